@@ -1,38 +1,54 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/api"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/cli"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/community"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/config"
 	grpcserver "github.com/fr0g-vibe/fr0g-ai-aip/internal/grpc"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/persona"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
 )
 
+// shutdownTimeout bounds how long in-flight requests may take to finish
+// after a shutdown signal
+const shutdownTimeout = 10 * time.Second
+
 // App holds the application state
 type App struct {
 	config  *config.Config
 	service *persona.Service
 }
 
-// NewApp creates a new application instance
-func NewApp() (*App, error) {
-	cfg := config.LoadConfig()
+// NewApp creates a new application instance from a fully loaded
+// configuration, which must pass validation
+func NewApp(cfg *config.Config) (*App, error) {
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %v", err)
 	}
 	
 	app := &App{config: cfg}
-	if err := app.ValidateConfig(); err != nil {
-		return nil, err
+	
+	middleware.SetTagLimits(cfg.Validation.MaxTagsPerEntity, cfg.Validation.MaxTagLength)
+	
+	if cfg.Community.PoolsFile != "" {
+		if err := community.LoadPoolsFile(cfg.Community.PoolsFile); err != nil {
+			return nil, fmt.Errorf("failed to load community pools: %v", err)
+		}
 	}
 	
 	// Initialize storage
@@ -42,15 +58,37 @@ func NewApp() (*App, error) {
 	}
 	
 	app.service = persona.NewService(store)
+	app.service.SetSoftDelete(cfg.Personas.SoftDelete)
+	
+	if cfg.Personas.BackupOnWrite {
+		backups, err := storage.NewBackupStore(cfg.Personas.BackupDir, cfg.Personas.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize persona backups: %v", err)
+		}
+		app.service.SetBackupStore(backups)
+	}
+	
 	return app, nil
 }
 
-// ValidateConfig validates application configuration
-func (app *App) ValidateConfig() error {
-	if app.config.HTTP.Port == app.config.GRPC.Port {
-		return fmt.Errorf("HTTP and gRPC ports cannot be the same: %s", app.config.HTTP.Port)
+// validateConfigCommand implements the validate-config subcommand: it
+// prints every problem with cfg, one per line, and fails if there are any
+func validateConfigCommand(cfg *config.Config, out io.Writer) error {
+	err := cfg.Validate()
+	if err == nil {
+		fmt.Fprintln(out, "Configuration is valid")
+		return nil
 	}
-	return nil
+	var problems config.ValidationErrors
+	if !errors.As(err, &problems) {
+		return err
+	}
+	
+	fmt.Fprintf(out, "Configuration has %d problem(s):\n", len(problems))
+	for _, problem := range problems {
+		fmt.Fprintf(out, "  %s\n", problem)
+	}
+	return fmt.Errorf("invalid configuration")
 }
 
 // CreateServers creates HTTP and gRPC server instances
@@ -60,19 +98,22 @@ func (app *App) CreateServers() (*api.Server, *grpcserver.PersonaServer, error)
 	return httpServer, grpcServer, nil
 }
 
-// RunCLI runs the CLI interface
-func (app *App) RunCLI() error {
+// RunCLI runs the CLI interface, printing list and get results in the given
+// output format
+func (app *App) RunCLI(output string) error {
 	cliConfig := cli.Config{
 		ClientType:  app.config.Client.Type,
 		StorageType: app.config.Storage.Type,
 		DataDir:     app.config.Storage.DataDir,
 		ServerURL:   app.config.Client.ServerURL,
+		Output:      output,
 		Service:     app.service,
 	}
 	return cli.ExecuteWithConfig(cliConfig)
 }
 
-// RunServers runs the HTTP and/or gRPC servers
+// RunServers runs the HTTP and/or gRPC servers until SIGINT or SIGTERM,
+// then drains them for up to shutdownTimeout
 func (app *App) RunServers(httpMode, grpcMode bool) error {
 	// Print startup banner
 	app.printStartupBanner()
@@ -80,46 +121,73 @@ func (app *App) RunServers(httpMode, grpcMode bool) error {
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	
+	var httpServer *api.Server
+	var grpcServer *grpcserver.GRPCServer
+	if httpMode {
+		httpServer = api.NewServer(app.config, app.service)
+	}
+	if grpcMode {
+		var err error
+		if grpcServer, err = grpcserver.NewGRPCServer(app.config, app.service); err != nil {
+			return fmt.Errorf("gRPC server error: %v", err)
+		}
+	}
 	
 	var wg sync.WaitGroup
 	errChan := make(chan error, 2)
 	
 	// Start HTTP server
-	if httpMode {
+	if httpServer != nil {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			fmt.Printf("Starting fr0g-ai-aip HTTP server on port %s (storage: %s)\n", 
 				app.config.HTTP.Port, app.config.Storage.Type)
-			if err := api.StartServerWithConfig(app.config, app.service); err != nil {
+			if err := httpServer.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				errChan <- fmt.Errorf("HTTP server error: %v", err)
 			}
 		}()
 	}
 	
 	// Start gRPC server
-	if grpcMode {
+	if grpcServer != nil {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			fmt.Printf("Starting fr0g-ai-aip gRPC server on port %s (storage: %s)\n", 
 				app.config.GRPC.Port, app.config.Storage.Type)
-			if err := grpcserver.StartGRPCServerWithConfig(app.config, app.service); err != nil {
+			if err := grpcServer.Start(); err != nil {
 				errChan <- fmt.Errorf("gRPC server error: %v", err)
 			}
 		}()
 	}
 	
 	// Wait for shutdown signal or error
+	var runErr error
 	select {
 	case sig := <-sigChan:
-		fmt.Printf("\nReceived signal %v, shutting down immediately...\n", sig)
-		os.Exit(0)
-	case err := <-errChan:
-		return err
+		fmt.Printf("\nReceived signal %v, shutting down...\n", sig)
+	case runErr = <-errChan:
+	}
+	
+	// Stop accepting connections and let in-flight requests finish
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if httpServer != nil {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			fmt.Printf("HTTP server did not shut down cleanly: %v\n", err)
+		}
+	}
+	if grpcServer != nil {
+		if err := grpcServer.Shutdown(ctx); err != nil {
+			fmt.Printf("gRPC server did not shut down cleanly: %v\n", err)
+		}
 	}
+	wg.Wait()
 	
-	return nil
+	return runErr
 }
 
 // printStartupBanner displays a startup banner with configuration info
@@ -127,8 +195,11 @@ func (app *App) printStartupBanner() {
 	fmt.Println("🐸 fr0g-ai-aip - AI Personas Management System")
 	fmt.Printf("   Version: 1.0.0\n")
 	fmt.Printf("   Storage: %s", app.config.Storage.Type)
-	if app.config.Storage.Type == "file" {
+	switch app.config.Storage.Type {
+	case "file":
 		fmt.Printf(" (%s)", app.config.Storage.DataDir)
+	case "redis":
+		fmt.Printf(" (%s)", app.config.Storage.RedisAddr)
 	}
 	fmt.Println()
 	fmt.Println("   Ready to manage your AI personas!")
@@ -136,6 +207,14 @@ func (app *App) printStartupBanner() {
 }
 
 func createStorage(cfg config.StorageConfig) (storage.Storage, error) {
+	store, err := createBackend(cfg)
+	if err != nil || cfg.CacheSize == 0 {
+		return store, err
+	}
+	return storage.NewCachingStorage(store, cfg.CacheSize), nil
+}
+
+func createBackend(cfg config.StorageConfig) (storage.Storage, error) {
 	switch cfg.Type {
 	case "memory":
 		return storage.NewMemoryStorage(), nil
@@ -148,8 +227,14 @@ func createStorage(cfg config.StorageConfig) (storage.Storage, error) {
 			return nil, fmt.Errorf("failed to initialize file storage at %s: %v", cfg.DataDir, err)
 		}
 		return store, nil
+	case "redis":
+		store, err := storage.NewRedisStorage(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize redis storage: %v", err)
+		}
+		return store, nil
 	default:
-		return nil, fmt.Errorf("unsupported storage type '%s' (supported: memory, file)", cfg.Type)
+		return nil, fmt.Errorf("unsupported storage type '%s' (supported: memory, file, redis)", cfg.Type)
 	}
 }
 
@@ -165,8 +250,11 @@ func run() error {
 		grpcMode   = flag.Bool("grpc", false, "Run gRPC server")
 		httpPort   = flag.String("port", "", "HTTP server port (overrides config)")
 		grpcPort   = flag.String("grpc-port", "", "gRPC server port (overrides config)")
+		configFile = flag.String("config", "", "YAML or JSON config file (environment variables override it)")
+		output     = flag.String("output", "", "CLI output format: table, json or yaml")
 		help       = flag.Bool("help", false, "Show help")
 	)
+	flag.StringVar(output, "o", "", "CLI output format (shorthand)")
 	flag.Parse()
 
 	if *help {
@@ -174,23 +262,39 @@ func run() error {
 		return nil
 	}
 
-	app, err := NewApp()
-	if err != nil {
-		return err
+	cfg := config.LoadConfig()
+	if *configFile != "" {
+		var err error
+		if cfg, err = config.LoadConfigFromFile(*configFile); err != nil {
+			return err
+		}
 	}
 	
 	// Override config with command line flags
 	if *httpPort != "" {
-		app.config.HTTP.Port = *httpPort
+		cfg.HTTP.Port = *httpPort
 	}
 	if *grpcPort != "" {
-		app.config.GRPC.Port = *grpcPort
+		cfg.GRPC.Port = *grpcPort
+	}
+	
+	// validate-config reports problems instead of failing on them, so it
+	// runs before NewApp
+	if flag.Arg(0) == "validate-config" {
+		return validateConfigCommand(cfg, os.Stdout)
+	}
+	
+	app, err := NewApp(cfg)
+	if err != nil {
+		return err
 	}
 
 	// Determine mode
 	if *serverMode || *grpcMode {
 		return app.RunServers(*serverMode, *grpcMode)
 	} else {
-		return app.RunCLI()
+		// Hand the CLI the subcommand and its arguments without our flags
+		os.Args = append([]string{os.Args[0]}, flag.Args()...)
+		return app.RunCLI(*output)
 	}
 }
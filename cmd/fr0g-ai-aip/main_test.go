@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bytes"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -8,7 +11,7 @@ import (
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/persona"
 )
 
-func TestAppValidateConfig(t *testing.T) {
+func TestNewAppRejectsPortConflict(t *testing.T) {
 	tests := []struct {
 		name        string
 		httpPort    string
@@ -31,21 +34,29 @@ func TestAppValidateConfig(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			app := &App{
-				config: &config.Config{
-					HTTP: config.HTTPConfig{Port: tt.httpPort},
-					GRPC: config.GRPCConfig{Port: tt.grpcPort},
-				},
-			}
+			cfg := config.DefaultConfig()
+			cfg.Storage.Type = "memory"
+			cfg.HTTP.Port = tt.httpPort
+			cfg.GRPC.Port = tt.grpcPort
 
-			err := app.ValidateConfig()
+			_, err := NewApp(cfg)
 			if (err != nil) != tt.expectError {
-				t.Errorf("ValidateConfig() error = %v, expectError %v", err, tt.expectError)
+				t.Errorf("NewApp() error = %v, expectError %v", err, tt.expectError)
 			}
 		})
 	}
 }
 
+func TestNewAppLoadsCommunityPools(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Storage.Type = "memory"
+	cfg.Community.PoolsFile = filepath.Join(t.TempDir(), "missing.json")
+
+	if _, err := NewApp(cfg); err == nil || !strings.Contains(err.Error(), "community pools") {
+		t.Errorf("Expected NewApp to fail on an unreadable pools file, got %v", err)
+	}
+}
+
 func TestCreateStorage(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -130,30 +141,35 @@ func TestAppCreateServers(t *testing.T) {
 	}
 }
 
-func TestAppValidateConfigIntegration(t *testing.T) {
-	// Test with a complete config structure
-	cfg := &config.Config{
-		HTTP: config.HTTPConfig{
-			Port:         "8080",
-			ReadTimeout:  30 * time.Second,
-			WriteTimeout: 30 * time.Second,
-		},
-		GRPC: config.GRPCConfig{
-			Port:           "9090",
-			MaxRecvMsgSize: 1024 * 1024,
-			MaxSendMsgSize: 1024 * 1024,
-		},
-		Storage: config.StorageConfig{
-			Type: "memory",
-		},
-		Security: config.SecurityConfig{
-			EnableAuth: false,
-		},
+func TestValidateConfigCommand(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Storage.Type = "memory"
+
+	var out bytes.Buffer
+	if err := validateConfigCommand(cfg, &out); err != nil {
+		t.Errorf("validate-config with valid config should not error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Configuration is valid") {
+		t.Errorf("expected a valid configuration to be reported, got %q", out.String())
 	}
 
-	app := &App{config: cfg}
-	err := app.ValidateConfig()
-	if err != nil {
-		t.Errorf("ValidateConfig() with valid config should not error: %v", err)
+	// Every problem is listed, not just the first
+	cfg.HTTP.Port = "9090"
+	cfg.GRPC.Port = "9090"
+	cfg.Storage.Type = "file"
+	cfg.Storage.DataDir = ""
+	cfg.Client.Type = "carrier-pigeon"
+	out.Reset()
+	if err := validateConfigCommand(cfg, &out); err == nil {
+		t.Error("validate-config with invalid config should error")
+	}
+	for _, want := range []string{
+		"ports: HTTP and gRPC ports cannot be the same: 9090",
+		"storage.data_dir: data directory is required for file storage",
+		"client.type:",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out.String())
+		}
 	}
 }
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/persona"
+)
+
+// identityAvatarHandler serves GET, PUT and DELETE /identities/{id}/avatar.
+// The avatar is sent and returned as raw image bytes, not JSON.
+func (s *Server) identityAvatarHandler(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		avatar, err := s.service.GetIdentityAvatar(id)
+		if err != nil {
+			writeAvatarError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", avatar.ContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(avatar.Data)))
+		if !avatar.UpdatedAt.IsZero() {
+			w.Header().Set("Last-Modified", avatar.UpdatedAt.UTC().Format(http.TimeFormat))
+		}
+		w.Write(avatar.Data)
+
+	case http.MethodPut:
+		contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			writeAvatarError(w, persona.ErrAvatarType)
+			return
+		}
+		// Read one byte past the limit so oversized images are detected
+		// without buffering all of them
+		data, err := io.ReadAll(io.LimitReader(r.Body, persona.MaxAvatarSize+1))
+		if err != nil {
+			writeReadError(w, err)
+			return
+		}
+		if err := s.service.SetIdentityAvatar(id, contentType, data); err != nil {
+			writeAvatarError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		if err := s.service.DeleteIdentityAvatar(id); err != nil {
+			writeAvatarError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeAvatarError reports an avatar operation failure with a status
+// matching its cause
+func writeAvatarError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, persona.ErrAvatarsUnsupported):
+		status = http.StatusNotImplemented
+	case errors.Is(err, persona.ErrAvatarTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, persona.ErrAvatarType):
+		status = http.StatusUnsupportedMediaType
+	case errors.Is(err, errs.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errs.ErrValidation):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
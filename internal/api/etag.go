@@ -0,0 +1,50 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// stableJSON serializes v for hashing. encoding/json writes struct fields in
+// declaration order and map keys sorted, so equal values always produce
+// equal bytes.
+func stableJSON(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// etagFor returns a strong entity tag for the given representation
+func etagFor(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified reports whether the request's If-None-Match header matches
+// etag. Weak comparison is used, as RFC 9110 requires for If-None-Match.
+func notModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSONWithETag writes data as JSON tagged with etag, or an empty
+// 304 Not Modified when the client already has that version
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, etag string, data []byte) {
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// personaFields lists the persona JSON keys that ?fields= may select
+var personaFields = map[string]bool{
+	"id":         true,
+	"name":       true,
+	"topic":      true,
+	"prompt":     true,
+	"context":    true,
+	"rag":        true,
+	"tags":       true,
+	"version":    true,
+	"parent_id":  true,
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+}
+
+// parseFields reads the comma-separated fields query parameter. It returns
+// nil when the parameter is absent, meaning the full representation.
+func parseFields(r *http.Request) ([]string, error) {
+	value := r.URL.Query().Get("fields")
+	if value == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !personaFields[field] {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("fields must name at least one field")
+	}
+	return fields, nil
+}
+
+// projectPersona returns p with only the given fields. Fields the persona
+// omits when empty stay omitted.
+func projectPersona(p types.Persona, fields []string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	projected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected, nil
+}
+
+// projectPersonas applies projectPersona to each persona
+func projectPersonas(personas []types.Persona, fields []string) ([]map[string]json.RawMessage, error) {
+	projected := make([]map[string]json.RawMessage, len(personas))
+	for i, p := range personas {
+		m, err := projectPersona(p, fields)
+		if err != nil {
+			return nil, err
+		}
+		projected[i] = m
+	}
+	return projected, nil
+}
@@ -3,12 +3,19 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/config"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/metrics"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/persona"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
@@ -137,6 +144,321 @@ func TestListPersonas(t *testing.T) {
 	}
 }
 
+func TestClonePersonaHandler(t *testing.T) {
+	server := createTestServer()
+	
+	persona := types.Persona{
+		Name:    "Test Expert",
+		Topic:   "Testing",
+		Prompt:  "You are a testing expert",
+		Context: map[string]string{"domain": "qa"},
+	}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	
+	req := httptest.NewRequest("POST", "/personas/"+persona.Id+"/clone", nil)
+	rr := httptest.NewRecorder()
+	server.personaHandler(rr, req)
+	
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	
+	var clone types.Persona
+	if err := json.Unmarshal(rr.Body.Bytes(), &clone); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if clone.Id == "" || clone.Id == persona.Id {
+		t.Errorf("expected a new persona ID, got %q", clone.Id)
+	}
+	if clone.Name != "Test Expert (copy)" || clone.Context["domain"] != "qa" {
+		t.Errorf("unexpected clone: %+v", clone)
+	}
+	
+	for method, status := range map[string]int{
+		"GET":  http.StatusMethodNotAllowed,
+		"POST": http.StatusNotFound,
+	} {
+		id := persona.Id
+		if method == "POST" {
+			id = "missing"
+		}
+		rr := httptest.NewRecorder()
+		server.personaHandler(rr, httptest.NewRequest(method, "/personas/"+id+"/clone", nil))
+		if rr.Code != status {
+			t.Errorf("%s: expected status %d, got %d", method, status, rr.Code)
+		}
+	}
+}
+
+func TestPersonaSoftDeleteAndRestore(t *testing.T) {
+	server := createTestServer()
+	server.service.SetSoftDelete(true)
+	
+	persona := types.Persona{Name: "Deleted Expert", Topic: "Deleting", Prompt: "You are a deleting expert"}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	
+	do := func(handler http.HandlerFunc, method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+	list := func(path string) []types.Persona {
+		rr := do(server.personasHandler, http.MethodGet, path)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 listing %s, got %d", path, rr.Code)
+		}
+		var personas []types.Persona
+		if err := json.Unmarshal(rr.Body.Bytes(), &personas); err != nil {
+			t.Fatal(err)
+		}
+		return personas
+	}
+	
+	if rr := do(server.personaHandler, http.MethodDelete, "/personas/"+persona.Id); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204 deleting, got %d", rr.Code)
+	}
+	if rr := do(server.personaHandler, http.MethodGet, "/personas/"+persona.Id); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a soft-deleted persona, got %d", rr.Code)
+	}
+	if personas := list("/personas"); len(personas) != 0 {
+		t.Errorf("expected no personas by default, got %d", len(personas))
+	}
+	if personas := list("/personas?include_deleted=true"); len(personas) != 1 || personas[0].DeletedAt == nil {
+		t.Errorf("expected the deleted persona with include_deleted, got %+v", personas)
+	}
+	if rr := do(server.personasHandler, http.MethodGet, "/personas?include_deleted=maybe"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid include_deleted, got %d", rr.Code)
+	}
+	
+	restorePath := "/personas/" + persona.Id + "/restore"
+	if rr := do(server.personaHandler, http.MethodGet, restorePath); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405 for GET restore, got %d", rr.Code)
+	}
+	rr := do(server.personaHandler, http.MethodPost, restorePath)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 restoring, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var restored types.Persona
+	json.Unmarshal(rr.Body.Bytes(), &restored)
+	if restored.Id != persona.Id || restored.DeletedAt != nil {
+		t.Errorf("expected the restored persona, got %+v", restored)
+	}
+	if personas := list("/personas"); len(personas) != 1 {
+		t.Errorf("expected the restored persona in the list, got %d", len(personas))
+	}
+	if rr := do(server.personaHandler, http.MethodPost, restorePath); rr.Code != http.StatusConflict {
+		t.Errorf("expected status 409 restoring a live persona, got %d", rr.Code)
+	}
+	if rr := do(server.personaHandler, http.MethodPost, "/personas/missing/restore"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 restoring a missing persona, got %d", rr.Code)
+	}
+}
+
+func TestDeletePersonaCascade(t *testing.T) {
+	server := createTestServer()
+	
+	persona := types.Persona{Name: "Cascade Expert", Topic: "Deleting", Prompt: "You are a cascading expert"}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	var memberIDs []string
+	for _, name := range []string{"First", "Second"} {
+		identity := &types.Identity{PersonaId: persona.Id, Name: name}
+		if err := server.service.CreateIdentity(identity); err != nil {
+			t.Fatal(err)
+		}
+		memberIDs = append(memberIDs, identity.Id)
+	}
+	community := &types.Community{Name: "Members", Type: "interest", MemberIds: memberIDs, Size: 2}
+	if err := server.service.GetStorage().CreateCommunity(community); err != nil {
+		t.Fatal(err)
+	}
+	
+	del := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.personaHandler(rr, httptest.NewRequest(http.MethodDelete, path, nil))
+		return rr
+	}
+	
+	if rr := del("/personas/" + persona.Id + "?cascade=sometimes"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid cascade value, got %d", rr.Code)
+	}
+	
+	rr := del("/personas/" + persona.Id + "?cascade=true")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result map[string]int
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result["identities_deleted"] != 2 {
+		t.Errorf("expected 2 identities deleted, got %v", result)
+	}
+	if identities, _ := server.service.ListIdentities(nil); len(identities) != 0 {
+		t.Errorf("expected no identities left, got %d", len(identities))
+	}
+	if c, _ := server.service.GetCommunity(community.Id); len(c.MemberIds) != 0 {
+		t.Errorf("expected community members to be removed, got %v", c.MemberIds)
+	}
+	
+	if rr := del("/personas/" + persona.Id + "?cascade=true"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing persona, got %d", rr.Code)
+	}
+}
+
+func TestPersonaETag(t *testing.T) {
+	server := createTestServer()
+	
+	persona := types.Persona{Name: "Cached Expert", Topic: "Caching", Prompt: "You are a caching expert"}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	
+	get := func(handler http.HandlerFunc, path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	
+	for name, tt := range map[string]struct {
+		handler http.HandlerFunc
+		path    string
+	}{
+		"single": {server.personaHandler, "/personas/" + persona.Id},
+		"list":   {server.personasHandler, "/personas"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rr := get(tt.handler, tt.path, "")
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rr.Code)
+			}
+			etag := rr.Header().Get("ETag")
+			if etag == "" {
+				t.Fatal("expected an ETag header")
+			}
+			
+			rr = get(tt.handler, tt.path, etag)
+			if rr.Code != http.StatusNotModified {
+				t.Errorf("expected status 304 for matching If-None-Match, got %d", rr.Code)
+			}
+			if rr.Body.Len() != 0 {
+				t.Errorf("expected empty body for 304, got %q", rr.Body.String())
+			}
+			
+			rr = get(tt.handler, tt.path, `"stale", W/`+etag)
+			if rr.Code != http.StatusNotModified {
+				t.Errorf("expected status 304 for weak match in a list, got %d", rr.Code)
+			}
+			
+			if rr := get(tt.handler, tt.path, `"stale"`); rr.Code != http.StatusOK {
+				t.Errorf("expected status 200 for stale If-None-Match, got %d", rr.Code)
+			}
+		})
+	}
+	
+	// An update changes both tags
+	before := get(server.personaHandler, "/personas/"+persona.Id, "").Header().Get("ETag")
+	beforeList := get(server.personasHandler, "/personas", "").Header().Get("ETag")
+	persona.Prompt = "You are an updated caching expert"
+	if err := server.service.UpdatePersona(persona.Id, persona); err != nil {
+		t.Fatal(err)
+	}
+	if rr := get(server.personaHandler, "/personas/"+persona.Id, before); rr.Code != http.StatusOK {
+		t.Errorf("expected status 200 after update, got %d", rr.Code)
+	}
+	if rr := get(server.personasHandler, "/personas", beforeList); rr.Code != http.StatusOK {
+		t.Errorf("expected list status 200 after update, got %d", rr.Code)
+	}
+}
+
+func TestPersonaListETagMatchesBody(t *testing.T) {
+	server := createTestServer()
+	for i := 0; i < 10; i++ {
+		p := types.Persona{Name: fmt.Sprintf("Expert %d", i), Topic: "Caching", Prompt: "You are a caching expert"}
+		if err := server.service.CreatePersona(&p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	
+	// Memory storage lists personas in map order, which varies between calls
+	bodies := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		rr := httptest.NewRecorder()
+		server.personasHandler(rr, httptest.NewRequest(http.MethodGet, "/personas", nil))
+		etag := rr.Header().Get("ETag")
+		if body, ok := bodies[etag]; ok && body != rr.Body.String() {
+			t.Fatalf("ETag %s was sent with two different bodies", etag)
+		}
+		bodies[etag] = rr.Body.String()
+	}
+	if len(bodies) != 1 {
+		t.Errorf("expected one ETag for an unchanged list, got %d", len(bodies))
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	server := createTestServer()
+	
+	rr := httptest.NewRecorder()
+	server.openAPIHandler(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to parse OpenAPI document: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.0") {
+		t.Errorf("expected an OpenAPI 3.0 document, got %q", doc.OpenAPI)
+	}
+	
+	raw, ok := doc.Paths["/personas"]["post"]
+	if !ok {
+		t.Fatal("expected a POST /personas operation")
+	}
+	var post struct {
+		Responses map[string]interface{} `json:"responses"`
+	}
+	if err := json.Unmarshal(raw, &post); err != nil {
+		t.Fatalf("failed to parse POST /personas: %v", err)
+	}
+	if _, ok := post.Responses["201"]; !ok {
+		t.Error("expected POST /personas to document 201")
+	}
+	for _, path := range []string{"/identities", "/communities", "/communities/generate"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("expected path %s", path)
+		}
+	}
+	for _, name := range []string{"Persona", "Identity", "Community"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("expected schema %s", name)
+		}
+	}
+	
+	rr = httptest.NewRecorder()
+	server.openAPIHandler(rr, httptest.NewRequest(http.MethodPost, "/openapi.json", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rr.Code)
+	}
+}
+
 func TestCreateIdentity(t *testing.T) {
 	server := createTestServer()
 	
@@ -190,138 +512,2332 @@ func TestCreateIdentity(t *testing.T) {
 	}
 }
 
-func TestInvalidPersonaCreation(t *testing.T) {
+func TestCreateIdentity_IsActive(t *testing.T) {
 	server := createTestServer()
 	
-	// Test with missing required fields
-	invalidPersona := map[string]interface{}{
-		"name": "Test Expert",
-		// Missing topic and prompt
+	persona := types.Persona{Name: "Test Expert", Topic: "Testing", Prompt: "You are a testing expert"}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
 	}
 	
-	jsonData, err := json.Marshal(invalidPersona)
-	if err != nil {
-		t.Fatal(err)
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"absent defaults to active", `{"persona_id":"` + persona.Id + `","name":"Default"}`, true},
+		{"explicit true", `{"persona_id":"` + persona.Id + `","name":"Active","is_active":true}`, true},
+		{"explicit false", `{"persona_id":"` + persona.Id + `","name":"Inactive","is_active":false}`, false},
 	}
 	
-	req, err := http.NewRequest("POST", "/personas", bytes.NewBuffer(jsonData))
-	if err != nil {
-		t.Fatal(err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/identities", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			server.identitiesHandler(rr, req)
+			
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+			}
+			var created types.Identity
+			if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+			
+			stored, err := server.service.GetIdentity(created.Id)
+			if err != nil {
+				t.Fatalf("failed to get identity: %v", err)
+			}
+			if stored.IsActive != tt.want {
+				t.Errorf("expected is_active %v, got %v", tt.want, stored.IsActive)
+			}
+		})
 	}
-	req.Header.Set("Content-Type", "application/json")
 	
+	body := `[{"persona_id":"` + persona.Id + `","name":"Batch Default"},{"persona_id":"` + persona.Id + `","name":"Batch Inactive","is_active":false}]`
+	req := httptest.NewRequest(http.MethodPost, "/identities/batch", strings.NewReader(body))
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(server.personasHandler)
-	handler.ServeHTTP(rr, req)
+	server.batchCreateIdentitiesHandler(rr, req)
 	
-	if status := rr.Code; status != http.StatusBadRequest {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Results []types.IdentityBatchResult `json:"results"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	for i, want := range []bool{true, false} {
+		stored, err := server.service.GetIdentity(response.Results[i].Id)
+		if err != nil {
+			t.Fatalf("failed to get identity %d: %v", i, err)
+		}
+		if stored.IsActive != want {
+			t.Errorf("batch identity %d: expected is_active %v, got %v", i, want, stored.IsActive)
+		}
 	}
 }
 
-func TestGetNonexistentPersona(t *testing.T) {
+func TestIdentityRelationships(t *testing.T) {
 	server := createTestServer()
 	
-	req, err := http.NewRequest("GET", "/personas/nonexistent", nil)
-	if err != nil {
+	persona := types.Persona{Name: "Test Expert", Topic: "Testing", Prompt: "You are a testing expert"}
+	if err := server.service.CreatePersona(&persona); err != nil {
 		t.Fatal(err)
 	}
+	alice := types.Identity{PersonaId: persona.Id, Name: "Alice"}
+	bob := types.Identity{PersonaId: persona.Id, Name: "Bob"}
+	for _, i := range []*types.Identity{&alice, &bob} {
+		if err := server.service.CreateIdentity(i); err != nil {
+			t.Fatal(err)
+		}
+	}
 	
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(server.personaHandler)
-	handler.ServeHTTP(rr, req)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.identityHandler(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
 	
-	if status := rr.Code; status != http.StatusNotFound {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	rr := do(http.MethodPost, "/identities/"+alice.Id+"/relationships", `{"to_id":"`+bob.Id+`","type":"friend","strength":0.7}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var created types.Relationship
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if created.FromId != alice.Id || created.ToId != bob.Id || created.Id == "" {
+		t.Errorf("unexpected relationship: %+v", created)
+	}
+	
+	// Visible from both ends
+	for _, id := range []string{alice.Id, bob.Id} {
+		rr := do(http.MethodGet, "/identities/"+id+"/relationships", "")
+		var list []types.Relationship
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if len(list) != 1 || list[0].Id != created.Id {
+			t.Errorf("expected the friendship for %s, got %+v", id, list)
+		}
+	}
+	
+	for name, tt := range map[string]struct {
+		method, path, body string
+		status             int
+	}{
+		"self link":        {http.MethodPost, "/identities/" + alice.Id + "/relationships", `{"to_id":"` + alice.Id + `","type":"friend"}`, http.StatusBadRequest},
+		"invalid json":     {http.MethodPost, "/identities/" + alice.Id + "/relationships", `{`, http.StatusBadRequest},
+		"missing identity": {http.MethodGet, "/identities/missing/relationships", "", http.StatusNotFound},
+		"unknown resource": {http.MethodGet, "/identities/" + alice.Id + "/friends", "", http.StatusNotFound},
+		"wrong method":     {http.MethodPut, "/identities/" + alice.Id + "/relationships", "", http.StatusMethodNotAllowed},
+		"unknown link":     {http.MethodDelete, "/identities/" + alice.Id + "/relationships/missing", "", http.StatusNotFound},
+	} {
+		if rr := do(tt.method, tt.path, tt.body); rr.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", name, tt.status, rr.Code)
+		}
+	}
+	
+	if rr := do(http.MethodDelete, "/identities/"+bob.Id+"/relationships/"+created.Id, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", rr.Code)
+	}
+	if list, _ := server.service.ListRelationships(alice.Id); len(list) != 0 {
+		t.Errorf("expected relationship to be deleted, got %+v", list)
 	}
 }
 
-func TestMethodNotAllowed(t *testing.T) {
+func TestUpdateIdentityRespondsWithStored(t *testing.T) {
 	server := createTestServer()
 	
-	req, err := http.NewRequest("PATCH", "/personas", nil)
+	persona := types.Persona{Name: "Test Expert", Topic: "Testing", Prompt: "You are a testing expert"}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	identity := types.Identity{PersonaId: persona.Id, Name: "Test Identity"}
+	if err := server.service.CreateIdentity(&identity); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := server.service.GetIdentity(identity.Id)
 	if err != nil {
 		t.Fatal(err)
 	}
 	
+	// The body carries neither the ID nor the creation time
+	body := fmt.Sprintf(`{"persona_id": %q, "name": "Renamed"}`, persona.Id)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(server.personasHandler)
-	handler.ServeHTTP(rr, req)
-	
-	if status := rr.Code; status != http.StatusMethodNotAllowed {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusMethodNotAllowed)
+	server.identityHandler(rr, httptest.NewRequest("PUT", "/identities/"+identity.Id, strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response types.Identity
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if response.Id != identity.Id || response.Name != "Renamed" {
+		t.Errorf("expected the renamed identity %s, got %+v", identity.Id, response)
+	}
+	if !response.CreatedAt.Equal(stored.CreatedAt) {
+		t.Errorf("expected CreatedAt %v, got %v", stored.CreatedAt, response.CreatedAt)
+	}
+	if response.UpdatedAt.IsZero() {
+		t.Error("expected UpdatedAt to be set")
 	}
 }
 
-func TestCommunityGeneration(t *testing.T) {
+func TestPatchIdentity(t *testing.T) {
 	server := createTestServer()
 	
-	// Create a persona first
 	persona := types.Persona{
-		Name:   "Community Expert",
-		Topic:  "Community Building",
-		Prompt: "You are a community building expert",
+		Name:   "Test Expert",
+		Topic:  "Testing",
+		Prompt: "You are a testing expert",
 	}
 	if err := server.service.CreatePersona(&persona); err != nil {
 		t.Fatal(err)
 	}
+	identity := types.Identity{PersonaId: persona.Id, Name: "Test Identity", Description: "Kept"}
+	if err := server.service.CreateIdentity(&identity); err != nil {
+		t.Fatal(err)
+	}
 	
-	request := map[string]interface{}{
-		"name":        "Test Community",
-		"description": "A test community",
-		"type":        "demographic",
-		"target_size": 5,
-		"generation_config": map[string]interface{}{
-			"persona_weights": map[string]float64{
-				persona.Id: 1.0,
-			},
-			"age_distribution": map[string]interface{}{
-				"mean":     35.0,
-				"std_dev":  10.0,
-				"min_age":  18,
-				"max_age":  65,
-				"skewness": 0.0,
-			},
-			"political_spread":    0.8,
-			"interest_spread":     0.9,
-			"socioeconomic_range": 0.7,
-			"activity_level":      0.6,
-		},
+	req := httptest.NewRequest("PATCH", "/identities/"+identity.Id, bytes.NewBufferString(`{"is_active": false}`))
+	rr := httptest.NewRecorder()
+	server.identityHandler(rr, req)
+	
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var response types.Identity
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if response.IsActive {
+		t.Error("expected identity to be inactive after patch")
+	}
+	if response.Name != "Test Identity" || response.Description != "Kept" {
+		t.Errorf("expected unpatched fields to be kept, got %+v", response)
 	}
 	
-	jsonData, err := json.Marshal(request)
-	if err != nil {
-		t.Fatal(err)
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		status int
+	}{
+		{"missing identity", "missing", `{"name": "x"}`, http.StatusNotFound},
+		{"invalid json", identity.Id, `{`, http.StatusBadRequest},
+		{"read-only field", identity.Id, `{"id": "other"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", "/identities/"+tt.id, bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+			server.identityHandler(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rr.Code)
+			}
+		})
 	}
+}
+
+func TestIdentityTagHandlers(t *testing.T) {
+	server := createTestServer()
 	
-	req, err := http.NewRequest("POST", "/communities/generate", bytes.NewBuffer(jsonData))
-	if err != nil {
+	persona := types.Persona{Name: "Test Expert", Topic: "Testing", Prompt: "You are a testing expert"}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	identity := types.Identity{PersonaId: persona.Id, Name: "Test Identity", Tags: []string{"kept"}}
+	if err := server.service.CreateIdentity(&identity); err != nil {
 		t.Fatal(err)
 	}
-	req.Header.Set("Content-Type", "application/json")
 	
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(server.generateCommunityHandler)
-	handler.ServeHTTP(rr, req)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		server.identityHandler(rr, req)
+		return rr
+	}
+	tagsOf := func(rr *httptest.ResponseRecorder) []string {
+		t.Helper()
+		var response types.Identity
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return response.Tags
+	}
 	
-	if status := rr.Code; status != http.StatusCreated {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	// Adding the same tag twice does not duplicate it
+	for n := 0; n < 2; n++ {
+		rr := do("POST", "/identities/"+identity.Id+"/tags", `{"tag": "new"}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		if tags := tagsOf(rr); !slices.Equal(tags, []string{"kept", "new"}) {
+			t.Errorf("expected tags [kept new], got %v", tags)
+		}
 	}
 	
-	var response types.Community
-	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
-		t.Errorf("failed to parse response: %v", err)
+	// Removing a tag the identity does not have succeeds
+	rr := do("DELETE", "/identities/"+identity.Id+"/tags/missing", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if tags := tagsOf(rr); !slices.Equal(tags, []string{"kept", "new"}) {
+		t.Errorf("expected tags unchanged, got %v", tags)
 	}
 	
-	if response.Name != "Test Community" {
-		t.Errorf("expected name 'Test Community', got %s", response.Name)
+	rr = do("DELETE", "/identities/"+identity.Id+"/tags/kept", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if tags := tagsOf(rr); !slices.Equal(tags, []string{"new"}) {
+		t.Errorf("expected tags [new], got %v", tags)
+	}
+	
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"add to missing identity", "POST", "/identities/missing/tags", `{"tag": "x"}`, http.StatusNotFound},
+		{"remove from missing identity", "DELETE", "/identities/missing/tags/x", "", http.StatusNotFound},
+		{"empty tag", "POST", "/identities/" + identity.Id + "/tags", `{"tag": ""}`, http.StatusBadRequest},
+		{"invalid json", "POST", "/identities/" + identity.Id + "/tags", `{`, http.StatusBadRequest},
+		{"wrong method", "GET", "/identities/" + identity.Id + "/tags", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := do(tt.method, tt.path, tt.body); rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestIdentityAvatarHandler(t *testing.T) {
+	server := createTestServer()
+	
+	p := types.Persona{Name: "Test Expert", Topic: "Testing", Prompt: "You are a testing expert"}
+	if err := server.service.CreatePersona(&p); err != nil {
+		t.Fatal(err)
+	}
+	identity := types.Identity{PersonaId: p.Id, Name: "Pictured Identity"}
+	if err := server.service.CreateIdentity(&identity); err != nil {
+		t.Fatal(err)
+	}
+	
+	do := func(method, id, contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/identities/"+id+"/avatar", bytes.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rr := httptest.NewRecorder()
+		server.identityHandler(rr, req)
+		return rr
+	}
+	
+	jpeg := append([]byte("\xff\xd8\xff\xe0"), make([]byte, 128)...)
+	if rr := do("PUT", identity.Id, "image/jpeg", jpeg); rr.Code != http.StatusNoContent {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusNoContent, rr.Body.String())
+	}
+	rr := do("GET", identity.Id, "", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Type"); got != "image/jpeg" {
+		t.Errorf("expected Content-Type image/jpeg, got %q", got)
+	}
+	if !bytes.Equal(rr.Body.Bytes(), jpeg) {
+		t.Errorf("expected the uploaded image back, got %d bytes", rr.Body.Len())
+	}
+	
+	oversized := append([]byte("\xff\xd8\xff\xe0"), make([]byte, persona.MaxAvatarSize)...)
+	tests := []struct {
+		name        string
+		method      string
+		id          string
+		contentType string
+		body        []byte
+		status      int
+	}{
+		{"too large", "PUT", identity.Id, "image/jpeg", oversized, http.StatusRequestEntityTooLarge},
+		{"unsupported type", "PUT", identity.Id, "text/plain", []byte("hello"), http.StatusUnsupportedMediaType},
+		{"mismatched type", "PUT", identity.Id, "image/png", jpeg, http.StatusUnsupportedMediaType},
+		{"missing identity", "PUT", "missing", "image/jpeg", jpeg, http.StatusNotFound},
+		{"wrong method", "POST", identity.Id, "image/jpeg", jpeg, http.StatusMethodNotAllowed},
+		{"delete", "DELETE", identity.Id, "", nil, http.StatusNoContent},
+		{"deleted", "GET", identity.Id, "", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := do(tt.method, tt.id, tt.contentType, tt.body); rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestUpdateIdentityAttributes(t *testing.T) {
+	server := createTestServer()
+	
+	persona := types.Persona{Name: "Test Expert", Topic: "Testing", Prompt: "You are a testing expert"}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	identity := types.Identity{
+		PersonaId:      persona.Id,
+		Name:           "Test Identity",
+		Tags:           []string{"kept"},
+		RichAttributes: &types.RichAttributes{Demographics: &types.Demographics{Age: 30}},
+	}
+	if err := server.service.CreateIdentity(&identity); err != nil {
+		t.Fatal(err)
+	}
+	
+	put := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/identities/"+id+"/attributes", bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		server.identityHandler(rr, req)
+		return rr
+	}
+	
+	rr := put(identity.Id, `{"demographics": {"age": 52, "occupation": "pilot"}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response types.Identity
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if response.Name != "Test Identity" || len(response.Tags) != 1 || response.Tags[0] != "kept" {
+		t.Errorf("expected name and tags to be untouched, got %+v", response)
+	}
+	if dem := response.RichAttributes.GetDemographics(); dem.GetAge() != 52 || dem.GetOccupation() != "pilot" {
+		t.Errorf("expected new demographics, got %+v", dem)
+	}
+	
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		status int
+	}{
+		{"missing identity", "missing", `{}`, http.StatusNotFound},
+		{"invalid json", identity.Id, `{`, http.StatusBadRequest},
+		{"age out of range", identity.Id, `{"demographics": {"age": 151}}`, http.StatusBadRequest},
+		{"personality out of range", identity.Id, `{"psychographics": {"personality": {"openness": 2}}}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := put(tt.id, tt.body); rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+	
+	req := httptest.NewRequest("GET", "/identities/"+identity.Id+"/attributes", nil)
+	rr = httptest.NewRecorder()
+	server.identityHandler(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405 for GET, got %d", rr.Code)
+	}
+}
+
+func TestListIdentitiesDeepSearch(t *testing.T) {
+	server := createTestServer()
+	
+	persona := types.Persona{
+		Name:   "Test Expert",
+		Topic:  "Testing",
+		Prompt: "You are a testing expert",
+	}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	identity := types.Identity{
+		PersonaId: persona.Id,
+		Name:      "Test Identity",
+		RichAttributes: &types.RichAttributes{
+			Preferences: &types.Preferences{Interests: []string{"birdwatching"}},
+		},
+	}
+	if err := server.service.CreateIdentity(&identity); err != nil {
+		t.Fatal(err)
+	}
+	
+	tests := []struct {
+		query  string
+		status int
+		count  int
+	}{
+		{"search=birdwatching", http.StatusOK, 0},
+		{"search=birdwatching&deep=true", http.StatusOK, 1},
+		{"search=birdwatching&deep=maybe", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/identities?"+tt.query, nil)
+		rr := httptest.NewRecorder()
+		server.identitiesHandler(rr, req)
+		
+		if rr.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.query, tt.status, rr.Code)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var identities []types.Identity
+		if err := json.Unmarshal(rr.Body.Bytes(), &identities); err != nil {
+			t.Fatalf("%s: failed to parse response: %v", tt.query, err)
+		}
+		if len(identities) != tt.count {
+			t.Errorf("%s: expected %d identities, got %d", tt.query, tt.count, len(identities))
+		}
+	}
+}
+
+func TestBatchCreateIdentities(t *testing.T) {
+	server := createTestServer()
+	
+	persona := types.Persona{
+		Name:   "Test Expert",
+		Topic:  "Testing",
+		Prompt: "You are a testing expert",
+	}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	
+	batch := []map[string]interface{}{
+		{"persona_id": persona.Id, "name": "First Identity"},
+		{"persona_id": persona.Id},
+		{"persona_id": persona.Id, "name": "Second Identity"},
+	}
+	jsonData, err := json.Marshal(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	req := httptest.NewRequest("POST", "/identities/batch", bytes.NewBuffer(jsonData))
+	rr := httptest.NewRecorder()
+	server.batchCreateIdentitiesHandler(rr, req)
+	
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	
+	var response struct {
+		Results []types.IdentityBatchResult `json:"results"`
+		Created int                         `json:"created"`
+		Failed  int                         `json:"failed"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	
+	if response.Created != 2 || response.Failed != 1 {
+		t.Errorf("expected 2 created and 1 failed, got %d and %d", response.Created, response.Failed)
+	}
+	if len(response.Results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(response.Results))
+	}
+	if response.Results[1].Error == "" {
+		t.Error("expected identity without a name to fail")
+	}
+	if response.Results[0].Id == "" || response.Results[2].Id == "" {
+		t.Error("expected valid identities to be created")
+	}
+	
+	// Rejected requests
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"wrong method", "GET", "", http.StatusMethodNotAllowed},
+		{"invalid json", "POST", "{", http.StatusBadRequest},
+		{"empty batch", "POST", "[]", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/identities/batch", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+			server.batchCreateIdentitiesHandler(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	server := createTestServer()
+	handler := middleware.BodyLimitMiddleware(1024)(http.HandlerFunc(server.identitiesHandler))
+	
+	oversized := `{"name": "Huge", "description": "` + strings.Repeat("x", 2048) + `"}`
+	for _, contentLength := range []int64{int64(len(oversized)), -1} {
+		req := httptest.NewRequest("POST", "/identities", strings.NewReader(oversized))
+		req.ContentLength = contentLength
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status 413 with Content-Length %d, got %d: %s", contentLength, rr.Code, rr.Body.String())
+		}
+	}
+	
+	// Endpoints that read the raw body report it too
+	importHandler := middleware.BodyLimitMiddleware(1024)(http.HandlerFunc(server.importPersonasHandler))
+	req := httptest.NewRequest("POST", "/personas/import", strings.NewReader(oversized))
+	req.ContentLength = -1
+	rr := httptest.NewRecorder()
+	importHandler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413 from import, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestInvalidPersonaCreation(t *testing.T) {
+	server := createTestServer()
+	
+	// Test with missing required fields
+	invalidPersona := map[string]interface{}{
+		"name": "Test Expert",
+		// Missing topic and prompt
+	}
+	
+	jsonData, err := json.Marshal(invalidPersona)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	req, err := http.NewRequest("POST", "/personas", bytes.NewBuffer(jsonData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.personasHandler)
+	handler.ServeHTTP(rr, req)
+	
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestGetNonexistentPersona(t *testing.T) {
+	server := createTestServer()
+	
+	req, err := http.NewRequest("GET", "/personas/nonexistent", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.personaHandler)
+	handler.ServeHTTP(rr, req)
+	
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	server := createTestServer()
+	
+	req, err := http.NewRequest("PATCH", "/personas", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.personasHandler)
+	handler.ServeHTTP(rr, req)
+	
+	if status := rr.Code; status != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestExportCommunityCSV(t *testing.T) {
+	server := createTestServer()
+	store := server.service.GetStorage()
+	
+	persona := types.Persona{
+		Name:   "Community Expert",
+		Topic:  "Community Building",
+		Prompt: "You are a community building expert",
+	}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	
+	withAttrs := types.Identity{
+		PersonaId: persona.Id,
+		Name:      "Alice",
+		RichAttributes: &types.RichAttributes{
+			Demographics: &types.Demographics{Age: 30, Gender: "female"},
+		},
+	}
+	withoutAttrs := types.Identity{PersonaId: persona.Id, Name: "Bob"}
+	for _, i := range []*types.Identity{&withAttrs, &withoutAttrs} {
+		if err := store.CreateIdentity(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	
+	community := types.Community{
+		Name:      "Export Community",
+		Type:      "interest",
+		MemberIds: []string{withAttrs.Id, withoutAttrs.Id},
+	}
+	if err := store.CreateCommunity(&community); err != nil {
+		t.Fatal(err)
+	}
+	
+	req := httptest.NewRequest("GET", "/communities/"+community.Id+"/export?format=csv", nil)
+	rr := httptest.NewRecorder()
+	server.communityHandler(rr, req)
+	
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "text/csv" {
+		t.Errorf("expected text/csv content type, got %s", contentType)
+	}
+	
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and 2 rows, got %d lines: %q", len(lines), lines)
+	}
+	if lines[1] != withAttrs.Id+",Alice,30,female,,,," {
+		t.Errorf("unexpected row for member with attributes: %s", lines[1])
+	}
+	if lines[2] != withoutAttrs.Id+",Bob,,,,,," {
+		t.Errorf("unexpected row for member without attributes: %s", lines[2])
+	}
+	
+	// Unsupported format and unknown community
+	for path, status := range map[string]int{
+		"/communities/" + community.Id + "/export?format=xml": http.StatusBadRequest,
+		"/communities/missing/export":                         http.StatusNotFound,
+	} {
+		rr := httptest.NewRecorder()
+		server.communityHandler(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != status {
+			t.Errorf("%s: expected status %d, got %d", path, status, rr.Code)
+		}
+	}
+}
+
+func TestListCommunitiesFilterAndSort(t *testing.T) {
+	server := createTestServer()
+	store := server.service.GetStorage()
+	
+	for _, c := range []types.Community{
+		{Name: "Narrow", Type: "interest", Size: 3, Diversity: 0.2, Cohesion: 0.9, IsActive: true, Attributes: map[string]interface{}{
+			"average_age":            29.0,
+			"political_distribution": map[string]float64{"liberal": 0.67, "moderate": 0.33},
+		}},
+		{Name: "Broad", Type: "interest", Size: 10, Diversity: 0.8, Cohesion: 0.4, IsActive: true, Attributes: map[string]interface{}{
+			"average_age":            52.5,
+			"political_distribution": map[string]float64{"conservative": 0.4, "liberal": 0.3, "moderate": 0.3},
+		}},
+		{Name: "Mixed", Type: "interest", Size: 6, Diversity: 0.6, Cohesion: 0.7, IsActive: false},
+	} {
+		if err := store.CreateCommunity(&c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	
+	list := func(query string) (int, []string) {
+		rr := httptest.NewRecorder()
+		server.communitiesHandler(rr, httptest.NewRequest(http.MethodGet, "/communities?"+query, nil))
+		if rr.Code != http.StatusOK {
+			return rr.Code, nil
+		}
+		var communities []types.Community
+		if err := json.Unmarshal(rr.Body.Bytes(), &communities); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		var names []string
+		for _, c := range communities {
+			names = append(names, c.Name)
+		}
+		return rr.Code, names
+	}
+	
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"min_diversity=0.5&sort=diversity", []string{"Mixed", "Broad"}},
+		{"max_diversity=0.6&sort=diversity&order=desc", []string{"Mixed", "Narrow"}},
+		{"min_size=4&max_size=8", []string{"Mixed"}},
+		{"is_active=true&sort=size&order=desc", []string{"Broad", "Narrow"}},
+		{"sort=cohesion", []string{"Broad", "Mixed", "Narrow"}},
+		{"min_avg_age=30", []string{"Broad"}},
+		{"min_avg_age=20&max_avg_age=60&sort=size", []string{"Narrow", "Broad"}},
+		{"dominant_political=liberal", []string{"Narrow"}},
+	}
+	for _, tt := range tests {
+		status, names := list(tt.query)
+		if status != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", tt.query, status)
+			continue
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expected %v, got %v", tt.query, tt.want, names)
+		}
+	}
+	
+	for _, query := range []string{"min_diversity=high", "max_diversity=1.5", "min_size=-1", "is_active=yes", "sort=name", "sort=size&order=up", "min_avg_age=old", "max_avg_age=-5"} {
+		if status, _ := list(query); status != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, status)
+		}
+	}
+}
+
+func TestCommunityBundleHandlers(t *testing.T) {
+	server := createTestServer()
+	store := server.service.GetStorage()
+	
+	persona := types.Persona{Name: "Bundled", Topic: "Sharing", Prompt: "You share communities"}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	member := types.Identity{PersonaId: persona.Id, Name: "Carol"}
+	if err := store.CreateIdentity(&member); err != nil {
+		t.Fatal(err)
+	}
+	community := types.Community{Name: "Shared", Type: "interest", MemberIds: []string{member.Id}}
+	if err := store.CreateCommunity(&community); err != nil {
+		t.Fatal(err)
+	}
+	
+	rr := httptest.NewRecorder()
+	server.communityHandler(rr, httptest.NewRequest("GET", "/communities/"+community.Id+"/bundle", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	bundle := rr.Body.Bytes()
+	
+	rr = httptest.NewRecorder()
+	server.importCommunityBundleHandler(rr, httptest.NewRequest("POST", "/communities/import-bundle", bytes.NewReader(bundle)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var imported types.Community
+	if err := json.Unmarshal(rr.Body.Bytes(), &imported); err != nil {
+		t.Fatal(err)
+	}
+	if imported.Id == community.Id || len(imported.MemberIds) != 1 || imported.MemberIds[0] == member.Id {
+		t.Errorf("expected a copy with a new id and remapped member, got %+v", imported)
+	}
+	
+	rr = httptest.NewRecorder()
+	server.communityHandler(rr, httptest.NewRequest("GET", "/communities/missing/bundle", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing community, got %d", rr.Code)
+	}
+	
+	rr = httptest.NewRecorder()
+	server.importCommunityBundleHandler(rr, httptest.NewRequest("POST", "/communities/import-bundle", strings.NewReader("{}")))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an empty bundle, got %d", rr.Code)
+	}
+}
+
+func TestEvolveCommunityHandler(t *testing.T) {
+	server := createTestServer()
+	store := server.service.GetStorage()
+	
+	persona := types.Persona{Name: "Community Expert", Topic: "Community Building", Prompt: "You are a community building expert"}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	identity := types.Identity{
+		PersonaId:      persona.Id,
+		Name:           "Aging Member",
+		RichAttributes: &types.RichAttributes{Demographics: &types.Demographics{Age: 40}},
+	}
+	if err := store.CreateIdentity(&identity); err != nil {
+		t.Fatal(err)
+	}
+	community := types.Community{Name: "Cohort", Type: "demographic", MemberIds: []string{identity.Id}, Size: 1}
+	if err := store.CreateCommunity(&community); err != nil {
+		t.Fatal(err)
+	}
+	
+	evolve := func(method, id, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.communityHandler(rr, httptest.NewRequest(method, "/communities/"+id+"/evolve", strings.NewReader(body)))
+		return rr
+	}
+	
+	if rr := evolve(http.MethodPost, community.Id, `{"years": 5}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	member, _ := store.GetIdentity(identity.Id)
+	if age := member.RichAttributes.GetDemographics().GetAge(); age != 45 {
+		t.Errorf("expected age 45 after 5 years, got %d", age)
+	}
+	
+	for name, tt := range map[string]struct {
+		method, id, body string
+		status           int
+	}{
+		"wrong method":  {http.MethodGet, community.Id, "", http.StatusMethodNotAllowed},
+		"invalid json":  {http.MethodPost, community.Id, "{", http.StatusBadRequest},
+		"missing years": {http.MethodPost, community.Id, `{}`, http.StatusBadRequest},
+		"not found":     {http.MethodPost, "missing", `{"years": 1}`, http.StatusNotFound},
+	} {
+		if rr := evolve(tt.method, tt.id, tt.body); rr.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", name, tt.status, rr.Code)
+		}
+	}
+}
+
+func TestRecalculateCommunityHandler(t *testing.T) {
+	server := createTestServer()
+	store := server.service.GetStorage()
+	
+	persona := types.Persona{Name: "Community Expert", Topic: "Community Building", Prompt: "You are a community building expert"}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	identity := types.Identity{
+		PersonaId:      persona.Id,
+		Name:           "Counted Member",
+		RichAttributes: &types.RichAttributes{Demographics: &types.Demographics{Age: 40}},
+	}
+	if err := store.CreateIdentity(&identity); err != nil {
+		t.Fatal(err)
+	}
+	community := types.Community{Name: "Cohort", Type: "demographic", MemberIds: []string{identity.Id}, Size: 1}
+	if err := store.CreateCommunity(&community); err != nil {
+		t.Fatal(err)
+	}
+	
+	recalculate := func(method, id string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.communityHandler(rr, httptest.NewRequest(method, "/communities/"+id+"/recalculate", nil))
+		return rr
+	}
+	
+	rr := recalculate(http.MethodPost, community.Id)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response types.Community
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if response.Attributes["average_age"] != 40.0 {
+		t.Errorf("expected recalculated attributes, got %v", response.Attributes)
+	}
+	
+	if rr := recalculate(http.MethodGet, community.Id); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("wrong method: expected status 405, got %d", rr.Code)
+	}
+	if rr := recalculate(http.MethodPost, "missing"); rr.Code != http.StatusNotFound {
+		t.Errorf("not found: expected status 404, got %d", rr.Code)
+	}
+}
+
+func TestMergeCommunityHandler(t *testing.T) {
+	server := createTestServer()
+	store := server.service.GetStorage()
+	
+	persona := types.Persona{Name: "Community Expert", Topic: "Community Building", Prompt: "You are a community building expert"}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	
+	ids := make([]string, 3)
+	for n := range ids {
+		identity := types.Identity{PersonaId: persona.Id, Name: fmt.Sprintf("Member %d", n)}
+		if err := store.CreateIdentity(&identity); err != nil {
+			t.Fatal(err)
+		}
+		ids[n] = identity.Id
+	}
+	
+	target := types.Community{Name: "Target", Type: "interest", MemberIds: ids[:2], MaxMembers: 3}
+	source := types.Community{Name: "Source", Type: "interest", MemberIds: ids[1:], MaxMembers: 3}
+	small := types.Community{Name: "Small", Type: "interest", MemberIds: ids[:1], MaxMembers: 1}
+	for _, c := range []*types.Community{&target, &source, &small} {
+		if err := store.CreateCommunity(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	
+	merge := func(id, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.communityHandler(rr, httptest.NewRequest(http.MethodPost, "/communities/"+id+"/merge", strings.NewReader(body)))
+		return rr
+	}
+	
+	rr := merge(target.Id, `{"source_id":"`+source.Id+`"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var merged types.Community
+	if err := json.Unmarshal(rr.Body.Bytes(), &merged); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if merged.Size != 3 {
+		t.Errorf("expected 3 members after merge, got %d", merged.Size)
+	}
+	if _, err := store.GetCommunity(source.Id); err != nil {
+		t.Error("expected source to be kept without delete_source")
+	}
+	
+	for name, tt := range map[string]struct {
+		id, body string
+		status   int
+	}{
+		"over limit":     {small.Id, `{"source_id":"` + source.Id + `"}`, http.StatusConflict},
+		"missing source": {target.Id, `{"source_id":"missing"}`, http.StatusNotFound},
+		"missing target": {"missing", `{"source_id":"` + source.Id + `"}`, http.StatusNotFound},
+		"no source id":   {target.Id, `{}`, http.StatusBadRequest},
+		"invalid json":   {target.Id, `{`, http.StatusBadRequest},
+	} {
+		if rr := merge(tt.id, tt.body); rr.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", name, tt.status, rr.Code)
+		}
+	}
+}
+
+func TestCommunityGeneration(t *testing.T) {
+	server := createTestServer()
+	
+	// Create a persona first
+	persona := types.Persona{
+		Name:   "Community Expert",
+		Topic:  "Community Building",
+		Prompt: "You are a community building expert",
+	}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	
+	request := map[string]interface{}{
+		"name":        "Test Community",
+		"description": "A test community",
+		"type":        "demographic",
+		"target_size": 5,
+		"generation_config": map[string]interface{}{
+			"persona_weights": map[string]float64{
+				persona.Id: 1.0,
+			},
+			"age_distribution": map[string]interface{}{
+				"mean":     35.0,
+				"std_dev":  10.0,
+				"min_age":  18,
+				"max_age":  65,
+				"skewness": 0.0,
+			},
+			"political_spread":    0.8,
+			"interest_spread":     0.9,
+			"socioeconomic_range": 0.7,
+			"activity_level":      0.6,
+		},
+	}
+	
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	req, err := http.NewRequest("POST", "/communities/generate", bytes.NewBuffer(jsonData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.generateCommunityHandler)
+	handler.ServeHTTP(rr, req)
+	
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	
+	var response types.Community
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Errorf("failed to parse response: %v", err)
+	}
+	
+	if response.Name != "Test Community" {
+		t.Errorf("expected name 'Test Community', got %s", response.Name)
 	}
 	
 	if response.Size != 5 {
 		t.Errorf("expected size 5, got %d", response.Size)
 	}
 	
-	if len(response.MemberIds) != 5 {
-		t.Errorf("expected 5 member IDs, got %d", len(response.MemberIds))
+	if len(response.MemberIds) != 5 {
+		t.Errorf("expected 5 member IDs, got %d", len(response.MemberIds))
+	}
+}
+
+func TestIdentitySchemaHandler(t *testing.T) {
+	server := createTestServer()
+	
+	req, err := http.NewRequest("GET", "/schema/identity.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.identitySchemaHandler)
+	handler.ServeHTTP(rr, req)
+	
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	
+	var schema map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &schema); err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+	
+	// Known-good payload produced from the Go structs
+	good := types.Identity{
+		Id:        "id-1",
+		PersonaId: "persona-1",
+		Name:      "Alice",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		IsActive:  true,
+		Tags:      []string{"analyst"},
+		RichAttributes: &types.RichAttributes{
+			Demographics: &types.Demographics{
+				Age:       34,
+				Gender:    "female",
+				Languages: []string{"en"},
+				Location:  &types.Location{Country: "US", City: "Austin"},
+			},
+			Psychographics: &types.Psychographics{
+				Personality:   &types.Personality{Openness: 0.7, Neuroticism: 0.2},
+				RiskTolerance: "medium",
+			},
+			Custom: map[string]string{"team": "red"},
+		},
+	}
+	if err := middleware.ValidateAgainstSchema(schema, toJSONValue(t, good)); err != nil {
+		t.Errorf("expected known-good identity to validate, got %v", err)
+	}
+	
+	// Known-bad payload violating types, ranges, enums and required fields
+	bad := map[string]interface{}{
+		"name": "Bob",
+		"tags": "not-an-array",
+		"rich_attributes": map[string]interface{}{
+			"demographics": map[string]interface{}{"age": -3},
+			"psychographics": map[string]interface{}{
+				"personality":    map[string]interface{}{"openness": 1.5},
+				"risk_tolerance": "reckless",
+			},
+			"unknown_section": map[string]interface{}{},
+		},
+	}
+	err = middleware.ValidateAgainstSchema(schema, toJSONValue(t, bad))
+	validationErr, ok := err.(middleware.ValidationErrors)
+	if !ok {
+		t.Fatalf("expected ValidationErrors for known-bad identity, got %v", err)
+	}
+	
+	fields := make(map[string]bool)
+	for _, e := range validationErr.Errors {
+		fields[e.Field] = true
+	}
+	for _, want := range []string{
+		"persona_id",
+		"tags",
+		"rich_attributes.demographics.age",
+		"rich_attributes.psychographics.personality.openness",
+		"rich_attributes.psychographics.risk_tolerance",
+		"rich_attributes.unknown_section",
+	} {
+		if !fields[want] {
+			t.Errorf("expected validation error for %s, got %v", want, validationErr.Errors)
+		}
+	}
+}
+
+// toJSONValue round-trips v through JSON into a generic value
+func toJSONValue(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	return out
+}
+
+func TestPersonaPromptIncludeRAG(t *testing.T) {
+	server := createTestServer()
+	
+	p := &types.Persona{
+		Name:   "Go Expert",
+		Topic:  "Golang",
+		Prompt: "You are a Go expert.",
+		Rag:    []string{"effective-go.md"},
+	}
+	if err := server.service.CreatePersona(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	
+	tests := []struct {
+		name    string
+		path    string
+		field   string
+		wantRAG bool
+	}{
+		{"prompt default", "/personas/" + p.Id + "/prompt", "prompt", true},
+		{"prompt with rag", "/personas/" + p.Id + "/prompt?include_rag=true", "prompt", true},
+		{"prompt without rag", "/personas/" + p.Id + "/prompt?include_rag=false", "prompt", false},
+		{"openai default", "/personas/" + p.Id + "/openai", "instructions", true},
+		{"openai without rag", "/personas/" + p.Id + "/openai?include_rag=false", "instructions", false},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+			
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			
+			var response map[string]interface{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+			
+			text, _ := response[tt.field].(string)
+			if hasRAG := bytes.Contains([]byte(text), []byte("effective-go.md")); hasRAG != tt.wantRAG {
+				t.Errorf("expected RAG included=%v, got %q", tt.wantRAG, text)
+			}
+		})
+	}
+	
+	// Invalid include_rag value
+	req := httptest.NewRequest("GET", "/personas/"+p.Id+"/prompt?include_rag=maybe", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid include_rag, got %d", rr.Code)
+	}
+}
+
+func TestRenderPersonaHandler(t *testing.T) {
+	server := createTestServer()
+	
+	p := &types.Persona{
+		Name:    "Domain Expert",
+		Topic:   "Templates",
+		Prompt:  "You are an expert in {{domain}}.",
+		Context: map[string]string{"audience": "{{audience}}"},
+	}
+	if err := server.service.CreatePersona(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	
+	render := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/personas/"+id+"/render", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+		return rr
+	}
+	
+	rr := render(p.Id, `{"variables": {"domain": "biology", "audience": "students"}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Prompt  string            `json:"prompt"`
+		Context map[string]string `json:"context"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if response.Prompt != "You are an expert in biology." || response.Context["audience"] != "students" {
+		t.Errorf("unexpected rendered persona: %+v", response)
+	}
+	
+	// Unresolved variables are reported by name
+	rr = render(p.Id, `{"variables": {"audience": "students"}}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a missing variable, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "domain") {
+		t.Errorf("expected the missing variable in the error, got %s", rr.Body.String())
+	}
+	
+	if rr := render(p.Id, "{"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid JSON, got %d", rr.Code)
+	}
+	if rr := render("missing", `{"variables": {}}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing persona, got %d", rr.Code)
+	}
+}
+
+func TestStrictJSON(t *testing.T) {
+	const body = `{"name": "Strict", "topic": "Parsing", "prompt": "Be strict", "promt": "typo"}`
+	
+	for _, strict := range []bool{false, true} {
+		server := createTestServer()
+		server.config.HTTP.StrictJSON = strict
+		
+		rr := httptest.NewRecorder()
+		server.personasHandler(rr, httptest.NewRequest(http.MethodPost, "/personas", strings.NewReader(body)))
+		
+		if !strict {
+			if rr.Code != http.StatusCreated {
+				t.Errorf("lenient: expected status 201, got %d: %s", rr.Code, rr.Body.String())
+			}
+			continue
+		}
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("strict: expected status 400, got %d", rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), `unknown field "promt"`) {
+			t.Errorf("strict: expected the unknown field to be named, got %q", rr.Body.String())
+		}
+		if personas, _ := server.service.ListPersonas(); len(personas) != 0 {
+			t.Errorf("strict: expected no persona to be created, got %d", len(personas))
+		}
+	}
+	
+	// Strict mode also applies to identity payloads
+	server := createTestServer()
+	server.config.HTTP.StrictJSON = true
+	rr := httptest.NewRecorder()
+	server.identitiesHandler(rr, httptest.NewRequest(http.MethodPost, "/identities", strings.NewReader(`{"persona_id": "p", "name": "n", "nickname": "x"}`)))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `unknown field "nickname"`) {
+		t.Errorf("expected identity with unknown field to be rejected, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestUpdatePersonaVersionConflict(t *testing.T) {
+	server := createTestServer()
+	
+	p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+	if err := server.service.CreatePersona(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	
+	update := func(body types.Persona, ifMatch string) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(body)
+		req := httptest.NewRequest("PUT", "/personas/"+p.Id, bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+		return rr
+	}
+	
+	// Successful versioned update via If-Match
+	body := *p
+	body.Name = "Updated Expert"
+	rr := update(body, `"1"`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var updated types.Persona
+	if err := json.Unmarshal(rr.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("expected version 2 in response, got %d", updated.Version)
+	}
+	
+	// Stale version in If-Match header
+	body.Name = "Stale Expert"
+	if rr := update(body, "1"); rr.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for stale If-Match, got %d", rr.Code)
+	}
+	
+	// Stale version in request body
+	body.Version = 1
+	if rr := update(body, ""); rr.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for stale body version, got %d", rr.Code)
+	}
+	
+	// Malformed If-Match
+	if rr := update(body, "abc"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for malformed If-Match, got %d", rr.Code)
+	}
+}
+
+func TestPersonaChainHandler(t *testing.T) {
+	server := createTestServer()
+	store := server.service.GetStorage()
+	
+	root := &types.Persona{Name: "Root", Topic: "Base", Prompt: "Root prompt"}
+	if err := server.service.CreatePersona(root); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	middle := &types.Persona{Name: "Middle", Topic: "Base", Prompt: "Middle prompt", ParentId: root.Id}
+	if err := server.service.CreatePersona(middle); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	leaf := &types.Persona{Name: "Leaf", Topic: "Base", Prompt: "Leaf prompt", ParentId: middle.Id}
+	if err := server.service.CreatePersona(leaf); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	
+	getChain := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/personas/"+id+"/chain", nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+		return rr
+	}
+	
+	rr := getChain(leaf.Id)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var chain []types.Persona
+	if err := json.Unmarshal(rr.Body.Bytes(), &chain); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(chain) != 3 || chain[0].Id != root.Id || chain[1].Id != middle.Id || chain[2].Id != leaf.Id {
+		t.Errorf("expected chain root -> middle -> leaf, got %+v", chain)
+	}
+	
+	// Introduce a cycle directly in storage
+	root.ParentId = leaf.Id
+	if err := store.Update(root.Id, *root); err != nil {
+		t.Fatalf("failed to update persona: %v", err)
+	}
+	rr = getChain(leaf.Id)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for cyclic chain, got %d", rr.Code)
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if response["error"] != "inheritance_cycle" {
+		t.Errorf("expected inheritance_cycle error, got %v", response["error"])
+	}
+	
+	if rr := getChain("missing"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown persona, got %d", rr.Code)
+	}
+}
+
+func TestPersonaIdentitiesHandler(t *testing.T) {
+	server := createTestServer()
+	
+	first := &types.Persona{Name: "First", Topic: "Base", Prompt: "First prompt"}
+	second := &types.Persona{Name: "Second", Topic: "Base", Prompt: "Second prompt"}
+	for _, p := range []*types.Persona{first, second} {
+		if err := server.service.CreatePersona(p); err != nil {
+			t.Fatalf("failed to create persona: %v", err)
+		}
+	}
+	for _, i := range []*types.Identity{
+		{PersonaId: first.Id, Name: "Ann"},
+		{PersonaId: first.Id, Name: "Ben"},
+		{PersonaId: second.Id, Name: "Cat"},
+	} {
+		if err := server.service.CreateIdentity(i); err != nil {
+			t.Fatalf("failed to create identity: %v", err)
+		}
+	}
+	
+	getIdentities := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/personas/"+id+"/identities", nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+		return rr
+	}
+	
+	rr := getIdentities(first.Id)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var identities []types.Identity
+	if err := json.Unmarshal(rr.Body.Bytes(), &identities); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(identities) != 2 {
+		t.Fatalf("expected 2 identities, got %d", len(identities))
+	}
+	for _, i := range identities {
+		if i.PersonaId != first.Id {
+			t.Errorf("expected only identities of %s, got %s from %s", first.Id, i.Name, i.PersonaId)
+		}
+	}
+	
+	if rr := getIdentities("missing"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown persona, got %d", rr.Code)
+	}
+}
+
+func TestPersonaRAGHandlers(t *testing.T) {
+	server := createTestServer()
+	
+	p := &types.Persona{Name: "Librarian", Topic: "Research", Prompt: "You know the sources."}
+	if err := server.service.CreatePersona(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+		return rr
+	}
+	ragPath := "/personas/" + p.Id + "/rag"
+	
+	rr := do(http.MethodPost, ragPath, `{"title":"Field guide","source":"https://example.com/guide","content":"Frogs are amphibians."}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var doc types.RAGDocument
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if doc.Id == "" || doc.Title != "Field guide" {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+	
+	if rr := do(http.MethodPost, ragPath, `{"id":"`+doc.Id+`","content":"again"}`); rr.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for duplicate document, got %d", rr.Code)
+	}
+	if rr := do(http.MethodPost, ragPath, `{"title":"Empty"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for document without content, got %d", rr.Code)
+	}
+	
+	rr = do(http.MethodGet, ragPath, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var docs []types.RAGDocument
+	if err := json.Unmarshal(rr.Body.Bytes(), &docs); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(docs) != 1 || docs[0].Id != doc.Id {
+		t.Fatalf("expected the added document, got %+v", docs)
+	}
+	
+	if rr := do(http.MethodDelete, ragPath+"/"+doc.Id, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodDelete, ragPath+"/"+doc.Id, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for removed document, got %d", rr.Code)
+	}
+	if rr := do(http.MethodGet, ragPath, ""); rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("expected empty list after removal, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodGet, "/personas/missing/rag", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown persona, got %d", rr.Code)
+	}
+}
+
+func TestPersonaSizeHandler(t *testing.T) {
+	server := createTestServer()
+	
+	p := &types.Persona{
+		Name:    "Sizer",
+		Topic:   "Testing",
+		Prompt:  "You are a helpful Go expert.",
+		Context: map[string]string{"level": "senior"},
+	}
+	if err := server.service.CreatePersona(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	
+	req := httptest.NewRequest("GET", "/personas/"+p.Id+"/size", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var size map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &size); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	want := map[string]interface{}{"persona_id": p.Id, "characters": 34.0, "words": 7.0, "estimated_tokens": 9.0}
+	for key, value := range want {
+		if size[key] != value {
+			t.Errorf("expected %s=%v, got %v", key, value, size[key])
+		}
+	}
+	
+	req = httptest.NewRequest("GET", "/personas/missing/size", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown persona, got %d", rr.Code)
+	}
+}
+
+func TestPersonaBackupHandlers(t *testing.T) {
+	server := createTestServer()
+	backups, err := storage.NewBackupStore(t.TempDir(), 5)
+	if err != nil {
+		t.Fatalf("failed to create backup store: %v", err)
+	}
+	server.service.SetBackupStore(backups)
+	
+	p := &types.Persona{Name: "Original", Topic: "Topic", Prompt: "Prompt"}
+	if err := server.service.CreatePersona(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	edited := types.Persona{Name: "Edited", Topic: "Topic", Prompt: "Prompt"}
+	if err := server.service.UpdatePersona(p.Id, edited); err != nil {
+		t.Fatalf("failed to update persona: %v", err)
+	}
+	
+	req := httptest.NewRequest("GET", "/personas/"+p.Id+"/backups", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var list []storage.PersonaBackup
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("expected 1 backup, got %d", len(list))
+	}
+	
+	req = httptest.NewRequest("POST", "/personas/"+p.Id+"/backups/"+list[0].Id+"/restore", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	
+	current, err := server.service.GetPersona(p.Id)
+	if err != nil {
+		t.Fatalf("failed to get persona: %v", err)
+	}
+	if current.Name != "Original" {
+		t.Errorf("expected persona restored to Original, got %s", current.Name)
+	}
+	
+	req = httptest.NewRequest("POST", "/personas/"+p.Id+"/backups/missing/restore", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown backup, got %d", rr.Code)
+	}
+}
+
+func TestPersonaVersionHandlers(t *testing.T) {
+	server := createTestServer()
+	
+	p := &types.Persona{Name: "Original", Topic: "Topic", Prompt: "Prompt"}
+	if err := server.service.CreatePersona(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	edited := types.Persona{Name: "Edited", Topic: "Topic", Prompt: "Prompt"}
+	if err := server.service.UpdatePersona(p.Id, edited); err != nil {
+		t.Fatalf("failed to update persona: %v", err)
+	}
+	
+	req := httptest.NewRequest("GET", "/personas/"+p.Id+"/versions", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var list []types.PersonaVersion
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(list) != 1 || list[0].Persona.Name != "Original" {
+		t.Fatalf("expected the Original version, got %+v", list)
+	}
+	
+	req = httptest.NewRequest("GET", "/personas/"+p.Id+"/versions/1", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	
+	for path, expected := range map[string]int{
+		"/personas/" + p.Id + "/versions/2":   http.StatusNotFound,
+		"/personas/" + p.Id + "/versions/abc": http.StatusBadRequest,
+		"/personas/missing/versions":          http.StatusNotFound,
+	} {
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(server.personaHandler).ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != expected {
+			t.Errorf("GET %s: expected status %d, got %d", path, expected, rr.Code)
+		}
+	}
+}
+
+func TestPersonaFieldsProjection(t *testing.T) {
+	server := createTestServer()
+	
+	p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+	if err := server.service.CreatePersona(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	
+	req := httptest.NewRequest("GET", "/personas/"+p.Id+"?fields=id,name", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.personaHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(got) != 2 || got["id"] != p.Id || got["name"] != "Expert" {
+		t.Errorf("expected only id and name, got %v", got)
+	}
+	if _, ok := got["prompt"]; ok {
+		t.Error("expected prompt to be omitted")
+	}
+	
+	req = httptest.NewRequest("GET", "/personas?fields=id,topic", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.personasHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var list []map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(list) != 1 || len(list[0]) != 2 || list[0]["topic"] != "Topic" {
+		t.Errorf("expected only id and topic, got %v", list)
+	}
+	
+	full := httptest.NewRecorder()
+	http.HandlerFunc(server.personasHandler).ServeHTTP(full, httptest.NewRequest("GET", "/personas", nil))
+	if full.Header().Get("ETag") == rr.Header().Get("ETag") {
+		t.Error("expected projected and full lists to have different ETags")
+	}
+	
+	for _, path := range []string{"/personas?fields=id,secret", "/personas/" + p.Id + "?fields=bogus"} {
+		rr = httptest.NewRecorder()
+		handler := server.personasHandler
+		if strings.HasPrefix(path, "/personas/") {
+			handler = server.personaHandler
+		}
+		http.HandlerFunc(handler).ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected status 400, got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestIdentitiesHandler_DemographicFilters(t *testing.T) {
+	server := createTestServer()
+	
+	p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+	if err := server.service.CreatePersona(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	for _, age := range []int32{25, 35, 50} {
+		i := &types.Identity{
+			PersonaId: p.Id,
+			Name:      fmt.Sprintf("Age %d", age),
+			RichAttributes: &types.RichAttributes{
+				Demographics: &types.Demographics{Age: age, Location: &types.Location{City: "Lisbon"}},
+			},
+		}
+		if err := server.service.GetStorage().CreateIdentity(i); err != nil {
+			t.Fatalf("failed to create identity: %v", err)
+		}
+	}
+	
+	req := httptest.NewRequest("GET", "/identities?min_age=35&max_age=50&city=lisbon", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.identitiesHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var identities []types.Identity
+	if err := json.Unmarshal(rr.Body.Bytes(), &identities); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(identities) != 2 {
+		t.Errorf("expected the 35 and 50 year olds, got %d identities", len(identities))
+	}
+	
+	for _, query := range []string{"min_age=abc", "max_age=-1", "min_age=50&max_age=20"} {
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(server.identitiesHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/identities?"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestPersonasHandler_Filters(t *testing.T) {
+	server := createTestServer()
+	
+	for _, p := range []*types.Persona{
+		{Name: "Pentester", Topic: "Network Security", Prompt: "You break into networks."},
+		{Name: "Gopher", Topic: "Golang Programming", Prompt: "You write Go."},
+	} {
+		if err := server.service.CreatePersona(p); err != nil {
+			t.Fatalf("failed to create persona: %v", err)
+		}
+	}
+	
+	for query, want := range map[string]string{
+		"topic=security": "Pentester",
+		"search=write":   "Gopher",
+	} {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.personasHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/personas?"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", query, rr.Code, rr.Body.String())
+		}
+		var personas []types.Persona
+		if err := json.Unmarshal(rr.Body.Bytes(), &personas); err != nil {
+			t.Fatalf("%s: failed to parse response: %v", query, err)
+		}
+		if len(personas) != 1 || personas[0].Name != want {
+			t.Errorf("%s: expected only %s, got %+v", query, want, personas)
+		}
+	}
+}
+
+func TestDuplicateIdentitiesHandler(t *testing.T) {
+	server := createTestServer()
+	
+	p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+	if err := server.service.CreatePersona(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	for _, name := range []string{"Alice", "Alicia"} {
+		i := &types.Identity{PersonaId: p.Id, Name: name, RichAttributes: &types.RichAttributes{
+			Demographics: &types.Demographics{Age: 30},
+			Preferences:  &types.Preferences{Interests: []string{"chess", "music"}},
+		}}
+		if err := server.service.CreateIdentity(i); err != nil {
+			t.Fatalf("failed to create identity: %v", err)
+		}
+	}
+	
+	rr := httptest.NewRecorder()
+	server.duplicateIdentitiesHandler(rr, httptest.NewRequest("GET", "/identities/duplicates?threshold=0.95", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result struct {
+		Threshold float64    `json:"threshold"`
+		Groups    [][]string `json:"groups"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if result.Threshold != 0.95 || len(result.Groups) != 1 || len(result.Groups[0]) != 2 {
+		t.Errorf("expected one pair at threshold 0.95, got %+v", result)
+	}
+	
+	rr = httptest.NewRecorder()
+	server.duplicateIdentitiesHandler(rr, httptest.NewRequest("GET", "/identities/duplicates?threshold=2", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for threshold 2, got %d", rr.Code)
+	}
+}
+
+func TestImportPersonasOpenAI(t *testing.T) {
+	server := createTestServer()
+	
+	body := `[
+		{"name": "Go Expert", "description": "Golang", "instructions": "You are a Go expert.", "model": "gpt-4o"},
+		{"name": "Chef", "messages": [{"role": "system", "content": "You are a chef."}]}
+	]`
+	req := httptest.NewRequest("POST", "/personas/import?format=openai", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.importPersonasHandler).ServeHTTP(rr, req)
+	
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	
+	var created []types.Persona
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(created) != 2 || created[0].Id == "" {
+		t.Fatalf("expected 2 created personas, got %+v", created)
+	}
+	if created[1].Prompt != "You are a chef." {
+		t.Errorf("expected system message as prompt, got %q", created[1].Prompt)
+	}
+	
+	// Unknown formats are rejected
+	req = httptest.NewRequest("POST", "/personas/import?format=yaml", bytes.NewBufferString(body))
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.importPersonasHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for unknown format, got %d", rr.Code)
+	}
+}
+
+func TestExportImportPersonaBundle(t *testing.T) {
+	source := createTestServer()
+	persona := types.Persona{Name: "Go Expert", Topic: "Golang", Prompt: "You are a Go expert."}
+	if err := source.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	
+	rr := httptest.NewRecorder()
+	source.exportPersonasHandler(rr, httptest.NewRequest("GET", "/personas/export", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	bundle := rr.Body.String()
+	
+	target := createTestServer()
+	rr = httptest.NewRecorder()
+	target.importPersonasHandler(rr, httptest.NewRequest("POST", "/personas/import", bytes.NewBufferString(bundle)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result map[string]int
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if result["imported"] != 1 {
+		t.Errorf("expected 1 imported persona, got %v", result)
+	}
+	
+	// Invalid overwrite flag
+	rr = httptest.NewRecorder()
+	target.importPersonasHandler(rr, httptest.NewRequest("POST", "/personas/import?overwrite=maybe", bytes.NewBufferString(bundle)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid overwrite flag, got %d", rr.Code)
+	}
+}
+
+func TestRebuildIndexesHandler(t *testing.T) {
+	store, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create file storage: %v", err)
+	}
+	server := NewServer(&config.Config{}, persona.NewService(store))
+	
+	req := httptest.NewRequest("POST", "/admin/rebuild-indexes", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.rebuildIndexesHandler).ServeHTTP(rr, req)
+	
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var report storage.IndexReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if report.Fixed != 0 {
+		t.Errorf("expected no fixes on a fresh store, got %d", report.Fixed)
+	}
+	
+	req = httptest.NewRequest("GET", "/admin/rebuild-indexes", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.rebuildIndexesHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rr.Code)
+	}
+}
+
+// fakeRecorder records metrics calls without a registry
+type fakeRecorder struct {
+	requests map[string]int
+	gauges   map[string]float64
+}
+
+func (f *fakeRecorder) ObserveRequest(handler string, status int, duration time.Duration) {
+	f.requests[fmt.Sprintf("%s %d", handler, status)]++
+}
+
+func (f *fakeRecorder) SetGauge(name string, value float64) {
+	f.gauges[name] = value
+}
+
+func TestInstrumentRecordsRequests(t *testing.T) {
+	server := createTestServer()
+	recorder := &fakeRecorder{requests: map[string]int{}, gauges: map[string]float64{}}
+	server.metrics = recorder
+	
+	handler := server.instrument("/personas/", server.personaHandler)
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/personas/missing", nil))
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/personas/missing", nil))
+	
+	if got := recorder.requests["/personas/ 404"]; got != 2 {
+		t.Errorf("expected 2 recorded 404s, got %d (%v)", got, recorder.requests)
+	}
+	
+	persona := types.Persona{Name: "Test Expert", Topic: "Testing", Prompt: "You are a testing expert"}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	
+	// Scrapes refresh the storage gauges even when the recorder cannot serve them
+	rr := httptest.NewRecorder()
+	server.metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if recorder.gauges[metrics.PersonasStored] != 1 {
+		t.Errorf("expected personas gauge of 1, got %v", recorder.gauges)
+	}
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a recorder without an HTTP handler, got %d", rr.Code)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	server := createTestServer()
+	
+	persona := types.Persona{Name: "Test Expert", Topic: "Testing", Prompt: "You are a testing expert"}
+	if err := server.service.CreatePersona(&persona); err != nil {
+		t.Fatal(err)
+	}
+	server.instrument("/health", server.healthHandler)(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	
+	rr := httptest.NewRecorder()
+	server.metricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		"fr0g_aip_personas 1\n",
+		"fr0g_aip_identities 0\n",
+		"fr0g_aip_communities 0\n",
+		`fr0g_aip_http_requests_total{handler="/health",code="200"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestSampleIdentitiesHandler(t *testing.T) {
+	server := createTestServer()
+	
+	p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+	if err := server.service.CreatePersona(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		identity := &types.Identity{PersonaId: p.Id, Name: fmt.Sprintf("Member %d", i)}
+		if i < 3 {
+			identity.Tags = []string{"panel"}
+		}
+		if err := server.service.CreateIdentity(identity); err != nil {
+			t.Fatalf("failed to create identity: %v", err)
+		}
+	}
+	
+	sample := func(query string) []types.Identity {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		server.sampleIdentitiesHandler(rr, httptest.NewRequest("GET", "/identities/sample?"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", query, rr.Code, rr.Body.String())
+		}
+		var identities []types.Identity
+		if err := json.Unmarshal(rr.Body.Bytes(), &identities); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return identities
+	}
+	
+	if got := sample(""); len(got) != 4 {
+		t.Errorf("expected every identity when n defaults to 10, got %d", len(got))
+	}
+	if got := sample("n=2&persona_id=" + p.Id); len(got) != 2 {
+		t.Errorf("expected 2 identities, got %d", len(got))
+	}
+	for _, identity := range sample("n=5&tags=panel,other") {
+		if len(identity.Tags) != 1 || identity.Tags[0] != "panel" {
+			t.Errorf("expected only tagged identities, got %+v", identity)
+		}
+	}
+	if got := sample("persona_id=missing"); got == nil || len(got) != 0 {
+		t.Errorf("expected an empty array for no matches, got %v", got)
+	}
+	first, second := sample("n=2&seed=7"), sample("n=2&seed=7")
+	if first[0].Id != second[0].Id || first[1].Id != second[1].Id {
+		t.Errorf("expected the same sample for the same seed, got %v and %v", first, second)
+	}
+	
+	for _, query := range []string{"n=0", "n=abc", "seed=1.5"} {
+		rr := httptest.NewRecorder()
+		server.sampleIdentitiesHandler(rr, httptest.NewRequest("GET", "/identities/sample?"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	server := createTestServer()
+	
+	for _, topic := range []string{"Law", "Art", "Law"} {
+		p := &types.Persona{Name: topic + " Expert", Topic: topic, Prompt: "Prompt"}
+		if err := server.service.CreatePersona(p); err != nil {
+			t.Fatalf("failed to create persona: %v", err)
+		}
+	}
+	
+	rr := httptest.NewRecorder()
+	server.statsHandler(rr, httptest.NewRequest("GET", "/stats", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var stats types.SystemStats
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if stats.TotalPersonas != 3 || stats.TotalIdentities != 0 || stats.TotalCommunities != 0 {
+		t.Errorf("unexpected totals: %+v", stats)
+	}
+	if stats.MostCommonTopic != "Law" || stats.MostCommonTopicCount != 2 {
+		t.Errorf("expected Law (2) as the most common topic, got %s (%d)", stats.MostCommonTopic, stats.MostCommonTopicCount)
+	}
+	
+	rr = httptest.NewRecorder()
+	server.statsHandler(rr, httptest.NewRequest("POST", "/stats", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rr.Code)
+	}
+}
+
+func TestPersonaDiffHandler(t *testing.T) {
+	server := createTestServer()
+	
+	a := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt", Context: map[string]string{"tone": "formal"}}
+	b := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt", Context: map[string]string{"tone": "casual"}}
+	for _, p := range []*types.Persona{a, b} {
+		if err := server.service.CreatePersona(p); err != nil {
+			t.Fatalf("failed to create persona: %v", err)
+		}
+	}
+	
+	rr := httptest.NewRecorder()
+	server.personaHandler(rr, httptest.NewRequest("GET", "/personas/"+a.Id+"/diff?against="+b.Id, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var diff types.PersonaDiff
+	if err := json.Unmarshal(rr.Body.Bytes(), &diff); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if got := diff.ContextChanged["tone"]; got.From != "formal" || got.To != "casual" {
+		t.Errorf("expected the tone change, got %+v", diff)
+	}
+	
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{"", http.StatusBadRequest},
+		{"?against=" + b.Id + "&version=1", http.StatusBadRequest},
+		{"?version=zero", http.StatusBadRequest},
+		{"?version=1", http.StatusNotFound},
+		{"?against=missing", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		server.personaHandler(rr, httptest.NewRequest("GET", "/personas/"+a.Id+"/diff"+tt.query, nil))
+		if rr.Code != tt.code {
+			t.Errorf("%q: expected status %d, got %d", tt.query, tt.code, rr.Code)
+		}
+	}
+}
+
+func TestExportIdentitiesHandler(t *testing.T) {
+	server := createTestServer()
+	
+	var personas []*types.Persona
+	for _, name := range []string{"First", "Second"} {
+		p := &types.Persona{Name: name, Topic: "Topic", Prompt: "Prompt"}
+		if err := server.service.CreatePersona(p); err != nil {
+			t.Fatalf("failed to create persona: %v", err)
+		}
+		personas = append(personas, p)
+	}
+	for i := 0; i < 5; i++ {
+		identity := &types.Identity{PersonaId: personas[i%2].Id, Name: fmt.Sprintf("Member %d", i)}
+		if err := server.service.CreateIdentity(identity); err != nil {
+			t.Fatalf("failed to create identity: %v", err)
+		}
+	}
+	
+	export := func(query string) []types.Identity {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		server.exportIdentitiesHandler(rr, httptest.NewRequest("GET", "/identities/export?"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", query, rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("Content-Type"); got != "application/x-ndjson" {
+			t.Errorf("expected application/x-ndjson, got %s", got)
+		}
+		var identities []types.Identity
+		for _, line := range strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n") {
+			var identity types.Identity
+			if err := json.Unmarshal([]byte(line), &identity); err != nil {
+				t.Fatalf("line %q is not a JSON object: %v", line, err)
+			}
+			identities = append(identities, identity)
+		}
+		return identities
+	}
+	
+	all := export("format=jsonl")
+	if len(all) != 5 {
+		t.Errorf("expected 5 identities, got %d", len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].Id >= all[i].Id {
+			t.Errorf("expected identities ordered by ID, got %s before %s", all[i-1].Id, all[i].Id)
+		}
+	}
+	filtered := export("persona_id=" + personas[1].Id)
+	if len(filtered) != 2 {
+		t.Errorf("expected 2 identities of the second persona, got %d", len(filtered))
+	}
+	for _, identity := range filtered {
+		if identity.PersonaId != personas[1].Id {
+			t.Errorf("expected only identities of %s, got %s", personas[1].Id, identity.PersonaId)
+		}
+	}
+	
+	for _, query := range []string{"format=csv", "deep=maybe"} {
+		rr := httptest.NewRecorder()
+		server.exportIdentitiesHandler(rr, httptest.NewRequest("GET", "/identities/export?"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestStreamExportFailure(t *testing.T) {
+	server := createTestServer()
+	failure := errors.New("storage failed")
+	
+	// Nothing sent yet, so the failure can still become an error status
+	rr := httptest.NewRecorder()
+	server.streamExport(rr, "text/csv", "export.csv", func(io.Writer) error { return failure })
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Content-Disposition"); got != "" {
+		t.Errorf("expected no attachment on failure, got %q", got)
+	}
+	
+	// Part of the body is out, so the response must be aborted
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("expected the response to be aborted, got %v", r)
+		}
+	}()
+	server.streamExport(httptest.NewRecorder(), "text/csv", "export.csv", func(out io.Writer) error {
+		io.WriteString(out, "id,name\n")
+		return failure
+	})
+	t.Error("expected a mid-stream failure to abort the handler")
+}
+
+func TestPersonaFeatureHandler(t *testing.T) {
+	server := createTestServer()
+	
+	var ids []string
+	for _, name := range []string{"Alpha", "Beta"} {
+		p := &types.Persona{Name: name, Topic: "Topic", Prompt: "Prompt"}
+		if err := server.service.CreatePersona(p); err != nil {
+			t.Fatalf("failed to create persona: %v", err)
+		}
+		ids = append(ids, p.Id)
+	}
+	
+	rr := httptest.NewRecorder()
+	server.personaHandler(rr, httptest.NewRequest("PUT", "/personas/"+ids[1]+"/feature", strings.NewReader(`{"order": 3}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var featured types.Persona
+	if err := json.Unmarshal(rr.Body.Bytes(), &featured); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if !featured.Featured || featured.FeatureOrder != 3 {
+		t.Errorf("expected the persona to be featured at order 3, got %+v", featured)
+	}
+	
+	list := func(query string) []types.Persona {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		server.personasHandler(rr, httptest.NewRequest("GET", "/personas"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var personas []types.Persona
+		if err := json.Unmarshal(rr.Body.Bytes(), &personas); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return personas
+	}
+	if personas := list("?featured_first=true"); len(personas) != 2 || personas[0].Id != ids[1] {
+		t.Errorf("expected the featured persona first, got %+v", personas)
+	}
+	
+	rr = httptest.NewRecorder()
+	server.personaHandler(rr, httptest.NewRequest("PUT", "/personas/"+ids[1]+"/unfeature", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	for _, p := range list("?featured_first=true") {
+		if p.Featured {
+			t.Errorf("expected no featured personas after unfeaturing, got %+v", p)
+		}
+	}
+	
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"PUT", "/personas/missing/feature", http.StatusNotFound},
+		{"GET", "/personas/" + ids[0] + "/feature", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		server.personaHandler(rr, httptest.NewRequest(tt.method, tt.path, nil))
+		if rr.Code != tt.code {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.code, rr.Code)
+		}
+	}
+	
+	rr = httptest.NewRecorder()
+	server.personasHandler(rr, httptest.NewRequest("GET", "/personas?featured_first=maybe", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid featured_first, got %d", rr.Code)
 	}
 }
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
+)
+
+const (
+	// idempotencyKeyHeader names the header clients set to make a POST
+	// safe to retry
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyTTL is how long a key keeps replaying its resource
+	idempotencyTTL = 24 * time.Hour
+	// maxIdempotencyKeyLength bounds the keys the server will remember
+	maxIdempotencyKeyLength = 255
+	// idempotencySweepInterval is how often Put drops expired keys
+	idempotencySweepInterval = time.Minute
+)
+
+// IdempotencyStore remembers which resource a creation request with a
+// given Idempotency-Key produced. Implementations must be safe for
+// concurrent use.
+type IdempotencyStore interface {
+	// Get returns the resource ID stored for key, unless it has expired
+	Get(key string) (string, bool)
+	// Put stores id for key until ttl has passed
+	Put(key, id string, ttl time.Duration)
+}
+
+type idempotencyEntry struct {
+	id      string
+	expires time.Time
+}
+
+// MemoryIdempotencyStore keeps idempotency keys in memory; they are lost
+// when the server restarts
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]idempotencyEntry
+	lastSweep time.Time
+	now       func() time.Time // replaceable in tests
+}
+
+// NewMemoryIdempotencyStore creates an empty in-memory key store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		entries: make(map[string]idempotencyEntry),
+		now:     time.Now,
+	}
+}
+
+// Get drops key if it has expired
+func (s *MemoryIdempotencyStore) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return "", false
+	}
+	if !s.now().Before(entry.expires) {
+		delete(s.entries, key)
+		return "", false
+	}
+	return entry.id, true
+}
+
+// Put also drops expired keys, at most once per sweep interval, so the
+// store only grows with live ones without scanning it on every call
+func (s *MemoryIdempotencyStore) Put(key, id string, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.Sub(s.lastSweep) >= idempotencySweepInterval {
+		for k, entry := range s.entries {
+			if !now.Before(entry.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.entries[key] = idempotencyEntry{id: id, expires: now.Add(ttl)}
+}
+
+// keyLocks hands out a mutex per key, so requests that share an
+// Idempotency-Key run one at a time while others proceed. Mutexes are
+// dropped once no request holds or waits for them.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock locks key and returns the function that unlocks it
+func (k *keyLocks) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyLock)
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// SetIdempotencyStore replaces the store that remembers Idempotency-Key
+// headers, e.g. with one shared between several servers
+func (s *Server) SetIdempotencyStore(store IdempotencyStore) {
+	s.idempotency = store
+}
+
+// idempotencyKey returns r's Idempotency-Key scoped to a kind of resource
+// and to the caller, or "" when the request has none. Callers are told apart
+// by API key, or by remote address when authentication is disabled, so two
+// clients that pick the same key do not see each other's resources. ok is
+// false, and a 400 has been written, when the key is too long.
+func idempotencyKey(w http.ResponseWriter, r *http.Request, scope string) (key string, ok bool) {
+	header := r.Header.Get(idempotencyKeyHeader)
+	if header == "" {
+		return "", true
+	}
+	if len(header) > maxIdempotencyKeyLength {
+		http.Error(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+		return "", false
+	}
+	caller := middleware.CallerFromContext(r.Context())
+	if caller == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		caller = "addr-" + host
+	}
+	return scope + ":" + caller + ":" + header, true
+}
+
+// createIdempotent runs create, which returns the ID of the resource it
+// stored, at most once per key. If an earlier request with key created a
+// resource that still exists, get's result for it is returned as replayed
+// and create is not run. Only requests sharing key wait for each other, and
+// only until the resource is stored; the caller writes the response after.
+func (s *Server) createIdempotent(key string, get func(id string) (interface{}, error), create func() (string, error)) (replayed interface{}, err error) {
+	if key == "" {
+		_, err := create()
+		return nil, err
+	}
+
+	unlock := s.idempotencyLocks.lock(key)
+	defer unlock()
+
+	// A resource that has since been deleted is not replayed, so the
+	// request creates a new one
+	if id, ok := s.idempotency.Get(key); ok {
+		if resource, err := get(id); err == nil {
+			return resource, nil
+		}
+	}
+	id, err := create()
+	if err != nil {
+		return nil, err
+	}
+	s.idempotency.Put(key, id, idempotencyTTL)
+	return nil, nil
+}
+
+// writeReplayed writes the resource an earlier request with the same
+// Idempotency-Key created, with 200 OK
+func writeReplayed(w http.ResponseWriter, resource interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	json.NewEncoder(w).Encode(resource)
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/config"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// postWithKey POSTs body to handler with the given Idempotency-Key
+func postWithKey(handler http.HandlerFunc, path, key string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", path, bytes.NewReader(data))
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPersonasHandler_IdempotencyKey(t *testing.T) {
+	server := createTestServer()
+	body := types.Persona{Name: "Retried", Topic: "Networks", Prompt: "You retry requests"}
+
+	first := postWithKey(server.personasHandler, "/personas", "create-1", body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", first.Code, first.Body.String())
+	}
+	second := postWithKey(server.personasHandler, "/personas", "create-1", body)
+	if second.Code != http.StatusOK || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected a replayed 200, got %d: %s", second.Code, second.Body.String())
+	}
+
+	var created, replayed types.Persona
+	json.Unmarshal(first.Body.Bytes(), &created)
+	json.Unmarshal(second.Body.Bytes(), &replayed)
+	if created.Id == "" || replayed.Id != created.Id {
+		t.Errorf("expected the original persona %q, got %q", created.Id, replayed.Id)
+	}
+
+	personas, err := server.service.ListPersonas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(personas) != 1 {
+		t.Errorf("expected 1 persona, got %d", len(personas))
+	}
+
+	if rr := postWithKey(server.personasHandler, "/personas", "create-2", body); rr.Code != http.StatusCreated {
+		t.Errorf("expected a new key to create, got %d", rr.Code)
+	}
+	if rr := postWithKey(server.personasHandler, "/personas", strings.Repeat("k", 256), body); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an oversized key, got %d", rr.Code)
+	}
+}
+
+func TestIdentitiesHandler_IdempotencyKey(t *testing.T) {
+	server := createTestServer()
+	p := &types.Persona{Name: "Base", Topic: "Testing", Prompt: "You test"}
+	if err := server.service.CreatePersona(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	body := map[string]interface{}{"persona_id": p.Id, "name": "Retried Identity"}
+
+	// Keys are scoped per resource, so a persona key does not replay here
+	postWithKey(server.personasHandler, "/personas", "shared", types.Persona{Name: "Other", Topic: "Testing", Prompt: "You test"})
+	for i := 0; i < 2; i++ {
+		rr := postWithKey(server.identitiesHandler, "/identities", "shared", body)
+		if want := []int{http.StatusCreated, http.StatusOK}[i]; rr.Code != want {
+			t.Fatalf("request %d: expected status %d, got %d: %s", i+1, want, rr.Code, rr.Body.String())
+		}
+	}
+
+	identities, err := server.service.ListIdentities(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 {
+		t.Errorf("expected 1 identity, got %d", len(identities))
+	}
+}
+
+func TestMemoryIdempotencyStore_Expiry(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	store.Put("personas:a", "p1", time.Hour)
+	if id, ok := store.Get("personas:a"); !ok || id != "p1" {
+		t.Fatalf("expected p1, got %q, %v", id, ok)
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok := store.Get("personas:a"); ok {
+		t.Error("expected the key to expire")
+	}
+	store.Put("personas:b", "p2", time.Hour)
+	if len(store.entries) != 1 {
+		t.Errorf("expected expired keys to be dropped, got %d entries", len(store.entries))
+	}
+}
+
+func TestIdempotencyKey_ScopedByCaller(t *testing.T) {
+	server := createTestServer()
+	handler := middleware.ScopedAuthMiddleware(map[string]string{"key-a": config.ScopeWrite, "key-b": config.ScopeWrite})(http.HandlerFunc(server.personasHandler))
+	body, _ := json.Marshal(types.Persona{Name: "Shared", Topic: "Keys", Prompt: "You share keys"})
+
+	post := func(apiKey, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/personas", bytes.NewReader(body))
+		req.Header.Set("Idempotency-Key", "same")
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		if apiKey == "" {
+			server.personasHandler(rr, req)
+		} else {
+			handler.ServeHTTP(rr, req)
+		}
+		return rr
+	}
+
+	tests := []struct {
+		apiKey, remoteAddr string
+		code               int
+	}{
+		{"key-a", "10.0.0.1:1000", http.StatusCreated},
+		{"key-a", "10.0.0.2:1000", http.StatusOK},
+		{"key-b", "10.0.0.1:1000", http.StatusCreated},
+		{"", "10.0.0.3:1000", http.StatusCreated},
+		{"", "10.0.0.3:2000", http.StatusOK},
+		{"", "10.0.0.4:1000", http.StatusCreated},
+	}
+	for i, tt := range tests {
+		if rr := post(tt.apiKey, tt.remoteAddr); rr.Code != tt.code {
+			t.Errorf("request %d: expected status %d, got %d", i+1, tt.code, rr.Code)
+		}
+	}
+}
+
+func TestPersonasHandler_IdempotencyKeyConcurrent(t *testing.T) {
+	server := createTestServer()
+	body := types.Persona{Name: "Racing", Topic: "Networks", Prompt: "You race"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			postWithKey(server.personasHandler, "/personas", "race", body)
+		}()
+	}
+	wg.Wait()
+
+	personas, err := server.service.ListPersonas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(personas) != 1 {
+		t.Errorf("expected concurrent requests sharing a key to create 1 persona, got %d", len(personas))
+	}
+	if len(server.idempotencyLocks.locks) != 0 {
+		t.Errorf("expected key locks to be released, got %d", len(server.idempotencyLocks.locks))
+	}
+}
+
+func TestMemoryIdempotencyStore_Sweep(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	store.Put("personas:a", "p1", time.Second)
+	now = now.Add(2 * time.Second)
+	store.Put("personas:b", "p2", time.Hour)
+	if len(store.entries) != 2 {
+		t.Errorf("expected no sweep within the sweep interval, got %d entries", len(store.entries))
+	}
+
+	now = now.Add(idempotencySweepInterval)
+	store.Put("personas:c", "p3", time.Hour)
+	if _, ok := store.entries["personas:a"]; ok || len(store.entries) != 2 {
+		t.Errorf("expected the expired key to be swept, got %d entries", len(store.entries))
+	}
+}
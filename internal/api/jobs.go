@@ -0,0 +1,411 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/ids"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// Job states reported by GET /jobs/{id}
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Webhook delivery states
+const (
+	CallbackPending   = "pending"
+	CallbackDelivered = "delivered"
+	CallbackFailed    = "failed"
+)
+
+const (
+	// webhookAttempts bounds how often a callback is POSTed before giving up
+	webhookAttempts = 3
+	// defaultWebhookRetryDelay is the wait before the first retry; it
+	// doubles for each further attempt
+	defaultWebhookRetryDelay = time.Second
+	// webhookTimeout bounds a single callback request
+	webhookTimeout = 10 * time.Second
+
+	// jobWorkers is the number of generation jobs run at once
+	jobWorkers = 2
+	// jobQueueSize bounds the jobs waiting for a worker; further requests
+	// get 503 Service Unavailable
+	jobQueueSize = 32
+	// finishedJobTTL is how long a finished job can still be fetched
+	finishedJobTTL = time.Hour
+	// jobSweepInterval bounds how often the job store looks for expired jobs
+	jobSweepInterval = time.Minute
+)
+
+var (
+	// errCallbackRejected marks callback responses that retrying will not fix
+	errCallbackRejected = errors.New("callback rejected")
+	// errJobQueueFull is returned when too many jobs are waiting for a worker
+	errJobQueueFull = errors.New("too many generation jobs queued, try again later")
+	// errBlockedCallback is returned when dialling a callback address that
+	// is not allowed
+	errBlockedCallback = errors.New("callback address is loopback, private or link-local")
+)
+
+// Job tracks an asynchronous community generation
+type Job struct {
+	Id             string    `json:"id"`
+	Status         string    `json:"status"`
+	CallbackURL    string    `json:"callback_url"`
+	CallbackStatus string    `json:"callback_status"`
+	CommunityId    string    `json:"community_id,omitempty"` // set once generation succeeds
+	Error          string    `json:"error,omitempty"`        // set once generation fails
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// finished reports whether a job has stopped changing
+func (j *Job) finished() bool {
+	return j.Status != JobRunning && j.CallbackStatus != CallbackPending
+}
+
+// jobStore keeps job state in memory; it is lost when the server restarts.
+// Finished jobs are dropped once they are older than ttl.
+type jobStore struct {
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	ttl       time.Duration
+	lastSweep time.Time
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{jobs: make(map[string]*Job), ttl: finishedJobTTL}
+}
+
+// expired reports whether j finished more than ttl before now
+func (s *jobStore) expired(j *Job, now time.Time) bool {
+	return j.finished() && now.Sub(j.UpdatedAt) > s.ttl
+}
+
+// sweep drops expired jobs, scanning at most once per jobSweepInterval.
+// The caller must hold s.mu.
+func (s *jobStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < jobSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for id, j := range s.jobs {
+		if s.expired(j, now) {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// create registers a running job for callbackURL
+func (s *jobStore) create(callbackURL string) Job {
+	now := time.Now()
+	j := &Job{
+		Id:             ids.New(),
+		Status:         JobRunning,
+		CallbackURL:    callbackURL,
+		CallbackStatus: CallbackPending,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	s.jobs[j.Id] = j
+	return *j
+}
+
+// get returns a copy of the job with the given ID
+func (s *jobStore) get(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	if s.expired(j, time.Now()) {
+		delete(s.jobs, id)
+		return Job{}, false
+	}
+	return *j, true
+}
+
+// remove forgets the job with the given ID
+func (s *jobStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+}
+
+// update applies change to the job with the given ID
+func (s *jobStore) update(id string, change func(j *Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		change(j)
+		j.UpdatedAt = time.Now()
+	}
+}
+
+// validateCallbackURL checks that a callback URL is an absolute http(s) URL
+// whose host is in allowedHosts or, when allowedHosts is empty, is not
+// localhost or a loopback, private or link-local address. Host names are
+// resolved when the callback is made, where webhookDialControl checks the
+// address again.
+func validateCallbackURL(raw string, allowedHosts []string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback_url must be an absolute http or https URL")
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if len(allowedHosts) > 0 {
+		if !slices.ContainsFunc(allowedHosts, func(allowed string) bool { return strings.EqualFold(allowed, host) }) {
+			return fmt.Errorf("callback_url host %q is not allowed", host)
+		}
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("callback_url must not target localhost")
+	}
+	if ip := net.ParseIP(host); ip != nil && blockedCallbackIP(ip) {
+		return fmt.Errorf("callback_url must not target a loopback, private or link-local address")
+	}
+	return nil
+}
+
+// blockedCallbackIP reports whether callbacks to ip are refused when no
+// callback hosts are configured
+func blockedCallbackIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// webhookDialControl refuses connections to blocked addresses, so a public
+// host name that resolves to an internal address is caught too
+func webhookDialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || blockedCallbackIP(ip) {
+		return fmt.Errorf("%w: %s", errBlockedCallback, address)
+	}
+	return nil
+}
+
+// newWebhookClient returns the client used for callbacks. Redirects are not
+// followed. Without allowedHosts, connections to blocked addresses are
+// refused, and callbacks are dialled directly rather than through a proxy
+// so the check sees the real target.
+func newWebhookClient(allowedHosts []string) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(allowedHosts) == 0 {
+		dialer := &net.Dialer{Timeout: webhookTimeout, Control: webhookDialControl}
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+	}
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// generationJob is a queued asynchronous generation
+type generationJob struct {
+	id       string
+	generate func() (*types.Community, error)
+}
+
+// enqueueJob registers a job for callbackURL and queues generate for the
+// job workers, starting them on first use. It fails with errJobQueueFull
+// when the queue is full and http.ErrServerClosed after Shutdown.
+func (s *Server) enqueueJob(callbackURL string, generate func() (*types.Community, error)) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return Job{}, http.ErrServerClosed
+	}
+	if s.jobQueue == nil {
+		s.jobQueue = make(chan generationJob, jobQueueSize)
+		for i := 0; i < jobWorkers; i++ {
+			s.jobWorkers.Add(1)
+			go s.jobWorker(s.jobQueue)
+		}
+	}
+
+	job := s.jobs.create(callbackURL)
+	select {
+	case s.jobQueue <- generationJob{id: job.Id, generate: generate}:
+		return job, nil
+	default:
+		s.jobs.remove(job.Id)
+		return Job{}, errJobQueueFull
+	}
+}
+
+// jobWorker runs queued jobs until the queue is closed. Once Shutdown has
+// given up waiting, jobs that have not started are failed instead.
+func (s *Server) jobWorker(queue <-chan generationJob) {
+	defer s.jobWorkers.Done()
+	for job := range queue {
+		if s.jobCtx.Err() != nil {
+			s.jobs.update(job.id, func(j *Job) {
+				j.Status = JobFailed
+				j.Error = "server shut down before the job started"
+				j.CallbackStatus = ""
+			})
+			continue
+		}
+		s.runGenerationJob(job.id, job.generate)
+	}
+}
+
+// drainJobs stops accepting jobs and waits for queued ones to finish. When
+// ctx is done first, callbacks in progress are cancelled and jobs that have
+// not started are failed.
+func (s *Server) drainJobs(ctx context.Context) error {
+	s.mu.Lock()
+	queue := s.jobQueue
+	s.jobQueue = nil
+	s.mu.Unlock()
+	if queue != nil {
+		close(queue)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.jobWorkers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.cancelJobs()
+		return ctx.Err()
+	}
+}
+
+// runGenerationJob generates a community for job and POSTs it to the job's
+// callback URL. Failed generations are only reported through the job.
+func (s *Server) runGenerationJob(jobID string, generate func() (*types.Community, error)) {
+	community, err := generate()
+	if err != nil {
+		s.jobs.update(jobID, func(j *Job) {
+			j.Status = JobFailed
+			j.Error = err.Error()
+			j.CallbackStatus = ""
+		})
+		return
+	}
+	s.jobs.update(jobID, func(j *Job) {
+		j.Status = JobSucceeded
+		j.CommunityId = community.Id
+	})
+
+	job, _ := s.jobs.get(jobID)
+	callbackStatus := CallbackDelivered
+	if err := s.deliverWebhook(job, community); err != nil {
+		callbackStatus = CallbackFailed
+	}
+	s.jobs.update(jobID, func(j *Job) {
+		j.CallbackStatus = callbackStatus
+	})
+}
+
+// deliverWebhook POSTs the community to the job's callback URL, retrying
+// network errors and 5xx responses with a doubling delay
+func (s *Server) deliverWebhook(job Job, community *types.Community) error {
+	payload, err := json.Marshal(community)
+	if err != nil {
+		return err
+	}
+
+	delay := s.webhookRetryDelay
+	var lastErr error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(delay):
+			case <-s.jobCtx.Done():
+				return s.jobCtx.Err()
+			}
+			delay *= 2
+		}
+		lastErr = s.postWebhook(job, payload)
+		if lastErr == nil {
+			return nil
+		}
+		if errors.Is(lastErr, errCallbackRejected) {
+			return lastErr
+		}
+	}
+	return fmt.Errorf("callback failed after %d attempts: %v", webhookAttempts, lastErr)
+}
+
+// postWebhook makes a single callback request
+func (s *Server) postWebhook(job Job, payload []byte) error {
+	req, err := http.NewRequestWithContext(s.jobCtx, http.MethodPost, job.CallbackURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Job-Id", job.Id)
+
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("callback returned %s", resp.Status)
+	default:
+		return fmt.Errorf("%w with %s", errCallbackRejected, resp.Status)
+	}
+}
+
+// jobHandler serves GET /jobs/{id}
+func (s *Server) jobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	if id == "" {
+		http.Error(w, "Job ID required", http.StatusBadRequest)
+		return
+	}
+	job, ok := s.jobs.get(id)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// postAsyncGeneration requests a community generation with a callback URL
+func postAsyncGeneration(t *testing.T, server *Server, callbackURL string) *httptest.ResponseRecorder {
+	t.Helper()
+	p := &types.Persona{Name: "Builder", Topic: "Community Building", Prompt: "You build communities"}
+	if err := server.service.CreatePersona(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"name":         "Async Community",
+		"type":         "demographic",
+		"target_size":  3,
+		"callback_url": callbackURL,
+		"generation_config": map[string]interface{}{
+			"age_distribution": map[string]interface{}{"mean": 35.0, "std_dev": 10.0, "min_age": 18, "max_age": 65},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.generateCommunityHandler).ServeHTTP(rr, httptest.NewRequest("POST", "/communities/generate", bytes.NewReader(body)))
+	return rr
+}
+
+// allowLocalCallbacks lets server send callbacks to httptest servers, which
+// listen on loopback addresses that are otherwise refused
+func allowLocalCallbacks(server *Server) {
+	server.config.Community.CallbackHosts = []string{"127.0.0.1"}
+	server.webhookClient = newWebhookClient(server.config.Community.CallbackHosts)
+}
+
+// waitForJob polls the job endpoint until the callback is no longer pending
+func waitForJob(t *testing.T, server *Server, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.jobHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/jobs/"+id, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var job Job
+		if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil {
+			t.Fatalf("failed to parse job: %v", err)
+		}
+		if job.Status != JobRunning && job.CallbackStatus != CallbackPending {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish: %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGenerateCommunityHandler_Callback(t *testing.T) {
+	server := createTestServer()
+	allowLocalCallbacks(server)
+
+	received := make(chan types.Community, 1)
+	var jobHeader atomic.Value
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jobHeader.Store(r.Header.Get("X-Job-Id"))
+		var community types.Community
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &community); err != nil {
+			t.Errorf("callback payload is not a community: %v", err)
+		}
+		received <- community
+	}))
+	defer callback.Close()
+
+	rr := postAsyncGeneration(t, server, callback.URL)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var job Job
+	if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil {
+		t.Fatalf("failed to parse job: %v", err)
+	}
+	if job.Id == "" || rr.Header().Get("Location") != "/jobs/"+job.Id {
+		t.Errorf("expected a job ID and matching Location, got %+v and %q", job, rr.Header().Get("Location"))
+	}
+
+	select {
+	case community := <-received:
+		if community.Name != "Async Community" || len(community.MemberIds) != 3 {
+			t.Errorf("unexpected callback payload %+v", community)
+		}
+		if got := jobHeader.Load(); got != job.Id {
+			t.Errorf("expected X-Job-Id %s, got %v", job.Id, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not called")
+	}
+
+	finished := waitForJob(t, server, job.Id)
+	if finished.Status != JobSucceeded || finished.CallbackStatus != CallbackDelivered || finished.CommunityId == "" {
+		t.Errorf("expected a delivered, succeeded job, got %+v", finished)
+	}
+}
+
+func TestGenerateCommunityHandler_CallbackRetries(t *testing.T) {
+	server := createTestServer()
+	allowLocalCallbacks(server)
+	server.webhookRetryDelay = time.Millisecond
+
+	var calls atomic.Int32
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer callback.Close()
+
+	rr := postAsyncGeneration(t, server, callback.URL)
+	var job Job
+	if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil {
+		t.Fatalf("failed to parse job: %v", err)
+	}
+	finished := waitForJob(t, server, job.Id)
+	if finished.CallbackStatus != CallbackDelivered || calls.Load() != 2 {
+		t.Errorf("expected delivery on the second attempt, got %+v after %d calls", finished, calls.Load())
+	}
+}
+
+func TestGenerateCommunityHandler_InvalidCallback(t *testing.T) {
+	server := createTestServer()
+
+	if rr := postAsyncGeneration(t, server, "ftp://example.com/hook"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a non-http callback, got %d", rr.Code)
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.jobHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/jobs/missing", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown job, got %d", rr.Code)
+	}
+}
+
+func TestGenerateCommunityHandler_BlockedCallback(t *testing.T) {
+	server := createTestServer()
+
+	for _, callbackURL := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+	} {
+		if rr := postAsyncGeneration(t, server, callbackURL); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for %s, got %d", callbackURL, rr.Code)
+		}
+	}
+
+	server.config.Community.CallbackHosts = []string{"hooks.example.com"}
+	if rr := postAsyncGeneration(t, server, "https://other.example.com/hook"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a host outside the allowlist, got %d", rr.Code)
+	}
+}
+
+func TestWebhookClient_RefusesPrivateAddresses(t *testing.T) {
+	// A callback host can resolve to a loopback address after validation
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("callback to a loopback address was delivered")
+	}))
+	defer callback.Close()
+
+	_, err := newWebhookClient(nil).Post(callback.URL, "application/json", nil)
+	if !errors.Is(err, errBlockedCallback) {
+		t.Errorf("expected errBlockedCallback, got %v", err)
+	}
+}
+
+func TestJobStore_EvictsFinishedJobs(t *testing.T) {
+	store := newJobStore()
+	running := store.create("https://example.com/hook")
+	finished := store.create("https://example.com/hook")
+	store.update(finished.Id, func(j *Job) {
+		j.Status = JobSucceeded
+		j.CallbackStatus = CallbackDelivered
+	})
+
+	// Age both jobs past the TTL
+	store.mu.Lock()
+	for _, j := range store.jobs {
+		j.UpdatedAt = time.Now().Add(-2 * finishedJobTTL)
+	}
+	store.lastSweep = time.Time{}
+	store.mu.Unlock()
+
+	if _, ok := store.get(finished.Id); ok {
+		t.Error("expected an expired finished job to be gone")
+	}
+	if _, ok := store.get(running.Id); !ok {
+		t.Error("expected a running job to be kept")
+	}
+
+	// A sweep drops expired jobs that are never fetched
+	other := store.create("https://example.com/hook")
+	store.update(other.Id, func(j *Job) {
+		j.Status = JobFailed
+		j.CallbackStatus = ""
+	})
+	store.mu.Lock()
+	store.jobs[other.Id].UpdatedAt = time.Now().Add(-2 * finishedJobTTL)
+	store.lastSweep = time.Time{}
+	store.mu.Unlock()
+	store.create("https://example.com/hook")
+	store.mu.Lock()
+	_, kept := store.jobs[other.Id]
+	store.mu.Unlock()
+	if kept {
+		t.Error("expected the sweep to drop an expired job")
+	}
+}
+
+func TestServer_JobQueue(t *testing.T) {
+	server := createTestServer()
+
+	release := make(chan struct{})
+	started := make(chan struct{}, jobWorkers)
+	generate := func() (*types.Community, error) {
+		started <- struct{}{}
+		<-release
+		return nil, errors.New("generation stopped")
+	}
+
+	// Occupy every worker, then fill the queue
+	var queued []string
+	for i := 0; i < jobWorkers; i++ {
+		job, err := server.enqueueJob("https://example.com/hook", generate)
+		if err != nil {
+			t.Fatalf("failed to enqueue job: %v", err)
+		}
+		queued = append(queued, job.Id)
+		<-started
+	}
+	for i := 0; i < jobQueueSize; i++ {
+		job, err := server.enqueueJob("https://example.com/hook", generate)
+		if err != nil {
+			t.Fatalf("failed to enqueue job %d: %v", i, err)
+		}
+		queued = append(queued, job.Id)
+	}
+	if _, err := server.enqueueJob("https://example.com/hook", generate); !errors.Is(err, errJobQueueFull) {
+		t.Fatalf("expected errJobQueueFull, got %v", err)
+	}
+
+	// Shutdown gives up while the workers are busy and fails waiting jobs
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := server.Shutdown(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := server.enqueueJob("https://example.com/hook", generate); !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("expected http.ErrServerClosed after Shutdown, got %v", err)
+	}
+
+	close(release)
+	server.jobWorkers.Wait()
+	for i, id := range queued {
+		job, ok := server.jobs.get(id)
+		if !ok || job.Status != JobFailed {
+			t.Fatalf("expected job %d to have failed, got %+v", i, job)
+		}
+		if i >= jobWorkers && job.Error != "server shut down before the job started" {
+			t.Errorf("expected queued job %d to be failed by Shutdown, got %q", i, job.Error)
+		}
+	}
+}
+
+func TestServer_ShutdownDrainsJobs(t *testing.T) {
+	server := createTestServer()
+
+	var ran atomic.Int32
+	for i := 0; i < 3; i++ {
+		_, err := server.enqueueJob("https://example.com/hook", func() (*types.Community, error) {
+			ran.Add(1)
+			return nil, errors.New("generation stopped")
+		})
+		if err != nil {
+			t.Fatalf("failed to enqueue job: %v", err)
+		}
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if ran.Load() != 3 {
+		t.Errorf("expected Shutdown to wait for 3 jobs, %d ran", ran.Load())
+	}
+}
@@ -0,0 +1,722 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
+)
+
+// spec is a JSON document node, built by hand like the identity schema
+type spec = middleware.Schema
+
+// OpenAPISpec returns an OpenAPI 3.0 document describing the persona,
+// identity and community endpoints. Paths, methods and status codes mirror
+// the handlers in server.go and must be kept in step with them.
+func OpenAPISpec() spec {
+	return spec{
+		"openapi": "3.0.3",
+		"info": spec{
+			"title":       "fr0g-ai-aip API",
+			"description": "AI Personas and identities REST API",
+			"version":     "1.0.0",
+		},
+		"paths": spec{
+			"/personas": spec{
+				"get": operation("List personas", nil, responses{
+					"200": jsonResponse("All personas", arrayOf(ref("Persona"))),
+					"304": response("Unchanged since the ETag in If-None-Match"),
+					"400": response("Invalid query parameter"),
+					"500": response("Storage failure"),
+				},
+					ifNoneMatchParameter(),
+					queryParameter("include_deleted", "Also list soft-deleted personas", spec{"type": "boolean"}),
+					queryParameter("topic", "Case-insensitive substring of the topic", spec{"type": "string"}),
+					queryParameter("search", "Case-insensitive substring of the name or prompt", spec{"type": "string"}),
+					queryParameter("tags", "Comma-separated tags; personas with any of them match", spec{"type": "string"}),
+					queryParameter("featured_first", "List featured personas first, in feature order", spec{"type": "boolean"}),
+					fieldsParameter(),
+				),
+				"post": operation("Create a persona", ref("Persona"), responses{
+					"200": jsonResponse("The persona an earlier request with the same Idempotency-Key created", ref("Persona")),
+					"201": jsonResponse("The created persona", ref("Persona")),
+					"400": response("Invalid JSON or validation failure"),
+				}, idempotencyKeyParameter()),
+			},
+			"/personas/{id}": spec{
+				"parameters": []spec{pathParameter("id", "Persona ID")},
+				"get": operation("Get a persona", nil, responses{
+					"200": jsonResponse("The persona", ref("Persona")),
+					"304": response("Unchanged since the ETag in If-None-Match"),
+					"400": response("Unknown field in fields"),
+					"404": response("Persona not found"),
+				}, ifNoneMatchParameter(), fieldsParameter()),
+				"put": operation("Update a persona", ref("Persona"), responses{
+					"200": jsonResponse("The updated persona", ref("Persona")),
+					"400": response("Invalid JSON, If-Match or validation failure"),
+					"409": response("Version conflict"),
+				}, spec{
+					"name":        "If-Match",
+					"in":          "header",
+					"description": "Expected persona version",
+					"schema":      spec{"type": "string"},
+				}),
+				"delete": operation("Delete a persona", nil, responses{
+					"200": jsonResponse("Deleted with its identities (cascade=true)", spec{
+						"type":       "object",
+						"properties": spec{"identities_deleted": spec{"type": "integer"}},
+					}),
+					"204": response("Deleted"),
+					"400": response("Invalid cascade value"),
+					"404": response("Persona not found"),
+				}, queryParameter("cascade", "Also delete the persona's identities", spec{"type": "boolean"})),
+			},
+			"/personas/{id}/restore": spec{
+				"parameters": []spec{pathParameter("id", "Persona ID")},
+				"post": operation("Restore a soft-deleted persona", nil, responses{
+					"200": jsonResponse("The restored persona", ref("Persona")),
+					"404": response("Persona not found"),
+					"409": response("Persona is not deleted"),
+				}),
+			},
+			"/personas/{id}/feature": spec{
+				"parameters": []spec{pathParameter("id", "Persona ID")},
+				"put": operation("Feature a persona", spec{
+					"type":       "object",
+					"properties": spec{"order": spec{"type": "integer", "description": "Lower orders list first"}},
+				}, responses{
+					"200": jsonResponse("The featured persona", ref("Persona")),
+					"400": response("Invalid JSON"),
+					"404": response("Persona not found"),
+					"409": response("Persona changed concurrently"),
+				}),
+			},
+			"/personas/{id}/unfeature": spec{
+				"parameters": []spec{pathParameter("id", "Persona ID")},
+				"put": operation("Stop featuring a persona", nil, responses{
+					"200": jsonResponse("The persona", ref("Persona")),
+					"404": response("Persona not found"),
+					"409": response("Persona changed concurrently"),
+				}),
+			},
+			"/personas/{id}/identities": spec{
+				"parameters": []spec{pathParameter("id", "Persona ID")},
+				"get": operation("List the identities derived from a persona", nil, responses{
+					"200": jsonResponse("The persona's identities", arrayOf(ref("Identity"))),
+					"404": response("Persona not found"),
+				}),
+			},
+			"/personas/{id}/rag": spec{
+				"parameters": []spec{pathParameter("id", "Persona ID")},
+				"get": operation("List a persona's RAG documents", nil, responses{
+					"200": jsonResponse("The persona's RAG documents", arrayOf(ref("RAGDocument"))),
+					"404": response("Persona not found"),
+				}),
+				"post": operation("Attach a RAG document to a persona", ref("RAGDocument"), responses{
+					"201": jsonResponse("The stored document", ref("RAGDocument")),
+					"400": response("Invalid JSON or validation failure"),
+					"404": response("Persona not found"),
+					"409": response("A document with this ID already exists"),
+				}),
+			},
+			"/personas/{id}/rag/{docId}": spec{
+				"parameters": []spec{
+					pathParameter("id", "Persona ID"),
+					pathParameter("docId", "RAG document ID"),
+				},
+				"delete": operation("Remove a RAG document from a persona", nil, responses{
+					"204": response("Removed"),
+					"404": response("Persona or document not found"),
+				}),
+			},
+			"/personas/{id}/size": spec{
+				"parameters": []spec{pathParameter("id", "Persona ID")},
+				"get": operation("Measure a persona's prompt and context values", nil, responses{
+					"200": jsonResponse("Character, word and approximate token counts", spec{
+						"type": "object",
+						"properties": spec{
+							"persona_id":       spec{"type": "string"},
+							"characters":       spec{"type": "integer"},
+							"words":            spec{"type": "integer"},
+							"estimated_tokens": spec{"type": "integer", "description": "About one token per four characters"},
+						},
+					}),
+					"404": response("Persona not found"),
+				}),
+			},
+			"/personas/{id}/diff": spec{
+				"parameters": []spec{pathParameter("id", "Persona ID")},
+				"get": operation("Compare a persona with another persona or a past version", nil, responses{
+					"200": jsonResponse("The differences", ref("PersonaDiff")),
+					"400": response("Neither or both of against and version given, or an invalid version"),
+					"404": response("Persona or version not found"),
+				},
+					queryParameter("against", "ID of the persona to compare with", spec{"type": "string"}),
+					queryParameter("version", "Version of this persona to compare the current state with", spec{"type": "integer", "minimum": 1}),
+				),
+			},
+			"/personas/{id}/versions": spec{
+				"parameters": []spec{pathParameter("id", "Persona ID")},
+				"get": operation("List a persona's past versions, oldest first", nil, responses{
+					"200": jsonResponse("The version history", arrayOf(ref("PersonaVersion"))),
+					"404": response("Persona not found"),
+				}),
+			},
+			"/personas/{id}/versions/{n}": spec{
+				"parameters": []spec{
+					pathParameter("id", "Persona ID"),
+					pathParameter("n", "Version number, 1 for the oldest"),
+				},
+				"get": operation("Get a past version of a persona", nil, responses{
+					"200": jsonResponse("The version", ref("PersonaVersion")),
+					"400": response("Invalid version number"),
+					"404": response("Persona or version not found"),
+				}),
+			},
+			"/personas/{id}/render": spec{
+				"parameters": []spec{pathParameter("id", "Persona ID")},
+				"post": operation("Substitute {{variables}} in a persona's prompt and context", spec{
+					"type": "object",
+					"properties": spec{
+						"variables": spec{"type": "object", "additionalProperties": spec{"type": "string"}},
+					},
+				}, responses{
+					"200": jsonResponse("The rendered prompt and context", spec{
+						"type": "object",
+						"properties": spec{
+							"persona_id": spec{"type": "string"},
+							"prompt":     spec{"type": "string"},
+							"context":    spec{"type": "object", "additionalProperties": spec{"type": "string"}},
+						},
+					}),
+					"400": response("Invalid JSON or unresolved variables"),
+					"404": response("Persona not found"),
+				}),
+			},
+			"/identities": spec{
+				"get": operation("List identities", nil, responses{
+					"200": jsonResponse("Matching identities", arrayOf(ref("Identity"))),
+					"400": response("Invalid query parameter"),
+					"500": response("Storage failure"),
+				},
+					queryParameter("persona_id", "Only identities of this persona", spec{"type": "string"}),
+					queryParameter("search", "Case-insensitive text search", spec{"type": "string"}),
+					queryParameter("deep", "Also search occupation, city, interests and values", spec{"type": "boolean"}),
+					queryParameter("is_active", "Filter by active state", spec{"type": "boolean"}),
+					queryParameter("min_age", "Minimum age, inclusive", spec{"type": "integer", "minimum": 0}),
+					queryParameter("max_age", "Maximum age, inclusive", spec{"type": "integer", "minimum": 0}),
+					queryParameter("city", "Case-insensitive city match", spec{"type": "string"}),
+				),
+				"post": operation("Create an identity", ref("Identity"), responses{
+					"200": jsonResponse("The identity an earlier request with the same Idempotency-Key created", ref("Identity")),
+					"201": jsonResponse("The created identity", ref("Identity")),
+					"400": response("Invalid JSON or validation failure"),
+				}, idempotencyKeyParameter()),
+			},
+			"/identities/duplicates": spec{
+				"get": operation("Find groups of likely duplicate identities", nil, responses{
+					"200": jsonResponse("Groups of duplicate identity IDs", spec{
+						"type": "object",
+						"properties": spec{
+							"threshold": spec{"type": "number"},
+							"groups":    arrayOf(arrayOf(spec{"type": "string"})),
+						},
+					}),
+					"400": response("Invalid threshold"),
+				}, queryParameter("threshold", "Similarity above which identities are duplicates (default 0.9)", spec{"type": "number", "minimum": 0, "maximum": 1})),
+			},
+			"/identities/sample": spec{
+				"get": operation("Pick identities at random", nil, responses{
+					"200": jsonResponse("Up to n identities, without repeats", arrayOf(ref("Identity"))),
+					"400": response("Invalid n or seed"),
+				},
+					queryParameter("n", "Number of identities to return (default 10)", spec{"type": "integer", "minimum": 1}),
+					queryParameter("persona_id", "Only sample identities of this persona", spec{"type": "string"}),
+					queryParameter("tags", "Comma-separated tags; identities with any of them match", spec{"type": "string"}),
+					queryParameter("seed", "Random seed; the same seed returns the same sample", spec{"type": "integer"}),
+				),
+			},
+			"/identities/export": spec{
+				"get": operation("Stream identities as JSON Lines", nil, responses{
+					"200": spec{
+						"description": "One identity object per line, ordered by ID",
+						"content":     spec{"application/x-ndjson": spec{"schema": ref("Identity")}},
+					},
+					"400": response("Unsupported format or invalid query parameter"),
+				},
+					queryParameter("format", "Export format; only jsonl (the default) is supported", spec{"type": "string", "enum": []string{"jsonl"}}),
+					queryParameter("persona_id", "Only identities of this persona", spec{"type": "string"}),
+					queryParameter("search", "Case-insensitive text search", spec{"type": "string"}),
+					queryParameter("deep", "Also search occupation, city, interests and values", spec{"type": "boolean"}),
+					queryParameter("is_active", "Filter by active state", spec{"type": "boolean"}),
+					queryParameter("min_age", "Minimum age, inclusive", spec{"type": "integer", "minimum": 0}),
+					queryParameter("max_age", "Maximum age, inclusive", spec{"type": "integer", "minimum": 0}),
+					queryParameter("city", "Case-insensitive city match", spec{"type": "string"}),
+				),
+			},
+			"/identities/{id}": spec{
+				"parameters": []spec{pathParameter("id", "Identity ID")},
+				"get": operation("Get an identity", nil, responses{
+					"200": jsonResponse("The identity", ref("Identity")),
+					"404": response("Identity not found"),
+				}),
+				"put": operation("Replace an identity", ref("Identity"), responses{
+					"200": jsonResponse("The updated identity", ref("Identity")),
+					"400": response("Invalid JSON or validation failure"),
+				}),
+				"patch": operation("Update some identity fields", spec{"type": "object"}, responses{
+					"200": jsonResponse("The patched identity", ref("Identity")),
+					"400": response("Invalid JSON or validation failure"),
+					"404": response("Identity not found"),
+				}),
+				"delete": operation("Delete an identity", nil, responses{
+					"204": response("Deleted"),
+					"404": response("Identity not found"),
+				}),
+			},
+			"/identities/{id}/attributes": spec{
+				"parameters": []spec{pathParameter("id", "Identity ID")},
+				"put": operation("Replace only an identity's rich attributes", ref("Identity/properties/rich_attributes"), responses{
+					"200": jsonResponse("The updated identity", ref("Identity")),
+					"400": response("Invalid JSON or validation failure"),
+					"404": response("Identity or its persona not found"),
+				}),
+			},
+			"/identities/{id}/avatar": spec{
+				"parameters": []spec{pathParameter("id", "Identity ID")},
+				"get": operation("Get an identity's avatar image", nil, responses{
+					"200": spec{"description": "The avatar image", "content": imageContent()},
+					"404": response("Identity or avatar not found"),
+				}),
+				"put": func() spec {
+					op := operation("Set an identity's avatar to a PNG or JPEG image", nil, responses{
+						"204": response("Avatar stored"),
+						"404": response("Identity not found"),
+						"413": response("Image larger than 512KB"),
+						"415": response("Not a PNG or JPEG image, or not of the declared Content-Type"),
+					})
+					op["requestBody"] = spec{"required": true, "content": imageContent()}
+					return op
+				}(),
+				"delete": operation("Delete an identity's avatar", nil, responses{
+					"204": response("Deleted"),
+					"404": response("Identity or avatar not found"),
+				}),
+			},
+			"/identities/{id}/tags": spec{
+				"parameters": []spec{pathParameter("id", "Identity ID")},
+				"post": operation("Add one tag to an identity", spec{
+					"type":       "object",
+					"required":   []string{"tag"},
+					"properties": spec{"tag": spec{"type": "string"}},
+				}, responses{
+					"200": jsonResponse("The identity with the tag; adding a tag it already has changes nothing", ref("Identity")),
+					"400": response("Missing tag or too many tags"),
+					"404": response("Identity not found"),
+				}),
+			},
+			"/identities/{id}/tags/{tag}": spec{
+				"parameters": []spec{pathParameter("id", "Identity ID"), pathParameter("tag", "Tag to remove")},
+				"delete": operation("Remove one tag from an identity", nil, responses{
+					"200": jsonResponse("The identity without the tag; removing a tag it does not have changes nothing", ref("Identity")),
+					"404": response("Identity not found"),
+				}),
+			},
+			"/communities": spec{
+				"get": operation("List communities", nil, responses{
+					"200": jsonResponse("Matching communities", arrayOf(ref("Community"))),
+					"400": response("Invalid query parameter"),
+					"500": response("Storage failure"),
+				},
+					queryParameter("type", "Only communities of this type", spec{"type": "string"}),
+					queryParameter("search", "Case-insensitive text search", spec{"type": "string"}),
+					queryParameter("is_active", "Filter by active state", spec{"type": "boolean"}),
+					queryParameter("min_size", "Minimum member count", spec{"type": "integer", "minimum": 0}),
+					queryParameter("max_size", "Maximum member count", spec{"type": "integer", "minimum": 0}),
+					queryParameter("min_diversity", "Minimum diversity score", spec{"type": "number", "minimum": 0, "maximum": 1}),
+					queryParameter("max_diversity", "Maximum diversity score", spec{"type": "number", "minimum": 0, "maximum": 1}),
+					queryParameter("min_avg_age", "Minimum average member age", spec{"type": "number", "minimum": 0}),
+					queryParameter("max_avg_age", "Maximum average member age", spec{"type": "number", "minimum": 0}),
+					queryParameter("dominant_political", "Only communities where this political leaning is the most common", spec{"type": "string"}),
+					queryParameter("sort", "Field to order results by", spec{"type": "string", "enum": []string{"size", "diversity", "cohesion"}}),
+					queryParameter("order", "Sort direction", spec{"type": "string", "enum": []string{"asc", "desc"}, "default": "asc"}),
+				),
+			},
+			"/communities/{id}": spec{
+				"parameters": []spec{pathParameter("id", "Community ID")},
+				"get": operation("Get a community", nil, responses{
+					"200": jsonResponse("The community", ref("Community")),
+					"404": response("Community not found"),
+				}),
+				"put": operation("Update a community", ref("Community"), responses{
+					"200": jsonResponse("The updated community", ref("Community")),
+					"400": response("Invalid JSON or validation failure"),
+				}),
+				"delete": operation("Delete a community", nil, responses{
+					"204": response("Deleted"),
+					"404": response("Community not found"),
+				}),
+			},
+			"/communities/{id}/bundle": spec{
+				"parameters": []spec{pathParameter("id", "Community ID")},
+				"get": operation("Export a community with its members and their personas", nil, responses{
+					"200": jsonResponse("The community bundle", ref("CommunityBundle")),
+					"404": response("Community not found"),
+				}),
+			},
+			"/communities/{id}/recalculate": spec{
+				"parameters": []spec{pathParameter("id", "Community ID")},
+				"post": operation("Recompute a community's diversity, cohesion and attributes from its members", nil, responses{
+					"200": jsonResponse("The updated community", ref("Community")),
+					"404": response("Community not found"),
+				}),
+			},
+			"/communities/import-bundle": spec{
+				"post": operation("Recreate a community from a bundle under new IDs", ref("CommunityBundle"), responses{
+					"201": jsonResponse("The imported community", ref("Community")),
+					"400": response("Invalid JSON, or the bundle is invalid or incomplete"),
+				}),
+			},
+			"/communities/generate": spec{
+				"post": operation("Generate a community", ref("CommunityGenerationRequest"), responses{
+					"201": jsonResponse("The generated community", ref("Community")),
+					"202": jsonResponse("Generation started; the community is POSTed to callback_url", ref("Job")),
+					"400": response("Invalid JSON or generation parameters"),
+					"404": response("Template not found"),
+					"503": response("Too many generation jobs queued, or the server is shutting down"),
+					"504": response("Generation timed out"),
+				}),
+			},
+			"/community-templates": spec{
+				"get": operation("List saved community generation templates", nil, responses{
+					"200": jsonResponse("Templates ordered by name", arrayOf(ref("CommunityTemplate"))),
+					"501": response("Storage backend does not support templates"),
+				}),
+				"post": operation("Save a community generation template", spec{
+					"type":     "object",
+					"required": []string{"name"},
+					"properties": spec{
+						"name":   spec{"type": "string"},
+						"config": spec{"type": "object"},
+					},
+				}, responses{
+					"201": jsonResponse("The saved template", ref("CommunityTemplate")),
+					"400": response("Invalid JSON or template name"),
+					"501": response("Storage backend does not support templates"),
+				}),
+			},
+			"/community-templates/{name}": spec{
+				"parameters": []spec{pathParameter("name", "Template name")},
+				"get": operation("Get a community generation template", nil, responses{
+					"200": jsonResponse("The template", ref("CommunityTemplate")),
+					"404": response("Template not found"),
+				}),
+				"put": operation("Save a template's generation config", spec{"type": "object"}, responses{
+					"200": jsonResponse("The saved template", ref("CommunityTemplate")),
+					"400": response("Invalid JSON or template name"),
+				}),
+			},
+			"/stats": spec{
+				"get": operation("Summarize the whole dataset", nil, responses{
+					"200": jsonResponse("Dataset totals", ref("SystemStats")),
+				}),
+			},
+			"/jobs/{id}": spec{
+				"parameters": []spec{pathParameter("id", "Job ID")},
+				"get": operation("Get an asynchronous generation job", nil, responses{
+					"200": jsonResponse("The job", ref("Job")),
+					"404": response("Job not found"),
+				}),
+			},
+		},
+		"components": spec{
+			"schemas": spec{
+				"Persona":                    personaSpec(),
+				"PersonaVersion":             personaVersionSpec(),
+				"PersonaDiff":                personaDiffSpec(),
+				"RAGDocument":                ragDocumentSpec(),
+				"Identity":                   identitySpec(),
+				"Community":                  communitySpec(),
+				"CommunityGenerationRequest": communityGenerationRequestSpec(),
+				"CommunityTemplate":          communityTemplateSpec(),
+				"CommunityBundle":            communityBundleSpec(),
+				"Job":                        jobSpec(),
+				"SystemStats":                systemStatsSpec(),
+			},
+		},
+	}
+}
+
+// openAPIHandler serves the OpenAPI document
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OpenAPISpec())
+}
+
+type responses = spec
+
+func operation(summary string, body spec, resp responses, parameters ...spec) spec {
+	op := spec{"summary": summary, "responses": resp}
+	if body != nil {
+		op["requestBody"] = spec{
+			"required": true,
+			"content":  spec{"application/json": spec{"schema": body}},
+		}
+	}
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+	return op
+}
+
+func jsonResponse(description string, schema spec) spec {
+	return spec{
+		"description": description,
+		"content":     spec{"application/json": spec{"schema": schema}},
+	}
+}
+
+// imageContent describes a raw PNG or JPEG body
+func imageContent() spec {
+	image := spec{"schema": spec{"type": "string", "format": "binary"}}
+	return spec{"image/png": image, "image/jpeg": image}
+}
+
+// response describes a response without a documented body
+func response(description string) spec {
+	return spec{"description": description}
+}
+
+func pathParameter(name, description string) spec {
+	return spec{
+		"name":        name,
+		"in":          "path",
+		"required":    true,
+		"description": description,
+		"schema":      spec{"type": "string"},
+	}
+}
+
+func queryParameter(name, description string, schema spec) spec {
+	return spec{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      schema,
+	}
+}
+
+func ifNoneMatchParameter() spec {
+	return spec{
+		"name":        "If-None-Match",
+		"in":          "header",
+		"description": "ETag from a previous response",
+		"schema":      spec{"type": "string"},
+	}
+}
+
+func idempotencyKeyParameter() spec {
+	return spec{
+		"name":        "Idempotency-Key",
+		"in":          "header",
+		"description": "Makes retries return the resource the first request created",
+		"schema":      spec{"type": "string", "maxLength": maxIdempotencyKeyLength},
+	}
+}
+
+func fieldsParameter() spec {
+	return queryParameter("fields", "Comma-separated persona fields to return, e.g. id,name,topic", spec{"type": "string"})
+}
+
+func ref(name string) spec {
+	return spec{"$ref": "#/components/schemas/" + name}
+}
+
+func arrayOf(items spec) spec {
+	return spec{"type": "array", "items": items}
+}
+
+func personaSpec() spec {
+	return spec{
+		"type":     "object",
+		"required": []string{"name", "topic", "prompt"},
+		"properties": spec{
+			"id":            spec{"type": "string", "readOnly": true},
+			"name":          spec{"type": "string"},
+			"topic":         spec{"type": "string"},
+			"prompt":        spec{"type": "string"},
+			"context":       spec{"type": "object", "additionalProperties": spec{"type": "string"}},
+			"rag":           arrayOf(spec{"type": "string"}),
+			"rag_documents": arrayOf(ref("RAGDocument")),
+			"tags":          arrayOf(spec{"type": "string"}),
+			"version":       spec{"type": "integer", "format": "int64"},
+			"parent_id":     spec{"type": "string"},
+			"created_at":    spec{"type": "string", "format": "date-time", "readOnly": true},
+			"updated_at":    spec{"type": "string", "format": "date-time", "readOnly": true},
+			"deleted_at":    spec{"type": "string", "format": "date-time", "readOnly": true},
+			"featured":      spec{"type": "boolean", "readOnly": true},
+			"feature_order": spec{"type": "integer", "readOnly": true},
+		},
+	}
+}
+
+func personaVersionSpec() spec {
+	return spec{
+		"type": "object",
+		"properties": spec{
+			"version":    spec{"type": "integer"},
+			"created_at": spec{"type": "string", "format": "date-time"},
+			"persona":    ref("Persona"),
+		},
+	}
+}
+
+func ragDocumentSpec() spec {
+	return spec{
+		"type":        "object",
+		"description": "A document a persona draws on; needs content, a source or both",
+		"properties": spec{
+			"id":        spec{"type": "string", "description": "Generated when omitted"},
+			"title":     spec{"type": "string", "maxLength": 200},
+			"source":    spec{"type": "string"},
+			"content":   spec{"type": "string"},
+			"embedding": arrayOf(spec{"type": "number", "format": "float"}),
+		},
+	}
+}
+
+// identitySpec reuses the JSON Schema served at /schema/identity.json,
+// without the keywords OpenAPI 3.0 does not allow in a component
+func identitySpec() spec {
+	schema := middleware.IdentitySchema()
+	delete(schema, "$schema")
+	delete(schema, "$id")
+	return schema
+}
+
+func communitySpec() spec {
+	return spec{
+		"type":     "object",
+		"required": []string{"name", "type"},
+		"properties": spec{
+			"id":                  spec{"type": "string", "readOnly": true},
+			"name":                spec{"type": "string"},
+			"description":         spec{"type": "string"},
+			"type":                spec{"type": "string", "enum": []string{"geographic", "demographic", "interest", "political", "professional"}},
+			"size":                spec{"type": "integer"},
+			"diversity":           spec{"type": "number", "minimum": 0, "maximum": 1},
+			"cohesion":            spec{"type": "number", "minimum": 0, "maximum": 1},
+			"metrics_member_hash": spec{"type": "string", "readOnly": true, "description": "Member set diversity and cohesion were last computed for"},
+			"attributes":          spec{"type": "object"},
+			"member_ids":          arrayOf(spec{"type": "string"}),
+			"max_members":         spec{"type": "integer"},
+			"min_members":         spec{"type": "integer"},
+			"generation_config":   spec{"type": "object"},
+			"created_at":          spec{"type": "string", "format": "date-time"},
+			"updated_at":          spec{"type": "string", "format": "date-time"},
+			"tags":                arrayOf(spec{"type": "string"}),
+			"is_active":           spec{"type": "boolean"},
+		},
+	}
+}
+
+func communityGenerationRequestSpec() spec {
+	return spec{
+		"type":     "object",
+		"required": []string{"name", "type", "target_size"},
+		"properties": spec{
+			"name":              spec{"type": "string"},
+			"description":       spec{"type": "string"},
+			"type":              spec{"type": "string"},
+			"target_size":       spec{"type": "integer", "minimum": 1},
+			"generation_config": spec{"type": "object"},
+			"template":          spec{"type": "string", "description": "Name of a saved template to use instead of generation_config"},
+			"callback_url":      spec{"type": "string", "format": "uri"},
+		},
+	}
+}
+
+func communityTemplateSpec() spec {
+	return spec{
+		"type": "object",
+		"properties": spec{
+			"name":       spec{"type": "string"},
+			"config":     spec{"type": "object"},
+			"created_at": spec{"type": "string", "format": "date-time"},
+			"updated_at": spec{"type": "string", "format": "date-time"},
+		},
+	}
+}
+
+func communityBundleSpec() spec {
+	return spec{
+		"type":     "object",
+		"required": []string{"community", "identities", "personas"},
+		"properties": spec{
+			"community":  ref("Community"),
+			"identities": arrayOf(ref("Identity")),
+			"personas":   arrayOf(ref("Persona")),
+		},
+	}
+}
+
+func personaDiffSpec() spec {
+	change := spec{
+		"type": "object",
+		"properties": spec{
+			"field": spec{"type": "string"},
+			"from":  spec{"type": "string"},
+			"to":    spec{"type": "string"},
+		},
+	}
+	return spec{
+		"type": "object",
+		"properties": spec{
+			"from":            spec{"type": "string"},
+			"to":              spec{"type": "string"},
+			"identical":       spec{"type": "boolean"},
+			"fields":          arrayOf(change),
+			"context_added":   spec{"type": "object", "additionalProperties": spec{"type": "string"}},
+			"context_removed": spec{"type": "object", "additionalProperties": spec{"type": "string"}},
+			"context_changed": spec{"type": "object", "additionalProperties": change},
+			"rag_added":       arrayOf(spec{"type": "string"}),
+			"rag_removed":     arrayOf(spec{"type": "string"}),
+		},
+	}
+}
+
+func systemStatsSpec() spec {
+	return spec{
+		"type": "object",
+		"properties": spec{
+			"total_personas":          spec{"type": "integer"},
+			"total_identities":        spec{"type": "integer"},
+			"total_communities":       spec{"type": "integer"},
+			"average_community_size":  spec{"type": "number"},
+			"most_common_topic":       spec{"type": "string"},
+			"most_common_topic_count": spec{"type": "integer"},
+			"generated_at":            spec{"type": "string", "format": "date-time"},
+		},
+	}
+}
+
+func jobSpec() spec {
+	return spec{
+		"type": "object",
+		"properties": spec{
+			"id":              spec{"type": "string"},
+			"status":          spec{"type": "string", "enum": []string{JobRunning, JobSucceeded, JobFailed}},
+			"callback_url":    spec{"type": "string", "format": "uri"},
+			"callback_status": spec{"type": "string", "enum": []string{CallbackPending, CallbackDelivered, CallbackFailed}},
+			"community_id":    spec{"type": "string"},
+			"error":           spec{"type": "string"},
+			"created_at":      spec{"type": "string", "format": "date-time"},
+			"updated_at":      spec{"type": "string", "format": "date-time"},
+		},
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// personaRAGHandler serves GET and POST /personas/{id}/rag
+func (s *Server) personaRAGHandler(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		docs, err := s.service.ListRAGDocuments(id)
+		if err != nil {
+			s.writeRAGError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(docs)
+
+	case http.MethodPost:
+		var doc types.RAGDocument
+		if err := s.decodeJSON(r, &doc); err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		stored, err := s.service.AddRAGDocument(id, doc)
+		if err != nil {
+			s.writeRAGError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(stored)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// personaRAGDocumentHandler serves DELETE /personas/{id}/rag/{docId}
+func (s *Server) personaRAGDocumentHandler(w http.ResponseWriter, r *http.Request, id, docID string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.service.RemoveRAGDocument(id, docID); err != nil {
+		s.writeRAGError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeRAGError reports a RAG document operation failure with a status
+// matching its cause
+func (s *Server) writeRAGError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, errs.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errs.ErrConflict):
+		status = http.StatusConflict
+	}
+	s.handleError(w, err, status)
+}
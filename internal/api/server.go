@@ -3,12 +3,20 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/community"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/config"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/metrics"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/persona"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
@@ -20,15 +28,44 @@ type Server struct {
 	config           *config.Config
 	service          *persona.Service
 	communityService *community.Service
-	server           *http.Server
+	metrics          metrics.Recorder
+	
+	// Asynchronous community generation
+	jobs              *jobStore
+	jobQueue          chan generationJob // started on first use, guarded by mu
+	jobWorkers        sync.WaitGroup
+	jobCtx            context.Context // cancelled when Shutdown stops waiting for jobs
+	cancelJobs        context.CancelFunc
+	webhookClient     *http.Client
+	webhookRetryDelay time.Duration
+	
+	// Idempotency-Key handling for creation requests
+	idempotency      IdempotencyStore
+	idempotencyLocks keyLocks // serializes requests that share a key
+	
+	mu     sync.Mutex // guards server, closed and jobQueue
+	server *http.Server
+	closed bool // Shutdown was called, possibly before Start
 }
 
 // NewServer creates a new HTTP server instance
 func NewServer(cfg *config.Config, service *persona.Service) *Server {
+	communityService := community.NewService(service.GetStorage())
+	communityService.SetGenerationTimeout(cfg.Community.GenerationTimeout)
+	communityService.SetGenerationWorkers(cfg.Community.GenerationWorkers)
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	
 	return &Server{
 		config:           cfg,
 		service:          service,
-		communityService: community.NewService(service.GetStorage()),
+		communityService:  communityService,
+		metrics:           metrics.NewRegistry(),
+		jobs:              newJobStore(),
+		jobCtx:            jobCtx,
+		cancelJobs:        cancelJobs,
+		webhookClient:     newWebhookClient(cfg.Community.CallbackHosts),
+		webhookRetryDelay: defaultWebhookRetryDelay,
+		idempotency:       NewMemoryIdempotencyStore(),
 	}
 }
 
@@ -36,53 +73,205 @@ func NewServer(cfg *config.Config, service *persona.Service) *Server {
 func (s *Server) Start() error {
 	mux := http.NewServeMux()
 	
+	// handle registers a handler and records request metrics under its pattern
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, s.instrument(pattern, handler))
+	}
+	
 	// Health check endpoint
-	mux.HandleFunc("/health", s.healthHandler)
+	handle("/health", s.healthHandler)
+	handle("/stats", s.statsHandler)
 	
 	// Persona endpoints
-	mux.HandleFunc("/personas", s.personasHandler)
-	mux.HandleFunc("/personas/", s.personaHandler)
+	handle("/personas", s.personasHandler)
+	handle("/personas/", s.personaHandler)
+	handle("/personas/import", s.importPersonasHandler)
+	handle("/personas/export", s.exportPersonasHandler)
 	
 	// Identity endpoints
-	mux.HandleFunc("/identities", s.identitiesHandler)
-	mux.HandleFunc("/identities/", s.identityHandler)
+	handle("/identities", s.identitiesHandler)
+	handle("/identities/", s.identityHandler)
+	handle("/identities/batch", s.batchCreateIdentitiesHandler)
+	handle("/identities/duplicates", s.duplicateIdentitiesHandler)
+	handle("/identities/sample", s.sampleIdentitiesHandler)
+	handle("/identities/export", s.exportIdentitiesHandler)
 	
 	// Community endpoints
-	mux.HandleFunc("/communities", s.communitiesHandler)
-	mux.HandleFunc("/communities/", s.communityHandler)
-	mux.HandleFunc("/communities/generate", s.generateCommunityHandler)
+	handle("/communities", s.communitiesHandler)
+	handle("/communities/", s.communityHandler)
+	handle("/communities/generate", s.generateCommunityHandler)
+	handle("/communities/import-bundle", s.importCommunityBundleHandler)
+	handle("/community-templates", s.communityTemplatesHandler)
+	handle("/community-templates/", s.communityTemplateHandler)
+	handle("/jobs/", s.jobHandler)
+	
+	// Admin endpoints
+	handle("/admin/rebuild-indexes", s.rebuildIndexesHandler)
+	
+	// Metrics endpoint
+	mux.HandleFunc("/metrics", s.metricsHandler)
+	
+	// Schema endpoints
+	handle("/schema/identity.json", s.identitySchemaHandler)
+	handle("/openapi.json", s.openAPIHandler)
 	
 	// Apply middleware
 	var handler http.Handler = mux
 	
-	// Add CORS middleware
-	handler = middleware.CORSMiddleware(handler)
+	// Cap request bodies so a client cannot exhaust memory
+	if s.config.HTTP.MaxBodySize > 0 {
+		handler = middleware.BodyLimitMiddleware(int64(s.config.HTTP.MaxBodySize))(handler)
+	}
+	
+	// Compress large responses for clients that accept gzip
+	if s.config.HTTP.EnableCompression {
+		handler = middleware.GzipMiddleware(s.config.HTTP.CompressionMinSize)(handler)
+	}
+	
+	// Add CORS middleware, unless disabled in the configuration
+	handler = middleware.CORS(s.config.Security.CORS)(handler)
 	
 	// Add authentication middleware if enabled
 	if s.config.Security.EnableAuth {
-		handler = middleware.AuthMiddleware(s.config.Security.APIKey)(handler)
+		keys, err := s.config.Security.KeyScopes()
+		if err != nil {
+			return fmt.Errorf("invalid API keys: %v", err)
+		}
+		handler = middleware.ScopedAuthMiddleware(keys)(handler)
 	}
 	
-	s.server = &http.Server{
+	// Log every request, including preflight and rejected ones
+	handler = middleware.LoggingMiddleware(handler)
+	
+	server := &http.Server{
 		Addr:         ":" + s.config.HTTP.Port,
 		Handler:      handler,
 		ReadTimeout:  s.config.HTTP.ReadTimeout,
 		WriteTimeout: s.config.HTTP.WriteTimeout,
 	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	s.server = server
+	s.mu.Unlock()
 	
 	if s.config.HTTP.EnableTLS {
-		return s.server.ListenAndServeTLS(s.config.HTTP.CertFile, s.config.HTTP.KeyFile)
+		return server.ListenAndServeTLS(s.config.HTTP.CertFile, s.config.HTTP.KeyFile)
 	}
 	
-	return s.server.ListenAndServe()
+	return server.ListenAndServe()
 }
 
-// Shutdown gracefully shuts down the server
+// Shutdown gracefully shuts down the server, waiting for in-flight requests
+// and queued generation jobs until ctx is done. Start returns
+// http.ErrServerClosed once it has been called, even if Start had not run
+// yet.
 func (s *Server) Shutdown(ctx context.Context) error {
-	if s.server == nil {
-		return nil
+	s.mu.Lock()
+	s.closed = true
+	server := s.server
+	s.mu.Unlock()
+	
+	var err error
+	if server != nil {
+		err = server.Shutdown(ctx)
+	}
+	if jobErr := s.drainJobs(ctx); err == nil {
+		err = jobErr
+	}
+	return err
+}
+
+// instrument records request counts and latency for a handler under name
+func (s *Server) instrument(name string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler(recorder, r)
+		s.metrics.ObserveRequest(name, recorder.status, time.Since(start))
+	}
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+// metricsHandler refreshes the storage gauges and serves the metrics in the
+// Prometheus text format
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	if personas, err := s.service.ListPersonas(); err == nil {
+		s.metrics.SetGauge(metrics.PersonasStored, float64(len(personas)))
+	}
+	if identities, err := s.service.ListIdentities(nil); err == nil {
+		s.metrics.SetGauge(metrics.IdentitiesStored, float64(len(identities)))
+	}
+	if communities, err := s.service.ListCommunities(nil); err == nil {
+		s.metrics.SetGauge(metrics.CommunitiesStored, float64(len(communities)))
+	}
+	
+	handler, ok := s.metrics.(http.Handler)
+	if !ok {
+		http.Error(w, "Metrics are not exposed by this recorder", http.StatusNotFound)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// decodeJSON decodes the request body into v. When HTTP.StrictJSON is set,
+// fields that v does not define are rejected instead of ignored.
+func (s *Server) decodeJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	if s.config.HTTP.StrictJSON {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(v)
+}
+
+// writeDecodeError reports a request body that decodeJSON rejected, naming
+// the offending field when it was unknown
+func writeDecodeError(w http.ResponseWriter, err error) {
+	if middleware.IsBodyTooLarge(err) {
+		writeReadError(w, err)
+		return
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		http.Error(w, "Invalid JSON: unknown field "+field, http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "Invalid JSON", http.StatusBadRequest)
+}
+
+// writeReadError reports a request body that could not be read, including
+// one cut off by the configured size limit
+func writeReadError(w http.ResponseWriter, err error) {
+	if middleware.IsBodyTooLarge(err) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
 	}
-	return s.server.Shutdown(ctx)
+	http.Error(w, "Failed to read request body", http.StatusBadRequest)
 }
 
 // handleError provides consistent error response handling
@@ -131,25 +320,104 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(health)
 }
 
+// statsHandler summarizes the whole dataset
+func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	stats, err := s.service.GetSystemStats()
+	if err != nil {
+		s.handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
 func (s *Server) personasHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		personas, err := s.service.ListPersonas()
+		includeDeleted := false
+		if value := r.URL.Query().Get("include_deleted"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				http.Error(w, "include_deleted must be true or false", http.StatusBadRequest)
+				return
+			}
+			includeDeleted = parsed
+		}
+		featuredFirst := false
+		if value := r.URL.Query().Get("featured_first"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				http.Error(w, "featured_first must be true or false", http.StatusBadRequest)
+				return
+			}
+			featuredFirst = parsed
+		}
+		fields, err := parseFields(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		
+		query := r.URL.Query()
+		filter := &types.PersonaFilter{
+			Topic:          query.Get("topic"),
+			Search:         query.Get("search"),
+			IncludeDeleted: includeDeleted,
+		}
+		if tags := query.Get("tags"); tags != "" {
+			for _, tag := range strings.Split(tags, ",") {
+				filter.Tags = append(filter.Tags, strings.TrimSpace(tag))
+			}
+		}
+		personas, err := s.service.ListPersonasFiltered(filter)
 		if err != nil {
 			http.Error(w, "Failed to list personas", http.StatusInternalServerError)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(personas)
+		// Storage order can change between requests; a fixed order keeps
+		// the body, and so its tag, the same while the personas are
+		sort.Slice(personas, func(i, j int) bool { return personas[i].Id < personas[j].Id })
+		if featuredFirst {
+			persona.SortFeaturedFirst(personas)
+		}
+		var body interface{} = personas
+		if fields != nil {
+			if body, err = projectPersonas(personas, fields); err != nil {
+				http.Error(w, "Failed to encode personas", http.StatusInternalServerError)
+				return
+			}
+		}
+		data, err := stableJSON(body)
+		if err != nil {
+			http.Error(w, "Failed to encode personas", http.StatusInternalServerError)
+			return
+		}
+		writeJSONWithETag(w, r, etagFor(data), data)
 		
 	case http.MethodPost:
 		var p types.Persona
-		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if err := s.decodeJSON(r, &p); err != nil {
+			writeDecodeError(w, err)
 			return
 		}
 		
-		if err := s.service.CreatePersona(&p); err != nil {
+		key, ok := idempotencyKey(w, r, "personas")
+		if !ok {
+			return
+		}
+		replayed, err := s.createIdempotent(key,
+			func(id string) (interface{}, error) { return s.service.GetPersona(id) },
+			func() (string, error) {
+				err := s.service.CreatePersona(&p)
+				return p.Id, err
+			})
+		if err != nil {
 			// Check if it's a validation error
 			if validationErr, ok := err.(middleware.ValidationErrors); ok {
 				w.Header().Set("Content-Type", "application/json")
@@ -163,6 +431,10 @@ func (s *Server) personasHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if replayed != nil {
+			writeReplayed(w, replayed)
+			return
+		}
 		
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
@@ -173,6 +445,88 @@ func (s *Server) personasHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// importPersonasHandler creates personas from an external format. Only
+// format=openai (assistant objects or arrays of them) is supported.
+func (s *Server) importPersonasHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "bundle" && format != "openai" {
+		http.Error(w, fmt.Sprintf("Unsupported import format: %q", format), http.StatusBadRequest)
+		return
+	}
+	
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	
+	if format != "openai" {
+		s.importPersonaBundle(w, r, body)
+		return
+	}
+	
+	personas, err := persona.ParseOpenAIAssistants(body)
+	if err != nil {
+		s.handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	
+	created, err := s.service.CreatePersonas(personas)
+	if err != nil {
+		s.handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// importPersonaBundle loads a bundle produced by GET /personas/export
+func (s *Server) importPersonaBundle(w http.ResponseWriter, r *http.Request, body []byte) {
+	overwrite := false
+	if value := r.URL.Query().Get("overwrite"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "overwrite must be true or false", http.StatusBadRequest)
+			return
+		}
+		overwrite = parsed
+	}
+	
+	imported, err := s.service.ImportPersonas(body, overwrite)
+	if err != nil {
+		s.handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"imported": imported})
+}
+
+// exportPersonasHandler returns all personas as a JSON bundle
+func (s *Server) exportPersonasHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	data, err := s.service.ExportPersonas()
+	if err != nil {
+		http.Error(w, "Failed to export personas", http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="personas.json"`)
+	w.Write(data)
+}
+
 func (s *Server) personaHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract persona ID from URL path
 	id := r.URL.Path[len("/personas/"):]
@@ -180,25 +534,61 @@ func (s *Server) personaHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Persona ID required", http.StatusBadRequest)
 		return
 	}
+	
+	// Handle persona sub-resources such as /personas/{id}/prompt
+	if idx := strings.Index(id, "/"); idx != -1 {
+		s.personaSubresourceHandler(w, r, id[:idx], id[idx+1:])
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
+		fields, err := parseFields(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		p, err := s.service.GetPersona(id)
 		if err != nil {
 			http.Error(w, "Persona not found", http.StatusNotFound)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(p)
+		var body interface{} = p
+		if fields != nil {
+			if body, err = projectPersona(p, fields); err != nil {
+				http.Error(w, "Failed to encode persona", http.StatusInternalServerError)
+				return
+			}
+		}
+		data, err := stableJSON(body)
+		if err != nil {
+			http.Error(w, "Failed to encode persona", http.StatusInternalServerError)
+			return
+		}
+		writeJSONWithETag(w, r, etagFor(data), data)
 		
 	case http.MethodPut:
 		var p types.Persona
-		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if err := s.decodeJSON(r, &p); err != nil {
+			writeDecodeError(w, err)
 			return
 		}
 		
+		// An If-Match header takes precedence over the version in the body
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+			version, err := strconv.Atoi(strings.Trim(ifMatch, `"`))
+			if err != nil {
+				http.Error(w, "If-Match must be a persona version number", http.StatusBadRequest)
+				return
+			}
+			p.Version = version
+		}
+		
 		if err := s.service.UpdatePersona(id, p); err != nil {
+			if errors.Is(err, storage.ErrVersionConflict) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
 			// Check if it's a validation error
 			if validationErr, ok := err.(middleware.ValidationErrors); ok {
 				w.Header().Set("Content-Type", "application/json")
@@ -213,10 +603,41 @@ func (s *Server) personaHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		
+		// Return the stored persona so the client sees the new version
+		if updated, err := s.service.GetPersona(id); err == nil {
+			p = updated
+		}
+		
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(p)
 		
 	case http.MethodDelete:
+		cascade := false
+		if value := r.URL.Query().Get("cascade"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				http.Error(w, "cascade must be true or false", http.StatusBadRequest)
+				return
+			}
+			cascade = parsed
+		}
+		
+		if cascade {
+			// Soft-deleted personas can still be purged with their identities
+			if _, err := s.service.GetStorage().Get(id); err != nil {
+				http.Error(w, "Persona not found", http.StatusNotFound)
+				return
+			}
+			removed, err := s.service.DeletePersonaCascade(id)
+			if err != nil {
+				s.handleError(w, err, http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]int{"identities_deleted": removed})
+			return
+		}
+		
 		if err := s.service.DeletePersona(id); err != nil {
 			http.Error(w, "Persona not found", http.StatusNotFound)
 			return
@@ -228,80 +649,890 @@ func (s *Server) personaHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) identitiesHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		// Parse query parameters for filtering
-		filter := &types.IdentityFilter{}
-		if personaID := r.URL.Query().Get("persona_id"); personaID != "" {
-			filter.PersonaID = personaID
-		}
-		if search := r.URL.Query().Get("search"); search != "" {
-			filter.Search = search
-		}
-		if isActiveStr := r.URL.Query().Get("is_active"); isActiveStr != "" {
-			if isActive := isActiveStr == "true"; isActiveStr == "true" || isActiveStr == "false" {
-				filter.IsActive = &isActive
-			}
-		}
-		
-		// Get identities from storage
-		identities, err := s.service.GetStorage().ListIdentities(filter)
-		if err != nil {
-			http.Error(w, "Failed to list identities", http.StatusInternalServerError)
+// personaSubresourceHandler dispatches endpoints nested under /personas/{id}/
+func (s *Server) personaSubresourceHandler(w http.ResponseWriter, r *http.Request, id, resource string) {
+	// POST /personas/{id}/backups/{backupId}/restore
+	if rest, ok := strings.CutPrefix(resource, "backups/"); ok {
+		if backupID, ok := strings.CutSuffix(rest, "/restore"); ok {
+			s.restorePersonaBackupHandler(w, r, id, backupID)
 			return
 		}
-		
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(identities)
-		
-	case http.MethodPost:
+	}
+	
+	// DELETE /personas/{id}/rag/{docId}
+	if docID, ok := strings.CutPrefix(resource, "rag/"); ok {
+		s.personaRAGDocumentHandler(w, r, id, docID)
+		return
+	}
+	
+	// GET /personas/{id}/versions/{n}
+	if version, ok := strings.CutPrefix(resource, "versions/"); ok {
+		s.personaVersionHandler(w, r, id, version)
+		return
+	}
+	
+	switch resource {
+	case "prompt":
+		s.personaPromptHandler(w, r, id)
+	case "size":
+		s.personaSizeHandler(w, r, id)
+	case "diff":
+		s.personaDiffHandler(w, r, id)
+	case "openai":
+		s.personaOpenAIHandler(w, r, id)
+	case "chain":
+		s.personaChainHandler(w, r, id)
+	case "identities":
+		s.personaIdentitiesHandler(w, r, id)
+	case "rag":
+		s.personaRAGHandler(w, r, id)
+	case "backups":
+		s.personaBackupsHandler(w, r, id)
+	case "versions":
+		s.personaVersionsHandler(w, r, id)
+	case "feature", "unfeature":
+		s.personaFeatureHandler(w, r, id, resource == "feature")
+	case "clone":
+		s.clonePersonaHandler(w, r, id)
+	case "restore":
+		s.restorePersonaHandler(w, r, id)
+	case "render":
+		s.renderPersonaHandler(w, r, id)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// personaFeatureHandler features or unfeatures a persona. Featuring takes
+// an optional {"order": n} body.
+func (s *Server) personaFeatureHandler(w http.ResponseWriter, r *http.Request, id string, feature bool) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	var p types.Persona
+	var err error
+	if feature {
 		var req struct {
-			PersonaID   string                 `json:"persona_id"`
-			Name        string                 `json:"name"`
-			Description string                 `json:"description"`
-			Background  string                 `json:"background"`
-			Tags        []string               `json:"tags"`
+			Order int `json:"order"`
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if err := s.decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+			writeDecodeError(w, err)
 			return
 		}
-		
-		// Create identity
-		identity := &types.Identity{
-			PersonaId:   req.PersonaID,
-			Name:        req.Name,
-			Description: req.Description,
-			Background:  req.Background,
-			Tags:        req.Tags,
+		p, err = s.service.FeaturePersona(id, req.Order)
+	} else {
+		p, err = s.service.UnfeaturePersona(id)
+	}
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			http.Error(w, "Persona not found", http.StatusNotFound)
+			return
 		}
-		
-		if err := s.service.CreateIdentity(identity); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if errors.Is(err, storage.ErrVersionConflict) {
+			s.handleError(w, err, http.StatusConflict)
 			return
 		}
-		
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(identity)
-		
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		s.handleError(w, err, http.StatusInternalServerError)
+		return
 	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
 }
 
-func (s *Server) identityHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract identity ID from URL path
-	path := r.URL.Path[len("/identities/"):]
-	if path == "" {
-		http.Error(w, "Identity ID required", http.StatusBadRequest)
+// personaIdentitiesHandler lists the identities derived from a persona
+func (s *Server) personaIdentitiesHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 	
-	// Handle special endpoints
-	if path == "with-persona" {
-		// Get all identities with personas
+	identities, err := s.service.ListIdentitiesByPersona(id)
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			http.Error(w, "Persona not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to list identities", http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identities)
+}
+
+// personaDiffHandler compares a persona with another persona (?against=)
+// or with a past version of itself (?version=)
+func (s *Server) personaDiffHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	query := r.URL.Query()
+	against, version := query.Get("against"), query.Get("version")
+	if (against == "") == (version == "") {
+		http.Error(w, "Exactly one of against or version is required", http.StatusBadRequest)
+		return
+	}
+	
+	var diff types.PersonaDiff
+	var err error
+	if against != "" {
+		diff, err = s.service.DiffPersona(id, against)
+	} else {
+		n, convErr := strconv.Atoi(version)
+		if convErr != nil || n < 1 {
+			http.Error(w, "Version must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		diff, err = s.service.DiffPersonaVersion(id, n)
+	}
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			s.handleError(w, err, http.StatusNotFound)
+			return
+		}
+		s.handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+// personaSizeHandler reports how large a persona's prompt and context are
+func (s *Server) personaSizeHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	p, err := s.service.GetPersona(id)
+	if err != nil {
+		http.Error(w, "Persona not found", http.StatusNotFound)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		PersonaID string `json:"persona_id"`
+		persona.PromptSize
+	}{p.Id, persona.MeasurePrompt(p)})
+}
+
+// personaPromptHandler returns the rendered system prompt for a persona
+func (s *Server) personaPromptHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	opts, err := parseRenderOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	p, err := s.service.GetPersona(id)
+	if err != nil {
+		http.Error(w, "Persona not found", http.StatusNotFound)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"persona_id": p.Id,
+		"prompt":     persona.RenderPersonaPrompt(p, opts),
+	})
+}
+
+// personaOpenAIHandler exports a persona as an OpenAI assistant definition
+func (s *Server) personaOpenAIHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	opts, err := parseRenderOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	p, err := s.service.GetPersona(id)
+	if err != nil {
+		http.Error(w, "Persona not found", http.StatusNotFound)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(persona.ExportPersonaOpenAI(p, opts))
+}
+
+// personaChainHandler returns a persona's ancestors ordered from the root
+func (s *Server) personaChainHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	if _, err := s.service.GetPersona(id); err != nil {
+		http.Error(w, "Persona not found", http.StatusNotFound)
+		return
+	}
+	
+	chain, err := s.service.GetPersonaChain(id)
+	if err != nil {
+		var cycleErr *persona.CycleError
+		if errors.As(err, &cycleErr) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":   "inheritance_cycle",
+				"message": cycleErr.Error(),
+				"cycle":   cycleErr.Cycle,
+			})
+			return
+		}
+		s.handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chain)
+}
+
+// personaBackupsHandler lists the backups of a persona, newest first
+func (s *Server) personaBackupsHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	backups, err := s.service.ListPersonaBackups(id)
+	if err != nil {
+		s.handleError(w, err, http.StatusNotFound)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(backups)
+}
+
+// restorePersonaBackupHandler restores a persona from one of its backups
+func (s *Server) restorePersonaBackupHandler(w http.ResponseWriter, r *http.Request, id, backupID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	restored, err := s.service.RestorePersonaBackup(id, backupID)
+	if err != nil {
+		s.handleError(w, err, http.StatusNotFound)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(restored)
+}
+
+// personaVersionsHandler lists the past versions of a persona, oldest first
+func (s *Server) personaVersionsHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	versions, err := s.service.ListPersonaVersions(id)
+	if err != nil {
+		s.handleError(w, err, http.StatusNotFound)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// personaVersionHandler returns a single past version of a persona
+func (s *Server) personaVersionHandler(w http.ResponseWriter, r *http.Request, id, version string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	n, err := strconv.Atoi(version)
+	if err != nil || n < 1 {
+		http.Error(w, "Version must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	
+	v, err := s.service.GetPersonaVersion(id, n)
+	if err != nil {
+		s.handleError(w, err, http.StatusNotFound)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// clonePersonaHandler copies a persona under a new ID
+func (s *Server) clonePersonaHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	if _, err := s.service.GetPersona(id); err != nil {
+		http.Error(w, "Persona not found", http.StatusNotFound)
+		return
+	}
+	
+	clone, err := s.service.ClonePersona(id)
+	if err != nil {
+		s.handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(clone)
+}
+
+// restorePersonaHandler brings back a soft-deleted persona
+func (s *Server) restorePersonaHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	p, err := s.service.RestorePersona(id)
+	if err != nil {
+		if errors.Is(err, storage.ErrPersonaNotDeleted) {
+			s.handleError(w, err, http.StatusConflict)
+			return
+		}
+		s.handleError(w, err, http.StatusNotFound)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// renderPersonaHandler substitutes template variables in a persona's prompt
+// and context values
+func (s *Server) renderPersonaHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	var req struct {
+		Variables map[string]string `json:"variables"`
+	}
+	if err := s.decodeJSON(r, &req); err != nil && err != io.EOF {
+		writeDecodeError(w, err)
+		return
+	}
+	
+	p, err := s.service.GetPersona(id)
+	if err != nil {
+		http.Error(w, "Persona not found", http.StatusNotFound)
+		return
+	}
+	
+	prompt, err := p.RenderPrompt(req.Variables)
+	if err != nil {
+		s.handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	renderedContext, err := p.RenderContext(req.Variables)
+	if err != nil {
+		s.handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"persona_id": p.Id,
+		"prompt":     prompt,
+		"context":    renderedContext,
+	})
+}
+
+// parseRenderOptions reads prompt rendering options from query parameters
+func parseRenderOptions(r *http.Request) (persona.RenderOptions, error) {
+	opts := persona.DefaultRenderOptions()
+	if value := r.URL.Query().Get("include_rag"); value != "" {
+		includeRAG, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("include_rag must be true or false")
+		}
+		opts.IncludeRAG = includeRAG
+	}
+	return opts, nil
+}
+
+func (s *Server) identitiesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		filter, err := parseIdentityFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		
+		// Get identities from storage
+		identities, err := s.service.GetStorage().ListIdentities(filter)
+		if err != nil {
+			http.Error(w, "Failed to list identities", http.StatusInternalServerError)
+			return
+		}
+		
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(identities)
+		
+	case http.MethodPost:
+		var req struct {
+			PersonaID   string                 `json:"persona_id"`
+			Name        string                 `json:"name"`
+			Description string                 `json:"description"`
+			Background  string                 `json:"background"`
+			Tags        []string               `json:"tags"`
+			IsActive    *bool                  `json:"is_active"`
+		}
+		if err := s.decodeJSON(r, &req); err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		
+		// Create identity
+		identity := &types.Identity{
+			PersonaId:   req.PersonaID,
+			Name:        req.Name,
+			Description: req.Description,
+			Background:  req.Background,
+			Tags:        req.Tags,
+			IsActive:    req.IsActive == nil || *req.IsActive,
+		}
+		
+		key, ok := idempotencyKey(w, r, "identities")
+		if !ok {
+			return
+		}
+		replayed, err := s.createIdempotent(key,
+			func(id string) (interface{}, error) { return s.service.GetIdentity(id) },
+			func() (string, error) {
+				err := s.service.CreateIdentity(identity)
+				return identity.Id, err
+			})
+		if err != nil {
+			s.handleError(w, err, http.StatusBadRequest)
+			return
+		}
+		if replayed != nil {
+			writeReplayed(w, replayed)
+			return
+		}
+		
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(identity)
+		
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// identitySubresourceHandler dispatches endpoints nested under /identities/{id}/
+func (s *Server) identitySubresourceHandler(w http.ResponseWriter, r *http.Request, id, resource string) {
+	switch {
+	case resource == "attributes":
+		s.identityAttributesHandler(w, r, id)
+	case resource == "avatar":
+		s.identityAvatarHandler(w, r, id)
+	case resource == "tags":
+		s.identityTagsHandler(w, r, id)
+	case strings.HasPrefix(resource, "tags/"):
+		s.identityTagHandler(w, r, id, strings.TrimPrefix(resource, "tags/"))
+	case resource == "relationships":
+		s.relationshipsHandler(w, r, id)
+	case strings.HasPrefix(resource, "relationships/"):
+		s.relationshipHandler(w, r, id, strings.TrimPrefix(resource, "relationships/"))
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// identityAttributesHandler replaces just the rich attributes of an identity
+func (s *Server) identityAttributesHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	var attrs *types.RichAttributes
+	if err := s.decodeJSON(r, &attrs); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	
+	identity, err := s.service.UpdateIdentityAttributes(id, attrs)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errs.ErrNotFound) {
+			status = http.StatusNotFound // The identity or its persona
+		}
+		s.handleError(w, err, status)
+		return
+	}
+	
+	for _, warning := range s.service.IdentityConsistencyWarnings(identity) {
+		w.Header().Add("Warning", fmt.Sprintf("199 - %q", warning))
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identity)
+}
+
+// identityTagsHandler adds a single tag to an identity, leaving its other
+// tags alone
+func (s *Server) identityTagsHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	var req struct {
+		Tag string `json:"tag"`
+	}
+	if err := s.decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	
+	identity, err := s.service.AddIdentityTag(id, req.Tag)
+	s.writeIdentityTagResult(w, identity, err)
+}
+
+// identityTagHandler removes a single tag from an identity
+func (s *Server) identityTagHandler(w http.ResponseWriter, r *http.Request, id, tag string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	identity, err := s.service.RemoveIdentityTag(id, tag)
+	s.writeIdentityTagResult(w, identity, err)
+}
+
+// writeIdentityTagResult responds with the identity after a tag change, or
+// with the error that prevented it
+func (s *Server) writeIdentityTagResult(w http.ResponseWriter, identity types.Identity, err error) {
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errs.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		s.handleError(w, err, status)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identity)
+}
+
+// relationshipsHandler lists an identity's relationships or creates a new
+// one starting at the identity
+func (s *Server) relationshipsHandler(w http.ResponseWriter, r *http.Request, identityID string) {
+	if _, err := s.service.GetIdentity(identityID); err != nil {
+		http.Error(w, "Identity not found", http.StatusNotFound)
+		return
+	}
+	
+	switch r.Method {
+	case http.MethodGet:
+		relationships, err := s.service.ListRelationships(identityID)
+		if err != nil {
+			s.handleError(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(relationships)
+		
+	case http.MethodPost:
+		var req struct {
+			ToID     string  `json:"to_id"`
+			Type     string  `json:"type"`
+			Strength float64 `json:"strength"`
+		}
+		if err := s.decodeJSON(r, &req); err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		
+		relationship := &types.Relationship{
+			FromId:   identityID,
+			ToId:     req.ToID,
+			Type:     req.Type,
+			Strength: req.Strength,
+		}
+		if err := s.service.CreateRelationship(relationship); err != nil {
+			s.handleError(w, err, http.StatusBadRequest)
+			return
+		}
+		
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(relationship)
+		
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// relationshipHandler deletes one of an identity's relationships
+func (s *Server) relationshipHandler(w http.ResponseWriter, r *http.Request, identityID, relationshipID string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	relationships, err := s.service.ListRelationships(identityID)
+	if err != nil {
+		http.Error(w, "Identity not found", http.StatusNotFound)
+		return
+	}
+	for _, relationship := range relationships {
+		if relationship.Id == relationshipID {
+			if err := s.service.DeleteRelationship(relationshipID); err != nil {
+				s.handleError(w, err, http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	http.Error(w, "Relationship not found", http.StatusNotFound)
+}
+
+// maxIdentityBatchSize bounds the number of identities in one batch request
+const maxIdentityBatchSize = 1000
+
+// identityRequest decodes an identity from a request body, keeping track of
+// whether is_active was sent so it can default to true when absent
+type identityRequest struct {
+	*types.Identity
+	IsActive *bool `json:"is_active"`
+}
+
+// identity returns the decoded identity, or nil for a null entry
+func (req *identityRequest) identity() *types.Identity {
+	if req == nil {
+		return nil
+	}
+	identity := req.Identity
+	if identity == nil {
+		identity = &types.Identity{}
+	}
+	identity.IsActive = req.IsActive == nil || *req.IsActive
+	return identity
+}
+
+// batchCreateIdentitiesHandler creates an array of identities, returning a
+// result per identity so one invalid identity does not drop the rest
+func (s *Server) batchCreateIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	var reqs []*identityRequest
+	if err := s.decodeJSON(r, &reqs); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	identities := make([]*types.Identity, len(reqs))
+	for i, req := range reqs {
+		identities[i] = req.identity()
+	}
+	if len(identities) == 0 {
+		http.Error(w, "At least one identity is required", http.StatusBadRequest)
+		return
+	}
+	if len(identities) > maxIdentityBatchSize {
+		http.Error(w, fmt.Sprintf("Batch cannot exceed %d identities", maxIdentityBatchSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	
+	results := s.service.CreateIdentities(identities)
+	
+	created := 0
+	for _, result := range results {
+		if result.Error == "" {
+			created++
+		}
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+		"created": created,
+		"failed":  len(results) - created,
+	})
+}
+
+// duplicateIdentitiesHandler reports groups of likely duplicate identities.
+// The optional threshold query parameter sets the similarity above which two
+// identities count as duplicates.
+func (s *Server) duplicateIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	threshold := persona.DefaultDuplicateThreshold
+	if value := r.URL.Query().Get("threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			http.Error(w, "threshold must be a number between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		threshold = parsed
+	}
+	
+	groups, err := s.service.FindDuplicateIdentities(threshold)
+	if err != nil {
+		s.handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"threshold": threshold,
+		"groups":    groups,
+	})
+}
+
+// defaultSampleSize is how many identities /identities/sample returns when n
+// is not given
+const defaultSampleSize = 10
+
+// sampleIdentitiesHandler returns a random subset of identities, optionally
+// limited to a persona or to identities with any of the given tags. A seed
+// makes the choice reproducible.
+func (s *Server) sampleIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	query := r.URL.Query()
+	n := defaultSampleSize
+	if value := query.Get("n"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			http.Error(w, "n must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		n = parsed
+	}
+	filter := &types.IdentityFilter{PersonaID: query.Get("persona_id")}
+	if tags := query.Get("tags"); tags != "" {
+		for _, tag := range strings.Split(tags, ",") {
+			filter.Tags = append(filter.Tags, strings.TrimSpace(tag))
+		}
+	}
+	
+	var identities []types.Identity
+	var err error
+	if value := query.Get("seed"); value != "" {
+		seed, parseErr := strconv.ParseInt(value, 10, 64)
+		if parseErr != nil {
+			http.Error(w, "seed must be an integer", http.StatusBadRequest)
+			return
+		}
+		identities, err = s.service.SampleIdentitiesSeeded(filter, n, seed)
+	} else {
+		identities, err = s.service.SampleIdentities(filter, n)
+	}
+	if err != nil {
+		s.handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identities)
+}
+
+// exportIdentitiesHandler streams the identities matching the list filters
+// as JSON Lines
+func (s *Server) exportIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if format := r.URL.Query().Get("format"); format != "" && format != "jsonl" {
+		http.Error(w, fmt.Sprintf("Unsupported export format: %s", format), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseIdentityFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	s.streamExport(w, "application/x-ndjson", "identities.jsonl", func(out io.Writer) error {
+		return s.service.WriteIdentitiesJSONL(out, filter)
+	})
+}
+
+// streamExport sends an export body produced by write as an attachment
+func (s *Server) streamExport(w http.ResponseWriter, contentType, filename string, write func(io.Writer) error) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	out := &startedWriter{Writer: w}
+	err := write(out)
+	if err == nil {
+		return
+	}
+	if !out.started {
+		w.Header().Del("Content-Disposition")
+		s.handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	// Errors past this point mean the client went away or storage failed
+	// mid-stream; the headers are already sent, so cut the response short
+	// rather than let a truncated export look complete
+	panic(http.ErrAbortHandler)
+}
+
+// startedWriter records whether any of the body has been written
+type startedWriter struct {
+	io.Writer
+	started bool
+}
+
+func (w *startedWriter) Write(p []byte) (int, error) {
+	w.started = true
+	return w.Writer.Write(p)
+}
+
+func (s *Server) identityHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract identity ID from URL path
+	path := r.URL.Path[len("/identities/"):]
+	if path == "" {
+		http.Error(w, "Identity ID required", http.StatusBadRequest)
+		return
+	}
+	
+	// Handle special endpoints
+	if path == "with-persona" {
+		// Get all identities with personas
 		identities, err := s.service.GetStorage().ListIdentities(nil)
 		if err != nil {
 			http.Error(w, "Failed to list identities", http.StatusInternalServerError)
@@ -325,6 +1556,12 @@ func (s *Server) identityHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// Handle identity sub-resources such as /identities/{id}/relationships
+	if idx := strings.Index(path, "/"); idx != -1 {
+		s.identitySubresourceHandler(w, r, path[:idx], path[idx+1:])
+		return
+	}
+	
 	switch r.Method {
 	case http.MethodGet:
 		identity, err := s.service.GetIdentity(path)
@@ -337,16 +1574,58 @@ func (s *Server) identityHandler(w http.ResponseWriter, r *http.Request) {
 		
 	case http.MethodPut:
 		var identity types.Identity
-		if err := json.NewDecoder(r.Body).Decode(&identity); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if err := s.decodeJSON(r, &identity); err != nil {
+			writeDecodeError(w, err)
 			return
 		}
 		
 		if err := s.service.UpdateIdentity(path, identity); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			s.handleError(w, err, http.StatusBadRequest)
+			return
+		}
+		
+		// Respond with the identity as stored, not as sent
+		stored, err := s.service.GetIdentity(path)
+		if err != nil {
+			http.Error(w, "Identity not found", http.StatusNotFound)
+			return
+		}
+		
+		// Persona conflicts are advisory and reported as HTTP warnings
+		for _, warning := range s.service.IdentityConsistencyWarnings(stored) {
+			w.Header().Add("Warning", fmt.Sprintf("199 - %q", warning))
+		}
+		
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stored)
+		
+	case http.MethodPatch:
+		var patch map[string]interface{}
+		if err := s.decodeJSON(r, &patch); err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		
+		if _, err := s.service.GetIdentity(path); err != nil {
+			http.Error(w, "Identity not found", http.StatusNotFound)
+			return
+		}
+		
+		if err := s.service.PatchIdentity(path, patch); err != nil {
+			s.handleError(w, err, http.StatusBadRequest)
 			return
 		}
 		
+		identity, err := s.service.GetIdentity(path)
+		if err != nil {
+			http.Error(w, "Identity not found", http.StatusNotFound)
+			return
+		}
+		
+		for _, warning := range s.service.IdentityConsistencyWarnings(identity) {
+			w.Header().Add("Warning", fmt.Sprintf("199 - %q", warning))
+		}
+		
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(identity)
 		
@@ -366,12 +1645,20 @@ func (s *Server) communitiesHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		// Parse query parameters for filtering
-		filter := &types.CommunityFilter{}
-		if communityType := r.URL.Query().Get("type"); communityType != "" {
-			filter.Type = communityType
+		filter, err := parseCommunityFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sortBy := r.URL.Query().Get("sort")
+		descending, err := parseSortOrder(r.URL.Query().Get("order"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		if search := r.URL.Query().Get("search"); search != "" {
-			filter.Search = search
+		if _, ok := communitySortKeys[sortBy]; sortBy != "" && !ok {
+			http.Error(w, "sort must be size, diversity or cohesion", http.StatusBadRequest)
+			return
 		}
 		
 		// Get communities from storage
@@ -380,6 +1667,9 @@ func (s *Server) communitiesHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Failed to list communities", http.StatusInternalServerError)
 			return
 		}
+		if sortBy != "" {
+			sortCommunities(communities, sortBy, descending)
+		}
 		
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(communities)
@@ -389,6 +1679,131 @@ func (s *Server) communitiesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// parseIdentityFilter reads the identity list filters from query parameters
+func parseIdentityFilter(r *http.Request) (*types.IdentityFilter, error) {
+	query := r.URL.Query()
+	filter := &types.IdentityFilter{
+		PersonaID: query.Get("persona_id"),
+		Search:    query.Get("search"),
+	}
+	if deep := query.Get("deep"); deep != "" {
+		deepSearch, err := strconv.ParseBool(deep)
+		if err != nil {
+			return nil, fmt.Errorf("deep must be true or false")
+		}
+		filter.DeepSearch = deepSearch
+	}
+	if isActiveStr := query.Get("is_active"); isActiveStr != "" {
+		if isActive := isActiveStr == "true"; isActiveStr == "true" || isActiveStr == "false" {
+			filter.IsActive = &isActive
+		}
+	}
+	if err := parseDemographicFilter(r, filter); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// parseDemographicFilter reads the min_age, max_age and city identity
+// filters from query parameters into filter
+func parseDemographicFilter(r *http.Request, filter *types.IdentityFilter) error {
+	query := r.URL.Query()
+	filter.City = query.Get("city")
+	for name, target := range map[string]**int{"min_age": &filter.MinAge, "max_age": &filter.MaxAge} {
+		if value := query.Get(name); value != "" {
+			age, err := strconv.Atoi(value)
+			if err != nil || age < 0 {
+				return fmt.Errorf("%s must be a non-negative integer", name)
+			}
+			*target = &age
+		}
+	}
+	if filter.MinAge != nil && filter.MaxAge != nil && *filter.MinAge > *filter.MaxAge {
+		return fmt.Errorf("min_age must not be greater than max_age")
+	}
+	return nil
+}
+
+// parseCommunityFilter reads community list filters from query parameters
+func parseCommunityFilter(r *http.Request) (*types.CommunityFilter, error) {
+	query := r.URL.Query()
+	filter := &types.CommunityFilter{
+		Type:              query.Get("type"),
+		Search:            query.Get("search"),
+		DominantPolitical: query.Get("dominant_political"),
+	}
+	
+	if value := query.Get("is_active"); value != "" {
+		isActive, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("is_active must be true or false")
+		}
+		filter.IsActive = &isActive
+	}
+	for name, target := range map[string]**int{"min_size": &filter.MinSize, "max_size": &filter.MaxSize} {
+		if value := query.Get(name); value != "" {
+			size, err := strconv.Atoi(value)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("%s must be a non-negative integer", name)
+			}
+			*target = &size
+		}
+	}
+	for name, target := range map[string]**float64{"min_diversity": &filter.MinDiversity, "max_diversity": &filter.MaxDiversity} {
+		if value := query.Get(name); value != "" {
+			diversity, err := strconv.ParseFloat(value, 64)
+			if err != nil || diversity < 0 || diversity > 1 {
+				return nil, fmt.Errorf("%s must be a number between 0 and 1", name)
+			}
+			*target = &diversity
+		}
+	}
+	for name, target := range map[string]**float64{"min_avg_age": &filter.MinAvgAge, "max_avg_age": &filter.MaxAvgAge} {
+		if value := query.Get(name); value != "" {
+			age, err := strconv.ParseFloat(value, 64)
+			if err != nil || age < 0 {
+				return nil, fmt.Errorf("%s must be a non-negative number", name)
+			}
+			*target = &age
+		}
+	}
+	
+	return filter, nil
+}
+
+// communitySortKeys maps the sort query parameter to the community field it
+// orders by
+var communitySortKeys = map[string]func(types.Community) float64{
+	"size":      func(c types.Community) float64 { return float64(c.Size) },
+	"diversity": func(c types.Community) float64 { return c.Diversity },
+	"cohesion":  func(c types.Community) float64 { return c.Cohesion },
+}
+
+// parseSortOrder reports whether order requests descending results. An empty
+// order means ascending.
+func parseSortOrder(order string) (bool, error) {
+	switch order {
+	case "", "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	default:
+		return false, fmt.Errorf("order must be asc or desc")
+	}
+}
+
+// sortCommunities orders communities by one of communitySortKeys, keeping the
+// storage order between equal values
+func sortCommunities(communities []types.Community, sortBy string, descending bool) {
+	key := communitySortKeys[sortBy]
+	sort.SliceStable(communities, func(i, j int) bool {
+		if descending {
+			return key(communities[i]) > key(communities[j])
+		}
+		return key(communities[i]) < key(communities[j])
+	})
+}
+
 func (s *Server) communityHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract community ID from URL path
 	path := r.URL.Path[len("/communities/"):]
@@ -403,13 +1818,48 @@ func (s *Server) communityHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	if strings.HasSuffix(path, "/export") {
+		s.exportCommunityHandler(w, r, strings.TrimSuffix(path, "/export"))
+		return
+	}
+	
+	if strings.HasSuffix(path, "/bundle") {
+		s.communityBundleHandler(w, r, strings.TrimSuffix(path, "/bundle"))
+		return
+	}
+	
+	if strings.HasSuffix(path, "/merge") {
+		s.mergeCommunityHandler(w, r, strings.TrimSuffix(path, "/merge"))
+		return
+	}
+	
+	if strings.HasSuffix(path, "/evolve") {
+		s.evolveCommunityHandler(w, r, strings.TrimSuffix(path, "/evolve"))
+		return
+	}
+	
+	if strings.HasSuffix(path, "/recalculate") {
+		s.recalculateCommunityHandler(w, r, strings.TrimSuffix(path, "/recalculate"))
+		return
+	}
+	
 	// Handle stats endpoint with proper path parsing
 	if len(path) > 6 && path[len(path)-6:] == "/stats" {
 		communityId := path[:len(path)-6]
 		
+		var opts community.StatsOptions
+		if value := r.URL.Query().Get("recompute"); value != "" {
+			recompute, err := strconv.ParseBool(value)
+			if err != nil {
+				http.Error(w, "recompute must be true or false", http.StatusBadRequest)
+				return
+			}
+			opts.ForceRecompute = recompute
+		}
+		
 		// Create community service instance
 		communityService := s.getCommunityService()
-		stats, err := communityService.GetCommunityStats(communityId)
+		stats, err := communityService.GetCommunityStatsWithOptions(communityId, opts)
 		if err != nil {
 			http.Error(w, "Failed to get community stats", http.StatusNotFound)
 			return
@@ -432,13 +1882,13 @@ func (s *Server) communityHandler(w http.ResponseWriter, r *http.Request) {
 		
 	case http.MethodPut:
 		var community types.Community
-		if err := json.NewDecoder(r.Body).Decode(&community); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if err := s.decodeJSON(r, &community); err != nil {
+			writeDecodeError(w, err)
 			return
 		}
 		
-		if err := s.service.GetStorage().UpdateCommunity(path, community); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if err := s.service.UpdateCommunity(path, community); err != nil {
+			s.handleError(w, err, http.StatusBadRequest)
 			return
 		}
 		
@@ -457,6 +1907,207 @@ func (s *Server) communityHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// exportCommunityHandler streams a community's members as CSV
+func (s *Server) exportCommunityHandler(w http.ResponseWriter, r *http.Request, communityId string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if format := r.URL.Query().Get("format"); format != "" && format != "csv" {
+		http.Error(w, fmt.Sprintf("Unsupported export format: %s", format), http.StatusBadRequest)
+		return
+	}
+	
+	communityService := s.getCommunityService()
+	if _, err := communityService.GetCommunity(communityId); err != nil {
+		http.Error(w, "Community not found", http.StatusNotFound)
+		return
+	}
+	
+	s.streamExport(w, "text/csv", fmt.Sprintf("community-%s.csv", communityId), func(out io.Writer) error {
+		return communityService.WriteCommunityMembersCSV(out, communityId)
+	})
+}
+
+// communityBundleHandler returns a community with its members and their
+// personas as a JSON bundle
+func (s *Server) communityBundleHandler(w http.ResponseWriter, r *http.Request, communityId string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	if _, err := s.service.GetStorage().GetCommunity(communityId); err != nil {
+		http.Error(w, "Community not found", http.StatusNotFound)
+		return
+	}
+	
+	data, err := s.getCommunityService().ExportCommunityBundle(communityId)
+	if err != nil {
+		s.handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="community-%s.json"`, communityId))
+	w.Write(data)
+}
+
+// importCommunityBundleHandler recreates a community from a bundle produced
+// by GET /communities/{id}/bundle
+func (s *Server) importCommunityBundleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	
+	imported, err := s.getCommunityService().ImportCommunityBundle(body)
+	if err != nil {
+		s.handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(imported)
+}
+
+// mergeCommunityHandler merges the community named in the body into the
+// community in the path
+func (s *Server) mergeCommunityHandler(w http.ResponseWriter, r *http.Request, communityId string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	var req struct {
+		SourceID     string `json:"source_id"`
+		DeleteSource bool   `json:"delete_source"`
+	}
+	if err := s.decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if req.SourceID == "" {
+		http.Error(w, "source_id is required", http.StatusBadRequest)
+		return
+	}
+	
+	storage := s.service.GetStorage()
+	for _, id := range []string{communityId, req.SourceID} {
+		if _, err := storage.GetCommunity(id); err != nil {
+			http.Error(w, fmt.Sprintf("Community not found: %s", id), http.StatusNotFound)
+			return
+		}
+	}
+	
+	merged, err := s.getCommunityService().MergeCommunities(communityId, req.SourceID, req.DeleteSource)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, community.ErrCommunityFull) {
+			status = http.StatusConflict
+		}
+		s.handleError(w, err, status)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(merged)
+}
+
+// evolveCommunityHandler advances a community's members by a number of years
+func (s *Server) evolveCommunityHandler(w http.ResponseWriter, r *http.Request, communityId string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	var req struct {
+		Years int `json:"years"`
+	}
+	if err := s.decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	
+	if _, err := s.service.GetStorage().GetCommunity(communityId); err != nil {
+		http.Error(w, "Community not found", http.StatusNotFound)
+		return
+	}
+	
+	evolved, err := s.getCommunityService().EvolveCommunity(communityId, req.Years)
+	if err != nil {
+		s.handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(evolved)
+}
+
+// recalculateCommunityHandler recomputes a community's stored metrics from
+// its current members
+func (s *Server) recalculateCommunityHandler(w http.ResponseWriter, r *http.Request, communityId string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	communityService := s.getCommunityService()
+	if err := communityService.RecalculateCommunityMetrics(communityId); err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			http.Error(w, "Community not found", http.StatusNotFound)
+			return
+		}
+		s.handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	
+	recalculated, err := communityService.GetCommunity(communityId)
+	if err != nil {
+		http.Error(w, "Community not found", http.StatusNotFound)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recalculated)
+}
+
+// rebuildIndexesHandler recomputes storage secondary indexes and reports
+// how many entries were fixed
+func (s *Server) rebuildIndexesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	report, err := s.service.RebuildIndexes()
+	if err != nil {
+		s.handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// identitySchemaHandler serves the JSON Schema for identity payloads
+func (s *Server) identitySchemaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/schema+json")
+	json.NewEncoder(w).Encode(middleware.IdentitySchema())
+}
+
 func (s *Server) generateCommunityHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -468,25 +2119,69 @@ func (s *Server) generateCommunityHandler(w http.ResponseWriter, r *http.Request
 		Description      string                              `json:"description"`
 		Type             string                              `json:"type"`
 		TargetSize       int                                 `json:"target_size"`
-		GenerationConfig types.CommunityGenerationConfig    `json:"generation_config"`
+		GenerationConfig *types.CommunityGenerationConfig   `json:"generation_config"`
+		Template         string                              `json:"template"` // saved config to use instead
+		CallbackURL      string                              `json:"callback_url"`
 	}
 	
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if err := s.decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
 		return
 	}
 	
-	// Create community service instance
+	// Resolve the generation config, inline or from a saved template
 	communityService := s.getCommunityService()
+	var config types.CommunityGenerationConfig
+	switch {
+	case req.Template != "" && req.GenerationConfig != nil:
+		http.Error(w, "Use either template or generation_config, not both", http.StatusBadRequest)
+		return
+	case req.Template != "":
+		template, err := communityService.GetTemplate(req.Template)
+		if err != nil {
+			writeTemplateError(w, err)
+			return
+		}
+		config = template.Config
+	case req.GenerationConfig != nil:
+		config = *req.GenerationConfig
+	}
+	generate := func() (*types.Community, error) {
+		return communityService.GenerateCommunity(
+			config,
+			req.Name,
+			req.Description,
+			req.Type,
+			req.TargetSize,
+		)
+	}
+	
+	// With a callback URL, generate in the background and POST the result
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(req.CallbackURL, s.config.Community.CallbackHosts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		job, err := s.enqueueJob(req.CallbackURL, generate)
+		if err != nil {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/jobs/"+job.Id)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+		return
+	}
 	
 	// Generate community
-	community, err := communityService.GenerateCommunity(
-		req.GenerationConfig,
-		req.Name,
-		req.Description,
-		req.Type,
-		req.TargetSize,
-	)
+	community, err := generate()
+	if errors.Is(err, context.DeadlineExceeded) {
+		s.handleError(w, fmt.Errorf("community generation timed out: %v", err), http.StatusGatewayTimeout)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to generate community: %v", err), http.StatusBadRequest)
 		return
@@ -507,6 +2202,7 @@ func StartServer(port string) error {
 		},
 		Security: config.SecurityConfig{
 			EnableAuth: false,
+			CORS:       config.DefaultConfig().Security.CORS,
 		},
 		Storage: config.StorageConfig{
 			Type: "memory",
@@ -2,7 +2,9 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -360,3 +362,15 @@ func TestPersonaHandler_DELETE_NotFound(t *testing.T) {
 		t.Errorf("Expected status 404, got %d", w.Code)
 	}
 }
+
+func TestServerShutdownBeforeStart(t *testing.T) {
+	server := createTestServer()
+	server.config.HTTP.Port = "0"
+	
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown before Start failed: %v", err)
+	}
+	if err := server.Start(); !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("Expected Start after Shutdown to return ErrServerClosed, got %v", err)
+	}
+}
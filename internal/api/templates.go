@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/community"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// communityTemplatesHandler serves GET and POST /community-templates
+func (s *Server) communityTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		templates, err := s.getCommunityService().ListTemplates()
+		if err != nil {
+			writeTemplateError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(templates)
+
+	case http.MethodPost:
+		var req struct {
+			Name   string                          `json:"name"`
+			Config types.CommunityGenerationConfig `json:"config"`
+		}
+		if err := s.decodeJSON(r, &req); err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		s.saveTemplate(w, req.Name, req.Config, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// communityTemplateHandler serves GET and PUT /community-templates/{name}
+func (s *Server) communityTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/community-templates/")
+	if name == "" {
+		http.Error(w, "Template name required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		template, err := s.getCommunityService().GetTemplate(name)
+		if err != nil {
+			writeTemplateError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(template)
+
+	case http.MethodPut:
+		var config types.CommunityGenerationConfig
+		if err := s.decodeJSON(r, &config); err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		s.saveTemplate(w, name, config, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// saveTemplate stores a template and writes it with the given status
+func (s *Server) saveTemplate(w http.ResponseWriter, name string, config types.CommunityGenerationConfig, status int) {
+	template, err := s.getCommunityService().SaveTemplate(name, config)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(template)
+}
+
+// writeTemplateError reports a template operation failure with a status
+// matching its cause
+func writeTemplateError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, community.ErrTemplatesUnsupported):
+		status = http.StatusNotImplemented
+	case errors.Is(err, errs.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errs.ErrValidation):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// serveJSON sends body as JSON to handler
+func serveJSON(handler http.HandlerFunc, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(method, path, bytes.NewReader(data)))
+	return rr
+}
+
+func TestGenerateCommunityFromTemplate(t *testing.T) {
+	server := createTestServer()
+	favored := &types.Persona{Name: "Engineer", Topic: "Engineering", Prompt: "You build things"}
+	ignored := &types.Persona{Name: "Artist", Topic: "Art", Prompt: "You paint"}
+	for _, p := range []*types.Persona{favored, ignored} {
+		if err := server.service.CreatePersona(p); err != nil {
+			t.Fatalf("failed to create persona: %v", err)
+		}
+	}
+
+	rr := serveJSON(server.communityTemplatesHandler, "POST", "/community-templates", map[string]interface{}{
+		"name": "engineers",
+		"config": map[string]interface{}{
+			// A zero weight means the default, so make the other one negligible
+			"persona_weights":  map[string]float64{favored.Id: 1e6, ignored.Id: 1e-6},
+			"age_distribution": map[string]interface{}{"mean": 40.0, "std_dev": 5.0, "min_age": 30, "max_age": 50},
+		},
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveJSON(server.communityTemplateHandler, "GET", "/community-templates/engineers", nil)
+	var template types.CommunityTemplate
+	if err := json.Unmarshal(rr.Body.Bytes(), &template); err != nil || template.Config.PersonaWeights[favored.Id] != 1e6 {
+		t.Fatalf("expected the saved template, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveJSON(server.generateCommunityHandler, "POST", "/communities/generate", map[string]interface{}{
+		"name":        "Engineering Guild",
+		"type":        "professional",
+		"target_size": 6,
+		"template":    "engineers",
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var community types.Community
+	if err := json.Unmarshal(rr.Body.Bytes(), &community); err != nil {
+		t.Fatalf("failed to parse community: %v", err)
+	}
+	if community.GenerationConfig.PersonaWeights[favored.Id] != 1e6 || len(community.MemberIds) != 6 {
+		t.Fatalf("expected the template config to be applied, got %+v", community)
+	}
+	for _, id := range community.MemberIds {
+		member, err := server.service.GetIdentity(id)
+		if err != nil {
+			t.Fatalf("failed to get member: %v", err)
+		}
+		if member.PersonaId != favored.Id {
+			t.Errorf("expected every member to use the weighted persona, got %s", member.PersonaId)
+		}
+		if age := member.RichAttributes.GetDemographics().GetAge(); age < 30 || age > 50 {
+			t.Errorf("expected the template's age range, got %d", age)
+		}
+	}
+}
+
+func TestCommunityTemplateErrors(t *testing.T) {
+	server := createTestServer()
+
+	if rr := serveJSON(server.communityTemplateHandler, "GET", "/community-templates/missing", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing template, got %d", rr.Code)
+	}
+	if rr := serveJSON(server.communityTemplatesHandler, "POST", "/community-templates", map[string]interface{}{"name": "../bad"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid name, got %d", rr.Code)
+	}
+	if rr := serveJSON(server.generateCommunityHandler, "POST", "/communities/generate", map[string]interface{}{
+		"name": "Ghosts", "type": "interest", "target_size": 2, "template": "missing",
+	}); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 generating from a missing template, got %d", rr.Code)
+	}
+
+	serveJSON(server.communityTemplateHandler, "PUT", "/community-templates/both", map[string]interface{}{"political_spread": 0.5})
+	if rr := serveJSON(server.generateCommunityHandler, "POST", "/communities/generate", map[string]interface{}{
+		"name": "Both", "type": "interest", "target_size": 2, "template": "both", "generation_config": map[string]interface{}{},
+	}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 with both template and generation_config, got %d", rr.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -9,8 +10,14 @@ import (
 	"strings"
 	"time"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/client"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/community"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/generator"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/ids"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/persona"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
@@ -22,6 +29,7 @@ type Config struct {
 	StorageType string // "memory", "file"
 	DataDir     string
 	ServerURL   string
+	Output      string      // "table" (default), "json" or "yaml"
 	Service     interface{} // persona.Service interface
 }
 
@@ -40,6 +48,20 @@ func Execute() error {
 
 // ExecuteWithConfig runs the CLI interface with the given configuration
 func ExecuteWithConfig(config Config) error {
+	args, err := parseGlobalFlags(&config, os.Args[1:])
+	if err == flag.ErrHelp {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	format, err := parseOutputFormat(config.Output)
+	if err != nil {
+		return err
+	}
+	// Subcommands read their arguments from os.Args
+	os.Args = append([]string{os.Args[0]}, args...)
+
 	if len(os.Args) < 2 {
 		printUsage()
 		return nil
@@ -63,49 +85,101 @@ func ExecuteWithConfig(config Config) error {
 		return handleGenerateRandomCommunity(config)
 	}
 
+	// Handle persona bundle commands (require direct service access)
+	if command == "export" {
+		return handleExportPersonas(config)
+	}
+	if command == "import" {
+		return handleImportPersonas(config)
+	}
+
+	// Handle whole-storage backup commands (require direct service access)
+	if command == "backup" {
+		return handleBackup(config)
+	}
+	if command == "restore" {
+		return handleRestore(config)
+	}
+
 	// Create client based on configuration
 	client, err := createClient(config)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %v", err)
 	}
 
+	switch command {
+	case "serve":
+		return serveCommand()
+	case "repl":
+		return runREPL(client, config, os.Stdin)
+	}
+
+	err = runClientCommand(client, format, command)
+	if errors.Is(err, errUnknownCommand) {
+		printUsage()
+	}
+	return err
+}
+
+// errUnknownCommand is returned by runClientCommand for commands it does not
+// handle
+var errUnknownCommand = errors.New("unknown command")
+
+// runClientCommand runs one of the subcommands that only need a client,
+// reading its arguments from os.Args. These are the commands the REPL
+// supports.
+func runClientCommand(c client.Client, format outputFormat, command string) error {
 	switch command {
 	case "list":
-		return listPersonas(client)
+		return listPersonas(c, format)
 	case "create":
-		return createPersona(client)
+		return createPersona(c)
 	case "get":
-		return getPersona(client)
+		return getPersona(c, format)
 	case "delete":
-		return deletePersona(client)
+		return deletePersona(c)
 	case "update":
-		return updatePersona(client)
-	case "serve":
-		return serveCommand()
+		return updatePersona(c)
+	case "import-openai":
+		return importOpenAIPersonas(c)
+	case "clone":
+		return clonePersona(c)
 	// Identity commands
 	case "identity-list":
-		return listIdentities(client)
+		return listIdentities(c, format)
 	case "identity-create":
-		return createIdentity(client)
+		return createIdentity(c)
 	case "identity-get":
-		return getIdentity(client)
+		return getIdentity(c, format)
 	case "identity-delete":
-		return deleteIdentity(client)
+		return deleteIdentity(c)
 	case "identity-update":
-		return updateIdentity(client)
+		return updateIdentity(c)
 	case "identity-get-with-persona":
-		return getIdentityWithPersona(client)
+		return getIdentityWithPersona(c, format)
 	// Generation commands
 	case "generate-identity":
-		return generateIdentity(client)
+		return generateIdentity(c)
 	case "generate-community":
-		return generateCommunity(client)
+		return generateCommunity(c)
 	default:
-		printUsage()
-		return fmt.Errorf("unknown command: %s", command)
+		return fmt.Errorf("%w: %s", errUnknownCommand, command)
 	}
 }
 
+// parseGlobalFlags parses the flags given before the subcommand into config
+// and returns the remaining arguments
+func parseGlobalFlags(config *Config, args []string) ([]string, error) {
+	fs := flag.NewFlagSet("fr0g-ai-aip", flag.ContinueOnError)
+	fs.Usage = printUsage
+	fs.StringVar(&config.Output, "output", config.Output, "Output format: table, json or yaml")
+	fs.StringVar(&config.Output, "o", config.Output, "Output format (shorthand)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return fs.Args(), nil
+}
+
 func handleGenerateIdentities(config Config) error {
 	if config.Service == nil {
 		return fmt.Errorf("service not available for identity generation")
@@ -153,6 +227,139 @@ func handleGenerateIdentities(config Config) error {
 	return nil
 }
 
+func handleExportPersonas(config Config) error {
+	service, ok := config.Service.(*persona.Service)
+	if !ok || service == nil {
+		return fmt.Errorf("service not available for persona export")
+	}
+
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: fr0g-ai-aip export -o <file.json>")
+	}
+	output := fs.String("o", "", "Bundle file to write")
+
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		return err
+	}
+
+	if *output == "" {
+		fs.Usage()
+		return fmt.Errorf("output file required")
+	}
+
+	data, err := service.ExportPersonas()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+
+	fmt.Printf("Exported personas to %s\n", *output)
+	return nil
+}
+
+func handleImportPersonas(config Config) error {
+	service, ok := config.Service.(*persona.Service)
+	if !ok || service == nil {
+		return fmt.Errorf("service not available for persona import")
+	}
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: fr0g-ai-aip import -i <file.json> [-overwrite]")
+	}
+	input := fs.String("i", "", "Bundle file written by export")
+	overwrite := fs.Bool("overwrite", false, "Replace personas whose IDs already exist")
+
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		return err
+	}
+
+	if *input == "" {
+		fs.Usage()
+		return fmt.Errorf("input file required")
+	}
+
+	data, err := os.ReadFile(*input)
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %v", err)
+	}
+
+	imported, err := service.ImportPersonas(data, *overwrite)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d persona(s)\n", imported)
+	return nil
+}
+
+func handleBackup(config Config) error {
+	service, ok := config.Service.(*persona.Service)
+	if !ok || service == nil {
+		return fmt.Errorf("service not available for backup")
+	}
+
+	if len(os.Args) < 3 {
+		fmt.Println("Usage: fr0g-ai-aip backup <file.tar.gz>")
+		return fmt.Errorf("backup file required")
+	}
+	output := os.Args[2]
+
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %v", err)
+	}
+	if err := service.BackupTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write backup file: %v", err)
+	}
+
+	fmt.Printf("Backed up storage to %s\n", output)
+	return nil
+}
+
+func handleRestore(config Config) error {
+	service, ok := config.Service.(*persona.Service)
+	if !ok || service == nil {
+		return fmt.Errorf("service not available for restore")
+	}
+
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: fr0g-ai-aip restore [-overwrite] <file.tar.gz>")
+	}
+	overwrite := fs.Bool("overwrite", false, "Replace entries whose IDs already exist")
+
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("backup file required")
+	}
+	input := fs.Arg(0)
+
+	file, err := os.Open(input)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %v", err)
+	}
+	defer file.Close()
+
+	if err := service.RestoreFrom(file, *overwrite); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored storage from %s\n", input)
+	return nil
+}
+
 func handleGenerateRandomCommunity(config Config) error {
 	if config.Service == nil {
 		return fmt.Errorf("service not available for community generation")
@@ -573,9 +780,12 @@ func printUsage() {
 	fmt.Println("  demographic simulation capabilities for diverse AI persona ecosystems.")
 	fmt.Println()
 	fmt.Println("USAGE:")
-	fmt.Println("  fr0g-ai-aip [command] [options]")
+	fmt.Println("  fr0g-ai-aip [-o table|json|yaml] [command] [options]")
 	fmt.Println("  fr0g-ai-aip [flags]")
 	fmt.Println()
+	fmt.Println("GLOBAL FLAGS:")
+	fmt.Println("  -o, --output <format> Output of list and get commands: table (default), json, yaml")
+	fmt.Println()
 	fmt.Println("PERSONA COMMANDS:")
 	fmt.Println("  list                List all personas")
 	fmt.Println("  create              Create a new persona")
@@ -588,6 +798,14 @@ func printUsage() {
 	fmt.Println("    -topic <topic>      Update persona topic")
 	fmt.Println("    -prompt <prompt>    Update system prompt")
 	fmt.Println("  delete <id>         Delete persona by ID")
+	fmt.Println("  clone <id>          Copy a persona under a new ID")
+	fmt.Println("  export              Export all personas as a JSON bundle")
+	fmt.Println("    -o <file>           Bundle file to write (required)")
+	fmt.Println("  import              Import personas from a JSON bundle")
+	fmt.Println("    -i <file>           Bundle file written by export (required)")
+	fmt.Println("    -overwrite          Replace personas whose IDs already exist")
+	fmt.Println("  import-openai       Import personas from OpenAI assistant JSON")
+	fmt.Println("    -i <file>           JSON file with one assistant or an array (required)")
 	fmt.Println()
 	fmt.Println("IDENTITY COMMANDS:")
 	fmt.Println("  identity-list       List all identities")
@@ -623,6 +841,7 @@ func printUsage() {
 	fmt.Println("    -size <number>        Number of identities to generate (required)")
 	fmt.Println("    -location <city,country> Location for the community (optional)")
 	fmt.Println("    -age-range <min>-<max>   Age range for the community (optional)")
+	fmt.Println("    -seed <number>           Random seed to reproduce the same population (optional)")
 	fmt.Println("")
 	fmt.Println("GENERATION COMMANDS:")
 	fmt.Println("  generate-identities   Generate a diverse set of sample identities")
@@ -632,9 +851,21 @@ func printUsage() {
 	fmt.Println("  generate-identity     Generate a single random identity based on a persona")
 	fmt.Println("    -persona-id <id>      Persona ID (required)")
 	fmt.Println("    -name <name>          Identity name (optional, auto-generated if not provided)")
+	fmt.Println("    -seed <number>        Random seed to reproduce the same identity (optional)")
+	fmt.Println()
+	fmt.Println("BACKUP COMMANDS:")
+	fmt.Println("  backup <file>       Write all personas, identities, communities and")
+	fmt.Println("                      relationships to a tar.gz archive")
+	fmt.Println("  restore <file>      Load a tar.gz archive written by backup")
+	fmt.Println("    -overwrite          Replace entries whose IDs already exist")
+	fmt.Println()
+	fmt.Println("INTERACTIVE MODE:")
+	fmt.Println("  repl                Run persona, identity and generation commands from a")
+	fmt.Println("                      prompt over a single client connection")
 	fmt.Println()
 	fmt.Println("SERVER COMMANDS:")
 	fmt.Println("  serve               Start gRPC server")
+	fmt.Println("  validate-config     Report every problem with the configuration")
 	fmt.Println("  help                Show this help message")
 	fmt.Println()
 	fmt.Println("SERVER FLAGS:")
@@ -642,6 +873,7 @@ func printUsage() {
 	fmt.Println("  -grpc               Run gRPC server")
 	fmt.Println("  -port <port>        HTTP server port (default: 8080)")
 	fmt.Println("  -grpc-port <port>   gRPC server port (default: 9090)")
+	fmt.Println("  -config <file>      YAML or JSON config file (env vars override it)")
 	fmt.Println("  -storage <type>     Storage type: memory, file (default: file)")
 	fmt.Println("  -data-dir <dir>     Data directory for file storage (default: ./data)")
 	fmt.Println("  -help               Show help")
@@ -675,6 +907,9 @@ func printUsage() {
 	fmt.Println("  # List all personas")
 	fmt.Println("  fr0g-ai-aip list")
 	fmt.Println()
+	fmt.Println("  # List persona names as JSON for scripting")
+	fmt.Println("  fr0g-ai-aip -o json list | jq -r '.[].name'")
+	fmt.Println()
 	fmt.Println("  # Create an identity based on a persona")
 	fmt.Println("  fr0g-ai-aip identity-create -persona-id <persona_id> -name \"John Doe\" \\")
 	fmt.Println("    -description \"Senior Go developer with 10 years experience\" \\")
@@ -714,6 +949,9 @@ func printUsage() {
 	fmt.Println("  # Connect to gRPC server")
 	fmt.Println("  FR0G_CLIENT_TYPE=grpc FR0G_SERVER_URL=localhost:9090 fr0g-ai-aip list")
 	fmt.Println()
+	fmt.Println("  # Explore a gRPC server interactively")
+	fmt.Println("  FR0G_CLIENT_TYPE=grpc fr0g-ai-aip repl")
+	fmt.Println()
 	fmt.Println("  # Start gRPC server")
 	fmt.Println("  fr0g-ai-aip -grpc")
 	fmt.Println()
@@ -721,22 +959,26 @@ func printUsage() {
 	fmt.Println("  fr0g-ai-aip -server -storage file -data-dir ./personas")
 }
 
-func listPersonas(c client.Client) error {
+func listPersonas(c client.Client, format outputFormat) error {
 	personas, err := c.List()
 	if err != nil {
 		return err
 	}
-
-	if len(personas) == 0 {
-		fmt.Println("No personas found")
-		return nil
+	if personas == nil {
+		personas = []types.Persona{} // Render [] rather than null
 	}
 
-	fmt.Println("Personas:")
-	for _, p := range personas {
-		fmt.Printf("  ID: %s, Name: %s, Topic: %s\n", p.Id, p.Name, p.Topic)
-	}
-	return nil
+	return render(format, personas, func() {
+		if len(personas) == 0 {
+			fmt.Println("No personas found")
+			return
+		}
+
+		fmt.Println("Personas:")
+		for _, p := range personas {
+			fmt.Printf("  ID: %s, Name: %s, Topic: %s\n", p.Id, p.Name, p.Topic)
+		}
+	})
 }
 
 func createPersona(c client.Client) error {
@@ -771,7 +1013,7 @@ func createPersona(c client.Client) error {
 	return nil
 }
 
-func getPersona(c client.Client) error {
+func getPersona(c client.Client, format outputFormat) error {
 	if len(os.Args) < 3 {
 		fmt.Println("Usage: fr0g-ai-aip get <id>")
 		return fmt.Errorf("persona ID required")
@@ -783,23 +1025,24 @@ func getPersona(c client.Client) error {
 		return err
 	}
 
-	fmt.Printf("ID: %s\n", p.Id)
-	fmt.Printf("Name: %s\n", p.Name)
-	fmt.Printf("Topic: %s\n", p.Topic)
-	fmt.Printf("Prompt: %s\n", p.Prompt)
-	if len(p.Context) > 0 {
-		fmt.Println("Context:")
-		for k, v := range p.Context {
-			fmt.Printf("  %s: %s\n", k, v)
+	return render(format, p, func() {
+		fmt.Printf("ID: %s\n", p.Id)
+		fmt.Printf("Name: %s\n", p.Name)
+		fmt.Printf("Topic: %s\n", p.Topic)
+		fmt.Printf("Prompt: %s\n", p.Prompt)
+		if len(p.Context) > 0 {
+			fmt.Println("Context:")
+			for k, v := range p.Context {
+				fmt.Printf("  %s: %s\n", k, v)
+			}
 		}
-	}
-	if len(p.Rag) > 0 {
-		fmt.Println("RAG:")
-		for _, r := range p.Rag {
-			fmt.Printf("  %s\n", r)
+		if len(p.Rag) > 0 {
+			fmt.Println("RAG:")
+			for _, r := range p.Rag {
+				fmt.Printf("  %s\n", r)
+			}
 		}
-	}
-	return nil
+	})
 }
 
 func updatePersona(c client.Client) error {
@@ -862,6 +1105,78 @@ func deletePersona(c client.Client) error {
 	return nil
 }
 
+func clonePersona(c client.Client) error {
+	if len(os.Args) < 3 {
+		fmt.Println("Usage: fr0g-ai-aip clone <id>")
+		return fmt.Errorf("persona ID required")
+	}
+
+	original, err := c.Get(os.Args[2])
+	if err != nil {
+		return err
+	}
+
+	clone := persona.CopyPersona(original)
+	if err := c.Create(&clone); err != nil {
+		return fmt.Errorf("failed to clone persona: %v", err)
+	}
+
+	fmt.Printf("Cloned persona: %s (ID: %s)\n", clone.Name, clone.Id)
+	return nil
+}
+
+func importOpenAIPersonas(c client.Client) error {
+	fs := flag.NewFlagSet("import-openai", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: fr0g-ai-aip import-openai -i <file.json>")
+	}
+	input := fs.String("i", "", "OpenAI assistant JSON file")
+
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		return err
+	}
+
+	if *input == "" {
+		fs.Usage()
+		return fmt.Errorf("input file required")
+	}
+
+	data, err := os.ReadFile(*input)
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %v", err)
+	}
+
+	personas, err := persona.ParseOpenAIAssistants(data)
+	if err != nil {
+		return err
+	}
+
+	for i := range personas {
+		if err := c.Create(&personas[i]); err != nil {
+			return fmt.Errorf("failed to import persona %s: %v", personas[i].Name, err)
+		}
+		fmt.Printf("Imported persona: %s (ID: %s)\n", personas[i].Name, personas[i].Id)
+	}
+
+	fmt.Printf("Imported %d persona(s)\n", len(personas))
+	return nil
+}
+
+// newGenerator returns a seeded generator when -seed was given, so the same
+// seed reproduces the same identities, and a crypto/rand generator otherwise
+func newGenerator(fs *flag.FlagSet, seed int64) *generator.Generator {
+	seeded := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			seeded = true
+		}
+	})
+	if seeded {
+		return generator.NewSeededGenerator(seed)
+	}
+	return generator.NewGenerator()
+}
+
 // GetConfigFromEnv reads configuration from environment variables
 func GetConfigFromEnv() Config {
 	config := defaultConfig
@@ -899,33 +1214,37 @@ func serveCommand() error {
 }
 
 // Identity management functions
-func listIdentities(c client.Client) error {
+func listIdentities(c client.Client, format outputFormat) error {
 	identities, err := c.ListIdentities(nil)
 	if err != nil {
 		return err
 	}
-
-	if len(identities) == 0 {
-		fmt.Println("No identities found")
-		return nil
+	if identities == nil {
+		identities = []types.Identity{} // Render [] rather than null
 	}
 
-	fmt.Println("Identities:")
-	for _, i := range identities {
-		status := "Active"
-		if !i.IsActive {
-			status = "Inactive"
-		}
-		fmt.Printf("  ID: %s, Name: %s, Persona: %s, Status: %s\n",
-			i.Id, i.Name, i.PersonaId, status)
-		if i.Description != "" {
-			fmt.Printf("    Description: %s\n", i.Description)
+	return render(format, identities, func() {
+		if len(identities) == 0 {
+			fmt.Println("No identities found")
+			return
 		}
-		if len(i.Tags) > 0 {
-			fmt.Printf("    Tags: %s\n", strings.Join(i.Tags, ", "))
+
+		fmt.Println("Identities:")
+		for _, i := range identities {
+			status := "Active"
+			if !i.IsActive {
+				status = "Inactive"
+			}
+			fmt.Printf("  ID: %s, Name: %s, Persona: %s, Status: %s\n",
+				i.Id, i.Name, i.PersonaId, status)
+			if i.Description != "" {
+				fmt.Printf("    Description: %s\n", i.Description)
+			}
+			if len(i.Tags) > 0 {
+				fmt.Printf("    Tags: %s\n", strings.Join(i.Tags, ", "))
+			}
 		}
-	}
-	return nil
+	})
 }
 
 func createIdentity(c client.Client) error {
@@ -972,7 +1291,7 @@ func createIdentity(c client.Client) error {
 	return nil
 }
 
-func getIdentity(c client.Client) error {
+func getIdentity(c client.Client, format outputFormat) error {
 	if len(os.Args) < 3 {
 		return fmt.Errorf("identity ID is required")
 	}
@@ -983,27 +1302,27 @@ func getIdentity(c client.Client) error {
 		return err
 	}
 
-	fmt.Printf("Identity: %s\n", i.Id)
-	fmt.Printf("  Name: %s\n", i.Name)
-	fmt.Printf("  Persona ID: %s\n", i.PersonaId)
-	fmt.Printf("  Description: %s\n", i.Description)
-	fmt.Printf("  Status: %s\n", map[bool]string{true: "Active", false: "Inactive"}[i.IsActive])
-	fmt.Printf("  Created: %s\n", i.CreatedAt.Format("2006-01-02 15:04:05"))
-	fmt.Printf("  Updated: %s\n", i.UpdatedAt.Format("2006-01-02 15:04:05"))
-
-	if len(i.Tags) > 0 {
-		fmt.Printf("  Tags: %s\n", strings.Join(i.Tags, ", "))
-	}
+	return render(format, i, func() {
+		fmt.Printf("Identity: %s\n", i.Id)
+		fmt.Printf("  Name: %s\n", i.Name)
+		fmt.Printf("  Persona ID: %s\n", i.PersonaId)
+		fmt.Printf("  Description: %s\n", i.Description)
+		fmt.Printf("  Status: %s\n", map[bool]string{true: "Active", false: "Inactive"}[i.IsActive])
+		fmt.Printf("  Created: %s\n", i.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("  Updated: %s\n", i.UpdatedAt.Format("2006-01-02 15:04:05"))
 
-	if i.RichAttributes != nil {
-		fmt.Printf("  Rich Attributes: Available\n")
-		if i.RichAttributes.Demographics != nil {
-			fmt.Printf("    Age: %d\n", i.RichAttributes.Demographics.Age)
-			fmt.Printf("    Gender: %s\n", i.RichAttributes.Demographics.Gender)
+		if len(i.Tags) > 0 {
+			fmt.Printf("  Tags: %s\n", strings.Join(i.Tags, ", "))
 		}
-	}
 
-	return nil
+		if i.RichAttributes != nil {
+			fmt.Printf("  Rich Attributes: Available\n")
+			if i.RichAttributes.Demographics != nil {
+				fmt.Printf("    Age: %d\n", i.RichAttributes.Demographics.Age)
+				fmt.Printf("    Gender: %s\n", i.RichAttributes.Demographics.Gender)
+			}
+		}
+	})
 }
 
 func updateIdentity(c client.Client) error {
@@ -1076,7 +1395,7 @@ func deleteIdentity(c client.Client) error {
 	return nil
 }
 
-func getIdentityWithPersona(c client.Client) error {
+func getIdentityWithPersona(c client.Client, format outputFormat) error {
 	if len(os.Args) < 3 {
 		return fmt.Errorf("identity ID is required")
 	}
@@ -1087,19 +1406,19 @@ func getIdentityWithPersona(c client.Client) error {
 		return err
 	}
 
-	fmt.Printf("Identity with Persona: %s\n", iwp.Identity.Id)
-	fmt.Printf("  Identity Name: %s\n", iwp.Identity.Name)
-	fmt.Printf("  Persona Name: %s\n", iwp.Persona.Name)
-	fmt.Printf("  Persona Topic: %s\n", iwp.Persona.Topic)
-	fmt.Printf("  Identity Description: %s\n", iwp.Identity.Description)
-	fmt.Printf("  Persona Prompt: %s\n", iwp.Persona.Prompt)
-	fmt.Printf("  Status: %s\n", map[bool]string{true: "Active", false: "Inactive"}[iwp.Identity.IsActive])
+	return render(format, iwp, func() {
+		fmt.Printf("Identity with Persona: %s\n", iwp.Identity.Id)
+		fmt.Printf("  Identity Name: %s\n", iwp.Identity.Name)
+		fmt.Printf("  Persona Name: %s\n", iwp.Persona.Name)
+		fmt.Printf("  Persona Topic: %s\n", iwp.Persona.Topic)
+		fmt.Printf("  Identity Description: %s\n", iwp.Identity.Description)
+		fmt.Printf("  Persona Prompt: %s\n", iwp.Persona.Prompt)
+		fmt.Printf("  Status: %s\n", map[bool]string{true: "Active", false: "Inactive"}[iwp.Identity.IsActive])
 
-	if len(iwp.Identity.Tags) > 0 {
-		fmt.Printf("  Tags: %s\n", strings.Join(iwp.Identity.Tags, ", "))
-	}
-
-	return nil
+		if len(iwp.Identity.Tags) > 0 {
+			fmt.Printf("  Tags: %s\n", strings.Join(iwp.Identity.Tags, ", "))
+		}
+	})
 }
 
 // Generation functions
@@ -1109,11 +1428,13 @@ func generateIdentity(c client.Client) error {
 		fmt.Println("Usage: fr0g-ai-aip generate-identity -persona-id <id> [-name <name>] [-random]")
 		fmt.Println("  -persona-id <id>    Persona ID (required)")
 		fmt.Println("  -name <name>        Identity name (optional, will generate if not provided)")
-		fmt.Println("  -random             Generate random attributes (default)")
+		fmt.Println("  -random             Generate random attributes (default; -random=false skips them)")
+		fmt.Println("  -seed <number>      Random seed for reproducible generation (optional)")
 	}
 	personaID := fs.String("persona-id", "", "Persona ID (required)")
 	name := fs.String("name", "", "Identity name (optional)")
-	// random := fs.Bool("random", true, "Generate random attributes") // TODO: implement random generation
+	random := fs.Bool("random", true, "Generate random attributes")
+	seed := fs.Int64("seed", 0, "Random seed (optional)")
 
 	if err := fs.Parse(os.Args[2:]); err != nil {
 		return err
@@ -1130,45 +1451,14 @@ func generateIdentity(c client.Client) error {
 		return fmt.Errorf("persona not found: %v", err)
 	}
 
-	// Generate identity name if not provided
-	if *name == "" {
-		*name = fmt.Sprintf("Generated Identity %d", time.Now().Unix())
-	}
-
-	// For now, we'll create a simple identity
-	// In a full implementation, you'd use the generator package
-	i := types.Identity{
-		PersonaId:   *personaID,
-		Name:        *name,
-		Description: "A generated identity with rich attributes",
-		Tags:        []string{"generated", "random"},
-		IsActive:    true,
-		RichAttributes: &types.RichAttributes{
-			Demographics: &types.Demographics{
-				Age:       30,
-				Gender:    "non-binary",
-				Education: "bachelors",
-				Location: &types.Location{
-					Country:    "United States",
-					City:       "San Francisco",
-					UrbanRural: "urban",
-				},
-			},
-			Psychographics: &types.Psychographics{
-				Personality: &types.Personality{
-					Openness:          0.7,
-					Conscientiousness: 0.6,
-					Extraversion:      0.5,
-					Agreeableness:     0.8,
-					Neuroticism:       0.3,
-				},
-				Values:        []string{"curiosity", "compassion", "growth"},
-				RiskTolerance: "medium",
-			},
-		},
+	// The generator picks a name when none is given
+	gen := newGenerator(fs, *seed)
+	i := gen.GenerateRandomIdentity(*personaID, *name)
+	if !*random {
+		i.RichAttributes = nil
 	}
 
-	if err := c.CreateIdentity(&i); err != nil {
+	if err := c.CreateIdentity(i); err != nil {
 		return fmt.Errorf("failed to create generated identity: %v", err)
 	}
 
@@ -1185,19 +1475,70 @@ func generateIdentity(c client.Client) error {
 	return nil
 }
 
+// memberCreateAttempts bounds how often generate-community tries to create
+// each member before giving up on it
+const memberCreateAttempts = 3
+
+// createIdentityWithRetry creates identity, trying up to
+// memberCreateAttempts times in all while the failure may be transient.
+// Clients that support it get the same idempotency key on every attempt,
+// so a create that reached the server is not repeated. Returns the last
+// error.
+func createIdentityWithRetry(c client.Client, identity *types.Identity) error {
+	create := c.CreateIdentity
+	keyed, hasKeys := c.(client.IdempotentIdentityCreator)
+	if hasKeys {
+		key := ids.New()
+		create = func(i *types.Identity) error { return keyed.CreateIdentityWithKey(i, key) }
+	}
+
+	var err error
+	for attempt := 0; attempt < memberCreateAttempts; attempt++ {
+		if err = create(identity); err == nil || !retryableCreate(err, hasKeys) {
+			return err
+		}
+	}
+	return err
+}
+
+// retryableCreate reports whether a failed create is worth sending again.
+// Rejected input, a missing persona and conflicts fail the same way every
+// time. Without an idempotency key a gRPC create is only resent when the
+// server was unavailable, as it may have stored the identity otherwise.
+func retryableCreate(err error, hasKeys bool) bool {
+	if errors.Is(err, errs.ErrValidation) || errors.Is(err, errs.ErrNotFound) || errors.Is(err, errs.ErrConflict) {
+		return false
+	}
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.FailedPrecondition,
+			codes.PermissionDenied, codes.Unauthenticated:
+			return false
+		case codes.Unavailable:
+			return true
+		}
+		return hasKeys
+	}
+	return true
+}
+
 func generateCommunity(c client.Client) error {
 	fs := flag.NewFlagSet("generate-community", flag.ContinueOnError)
 	fs.Usage = func() {
-		fmt.Println("Usage: fr0g-ai-aip generate-community -persona-id <id> -size <number> [-location <city,country>] [-age-range <min>-<max>]")
+		fmt.Println("Usage: fr0g-ai-aip generate-community -persona-id <id> -size <number> [-location <city,country>] [-age-range <min>-<max>] [-best-effort]")
 		fmt.Println("  -persona-id <id>    Persona ID (required)")
 		fmt.Println("  -size <number>      Number of identities to generate (required)")
 		fmt.Println("  -location <city,country>  Location for the community (optional)")
 		fmt.Println("  -age-range <min>-<max>    Age range for the community (optional)")
+		fmt.Println("  -seed <number>      Random seed for reproducible generation (optional)")
+		fmt.Printf("  -best-effort        Skip members that fail %d times instead of failing (optional)\n", memberCreateAttempts)
 	}
 	personaID := fs.String("persona-id", "", "Persona ID (required)")
 	size := fs.Int("size", 0, "Number of identities to generate (required)")
 	location := fs.String("location", "", "Location (city,country)")
 	ageRange := fs.String("age-range", "", "Age range (min-max)")
+	seed := fs.Int64("seed", 0, "Random seed (optional)")
+	bestEffort := fs.Bool("best-effort", false, "Skip members that cannot be created")
 
 	if err := fs.Parse(os.Args[2:]); err != nil {
 		return err
@@ -1240,49 +1581,35 @@ func generateCommunity(c client.Client) error {
 		}
 	}
 
+	// Members default to a broad adult population
+	spec := &generator.CommunitySpecification{
+		Location:           loc,
+		AgeRange:           &types.AgeRange{Min: 25, Max: 69},
+		GenderDistribution: map[string]float64{"female": 1.0 / 3, "male": 1.0 / 3, "non-binary": 1.0 / 3},
+		PersonalityProfile: &types.Personality{
+			Openness:          0.6,
+			Conscientiousness: 0.6,
+			Extraversion:      0.6,
+			Agreeableness:     0.6,
+			Neuroticism:       0.4,
+		},
+	}
+	if ageRangeStruct != nil {
+		spec.AgeRange = ageRangeStruct
+	}
+
 	// Generate community identities
+	gen := newGenerator(fs, *seed)
 	createdCount := 0
-	for i := 0; i < *size; i++ {
-		name := fmt.Sprintf("Community Member %d", i+1)
-
-		// Create identity with location and age range if specified
-		identity := types.Identity{
-			PersonaId:   *personaID,
-			Name:        name,
-			Description: fmt.Sprintf("Community member %d with generated attributes", i+1),
-			Tags:        []string{"community", "generated"},
-			IsActive:    true,
-			RichAttributes: &types.RichAttributes{
-				Demographics: &types.Demographics{
-					Age:       int32(25 + i%45), // Spread ages
-					Gender:    []string{"male", "female", "non-binary"}[i%3],
-					Education: []string{"high_school", "bachelors", "masters"}[i%3],
-				},
-				Psychographics: &types.Psychographics{
-					Personality: &types.Personality{
-						Openness:          0.5 + float64(i%5)*0.1,
-						Conscientiousness: 0.5 + float64(i%5)*0.1,
-						Extraversion:      0.5 + float64(i%5)*0.1,
-						Agreeableness:     0.5 + float64(i%5)*0.1,
-						Neuroticism:       0.3 + float64(i%5)*0.1,
-					},
-					Values: []string{"community", "growth", "connection"},
-				},
-			},
-		}
-
-		// Apply location if specified
-		if loc != nil {
-			identity.RichAttributes.Demographics.Location = loc
-		}
-
-		// Apply age range if specified
-		if ageRangeStruct != nil {
-			ageSpread := int(ageRangeStruct.Max - ageRangeStruct.Min + 1)
-			identity.RichAttributes.Demographics.Age = ageRangeStruct.Min + int32(i%ageSpread)
-		}
-
-		if err := c.CreateIdentity(&identity); err != nil {
+	for i, identity := range gen.GenerateCommunity(*personaID, *size, spec) {
+		identity.Name = fmt.Sprintf("Community Member %d", i+1)
+		identity.Description = fmt.Sprintf("Community member %d with generated attributes", i+1)
+		identity.Tags = []string{"community", "generated"}
+
+		if err := createIdentityWithRetry(c, identity); err != nil {
+			if !*bestEffort {
+				return fmt.Errorf("failed to create identity %d after %d attempts (%d of %d created): %v", i+1, memberCreateAttempts, createdCount, *size, err)
+			}
 			fmt.Printf("Warning: Failed to create identity %d: %v\n", i+1, err)
 			continue
 		}
@@ -1,10 +1,17 @@
 package cli
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/client"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/persona"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
@@ -843,3 +850,356 @@ func TestCreateClient_RESTWithDefaultURL(t *testing.T) {
 		t.Error("Expected client to be created")
 	}
 }
+
+func TestExecuteWithConfig_ImportOpenAI(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	
+	tempDir := t.TempDir()
+	input := filepath.Join(tempDir, "assistant.json")
+	assistant := `{"name": "Go Expert", "description": "Golang", "instructions": "You are a Go expert."}`
+	if err := os.WriteFile(input, []byte(assistant), 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+	
+	dataDir := filepath.Join(tempDir, "data")
+	os.Args = []string{"fr0g-ai-aip", "import-openai", "-i", input}
+	config := Config{ClientType: "local", StorageType: "file", DataDir: dataDir}
+	if err := ExecuteWithConfig(config); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	
+	store, err := storage.NewFileStorage(dataDir)
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	personas, err := store.List()
+	if err != nil {
+		t.Fatalf("Failed to list personas: %v", err)
+	}
+	if len(personas) != 1 || personas[0].Prompt != "You are a Go expert." {
+		t.Errorf("Expected imported persona, got %+v", personas)
+	}
+	
+	// Missing input flag
+	os.Args = []string{"fr0g-ai-aip", "import-openai"}
+	if err := ExecuteWithConfig(config); err == nil {
+		t.Error("Expected error for missing input file")
+	}
+}
+
+func TestExecuteWithConfig_ExportImport(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	
+	source := persona.NewService(storage.NewMemoryStorage())
+	if err := createSamplePersonas(source); err != nil {
+		t.Fatalf("failed to create sample personas: %v", err)
+	}
+	expected, _ := source.ListPersonas()
+	
+	bundle := filepath.Join(t.TempDir(), "personas.json")
+	os.Args = []string{"fr0g-ai-aip", "export", "-o", bundle}
+	if err := ExecuteWithConfig(Config{Service: source}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	
+	target := persona.NewService(storage.NewMemoryStorage())
+	os.Args = []string{"fr0g-ai-aip", "import", "-i", bundle}
+	if err := ExecuteWithConfig(Config{Service: target}); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	imported, _ := target.ListPersonas()
+	if len(imported) != len(expected) {
+		t.Errorf("Expected %d imported personas, got %d", len(expected), len(imported))
+	}
+	
+	// Both commands need a file and direct service access
+	os.Args = []string{"fr0g-ai-aip", "import"}
+	if err := ExecuteWithConfig(Config{Service: target}); err == nil {
+		t.Error("Expected error for missing input file")
+	}
+	os.Args = []string{"fr0g-ai-aip", "export", "-o", bundle}
+	if err := ExecuteWithConfig(Config{}); err == nil {
+		t.Error("Expected error without a service")
+	}
+}
+
+func TestExecuteWithConfig_Clone(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	
+	dataDir := t.TempDir()
+	store, err := storage.NewFileStorage(dataDir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	original := &types.Persona{Name: "Go Expert", Topic: "Golang", Prompt: "You are a Go expert."}
+	if err := store.Create(original); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	
+	os.Args = []string{"fr0g-ai-aip", "clone", original.Id}
+	config := Config{ClientType: "local", StorageType: "file", DataDir: dataDir}
+	if err := ExecuteWithConfig(config); err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	
+	store, err = storage.NewFileStorage(dataDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	personas, err := store.List()
+	if err != nil {
+		t.Fatalf("Failed to list personas: %v", err)
+	}
+	if len(personas) != 2 {
+		t.Fatalf("Expected 2 personas after clone, got %d", len(personas))
+	}
+	for _, p := range personas {
+		if p.Id != original.Id && p.Name != "Go Expert (copy)" {
+			t.Errorf("Expected clone named 'Go Expert (copy)', got %q", p.Name)
+		}
+	}
+	
+	// Missing ID
+	os.Args = []string{"fr0g-ai-aip", "clone"}
+	if err := ExecuteWithConfig(config); err == nil {
+		t.Error("Expected error for missing persona ID")
+	}
+}
+
+func TestExecuteWithConfig_GenerateIdentity(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	
+	dataDir := t.TempDir()
+	store, err := storage.NewFileStorage(dataDir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	p := &types.Persona{Name: "Generator", Topic: "Testing", Prompt: "You generate identities."}
+	if err := store.Create(p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	config := Config{ClientType: "local", StorageType: "file", DataDir: dataDir}
+	
+	// Generate one identity and return it
+	generate := func(args ...string) types.Identity {
+		t.Helper()
+		before, _ := store.ListIdentities(nil)
+		
+		os.Args = append([]string{"fr0g-ai-aip", "generate-identity", "-persona-id", p.Id}, args...)
+		if err := ExecuteWithConfig(config); err != nil {
+			t.Fatalf("generate-identity failed: %v", err)
+		}
+		
+		store, _ = storage.NewFileStorage(dataDir)
+		identities, err := store.ListIdentities(nil)
+		if err != nil {
+			t.Fatalf("Failed to list identities: %v", err)
+		}
+		if len(identities) != len(before)+1 {
+			t.Fatalf("Expected %d identities, got %d", len(before)+1, len(identities))
+		}
+		for _, identity := range identities {
+			known := false
+			for _, b := range before {
+				known = known || b.Id == identity.Id
+			}
+			if !known {
+				return identity
+			}
+		}
+		t.Fatal("Generated identity not found")
+		return types.Identity{}
+	}
+	
+	first := generate("-seed", "1")
+	second := generate("-seed", "2")
+	for _, identity := range []types.Identity{first, second} {
+		if identity.Name == "" {
+			t.Error("Expected a generated name")
+		}
+		if identity.RichAttributes == nil || identity.RichAttributes.Demographics == nil {
+			t.Fatalf("Expected generated demographics for %s", identity.Id)
+		}
+	}
+	d1, d2 := first.RichAttributes.Demographics, second.RichAttributes.Demographics
+	if d1.Age == d2.Age && d1.Gender == d2.Gender && d1.Ethnicity == d2.Ethnicity && d1.Education == d2.Education {
+		t.Errorf("Expected different demographics, both were %+v", d1)
+	}
+	
+	named := generate("-name", "Alex Chen", "-random=false")
+	if named.Name != "Alex Chen" {
+		t.Errorf("Expected name 'Alex Chen', got %q", named.Name)
+	}
+	if named.RichAttributes != nil && named.RichAttributes.Demographics != nil {
+		t.Error("Expected no generated demographics with -random=false")
+	}
+}
+
+func TestExecuteWithConfig_GenerateCommunitySeed(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	
+	// Generate a seeded population into a fresh store and return the ages
+	generate := func(seed string) []int32 {
+		t.Helper()
+		dataDir := t.TempDir()
+		store, err := storage.NewFileStorage(dataDir)
+		if err != nil {
+			t.Fatalf("Failed to create storage: %v", err)
+		}
+		p := &types.Persona{Name: "Seeded", Topic: "Testing", Prompt: "You are seeded."}
+		if err := store.Create(p); err != nil {
+			t.Fatalf("Failed to create persona: %v", err)
+		}
+		
+		os.Args = []string{"fr0g-ai-aip", "generate-community", "-persona-id", p.Id, "-size", "10", "-seed", seed}
+		config := Config{ClientType: "local", StorageType: "file", DataDir: dataDir}
+		if err := ExecuteWithConfig(config); err != nil {
+			t.Fatalf("generate-community failed: %v", err)
+		}
+		
+		store, _ = storage.NewFileStorage(dataDir)
+		identities, err := store.ListIdentities(nil)
+		if err != nil {
+			t.Fatalf("Failed to list identities: %v", err)
+		}
+		ages := make([]int32, 10)
+		for _, identity := range identities {
+			var n int
+			fmt.Sscanf(identity.Name, "Community Member %d", &n)
+			ages[n-1] = identity.RichAttributes.Demographics.Age
+		}
+		return ages
+	}
+	
+	first := generate("42")
+	second := generate("42")
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Expected the same seed to reproduce member ages, got %v and %v", first, second)
+		}
+	}
+}
+
+// flakyClient fails the first failures identity creations
+type flakyClient struct {
+	client.Client
+	failures int
+	attempts int
+}
+
+func (f *flakyClient) CreateIdentity(i *types.Identity) error {
+	f.attempts++
+	if f.attempts <= f.failures {
+		return errors.New("temporarily unavailable")
+	}
+	return f.Client.CreateIdentity(i)
+}
+
+// failingClient fails every identity creation with err
+type failingClient struct {
+	client.Client
+	err      error
+	attempts int
+}
+
+func (f *failingClient) CreateIdentity(i *types.Identity) error {
+	f.attempts++
+	return f.err
+}
+
+// keyedClient adds idempotency key support to failingClient
+type keyedClient struct {
+	*failingClient
+	keys []string
+}
+
+func (k *keyedClient) CreateIdentityWithKey(i *types.Identity, key string) error {
+	k.keys = append(k.keys, key)
+	return k.CreateIdentity(i)
+}
+
+func TestCreateIdentityWithRetry_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		keyed    bool
+		attempts int
+	}{
+		{"validation", errs.Validation("name is required"), false, 1},
+		{"missing persona", errs.NotFound("persona not found"), true, 1},
+		{"conflict", errs.Conflict("version conflict"), true, 1},
+		{"grpc invalid argument", status.Error(codes.InvalidArgument, "bad identity"), true, 1},
+		{"grpc unavailable", status.Error(codes.Unavailable, "connection refused"), false, memberCreateAttempts},
+		{"grpc internal without key", status.Error(codes.Internal, "storage failed"), false, 1},
+		{"grpc internal with key", status.Error(codes.Internal, "storage failed"), true, memberCreateAttempts},
+		{"transport", errors.New("connection reset"), true, memberCreateAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failing := &failingClient{err: tt.err}
+			var c client.Client = failing
+			keyed := &keyedClient{failingClient: failing}
+			if tt.keyed {
+				c = keyed
+			}
+			
+			if err := createIdentityWithRetry(c, &types.Identity{Name: "Member"}); !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+			if failing.attempts != tt.attempts {
+				t.Errorf("Expected %d attempts, got %d", tt.attempts, failing.attempts)
+			}
+			for _, key := range keyed.keys {
+				if key == "" || key != keyed.keys[0] {
+					t.Errorf("Expected one key for every attempt, got %q", keyed.keys)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateCommunity_Retries(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	
+	tests := []struct {
+		name     string
+		failures int
+		args     []string
+		created  int
+		wantErr  bool
+	}{
+		{"retry recovers", 1, nil, 5, false},
+		{"attempts exhausted", memberCreateAttempts, nil, 0, true},
+		{"best effort skips", memberCreateAttempts, []string{"-best-effort"}, 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewMemoryStorage()
+			p := &types.Persona{Name: "Flaky", Topic: "Testing", Prompt: "You are flaky."}
+			if err := store.Create(p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			
+			os.Args = append([]string{"fr0g-ai-aip", "generate-community", "-persona-id", p.Id, "-size", "5", "-seed", "1"}, tt.args...)
+			err := generateCommunity(&flakyClient{Client: client.NewLocalClient(store), failures: tt.failures})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			
+			identities, err := store.ListIdentities(nil)
+			if err != nil {
+				t.Fatalf("Failed to list identities: %v", err)
+			}
+			if len(identities) != tt.created {
+				t.Errorf("Expected %d identities, got %d", tt.created, len(identities))
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// outputFormat selects how list and get commands print their results
+type outputFormat string
+
+const (
+	formatTable outputFormat = "table" // human-readable text, the default
+	formatJSON  outputFormat = "json"
+	formatYAML  outputFormat = "yaml"
+)
+
+// parseOutputFormat validates the -o/--output value. Empty means table.
+func parseOutputFormat(value string) (outputFormat, error) {
+	switch format := outputFormat(strings.ToLower(value)); format {
+	case "":
+		return formatTable, nil
+	case formatTable, formatJSON, formatYAML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q (want table, json or yaml)", value)
+	}
+}
+
+// render prints v to stdout as JSON or YAML, or calls table for the
+// human-readable format. v is emitted as is so its fields keep their JSON
+// names in both machine-readable formats.
+func render(format outputFormat, v interface{}, table func()) error {
+	var data []byte
+	var err error
+	switch format {
+	case formatJSON:
+		data, err = json.MarshalIndent(v, "", "  ")
+		data = append(data, '\n')
+	case formatYAML:
+		data, err = encodeYAML(v)
+	default:
+		table()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode output: %v", err)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// encodeYAML writes v as block-style YAML by way of its JSON form, keeping
+// struct fields in declaration order. Strings are always double-quoted,
+// which YAML reads the same as JSON does.
+func encodeYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := decodeOrdered(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	if isYAMLCollection(value) {
+		writeYAMLNode(&b, value, 0)
+	} else {
+		b.WriteString(yamlScalar(value) + "\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// yamlField is one key of a mapping, kept in document order
+type yamlField struct {
+	key   string
+	value interface{}
+}
+
+// decodeOrdered reads the next JSON value, decoding objects as []yamlField
+// so their key order survives
+func decodeOrdered(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		fields := []yamlField{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, yamlField{key.(string), value})
+		}
+		_, err := decoder.Token() // Closing brace
+		return fields, err
+	case json.Delim('['):
+		items := []interface{}{}
+		for decoder.More() {
+			item, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		_, err := decoder.Token() // Closing bracket
+		return items, err
+	}
+	return token, nil
+}
+
+// writeYAMLNode writes a non-empty mapping or sequence at the given indent
+func writeYAMLNode(b *strings.Builder, value interface{}, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch value := value.(type) {
+	case []yamlField:
+		for _, field := range value {
+			writeYAMLEntry(b, pad+yamlKey(field.key)+":", field.value, indent)
+		}
+	case []interface{}:
+		for _, item := range value {
+			if fields, ok := item.([]yamlField); ok && len(fields) > 0 {
+				// Start the item's mapping on the dash line
+				var nested strings.Builder
+				writeYAMLNode(&nested, fields, indent+2)
+				b.WriteString(pad + "- " + nested.String()[indent+2:])
+				continue
+			}
+			writeYAMLEntry(b, pad+"-", item, indent)
+		}
+	}
+}
+
+// writeYAMLEntry writes prefix followed by value, nesting collections below it
+func writeYAMLEntry(b *strings.Builder, prefix string, value interface{}, indent int) {
+	if isYAMLCollection(value) {
+		b.WriteString(prefix + "\n")
+		writeYAMLNode(b, value, indent+2)
+		return
+	}
+	b.WriteString(prefix + " " + yamlScalar(value) + "\n")
+}
+
+// isYAMLCollection reports whether value is a non-empty mapping or sequence
+func isYAMLCollection(value interface{}) bool {
+	switch value := value.(type) {
+	case []yamlField:
+		return len(value) > 0
+	case []interface{}:
+		return len(value) > 0
+	}
+	return false
+}
+
+// yamlScalar formats a JSON scalar, or an empty collection, as YAML
+func yamlScalar(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(value)
+	case []yamlField:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+var plainYAMLKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// yamlKey quotes mapping keys that would not read back as plain strings
+func yamlKey(key string) string {
+	if plainYAMLKey.MatchString(key) && !isYAMLKeyword(key) {
+		return key
+	}
+	return strconv.Quote(key)
+}
+
+func isYAMLKeyword(key string) bool {
+	switch strings.ToLower(key) {
+	case "true", "false", "yes", "no", "on", "off", "null", "y", "n":
+		return true
+	}
+	return false
+}
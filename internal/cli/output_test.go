@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// captureStdout returns what fn writes to os.Stdout
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	original := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = original }()
+
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	runErr := fn()
+	w.Close()
+	return <-done, runErr
+}
+
+// runCLI executes the CLI with args against a file store in a temp directory
+func runCLI(t *testing.T, dataDir string, args ...string) (string, error) {
+	t.Helper()
+	originalArgs := os.Args
+	defer func() { os.Args = originalArgs }()
+	os.Args = append([]string{"fr0g-ai-aip"}, args...)
+
+	config := Config{ClientType: "local", StorageType: "file", DataDir: dataDir}
+	return captureStdout(t, func() error { return ExecuteWithConfig(config) })
+}
+
+func newOutputTestStore(t *testing.T) (string, *types.Persona) {
+	t.Helper()
+	dataDir := t.TempDir()
+	store, err := storage.NewFileStorage(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	p := &types.Persona{
+		Name:    "Go Expert",
+		Topic:   "Golang",
+		Prompt:  "You are a Go expert.",
+		Context: map[string]string{"level": "senior", "odd key": "yes"},
+		Rag:     []string{"effective-go"},
+	}
+	if err := store.Create(p); err != nil {
+		t.Fatalf("failed to create persona: %v", err)
+	}
+	return dataDir, p
+}
+
+func TestListOutputJSON(t *testing.T) {
+	dataDir, p := newOutputTestStore(t)
+
+	for _, args := range [][]string{
+		{"-o", "json", "list"},
+		{"--output=json", "list"},
+	} {
+		out, err := runCLI(t, dataDir, args...)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", args, err)
+		}
+		var personas []types.Persona
+		if err := json.Unmarshal([]byte(out), &personas); err != nil {
+			t.Fatalf("%v: output is not JSON: %v\n%s", args, err, out)
+		}
+		if len(personas) != 1 || personas[0].Id != p.Id || personas[0].Context["level"] != "senior" {
+			t.Errorf("%v: unexpected personas %+v", args, personas)
+		}
+	}
+}
+
+func TestGetOutputJSON(t *testing.T) {
+	dataDir, p := newOutputTestStore(t)
+
+	out, err := runCLI(t, dataDir, "-o", "json", "get", p.Id)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got types.Persona
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if got.Id != p.Id || got.Name != p.Name {
+		t.Errorf("expected persona %s, got %+v", p.Id, got)
+	}
+}
+
+func TestListOutputYAMLAndTable(t *testing.T) {
+	dataDir, p := newOutputTestStore(t)
+
+	out, err := runCLI(t, dataDir, "-o", "yaml", "list")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"- id: \"" + p.Id + "\"\n",
+		"  name: \"Go Expert\"\n",
+		"  context:\n    level: \"senior\"\n    \"odd key\": \"yes\"\n",
+		"  version: 1\n",
+		"  rag:\n    - \"effective-go\"\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected YAML to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	out, err = runCLI(t, dataDir, "list")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(out, "Personas:\n") {
+		t.Errorf("expected table output by default, got:\n%s", out)
+	}
+}
+
+func TestOutputEmptyListJSON(t *testing.T) {
+	out, err := runCLI(t, t.TempDir(), "-o", "json", "identity-list")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.TrimSpace(out) != "[]" {
+		t.Errorf("expected an empty JSON array, got %q", out)
+	}
+}
+
+func TestOutputInvalidFormat(t *testing.T) {
+	if _, err := runCLI(t, t.TempDir(), "-o", "xml", "list"); err == nil {
+		t.Error("expected error for unknown output format")
+	}
+}
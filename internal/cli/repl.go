@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/client"
+)
+
+const replPrompt = "fr0g-ai-aip> "
+
+// runREPL reads commands from in, one per line, and runs them against c
+// until exit, quit or the end of input. Every command shares the one client,
+// so a gRPC or REST session connects once instead of once per command.
+//
+// Lines are split like a shell would split them, honouring single and
+// double quotes and backslash escapes, and may start with -o to pick an
+// output format for that command alone. A failing command reports its
+// error and the session carries on. Line editing is whatever the terminal
+// provides; there is no history.
+func runREPL(c client.Client, config Config, in io.Reader) error {
+	originalArgs := os.Args
+	defer func() { os.Args = originalArgs }()
+
+	fmt.Println("fr0g-ai-aip interactive mode. Type help for commands, exit to quit.")
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Print(replPrompt)
+		if !scanner.Scan() {
+			fmt.Println()
+			return scanner.Err()
+		}
+
+		args, err := splitArgs(scanner.Text())
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "exit", "quit":
+			return nil
+		case "help":
+			printREPLHelp()
+			continue
+		}
+
+		if err := runREPLCommand(c, config, originalArgs[0], args); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+}
+
+// runREPLCommand runs a single REPL line, already split into args
+func runREPLCommand(c client.Client, config Config, program string, args []string) error {
+	args, err := parseGlobalFlags(&config, args)
+	if err == flag.ErrHelp {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("command required")
+	}
+	format, err := parseOutputFormat(config.Output)
+	if err != nil {
+		return err
+	}
+
+	// Subcommands read their arguments from os.Args
+	os.Args = append([]string{program}, args...)
+	err = runClientCommand(c, format, args[0])
+	if errors.Is(err, errUnknownCommand) {
+		return fmt.Errorf("%w (type help for the commands available here)", err)
+	}
+	return err
+}
+
+func printREPLHelp() {
+	fmt.Println("Commands (see fr0g-ai-aip help for their options):")
+	fmt.Println("  list, create, get, update, delete, clone, import-openai")
+	fmt.Println("  identity-list, identity-create, identity-get, identity-update,")
+	fmt.Println("  identity-delete, identity-get-with-persona")
+	fmt.Println("  generate-identity, generate-community")
+	fmt.Println("Prefix a command with -o table|json|yaml to change its output format.")
+	fmt.Println("  help                Show this help")
+	fmt.Println("  exit, quit          Leave the REPL")
+}
+
+// splitArgs splits a command line into arguments at unquoted whitespace.
+// Single quotes keep everything literally, double quotes allow backslash
+// escapes, and a backslash outside quotes escapes the next character.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inArg = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("line ends with a backslash")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
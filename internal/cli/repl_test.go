@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/client"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
+)
+
+func TestREPL(t *testing.T) {
+	c := client.NewLocalClient(storage.NewMemoryStorage())
+	input := strings.Join([]string{
+		`create -name "Go Expert" -topic Golang -prompt 'You are a Go expert.'`,
+		``,
+		`list`,
+		`-o json list`,
+		`get`,
+		`frobnicate`,
+		`create -name "unterminated`,
+		`help`,
+		`exit`,
+		`create -name Ignored -topic After -prompt Exit`,
+	}, "\n")
+
+	out, err := captureStdout(t, func() error {
+		return runREPL(c, Config{}, strings.NewReader(input))
+	})
+	if err != nil {
+		t.Fatalf("REPL failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"Created persona: Go Expert (ID: ",
+		"Name: Go Expert, Topic: Golang",
+		`"name": "Go Expert"`,
+		"Error: persona ID required",
+		"Error: unknown command: frobnicate",
+		"Error: unterminated \" quote",
+		"exit, quit",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	personas, err := c.List()
+	if err != nil {
+		t.Fatalf("failed to list personas: %v", err)
+	}
+	if len(personas) != 1 {
+		t.Errorf("expected only the persona created before exit, got %d", len(personas))
+	}
+}
+
+func TestREPL_EndOfInput(t *testing.T) {
+	c := client.NewLocalClient(storage.NewMemoryStorage())
+	out, err := captureStdout(t, func() error {
+		return runREPL(c, Config{}, strings.NewReader("list"))
+	})
+	if err != nil {
+		t.Fatalf("REPL failed: %v", err)
+	}
+	if strings.Count(out, replPrompt) != 2 || !strings.Contains(out, "No personas found") {
+		t.Errorf("expected the last line to run before the input ended, got:\n%s", out)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := map[string][]string{
+		`list`:                           {"list"},
+		`  get   abc  `:                  {"get", "abc"},
+		`create -name "Go Expert"`:       {"create", "-name", "Go Expert"},
+		`create -prompt 'Say "hi"'`:      {"create", "-prompt", `Say "hi"`},
+		`create -prompt "It's \"fine\""`: {"create", "-prompt", `It's "fine"`},
+		`a\ b ""`:                        {"a b", ""},
+		``:                               nil,
+	}
+	for line, want := range tests {
+		got, err := splitArgs(line)
+		if err != nil {
+			t.Errorf("splitArgs(%q) failed: %v", line, err)
+			continue
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", line, got, want)
+		}
+	}
+
+	for _, line := range []string{`"open`, `'open`, `trailing\`} {
+		if _, err := splitArgs(line); err == nil {
+			t.Errorf("expected error for %q", line)
+		}
+	}
+}
@@ -2,35 +2,138 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io"
+	"os"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
 
 	pb "github.com/fr0g-vibe/fr0g-ai-aip/internal/grpc/pb"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
 )
 
-// GRPCClient implements a real gRPC client using protobuf
+// DefaultTimeout bounds each RPC made through a GRPCClient method that
+// does not take a context
+const DefaultTimeout = 5 * time.Second
+
+// minBatchTimeout is the least time given to batch identity creation, which
+// does far more work per call than other RPCs
+const minBatchTimeout = 30 * time.Second
+
+// GRPCClient implements a real gRPC client using protobuf.
+//
+// Every method has a Ctx variant, e.g. GetCtx, that uses the caller's
+// context as is. The plain methods call it with a context bounded by the
+// client's timeout.
 type GRPCClient struct {
-	conn   *grpc.ClientConn
-	client pb.PersonaServiceClient
+	conn    *grpc.ClientConn
+	client  pb.PersonaServiceClient
+	timeout time.Duration
+}
+
+// GRPCClientOption configures a GRPCClient
+type GRPCClientOption func(*GRPCClient)
+
+// WithTimeout sets the timeout for methods that do not take a context.
+// Non-positive values keep DefaultTimeout.
+func WithTimeout(timeout time.Duration) GRPCClientOption {
+	return func(g *GRPCClient) {
+		if timeout > 0 {
+			g.timeout = timeout
+		}
+	}
+}
+
+// TLSOptions configures the TLS connection of a client made with
+// NewGRPCClientTLS
+type TLSOptions struct {
+	// CAFile is a PEM file of the CAs that verify the server certificate.
+	// Empty uses the system roots.
+	CAFile string
+
+	// CertFile and KeyFile hold the client certificate presented to a
+	// server that requires mutual TLS. Leave both empty otherwise.
+	CertFile string
+	KeyFile  string
+
+	// ServerName overrides the name checked against the server
+	// certificate, which defaults to the host in the address
+	ServerName string
+}
+
+// NewGRPCClient creates a new gRPC client over an insecure connection
+func NewGRPCClient(address string, opts ...GRPCClientOption) (*GRPCClient, error) {
+	return newGRPCClient(address, insecure.NewCredentials(), opts)
+}
+
+// NewGRPCClientTLS creates a new gRPC client that connects with TLS, for
+// servers started with grpc.enable_tls
+func NewGRPCClientTLS(address string, tlsOpts TLSOptions, opts ...GRPCClientOption) (*GRPCClient, error) {
+	tlsConfig := &tls.Config{
+		ServerName: tlsOpts.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if tlsOpts.CAFile != "" {
+		data, err := os.ReadFile(tlsOpts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", tlsOpts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if tlsOpts.CertFile != "" || tlsOpts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(tlsOpts.CertFile, tlsOpts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return newGRPCClient(address, credentials.NewTLS(tlsConfig), opts)
 }
 
-// NewGRPCClient creates a new gRPC client
-func NewGRPCClient(address string) (*GRPCClient, error) {
-	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func newGRPCClient(address string, creds credentials.TransportCredentials, opts []GRPCClientOption) (*GRPCClient, error) {
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gRPC connection: %v", err)
 	}
 
-	client := pb.NewPersonaServiceClient(conn)
+	g := &GRPCClient{
+		conn:    conn,
+		client:  pb.NewPersonaServiceClient(conn),
+		timeout: DefaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g, nil
+}
 
-	return &GRPCClient{
-		conn:   conn,
-		client: client,
-	}, nil
+// rpcContext returns a background context bounded by the client's timeout
+func (g *GRPCClient) rpcContext() (context.Context, context.CancelFunc) {
+	timeout := g.timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// batchContext is rpcContext with at least minBatchTimeout
+func (g *GRPCClient) batchContext() (context.Context, context.CancelFunc) {
+	timeout := g.timeout
+	if timeout < minBatchTimeout {
+		timeout = minBatchTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
 }
 
 // Close closes the gRPC connection
@@ -38,24 +141,48 @@ func (g *GRPCClient) Close() error {
 	return g.conn.Close()
 }
 
+// CheckHealth queries the server's grpc.health.v1 service and returns an
+// error unless the server reports SERVING
+func (g *GRPCClient) CheckHealth() error {
+	ctx, cancel := g.rpcContext()
+	defer cancel()
+	return g.CheckHealthCtx(ctx)
+}
+
+func (g *GRPCClient) CheckHealthCtx(ctx context.Context) error {
+	resp, err := healthpb.NewHealthClient(g.conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("server is not serving: %s", resp.GetStatus())
+	}
+	return nil
+}
+
 // Persona operations
 func (g *GRPCClient) Create(p *types.Persona) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := g.rpcContext()
 	defer cancel()
+	return g.CreateCtx(ctx, p)
+}
 
+func (g *GRPCClient) CreateCtx(ctx context.Context, p *types.Persona) error {
 	req := &pb.CreatePersonaRequest{
 		Persona: &pb.Persona{
-			Name:    p.Name,
-			Topic:   p.Topic,
-			Prompt:  p.Prompt,
-			Context: p.Context,
-			Rag:     p.Rag,
+			Name:     p.Name,
+			Topic:    p.Topic,
+			Prompt:   p.Prompt,
+			Context:  p.Context,
+			Rag:      p.Rag,
+			Tags:     p.Tags,
+			ParentId: p.ParentId,
 		},
 	}
 
 	resp, err := g.client.CreatePersona(ctx, req)
 	if err != nil {
-		return fmt.Errorf("failed to create persona: %v", err)
+		return fmt.Errorf("failed to create persona: %w", err)
 	}
 
 	// Update the persona with the returned ID
@@ -64,84 +191,137 @@ func (g *GRPCClient) Create(p *types.Persona) error {
 }
 
 func (g *GRPCClient) Get(id string) (types.Persona, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := g.rpcContext()
 	defer cancel()
+	return g.GetCtx(ctx, id)
+}
 
+func (g *GRPCClient) GetCtx(ctx context.Context, id string) (types.Persona, error) {
 	req := &pb.GetPersonaRequest{Id: id}
 
 	resp, err := g.client.GetPersona(ctx, req)
 	if err != nil {
-		return types.Persona{}, fmt.Errorf("failed to get persona: %v", err)
+		return types.Persona{}, fmt.Errorf("failed to get persona: %w", err)
 	}
 
 	return types.Persona{
-		Id:      resp.Persona.Id,
-		Name:    resp.Persona.Name,
-		Topic:   resp.Persona.Topic,
-		Prompt:  resp.Persona.Prompt,
-		Context: resp.Persona.Context,
-		Rag:     resp.Persona.Rag,
+		Id:       resp.Persona.Id,
+		Name:     resp.Persona.Name,
+		Topic:    resp.Persona.Topic,
+		Prompt:   resp.Persona.Prompt,
+		Context:  resp.Persona.Context,
+		Rag:      resp.Persona.Rag,
+		Tags:     resp.Persona.Tags,
+		Version:  int(resp.Persona.Version),
+		ParentId: resp.Persona.ParentId,
 	}, nil
 }
 
 func (g *GRPCClient) List() ([]types.Persona, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := g.rpcContext()
 	defer cancel()
+	return g.ListCtx(ctx)
+}
 
+func (g *GRPCClient) ListCtx(ctx context.Context) ([]types.Persona, error) {
 	req := &pb.ListPersonasRequest{}
 
 	resp, err := g.client.ListPersonas(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list personas: %v", err)
+		return nil, fmt.Errorf("failed to list personas: %w", err)
 	}
 
 	var personas []types.Persona
 	for _, p := range resp.Personas {
 		personas = append(personas, types.Persona{
-			Id:      p.Id,
-			Name:    p.Name,
-			Topic:   p.Topic,
-			Prompt:  p.Prompt,
-			Context: p.Context,
-			Rag:     p.Rag,
+			Id:       p.Id,
+			Name:     p.Name,
+			Topic:    p.Topic,
+			Prompt:   p.Prompt,
+			Context:  p.Context,
+			Rag:      p.Rag,
+			Tags:     p.Tags,
+			Version:  int(p.Version),
+			ParentId: p.ParentId,
 		})
 	}
 
 	return personas, nil
 }
 
+// StreamList receives personas one at a time and calls fn for each, without
+// holding the whole list in memory. It stops and returns the error if fn
+// fails.
+func (g *GRPCClient) StreamList(fn func(types.Persona) error) error {
+	return g.StreamListCtx(context.Background(), fn)
+}
+
+// StreamListCtx is StreamList with a caller-supplied context. No default
+// timeout applies, as a stream runs for as long as the list takes.
+func (g *GRPCClient) StreamListCtx(ctx context.Context, fn func(types.Persona) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := g.client.StreamPersonas(ctx, &pb.StreamPersonasRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to stream personas: %w", err)
+	}
+
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to stream personas: %w", err)
+		}
+		if err := fn(*types.ProtoToPersona(p)); err != nil {
+			return err
+		}
+	}
+}
+
 func (g *GRPCClient) Update(id string, p types.Persona) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := g.rpcContext()
 	defer cancel()
+	return g.UpdateCtx(ctx, id, p)
+}
 
+func (g *GRPCClient) UpdateCtx(ctx context.Context, id string, p types.Persona) error {
 	req := &pb.UpdatePersonaRequest{
 		Id: id,
 		Persona: &pb.Persona{
-			Name:    p.Name,
-			Topic:   p.Topic,
-			Prompt:  p.Prompt,
-			Context: p.Context,
-			Rag:     p.Rag,
+			Name:     p.Name,
+			Topic:    p.Topic,
+			Prompt:   p.Prompt,
+			Context:  p.Context,
+			Rag:      p.Rag,
+			Tags:     p.Tags,
+			Version:  int64(p.Version),
+			ParentId: p.ParentId,
 		},
 	}
 
 	_, err := g.client.UpdatePersona(ctx, req)
 	if err != nil {
-		return fmt.Errorf("failed to update persona: %v", err)
+		return fmt.Errorf("failed to update persona: %w", err)
 	}
 
 	return nil
 }
 
 func (g *GRPCClient) Delete(id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := g.rpcContext()
 	defer cancel()
+	return g.DeleteCtx(ctx, id)
+}
 
+func (g *GRPCClient) DeleteCtx(ctx context.Context, id string) error {
 	req := &pb.DeletePersonaRequest{Id: id}
 
 	_, err := g.client.DeletePersona(ctx, req)
 	if err != nil {
-		return fmt.Errorf("failed to delete persona: %v", err)
+		return fmt.Errorf("failed to delete persona: %w", err)
 	}
 
 	return nil
@@ -149,23 +329,26 @@ func (g *GRPCClient) Delete(id string) error {
 
 // Identity operations
 func (g *GRPCClient) CreateIdentity(i *types.Identity) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := g.rpcContext()
 	defer cancel()
+	return g.CreateIdentityCtx(ctx, i)
+}
 
+func (g *GRPCClient) CreateIdentityCtx(ctx context.Context, i *types.Identity) error {
 	req := &pb.CreateIdentityRequest{
 		Identity: &pb.Identity{
 			PersonaId:      i.PersonaId,
 			Name:           i.Name,
 			Description:    i.Description,
 			RichAttributes: i.RichAttributes,
-			IsActive:       i.IsActive,
+			IsActive:       proto.Bool(i.IsActive),
 			Tags:           i.Tags,
 		},
 	}
 
 	resp, err := g.client.CreateIdentity(ctx, req)
 	if err != nil {
-		return fmt.Errorf("failed to create identity: %v", err)
+		return fmt.Errorf("failed to create identity: %w", err)
 	}
 
 	// Update the identity with the returned ID
@@ -173,15 +356,163 @@ func (g *GRPCClient) CreateIdentity(i *types.Identity) error {
 	return nil
 }
 
+func (g *GRPCClient) CreateIdentitiesBatch(identities []*types.Identity) ([]string, error) {
+	ctx, cancel := g.batchContext()
+	defer cancel()
+	return g.CreateIdentitiesBatchCtx(ctx, identities)
+}
+
+func (g *GRPCClient) CreateIdentitiesBatchCtx(ctx context.Context, identities []*types.Identity) ([]string, error) {
+	req := &pb.BatchCreateIdentitiesRequest{
+		Identities: make([]*pb.Identity, len(identities)),
+	}
+	for idx, i := range identities {
+		if i == nil {
+			// Sent empty so the server reports it instead of failing the batch
+			req.Identities[idx] = &pb.Identity{}
+			continue
+		}
+		req.Identities[idx] = &pb.Identity{
+			PersonaId:      i.PersonaId,
+			Name:           i.Name,
+			Description:    i.Description,
+			RichAttributes: i.RichAttributes,
+			IsActive:       proto.Bool(i.IsActive),
+			Tags:           i.Tags,
+		}
+	}
+
+	resp, err := g.client.BatchCreateIdentities(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create identities: %w", err)
+	}
+
+	results := make([]types.IdentityBatchResult, len(resp.Results))
+	for idx, result := range resp.Results {
+		results[idx] = types.IdentityBatchResult{
+			Index: int(result.Index),
+			Id:    result.Id,
+			Error: result.Error,
+		}
+	}
+	return batchResults(identities, results)
+}
+
+// BatchMutate sends ops to the server in one BatchMutate call and returns
+// a result per operation. If any operation fails the server undoes the
+// others where it can, and an error naming the failure, and any operations
+// whose undo failed, is returned along with the results.
+func (g *GRPCClient) BatchMutate(ops []types.BatchOperation) ([]types.BatchOperationResult, error) {
+	ctx, cancel := g.batchContext()
+	defer cancel()
+	return g.BatchMutateCtx(ctx, ops)
+}
+
+func (g *GRPCClient) BatchMutateCtx(ctx context.Context, ops []types.BatchOperation) ([]types.BatchOperationResult, error) {
+	req := &pb.BatchMutateRequest{
+		Operations: make([]*pb.BatchOperation, len(ops)),
+	}
+	for idx, op := range ops {
+		converted, err := batchOperationToProto(op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", idx, err)
+		}
+		req.Operations[idx] = converted
+	}
+
+	resp, err := g.client.BatchMutate(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply batch: %w", err)
+	}
+
+	results := make([]types.BatchOperationResult, len(resp.Results))
+	for idx, result := range resp.Results {
+		results[idx] = types.BatchOperationResult{
+			Index:      int(result.Index),
+			Id:         result.Id,
+			Error:      result.Error,
+			RolledBack: result.RolledBack,
+			Skipped:    result.Skipped,
+		}
+	}
+	if !resp.Applied {
+		// The failed operation is the last one attempted; errors before it
+		// are undos that failed, leaving those operations applied
+		for i := len(results) - 1; i >= 0; i-- {
+			if results[i].Skipped || results[i].Error == "" {
+				continue
+			}
+			unreverted := 0
+			for _, earlier := range results[:i] {
+				if earlier.Error != "" {
+					unreverted++
+				}
+			}
+			if unreverted > 0 {
+				return results, fmt.Errorf("batch not applied: operation %d failed: %s; %d earlier operations could not be rolled back", results[i].Index, results[i].Error, unreverted)
+			}
+			return results, fmt.Errorf("batch not applied: operation %d failed: %s", results[i].Index, results[i].Error)
+		}
+		return results, fmt.Errorf("batch not applied")
+	}
+	return results, nil
+}
+
+// batchOperationToProto tags op with the request message of its kind
+func batchOperationToProto(op types.BatchOperation) (*pb.BatchOperation, error) {
+	switch op.Kind {
+	case types.BatchCreatePersona:
+		if op.Persona == nil {
+			return nil, fmt.Errorf("persona is required")
+		}
+		return &pb.BatchOperation{Op: &pb.BatchOperation_CreatePersona{
+			CreatePersona: &pb.CreatePersonaRequest{Persona: types.PersonaToProto(op.Persona)},
+		}}, nil
+	case types.BatchUpdatePersona:
+		if op.Persona == nil {
+			return nil, fmt.Errorf("persona is required")
+		}
+		return &pb.BatchOperation{Op: &pb.BatchOperation_UpdatePersona{
+			UpdatePersona: &pb.UpdatePersonaRequest{Id: op.Id, Persona: types.PersonaToProto(op.Persona)},
+		}}, nil
+	case types.BatchDeletePersona:
+		return &pb.BatchOperation{Op: &pb.BatchOperation_DeletePersona{
+			DeletePersona: &pb.DeletePersonaRequest{Id: op.Id},
+		}}, nil
+	case types.BatchCreateIdentity:
+		if op.Identity == nil {
+			return nil, fmt.Errorf("identity is required")
+		}
+		return &pb.BatchOperation{Op: &pb.BatchOperation_CreateIdentity{
+			CreateIdentity: &pb.CreateIdentityRequest{Identity: types.IdentityToProto(op.Identity)},
+		}}, nil
+	case types.BatchUpdateIdentity:
+		if op.Identity == nil {
+			return nil, fmt.Errorf("identity is required")
+		}
+		return &pb.BatchOperation{Op: &pb.BatchOperation_UpdateIdentity{
+			UpdateIdentity: &pb.UpdateIdentityRequest{Id: op.Id, Identity: types.IdentityToProto(op.Identity)},
+		}}, nil
+	case types.BatchDeleteIdentity:
+		return &pb.BatchOperation{Op: &pb.BatchOperation_DeleteIdentity{
+			DeleteIdentity: &pb.DeleteIdentityRequest{Id: op.Id},
+		}}, nil
+	}
+	return nil, fmt.Errorf("unknown batch operation %q", op.Kind)
+}
+
 func (g *GRPCClient) GetIdentity(id string) (types.Identity, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := g.rpcContext()
 	defer cancel()
+	return g.GetIdentityCtx(ctx, id)
+}
 
+func (g *GRPCClient) GetIdentityCtx(ctx context.Context, id string) (types.Identity, error) {
 	req := &pb.GetIdentityRequest{Id: id}
 
 	resp, err := g.client.GetIdentity(ctx, req)
 	if err != nil {
-		return types.Identity{}, fmt.Errorf("failed to get identity: %v", err)
+		return types.Identity{}, fmt.Errorf("failed to get identity: %w", err)
 	}
 
 	var createdAt, updatedAt time.Time
@@ -200,140 +531,128 @@ func (g *GRPCClient) GetIdentity(id string) (types.Identity, error) {
 		RichAttributes: resp.Identity.RichAttributes,
 		CreatedAt:      createdAt,
 		UpdatedAt:      updatedAt,
-		IsActive:       resp.Identity.IsActive,
+		IsActive:       resp.Identity.GetIsActive(),
 		Tags:           resp.Identity.Tags,
 	}, nil
 }
 
 func (g *GRPCClient) ListIdentities(filter *types.IdentityFilter) ([]types.Identity, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := g.rpcContext()
 	defer cancel()
+	return g.ListIdentitiesCtx(ctx, filter)
+}
 
-	var pbFilter *pb.IdentityFilter
-	if filter != nil {
-		pbFilter = &pb.IdentityFilter{
-			PersonaId: filter.PersonaID,
-			Tags:      filter.Tags,
-			Search:    filter.Search,
-		}
-		if filter.IsActive != nil {
-			pbFilter.IsActive = *filter.IsActive
-		}
-	}
-
-	req := &pb.ListIdentitiesRequest{Filter: pbFilter}
+func (g *GRPCClient) ListIdentitiesCtx(ctx context.Context, filter *types.IdentityFilter) ([]types.Identity, error) {
+	req := &pb.ListIdentitiesRequest{Filter: types.IdentityFilterToProto(filter)}
 
 	resp, err := g.client.ListIdentities(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list identities: %v", err)
+		return nil, fmt.Errorf("failed to list identities: %w", err)
 	}
 
-	var identities []types.Identity
+	identities := make([]types.Identity, 0, len(resp.Identities))
 	for _, i := range resp.Identities {
-		var createdAt, updatedAt time.Time
-		if i.CreatedAt != nil {
-			createdAt = i.CreatedAt.AsTime()
-		}
-		if i.UpdatedAt != nil {
-			updatedAt = i.UpdatedAt.AsTime()
-		}
-
-		identities = append(identities, types.Identity{
-			Id:             i.Id,
-			PersonaId:      i.PersonaId,
-			Name:           i.Name,
-			Description:    i.Description,
-			RichAttributes: i.RichAttributes,
-			CreatedAt:      createdAt,
-			UpdatedAt:      updatedAt,
-			IsActive:       i.IsActive,
-			Tags:           i.Tags,
-		})
+		identities = append(identities, *types.ProtoToIdentity(i))
 	}
 
 	return identities, nil
 }
 
 func (g *GRPCClient) UpdateIdentity(id string, i types.Identity) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := g.rpcContext()
 	defer cancel()
+	return g.UpdateIdentityCtx(ctx, id, i)
+}
 
+func (g *GRPCClient) UpdateIdentityCtx(ctx context.Context, id string, i types.Identity) error {
 	req := &pb.UpdateIdentityRequest{
-		Id: id,
-		Identity: &pb.Identity{
-			PersonaId:      i.PersonaId,
-			Name:           i.Name,
-			Description:    i.Description,
-			RichAttributes: i.RichAttributes,
-			IsActive:       i.IsActive,
-			Tags:           i.Tags,
-		},
+		Id:       id,
+		Identity: types.IdentityToProto(&i),
 	}
 
 	_, err := g.client.UpdateIdentity(ctx, req)
 	if err != nil {
-		return fmt.Errorf("failed to update identity: %v", err)
+		return fmt.Errorf("failed to update identity: %w", err)
 	}
 
 	return nil
 }
 
 func (g *GRPCClient) DeleteIdentity(id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := g.rpcContext()
 	defer cancel()
+	return g.DeleteIdentityCtx(ctx, id)
+}
 
+func (g *GRPCClient) DeleteIdentityCtx(ctx context.Context, id string) error {
 	req := &pb.DeleteIdentityRequest{Id: id}
 
 	_, err := g.client.DeleteIdentity(ctx, req)
 	if err != nil {
-		return fmt.Errorf("failed to delete identity: %v", err)
+		return fmt.Errorf("failed to delete identity: %w", err)
 	}
 
 	return nil
 }
 
 func (g *GRPCClient) GetIdentityWithPersona(id string) (types.IdentityWithPersona, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := g.rpcContext()
 	defer cancel()
+	return g.GetIdentityWithPersonaCtx(ctx, id)
+}
 
+func (g *GRPCClient) GetIdentityWithPersonaCtx(ctx context.Context, id string) (types.IdentityWithPersona, error) {
 	req := &pb.GetIdentityWithPersonaRequest{Id: id}
 
 	resp, err := g.client.GetIdentityWithPersona(ctx, req)
 	if err != nil {
-		return types.IdentityWithPersona{}, fmt.Errorf("failed to get identity with persona: %v", err)
+		return types.IdentityWithPersona{}, fmt.Errorf("failed to get identity with persona: %w", err)
 	}
-
-	var createdAt, updatedAt time.Time
-	if resp.IdentityWithPersona.Identity.CreatedAt != nil {
-		createdAt = resp.IdentityWithPersona.Identity.CreatedAt.AsTime()
-	}
-	if resp.IdentityWithPersona.Identity.UpdatedAt != nil {
-		updatedAt = resp.IdentityWithPersona.Identity.UpdatedAt.AsTime()
+	if resp.IdentityWithPersona == nil || resp.IdentityWithPersona.Identity == nil || resp.IdentityWithPersona.Persona == nil {
+		return types.IdentityWithPersona{}, fmt.Errorf("failed to get identity with persona: incomplete response")
 	}
 
-	identity := types.Identity{
-		Id:             resp.IdentityWithPersona.Identity.Id,
-		PersonaId:      resp.IdentityWithPersona.Identity.PersonaId,
-		Name:           resp.IdentityWithPersona.Identity.Name,
-		Description:    resp.IdentityWithPersona.Identity.Description,
-		RichAttributes: resp.IdentityWithPersona.Identity.RichAttributes,
-		CreatedAt:      createdAt,
-		UpdatedAt:      updatedAt,
-		IsActive:       resp.IdentityWithPersona.Identity.IsActive,
-		Tags:           resp.IdentityWithPersona.Identity.Tags,
-	}
+	return types.IdentityWithPersona{
+		Identity: *types.ProtoToIdentity(resp.IdentityWithPersona.Identity),
+		Persona:  *types.ProtoToPersona(resp.IdentityWithPersona.Persona),
+	}, nil
+}
+
+// GetCommunityStats fetches analytics for a community
+func (g *GRPCClient) GetCommunityStats(id string) (*types.CommunityStats, error) {
+	ctx, cancel := g.rpcContext()
+	defer cancel()
+	return g.GetCommunityStatsCtx(ctx, id)
+}
+
+func (g *GRPCClient) GetCommunityStatsCtx(ctx context.Context, id string) (*types.CommunityStats, error) {
+	req := &pb.GetCommunityStatsRequest{Id: id}
 
-	persona := types.Persona{
-		Id:      resp.IdentityWithPersona.Persona.Id,
-		Name:    resp.IdentityWithPersona.Persona.Name,
-		Topic:   resp.IdentityWithPersona.Persona.Topic,
-		Prompt:  resp.IdentityWithPersona.Persona.Prompt,
-		Context: resp.IdentityWithPersona.Persona.Context,
-		Rag:     resp.IdentityWithPersona.Persona.Rag,
+	resp, err := g.client.GetCommunityStats(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get community stats: %w", err)
 	}
 
-	return types.IdentityWithPersona{
-		Identity: identity,
-		Persona:  persona,
-	}, nil
+	return types.ProtoToCommunityStats(resp.Stats), nil
+}
+
+// Community CRUD operations are not exposed by the gRPC service
+func (g *GRPCClient) CreateCommunity(c *types.Community) error {
+	return unsupported("create community", "grpc")
+}
+
+func (g *GRPCClient) GetCommunity(id string) (types.Community, error) {
+	return types.Community{}, unsupported("get community", "grpc")
+}
+
+func (g *GRPCClient) ListCommunities(filter *types.CommunityFilter) ([]types.Community, error) {
+	return nil, unsupported("list communities", "grpc")
+}
+
+func (g *GRPCClient) UpdateCommunity(id string, c types.Community) error {
+	return unsupported("update community", "grpc")
+}
+
+func (g *GRPCClient) DeleteCommunity(id string) error {
+	return unsupported("delete community", "grpc")
 }
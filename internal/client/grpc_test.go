@@ -1,8 +1,27 @@
 package client
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
 	"testing"
+	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/community"
+	aipgrpc "github.com/fr0g-vibe/fr0g-ai-aip/internal/grpc"
+	pb "github.com/fr0g-vibe/fr0g-ai-aip/internal/grpc/pb"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/persona"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
 )
 
@@ -47,3 +66,385 @@ func TestGRPCClient_Methods(t *testing.T) {
 	_ = client.Update("test-id", *p)
 	_ = client.Delete("test-id")
 }
+
+func TestGRPCClient_CommunityUnsupported(t *testing.T) {
+	client, err := NewGRPCClient("localhost:9090")
+	if err != nil {
+		t.Fatalf("Failed to create gRPC client: %v", err)
+	}
+	defer client.Close()
+	
+	c := &types.Community{Name: "Test", Type: "interest"}
+	
+	errs := map[string]error{
+		"create": client.CreateCommunity(c),
+		"update": client.UpdateCommunity("test-id", *c),
+		"delete": client.DeleteCommunity("test-id"),
+	}
+	_, errs["get"] = client.GetCommunity("test-id")
+	_, errs["list"] = client.ListCommunities(nil)
+	
+	for op, err := range errs {
+		if !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Expected %s community to be unsupported, got %v", op, err)
+		}
+	}
+}
+
+func TestGRPCClient_StreamList(t *testing.T) {
+	service := persona.NewService(storage.NewMemoryStorage())
+	const count = 10
+	for i := 0; i < count; i++ {
+		if err := service.CreatePersona(&types.Persona{
+			Name:   fmt.Sprintf("Persona %d", i),
+			Topic:  "Streaming",
+			Prompt: "Stream prompt",
+		}); err != nil {
+			t.Fatalf("Failed to create persona: %v", err)
+		}
+	}
+	
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	pb.RegisterPersonaServiceServer(server, aipgrpc.NewPersonaServer(nil, service))
+	go server.Serve(lis)
+	defer server.Stop()
+	
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	client := &GRPCClient{conn: conn, client: pb.NewPersonaServiceClient(conn)}
+	defer client.Close()
+	
+	streamed := 0
+	err = client.StreamList(func(p types.Persona) error {
+		if p.Id == "" || p.Topic != "Streaming" {
+			t.Errorf("Unexpected streamed persona: %+v", p)
+		}
+		streamed++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamList failed: %v", err)
+	}
+	if streamed != count {
+		t.Errorf("Expected %d streamed personas, got %d", count, streamed)
+	}
+	
+	// An error from the callback stops the stream and is returned as-is
+	stop := errors.New("stop")
+	received := 0
+	err = client.StreamList(func(types.Persona) error {
+		received++
+		return stop
+	})
+	if err != stop {
+		t.Errorf("Expected callback error, got %v", err)
+	}
+	if received != 1 {
+		t.Errorf("Expected streaming to stop after 1 persona, got %d", received)
+	}
+}
+
+func TestGRPCClient_CheckHealth(t *testing.T) {
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(lis)
+	defer server.Stop()
+	
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	client := &GRPCClient{conn: conn, client: pb.NewPersonaServiceClient(conn)}
+	defer client.Close()
+	
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	if err := client.CheckHealth(); err != nil {
+		t.Errorf("Expected a healthy server, got %v", err)
+	}
+	
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	if err := client.CheckHealth(); err == nil {
+		t.Error("Expected an error when the server is not serving")
+	}
+}
+
+func TestGRPCClient_Timeout(t *testing.T) {
+	service := persona.NewService(storage.NewMemoryStorage())
+	
+	// Hold every call until the client gives up
+	slow := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-time.After(time.Second):
+			return handler(ctx, req)
+		}
+	}
+	
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.UnaryInterceptor(slow))
+	pb.RegisterPersonaServiceServer(server, aipgrpc.NewPersonaServer(nil, service))
+	go server.Serve(lis)
+	defer server.Stop()
+	
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	client := &GRPCClient{conn: conn, client: pb.NewPersonaServiceClient(conn)}
+	WithTimeout(20 * time.Millisecond)(client)
+	defer client.Close()
+	
+	start := time.Now()
+	_, err = client.Get("any")
+	if code := status.Code(err); code != codes.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v (%v)", code, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the configured timeout to apply, call took %v", elapsed)
+	}
+	
+	// A caller-supplied context is used as is
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.ListCtx(ctx); status.Code(err) != codes.Canceled {
+		t.Errorf("Expected Canceled for a cancelled context, got %v", err)
+	}
+}
+
+func TestGRPCClient_GetCommunityStats(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	service := persona.NewService(store)
+	if err := service.CreatePersona(&types.Persona{Name: "Resident", Topic: "Community", Prompt: "You live here."}); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	config := types.CommunityGenerationConfig{
+		AgeDistribution:    types.AgeDistribution{Mean: 40, StdDev: 15, MinAge: 18, MaxAge: 80},
+		LocationConstraint: types.LocationConstraint{Type: "global"},
+		PoliticalSpread:    0.8,
+		InterestSpread:     0.8,
+		SocioeconomicRange: 0.8,
+		ActivityLevel:      0.5,
+	}
+	generated, err := community.NewService(store).GenerateCommunity(config, "Town", "A generated town", "geographic", 12)
+	if err != nil {
+		t.Fatalf("Failed to generate community: %v", err)
+	}
+	
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	pb.RegisterPersonaServiceServer(server, aipgrpc.NewPersonaServer(nil, service))
+	go server.Serve(lis)
+	defer server.Stop()
+	
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	client := &GRPCClient{conn: conn, client: pb.NewPersonaServiceClient(conn)}
+	defer client.Close()
+	
+	stats, err := client.GetCommunityStats(generated.Id)
+	if err != nil {
+		t.Fatalf("GetCommunityStats failed: %v", err)
+	}
+	if stats.CommunityId != generated.Id {
+		t.Errorf("Expected stats for %s, got %s", generated.Id, stats.CommunityId)
+	}
+	if stats.MemberCount != 12 {
+		t.Errorf("Expected 12 members, got %d", stats.MemberCount)
+	}
+	if stats.AverageAge < 18 || stats.AverageAge > 80 {
+		t.Errorf("Expected average age within the distribution bounds, got %.1f", stats.AverageAge)
+	}
+	if len(stats.GenderRatio) == 0 || len(stats.LocationSpread) == 0 {
+		t.Errorf("Expected gender ratio and location spread, got %+v", stats)
+	}
+	if stats.GeneratedAt.IsZero() {
+		t.Error("Expected generated_at to be set")
+	}
+	
+	if _, err := client.GetCommunityStats("missing"); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for a missing community, got %v", err)
+	}
+}
+
+// newBufconnClient serves service over an in-memory gRPC connection and
+// returns a client for it
+func newBufconnClient(t *testing.T, service *persona.Service) *GRPCClient {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	pb.RegisterPersonaServiceServer(server, aipgrpc.NewPersonaServer(nil, service))
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	client := &GRPCClient{conn: conn, client: pb.NewPersonaServiceClient(conn)}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestGRPCClient_Identities(t *testing.T) {
+	service := persona.NewService(storage.NewMemoryStorage())
+	p := types.Persona{Name: "Resident", Topic: "Community", Prompt: "You live here."}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	other := types.Persona{Name: "Visitor", Topic: "Community", Prompt: "You are passing through."}
+	if err := service.CreatePersona(&other); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	
+	demographics := func(age int32, city string) *types.RichAttributes {
+		return &types.RichAttributes{Demographics: &types.Demographics{Age: age, Location: &types.Location{City: city}}}
+	}
+	ann := types.Identity{PersonaId: p.Id, Name: "Ann", IsActive: true, Tags: []string{"local"}, Background: "Grew up here", RichAttributes: demographics(34, "Seattle")}
+	ben := types.Identity{PersonaId: p.Id, Name: "Ben", IsActive: false, RichAttributes: demographics(61, "Portland")}
+	cat := types.Identity{PersonaId: other.Id, Name: "Cat", IsActive: true, RichAttributes: demographics(45, "Seattle")}
+	for _, i := range []*types.Identity{&ann, &ben, &cat} {
+		if err := service.CreateIdentity(i); err != nil {
+			t.Fatalf("Failed to create identity: %v", err)
+		}
+	}
+	
+	client := newBufconnClient(t, service)
+	
+	// Filters are applied by the server
+	active, inactive := true, false
+	minAge, maxAge := 40, 50
+	tests := []struct {
+		name   string
+		filter *types.IdentityFilter
+		want   []string
+	}{
+		{"no filter", nil, []string{"Ann", "Ben", "Cat"}},
+		{"persona only", &types.IdentityFilter{PersonaID: p.Id}, []string{"Ann", "Ben"}},
+		{"active", &types.IdentityFilter{IsActive: &active}, []string{"Ann", "Cat"}},
+		{"inactive", &types.IdentityFilter{PersonaID: p.Id, IsActive: &inactive}, []string{"Ben"}},
+		{"tags", &types.IdentityFilter{Tags: []string{"local"}}, []string{"Ann"}},
+		{"min age", &types.IdentityFilter{MinAge: &minAge}, []string{"Ben", "Cat"}},
+		{"age range", &types.IdentityFilter{MinAge: &minAge, MaxAge: &maxAge}, []string{"Cat"}},
+		{"max age", &types.IdentityFilter{MaxAge: &maxAge}, []string{"Ann", "Cat"}},
+		{"city", &types.IdentityFilter{City: "seattle"}, []string{"Ann", "Cat"}},
+	}
+	for _, tt := range tests {
+		identities, err := client.ListIdentities(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: ListIdentities failed: %v", tt.name, err)
+		}
+		var names []string
+		for _, i := range identities {
+			names = append(names, i.Name)
+		}
+		slices.Sort(names)
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, names)
+		}
+	}
+	
+	// Updates send every field, including rich attributes, and nothing is lost
+	// on the way back
+	ann.Description = "Updated over gRPC"
+	ann.RichAttributes = demographics(35, "Tacoma")
+	if err := client.UpdateIdentity(ann.Id, ann); err != nil {
+		t.Fatalf("UpdateIdentity failed: %v", err)
+	}
+	withPersona, err := client.GetIdentityWithPersona(ann.Id)
+	if err != nil {
+		t.Fatalf("GetIdentityWithPersona failed: %v", err)
+	}
+	got := withPersona.Identity
+	if got.Description != "Updated over gRPC" || got.Background != "Grew up here" || !slices.Equal(got.Tags, []string{"local"}) {
+		t.Errorf("Expected the update to keep every field, got %+v", got)
+	}
+	if dem := got.RichAttributes.GetDemographics(); dem.GetAge() != 35 || dem.GetLocation().GetCity() != "Tacoma" {
+		t.Errorf("Expected updated demographics, got %+v", dem)
+	}
+	if got.CreatedAt.IsZero() || got.UpdatedAt.IsZero() {
+		t.Errorf("Expected timestamps to be returned, got %+v", got)
+	}
+	if withPersona.Persona.Id != p.Id || withPersona.Persona.Name != "Resident" {
+		t.Errorf("Expected the identity's persona, got %+v", withPersona.Persona)
+	}
+	
+	if err := client.DeleteIdentity(ben.Id); err != nil {
+		t.Fatalf("DeleteIdentity failed: %v", err)
+	}
+	if _, err := service.GetIdentity(ben.Id); err == nil {
+		t.Error("Expected the deleted identity to be gone")
+	}
+	
+	// Missing identities come back as NotFound
+	if err := client.DeleteIdentity(ben.Id); status.Code(errors.Unwrap(err)) != codes.NotFound {
+		t.Errorf("Expected NotFound deleting a missing identity, got %v", err)
+	}
+	if _, err := client.GetIdentityWithPersona("missing"); status.Code(errors.Unwrap(err)) != codes.NotFound {
+		t.Errorf("Expected NotFound for a missing identity, got %v", err)
+	}
+	if err := client.UpdateIdentity("missing", cat); status.Code(errors.Unwrap(err)) != codes.NotFound {
+		t.Errorf("Expected NotFound updating a missing identity, got %v", err)
+	}
+}
+
+func TestGRPCClient_BatchMutate(t *testing.T) {
+	service := persona.NewService(storage.NewMemoryStorage())
+	old := types.Persona{Name: "Retired", Topic: "Sync", Prompt: "You are being replaced."}
+	if err := service.CreatePersona(&old); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	
+	client := newBufconnClient(t, service)
+	
+	results, err := client.BatchMutate([]types.BatchOperation{
+		{Kind: types.BatchCreatePersona, Persona: &types.Persona{Name: "Replacement", Topic: "Sync", Prompt: "You replace the old one."}},
+		{Kind: types.BatchDeletePersona, Id: old.Id},
+	})
+	if err != nil {
+		t.Fatalf("BatchMutate failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Id == "" || results[1].Id != old.Id {
+		t.Fatalf("Expected a result per operation, got %+v", results)
+	}
+	if created, err := service.GetPersona(results[0].Id); err != nil || created.Name != "Replacement" {
+		t.Errorf("Expected the created persona to be stored, got %+v, %v", created, err)
+	}
+	if _, err := service.GetPersona(old.Id); err == nil {
+		t.Error("Expected the deleted persona to be gone")
+	}
+	
+	// A failing operation undoes the create before it and skips the rest
+	results, err = client.BatchMutate([]types.BatchOperation{
+		{Kind: types.BatchCreatePersona, Persona: &types.Persona{Name: "Doomed", Topic: "Sync", Prompt: "You will not last."}},
+		{Kind: types.BatchDeletePersona, Id: old.Id},
+		{Kind: types.BatchDeletePersona, Id: results[0].Id},
+	})
+	if err == nil {
+		t.Fatal("Expected an error for a batch with a failing operation")
+	}
+	if len(results) != 3 || !results[0].RolledBack || results[1].Error == "" || !results[2].Skipped {
+		t.Errorf("Expected the first operation rolled back, the second failed and the third skipped, got %+v", results)
+	}
+	personas, _ := service.ListPersonas()
+	if len(personas) != 1 || personas[0].Name != "Replacement" {
+		t.Errorf("Expected only the earlier batch's persona to remain, got %+v", personas)
+	}
+}
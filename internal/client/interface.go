@@ -1,6 +1,69 @@
 package client
 
-import "github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// ErrUnsupported is returned by client methods whose operation is not
+// available over the client's transport.
+var ErrUnsupported = errors.New("unsupported by this transport")
+
+// unsupported builds an ErrUnsupported error naming the operation and transport
+func unsupported(operation, transport string) error {
+	return fmt.Errorf("%s: %w (%s)", operation, ErrUnsupported, transport)
+}
+
+// BatchError reports the items of a batch operation that failed, keyed by
+// their index in the request
+type BatchError struct {
+	Total    int
+	Failures map[int]string
+}
+
+func (e *BatchError) Error() string {
+	indexes := make([]int, 0, len(e.Failures))
+	for i := range e.Failures {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	first := indexes[0]
+	return fmt.Sprintf("%d of %d items failed (item %d: %s)", len(e.Failures), e.Total, first, e.Failures[first])
+}
+
+// batchResults turns per-item results into IDs aligned with the request,
+// assigning IDs to the created identities. Failed items get an empty ID and
+// are reported through a *BatchError.
+func batchResults(identities []*types.Identity, results []types.IdentityBatchResult) ([]string, error) {
+	ids := make([]string, len(identities))
+	failures := make(map[int]string)
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= len(identities) {
+			continue
+		}
+		if result.Error != "" {
+			failures[result.Index] = result.Error
+			continue
+		}
+		ids[result.Index] = result.Id
+		if identities[result.Index] != nil {
+			identities[result.Index].Id = result.Id
+		}
+	}
+	for i := range identities {
+		if ids[i] == "" && failures[i] == "" {
+			failures[i] = "no result returned"
+		}
+	}
+
+	if len(failures) > 0 {
+		return ids, &BatchError{Total: len(identities), Failures: failures}
+	}
+	return ids, nil
+}
 
 // Client defines the interface for persona service clients
 type Client interface {
@@ -14,9 +77,33 @@ type Client interface {
 
 	// Identity operations
 	CreateIdentity(i *types.Identity) error
+	CreateIdentitiesBatch(identities []*types.Identity) ([]string, error)
 	GetIdentity(id string) (types.Identity, error)
 	ListIdentities(filter *types.IdentityFilter) ([]types.Identity, error)
 	UpdateIdentity(id string, i types.Identity) error
 	DeleteIdentity(id string) error
 	GetIdentityWithPersona(id string) (types.IdentityWithPersona, error)
+
+	// Community operations
+	CreateCommunity(c *types.Community) error
+	GetCommunity(id string) (types.Community, error)
+	ListCommunities(filter *types.CommunityFilter) ([]types.Community, error)
+	UpdateCommunity(id string, c types.Community) error
+	DeleteCommunity(id string) error
 }
+
+// IdempotentIdentityCreator is implemented by clients that can send an
+// idempotency key with an identity create, so a create that is sent again
+// after an ambiguous failure cannot add a second identity
+type IdempotentIdentityCreator interface {
+	CreateIdentityWithKey(i *types.Identity, key string) error
+}
+
+// Compile-time checks that every transport implements the full interface
+var (
+	_ Client = (*LocalClient)(nil)
+	_ Client = (*RESTClient)(nil)
+	_ Client = (*GRPCClient)(nil)
+
+	_ IdempotentIdentityCreator = (*RESTClient)(nil)
+)
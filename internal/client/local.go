@@ -63,6 +63,45 @@ func (l *LocalClient) GetIdentityWithPersona(id string) (types.IdentityWithPerso
 	return l.storage.GetIdentityWithPersona(id)
 }
 
+// CreateIdentitiesBatch creates each identity in turn, reporting failures per item
+func (l *LocalClient) CreateIdentitiesBatch(identities []*types.Identity) ([]string, error) {
+	results := make([]types.IdentityBatchResult, len(identities))
+	for idx, i := range identities {
+		results[idx].Index = idx
+		if i == nil {
+			results[idx].Error = "identity cannot be nil"
+			continue
+		}
+		if err := l.storage.CreateIdentity(i); err != nil {
+			results[idx].Error = err.Error()
+			continue
+		}
+		results[idx].Id = i.Id
+	}
+	return batchResults(identities, results)
+}
+
+// Community operations
+func (l *LocalClient) CreateCommunity(c *types.Community) error {
+	return l.storage.CreateCommunity(c)
+}
+
+func (l *LocalClient) GetCommunity(id string) (types.Community, error) {
+	return l.storage.GetCommunity(id)
+}
+
+func (l *LocalClient) ListCommunities(filter *types.CommunityFilter) ([]types.Community, error) {
+	return l.storage.ListCommunities(filter)
+}
+
+func (l *LocalClient) UpdateCommunity(id string, c types.Community) error {
+	return l.storage.UpdateCommunity(id, c)
+}
+
+func (l *LocalClient) DeleteCommunity(id string) error {
+	return l.storage.DeleteCommunity(id)
+}
+
 func (l *LocalClient) Close() error {
 	// Local client doesn't need cleanup
 	return nil
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
@@ -121,3 +122,77 @@ func TestLocalClient_GetNotFound(t *testing.T) {
 		t.Error("Expected error for nonexistent persona")
 	}
 }
+
+func TestLocalClient_CommunityCRUD(t *testing.T) {
+	client := NewLocalClient(storage.NewMemoryStorage())
+	
+	c := &types.Community{
+		Name: "Local Community",
+		Type: "interest",
+		Tags: []string{"test"},
+	}
+	if err := client.CreateCommunity(c); err != nil {
+		t.Fatalf("CreateCommunity failed: %v", err)
+	}
+	if c.Id == "" {
+		t.Fatal("Expected community ID to be generated")
+	}
+	
+	got, err := client.GetCommunity(c.Id)
+	if err != nil {
+		t.Fatalf("GetCommunity failed: %v", err)
+	}
+	if got.Name != c.Name {
+		t.Errorf("Expected name %s, got %s", c.Name, got.Name)
+	}
+	
+	got.Description = "Updated"
+	if err := client.UpdateCommunity(c.Id, got); err != nil {
+		t.Fatalf("UpdateCommunity failed: %v", err)
+	}
+	
+	communities, err := client.ListCommunities(&types.CommunityFilter{Type: "interest"})
+	if err != nil {
+		t.Fatalf("ListCommunities failed: %v", err)
+	}
+	if len(communities) != 1 || communities[0].Description != "Updated" {
+		t.Errorf("Expected one updated community, got %+v", communities)
+	}
+	
+	if err := client.DeleteCommunity(c.Id); err != nil {
+		t.Fatalf("DeleteCommunity failed: %v", err)
+	}
+	if _, err := client.GetCommunity(c.Id); err == nil {
+		t.Error("Expected error getting deleted community")
+	}
+}
+
+func TestLocalClient_CreateIdentitiesBatch(t *testing.T) {
+	client := NewLocalClient(storage.NewMemoryStorage())
+	
+	p := &types.Persona{Name: "Batch Persona", Topic: "Testing", Prompt: "You test batches"}
+	if err := client.Create(p); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	
+	identities := []*types.Identity{
+		{PersonaId: p.Id, Name: "First"},
+		nil,
+		{PersonaId: p.Id, Name: "Second"},
+	}
+	ids, err := client.CreateIdentitiesBatch(identities)
+	
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Expected *BatchError, got %v", err)
+	}
+	if batchErr.Total != 3 || len(batchErr.Failures) != 1 || batchErr.Failures[1] == "" {
+		t.Errorf("Expected only item 1 to fail, got %+v", batchErr)
+	}
+	if len(ids) != 3 || ids[0] == "" || ids[1] != "" || ids[2] == "" {
+		t.Errorf("Expected IDs for items 0 and 2, got %v", ids)
+	}
+	if identities[0].Id != ids[0] {
+		t.Errorf("Expected identity ID %s to be assigned, got %s", ids[0], identities[0].Id)
+	}
+}
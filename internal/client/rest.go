@@ -3,26 +3,133 @@ package client
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
 )
 
-// RESTClient implements REST API client for persona and identity service
+// Retry defaults used by NewRESTClient
+const (
+	DefaultMaxRetries = 3
+	DefaultRetryDelay = 100 * time.Millisecond
+)
+
+// maxRetryDelay caps the backoff between two attempts
+const maxRetryDelay = 5 * time.Second
+
+// RESTClient implements REST API client for persona and identity service.
+//
+// Idempotent operations (gets, lists, updates and deletes) are retried with
+// exponential backoff and jitter when the server cannot be reached or
+// answers 502, 503 or 504, e.g. while it restarts. Other errors, including
+// every 4xx response, are returned straight away, and creates are never
+// retried.
 type RESTClient struct {
-	baseURL string
-	client  *http.Client
+	baseURL    string
+	client     *http.Client
+	maxRetries int
+	retryDelay time.Duration
+}
+
+// RESTClientOptions configures a RESTClient
+type RESTClientOptions struct {
+	// MaxRetries is how many times a failed idempotent request is retried.
+	// Zero disables retries.
+	MaxRetries int
+
+	// BaseDelay is the wait before the first retry. It doubles for each
+	// further retry, up to 5s, and is randomized by up to half to spread
+	// out clients retrying together. Non-positive values use
+	// DefaultRetryDelay.
+	BaseDelay time.Duration
 }
 
-// NewRESTClient creates a new REST client
+// NewRESTClient creates a new REST client that retries up to
+// DefaultMaxRetries times
 func NewRESTClient(baseURL string) *RESTClient {
-	return &RESTClient{
-		baseURL: baseURL,
-		client:  &http.Client{},
+	return NewRESTClientWithOptions(baseURL, RESTClientOptions{
+		MaxRetries: DefaultMaxRetries,
+		BaseDelay:  DefaultRetryDelay,
+	})
+}
+
+// NewRESTClientWithOptions creates a new REST client with the given retry
+// settings
+func NewRESTClientWithOptions(baseURL string, opts RESTClientOptions) *RESTClient {
+	r := &RESTClient{
+		baseURL:    baseURL,
+		client:     &http.Client{},
+		maxRetries: max(opts.MaxRetries, 0),
+		retryDelay: opts.BaseDelay,
+	}
+	if r.retryDelay <= 0 {
+		r.retryDelay = DefaultRetryDelay
 	}
+	return r
+}
+
+// doIdempotent sends a request that is safe to repeat, retrying it while
+// the failure is transient. A JSON body, if any, is resent on every attempt.
+// After the last attempt the final response or error is returned as is.
+func (r *RESTClient) doIdempotent(method, target string, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, target, reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := r.client.Do(req)
+		if attempt >= r.maxRetries || !retryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		time.Sleep(r.backoff(attempt))
+	}
+}
+
+// retryable reports whether a request failed in a way a later attempt may
+// not: the connection failed or a gateway or overloaded server answered
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var opErr *net.OpError
+		return errors.As(err, &opErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the wait before retry number attempt+1: the base delay
+// doubled attempt times, capped at maxRetryDelay, less a random jitter of
+// up to half
+func (r *RESTClient) backoff(attempt int) time.Duration {
+	delay := r.retryDelay
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxRetryDelay)
+	return delay - time.Duration(rand.Int63n(int64(delay)/2+1))
 }
 
 // Persona operations
@@ -47,7 +154,7 @@ func (r *RESTClient) Create(p *types.Persona) error {
 }
 
 func (r *RESTClient) Get(id string) (types.Persona, error) {
-	resp, err := r.client.Get(r.baseURL + "/personas/" + id)
+	resp, err := r.doIdempotent(http.MethodGet, r.baseURL+"/personas/"+id, nil)
 	if err != nil {
 		return types.Persona{}, fmt.Errorf("failed to get persona: %v", err)
 	}
@@ -66,7 +173,7 @@ func (r *RESTClient) Get(id string) (types.Persona, error) {
 }
 
 func (r *RESTClient) List() ([]types.Persona, error) {
-	resp, err := r.client.Get(r.baseURL + "/personas")
+	resp, err := r.doIdempotent(http.MethodGet, r.baseURL+"/personas", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list personas: %v", err)
 	}
@@ -90,13 +197,7 @@ func (r *RESTClient) Update(id string, p types.Persona) error {
 		return fmt.Errorf("failed to marshal persona: %v", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPut, r.baseURL+"/personas/"+id, bytes.NewBuffer(data))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := r.client.Do(req)
+	resp, err := r.doIdempotent(http.MethodPut, r.baseURL+"/personas/"+id, data)
 	if err != nil {
 		return fmt.Errorf("failed to update persona: %v", err)
 	}
@@ -111,12 +212,7 @@ func (r *RESTClient) Update(id string, p types.Persona) error {
 }
 
 func (r *RESTClient) Delete(id string) error {
-	req, err := http.NewRequest(http.MethodDelete, r.baseURL+"/personas/"+id, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-
-	resp, err := r.client.Do(req)
+	resp, err := r.doIdempotent(http.MethodDelete, r.baseURL+"/personas/"+id, nil)
 	if err != nil {
 		return fmt.Errorf("failed to delete persona: %v", err)
 	}
@@ -130,28 +226,74 @@ func (r *RESTClient) Delete(id string) error {
 }
 
 // Identity operations
+// identityPayload sends is_active explicitly, since the identity's own JSON
+// omits it when false and the server treats a missing field as active
+type identityPayload struct {
+	*types.Identity
+	IsActive bool `json:"is_active"`
+}
+
+func newIdentityPayload(i *types.Identity) *identityPayload {
+	if i == nil {
+		return nil
+	}
+	return &identityPayload{Identity: i, IsActive: i.IsActive}
+}
+
 func (r *RESTClient) CreateIdentity(i *types.Identity) error {
-	data, err := json.Marshal(i)
+	return r.CreateIdentityWithKey(i, "")
+}
+
+// CreateIdentityWithKey creates an identity, sending key as the
+// Idempotency-Key header unless it is empty. The server answers a repeated
+// key with the identity it created the first time.
+func (r *RESTClient) CreateIdentityWithKey(i *types.Identity, key string) error {
+	data, err := json.Marshal(newIdentityPayload(i))
 	if err != nil {
 		return fmt.Errorf("failed to marshal identity: %v", err)
 	}
 
-	resp, err := r.client.Post(r.baseURL+"/identities", "application/json", bytes.NewBuffer(data))
+	req, err := http.NewRequest(http.MethodPost, r.baseURL+"/identities", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	resp, err := r.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to create identity: %v", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to create identity: %s", string(body))
+	// A replayed key answers 200 with the identity created before
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return statusError("failed to create identity", resp)
 	}
 
 	return json.NewDecoder(resp.Body).Decode(i)
 }
 
+// statusError builds the error for an unexpected response. 400, 404 and 409
+// responses keep their kind, so callers can tell them apart with errors.Is.
+func statusError(action string, resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	message := strings.TrimSpace(string(body))
+	switch resp.StatusCode {
+	case http.StatusBadRequest:
+		return errs.Validation("%s: %s", action, message)
+	case http.StatusNotFound:
+		return errs.NotFound("%s: %s", action, message)
+	case http.StatusConflict:
+		return errs.Conflict("%s: %s", action, message)
+	}
+	return fmt.Errorf("%s: %s", action, message)
+}
+
 func (r *RESTClient) GetIdentity(id string) (types.Identity, error) {
-	resp, err := r.client.Get(r.baseURL + "/identities/" + id)
+	resp, err := r.doIdempotent(http.MethodGet, r.baseURL+"/identities/"+id, nil)
 	if err != nil {
 		return types.Identity{}, fmt.Errorf("failed to get identity: %v", err)
 	}
@@ -184,6 +326,9 @@ func (r *RESTClient) ListIdentities(filter *types.IdentityFilter) ([]types.Ident
 		if filter.Search != "" {
 			q.Set("search", filter.Search)
 		}
+		if filter.DeepSearch {
+			q.Set("deep", "true")
+		}
 		if filter.IsActive != nil {
 			q.Set("is_active", fmt.Sprintf("%t", *filter.IsActive))
 		}
@@ -195,7 +340,7 @@ func (r *RESTClient) ListIdentities(filter *types.IdentityFilter) ([]types.Ident
 		u.RawQuery = q.Encode()
 	}
 
-	resp, err := r.client.Get(u.String())
+	resp, err := r.doIdempotent(http.MethodGet, u.String(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list identities: %v", err)
 	}
@@ -219,13 +364,7 @@ func (r *RESTClient) UpdateIdentity(id string, i types.Identity) error {
 		return fmt.Errorf("failed to marshal identity: %v", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPut, r.baseURL+"/identities/"+id, bytes.NewBuffer(data))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := r.client.Do(req)
+	resp, err := r.doIdempotent(http.MethodPut, r.baseURL+"/identities/"+id, data)
 	if err != nil {
 		return fmt.Errorf("failed to update identity: %v", err)
 	}
@@ -240,12 +379,7 @@ func (r *RESTClient) UpdateIdentity(id string, i types.Identity) error {
 }
 
 func (r *RESTClient) DeleteIdentity(id string) error {
-	req, err := http.NewRequest(http.MethodDelete, r.baseURL+"/identities/"+id, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-
-	resp, err := r.client.Do(req)
+	resp, err := r.doIdempotent(http.MethodDelete, r.baseURL+"/identities/"+id, nil)
 	if err != nil {
 		return fmt.Errorf("failed to delete identity: %v", err)
 	}
@@ -259,7 +393,7 @@ func (r *RESTClient) DeleteIdentity(id string) error {
 }
 
 func (r *RESTClient) GetIdentityWithPersona(id string) (types.IdentityWithPersona, error) {
-	resp, err := r.client.Get(r.baseURL + "/identities/" + id + "/with-persona")
+	resp, err := r.doIdempotent(http.MethodGet, r.baseURL+"/identities/"+id+"/with-persona", nil)
 	if err != nil {
 		return types.IdentityWithPersona{}, fmt.Errorf("failed to get identity with persona: %v", err)
 	}
@@ -277,6 +411,132 @@ func (r *RESTClient) GetIdentityWithPersona(id string) (types.IdentityWithPerson
 	return iwp, nil
 }
 
+func (r *RESTClient) CreateIdentitiesBatch(identities []*types.Identity) ([]string, error) {
+	payload := make([]*identityPayload, len(identities))
+	for n, i := range identities {
+		payload[n] = newIdentityPayload(i)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal identities: %v", err)
+	}
+
+	resp, err := r.client.Post(r.baseURL+"/identities/batch", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create identities: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to create identities: %s", string(body))
+	}
+
+	var batch struct {
+		Results []types.IdentityBatchResult `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return nil, fmt.Errorf("failed to decode batch results: %v", err)
+	}
+
+	return batchResults(identities, batch.Results)
+}
+
+// Community operations
+func (r *RESTClient) CreateCommunity(c *types.Community) error {
+	// The REST API only creates communities through /communities/generate
+	return unsupported("create community", "rest")
+}
+
+func (r *RESTClient) GetCommunity(id string) (types.Community, error) {
+	resp, err := r.doIdempotent(http.MethodGet, r.baseURL+"/communities/"+id, nil)
+	if err != nil {
+		return types.Community{}, fmt.Errorf("failed to get community: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return types.Community{}, fmt.Errorf("community not found: %s", id)
+	}
+
+	var c types.Community
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		return types.Community{}, fmt.Errorf("failed to decode community: %v", err)
+	}
+
+	return c, nil
+}
+
+func (r *RESTClient) ListCommunities(filter *types.CommunityFilter) ([]types.Community, error) {
+	u, err := url.Parse(r.baseURL + "/communities")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %v", err)
+	}
+
+	// Add query parameters for filtering
+	if filter != nil {
+		q := u.Query()
+		if filter.Type != "" {
+			q.Set("type", filter.Type)
+		}
+		if filter.Search != "" {
+			q.Set("search", filter.Search)
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	resp, err := r.doIdempotent(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list communities: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list communities")
+	}
+
+	var communities []types.Community
+	if err := json.NewDecoder(resp.Body).Decode(&communities); err != nil {
+		return nil, fmt.Errorf("failed to decode communities: %v", err)
+	}
+
+	return communities, nil
+}
+
+func (r *RESTClient) UpdateCommunity(id string, c types.Community) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal community: %v", err)
+	}
+
+	resp, err := r.doIdempotent(http.MethodPut, r.baseURL+"/communities/"+id, data)
+	if err != nil {
+		return fmt.Errorf("failed to update community: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to update community: %s", string(body))
+	}
+
+	return nil
+}
+
+func (r *RESTClient) DeleteCommunity(id string) error {
+	resp, err := r.doIdempotent(http.MethodDelete, r.baseURL+"/communities/"+id, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete community: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to delete community: %s", id)
+	}
+
+	return nil
+}
+
 func (r *RESTClient) Close() error {
 	// REST client doesn't need cleanup
 	return nil
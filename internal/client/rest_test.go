@@ -2,11 +2,16 @@ package client
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
 )
 
@@ -402,3 +407,230 @@ func TestRESTClient_ComplexPersona(t *testing.T) {
 		t.Error("Expected newlines to be preserved")
 	}
 }
+
+func TestRESTClient_CommunityOperations(t *testing.T) {
+	// Mock server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/communities":
+			if r.URL.Query().Get("type") != "interest" {
+				http.Error(w, "Missing type filter", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode([]types.Community{{Id: "c1", Name: "Community", Type: "interest"}})
+		case r.Method == http.MethodGet && r.URL.Path == "/communities/c1":
+			json.NewEncoder(w).Encode(types.Community{Id: "c1", Name: "Community", Type: "interest"})
+		case r.Method == http.MethodPut && r.URL.Path == "/communities/c1":
+			var c types.Community
+			json.NewDecoder(r.Body).Decode(&c)
+			json.NewEncoder(w).Encode(c)
+		case r.Method == http.MethodDelete && r.URL.Path == "/communities/c1":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	
+	client := NewRESTClient(server.URL)
+	
+	communities, err := client.ListCommunities(&types.CommunityFilter{Type: "interest"})
+	if err != nil {
+		t.Fatalf("ListCommunities failed: %v", err)
+	}
+	if len(communities) != 1 || communities[0].Id != "c1" {
+		t.Errorf("Expected community c1, got %+v", communities)
+	}
+	
+	c, err := client.GetCommunity("c1")
+	if err != nil {
+		t.Fatalf("GetCommunity failed: %v", err)
+	}
+	if c.Name != "Community" {
+		t.Errorf("Expected name 'Community', got %s", c.Name)
+	}
+	if _, err := client.GetCommunity("missing"); err == nil {
+		t.Error("Expected error for missing community")
+	}
+	
+	if err := client.UpdateCommunity("c1", c); err != nil {
+		t.Fatalf("UpdateCommunity failed: %v", err)
+	}
+	if err := client.DeleteCommunity("c1"); err != nil {
+		t.Fatalf("DeleteCommunity failed: %v", err)
+	}
+	
+	// Communities are only created through generation over REST
+	if err := client.CreateCommunity(&c); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected unsupported error for CreateCommunity, got %v", err)
+	}
+}
+
+func TestRESTClient_CreateIdentitiesBatch(t *testing.T) {
+	// Mock server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/identities/batch" {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		var identities []types.Identity
+		json.NewDecoder(r.Body).Decode(&identities)
+		
+		results := make([]types.IdentityBatchResult, len(identities))
+		for idx, i := range identities {
+			results[idx].Index = idx
+			if i.Name == "" {
+				results[idx].Error = "name is required"
+				continue
+			}
+			results[idx].Id = fmt.Sprintf("id-%d", idx)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	}))
+	defer server.Close()
+	
+	client := NewRESTClient(server.URL)
+	
+	identities := []*types.Identity{
+		{PersonaId: "p1", Name: "First"},
+		{PersonaId: "p1"},
+	}
+	ids, err := client.CreateIdentitiesBatch(identities)
+	
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Expected *BatchError, got %v", err)
+	}
+	if batchErr.Failures[1] != "name is required" {
+		t.Errorf("Expected failure for item 1, got %+v", batchErr.Failures)
+	}
+	if len(ids) != 2 || ids[0] != "id-0" || ids[1] != "" {
+		t.Errorf("Expected IDs [id-0 \"\"], got %v", ids)
+	}
+	if identities[0].Id != "id-0" {
+		t.Errorf("Expected identity ID to be assigned, got %s", identities[0].Id)
+	}
+	
+	ids, err = client.CreateIdentitiesBatch(identities[:1])
+	if err != nil {
+		t.Fatalf("CreateIdentitiesBatch failed: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "id-0" {
+		t.Errorf("Expected IDs [id-0], got %v", ids)
+	}
+}
+
+func TestRESTClient_Retry(t *testing.T) {
+	var attempts, failures atomic.Int32
+	failures.Store(2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= failures.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method == http.MethodPut {
+			var p types.Persona
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p.Name != "Updated" {
+				t.Errorf("Expected the body to be resent, got %+v (%v)", p, err)
+			}
+		}
+		json.NewEncoder(w).Encode(types.Persona{Id: "test-id", Name: "Test"})
+	}))
+	defer server.Close()
+	
+	client := NewRESTClientWithOptions(server.URL, RESTClientOptions{MaxRetries: 3, BaseDelay: time.Millisecond})
+	
+	p, err := client.Get("test-id")
+	if err != nil {
+		t.Fatalf("Expected Get to succeed after retries, got %v", err)
+	}
+	if p.Id != "test-id" {
+		t.Errorf("Expected persona test-id, got %s", p.Id)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("Expected 3 attempts, got %d", got)
+	}
+	
+	attempts.Store(0)
+	if err := client.Update("test-id", types.Persona{Name: "Updated"}); err != nil {
+		t.Fatalf("Expected Update to succeed after retries, got %v", err)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("Expected 3 attempts, got %d", got)
+	}
+	
+	// Retries run out
+	attempts.Store(0)
+	failures.Store(10)
+	if _, err := client.Get("test-id"); err == nil {
+		t.Error("Expected Get to fail once retries are exhausted")
+	}
+	if got := attempts.Load(); got != 4 {
+		t.Errorf("Expected 4 attempts, got %d", got)
+	}
+}
+
+func TestRESTClient_NoRetryOnClientError(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	
+	client := NewRESTClientWithOptions(server.URL, RESTClientOptions{MaxRetries: 3, BaseDelay: time.Millisecond})
+	if _, err := client.Get("missing"); err == nil {
+		t.Fatal("Expected error for 404")
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("Expected a single attempt for 404, got %d", got)
+	}
+	
+	// Creates are never retried
+	attempts.Store(0)
+	client.Create(&types.Persona{Name: "Test", Topic: "Test", Prompt: "Test"})
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("Expected a single attempt for Create, got %d", got)
+	}
+}
+
+func TestRESTClient_CreateIdentityWithKey(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		switch len(keys) {
+		case 1:
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(types.Identity{Id: "identity-1", PersonaId: "persona-1", Name: "Member"})
+		case 2:
+			// A repeated key replays the identity with 200
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(types.Identity{Id: "identity-1", PersonaId: "persona-1", Name: "Member"})
+		default:
+			http.Error(w, "referenced persona not found", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	
+	client := NewRESTClient(server.URL)
+	for attempt := 0; attempt < 2; attempt++ {
+		i := &types.Identity{PersonaId: "persona-1", Name: "Member"}
+		if err := client.CreateIdentityWithKey(i, "key-1"); err != nil {
+			t.Fatalf("CreateIdentityWithKey failed: %v", err)
+		}
+		if i.Id != "identity-1" {
+			t.Errorf("Expected identity-1, got %q", i.Id)
+		}
+	}
+	if keys[0] != "key-1" || keys[1] != "key-1" {
+		t.Errorf("Expected the key on every request, got %q", keys)
+	}
+	
+	err := client.CreateIdentity(&types.Identity{PersonaId: "missing", Name: "Member"})
+	if !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("Expected ErrValidation for 400, got %v", err)
+	}
+	if keys[2] != "" {
+		t.Errorf("Expected no key from CreateIdentity, got %q", keys[2])
+	}
+}
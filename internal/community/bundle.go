@@ -0,0 +1,209 @@
+package community
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// Bundle is a self-contained copy of a community: the community itself, its
+// member identities and every persona they need. Personas are ordered so
+// that parents come before the personas inheriting from them.
+type Bundle struct {
+	Community  types.Community  `json:"community"`
+	Identities []types.Identity `json:"identities"`
+	Personas   []types.Persona  `json:"personas"`
+}
+
+// ExportCommunityBundle serializes a community, its members and the
+// personas they reference, including those personas' ancestors, as a JSON
+// Bundle for ImportCommunityBundle. Members whose identities no longer
+// exist are left out. Relationships between members are not exported.
+func (s *Service) ExportCommunityBundle(id string) ([]byte, error) {
+	community, err := s.storage.GetCommunity(id)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := Bundle{
+		Community:  community,
+		Identities: s.loadMembers(community),
+		Personas:   []types.Persona{},
+	}
+	bundle.Community.MemberIds = make([]string, 0, len(bundle.Identities))
+	for _, member := range bundle.Identities {
+		bundle.Community.MemberIds = append(bundle.Community.MemberIds, member.Id)
+	}
+	bundle.Community.Size = len(bundle.Community.MemberIds)
+
+	included := make(map[string]bool)
+	for _, member := range bundle.Identities {
+		if included[member.PersonaId] {
+			continue
+		}
+		chain, err := s.personaChain(member.PersonaId, included)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Personas = append(bundle.Personas, chain...)
+	}
+
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal community bundle: %v", err)
+	}
+	return data, nil
+}
+
+// personaChain returns the persona with the given ID and those of its
+// ancestors not yet in included, root first, and adds them to included
+func (s *Service) personaChain(id string, included map[string]bool) ([]types.Persona, error) {
+	var chain []types.Persona
+	seen := make(map[string]bool)
+	for current := id; current != "" && !included[current]; {
+		if seen[current] {
+			return nil, errs.Validation("persona inheritance cycle at %s", current)
+		}
+		seen[current] = true
+
+		p, err := s.storage.Get(current)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export persona %s: %w", current, err)
+		}
+		chain = append([]types.Persona{p}, chain...)
+		current = p.ParentId
+	}
+	for _, p := range chain {
+		included[p.Id] = true
+	}
+	return chain, nil
+}
+
+// ImportCommunityBundle recreates a Bundle produced by
+// ExportCommunityBundle and returns the new community.
+//
+// Everything in the bundle is validated before anything is written, and
+// every persona, identity and the community are created under new IDs, so
+// a bundle can be imported repeatedly, including into the store it came
+// from. References between them are rewritten to match. If a write fails,
+// what was already created is removed again.
+func (s *Service) ImportCommunityBundle(data []byte) (*types.Community, error) {
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, errs.Validation("failed to parse community bundle: %v", err)
+	}
+	if err := validateBundle(&bundle); err != nil {
+		return nil, err
+	}
+
+	var personaIDs, identityIDs []string
+	rollback := func() {
+		s.rollbackMembers(identityIDs)
+		for i := len(personaIDs) - 1; i >= 0; i-- {
+			s.storage.Delete(personaIDs[i]) // Best effort; nothing else references them yet
+		}
+	}
+
+	newPersonaIDs := make(map[string]string, len(bundle.Personas))
+	for _, p := range bundle.Personas {
+		oldID := p.Id
+		p.ParentId = newPersonaIDs[p.ParentId]
+		p.Version = 0
+		p.DeletedAt = nil
+		if err := s.storage.Create(&p); err != nil {
+			rollback()
+			return nil, fmt.Errorf("failed to import persona %s: %w", p.Name, err)
+		}
+		newPersonaIDs[oldID] = p.Id
+		personaIDs = append(personaIDs, p.Id)
+	}
+
+	newIdentityIDs := make(map[string]string, len(bundle.Identities))
+	for _, member := range bundle.Identities {
+		oldID := member.Id
+		member.PersonaId = newPersonaIDs[member.PersonaId]
+		if err := s.storage.CreateIdentity(&member); err != nil {
+			rollback()
+			return nil, fmt.Errorf("failed to import identity %s: %w", member.Name, err)
+		}
+		newIdentityIDs[oldID] = member.Id
+		identityIDs = append(identityIDs, member.Id)
+	}
+
+	community := bundle.Community
+	community.Id = ""
+	community.MemberIds = make([]string, 0, len(community.MemberIds))
+	for _, id := range bundle.Community.MemberIds {
+		if newID, ok := newIdentityIDs[id]; ok {
+			community.MemberIds = append(community.MemberIds, newID)
+		}
+	}
+	community.Size = len(community.MemberIds)
+	now := time.Now()
+	community.CreatedAt = now
+	community.UpdatedAt = now
+	if err := s.storage.CreateCommunity(&community); err != nil {
+		rollback()
+		return nil, fmt.Errorf("failed to import community: %w", err)
+	}
+	return &community, nil
+}
+
+// validateBundle sanitizes and validates every entry in a bundle and checks
+// that all references between them resolve within the bundle
+func validateBundle(bundle *Bundle) error {
+	c := &bundle.Community
+	middleware.SanitizeCommunity(c)
+	if c.Name == "" {
+		return errs.Validation("community name is required")
+	}
+	if c.Type == "" {
+		return errs.Validation("community type is required")
+	}
+	if err := middleware.ValidateCommunity(c); err != nil {
+		return err
+	}
+
+	personas := make(map[string]bool, len(bundle.Personas))
+	for i := range bundle.Personas {
+		p := &bundle.Personas[i]
+		middleware.SanitizePersona(p)
+		if err := middleware.ValidatePersona(p); err != nil {
+			return fmt.Errorf("persona %d (%s): %w", i, p.Name, err)
+		}
+		if p.Id == "" || personas[p.Id] {
+			return errs.Validation("persona %d (%s) needs a unique id", i, p.Name)
+		}
+		if p.ParentId != "" && !personas[p.ParentId] {
+			return errs.Validation("persona %s: parent %s must appear earlier in the bundle", p.Id, p.ParentId)
+		}
+		personas[p.Id] = true
+	}
+
+	identities := make(map[string]bool, len(bundle.Identities))
+	for i := range bundle.Identities {
+		member := &bundle.Identities[i]
+		middleware.SanitizeIdentity(member)
+		if err := middleware.ValidateIdentity(member); err != nil {
+			return fmt.Errorf("identity %d (%s): %w", i, member.Name, err)
+		}
+		if member.Id == "" || identities[member.Id] {
+			return errs.Validation("identity %d (%s) needs a unique id", i, member.Name)
+		}
+		if !personas[member.PersonaId] {
+			return errs.Validation("identity %s: persona %s is not in the bundle", member.Id, member.PersonaId)
+		}
+		identities[member.Id] = true
+	}
+
+	for _, id := range c.MemberIds {
+		if !identities[id] {
+			return errs.Validation("community member %s is not in the bundle", id)
+		}
+	}
+	return nil
+}
@@ -1,38 +1,139 @@
 package community
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"math"
-	"strconv"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/generator"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/ids"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/names"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/parallel"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
 )
 
+// defaultMaxGenerationAttempts bounds member regeneration when MinDiversity
+// or TargetDiversity is set
+const defaultMaxGenerationAttempts = 10
+
+// defaultDiversityTolerance is how close to TargetDiversity a member set must be
+const defaultDiversityTolerance = 0.05
+
 // Service provides community generation and management functionality
 type Service struct {
-	storage storage.Storage
+	storage           storage.Storage
+	identities        *generator.Generator
+	generationTimeout time.Duration
+	generationWorkers int
+
+	// memberGenerator produces candidate members; replaceable in tests
+	memberGenerator func(config types.CommunityGenerationConfig, count int) ([]types.Identity, error)
+
+	// cohesionScore computes the pairwise cohesion of members; replaceable
+	// in tests
+	cohesionScore func(members []types.Identity, config types.CommunityGenerationConfig) float64
+
+	// metrics holds diversity and cohesion computed by stats requests for
+	// communities whose stored values are out of date, so reads never write
+	// the community back
+	metricsMu sync.Mutex
+	metrics   map[string]cachedMetrics
+}
+
+// cachedMetrics are the diversity and cohesion computed for a member set
+type cachedMetrics struct {
+	memberHash string
+	diversity  float64
+	cohesion   float64
 }
 
 // NewService creates a new community service
 func NewService(storage storage.Storage) *Service {
-	return &Service{
-		storage: storage,
-	}
+	s := &Service{
+		storage:    storage,
+		identities: generator.NewGenerator(),
+		metrics:    make(map[string]cachedMetrics),
+	}
+	s.memberGenerator = s.generateMembers
+	s.cohesionScore = s.calculateCohesionScore
+	return s
+}
+
+// SetGenerationWorkers bounds how many goroutines generate a community's
+// members concurrently. A zero or negative count uses one per CPU.
+func (s *Service) SetGenerationWorkers(workers int) {
+	s.generationWorkers = workers
+}
+
+// SetGenerationTimeout bounds how long GenerateCommunity may run. A zero or
+// negative timeout disables the deadline.
+func (s *Service) SetGenerationTimeout(timeout time.Duration) {
+	s.generationTimeout = timeout
 }
 
-// GenerateCommunity creates a new community with generated members
+// GenerateCommunity creates a new community with generated members, applying
+// the configured generation timeout
 func (s *Service) GenerateCommunity(config types.CommunityGenerationConfig, name, description, communityType string, targetSize int) (*types.Community, error) {
+	ctx := context.Background()
+	if s.generationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.generationTimeout)
+		defer cancel()
+	}
+	return s.GenerateCommunityContext(ctx, config, name, description, communityType, targetSize)
+}
+
+// GenerateCommunityContext creates a new community with generated members.
+//
+// If ctx is done before the community is stored, generation is aborted, any
+// member identities already stored are removed, and the returned error wraps
+// ctx.Err() (context.DeadlineExceeded when a deadline was hit).
+func (s *Service) GenerateCommunityContext(ctx context.Context, config types.CommunityGenerationConfig, name, description, communityType string, targetSize int) (*types.Community, error) {
 	if targetSize <= 0 {
 		return nil, fmt.Errorf("target size must be positive")
 	}
+	if config.MinDiversity != nil && (*config.MinDiversity < 0 || *config.MinDiversity > 1) {
+		return nil, fmt.Errorf("min diversity must be between 0 and 1")
+	}
+	if config.TargetDiversity < 0 || config.TargetDiversity > 1 {
+		return nil, fmt.Errorf("target diversity must be between 0 and 1")
+	}
+	if config.DiversityTolerance < 0 || config.DiversityTolerance > 1 {
+		return nil, fmt.Errorf("diversity tolerance must be between 0 and 1")
+	}
+	if err := validateDimensionTargets(config.TargetDiversityByDimension); err != nil {
+		return nil, err
+	}
+	if err := validateLocationConstraint(config.LocationConstraint); err != nil {
+		return nil, err
+	}
+	if config.PersonaConsistency < 0 || config.PersonaConsistency > 1 {
+		return nil, fmt.Errorf("persona consistency must be between 0 and 1")
+	}
+	genders, err := normalizeGenderDistribution(config.GenderDistribution)
+	if err != nil {
+		return nil, err
+	}
+	config.GenderDistribution = genders
+	if err := s.validatePersonaWeights(config.PersonaWeights); err != nil {
+		return nil, err
+	}
 
 	// Create the community structure
 	community := &types.Community{
-		Id:               generateID(),
+		Id:               ids.New(),
 		Name:             name,
 		Description:      description,
 		Type:             communityType,
@@ -49,14 +150,20 @@ func (s *Service) GenerateCommunity(config types.CommunityGenerationConfig, name
 	}
 
 	// Generate community members
-	members, err := s.generateMembers(config, targetSize)
+	members, warning, err := s.generateDiverseMembersContext(ctx, config, targetSize)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate members: %v", err)
+		return nil, err
 	}
 
-	// Add members to community
-	for _, member := range members {
-		if err := s.storage.CreateIdentity(&member); err != nil {
+	// Add members to community, rolling back on failure or cancellation
+	for i := range members {
+		member := &members[i] // Keep the assigned ID for the metrics below
+		if err := ctx.Err(); err != nil {
+			s.rollbackMembers(community.MemberIds)
+			return nil, generationAborted(err)
+		}
+		if err := s.storage.CreateIdentity(member); err != nil {
+			s.rollbackMembers(community.MemberIds)
 			return nil, fmt.Errorf("failed to create member identity: %v", err)
 		}
 		community.MemberIds = append(community.MemberIds, member.Id)
@@ -64,18 +171,135 @@ func (s *Service) GenerateCommunity(config types.CommunityGenerationConfig, name
 
 	community.Size = len(community.MemberIds)
 
+	if config.GenerateRelationships {
+		if err := s.linkMembers(community.MemberIds, members, config.NetworkDensity); err != nil {
+			s.rollbackMembers(community.MemberIds) // Deleting members also deletes their relationships
+			return nil, fmt.Errorf("failed to create member relationships: %v", err)
+		}
+	}
+
 	// Calculate community metrics
 	s.calculateCommunityMetrics(community, members)
+	if warning != "" {
+		community.Attributes["diversity_warning"] = warning
+	}
 
 	// Store the community
+	if err := ctx.Err(); err != nil {
+		s.rollbackMembers(community.MemberIds)
+		return nil, generationAborted(err)
+	}
 	if err := s.storage.CreateCommunity(community); err != nil {
+		s.rollbackMembers(community.MemberIds)
 		return nil, fmt.Errorf("failed to store community: %v", err)
 	}
 
 	return community, nil
 }
 
-// generateMembers creates identities based on the generation configuration
+// generateDiverseMembersContext runs member generation in the background so a
+// slow generation can be abandoned as soon as ctx is done. Generation does not
+// touch storage, so an abandoned run leaves nothing behind.
+func (s *Service) generateDiverseMembersContext(ctx context.Context, config types.CommunityGenerationConfig, count int) ([]types.Identity, string, error) {
+	type result struct {
+		members []types.Identity
+		warning string
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		members, warning, err := s.generateDiverseMembers(ctx, config, count)
+		done <- result{members, warning, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.members, res.warning, res.err
+	case <-ctx.Done():
+		return nil, "", generationAborted(ctx.Err())
+	}
+}
+
+// rollbackMembers removes member identities stored by an aborted generation
+func (s *Service) rollbackMembers(ids []string) {
+	for _, id := range ids {
+		s.storage.DeleteIdentity(id) // Best effort; nothing else references them yet
+	}
+}
+
+func generationAborted(err error) error {
+	return fmt.Errorf("community generation aborted: %w", err)
+}
+
+// generateDiverseMembers generates members, regenerating until the configured
+// minimum and target diversity are met or the attempt budget is exhausted.
+// A missed target is not an error: the member set closest to it is returned
+// with a warning.
+func (s *Service) generateDiverseMembers(ctx context.Context, config types.CommunityGenerationConfig, count int) ([]types.Identity, string, error) {
+	targeted := config.TargetDiversity > 0
+	attempts := 1
+	if config.MinDiversity != nil || targeted {
+		attempts = config.MaxGenerationAttempts
+		if attempts <= 0 {
+			attempts = defaultMaxGenerationAttempts
+		}
+	}
+	tolerance := config.DiversityTolerance
+	if tolerance <= 0 {
+		tolerance = defaultDiversityTolerance
+	}
+
+	var closest []types.Identity
+	closestDiversity, closestDistance := 0.0, math.Inf(1)
+	bestDiversity := 0.0
+	for range attempts {
+		if err := ctx.Err(); err != nil {
+			return nil, "", generationAborted(err)
+		}
+		members, err := s.memberGenerator(config, count)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to generate members: %v", err)
+		}
+		if config.MinDiversity == nil && !targeted {
+			return members, "", nil
+		}
+
+		diversity := s.calculateDiversityIndex(members)
+		bestDiversity = math.Max(bestDiversity, diversity)
+		if config.MinDiversity != nil && diversity < *config.MinDiversity {
+			continue
+		}
+		if !targeted {
+			return members, "", nil
+		}
+		distance := math.Abs(diversity - config.TargetDiversity)
+		if distance <= tolerance {
+			return members, "", nil
+		}
+		if distance < closestDistance {
+			closest, closestDiversity, closestDistance = members, diversity, distance
+		}
+	}
+
+	if closest == nil {
+		return nil, "", fmt.Errorf("failed to reach minimum diversity %.3f after %d attempts (best %.3f)",
+			*config.MinDiversity, attempts, bestDiversity)
+	}
+	return closest, fmt.Sprintf("target diversity %.3f not reached after %d attempts, closest was %.3f",
+		config.TargetDiversity, attempts, closestDiversity), nil
+}
+
+// memberDraft is a member's persona and attributes before balancing
+type memberDraft struct {
+	persona types.Persona
+	attrs   map[string]interface{}
+}
+
+// generateMembers creates identities based on the generation configuration.
+// Members are independent, so they are generated by up to
+// generationWorkers goroutines; only per-dimension balancing, which depends
+// on the members before it, runs in member order. Nothing is written to
+// storage here.
 func (s *Service) generateMembers(config types.CommunityGenerationConfig, count int) ([]types.Identity, error) {
 	// Get available personas
 	personas, err := s.storage.List()
@@ -87,71 +311,119 @@ func (s *Service) generateMembers(config types.CommunityGenerationConfig, count
 		return nil, fmt.Errorf("no personas available for community generation")
 	}
 
-	members := make([]types.Identity, 0, count)
+	// Select personas based on weights and generate rich attributes
+	drafts := make([]memberDraft, count)
+	parallel.For(count, s.generationWorkers, func(i int) {
+		drafts[i] = memberDraft{
+			persona: s.selectPersonaByWeight(personas, config.PersonaWeights),
+			attrs:   s.generateRichAttributes(config, i, count),
+		}
+	})
 
-	for i := range count {
-		// Select persona based on weights
-		persona := s.selectPersonaByWeight(personas, config.PersonaWeights)
+	if len(config.TargetDiversityByDimension) > 0 {
+		balancer := newDimensionBalancer(config.TargetDiversityByDimension)
+		for _, draft := range drafts {
+			balancer.apply(config, draft.attrs)
+		}
+	}
 
-		// Generate identity attributes
+	members := make([]types.Identity, count)
+	memberNames := names.NewNameGenerator(cryptoRandIntn)
+	namePools := pools()
+	parallel.For(count, s.generationWorkers, func(i int) {
+		persona := drafts[i].persona
 		now := time.Now()
 		identity := types.Identity{
-			Id:          generateID(),
-			PersonaId:   persona.Id,
-			Name:        s.generateName(),
-			Description: fmt.Sprintf("Community member based on %s persona", persona.Name),
-			IsActive:    true,
-			CreatedAt:   now,
-			UpdatedAt:   now,
-			Tags:        []string{"community-generated"},
-		}
-
-		// Generate rich attributes based on community config
-		richAttrs := s.generateRichAttributes(config, i, count)
-
-		// Create RichAttributes with available fields
-		identity.RichAttributes = &types.RichAttributes{}
-		// Set Demographics
-		dem := &types.Demographics{}
-		if age, ok := richAttrs["age"].(int); ok {
-			dem.Age = int32(age)
-		}
-		if gender, ok := richAttrs["gender"].(string); ok {
-			dem.Gender = gender
-		}
-		if education, ok := richAttrs["education"].(string); ok {
-			dem.Education = education
-		}
-		if socioeconomic, ok := richAttrs["socioeconomic_status"].(string); ok {
-			dem.SocioeconomicStatus = socioeconomic
-		}
-		if loc, ok := richAttrs["location"].(map[string]interface{}); ok {
-			dem.Location = mapToLocation(loc)
-		}
-		identity.RichAttributes.Demographics = dem
-		// Set PoliticalSocial
-		if political, ok := richAttrs["political_leaning"].(string); ok {
-			ps := &types.PoliticalSocial{PoliticalLeaning: political}
-			identity.RichAttributes.PoliticalSocial = ps
-		}
-		// Set Preferences
-		if interests, ok := richAttrs["interests"].([]string); ok {
-			prefs := &types.Preferences{Interests: interests}
-			identity.RichAttributes.Preferences = prefs
-		}
-		// Set activity level in custom map
-		if activity, ok := richAttrs["activity_level"].(float64); ok {
-			if identity.RichAttributes.Custom == nil {
-				identity.RichAttributes.Custom = make(map[string]string)
-			}
-			identity.RichAttributes.Custom["activity_level"] = fmt.Sprintf("%f", activity)
+			Id:             ids.New(),
+			PersonaId:      persona.Id,
+			Description:    fmt.Sprintf("Community member based on %s persona", persona.Name),
+			IsActive:       true,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+			Tags:           []string{"community-generated"},
+			RichAttributes: memberRichAttributes(drafts[i].attrs),
 		}
-		members = append(members, identity)
-	}
+		identity.Name = generateName(namePools, memberNames, identity.RichAttributes.Demographics)
+		s.identities.ApplyPersonaConsistency(&identity, persona, config.PersonaConsistency)
+		members[i] = identity
+	})
 
 	return members, nil
 }
 
+// memberRichAttributes builds a member's rich attributes from the map
+// produced by generateRichAttributes
+func memberRichAttributes(attrs map[string]interface{}) *types.RichAttributes {
+	rich := &types.RichAttributes{Demographics: &types.Demographics{}}
+
+	dem := rich.Demographics
+	if age, ok := attrs["age"].(int); ok {
+		dem.Age = int32(age)
+	}
+	if gender, ok := attrs["gender"].(string); ok {
+		dem.Gender = gender
+	}
+	if education, ok := attrs["education"].(string); ok {
+		dem.Education = education
+	}
+	if socioeconomic, ok := attrs["socioeconomic_status"].(string); ok {
+		dem.SocioeconomicStatus = socioeconomic
+	}
+	if loc, ok := attrs["location"].(map[string]interface{}); ok {
+		dem.Location = mapToLocation(loc)
+	}
+
+	if political, ok := attrs["political_leaning"].(string); ok {
+		rich.PoliticalSocial = &types.PoliticalSocial{PoliticalLeaning: political}
+	}
+	if interests, ok := attrs["interests"].([]string); ok {
+		rich.Preferences = &types.Preferences{Interests: interests}
+	}
+	if activity, ok := attrs["activity_level"].(float64); ok {
+		rich.Custom = map[string]string{"activity_level": fmt.Sprintf("%f", activity)}
+	}
+
+	return rich
+}
+
+// validatePersonaWeights checks that every weighted persona exists and that
+// at least one weight is positive. A zero or negative weight on its own
+// means the default weight, but weights that are all zero or negative
+// express no preference at all and are most likely a mistake.
+func (s *Service) validatePersonaWeights(weights map[string]float64) error {
+	if len(weights) == 0 {
+		return nil
+	}
+
+	personas, err := s.storage.List()
+	if err != nil {
+		return fmt.Errorf("failed to get personas: %v", err)
+	}
+	known := make(map[string]bool, len(personas))
+	for _, p := range personas {
+		known[p.Id] = true
+	}
+
+	var unknown []string
+	positive := false
+	for id, weight := range weights {
+		if !known[id] {
+			unknown = append(unknown, id)
+		}
+		if weight > 0 {
+			positive = true
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return errs.Validation("persona weights reference unknown personas: %s", strings.Join(unknown, ", "))
+	}
+	if !positive {
+		return errs.Validation("persona weights must include at least one positive weight")
+	}
+	return nil
+}
+
 // selectPersonaByWeight selects a persona based on configured weights
 func (s *Service) selectPersonaByWeight(personas []types.Persona, weights map[string]float64) types.Persona {
 	if len(weights) == 0 {
@@ -209,75 +481,116 @@ func (s *Service) generateRichAttributes(config types.CommunityGenerationConfig,
 	socioeconomicStatus := s.generateSocioeconomicStatus(config.SocioeconomicRange)
 	attrs["socioeconomic_status"] = socioeconomicStatus
 
-	// Generate interests with diversity
-	interests := s.generateInterests(config.InterestSpread)
-	attrs["interests"] = interests
-
 	// Generate activity level
 	activityLevel := s.generateActivityLevel(config.ActivityLevel)
 	attrs["activity_level"] = activityLevel
 
-	// Generate gender (simple binary for now, could be expanded)
-	gender := s.generateGender()
+	// Generate gender from the configured distribution
+	gender := s.generateGender(config.GenderDistribution)
 	attrs["gender"] = gender
 
 	// Generate education level
 	education := s.generateEducationLevel(age)
 	attrs["education"] = education
 
+	// Generate interests with diversity, weighted by age and education
+	interests := s.generateInterests(config.InterestSpread, age, education)
+	attrs["interests"] = interests
+
 	return attrs
 }
 
-// generateAge creates an age based on the distribution parameters
+// maxAgeDraws bounds how many times generateAge redraws an age that falls
+// outside [MinAge, MaxAge] before clamping it
+const maxAgeDraws = 100
+
+// generateAge creates an age based on the distribution parameters. Ages
+// follow a skew-normal distribution with the configured mean, standard
+// deviation and skewness. Draws outside [MinAge, MaxAge] are rejected and
+// redrawn, so the bounds truncate the distribution instead of piling
+// probability onto the edge ages.
 func (s *Service) generateAge(dist types.AgeDistribution) int {
-	// Use normal distribution with constraints
-	age := cryptoRandNormFloat64()*dist.StdDev + dist.Mean
+	age := int(math.Round(dist.Mean))
+	for range maxAgeDraws {
+		age = int(math.Round(dist.Mean + dist.StdDev*skewNormalFloat64(dist.Skewness)))
+		if age >= dist.MinAge && age <= dist.MaxAge {
+			return age
+		}
+	}
 
-	// Apply skewness (simple implementation)
-	if dist.Skewness != 0 {
-		skewAdjustment := dist.Skewness * (age - dist.Mean) * 0.5
-		age += skewAdjustment
+	// The bounds are too narrow for the distribution; fall back to clamping
+	if age < dist.MinAge {
+		age = dist.MinAge
+	}
+	if age > dist.MaxAge {
+		age = dist.MaxAge
 	}
+	return age
+}
+
+// maxSkewNormalSkewness is just below the largest skewness a skew-normal
+// distribution can reach (about 0.995)
+const maxSkewNormalSkewness = 0.99
 
-	// Constrain to bounds
-	ageInt := int(math.Round(age))
-	if ageInt < dist.MinAge {
-		ageInt = dist.MinAge
+// skewNormalFloat64 returns a sample with mean 0, standard deviation 1 and
+// the given skewness, clamped to ±maxSkewNormalSkewness. It uses the
+// skew-normal construction z = δ|u| + sqrt(1-δ²)v for independent standard
+// normals u and v, choosing δ from the method-of-moments inverse of the
+// skew-normal skewness and standardizing z by its known mean and variance.
+func skewNormalFloat64(skewness float64) float64 {
+	if skewness == 0 {
+		return cryptoRandNormFloat64()
 	}
-	if ageInt > dist.MaxAge {
-		ageInt = dist.MaxAge
+
+	gamma := math.Min(math.Abs(skewness), maxSkewNormalSkewness)
+	g := math.Pow(gamma, 2.0/3)
+	delta := math.Sqrt(math.Pi / 2 * g / (g + math.Pow((4-math.Pi)/2, 2.0/3)))
+	if skewness < 0 {
+		delta = -delta
 	}
 
-	return ageInt
+	z := delta*math.Abs(cryptoRandNormFloat64()) + math.Sqrt(1-delta*delta)*cryptoRandNormFloat64()
+	mean := delta * math.Sqrt(2/math.Pi)
+	stdDev := math.Sqrt(1 - 2*delta*delta/math.Pi)
+	return (z - mean) / stdDev
 }
 
-// generateLocation creates a location based on constraints
+// generateLocation creates a location based on constraints. Cities,
+// regions and countries found in the geography data are completed with the
+// rest of a matching place, so the city, region, country and timezone of a
+// location agree, and carry the place's coordinates. A geo constraint picks
+// among the known cities within its radius. A preferred timezone narrows the
+// places chosen from when any of them lie in it.
 func (s *Service) generateLocation(constraint types.LocationConstraint) map[string]interface{} {
 	location := make(map[string]interface{})
 
 	switch constraint.Type {
 	case "city":
-		if len(constraint.Locations) > 0 {
-			city := constraint.Locations[cryptoRandIntn(len(constraint.Locations))]
-			location["city"] = city
-			location["type"] = "city"
-		} else {
-			location["city"] = s.generateRandomCity()
-			location["type"] = "city"
+		cities := constraint.Locations
+		if len(cities) == 0 {
+			cities = pools().Cities
 		}
-	case "region":
+		cities = preferTimezone(cities, constraint.Timezone)
+		setCity(location, cities[cryptoRandIntn(len(cities))])
+		location["type"] = "city"
+	case "region", "country":
 		if len(constraint.Locations) > 0 {
-			region := constraint.Locations[cryptoRandIntn(len(constraint.Locations))]
-			location["region"] = region
-			location["type"] = "region"
+			name := constraint.Locations[cryptoRandIntn(len(constraint.Locations))]
+			location[constraint.Type] = name
+			location["type"] = constraint.Type
+			if p, ok := pickPlace(placesIn(constraint.Type, name), constraint.Timezone); ok {
+				setPlace(location, p)
+			}
 		}
-	case "country":
-		if len(constraint.Locations) > 0 {
-			country := constraint.Locations[cryptoRandIntn(len(constraint.Locations))]
-			location["country"] = country
-			location["type"] = "country"
+	case "geo":
+		nearby := placesWithin(constraint.CenterLat, constraint.CenterLng, constraint.RadiusKm)
+		if p, ok := pickPlace(nearby, constraint.Timezone); ok {
+			setPlace(location, p)
 		}
+		location["type"] = "geo"
 	default:
+		cities := preferTimezone(pools().Cities, constraint.Timezone)
+		setCity(location, cities[cryptoRandIntn(len(cities))])
 		location["type"] = "global"
 	}
 
@@ -288,7 +601,7 @@ func (s *Service) generateLocation(constraint types.LocationConstraint) map[stri
 		location["urban"] = cryptoRandFloat64() > 0.3 // 70% urban by default
 	}
 
-	if constraint.Timezone != "" {
+	if _, ok := location["timezone"]; !ok && constraint.Timezone != "" {
 		location["timezone"] = constraint.Timezone
 	}
 
@@ -340,24 +653,30 @@ func (s *Service) generateSocioeconomicStatus(spread float64) string {
 	}
 }
 
-// generateInterests creates a list of interests with specified diversity
-func (s *Service) generateInterests(diversity float64) []string {
-	allInterests := []string{
-		"technology", "sports", "music", "art", "cooking", "travel", "reading",
-		"gaming", "fitness", "photography", "gardening", "movies", "politics",
-		"science", "history", "fashion", "cars", "pets", "crafts", "business",
-	}
-
+// generateInterests creates a list of interests with specified diversity.
+// Interests are drawn from the configured pools without replacement, each weighted for the member's
+// age and education by interestWeights.
+func (s *Service) generateInterests(diversity float64, age int, education string) []string {
 	// Number of interests based on diversity (more diversity = more varied interests)
+	allInterests := pools().Interests
 	numInterests := int(diversity*10) + 2 // 2-12 interests
 	if numInterests > len(allInterests) {
 		numInterests = len(allInterests)
 	}
 
-	// Randomly select interests
-	selected := make([]string, 0, numInterests)
-	indices := cryptoRandPerm(len(allInterests))
+	// Weighted sampling without replacement (Efraimidis-Spirakis): give each
+	// interest the key u^(1/weight) and keep the largest keys
+	keys := make([]float64, len(allInterests))
+	indices := make([]int, len(allInterests))
+	for i, interest := range allInterests {
+		keys[i] = math.Pow(cryptoRandFloat64(), 1/interestWeight(interest, age, education))
+		indices[i] = i
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		return keys[indices[i]] > keys[indices[j]]
+	})
 
+	selected := make([]string, 0, numInterests)
 	for i := 0; i < numInterests; i++ {
 		selected = append(selected, allInterests[indices[i]])
 	}
@@ -382,12 +701,64 @@ func (s *Service) generateActivityLevel(baseLevel float64) float64 {
 	return level
 }
 
-// generateGender creates gender (simplified binary model)
-func (s *Service) generateGender() string {
-	if cryptoRandFloat64() < 0.5 {
-		return "male"
+// generateGender selects a gender from a normalized distribution, falling
+// back to an even male/female split when none is configured
+func (s *Service) generateGender(distribution map[string]float64) string {
+	if len(distribution) == 0 {
+		if cryptoRandFloat64() < 0.5 {
+			return "male"
+		}
+		return "female"
+	}
+
+	genders := sortedKeys(distribution)
+	target := cryptoRandFloat64()
+	cumulative := 0.0
+	for _, gender := range genders {
+		cumulative += distribution[gender]
+		if target < cumulative {
+			return gender
+		}
+	}
+
+	// Guard against rounding leaving target just above the total
+	return genders[len(genders)-1]
+}
+
+// normalizeGenderDistribution validates gender weights and scales them to
+// sum to 1. Genders with zero weight are dropped.
+func normalizeGenderDistribution(distribution map[string]float64) (map[string]float64, error) {
+	if len(distribution) == 0 {
+		return nil, nil
+	}
+
+	total := 0.0
+	for gender, weight := range distribution {
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("gender weight for %q must be a non-negative number", gender)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("gender distribution must have at least one positive weight")
+	}
+
+	normalized := make(map[string]float64, len(distribution))
+	for gender, weight := range distribution {
+		if weight > 0 {
+			normalized[gender] = weight / total
+		}
 	}
-	return "female"
+	return normalized, nil
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // generateEducationLevel creates education level based on age
@@ -414,42 +785,12 @@ func (s *Service) generateEducationLevel(age int) string {
 	}
 }
 
-// generateName creates a random name for community members
-func (s *Service) generateName() string {
-	firstNames := []string{
-		"Alex", "Jordan", "Taylor", "Casey", "Morgan", "Riley", "Avery", "Quinn",
-		"Sam", "Blake", "Cameron", "Drew", "Emery", "Finley", "Harper", "Hayden",
-		"Jamie", "Kendall", "Logan", "Parker", "Peyton", "Reese", "Sage", "Skyler",
-	}
-
-	lastNames := []string{
-		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
-		"Rodriguez", "Martinez", "Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas",
-		"Taylor", "Moore", "Jackson", "Martin", "Lee", "Perez", "Thompson", "White",
-	}
-
-	firstName := firstNames[cryptoRandIntn(len(firstNames))]
-	lastName := lastNames[cryptoRandIntn(len(lastNames))]
-
-	return fmt.Sprintf("%s %s", firstName, lastName)
-}
-
-// generateRandomCity creates a random city name
-func (s *Service) generateRandomCity() string {
-	cities := []string{
-		"New York", "Los Angeles", "Chicago", "Houston", "Phoenix", "Philadelphia",
-		"San Antonio", "San Diego", "Dallas", "San Jose", "Austin", "Jacksonville",
-		"Fort Worth", "Columbus", "Charlotte", "San Francisco", "Indianapolis", "Seattle",
-		"Denver", "Washington", "Boston", "El Paso", "Nashville", "Detroit", "Portland",
-	}
-	return cities[cryptoRandIntn(len(cities))]
-}
-
 // calculateCommunityMetrics computes diversity and cohesion scores
 func (s *Service) calculateCommunityMetrics(community *types.Community, members []types.Identity) {
 	if len(members) == 0 {
 		community.Diversity = 0
 		community.Cohesion = 0
+		community.MetricsMemberHash = memberSetHash(nil)
 		return
 	}
 
@@ -458,13 +799,17 @@ func (s *Service) calculateCommunityMetrics(community *types.Community, members
 	community.Diversity = diversity
 
 	// Calculate cohesion based on similarity and network density
-	cohesion := s.calculateCohesionScore(members, community.GenerationConfig)
+	cohesion := s.cohesionScore(members, community.GenerationConfig)
 	community.Cohesion = cohesion
+	community.MetricsMemberHash = memberSetHash(memberIDs(members))
 
 	// Set community attributes
 	community.Attributes["average_age"] = s.calculateAverageAge(members)
 	community.Attributes["political_distribution"] = s.calculatePoliticalDistribution(members)
 	community.Attributes["location_spread"] = s.calculateLocationSpread(members)
+	if len(community.GenerationConfig.TargetDiversityByDimension) > 0 {
+		community.Attributes["diversity_by_dimension"] = s.calculateDimensionDiversities(members, community.GenerationConfig.TargetDiversityByDimension)
+	}
 }
 
 // calculateDiversityIndex computes a diversity score based on member attributes
@@ -592,7 +937,7 @@ func (s *Service) calculateCohesionScore(members []types.Identity, config types.
 
 	for i := 0; i < len(members); i++ {
 		for j := i + 1; j < len(members); j++ {
-			similarity := s.calculateMemberSimilarity(members[i], members[j])
+			similarity := types.IdentitySimilarity(members[i], members[j])
 			similarities = append(similarities, similarity)
 		}
 	}
@@ -610,157 +955,17 @@ func (s *Service) calculateCohesionScore(members []types.Identity, config types.
 	return total / float64(len(similarities))
 }
 
-// calculateMemberSimilarity computes similarity between two members
-func (s *Service) calculateMemberSimilarity(member1, member2 types.Identity) float64 {
-	similarities := make([]float64, 0)
-
-	// Age similarity
-	if member1.RichAttributes != nil && member2.RichAttributes != nil &&
-		member1.RichAttributes.Demographics != nil && member2.RichAttributes.Demographics != nil {
-		age1 := int(member1.RichAttributes.Demographics.Age)
-		age2 := int(member2.RichAttributes.Demographics.Age)
-		ageDiff := math.Abs(float64(age1 - age2))
-		ageSim := math.Max(0, 1.0-ageDiff/50.0) // Normalize by 50-year span
-		similarities = append(similarities, ageSim)
-	}
-
-	// Political similarity
-	if member1.RichAttributes != nil && member2.RichAttributes != nil &&
-		member1.RichAttributes.PoliticalSocial != nil && member2.RichAttributes.PoliticalSocial != nil {
-		pol1Str := member1.RichAttributes.PoliticalSocial.PoliticalLeaning
-		pol2Str := member2.RichAttributes.PoliticalSocial.PoliticalLeaning
-		if pol1Str != "" && pol2Str != "" {
-			polSim := s.calculatePoliticalSimilarity(pol1Str, pol2Str)
-			similarities = append(similarities, polSim)
-		}
-	}
-
-	// Interest similarity
-	if member1.RichAttributes != nil && member2.RichAttributes != nil &&
-		member1.RichAttributes.Preferences != nil && member2.RichAttributes.Preferences != nil {
-		int1Slice := member1.RichAttributes.Preferences.Interests
-		int2Slice := member2.RichAttributes.Preferences.Interests
-		if len(int1Slice) > 0 && len(int2Slice) > 0 {
-			intSim := s.calculateInterestSimilarity(int1Slice, int2Slice)
-			similarities = append(similarities, intSim)
-		}
-	}
-
-	if len(similarities) == 0 {
-		return 0
-	}
-
-	// Average similarity across attributes
-	total := 0.0
-	for _, sim := range similarities {
-		total += sim
-	}
-
-	return total / float64(len(similarities))
-}
-
-// calculatePoliticalSimilarity computes similarity between political leanings
-func (s *Service) calculatePoliticalSimilarity(pol1, pol2 string) float64 {
-	politicalOrder := map[string]int{
-		"very_liberal":      0,
-		"liberal":           1,
-		"moderate":          2,
-		"conservative":      3,
-		"very_conservative": 4,
-	}
-
-	val1, ok1 := politicalOrder[pol1]
-	val2, ok2 := politicalOrder[pol2]
-
-	if !ok1 || !ok2 {
-		return 0
-	}
-
-	diff := math.Abs(float64(val1 - val2))
-	return math.Max(0, 1.0-diff/4.0) // Normalize by maximum difference
-}
-
-// calculateInterestSimilarity computes Jaccard similarity between interest lists
-func (s *Service) calculateInterestSimilarity(interests1, interests2 []string) float64 {
-	set1 := make(map[string]bool)
-	set2 := make(map[string]bool)
-
-	for _, interest := range interests1 {
-		set1[interest] = true
-	}
-	for _, interest := range interests2 {
-		set2[interest] = true
-	}
-
-	intersection := 0
-	union := len(set1)
-
-	for interest := range set2 {
-		if set1[interest] {
-			intersection++
-		} else {
-			union++
-		}
-	}
-
-	if union == 0 {
-		return 0
-	}
-
-	return float64(intersection) / float64(union)
-}
-
 // Helper functions for community attributes
 func (s *Service) calculateAverageAge(members []types.Identity) float64 {
-	total := 0.0
-	count := 0
-	for _, member := range members {
-		if member.RichAttributes != nil && member.RichAttributes.Demographics != nil {
-			age := int(member.RichAttributes.Demographics.Age)
-			if age > 0 {
-				total += float64(age)
-				count++
-			}
-		}
-	}
-	if count == 0 {
-		return 0
-	}
-	return total / float64(count)
+	return tallyMembers(members).averageAge()
 }
 
 func (s *Service) calculatePoliticalDistribution(members []types.Identity) map[string]float64 {
-	distribution := make(map[string]int)
-	total := 0
-	for _, member := range members {
-		if member.RichAttributes != nil && member.RichAttributes.PoliticalSocial != nil {
-			pol := member.RichAttributes.PoliticalSocial.PoliticalLeaning
-			if pol != "" {
-				distribution[pol]++
-				total++
-			}
-		}
-	}
-	result := make(map[string]float64)
-	for pol, count := range distribution {
-		result[pol] = float64(count) / float64(total)
-	}
-	return result
+	return tallyMembers(members).politicalDistribution()
 }
 
 func (s *Service) calculateLocationSpread(members []types.Identity) map[string]int {
-	locations := make(map[string]int)
-	for _, member := range members {
-		if member.RichAttributes != nil && member.RichAttributes.Demographics != nil && member.RichAttributes.Demographics.Location != nil {
-			city := member.RichAttributes.Demographics.Location.City
-			if city != "" {
-				locations[city]++
-			} else if member.RichAttributes.Demographics.Location.UrbanRural != "" {
-				locations[member.RichAttributes.Demographics.Location.UrbanRural]++
-			}
-		}
-	}
-	return locations
+	return tallyMembers(members).locations
 }
 
 // GetCommunity retrieves a community by ID
@@ -775,93 +980,131 @@ func (s *Service) ListCommunities(filter *types.CommunityFilter) ([]types.Commun
 
 // UpdateCommunity updates an existing community
 func (s *Service) UpdateCommunity(id string, community types.Community) error {
+	middleware.SanitizeCommunity(&community)
+	if err := middleware.ValidateCommunity(&community); err != nil {
+		return err
+	}
+
 	community.UpdatedAt = time.Now()
 	return s.storage.UpdateCommunity(id, community)
 }
 
 // DeleteCommunity removes a community
 func (s *Service) DeleteCommunity(id string) error {
-	return s.storage.DeleteCommunity(id)
+	if err := s.storage.DeleteCommunity(id); err != nil {
+		return err
+	}
+	s.metricsMu.Lock()
+	delete(s.metrics, id)
+	s.metricsMu.Unlock()
+	return nil
+}
+
+// StatsOptions controls how GetCommunityStatsWithOptions computes stats
+type StatsOptions struct {
+	// ForceRecompute recalculates diversity and cohesion even when the
+	// values stored on the community are current
+	ForceRecompute bool
+}
+
+// memberIDs returns the IDs of members
+func memberIDs(members []types.Identity) []string {
+	ids := make([]string, len(members))
+	for i, member := range members {
+		ids[i] = member.Id
+	}
+	return ids
+}
+
+// memberSetHash identifies a set of member IDs regardless of their order.
+// Hash the members that actually loaded rather than the community's
+// MemberIds, so a dangling ID does not make the stored metrics look stale.
+func memberSetHash(memberIds []string) string {
+	sorted := slices.Clone(memberIds)
+	slices.Sort(sorted)
+	h := sha256.New()
+	for _, id := range sorted {
+		h.Write([]byte(id))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 // GetCommunityStats generates analytics for a community
 func (s *Service) GetCommunityStats(communityId string) (*types.CommunityStats, error) {
+	return s.GetCommunityStatsWithOptions(communityId, StatsOptions{})
+}
+
+// GetCommunityStatsWithOptions generates analytics for a community.
+// Cohesion compares every pair of members, so diversity and cohesion are
+// reused while the member set is unchanged: the values stored on the
+// community when they are current, otherwise values computed by an earlier
+// call and kept in memory. Stats never write the community. Changes to the
+// members' own attributes are not detected; set ForceRecompute to pick them
+// up.
+func (s *Service) GetCommunityStatsWithOptions(communityId string, opts StatsOptions) (*types.CommunityStats, error) {
 	community, err := s.storage.GetCommunity(communityId)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get all community members
-	members := make([]types.Identity, 0, len(community.MemberIds))
-	for _, memberId := range community.MemberIds {
-		member, err := s.storage.GetIdentity(memberId)
-		if err != nil {
-			continue // Skip missing members
-		}
-		members = append(members, member)
-	}
-
-	stats := &types.CommunityStats{
-		CommunityId:     communityId,
-		MemberCount:     len(members),
-		AverageAge:      s.calculateAverageAge(members),
-		LocationSpread:  s.calculateLocationSpread(members),
-		PoliticalSpread: s.calculatePoliticalDistribution(members),
-		DiversityIndex:  s.calculateDiversityIndex(members),
-		CohesionScore:   s.calculateCohesionScore(members, community.GenerationConfig),
-		GeneratedAt:     time.Now(),
-	}
-
-	// Calculate active members (activity_level > 0.5)
-	activeCount := 0
-	for _, member := range members {
-		if member.RichAttributes != nil {
-			activityVal := member.RichAttributes.Custom["activity_level"]
-			if activityVal != "" {
-				if activityFloat, err := strconv.ParseFloat(activityVal, 64); err == nil && activityFloat > 0.5 {
-					activeCount++
-				}
-			}
-		}
-	}
-	stats.ActiveMembers = activeCount
-
-	// Calculate gender ratio
-	genderCount := make(map[string]int)
-	for _, member := range members {
-		if member.RichAttributes != nil && member.RichAttributes.Demographics != nil {
-			genderStr := member.RichAttributes.Demographics.Gender
-			if genderStr != "" {
-				genderCount[genderStr]++
-			}
-		}
+	// Tally members one at a time rather than loading them all
+	tally := newMemberTally()
+	memberIds := make([]string, 0, len(community.MemberIds))
+	err = storage.ForEachCommunityMember(s.storage, communityId, func(member types.Identity) error {
+		tally.add(member)
+		memberIds = append(memberIds, member.Id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	genderRatio := make(map[string]float64)
-	for gender, count := range genderCount {
-		genderRatio[gender] = float64(count) / float64(len(members))
+	diversity, cohesion := community.Diversity, community.Cohesion
+	if hash := memberSetHash(memberIds); opts.ForceRecompute || community.MetricsMemberHash != hash {
+		diversity, cohesion = s.currentMetrics(community, hash, opts.ForceRecompute)
 	}
-	stats.GenderRatio = genderRatio
 
-	// Calculate engagement score (average activity level)
-	totalActivity := 0.0
-	activityCount := 0
-	for _, member := range members {
-		if member.RichAttributes != nil {
-			activityVal := member.RichAttributes.Custom["activity_level"]
-			if activityVal != "" {
-				if activityFloat, err := strconv.ParseFloat(activityVal, 64); err == nil {
-					totalActivity += activityFloat
-					activityCount++
-				}
-			}
-		}
-	}
-	if activityCount > 0 {
-		stats.EngagementScore = totalActivity / float64(activityCount)
-	}
+	return &types.CommunityStats{
+		CommunityId:     communityId,
+		MemberCount:     tally.members,
+		ActiveMembers:   tally.activeMembers,
+		AverageAge:      tally.averageAge(),
+		GenderRatio:     tally.genderRatio(),
+		LocationSpread:  tally.locations,
+		PoliticalSpread: tally.politicalDistribution(),
+		DiversityIndex:  diversity,
+		CohesionScore:   cohesion,
+		EngagementScore: tally.engagementScore(),
+		GeneratedAt:     time.Now(),
+	}, nil
+}
 
-	return stats, nil
+// currentMetrics returns diversity and cohesion for a community whose
+// stored values do not match its member set hash. Results are kept in
+// memory rather than written to the community: a stats read must not race
+// membership changes made between its read and a write. The stored values
+// are refreshed by RecalculateCommunityMetrics and by operations that
+// rebuild a community.
+func (s *Service) currentMetrics(community types.Community, hash string, force bool) (float64, float64) {
+	s.metricsMu.Lock()
+	cached, ok := s.metrics[community.Id]
+	s.metricsMu.Unlock()
+	if ok && !force && cached.memberHash == hash {
+		return cached.diversity, cached.cohesion
+	}
+
+	// Cohesion compares every pair, so these need all members at once
+	members := s.loadMembers(community)
+	cached = cachedMetrics{
+		memberHash: hash,
+		diversity:  s.calculateDiversityIndex(members),
+		cohesion:   s.cohesionScore(members, community.GenerationConfig),
+	}
+	s.metricsMu.Lock()
+	s.metrics[community.Id] = cached
+	s.metricsMu.Unlock()
+	return cached.diversity, cached.cohesion
 }
 
 // AddMemberToCommunity adds an existing identity to a community
@@ -893,6 +1136,7 @@ func (s *Service) AddMemberToCommunity(communityId, identityId string) error {
 	community.MemberIds = append(community.MemberIds, identityId)
 	community.Size = len(community.MemberIds)
 	community.UpdatedAt = time.Now()
+	s.recalculateMetrics(&community)
 
 	return s.storage.UpdateCommunity(communityId, community)
 }
@@ -928,15 +1172,35 @@ func (s *Service) RemoveMemberFromCommunity(communityId, identityId string) erro
 	community.MemberIds = newMemberIds
 	community.Size = len(community.MemberIds)
 	community.UpdatedAt = time.Now()
+	s.recalculateMetrics(&community)
 
 	return s.storage.UpdateCommunity(communityId, community)
 }
 
-// Utility functions
-func generateID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+// RecalculateCommunityMetrics reloads a community's members and recomputes
+// and saves its diversity, cohesion and attributes. Use it after members
+// were changed outside the service, for example by editing their
+// identities.
+func (s *Service) RecalculateCommunityMetrics(id string) error {
+	community, err := s.storage.GetCommunity(id)
+	if err != nil {
+		return err
+	}
+
+	s.recalculateMetrics(&community)
+	community.UpdatedAt = time.Now()
+	return s.storage.UpdateCommunity(id, community)
 }
 
+// recalculateMetrics recomputes a community's metrics from its stored members
+func (s *Service) recalculateMetrics(community *types.Community) {
+	if community.Attributes == nil {
+		community.Attributes = make(map[string]interface{})
+	}
+	s.calculateCommunityMetrics(community, s.loadMembers(*community))
+}
+
+// Utility functions
 func max(a, b int) int {
 	if a > b {
 		return a
@@ -950,12 +1214,22 @@ func mapToLocation(loc map[string]interface{}) *types.Location {
 	if city, ok := loc["city"].(string); ok {
 		l.City = city
 	}
-	if locType, ok := loc["type"].(string); ok {
-		l.UrbanRural = locType // Map "type" to UrbanRural if present
+	if urban, ok := loc["urban"].(bool); ok {
+		if urban {
+			l.UrbanRural = "urban"
+		} else {
+			l.UrbanRural = "rural"
+		}
 	}
 	if timezone, ok := loc["timezone"].(string); ok {
 		l.Timezone = timezone
 	}
+	if latitude, ok := loc["latitude"].(float64); ok {
+		l.Latitude = latitude
+	}
+	if longitude, ok := loc["longitude"].(float64); ok {
+		l.Longitude = longitude
+	}
 	if country, ok := loc["country"].(string); ok {
 		l.Country = country
 	}
@@ -0,0 +1,1545 @@
+package community
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+func newTestService(t *testing.T) (*Service, storage.Storage) {
+	t.Helper()
+	store := storage.NewMemoryStorage()
+	p := &types.Persona{
+		Name:   "Test Persona",
+		Topic:  "Testing",
+		Prompt: "You are a test persona.",
+	}
+	if err := store.Create(p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	return NewService(store), store
+}
+
+func testGenerationConfig() types.CommunityGenerationConfig {
+	return types.CommunityGenerationConfig{
+		AgeDistribution: types.AgeDistribution{
+			Mean:   40,
+			StdDev: 15,
+			MinAge: 18,
+			MaxAge: 80,
+		},
+		LocationConstraint: types.LocationConstraint{Type: "global"},
+		PoliticalSpread:    0.8,
+		InterestSpread:     0.8,
+		SocioeconomicRange: 0.8,
+		ActivityLevel:      0.5,
+	}
+}
+
+func TestGenerateCommunity_MinDiversityReachable(t *testing.T) {
+	service, store := newTestService(t)
+
+	config := testGenerationConfig()
+	minDiversity := 0.3
+	config.MinDiversity = &minDiversity
+
+	community, err := service.GenerateCommunity(config, "Diverse", "A diverse community", "demographic", 30)
+	if err != nil {
+		t.Fatalf("Expected community generation to succeed, got %v", err)
+	}
+	if community.Diversity < minDiversity {
+		t.Errorf("Expected diversity >= %.2f, got %.3f", minDiversity, community.Diversity)
+	}
+	if community.Size != 30 {
+		t.Errorf("Expected 30 members, got %d", community.Size)
+	}
+
+	identities, err := store.ListIdentities(nil)
+	if err != nil {
+		t.Fatalf("Failed to list identities: %v", err)
+	}
+	if len(identities) != 30 {
+		t.Errorf("Expected only the accepted 30 members to be stored, got %d", len(identities))
+	}
+}
+
+func TestGenerateCommunity_MinDiversityUnreachable(t *testing.T) {
+	service, store := newTestService(t)
+
+	// Pin age so age diversity is always zero, capping overall diversity at 0.75
+	config := testGenerationConfig()
+	config.AgeDistribution = types.AgeDistribution{Mean: 30, MinAge: 30, MaxAge: 30}
+	minDiversity := 0.999
+	config.MinDiversity = &minDiversity
+	config.MaxGenerationAttempts = 3
+
+	community, err := service.GenerateCommunity(config, "Tiny", "Too small to be diverse", "demographic", 3)
+	if err == nil {
+		t.Fatalf("Expected error for unreachable diversity, got community with diversity %.3f", community.Diversity)
+	}
+	if !strings.Contains(err.Error(), "minimum diversity") {
+		t.Errorf("Expected minimum diversity error, got %v", err)
+	}
+
+	// Nothing should be persisted for a rejected generation
+	identities, _ := store.ListIdentities(nil)
+	if len(identities) != 0 {
+		t.Errorf("Expected no identities to be stored, got %d", len(identities))
+	}
+	communities, _ := store.ListCommunities(nil)
+	if len(communities) != 0 {
+		t.Errorf("Expected no communities to be stored, got %d", len(communities))
+	}
+}
+
+func TestGenerateCommunity_InvalidMinDiversity(t *testing.T) {
+	service, _ := newTestService(t)
+
+	config := testGenerationConfig()
+	minDiversity := 1.5
+	config.MinDiversity = &minDiversity
+
+	if _, err := service.GenerateCommunity(config, "Invalid", "", "demographic", 5); err == nil {
+		t.Error("Expected error for min diversity outside [0, 1]")
+	}
+}
+
+func TestGenerateCommunity_TargetDiversity(t *testing.T) {
+	service, _ := newTestService(t)
+
+	// Alternate narrow and wide political spreads so the first, default
+	// attempt is the less diverse one
+	config := testGenerationConfig()
+	var calls int
+	service.memberGenerator = func(config types.CommunityGenerationConfig, count int) ([]types.Identity, error) {
+		calls++
+		if calls%2 == 1 {
+			config.PoliticalSpread = 0
+		} else {
+			config.PoliticalSpread = 1
+		}
+		return service.generateMembers(config, count)
+	}
+
+	baseline, err := service.GenerateCommunity(config, "Baseline", "", "demographic", 30)
+	if err != nil {
+		t.Fatalf("Failed to generate baseline community: %v", err)
+	}
+	if _, ok := baseline.Attributes["diversity_warning"]; ok {
+		t.Error("Expected no diversity warning without a target")
+	}
+
+	config.TargetDiversity = 1.0
+	config.MaxGenerationAttempts = 4
+	targeted, err := service.GenerateCommunity(config, "Targeted", "", "demographic", 30)
+	if err != nil {
+		t.Fatalf("Failed to generate targeted community: %v", err)
+	}
+	if math.Abs(targeted.Diversity-1.0) >= math.Abs(baseline.Diversity-1.0) {
+		t.Errorf("Expected diversity closer to the target than %.3f, got %.3f", baseline.Diversity, targeted.Diversity)
+	}
+
+	// A tolerance no member set meets uses every attempt and keeps the closest
+	calls = 0
+	config.DiversityTolerance = 1e-9
+	missed, err := service.GenerateCommunity(config, "Missed", "", "demographic", 30)
+	if err != nil {
+		t.Fatalf("Failed to generate community: %v", err)
+	}
+	if calls != 4 {
+		t.Errorf("Expected all 4 attempts to be used, got %d", calls)
+	}
+	if _, ok := missed.Attributes["diversity_warning"]; !ok {
+		t.Error("Expected a diversity warning for a missed target")
+	}
+
+	config.TargetDiversity = 1.5
+	if _, err := service.GenerateCommunity(config, "Invalid", "", "demographic", 5); err == nil {
+		t.Error("Expected error for target diversity above 1")
+	}
+}
+
+func TestGenerateCommunity_Timeout(t *testing.T) {
+	service, store := newTestService(t)
+	service.SetGenerationTimeout(20 * time.Millisecond)
+
+	// Artificially slow generator that outlives the deadline
+	release := make(chan struct{})
+	defer close(release)
+	service.memberGenerator = func(config types.CommunityGenerationConfig, count int) ([]types.Identity, error) {
+		<-release
+		return service.generateMembers(config, count)
+	}
+
+	start := time.Now()
+	_, err := service.GenerateCommunity(testGenerationConfig(), "Slow", "Never finishes", "demographic", 5)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected timeout to fire promptly, took %v", elapsed)
+	}
+
+	identities, _ := store.ListIdentities(nil)
+	if len(identities) != 0 {
+		t.Errorf("Expected no identities to be stored, got %d", len(identities))
+	}
+	communities, _ := store.ListCommunities(nil)
+	if len(communities) != 0 {
+		t.Errorf("Expected no communities to be stored, got %d", len(communities))
+	}
+}
+
+func TestGenerateCommunityContext_RollsBackOnCancel(t *testing.T) {
+	service, store := newTestService(t)
+
+	// Cancel once members are generated but before they are stored
+	ctx, cancel := context.WithCancel(context.Background())
+	service.memberGenerator = func(config types.CommunityGenerationConfig, count int) ([]types.Identity, error) {
+		defer cancel()
+		return service.generateMembers(config, count)
+	}
+
+	_, err := service.GenerateCommunityContext(ctx, testGenerationConfig(), "Cancelled", "", "demographic", 5)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected canceled error, got %v", err)
+	}
+
+	identities, _ := store.ListIdentities(nil)
+	if len(identities) != 0 {
+		t.Errorf("Expected no identities to be stored, got %d", len(identities))
+	}
+}
+
+func TestGenerateCommunity_TargetDiversityByDimension(t *testing.T) {
+	service, _ := newTestService(t)
+
+	// A narrow political spread keeps the default distribution near "moderate"
+	config := testGenerationConfig()
+	config.PoliticalSpread = 0.1
+
+	politicalLeanings := func(c *types.Community) map[string]int {
+		t.Helper()
+		counts := make(map[string]int)
+		for _, id := range c.MemberIds {
+			identity, err := service.storage.GetIdentity(id)
+			if err != nil {
+				t.Fatalf("Failed to get member: %v", err)
+			}
+			counts[identity.RichAttributes.PoliticalSocial.PoliticalLeaning]++
+		}
+		return counts
+	}
+
+	baseline, err := service.GenerateCommunity(config, "Baseline", "", "political", 50)
+	if err != nil {
+		t.Fatalf("Failed to generate baseline community: %v", err)
+	}
+
+	config.TargetDiversityByDimension = map[string]float64{DimensionPolitical: 1.0}
+	targeted, err := service.GenerateCommunity(config, "Targeted", "", "political", 50)
+	if err != nil {
+		t.Fatalf("Failed to generate targeted community: %v", err)
+	}
+
+	baselineCounts := politicalLeanings(baseline)
+	targetedCounts := politicalLeanings(targeted)
+	if len(targetedCounts) <= len(baselineCounts) {
+		t.Errorf("Expected broader political distribution with target, got %v vs baseline %v", targetedCounts, baselineCounts)
+	}
+	if len(targetedCounts) != len(dimensionCategories[DimensionPolitical]) {
+		t.Errorf("Expected every political category to be represented, got %v", targetedCounts)
+	}
+
+	achieved, ok := targeted.Attributes["diversity_by_dimension"].(map[string]float64)
+	if !ok {
+		t.Fatalf("Expected achieved diversity to be reported, got %v", targeted.Attributes)
+	}
+	if achieved[DimensionPolitical] < 0.9 {
+		t.Errorf("Expected political diversity near target, got %.3f", achieved[DimensionPolitical])
+	}
+	if _, ok := baseline.Attributes["diversity_by_dimension"]; ok {
+		t.Error("Expected no per-dimension report without targets")
+	}
+}
+
+func TestGenerateCommunity_InvalidDimensionTarget(t *testing.T) {
+	service, _ := newTestService(t)
+
+	tests := map[string]map[string]float64{
+		"unknown dimension": {"shoe_size": 0.5},
+		"out of range":      {DimensionPolitical: 1.5},
+	}
+	for name, targets := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := testGenerationConfig()
+			config.TargetDiversityByDimension = targets
+			if _, err := service.GenerateCommunity(config, "Invalid", "", "demographic", 5); err == nil {
+				t.Error("Expected error for invalid dimension target")
+			}
+		})
+	}
+}
+
+func TestGenerateCommunity_GenderDistribution(t *testing.T) {
+	service, _ := newTestService(t)
+
+	config := testGenerationConfig()
+	config.GenderDistribution = map[string]float64{"female": 2, "non-binary": 2, "male": 0}
+
+	community, err := service.GenerateCommunity(config, "Gendered", "", "demographic", 40)
+	if err != nil {
+		t.Fatalf("Failed to generate community: %v", err)
+	}
+
+	// Weights are stored normalized, with zero weights dropped
+	if w := community.GenerationConfig.GenderDistribution["female"]; w != 0.5 {
+		t.Errorf("Expected normalized female weight 0.5, got %v", w)
+	}
+	if _, ok := community.GenerationConfig.GenderDistribution["male"]; ok {
+		t.Error("Expected zero-weight gender to be dropped")
+	}
+
+	stats, err := service.GetCommunityStats(community.Id)
+	if err != nil {
+		t.Fatalf("Failed to get community stats: %v", err)
+	}
+	if stats.GenderRatio["male"] != 0 {
+		t.Errorf("Expected no male members, got ratio %v", stats.GenderRatio["male"])
+	}
+	if stats.GenderRatio["non-binary"] == 0 || stats.GenderRatio["female"] == 0 {
+		t.Errorf("Expected female and non-binary members, got %v", stats.GenderRatio)
+	}
+	if total := stats.GenderRatio["female"] + stats.GenderRatio["non-binary"]; total < 0.999 {
+		t.Errorf("Expected all members to have a configured gender, got %v", stats.GenderRatio)
+	}
+}
+
+func TestGenerateCommunity_InvalidGenderDistribution(t *testing.T) {
+	service, _ := newTestService(t)
+
+	tests := map[string]map[string]float64{
+		"negative weight": {"female": 1, "male": -1},
+		"all zero":        {"female": 0, "male": 0},
+	}
+	for name, distribution := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := testGenerationConfig()
+			config.GenderDistribution = distribution
+			if _, err := service.GenerateCommunity(config, "Invalid", "", "demographic", 5); err == nil {
+				t.Error("Expected error for invalid gender distribution")
+			}
+		})
+	}
+}
+
+func TestGenerateCommunity_UnknownPersonaWeight(t *testing.T) {
+	service, store := newTestService(t)
+	personas, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := testGenerationConfig()
+	config.PersonaWeights = map[string]float64{personas[0].Id: 1, "ghost-2": 1, "ghost-1": 0.5}
+	_, err = service.GenerateCommunity(config, "Haunted", "Unknown weights", "interest", 3)
+	if !errors.Is(err, errs.ErrValidation) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "ghost-1, ghost-2") {
+		t.Errorf("Expected the error to list the unknown IDs, got %v", err)
+	}
+
+	identities, err := store.ListIdentities(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 0 {
+		t.Errorf("Expected no members to be stored, got %d", len(identities))
+	}
+}
+
+func TestGenerateCommunity_AllZeroPersonaWeights(t *testing.T) {
+	service, store := newTestService(t)
+	personas, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := testGenerationConfig()
+	config.PersonaWeights = map[string]float64{personas[0].Id: 0}
+	if _, err := service.GenerateCommunity(config, "Weightless", "Zero weights", "interest", 3); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("Expected a validation error for all-zero weights, got %v", err)
+	}
+
+	config.PersonaWeights = map[string]float64{personas[0].Id: -1}
+	if _, err := service.GenerateCommunity(config, "Weightless", "Negative weights", "interest", 3); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("Expected a validation error for negative weights, got %v", err)
+	}
+}
+
+func TestWriteMembersCSV(t *testing.T) {
+	members := []types.Identity{
+		{
+			Id:   "m1",
+			Name: "Alice, Jr.",
+			RichAttributes: &types.RichAttributes{
+				Demographics: &types.Demographics{
+					Age:       34,
+					Gender:    "female",
+					Education: "bachelor",
+					Location:  &types.Location{City: "Portland"},
+				},
+				PoliticalSocial: &types.PoliticalSocial{PoliticalLeaning: "moderate"},
+				Custom:          map[string]string{"activity_level": "0.750000"},
+			},
+		},
+		{Id: "m2", Name: "Bob"},
+	}
+
+	var buf strings.Builder
+	if err := WriteMembersCSV(&buf, members); err != nil {
+		t.Fatalf("WriteMembersCSV failed: %v", err)
+	}
+
+	want := "id,name,age,gender,political_leaning,education,city,activity_level\n" +
+		"m1,\"Alice, Jr.\",34,female,moderate,bachelor,Portland,0.750000\n" +
+		"m2,Bob,,,,,,\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected CSV:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteMembersCSV_EscapesFormulas(t *testing.T) {
+	members := []types.Identity{
+		{
+			Id:   "m1",
+			Name: "=HYPERLINK(\"http://example.com\")",
+			RichAttributes: &types.RichAttributes{
+				Demographics: &types.Demographics{
+					Gender:   "+1",
+					Location: &types.Location{City: "@SUM(A1)"},
+				},
+				Custom: map[string]string{"activity_level": "-2+3"},
+			},
+		},
+		{Id: "m2", Name: "Bob = Bobby"},
+	}
+
+	var buf strings.Builder
+	if err := WriteMembersCSV(&buf, members); err != nil {
+		t.Fatalf("WriteMembersCSV failed: %v", err)
+	}
+
+	want := "id,name,age,gender,political_leaning,education,city,activity_level\n" +
+		"m1,\"'=HYPERLINK(\"\"http://example.com\"\")\",,'+1,,,'@SUM(A1),'-2+3\n" +
+		"m2,Bob = Bobby,,,,,,\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected CSV:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestGetCommunityMembers(t *testing.T) {
+	service, _ := newTestService(t)
+
+	community, err := service.GenerateCommunity(testGenerationConfig(), "Members", "Member lookup", "interest", 4)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+
+	members, err := service.GetCommunityMembers(community.Id)
+	if err != nil {
+		t.Fatalf("GetCommunityMembers failed: %v", err)
+	}
+	if len(members) != len(community.MemberIds) {
+		t.Errorf("Expected %d members, got %d", len(community.MemberIds), len(members))
+	}
+
+	if _, err := service.GetCommunityMembers("missing"); err == nil {
+		t.Error("Expected error for missing community")
+	}
+}
+
+func TestMergeCommunities(t *testing.T) {
+	service, store := newTestService(t)
+
+	target, err := service.GenerateCommunity(testGenerationConfig(), "Target", "Merge target", "interest", 4)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+	source, err := service.GenerateCommunity(testGenerationConfig(), "Source", "Merge source", "interest", 3)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+
+	// Share one member so the merge has to deduplicate
+	source.MemberIds = append(source.MemberIds, target.MemberIds[0])
+	if err := store.UpdateCommunity(source.Id, *source); err != nil {
+		t.Fatalf("Failed to update source: %v", err)
+	}
+
+	merged, err := service.MergeCommunities(target.Id, source.Id, true)
+	if err != nil {
+		t.Fatalf("MergeCommunities failed: %v", err)
+	}
+	if merged.Size != 7 || len(merged.MemberIds) != 7 {
+		t.Errorf("Expected 7 deduplicated members, got size %d with %d ids", merged.Size, len(merged.MemberIds))
+	}
+	if merged.Attributes["average_age"] == nil {
+		t.Error("Expected metrics to be recalculated")
+	}
+
+	stored, err := store.GetCommunity(target.Id)
+	if err != nil {
+		t.Fatalf("Failed to get target: %v", err)
+	}
+	if len(stored.MemberIds) != 7 {
+		t.Errorf("Expected stored target to have 7 members, got %d", len(stored.MemberIds))
+	}
+	if _, err := store.GetCommunity(source.Id); err == nil {
+		t.Error("Expected source community to be deleted")
+	}
+
+	if _, err := service.MergeCommunities(target.Id, target.Id, false); err == nil {
+		t.Error("Expected error when merging a community into itself")
+	}
+	if _, err := service.MergeCommunities(target.Id, "missing", false); err == nil {
+		t.Error("Expected error for missing source community")
+	}
+}
+
+func TestCommunityBundleRoundTrip(t *testing.T) {
+	service, store := newTestService(t)
+
+	original, err := service.GenerateCommunity(testGenerationConfig(), "Bundled", "Shared elsewhere", "interest", 5)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+
+	// Give the members' persona a parent so the bundle has to carry it too
+	parent := &types.Persona{Name: "Parent", Topic: "Testing", Prompt: "You are a parent persona."}
+	if err := store.Create(parent); err != nil {
+		t.Fatalf("Failed to create parent: %v", err)
+	}
+	member, err := store.GetIdentity(original.MemberIds[0])
+	if err != nil {
+		t.Fatalf("Failed to get member: %v", err)
+	}
+	child, err := store.Get(member.PersonaId)
+	if err != nil {
+		t.Fatalf("Failed to get persona: %v", err)
+	}
+	child.ParentId = parent.Id
+	if err := store.Update(child.Id, child); err != nil {
+		t.Fatalf("Failed to set parent: %v", err)
+	}
+
+	data, err := service.ExportCommunityBundle(original.Id)
+	if err != nil {
+		t.Fatalf("ExportCommunityBundle failed: %v", err)
+	}
+
+	fresh := storage.NewMemoryStorage()
+	imported, err := NewService(fresh).ImportCommunityBundle(data)
+	if err != nil {
+		t.Fatalf("ImportCommunityBundle failed: %v", err)
+	}
+	if imported.Name != original.Name || imported.Size != 5 || len(imported.MemberIds) != 5 {
+		t.Fatalf("Expected 5 members named %q, got %q with size %d and %d ids", original.Name, imported.Name, imported.Size, len(imported.MemberIds))
+	}
+	if _, err := fresh.GetCommunity(imported.Id); err != nil {
+		t.Errorf("Expected the imported community to be stored: %v", err)
+	}
+
+	for _, id := range imported.MemberIds {
+		member, err := fresh.GetIdentity(id)
+		if err != nil {
+			t.Fatalf("Member %s does not resolve: %v", id, err)
+		}
+		p, err := fresh.Get(member.PersonaId)
+		if err != nil {
+			t.Fatalf("Persona %s of member %s does not resolve: %v", member.PersonaId, id, err)
+		}
+		if p.Name != child.Name {
+			t.Errorf("Expected persona %q, got %q", child.Name, p.Name)
+		}
+		if p.ParentId == "" {
+			t.Fatal("Expected the persona's parent link to be kept")
+		}
+		if ancestor, err := fresh.Get(p.ParentId); err != nil || ancestor.Name != parent.Name {
+			t.Errorf("Expected parent %q to resolve, got %+v, %v", parent.Name, ancestor, err)
+		}
+	}
+
+	personas, err := fresh.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(personas) != 2 {
+		t.Errorf("Expected only the referenced persona and its parent, got %d personas", len(personas))
+	}
+}
+
+func TestImportCommunityBundle_Invalid(t *testing.T) {
+	fresh := storage.NewMemoryStorage()
+	service := NewService(fresh)
+
+	bundle := `{
+		"community": {"name": "Orphans", "type": "interest", "member_ids": ["i1"]},
+		"identities": [{"id": "i1", "persona_id": "missing", "name": "Orphan"}],
+		"personas": [{"id": "p1", "name": "Unused", "topic": "Testing", "prompt": "You are unused."}]
+	}`
+	if _, err := service.ImportCommunityBundle([]byte(bundle)); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("Expected ErrValidation for an unresolved persona, got %v", err)
+	}
+	if _, err := service.ImportCommunityBundle([]byte("not json")); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("Expected ErrValidation for malformed JSON, got %v", err)
+	}
+
+	if personas, _ := fresh.List(); len(personas) != 0 {
+		t.Errorf("Expected a rejected bundle to write nothing, got %d personas", len(personas))
+	}
+}
+
+func TestMergeCommunities_ExceedsMaxMembers(t *testing.T) {
+	service, store := newTestService(t)
+
+	target, err := service.GenerateCommunity(testGenerationConfig(), "Small", "Small target", "interest", 2)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+	source, err := service.GenerateCommunity(testGenerationConfig(), "Large", "Large source", "interest", 3)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+
+	_, err = service.MergeCommunities(target.Id, source.Id, true)
+	if !errors.Is(err, ErrCommunityFull) {
+		t.Fatalf("Expected ErrCommunityFull, got %v", err)
+	}
+
+	unchanged, err := store.GetCommunity(target.Id)
+	if err != nil {
+		t.Fatalf("Failed to get target: %v", err)
+	}
+	if len(unchanged.MemberIds) != 2 {
+		t.Errorf("Expected target to keep 2 members, got %d", len(unchanged.MemberIds))
+	}
+	if _, err := store.GetCommunity(source.Id); err != nil {
+		t.Error("Expected source community to survive a failed merge")
+	}
+}
+
+func TestSplitCommunity(t *testing.T) {
+	service, store := newTestService(t)
+	personas, err := store.List()
+	if err != nil {
+		t.Fatalf("Failed to list personas: %v", err)
+	}
+	personaID := personas[0].Id
+
+	leanings := []string{"liberal", "conservative", "liberal", ""}
+	memberIds := make([]string, 0, len(leanings)+1)
+	for _, leaning := range leanings {
+		member := types.Identity{PersonaId: personaID, Name: "Member", RichAttributes: &types.RichAttributes{}}
+		if leaning != "" {
+			member.RichAttributes.PoliticalSocial = &types.PoliticalSocial{PoliticalLeaning: leaning}
+		}
+		if err := store.CreateIdentity(&member); err != nil {
+			t.Fatalf("Failed to create identity: %v", err)
+		}
+		memberIds = append(memberIds, member.Id)
+	}
+	bare := types.Identity{PersonaId: personaID, Name: "No Attributes"}
+	if err := store.CreateIdentity(&bare); err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	memberIds = append(memberIds, bare.Id)
+
+	parent := types.Community{
+		Name:             "Parent",
+		Type:             "political",
+		MemberIds:        memberIds,
+		MaxMembers:       10,
+		GenerationConfig: testGenerationConfig(),
+	}
+	if err := store.CreateCommunity(&parent); err != nil {
+		t.Fatalf("Failed to create community: %v", err)
+	}
+
+	children, err := service.SplitCommunity(parent.Id, "political_leaning", false)
+	if err != nil {
+		t.Fatalf("SplitCommunity failed: %v", err)
+	}
+
+	want := map[string]int{"conservative": 1, "liberal": 2, "unspecified": 2}
+	if len(children) != len(want) {
+		t.Fatalf("Expected %d children, got %d", len(want), len(children))
+	}
+	for _, child := range children {
+		value, _ := child.Attributes["political_leaning"].(string)
+		if child.Size != want[value] || len(child.MemberIds) != want[value] {
+			t.Errorf("Expected %d members for %q, got %d", want[value], value, child.Size)
+		}
+		if child.GenerationConfig.PoliticalSpread != parent.GenerationConfig.PoliticalSpread {
+			t.Errorf("Expected child %q to inherit the generation config", value)
+		}
+		if _, err := store.GetCommunity(child.Id); err != nil {
+			t.Errorf("Expected child %q to be stored: %v", value, err)
+		}
+	}
+	if _, err := store.GetCommunity(parent.Id); err != nil {
+		t.Error("Expected parent to be kept without deleteParent")
+	}
+
+	if _, err := service.SplitCommunity(parent.Id, "shoe_size", false); err == nil {
+		t.Error("Expected error for unsupported attribute")
+	}
+
+	if _, err := service.SplitCommunity(parent.Id, "gender", true); err != nil {
+		t.Fatalf("SplitCommunity with deleteParent failed: %v", err)
+	}
+	if _, err := store.GetCommunity(parent.Id); err == nil {
+		t.Error("Expected parent to be deleted")
+	}
+}
+
+func TestGenerateCommunity_MemberDemographics(t *testing.T) {
+	service, store := newTestService(t)
+
+	urban := false
+	config := testGenerationConfig()
+	config.LocationConstraint.Urban = &urban
+
+	community, err := service.GenerateCommunity(config, "Populated", "Populated members", "demographic", 10)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+
+	for _, id := range community.MemberIds {
+		member, err := store.GetIdentity(id)
+		if err != nil {
+			t.Fatalf("Failed to get member: %v", err)
+		}
+		dem := member.RichAttributes.GetDemographics()
+		if dem.GetAge() == 0 {
+			t.Errorf("Expected member %s to have an age", id)
+		}
+		if dem.GetGender() == "" {
+			t.Errorf("Expected member %s to have a gender", id)
+		}
+		if dem.GetLocation().GetCity() == "" {
+			t.Errorf("Expected member %s to have a city", id)
+		}
+		if got := dem.GetLocation().GetUrbanRural(); got != "rural" {
+			t.Errorf("Expected member %s to be rural, got %q", id, got)
+		}
+	}
+}
+
+func TestGenerateCommunity_PersonaConsistencyEducation(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	p := &types.Persona{Name: "Engineer", Topic: "Software Engineering", Prompt: "You write software."}
+	if err := store.Create(p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	service := NewService(store)
+
+	config := testGenerationConfig()
+	config.PersonaConsistency = 1
+	community, err := service.GenerateCommunity(config, "Engineers", "Consistent members", "professional", 20)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+
+	known := dimensionCategories[DimensionEducation]
+	for _, id := range community.MemberIds {
+		member, err := store.GetIdentity(id)
+		if err != nil {
+			t.Fatalf("Failed to get member: %v", err)
+		}
+		education := member.RichAttributes.GetDemographics().GetEducation()
+		if !slices.Contains(known, education) {
+			t.Errorf("Expected member %s to have one of %v, got %q", id, known, education)
+		}
+	}
+}
+
+func TestGenerateCommunity_Relationships(t *testing.T) {
+	service, store := newTestService(t)
+
+	config := testGenerationConfig()
+	config.GenerateRelationships = true
+	config.NetworkDensity = 1 // Link every pair
+
+	community, err := service.GenerateCommunity(config, "Connected", "Fully connected", "interest", 5)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, id := range community.MemberIds {
+		relationships, err := store.ListRelationships(id)
+		if err != nil {
+			t.Fatalf("Failed to list relationships: %v", err)
+		}
+		if len(relationships) != len(community.MemberIds)-1 {
+			t.Errorf("Expected member %s to know %d others, got %d", id, len(community.MemberIds)-1, len(relationships))
+		}
+		for _, r := range relationships {
+			seen[r.Id] = true
+			if r.Strength < 0 || r.Strength > 1 {
+				t.Errorf("Expected strength within [0, 1], got %v", r.Strength)
+			}
+		}
+	}
+	if len(seen) != 10 {
+		t.Errorf("Expected 10 relationships among 5 members, got %d", len(seen))
+	}
+
+	unlinked, err := service.GenerateCommunity(testGenerationConfig(), "Unlinked", "No relationships", "interest", 3)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+	for _, id := range unlinked.MemberIds {
+		if relationships, _ := store.ListRelationships(id); len(relationships) != 0 {
+			t.Errorf("Expected no relationships without generate_relationships, got %d", len(relationships))
+		}
+	}
+}
+
+func TestGenerateLocation_Geography(t *testing.T) {
+	service, store := newTestService(t)
+
+	location := service.generateLocation(types.LocationConstraint{Type: "city", Locations: []string{"Chicago"}})
+	if location["city"] != "Chicago" || location["region"] != "Illinois" || location["country"] != "United States" || location["timezone"] != "America/Chicago" {
+		t.Errorf("Expected Chicago to be completed from the geography, got %v", location)
+	}
+
+	for range 50 {
+		location := service.generateLocation(types.LocationConstraint{Type: "country", Locations: []string{"japan"}})
+		if location["country"] != "Japan" || location["timezone"] != "Asia/Tokyo" {
+			t.Fatalf("Expected a place in Japan, got %v", location)
+		}
+		if p, ok := placeForCity(location["city"].(string)); !ok || p.Country != "Japan" {
+			t.Fatalf("Expected a Japanese city, got %v", location)
+		}
+	}
+
+	// A preferred timezone picks the matching places of a region
+	location = service.generateLocation(types.LocationConstraint{Type: "region", Locations: []string{"Texas"}, Timezone: "America/Denver"})
+	if location["city"] != "El Paso" {
+		t.Errorf("Expected El Paso as the Texan city in America/Denver, got %v", location)
+	}
+
+	// Unknown places keep what was asked for and nothing more
+	location = service.generateLocation(types.LocationConstraint{Type: "city", Locations: []string{"Atlantis"}, Timezone: "Etc/UTC"})
+	if location["city"] != "Atlantis" || location["country"] != nil || location["timezone"] != "Etc/UTC" {
+		t.Errorf("Expected only the city and preferred timezone for an unknown city, got %v", location)
+	}
+
+	// Generated members, including cities swapped in by balancing, have
+	// consistent locations
+	config := testGenerationConfig()
+	config.TargetDiversityByDimension = map[string]float64{DimensionLocation: 1}
+	community, err := service.GenerateCommunity(config, "Travellers", "Everywhere", "geographic", 20)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+	for _, id := range community.MemberIds {
+		member, err := store.GetIdentity(id)
+		if err != nil {
+			t.Fatalf("Failed to get member: %v", err)
+		}
+		loc := member.RichAttributes.GetDemographics().GetLocation()
+		p, ok := placeForCity(loc.GetCity())
+		if !ok {
+			t.Fatalf("Expected a city from the geography, got %v", loc)
+		}
+		if loc.GetCountry() != p.Country || loc.GetRegion() != p.Region || loc.GetTimezone() != p.Timezone {
+			t.Errorf("Expected %s to be in %s, %s (%s), got %v", p.City, p.Region, p.Country, p.Timezone, loc)
+		}
+	}
+}
+
+func TestGenerateCommunity_GeoRadius(t *testing.T) {
+	service, store := newTestService(t)
+
+	// 60 km around Manhattan takes in the New York metro area but not
+	// Philadelphia or Boston
+	constraint := types.LocationConstraint{Type: "geo", CenterLat: 40.7128, CenterLng: -74.0060, RadiusKm: 60}
+	config := testGenerationConfig()
+	config.LocationConstraint = constraint
+	config.TargetDiversityByDimension = map[string]float64{DimensionLocation: 0.5}
+
+	community, err := service.GenerateCommunity(config, "Metro", "New York metro area", "geographic", 30)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+	cities := make(map[string]bool)
+	for _, id := range community.MemberIds {
+		member, err := store.GetIdentity(id)
+		if err != nil {
+			t.Fatalf("Failed to get member: %v", err)
+		}
+		loc := member.RichAttributes.GetDemographics().GetLocation()
+		p, ok := placeForCity(loc.GetCity())
+		if !ok {
+			t.Fatalf("Expected a city from the geography, got %v", loc)
+		}
+		if d := distanceKm(constraint.CenterLat, constraint.CenterLng, p.Lat, p.Lng); d > constraint.RadiusKm {
+			t.Errorf("Expected %s to lie within %g km, it is %.1f km away", p.City, constraint.RadiusKm, d)
+		}
+		if loc.GetLatitude() != p.Lat || loc.GetLongitude() != p.Lng || loc.GetRegion() != p.Region {
+			t.Errorf("Expected %s's coordinates and region, got %v", p.City, loc)
+		}
+		cities[p.City] = true
+	}
+	if len(cities) < 2 {
+		t.Errorf("Expected members spread over the metro area, got %v", cities)
+	}
+
+	invalid := []types.LocationConstraint{
+		{Type: "geo", CenterLat: 95, CenterLng: 0, RadiusKm: 10},
+		{Type: "geo", CenterLat: 40.7, CenterLng: -74, RadiusKm: 0},
+		{Type: "geo", CenterLat: 0, CenterLng: -30, RadiusKm: 100}, // mid-Atlantic
+	}
+	for _, c := range invalid {
+		config.LocationConstraint = c
+		if _, err := service.GenerateCommunity(config, "Invalid", "", "geographic", 5); err == nil {
+			t.Errorf("Expected an error for %+v", c)
+		}
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	// London to Paris is about 344 km
+	if d := distanceKm(51.5074, -0.1278, 48.8566, 2.3522); d < 340 || d > 348 {
+		t.Errorf("Expected about 344 km from London to Paris, got %.1f", d)
+	}
+	if d := distanceKm(10, 20, 10, 20); d != 0 {
+		t.Errorf("Expected 0 km between identical points, got %v", d)
+	}
+}
+
+func TestGenerateCommunity_LocaleNames(t *testing.T) {
+	service, store := newTestService(t)
+
+	config := testGenerationConfig()
+	config.LocationConstraint = types.LocationConstraint{Type: "country", Locations: []string{"Spain"}}
+
+	community, err := service.GenerateCommunity(config, "Madrid", "Spanish members", "geographic", 20)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+
+	spanish := map[string]bool{}
+	for _, name := range []string{"García", "Rodríguez", "González", "Fernández", "López", "Martínez", "Sánchez", "Pérez",
+		"Gómez", "Martín", "Jiménez", "Ruiz", "Hernández", "Díaz", "Moreno", "Muñoz",
+		"Álvarez", "Romero", "Alonso", "Gutiérrez", "Navarro", "Torres", "Domínguez", "Vázquez"} {
+		spanish[name] = true
+	}
+	for _, id := range community.MemberIds {
+		member, err := store.GetIdentity(id)
+		if err != nil {
+			t.Fatalf("Failed to get member: %v", err)
+		}
+		parts := strings.Fields(member.Name)
+		if !spanish[parts[len(parts)-1]] {
+			t.Errorf("Expected a Spanish name for a member in Spain, got %q", member.Name)
+		}
+	}
+}
+
+func TestEvolveCommunity(t *testing.T) {
+	service, store := newTestService(t)
+
+	community, err := service.GenerateCommunity(testGenerationConfig(), "Cohort", "Longitudinal cohort", "demographic", 10)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+
+	// Snapshot plain values; memory storage shares rich attribute pointers
+	type snapshot struct {
+		age       int32
+		education string
+		updatedAt time.Time
+	}
+	before := make(map[string]snapshot)
+	for _, id := range community.MemberIds {
+		member, err := store.GetIdentity(id)
+		if err != nil {
+			t.Fatalf("Failed to get member: %v", err)
+		}
+		dem := member.RichAttributes.GetDemographics()
+		before[id] = snapshot{dem.GetAge(), dem.GetEducation(), member.UpdatedAt}
+	}
+
+	// Clobber the stored metrics so recomputation is observable
+	stale, _ := store.GetCommunity(community.Id)
+	stale.Diversity, stale.Cohesion = -1, -1
+	if err := store.UpdateCommunity(community.Id, stale); err != nil {
+		t.Fatalf("Failed to update community: %v", err)
+	}
+
+	educationRank := map[string]int{"some_high_school": 0, "high_school": 1, "associate": 2, "bachelor": 3, "graduate": 4}
+	evolved, err := service.EvolveCommunity(community.Id, 10)
+	if err != nil {
+		t.Fatalf("EvolveCommunity failed: %v", err)
+	}
+	if evolved.Diversity < 0 || evolved.Cohesion < 0 {
+		t.Errorf("Expected metrics to be recomputed, got diversity %v cohesion %v", evolved.Diversity, evolved.Cohesion)
+	}
+	if !evolved.UpdatedAt.After(stale.UpdatedAt) {
+		t.Error("Expected community UpdatedAt to be bumped")
+	}
+
+	for id, old := range before {
+		member, err := store.GetIdentity(id)
+		if err != nil {
+			t.Fatalf("Failed to get member: %v", err)
+		}
+		dem := member.RichAttributes.GetDemographics()
+		if dem.GetAge() != old.age+10 {
+			t.Errorf("Expected member %s to age from %d to %d, got %d", id, old.age, old.age+10, dem.GetAge())
+		}
+		if educationRank[dem.GetEducation()] < educationRank[old.education] {
+			t.Errorf("Expected education of %s not to regress from %s, got %s", id, old.education, dem.GetEducation())
+		}
+		if stage := member.RichAttributes.GetCurrentContext().GetLifeStage(); lifeStageForAge(int(old.age)) != lifeStageForAge(int(dem.GetAge())) && stage != lifeStageForAge(int(dem.GetAge())) {
+			t.Errorf("Expected member %s to reach life stage %s, got %q", id, lifeStageForAge(int(dem.GetAge())), stage)
+		}
+		if !member.UpdatedAt.After(old.updatedAt) {
+			t.Errorf("Expected member %s UpdatedAt to be bumped", id)
+		}
+	}
+
+	for _, years := range []int{0, -1, maxEvolveYears + 1} {
+		if _, err := service.EvolveCommunity(community.Id, years); err == nil {
+			t.Errorf("Expected error for %d years", years)
+		}
+	}
+	if _, err := service.EvolveCommunity("missing", 1); err == nil {
+		t.Error("Expected error for a missing community")
+	}
+}
+
+func TestGenerateAge_Skewness(t *testing.T) {
+	service, _ := newTestService(t)
+	const samples = 10000
+
+	// sampleStats returns the mean and sample skewness of n generated ages
+	sampleStats := func(dist types.AgeDistribution) (mean, skew float64) {
+		ages := make([]float64, samples)
+		for i := range ages {
+			age := service.generateAge(dist)
+			if age < dist.MinAge || age > dist.MaxAge {
+				t.Fatalf("Age %d outside [%d, %d]", age, dist.MinAge, dist.MaxAge)
+			}
+			ages[i] = float64(age)
+			mean += ages[i]
+		}
+		mean /= samples
+		var m2, m3 float64
+		for _, age := range ages {
+			d := age - mean
+			m2 += d * d
+			m3 += d * d * d
+		}
+		m2 /= samples
+		m3 /= samples
+		return mean, m3 / math.Pow(m2, 1.5)
+	}
+
+	tests := []struct {
+		name     string
+		skewness float64
+		check    func(skew float64) bool
+	}{
+		{"right skew", 0.8, func(skew float64) bool { return skew > 0.4 }},
+		{"left skew", -0.8, func(skew float64) bool { return skew < -0.4 }},
+		{"symmetric", 0, func(skew float64) bool { return math.Abs(skew) < 0.15 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dist := types.AgeDistribution{Mean: 45, StdDev: 10, MinAge: 0, MaxAge: 120, Skewness: tt.skewness}
+			mean, skew := sampleStats(dist)
+			if math.Abs(mean-dist.Mean) > 1 {
+				t.Errorf("Expected mean near %v, got %.2f", dist.Mean, mean)
+			}
+			if !tt.check(skew) {
+				t.Errorf("Unexpected sample skewness %.3f for skewness %v", skew, tt.skewness)
+			}
+		})
+	}
+
+	// Tight bounds truncate the distribution rather than piling ages onto the edges
+	dist := types.AgeDistribution{Mean: 40, StdDev: 15, MinAge: 30, MaxAge: 50, Skewness: 0.5}
+	edges := 0
+	for range samples {
+		if age := service.generateAge(dist); age == dist.MinAge || age == dist.MaxAge {
+			edges++
+		}
+	}
+	// Each of the 21 ages gets about 1/21 of the samples; clamping would give
+	// the edges over a quarter each
+	if edges > samples/5 {
+		t.Errorf("Expected ages not to cluster on the bounds, got %d of %d on an edge", edges, samples)
+	}
+}
+
+func TestGenerateInterests_DemographicWeighting(t *testing.T) {
+	service, _ := newTestService(t)
+	const samples = 2000
+
+	// countGaming returns how many of n members of the given age list gaming
+	countGaming := func(age int) int {
+		count := 0
+		for i := 0; i < samples; i++ {
+			interests := service.generateInterests(0.3, age, "high_school")
+			seen := make(map[string]bool)
+			for _, interest := range interests {
+				if seen[interest] {
+					t.Fatalf("Duplicate interest %q in %v", interest, interests)
+				}
+				seen[interest] = true
+				if interest == "gaming" {
+					count++
+				}
+			}
+			if len(interests) != 5 {
+				t.Fatalf("Expected 5 interests for spread 0.3, got %d", len(interests))
+			}
+		}
+		return count
+	}
+
+	young, elderly := countGaming(20), countGaming(75)
+	if young <= elderly {
+		t.Errorf("Expected gaming more often for young members, got %d young vs %d elderly", young, elderly)
+	}
+}
+
+func TestGenerateMembers_Parallel(t *testing.T) {
+	service, _ := newTestService(t)
+	service.SetGenerationWorkers(4)
+
+	config := testGenerationConfig()
+	config.TargetDiversityByDimension = map[string]float64{DimensionPolitical: 1}
+	members, err := service.generateMembers(config, 200)
+	if err != nil {
+		t.Fatalf("generateMembers failed: %v", err)
+	}
+	if len(members) != 200 {
+		t.Fatalf("Expected 200 members, got %d", len(members))
+	}
+
+	seen := make(map[string]bool)
+	leanings := make(map[string]int)
+	for _, member := range members {
+		if member.Id == "" || seen[member.Id] {
+			t.Fatalf("Expected unique member IDs, got %q twice", member.Id)
+		}
+		seen[member.Id] = true
+		if member.Name == "" || member.RichAttributes.GetDemographics().GetAge() == 0 {
+			t.Errorf("Expected a fully generated member, got %+v", member)
+		}
+		leanings[member.RichAttributes.GetPoliticalSocial().GetPoliticalLeaning()]++
+	}
+
+	// Full balancing spreads the batch evenly, which needs members in order
+	for leaning, n := range leanings {
+		if n != 40 {
+			t.Errorf("Expected 40 members per political leaning, got %d for %s", n, leaning)
+		}
+	}
+}
+
+// BenchmarkGenerateMembers compares generating 10,000 members on one
+// goroutine with generating them on one worker per CPU
+func BenchmarkGenerateMembers(b *testing.B) {
+	store := storage.NewMemoryStorage()
+	if err := store.Create(&types.Persona{Name: "Bench", Topic: "Benchmarking", Prompt: "You benchmark."}); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bench := range []struct {
+		name    string
+		workers int
+	}{
+		{"sequential", 1},
+		{"parallel", 0},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			service := NewService(store)
+			service.SetGenerationWorkers(bench.workers)
+			config := testGenerationConfig()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := service.generateMembers(config, 10000); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetCommunityStats_ReusesStoredMetrics(t *testing.T) {
+	service, store := newTestService(t)
+
+	community, err := service.GenerateCommunity(testGenerationConfig(), "Cached", "Stats cache", "interest", 6)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+
+	calls := 0
+	service.cohesionScore = func(members []types.Identity, config types.CommunityGenerationConfig) float64 {
+		calls++
+		return service.calculateCohesionScore(members, config)
+	}
+
+	for range 2 {
+		stats, err := service.GetCommunityStats(community.Id)
+		if err != nil {
+			t.Fatalf("GetCommunityStats failed: %v", err)
+		}
+		if stats.CohesionScore != community.Cohesion || stats.DiversityIndex != community.Diversity {
+			t.Errorf("Expected the stored cohesion %.3f and diversity %.3f, got %.3f and %.3f",
+				community.Cohesion, community.Diversity, stats.CohesionScore, stats.DiversityIndex)
+		}
+	}
+	if calls != 0 {
+		t.Fatalf("Expected stats on an unchanged community to reuse stored cohesion, got %d computations", calls)
+	}
+
+	personas, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newcomer := &types.Identity{PersonaId: personas[0].Id, Name: "Newcomer"}
+	if err := store.CreateIdentity(newcomer); err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	if err := service.AddMemberToCommunity(community.Id, newcomer.Id); err != nil {
+		t.Fatalf("AddMemberToCommunity failed: %v", err)
+	}
+	for range 2 {
+		if _, err := service.GetCommunityStats(community.Id); err != nil {
+			t.Fatalf("GetCommunityStats failed: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected one recomputation after the member set changed, got %d", calls)
+	}
+
+	if _, err := service.GetCommunityStatsWithOptions(community.Id, StatsOptions{ForceRecompute: true}); err != nil {
+		t.Fatalf("GetCommunityStatsWithOptions failed: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected ForceRecompute to recompute cohesion, got %d computations", calls)
+	}
+}
+
+// BenchmarkGetCommunityStats compares stats for a 2,000-member community
+// using the stored cohesion with recomputing it on every call
+func BenchmarkGetCommunityStats(b *testing.B) {
+	store := storage.NewMemoryStorage()
+	if err := store.Create(&types.Persona{Name: "Bench", Topic: "Benchmarking", Prompt: "You benchmark."}); err != nil {
+		b.Fatal(err)
+	}
+	service := NewService(store)
+	community, err := service.GenerateCommunity(testGenerationConfig(), "Large", "Benchmark", "interest", 2000)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bench := range []struct {
+		name string
+		opts StatsOptions
+	}{
+		{"stored", StatsOptions{}},
+		{"recomputed", StatsOptions{ForceRecompute: true}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := service.GetCommunityStatsWithOptions(community.Id, bench.opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetCommunityStats_TalliesMembers(t *testing.T) {
+	service, store := newTestService(t)
+	personas, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	member := func(name string, age int32, gender, leaning, city, activity string) string {
+		i := &types.Identity{PersonaId: personas[0].Id, Name: name, RichAttributes: &types.RichAttributes{
+			Demographics:    &types.Demographics{Age: age, Gender: gender, Location: &types.Location{City: city}},
+			PoliticalSocial: &types.PoliticalSocial{PoliticalLeaning: leaning},
+			Custom:          map[string]string{"activity_level": activity},
+		}}
+		if err := store.CreateIdentity(i); err != nil {
+			t.Fatalf("Failed to create identity: %v", err)
+		}
+		return i.Id
+	}
+	memberIds := []string{
+		member("Ann", 30, "female", "liberal", "Oslo", "0.9"),
+		member("Ben", 50, "male", "liberal", "Oslo", "0.3"),
+		member("Cat", 0, "female", "", "Bergen", ""),
+		"gone", // Members whose identity no longer exists are skipped
+	}
+	community := &types.Community{Name: "Tallied", Type: "interest", MemberIds: memberIds}
+	if err := store.CreateCommunity(community); err != nil {
+		t.Fatalf("Failed to create community: %v", err)
+	}
+
+	stats, err := service.GetCommunityStats(community.Id)
+	if err != nil {
+		t.Fatalf("GetCommunityStats failed: %v", err)
+	}
+	if stats.MemberCount != 3 || stats.ActiveMembers != 1 || stats.AverageAge != 40 || stats.EngagementScore != 0.6 {
+		t.Errorf("Unexpected member tallies: %+v", stats)
+	}
+	if math.Abs(stats.GenderRatio["female"]-2.0/3) > 1e-9 || stats.PoliticalSpread["liberal"] != 1 {
+		t.Errorf("Expected ratios over the members that have each attribute, got %v and %v", stats.GenderRatio, stats.PoliticalSpread)
+	}
+	if stats.LocationSpread["Oslo"] != 2 || stats.LocationSpread["Bergen"] != 1 {
+		t.Errorf("Expected location counts, got %v", stats.LocationSpread)
+	}
+
+	if _, err := service.GetCommunityStats("missing"); err == nil {
+		t.Error("Expected an error for a missing community")
+	}
+}
+
+func TestRecalculateCommunityMetrics(t *testing.T) {
+	service, store := newTestService(t)
+	personas, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	member := func(name string, age int32, leaning, city string) string {
+		i := &types.Identity{PersonaId: personas[0].Id, Name: name, RichAttributes: &types.RichAttributes{
+			Demographics:    &types.Demographics{Age: age, Location: &types.Location{City: city}},
+			PoliticalSocial: &types.PoliticalSocial{PoliticalLeaning: leaning},
+		}}
+		if err := store.CreateIdentity(i); err != nil {
+			t.Fatalf("Failed to create identity: %v", err)
+		}
+		return i.Id
+	}
+	community := &types.Community{
+		Name:       "Alike",
+		Type:       "interest",
+		MemberIds:  []string{member("Ann", 30, "liberal", "Oslo"), member("Ben", 30, "liberal", "Oslo")},
+		MaxMembers: 10,
+	}
+	if err := store.CreateCommunity(community); err != nil {
+		t.Fatalf("Failed to create community: %v", err)
+	}
+
+	if err := service.RecalculateCommunityMetrics(community.Id); err != nil {
+		t.Fatalf("RecalculateCommunityMetrics failed: %v", err)
+	}
+	alike, err := service.GetCommunity(community.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alike.Attributes["average_age"] != 30.0 {
+		t.Errorf("Expected the attributes to be recalculated, got %v", alike.Attributes)
+	}
+
+	// A dissimilar member raises the stored diversity straight away
+	outlier := member("Cat", 70, "conservative", "Bergen")
+	if err := service.AddMemberToCommunity(community.Id, outlier); err != nil {
+		t.Fatalf("AddMemberToCommunity failed: %v", err)
+	}
+	mixed, err := service.GetCommunity(community.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mixed.Diversity <= alike.Diversity {
+		t.Errorf("Expected diversity to increase from %v, got %v", alike.Diversity, mixed.Diversity)
+	}
+
+	if err := service.RemoveMemberFromCommunity(community.Id, outlier); err != nil {
+		t.Fatalf("RemoveMemberFromCommunity failed: %v", err)
+	}
+	removed, err := service.GetCommunity(community.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed.Diversity != alike.Diversity {
+		t.Errorf("Expected diversity %v after removing the member, got %v", alike.Diversity, removed.Diversity)
+	}
+
+	if err := service.RecalculateCommunityMetrics("missing"); err == nil {
+		t.Error("Expected an error for a missing community")
+	}
+}
+
+func TestLoadPoolsFile(t *testing.T) {
+	t.Cleanup(func() { SetPools(DefaultPools()) })
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"pools.json": `{
+			"interests": ["birding", "chess", "sailing"],
+			"cities": ["Tromsø", "Bodø"],
+			"first_names": ["Ingrid", "Sindre"],
+			"last_names": ["Berg", "Dahl"]
+		}`,
+		"pools.csv": "interests,cities,first_names,last_names\n" +
+			"birding,Tromsø,Ingrid,Berg\n" +
+			"chess,Bodø,Sindre,Dahl\n" +
+			"sailing,,,\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := LoadPoolsFile(path); err != nil {
+				t.Fatalf("LoadPoolsFile failed: %v", err)
+			}
+			defer SetPools(DefaultPools())
+
+			service, _ := newTestService(t)
+			community, err := service.GenerateCommunity(testGenerationConfig(), "Northern", "Custom pools", "interest", 10)
+			if err != nil {
+				t.Fatalf("GenerateCommunity failed: %v", err)
+			}
+			members, err := service.GetCommunityMembers(community.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			interests := map[string]bool{"birding": true, "chess": true, "sailing": true}
+			cities := map[string]bool{"Tromsø": true, "Bodø": true}
+			for _, member := range members {
+				first, last, _ := strings.Cut(member.Name, " ")
+				if (first != "Ingrid" && first != "Sindre") || (last != "Berg" && last != "Dahl") {
+					t.Errorf("Expected a name from the pools, got %q", member.Name)
+				}
+				if city := member.RichAttributes.Demographics.Location.City; !cities[city] {
+					t.Errorf("Expected a city from the pools, got %q", city)
+				}
+				for _, interest := range member.RichAttributes.Preferences.Interests {
+					if !interests[interest] {
+						t.Errorf("Expected interests from the pools, got %q", interest)
+					}
+				}
+			}
+		})
+	}
+
+	// Lists a file leaves out keep their defaults
+	partial := filepath.Join(dir, "cities.csv")
+	if err := os.WriteFile(partial, []byte("cities\nOslo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadPoolsFile(partial); err != nil {
+		t.Fatalf("LoadPoolsFile failed: %v", err)
+	}
+	if p := pools(); len(p.Cities) != 1 || len(p.Interests) != len(DefaultPools().Interests) || p.FirstNames != nil {
+		t.Errorf("Expected only the cities to change, got %+v", p)
+	}
+
+	for name, content := range map[string]string{
+		"names.json":   `{"first_names": ["Ingrid"]}`,
+		"empty.json":   `{"interests": []}`,
+		"unknown.csv":  "hobbies\nchess\n",
+		"pools.yaml":   "interests: [chess]",
+		"invalid.json": `{"interests": `,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadPoolsFile(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := LoadPoolsFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+// communityWriteCounter counts community writes that reach the backend
+type communityWriteCounter struct {
+	storage.Storage
+	writes int
+}
+
+func (c *communityWriteCounter) UpdateCommunity(id string, community types.Community) error {
+	c.writes++
+	return c.Storage.UpdateCommunity(id, community)
+}
+
+func TestGetCommunityStats_DoesNotWrite(t *testing.T) {
+	_, store := newTestService(t)
+	counter := &communityWriteCounter{Storage: store}
+	service := NewService(counter)
+
+	community, err := service.GenerateCommunity(testGenerationConfig(), "Read only", "Stats do not write", "interest", 6)
+	if err != nil {
+		t.Fatalf("GenerateCommunity failed: %v", err)
+	}
+
+	calls := 0
+	service.cohesionScore = func(members []types.Identity, config types.CommunityGenerationConfig) float64 {
+		calls++
+		return service.calculateCohesionScore(members, config)
+	}
+
+	// A dangling member ID does not make the stored metrics look stale
+	stored, err := store.GetCommunity(community.Id)
+	if err != nil {
+		t.Fatalf("Failed to get community: %v", err)
+	}
+	stored.MemberIds = append(stored.MemberIds, "missing")
+	if err := store.UpdateCommunity(community.Id, stored); err != nil {
+		t.Fatalf("Failed to update community: %v", err)
+	}
+	if _, err := service.GetCommunityStats(community.Id); err != nil {
+		t.Fatalf("GetCommunityStats failed: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Expected the stored metrics to be reused despite a dangling member, got %d computations", calls)
+	}
+
+	if err := service.RemoveMemberFromCommunity(community.Id, community.MemberIds[0]); err != nil {
+		t.Fatalf("RemoveMemberFromCommunity failed: %v", err)
+	}
+	counter.writes = 0
+	for range 2 {
+		if _, err := service.GetCommunityStats(community.Id); err != nil {
+			t.Fatalf("GetCommunityStats failed: %v", err)
+		}
+	}
+	if counter.writes != 0 {
+		t.Errorf("Expected stats reads not to write the community, got %d writes", counter.writes)
+	}
+	if calls != 1 {
+		t.Errorf("Expected one recomputation for the changed member set, got %d", calls)
+	}
+}
@@ -0,0 +1,193 @@
+package community
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// Dimensions that can be targeted via TargetDiversityByDimension
+const (
+	DimensionAge           = "age"
+	DimensionPolitical     = "political_leaning"
+	DimensionGender        = "gender"
+	DimensionEducation     = "education"
+	DimensionSocioeconomic = "socioeconomic_status"
+	DimensionLocation      = "location"
+	DimensionInterests     = "interests"
+)
+
+// Categorical values produced by the attribute generators
+var dimensionCategories = map[string][]string{
+	DimensionPolitical:     {"very_liberal", "liberal", "moderate", "conservative", "very_conservative"},
+	DimensionGender:        {"male", "female"},
+	DimensionEducation:     {"some_high_school", "high_school", "associate", "bachelor", "graduate"},
+	DimensionSocioeconomic: {"low_income", "lower_middle", "middle", "upper_middle", "high_income"},
+}
+
+// validateDimensionTargets checks that every targeted dimension is known and
+// its target lies in [0, 1]
+func validateDimensionTargets(targets map[string]float64) error {
+	for dimension, target := range targets {
+		if !isKnownDimension(dimension) {
+			return fmt.Errorf("unknown diversity dimension: %s", dimension)
+		}
+		if target < 0 || target > 1 {
+			return fmt.Errorf("diversity target for %s must be between 0 and 1", dimension)
+		}
+	}
+	return nil
+}
+
+func isKnownDimension(dimension string) bool {
+	switch dimension {
+	case DimensionAge, DimensionLocation, DimensionInterests:
+		return true
+	}
+	_, ok := dimensionCategories[dimension]
+	return ok
+}
+
+// dimensionBalancer biases generated attributes towards per-dimension
+// diversity targets. With probability equal to a dimension's target, a
+// member's value is replaced by the least used value so far, which spreads
+// the batch evenly across the available values. This is best-effort: the
+// achieved diversity is measured afterwards and reported, not guaranteed.
+type dimensionBalancer struct {
+	targets map[string]float64
+	counts  map[string]map[string]int
+}
+
+func newDimensionBalancer(targets map[string]float64) *dimensionBalancer {
+	return &dimensionBalancer{
+		targets: targets,
+		counts:  make(map[string]map[string]int),
+	}
+}
+
+// apply adjusts generated attributes in place
+func (b *dimensionBalancer) apply(config types.CommunityGenerationConfig, attrs map[string]interface{}) {
+	if len(b.targets) == 0 {
+		return
+	}
+
+	for dimension, categories := range dimensionCategories {
+		if dimension == DimensionGender && len(config.GenderDistribution) > 0 {
+			categories = sortedKeys(config.GenderDistribution)
+		}
+		if value, ok := attrs[dimension].(string); ok {
+			attrs[dimension] = b.balance(dimension, categories, value)
+		}
+	}
+
+	if b.shouldBalance(DimensionAge) {
+		// Uniform ages cover the allowed range instead of clustering at the mean
+		dist := config.AgeDistribution
+		if dist.MaxAge > dist.MinAge {
+			attrs["age"] = dist.MinAge + cryptoRandIntn(dist.MaxAge-dist.MinAge+1)
+		}
+	}
+
+	if location, ok := attrs["location"].(map[string]interface{}); ok {
+		if cities := balancedCities(config.LocationConstraint); cities != nil {
+			city, _ := location["city"].(string)
+			if balanced := b.balance(DimensionLocation, cities, city); balanced != "" && balanced != city {
+				setCity(location, balanced)
+				if _, ok := location["timezone"]; !ok && config.LocationConstraint.Timezone != "" {
+					location["timezone"] = config.LocationConstraint.Timezone
+				}
+			}
+		}
+	}
+
+	if interests, ok := attrs["interests"].([]string); ok && b.shouldBalance(DimensionInterests) {
+		balanced := make([]string, 0, len(interests))
+		for _, interest := range b.leastUsed(DimensionInterests, pools().Interests, len(interests)) {
+			b.record(DimensionInterests, interest)
+			balanced = append(balanced, interest)
+		}
+		attrs["interests"] = balanced
+	} else if ok {
+		for _, interest := range interests {
+			b.record(DimensionInterests, interest)
+		}
+	}
+}
+
+// balance returns either the generated value or, when the dimension is
+// selected for balancing, the least used category
+func (b *dimensionBalancer) balance(dimension string, categories []string, value string) string {
+	if b.shouldBalance(dimension) {
+		value = b.leastUsed(dimension, categories, 1)[0]
+	}
+	if value != "" {
+		b.record(dimension, value)
+	}
+	return value
+}
+
+func (b *dimensionBalancer) shouldBalance(dimension string) bool {
+	target, ok := b.targets[dimension]
+	return ok && target > 0 && cryptoRandFloat64() < target
+}
+
+// leastUsed returns the n least used categories, breaking ties randomly
+func (b *dimensionBalancer) leastUsed(dimension string, categories []string, n int) []string {
+	shuffled := make([]string, len(categories))
+	for i, j := range cryptoRandPerm(len(categories)) {
+		shuffled[i] = categories[j]
+	}
+	counts := b.counts[dimension]
+	sort.SliceStable(shuffled, func(i, j int) bool {
+		return counts[shuffled[i]] < counts[shuffled[j]]
+	})
+	if n > len(shuffled) {
+		n = len(shuffled)
+	}
+	return shuffled[:n]
+}
+
+func (b *dimensionBalancer) record(dimension, value string) {
+	if b.counts[dimension] == nil {
+		b.counts[dimension] = make(map[string]int)
+	}
+	b.counts[dimension][value]++
+}
+
+// balancedCities returns the cities location balancing may choose from, or nil
+// when the constraint pins members to regions or countries. Geo constraints
+// balance across the known cities inside the radius.
+func balancedCities(constraint types.LocationConstraint) []string {
+	switch constraint.Type {
+	case "city":
+		if len(constraint.Locations) > 0 {
+			return constraint.Locations
+		}
+		return pools().Cities
+	case "region", "country":
+		return nil
+	case "geo":
+		var cities []string
+		for _, p := range placesWithin(constraint.CenterLat, constraint.CenterLng, constraint.RadiusKm) {
+			cities = append(cities, p.City)
+		}
+		return cities
+	default:
+		return pools().Cities
+	}
+}
+
+// calculateDimensionDiversities reports the achieved diversity for each
+// targeted dimension
+func (s *Service) calculateDimensionDiversities(members []types.Identity, targets map[string]float64) map[string]float64 {
+	achieved := make(map[string]float64, len(targets))
+	for dimension := range targets {
+		if dimension == DimensionInterests {
+			achieved[dimension] = s.calculateInterestDiversity(members)
+		} else {
+			achieved[dimension] = s.calculateAttributeDiversity(members, dimension)
+		}
+	}
+	return achieved
+}
@@ -0,0 +1,104 @@
+package community
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// maxEvolveYears bounds a single evolution step
+const maxEvolveYears = 100
+
+// educationStep is the next education level a member can reach and the
+// yearly chance of reaching it while within the age range
+type educationStep struct {
+	next           string
+	minAge, maxAge int
+	chance         float64
+}
+
+// educationSteps covers the levels produced by generateEducationLevel.
+// Levels not listed here, including graduate, never change.
+var educationSteps = map[string]educationStep{
+	"some_high_school": {next: "high_school", minAge: 16, maxAge: 21, chance: 0.5},
+	"high_school":      {next: "bachelor", minAge: 18, maxAge: 30, chance: 0.08},
+	"associate":        {next: "bachelor", minAge: 19, maxAge: 35, chance: 0.15},
+	"bachelor":         {next: "graduate", minAge: 22, maxAge: 40, chance: 0.06},
+}
+
+// lifeStageForAge returns the life stage EvolveCommunity assigns at an age
+func lifeStageForAge(age int) string {
+	switch {
+	case age < 18:
+		return "adolescent"
+	case age < 30:
+		return "young_adult"
+	case age < 45:
+		return "established_adult"
+	case age < 65:
+		return "middle_aged"
+	default:
+		return "retired"
+	}
+}
+
+// EvolveCommunity advances every member of a community by the given number
+// of years. Each member's age increases, their education may advance one
+// simulated year at a time, and their life stage is updated when the new age
+// crosses into a different stage. Members without an age are left
+// unchanged. The updated members are saved and the community's metrics are
+// recomputed.
+func (s *Service) EvolveCommunity(id string, years int) (*types.Community, error) {
+	if years < 1 || years > maxEvolveYears {
+		return nil, fmt.Errorf("years must be between 1 and %d", maxEvolveYears)
+	}
+
+	c, err := s.storage.GetCommunity(id)
+	if err != nil {
+		return nil, err
+	}
+
+	members := s.loadMembers(c)
+	for n := range members {
+		if !evolveMember(&members[n], years) {
+			continue
+		}
+		if err := s.storage.UpdateIdentity(members[n].Id, members[n]); err != nil {
+			return nil, fmt.Errorf("failed to update member %s: %v", members[n].Id, err)
+		}
+	}
+
+	s.calculateCommunityMetrics(&c, members)
+	c.UpdatedAt = time.Now()
+	if err := s.storage.UpdateCommunity(id, c); err != nil {
+		return nil, fmt.Errorf("failed to update community: %v", err)
+	}
+	return &c, nil
+}
+
+// evolveMember ages a member by years and reports whether anything changed
+func evolveMember(member *types.Identity, years int) bool {
+	dem := memberDemographics(*member)
+	if dem == nil || dem.Age <= 0 {
+		return false
+	}
+
+	oldStage := lifeStageForAge(int(dem.Age))
+	for range years {
+		dem.Age++
+		if step, ok := educationSteps[dem.Education]; ok &&
+			int(dem.Age) >= step.minAge && int(dem.Age) <= step.maxAge &&
+			cryptoRandFloat64() < step.chance {
+			dem.Education = step.next
+		}
+	}
+
+	if newStage := lifeStageForAge(int(dem.Age)); newStage != oldStage {
+		if member.RichAttributes.CurrentContext == nil {
+			member.RichAttributes.CurrentContext = &types.CurrentContext{}
+		}
+		member.RichAttributes.CurrentContext.LifeStage = newStage
+	}
+	return true
+}
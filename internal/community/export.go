@@ -0,0 +1,120 @@
+package community
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// MemberCSVHeader is the header row written by WriteMembersCSV
+var MemberCSVHeader = []string{
+	"id", "name", "age", "gender", "political_leaning", "education", "city", "activity_level",
+}
+
+// MemberCSVRecord flattens a member into a row matching MemberCSVHeader.
+// Attributes the member does not have, including all rich attributes when
+// RichAttributes is nil, are left as empty cells. Cells that a spreadsheet
+// would read as a formula are escaped as csvCell describes.
+func MemberCSVRecord(member types.Identity) []string {
+	var age, gender, political, education, city, activity string
+
+	if attrs := member.RichAttributes; attrs != nil {
+		if dem := attrs.Demographics; dem != nil {
+			if dem.Age > 0 {
+				age = strconv.Itoa(int(dem.Age))
+			}
+			gender = dem.Gender
+			education = dem.Education
+			if dem.Location != nil {
+				city = dem.Location.City
+			}
+		}
+		if attrs.PoliticalSocial != nil {
+			political = attrs.PoliticalSocial.PoliticalLeaning
+		}
+		activity = attrs.Custom["activity_level"]
+	}
+
+	record := []string{member.Id, member.Name, age, gender, political, education, city, activity}
+	for i, cell := range record {
+		record[i] = csvCell(cell)
+	}
+	return record
+}
+
+// csvCell prefixes a cell starting with =, +, - or @ with a single quote,
+// so spreadsheets show it as text instead of evaluating it as a formula
+func csvCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// WriteMembersCSV writes a header row followed by one row per member
+func WriteMembersCSV(w io.Writer, members []types.Identity) error {
+	return writeMembersCSV(w, func(fn func(types.Identity) error) error {
+		for _, member := range members {
+			if err := fn(member); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WriteCommunityMembersCSV writes a community's members as WriteMembersCSV
+// does, reading them from storage one at a time so that large communities
+// are never held in memory
+func (s *Service) WriteCommunityMembersCSV(w io.Writer, communityId string) error {
+	return writeMembersCSV(w, func(fn func(types.Identity) error) error {
+		return storage.ForEachCommunityMember(s.storage, communityId, fn)
+	})
+}
+
+// writeMembersCSV writes a header row and then a row for each member that
+// forEach passes on
+func writeMembersCSV(w io.Writer, forEach func(fn func(types.Identity) error) error) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(MemberCSVHeader); err != nil {
+		return fmt.Errorf("failed to write CSV header: %v", err)
+	}
+	err := forEach(func(member types.Identity) error {
+		if err := writer.Write(MemberCSVRecord(member)); err != nil {
+			return fmt.Errorf("failed to write CSV row for %s: %v", member.Id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// GetCommunityMembers returns the identities of a community's members.
+// Members whose identities no longer exist are skipped.
+func (s *Service) GetCommunityMembers(communityId string) ([]types.Identity, error) {
+	community, err := s.storage.GetCommunity(communityId)
+	if err != nil {
+		return nil, err
+	}
+	return s.loadMembers(community), nil
+}
+
+func (s *Service) loadMembers(community types.Community) []types.Identity {
+	members := make([]types.Identity, 0, len(community.MemberIds))
+	for _, memberId := range community.MemberIds {
+		member, err := s.storage.GetIdentity(memberId)
+		if err != nil {
+			continue // Skip missing members
+		}
+		members = append(members, member)
+	}
+	return members
+}
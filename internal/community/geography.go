@@ -0,0 +1,171 @@
+package community
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// place is a city with the region, country and timezone it lies in, and
+// the coordinates of its center
+type place struct {
+	City     string  `json:"city"`
+	Region   string  `json:"region"`
+	Country  string  `json:"country"`
+	Timezone string  `json:"timezone"`
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+}
+
+//go:embed pools/geography.json
+var geographyJSON []byte
+
+// geography lists the places generated locations are completed from, so
+// a member's city, region, country and timezone agree
+var geography = loadGeography()
+
+func loadGeography() []place {
+	var places []place
+	if err := json.Unmarshal(geographyJSON, &places); err != nil {
+		panic(fmt.Sprintf("embedded geography: %v", err))
+	}
+	return places
+}
+
+// placeForCity returns the known place named city, matched
+// case-insensitively
+func placeForCity(city string) (place, bool) {
+	for _, p := range geography {
+		if strings.EqualFold(p.City, city) {
+			return p, true
+		}
+	}
+	return place{}, false
+}
+
+// placesIn returns the known places whose region or country, as selected
+// by field, matches value case-insensitively
+func placesIn(field, value string) []place {
+	var places []place
+	for _, p := range geography {
+		name := p.Country
+		if field == "region" {
+			name = p.Region
+		}
+		if strings.EqualFold(name, value) {
+			places = append(places, p)
+		}
+	}
+	return places
+}
+
+// earthRadiusKm is the mean radius of the Earth
+const earthRadiusKm = 6371.0
+
+// distanceKm returns the great-circle distance between two points given in
+// degrees, using the haversine formula
+func distanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// placesWithin returns the known places whose centers lie within radiusKm
+// of the given point
+func placesWithin(lat, lng, radiusKm float64) []place {
+	var places []place
+	for _, p := range geography {
+		if distanceKm(lat, lng, p.Lat, p.Lng) <= radiusKm {
+			places = append(places, p)
+		}
+	}
+	return places
+}
+
+// validateLocationConstraint checks the center and radius of a geo
+// constraint, and that at least one known city lies inside it
+func validateLocationConstraint(c types.LocationConstraint) error {
+	if c.Type != "geo" {
+		return nil
+	}
+	if c.CenterLat < -90 || c.CenterLat > 90 || c.CenterLng < -180 || c.CenterLng > 180 {
+		return fmt.Errorf("geo location center must be a latitude between -90 and 90 and a longitude between -180 and 180")
+	}
+	if c.RadiusKm <= 0 {
+		return fmt.Errorf("geo location radius must be positive")
+	}
+	if len(placesWithin(c.CenterLat, c.CenterLng, c.RadiusKm)) == 0 {
+		return fmt.Errorf("no known city lies within %g km of %g, %g", c.RadiusKm, c.CenterLat, c.CenterLng)
+	}
+	return nil
+}
+
+// preferTimezone narrows cities to those known to be in timezone, unless
+// none are
+func preferTimezone(cities []string, timezone string) []string {
+	if timezone == "" {
+		return cities
+	}
+	var matching []string
+	for _, city := range cities {
+		if p, ok := placeForCity(city); ok && p.Timezone == timezone {
+			matching = append(matching, city)
+		}
+	}
+	if len(matching) == 0 {
+		return cities
+	}
+	return matching
+}
+
+// pickPlace picks one of places at random, preferring those in timezone
+func pickPlace(places []place, timezone string) (place, bool) {
+	if len(places) == 0 {
+		return place{}, false
+	}
+	if timezone != "" {
+		var matching []place
+		for _, p := range places {
+			if p.Timezone == timezone {
+				matching = append(matching, p)
+			}
+		}
+		if len(matching) > 0 {
+			places = matching
+		}
+	}
+	return places[cryptoRandIntn(len(places))], true
+}
+
+// setPlace completes a generated location with a place's details
+func setPlace(location map[string]interface{}, p place) {
+	location["city"] = p.City
+	location["region"] = p.Region
+	location["country"] = p.Country
+	location["timezone"] = p.Timezone
+	location["latitude"] = p.Lat
+	location["longitude"] = p.Lng
+}
+
+// setCity moves a generated location to city, keeping its details
+// consistent. A city missing from the geography has no known region,
+// country or timezone.
+func setCity(location map[string]interface{}, city string) {
+	if p, ok := placeForCity(city); ok {
+		setPlace(location, p)
+		return
+	}
+	location["city"] = city
+	delete(location, "region")
+	delete(location, "country")
+	delete(location, "timezone")
+	delete(location, "latitude")
+	delete(location, "longitude")
+}
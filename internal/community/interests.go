@@ -0,0 +1,100 @@
+package community
+
+// interestAgeBands splits members into the age bands used by
+// interestWeights, each covering ages up to and including maxAge
+var interestAgeBands = []struct {
+	name   string
+	maxAge int
+}{
+	{"young", 29},
+	{"middle", 54},
+	{"senior", 200},
+}
+
+// demographicWeights scales an interest's weight by age band and by
+// education level. Bands and levels that are not listed keep a factor of 1.
+type demographicWeights struct {
+	age       map[string]float64
+	education map[string]float64
+}
+
+// interestWeights conditions interest selection on a member's age and
+// education. Every interest starts with a weight of 1, which is multiplied
+// by the factors listed here; interests without an entry stay uniform.
+// Tune this table to change which interests populations favour.
+var interestWeights = map[string]demographicWeights{
+	"gaming": {
+		age: map[string]float64{"young": 3, "middle": 1, "senior": 0.2},
+	},
+	"technology": {
+		age:       map[string]float64{"young": 1.8, "senior": 0.6},
+		education: map[string]float64{"bachelor": 1.3, "graduate": 1.5},
+	},
+	"fitness": {
+		age: map[string]float64{"young": 1.5, "senior": 0.7},
+	},
+	"fashion": {
+		age: map[string]float64{"young": 1.6, "senior": 0.6},
+	},
+	"music": {
+		age: map[string]float64{"young": 1.4},
+	},
+	"sports": {
+		age: map[string]float64{"young": 1.3, "senior": 0.8},
+	},
+	"gardening": {
+		age: map[string]float64{"young": 0.4, "middle": 1.2, "senior": 2.5},
+	},
+	"history": {
+		age:       map[string]float64{"young": 0.7, "senior": 1.8},
+		education: map[string]float64{"bachelor": 1.3, "graduate": 1.6},
+	},
+	"reading": {
+		age:       map[string]float64{"senior": 1.5},
+		education: map[string]float64{"some_high_school": 0.7, "bachelor": 1.3, "graduate": 1.6},
+	},
+	"crafts": {
+		age: map[string]float64{"young": 0.6, "senior": 1.8},
+	},
+	"travel": {
+		age: map[string]float64{"middle": 1.3, "senior": 1.3},
+	},
+	"politics": {
+		age:       map[string]float64{"young": 0.8, "senior": 1.4},
+		education: map[string]float64{"graduate": 1.4},
+	},
+	"science": {
+		education: map[string]float64{"some_high_school": 0.5, "high_school": 0.8, "bachelor": 1.4, "graduate": 2},
+	},
+	"business": {
+		age:       map[string]float64{"young": 0.8, "middle": 1.5, "senior": 0.8},
+		education: map[string]float64{"bachelor": 1.4, "graduate": 1.4},
+	},
+}
+
+// interestAgeBand returns the name of the interestAgeBands entry for age
+func interestAgeBand(age int) string {
+	for _, band := range interestAgeBands {
+		if age <= band.maxAge {
+			return band.name
+		}
+	}
+	return interestAgeBands[len(interestAgeBands)-1].name
+}
+
+// interestWeight returns how likely interest is, relative to an unweighted
+// interest, for a member of the given age and education
+func interestWeight(interest string, age int, education string) float64 {
+	weight := 1.0
+	weights, ok := interestWeights[interest]
+	if !ok {
+		return weight
+	}
+	if factor, ok := weights.age[interestAgeBand(age)]; ok {
+		weight *= factor
+	}
+	if factor, ok := weights.education[education]; ok {
+		weight *= factor
+	}
+	return weight
+}
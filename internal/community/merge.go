@@ -0,0 +1,67 @@
+package community
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// ErrCommunityFull is returned when an operation would take a community past
+// its MaxMembers limit
+var ErrCommunityFull = errors.New("community has reached maximum size")
+
+// MergeCommunities adds the members of the source community to the target,
+// skipping identities that already belong to the target, and recomputes the
+// target's metrics over the combined membership. The source is deleted when
+// deleteSource is set.
+func (s *Service) MergeCommunities(targetID, sourceID string, deleteSource bool) (*types.Community, error) {
+	if targetID == sourceID {
+		return nil, fmt.Errorf("cannot merge a community into itself")
+	}
+
+	target, err := s.storage.GetCommunity(targetID)
+	if err != nil {
+		return nil, err
+	}
+	source, err := s.storage.GetCommunity(sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(target.MemberIds)+len(source.MemberIds))
+	memberIds := make([]string, 0, len(target.MemberIds)+len(source.MemberIds))
+	for _, ids := range [][]string{target.MemberIds, source.MemberIds} {
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				memberIds = append(memberIds, id)
+			}
+		}
+	}
+
+	if len(memberIds) > target.MaxMembers {
+		return nil, fmt.Errorf("%w: merge needs %d members, limit is %d", ErrCommunityFull, len(memberIds), target.MaxMembers)
+	}
+
+	target.MemberIds = memberIds
+	target.Size = len(memberIds)
+	if target.Attributes == nil {
+		target.Attributes = make(map[string]interface{})
+	}
+	s.calculateCommunityMetrics(&target, s.loadMembers(target))
+	target.UpdatedAt = time.Now()
+
+	if err := s.storage.UpdateCommunity(targetID, target); err != nil {
+		return nil, fmt.Errorf("failed to update community: %v", err)
+	}
+
+	if deleteSource {
+		if err := s.storage.DeleteCommunity(sourceID); err != nil {
+			return nil, fmt.Errorf("merged but failed to delete source community: %v", err)
+		}
+	}
+
+	return &target, nil
+}
@@ -0,0 +1,168 @@
+package community
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/names"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// Pools are the values community generation draws members' interests,
+// cities and names from. The defaults are embedded from pools/default.json;
+// LoadPoolsFile replaces them without recompiling.
+type Pools struct {
+	Interests []string `json:"interests"`
+	Cities    []string `json:"cities"`
+	// FirstNames and LastNames, when given, are used for every member
+	// instead of the per-locale pools of the names package
+	FirstNames []string `json:"first_names,omitempty"`
+	LastNames  []string `json:"last_names,omitempty"`
+}
+
+//go:embed pools/default.json
+var defaultPoolsJSON []byte
+
+var (
+	poolsMu      sync.RWMutex
+	currentPools = DefaultPools()
+)
+
+// DefaultPools returns the built-in pools
+func DefaultPools() Pools {
+	var p Pools
+	if err := json.Unmarshal(defaultPoolsJSON, &p); err != nil {
+		panic(fmt.Sprintf("embedded community pools: %v", err))
+	}
+	return p
+}
+
+func (p Pools) validate() error {
+	if len(p.Interests) == 0 {
+		return fmt.Errorf("community pools need at least one interest")
+	}
+	if len(p.Cities) == 0 {
+		return fmt.Errorf("community pools need at least one city")
+	}
+	if (len(p.FirstNames) == 0) != (len(p.LastNames) == 0) {
+		return fmt.Errorf("community pools need both first and last names, or neither")
+	}
+	return nil
+}
+
+// SetPools replaces the pools used by every community service
+func SetPools(p Pools) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	currentPools = p
+	return nil
+}
+
+// pools returns the pools in use. Callers must not modify the slices.
+func pools() Pools {
+	poolsMu.RLock()
+	defer poolsMu.RUnlock()
+	return currentPools
+}
+
+// LoadPoolsFile reads pools from a .json or .csv file and puts them in use.
+// Lists the file leaves out keep their default values.
+//
+// A JSON file is an object like pools/default.json. A CSV file has a header
+// row naming the lists (interests, cities, first_names, last_names) and
+// their values in the rows below; blank cells are skipped, so the columns
+// may be of different lengths.
+func LoadPoolsFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open community pools: %v", err)
+	}
+	defer f.Close()
+
+	p := DefaultPools()
+	var loaded Pools
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		if err := json.NewDecoder(f).Decode(&loaded); err != nil {
+			return fmt.Errorf("invalid community pools %s: %v", path, err)
+		}
+	case ".csv":
+		if loaded, err = readPoolsCSV(f); err != nil {
+			return fmt.Errorf("invalid community pools %s: %v", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported community pools format %q, expected .json or .csv", ext)
+	}
+
+	if loaded.Interests != nil {
+		p.Interests = loaded.Interests
+	}
+	if loaded.Cities != nil {
+		p.Cities = loaded.Cities
+	}
+	p.FirstNames = loaded.FirstNames
+	p.LastNames = loaded.LastNames
+	return SetPools(p)
+}
+
+// readPoolsCSV parses the CSV layout described at LoadPoolsFile
+func readPoolsCSV(r io.Reader) (Pools, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return Pools{}, fmt.Errorf("failed to read header: %v", err)
+	}
+
+	var p Pools
+	columns := make([]*[]string, len(header))
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "interests":
+			columns[i] = &p.Interests
+		case "cities":
+			columns[i] = &p.Cities
+		case "first_names":
+			columns[i] = &p.FirstNames
+		case "last_names":
+			columns[i] = &p.LastNames
+		default:
+			return Pools{}, fmt.Errorf("unknown column %q", name)
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return p, nil
+		}
+		if err != nil {
+			return Pools{}, err
+		}
+		for i, value := range record {
+			if value = strings.TrimSpace(value); value != "" && i < len(columns) {
+				*columns[i] = append(*columns[i], value)
+			}
+		}
+	}
+}
+
+// generateName names a member from the configured first and last names,
+// or from the locale pools when none are configured
+func generateName(p Pools, localeNames *names.NameGenerator, demographics *types.Demographics) string {
+	if len(p.FirstNames) == 0 {
+		return localeNames.ForDemographics(demographics)
+	}
+	return p.FirstNames[cryptoRandIntn(len(p.FirstNames))] + " " + p.LastNames[cryptoRandIntn(len(p.LastNames))]
+}
@@ -0,0 +1,32 @@
+package community
+
+import "github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+
+// memberRelationshipType is the relationship type stored between generated
+// community members
+const memberRelationshipType = "acquaintance"
+
+// linkMembers stores a relationship between every pair of members whose
+// similarity is at least 1 - density, with the similarity as its strength.
+// ids holds the stored ID of each member, in the same order as members.
+func (s *Service) linkMembers(ids []string, members []types.Identity, density float64) error {
+	threshold := 1 - density
+	for i := range members {
+		for j := i + 1; j < len(members); j++ {
+			similarity := types.IdentitySimilarity(members[i], members[j])
+			if similarity < threshold {
+				continue
+			}
+			r := &types.Relationship{
+				FromId:   ids[i],
+				ToId:     ids[j],
+				Type:     memberRelationshipType,
+				Strength: similarity,
+			}
+			if err := s.storage.CreateRelationship(r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
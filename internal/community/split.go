@@ -0,0 +1,131 @@
+package community
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/ids"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// unspecifiedBucket groups members that have no value for the split attribute
+const unspecifiedBucket = "unspecified"
+
+// splitAttributes maps the attributes a community can be split by to the
+// member value they read
+var splitAttributes = map[string]func(types.Identity) string{
+	"political_leaning": func(member types.Identity) string {
+		if member.RichAttributes == nil || member.RichAttributes.PoliticalSocial == nil {
+			return ""
+		}
+		return member.RichAttributes.PoliticalSocial.PoliticalLeaning
+	},
+	"gender": func(member types.Identity) string {
+		if dem := memberDemographics(member); dem != nil {
+			return dem.Gender
+		}
+		return ""
+	},
+	"education": func(member types.Identity) string {
+		if dem := memberDemographics(member); dem != nil {
+			return dem.Education
+		}
+		return ""
+	},
+	"city": func(member types.Identity) string {
+		if dem := memberDemographics(member); dem != nil && dem.Location != nil {
+			return dem.Location.City
+		}
+		return ""
+	},
+}
+
+func memberDemographics(member types.Identity) *types.Demographics {
+	if member.RichAttributes == nil {
+		return nil
+	}
+	return member.RichAttributes.Demographics
+}
+
+// SplitCommunity creates one child community per distinct value of attribute
+// among the community's members, sorted by value. Members without a value go
+// into an "unspecified" child. Children inherit the parent's type and
+// generation config. The parent is deleted when deleteParent is set.
+func (s *Service) SplitCommunity(id string, attribute string, deleteParent bool) ([]*types.Community, error) {
+	valueOf, ok := splitAttributes[attribute]
+	if !ok {
+		return nil, fmt.Errorf("cannot split by %q: must be one of political_leaning, gender, education or city", attribute)
+	}
+
+	parent, err := s.storage.GetCommunity(id)
+	if err != nil {
+		return nil, err
+	}
+
+	members := s.loadMembers(parent)
+	if len(members) == 0 {
+		return nil, fmt.Errorf("community has no members to split")
+	}
+
+	groups := make(map[string][]types.Identity)
+	for _, member := range members {
+		value := valueOf(member)
+		if value == "" {
+			value = unspecifiedBucket
+		}
+		groups[value] = append(groups[value], member)
+	}
+
+	values := make([]string, 0, len(groups))
+	for value := range groups {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	children := make([]*types.Community, 0, len(values))
+	for _, value := range values {
+		group := groups[value]
+		child := &types.Community{
+			Id:               ids.New(),
+			Name:             fmt.Sprintf("%s (%s: %s)", parent.Name, attribute, value),
+			Description:      parent.Description,
+			Type:             parent.Type,
+			Size:             len(group),
+			MemberIds:        make([]string, 0, len(group)),
+			MaxMembers:       max(parent.MaxMembers, len(group)),
+			MinMembers:       1,
+			GenerationConfig: parent.GenerationConfig,
+			CreatedAt:        time.Now(),
+			UpdatedAt:        time.Now(),
+			IsActive:         parent.IsActive,
+			Tags:             append([]string{}, parent.Tags...),
+			Attributes:       map[string]interface{}{attribute: value},
+		}
+		for _, member := range group {
+			child.MemberIds = append(child.MemberIds, member.Id)
+		}
+		s.calculateCommunityMetrics(child, group)
+
+		if err := s.storage.CreateCommunity(child); err != nil {
+			s.rollbackCommunities(children)
+			return nil, fmt.Errorf("failed to store community: %v", err)
+		}
+		children = append(children, child)
+	}
+
+	if deleteParent {
+		if err := s.storage.DeleteCommunity(id); err != nil {
+			return nil, fmt.Errorf("split but failed to delete parent community: %v", err)
+		}
+	}
+
+	return children, nil
+}
+
+// rollbackCommunities deletes communities created before a failed split
+func (s *Service) rollbackCommunities(communities []*types.Community) {
+	for _, c := range communities {
+		s.storage.DeleteCommunity(c.Id)
+	}
+}
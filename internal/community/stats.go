@@ -0,0 +1,112 @@
+package community
+
+import (
+	"strconv"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// memberTally accumulates per-member community statistics one member at a
+// time, so its size depends on the number of distinct attribute values
+// rather than on the number of members
+type memberTally struct {
+	members       int
+	ageTotal      float64
+	ageCount      int
+	political     map[string]int
+	politicalSeen int
+	locations     map[string]int
+	genders       map[string]int
+	activeMembers int
+	activityTotal float64
+	activityCount int
+}
+
+func newMemberTally() *memberTally {
+	return &memberTally{
+		political: make(map[string]int),
+		locations: make(map[string]int),
+		genders:   make(map[string]int),
+	}
+}
+
+// add counts one member
+func (t *memberTally) add(member types.Identity) {
+	t.members++
+	attrs := member.RichAttributes
+	if attrs == nil {
+		return
+	}
+
+	if dem := attrs.Demographics; dem != nil {
+		if dem.Age > 0 {
+			t.ageTotal += float64(dem.Age)
+			t.ageCount++
+		}
+		if dem.Gender != "" {
+			t.genders[dem.Gender]++
+		}
+		if loc := dem.Location; loc != nil {
+			if loc.City != "" {
+				t.locations[loc.City]++
+			} else if loc.UrbanRural != "" {
+				t.locations[loc.UrbanRural]++
+			}
+		}
+	}
+	if attrs.PoliticalSocial != nil && attrs.PoliticalSocial.PoliticalLeaning != "" {
+		t.political[attrs.PoliticalSocial.PoliticalLeaning]++
+		t.politicalSeen++
+	}
+	if activity, err := strconv.ParseFloat(attrs.Custom["activity_level"], 64); err == nil {
+		t.activityTotal += activity
+		t.activityCount++
+		if activity > 0.5 {
+			t.activeMembers++
+		}
+	}
+}
+
+// averageAge is the mean age of the members whose age is known
+func (t *memberTally) averageAge() float64 {
+	if t.ageCount == 0 {
+		return 0
+	}
+	return t.ageTotal / float64(t.ageCount)
+}
+
+// politicalDistribution is the share of each leaning among the members
+// that have one
+func (t *memberTally) politicalDistribution() map[string]float64 {
+	result := make(map[string]float64, len(t.political))
+	for leaning, count := range t.political {
+		result[leaning] = float64(count) / float64(t.politicalSeen)
+	}
+	return result
+}
+
+// genderRatio is the share of all members with each gender
+func (t *memberTally) genderRatio() map[string]float64 {
+	result := make(map[string]float64, len(t.genders))
+	for gender, count := range t.genders {
+		result[gender] = float64(count) / float64(t.members)
+	}
+	return result
+}
+
+// engagementScore is the mean activity level of the members that have one
+func (t *memberTally) engagementScore() float64 {
+	if t.activityCount == 0 {
+		return 0
+	}
+	return t.activityTotal / float64(t.activityCount)
+}
+
+// tallyMembers counts every member in members
+func tallyMembers(members []types.Identity) *memberTally {
+	t := newMemberTally()
+	for _, member := range members {
+		t.add(member)
+	}
+	return t
+}
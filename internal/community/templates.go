@@ -0,0 +1,51 @@
+package community
+
+import (
+	"errors"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// ErrTemplatesUnsupported is returned when the storage backend does not
+// implement storage.TemplateStore
+var ErrTemplatesUnsupported = errors.New("storage backend does not support community templates")
+
+func (s *Service) templateStore() (storage.TemplateStore, error) {
+	store, ok := storage.As[storage.TemplateStore](s.storage)
+	if !ok {
+		return nil, ErrTemplatesUnsupported
+	}
+	return store, nil
+}
+
+// SaveTemplate stores a generation config under name for reuse, replacing
+// any template of that name
+func (s *Service) SaveTemplate(name string, config types.CommunityGenerationConfig) (types.CommunityTemplate, error) {
+	store, err := s.templateStore()
+	if err != nil {
+		return types.CommunityTemplate{}, err
+	}
+	if err := store.SaveCommunityTemplate(name, config); err != nil {
+		return types.CommunityTemplate{}, err
+	}
+	return store.GetCommunityTemplate(name)
+}
+
+// GetTemplate returns the template with the given name
+func (s *Service) GetTemplate(name string) (types.CommunityTemplate, error) {
+	store, err := s.templateStore()
+	if err != nil {
+		return types.CommunityTemplate{}, err
+	}
+	return store.GetCommunityTemplate(name)
+}
+
+// ListTemplates returns all saved templates ordered by name
+func (s *Service) ListTemplates() ([]types.CommunityTemplate, error) {
+	store, err := s.templateStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.ListCommunityTemplates()
+}
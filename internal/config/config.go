@@ -1,9 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,6 +26,15 @@ type Config struct {
 	
 	// Logging configuration
 	Logging LoggingConfig `yaml:"logging"`
+	
+	// Validation configuration
+	Validation ValidationConfig `yaml:"validation"`
+	
+	// Persona management configuration
+	Personas PersonasConfig `yaml:"personas"`
+	
+	// Community generation configuration
+	Community CommunityConfig `yaml:"community"`
 }
 
 type HTTPConfig struct {
@@ -34,6 +45,16 @@ type HTTPConfig struct {
 	EnableTLS       bool          `yaml:"enable_tls"`
 	CertFile        string        `yaml:"cert_file"`
 	KeyFile         string        `yaml:"key_file"`
+	// StrictJSON rejects request bodies containing fields the endpoint does
+	// not define instead of silently ignoring them
+	StrictJSON bool `yaml:"strict_json"`
+	// EnableCompression gzips responses of at least CompressionMinSize
+	// bytes for clients that accept it
+	EnableCompression  bool `yaml:"enable_compression"`
+	CompressionMinSize int  `yaml:"compression_min_size"`
+	// MaxBodySize is the largest request body in bytes accepted before
+	// responding 413 Payload Too Large; 0 disables the limit
+	MaxBodySize int `yaml:"max_body_size"`
 }
 
 type GRPCConfig struct {
@@ -44,11 +65,25 @@ type GRPCConfig struct {
 	EnableTLS       bool          `yaml:"enable_tls"`
 	CertFile        string        `yaml:"cert_file"`
 	KeyFile         string        `yaml:"key_file"`
+	// ClientCAFile enables mutual TLS: clients must present a certificate
+	// signed by one of the CAs in this PEM file
+	ClientCAFile string `yaml:"client_ca_file"`
+	// EnableReflection registers the gRPC reflection service so tools like
+	// grpcurl can list and call methods without the .proto file
+	EnableReflection bool `yaml:"enable_reflection"`
 }
 
 type StorageConfig struct {
-	Type    string `yaml:"type"` // memory, file
+	Type    string `yaml:"type"` // memory, file, redis
 	DataDir string `yaml:"data_dir"`
+
+	RedisAddr     string `yaml:"redis_addr"` // host:port, for redis storage
+	RedisPassword string `yaml:"redis_password"`
+	RedisDB       int    `yaml:"redis_db"`
+
+	// CacheSize is how many personas, and separately how many identities,
+	// to keep in an LRU cache in front of the backend; 0 disables the cache
+	CacheSize int `yaml:"cache_size"`
 }
 
 type ClientConfig struct {
@@ -59,7 +94,55 @@ type ClientConfig struct {
 
 type SecurityConfig struct {
 	EnableAuth bool   `yaml:"enable_auth"`
-	APIKey     string `yaml:"api_key"`
+	APIKey     string `yaml:"api_key"` // has write scope
+	// APIKeys lists further keys as "key:scope" entries, where scope is
+	// ScopeRead or ScopeWrite; an entry without a scope has write scope
+	APIKeys []string   `yaml:"api_keys"`
+	CORS    CORSConfig `yaml:"cors"`
+}
+
+// API key scopes
+const (
+	// ScopeRead allows only GET, HEAD and OPTIONS requests
+	ScopeRead = "read"
+	// ScopeWrite allows every request
+	ScopeWrite = "write"
+)
+
+// KeyScopes returns every configured API key mapped to its scope. Errors
+// name entries by position so they never reveal a key.
+func (s SecurityConfig) KeyScopes() (map[string]string, error) {
+	keys := make(map[string]string, len(s.APIKeys)+1)
+	if s.APIKey != "" {
+		keys[s.APIKey] = ScopeWrite
+	}
+	for n, entry := range s.APIKeys {
+		key, scope := entry, ScopeWrite
+		if i := strings.LastIndex(entry, ":"); i >= 0 {
+			key, scope = entry[:i], entry[i+1:]
+		}
+		if key == "" {
+			return nil, fmt.Errorf("entry %d has no key", n+1)
+		}
+		if scope != ScopeRead && scope != ScopeWrite {
+			return nil, fmt.Errorf("entry %d has scope %q, expected %q or %q", n+1, scope, ScopeRead, ScopeWrite)
+		}
+		if existing, ok := keys[key]; ok && existing != scope {
+			return nil, fmt.Errorf("entry %d gives a key two different scopes", n+1)
+		}
+		keys[key] = scope
+	}
+	return keys, nil
+}
+
+// CORSConfig controls the CORS headers of the HTTP API. Lists are written
+// comma-separated in YAML files and environment variables.
+type CORSConfig struct {
+	Enabled          bool     `yaml:"enabled"`         // false sends no CORS headers at all
+	AllowedOrigins   []string `yaml:"allowed_origins"` // "*" allows any origin
+	AllowedMethods   []string `yaml:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers"`
+	AllowCredentials bool     `yaml:"allow_credentials"` // not allowed with the "*" origin
 }
 
 type LoggingConfig struct {
@@ -67,43 +150,181 @@ type LoggingConfig struct {
 	Format string `yaml:"format"` // json, text
 }
 
+type ValidationConfig struct {
+	MaxTagsPerEntity int `yaml:"max_tags_per_entity"`
+	MaxTagLength     int `yaml:"max_tag_length"`
+}
+
+type PersonasConfig struct {
+	BackupOnWrite bool   `yaml:"backup_on_write"` // snapshot personas before update/delete
+	BackupDir     string `yaml:"backup_dir"`
+	MaxBackups    int    `yaml:"max_backups"` // per persona, oldest are pruned
+	SoftDelete    bool   `yaml:"soft_delete"` // mark deleted personas instead of removing them
+}
+
+type CommunityConfig struct {
+	GenerationTimeout time.Duration `yaml:"generation_timeout"` // 0 disables the deadline
+	GenerationWorkers int           `yaml:"generation_workers"` // 0 uses one per CPU
+	// PoolsFile is a JSON or CSV file of interests, cities and names for
+	// generated members; empty uses the built-in pools
+	PoolsFile string `yaml:"pools_file"`
+	// CallbackHosts, when set, are the only hosts generation callbacks may
+	// be sent to. When empty any host is allowed except loopback, private
+	// and link-local addresses.
+	CallbackHosts []string `yaml:"callback_hosts"`
+}
+
+// DefaultConfig returns the built-in configuration used when neither a
+// config file nor environment variables set a value
+func DefaultConfig() *Config {
+	return &Config{
+		HTTP: HTTPConfig{
+			Port:               "8080",
+			ReadTimeout:        30 * time.Second,
+			WriteTimeout:       30 * time.Second,
+			ShutdownTimeout:    10 * time.Second,
+			EnableTLS:          false,
+			CertFile:           "",
+			KeyFile:            "",
+			StrictJSON:         false,
+			EnableCompression:  true,
+			CompressionMinSize: 1024,
+			MaxBodySize:        1024 * 1024, // 1MB
+		},
+		GRPC: GRPCConfig{
+			Port:              "9090",
+			MaxRecvMsgSize:    4 * 1024 * 1024, // 4MB
+			MaxSendMsgSize:    4 * 1024 * 1024, // 4MB
+			ConnectionTimeout: 5 * time.Second,
+			EnableTLS:         false,
+			CertFile:          "",
+			KeyFile:           "",
+			ClientCAFile:      "",
+			EnableReflection:  false,
+		},
+		Storage: StorageConfig{
+			Type:    "file",
+			DataDir: "./data",
+
+			RedisAddr:     "localhost:6379",
+			RedisPassword: "",
+			RedisDB:       0,
+		},
+		Client: ClientConfig{
+			Type:      "grpc",
+			ServerURL: "localhost:9090",
+			Timeout:   30 * time.Second,
+		},
+		Security: SecurityConfig{
+			EnableAuth: false,
+			APIKey:     "",
+			CORS: CORSConfig{
+				Enabled:          true,
+				AllowedOrigins:   []string{"*"},
+				AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+				AllowedHeaders:   []string{"Content-Type", "Authorization", "X-API-Key", "If-Match", "If-None-Match"},
+				AllowCredentials: false,
+			},
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Validation: ValidationConfig{
+			MaxTagsPerEntity: 20,
+			MaxTagLength:     50,
+		},
+		Personas: PersonasConfig{
+			BackupOnWrite: false,
+			BackupDir:     "",
+			MaxBackups:    10,
+			SoftDelete:    true,
+		},
+		Community: CommunityConfig{
+			GenerationTimeout: 60 * time.Second,
+		},
+	}
+}
+
 // LoadConfig loads configuration from environment variables with defaults
 func LoadConfig() *Config {
+	return loadConfig(DefaultConfig())
+}
+
+// loadConfig overrides base with any values set in environment variables
+// and resolves derived settings such as the backup directory
+func loadConfig(base *Config) *Config {
 	config := &Config{
 		HTTP: HTTPConfig{
-			Port:            getEnv("FR0G_HTTP_PORT", "8080"),
-			ReadTimeout:     getDurationEnv("FR0G_HTTP_READ_TIMEOUT", 30*time.Second),
-			WriteTimeout:    getDurationEnv("FR0G_HTTP_WRITE_TIMEOUT", 30*time.Second),
-			ShutdownTimeout: getDurationEnv("FR0G_HTTP_SHUTDOWN_TIMEOUT", 10*time.Second),
-			EnableTLS:       getBoolEnv("FR0G_HTTP_ENABLE_TLS", false),
-			CertFile:        getEnv("FR0G_HTTP_CERT_FILE", ""),
-			KeyFile:         getEnv("FR0G_HTTP_KEY_FILE", ""),
+			Port:               getEnv("FR0G_HTTP_PORT", base.HTTP.Port),
+			ReadTimeout:        getDurationEnv("FR0G_HTTP_READ_TIMEOUT", base.HTTP.ReadTimeout),
+			WriteTimeout:       getDurationEnv("FR0G_HTTP_WRITE_TIMEOUT", base.HTTP.WriteTimeout),
+			ShutdownTimeout:    getDurationEnv("FR0G_HTTP_SHUTDOWN_TIMEOUT", base.HTTP.ShutdownTimeout),
+			EnableTLS:          getBoolEnv("FR0G_HTTP_ENABLE_TLS", base.HTTP.EnableTLS),
+			CertFile:           getEnv("FR0G_HTTP_CERT_FILE", base.HTTP.CertFile),
+			KeyFile:            getEnv("FR0G_HTTP_KEY_FILE", base.HTTP.KeyFile),
+			StrictJSON:         getBoolEnv("FR0G_HTTP_STRICT_JSON", base.HTTP.StrictJSON),
+			EnableCompression:  getBoolEnv("FR0G_HTTP_ENABLE_COMPRESSION", base.HTTP.EnableCompression),
+			CompressionMinSize: getIntEnv("FR0G_HTTP_COMPRESSION_MIN_SIZE", base.HTTP.CompressionMinSize),
+			MaxBodySize:        getIntEnv("FR0G_HTTP_MAX_BODY_SIZE", base.HTTP.MaxBodySize),
 		},
 		GRPC: GRPCConfig{
-			Port:              getEnv("FR0G_GRPC_PORT", "9090"),
-			MaxRecvMsgSize:    getIntEnv("FR0G_GRPC_MAX_RECV_MSG_SIZE", 4*1024*1024), // 4MB
-			MaxSendMsgSize:    getIntEnv("FR0G_GRPC_MAX_SEND_MSG_SIZE", 4*1024*1024), // 4MB
-			ConnectionTimeout: getDurationEnv("FR0G_GRPC_CONNECTION_TIMEOUT", 5*time.Second),
-			EnableTLS:         getBoolEnv("FR0G_GRPC_ENABLE_TLS", false),
-			CertFile:          getEnv("FR0G_GRPC_CERT_FILE", ""),
-			KeyFile:           getEnv("FR0G_GRPC_KEY_FILE", ""),
+			Port:              getEnv("FR0G_GRPC_PORT", base.GRPC.Port),
+			MaxRecvMsgSize:    getIntEnv("FR0G_GRPC_MAX_RECV_MSG_SIZE", base.GRPC.MaxRecvMsgSize),
+			MaxSendMsgSize:    getIntEnv("FR0G_GRPC_MAX_SEND_MSG_SIZE", base.GRPC.MaxSendMsgSize),
+			ConnectionTimeout: getDurationEnv("FR0G_GRPC_CONNECTION_TIMEOUT", base.GRPC.ConnectionTimeout),
+			EnableTLS:         getBoolEnv("FR0G_GRPC_ENABLE_TLS", base.GRPC.EnableTLS),
+			CertFile:          getEnv("FR0G_GRPC_CERT_FILE", base.GRPC.CertFile),
+			KeyFile:           getEnv("FR0G_GRPC_KEY_FILE", base.GRPC.KeyFile),
+			ClientCAFile:      getEnv("FR0G_GRPC_CLIENT_CA_FILE", base.GRPC.ClientCAFile),
+			EnableReflection:  getBoolEnv("FR0G_GRPC_ENABLE_REFLECTION", base.GRPC.EnableReflection),
 		},
 		Storage: StorageConfig{
-			Type:    getEnv("FR0G_STORAGE_TYPE", "file"),
-			DataDir: getEnv("FR0G_DATA_DIR", "./data"),
+			Type:    getEnv("FR0G_STORAGE_TYPE", base.Storage.Type),
+			DataDir: getEnv("FR0G_DATA_DIR", base.Storage.DataDir),
+
+			RedisAddr:     getEnv("FR0G_REDIS_ADDR", base.Storage.RedisAddr),
+			RedisPassword: getEnv("FR0G_REDIS_PASSWORD", base.Storage.RedisPassword),
+			RedisDB:       getIntEnv("FR0G_REDIS_DB", base.Storage.RedisDB),
+
+			CacheSize: getIntEnv("FR0G_STORAGE_CACHE_SIZE", base.Storage.CacheSize),
 		},
 		Client: ClientConfig{
-			Type:      getEnv("FR0G_CLIENT_TYPE", "grpc"),
-			ServerURL: getEnv("FR0G_SERVER_URL", "localhost:9090"),
-			Timeout:   getDurationEnv("FR0G_CLIENT_TIMEOUT", 30*time.Second),
+			Type:      getEnv("FR0G_CLIENT_TYPE", base.Client.Type),
+			ServerURL: getEnv("FR0G_SERVER_URL", base.Client.ServerURL),
+			Timeout:   getDurationEnv("FR0G_CLIENT_TIMEOUT", base.Client.Timeout),
 		},
 		Security: SecurityConfig{
-			EnableAuth: getBoolEnv("FR0G_ENABLE_AUTH", false),
-			APIKey:     getEnv("FR0G_API_KEY", ""),
+			EnableAuth: getBoolEnv("FR0G_ENABLE_AUTH", base.Security.EnableAuth),
+			APIKey:     getEnv("FR0G_API_KEY", base.Security.APIKey),
+			APIKeys:    getListEnv("FR0G_API_KEYS", base.Security.APIKeys),
+			CORS: CORSConfig{
+				Enabled:          getBoolEnv("FR0G_CORS_ENABLED", base.Security.CORS.Enabled),
+				AllowedOrigins:   getListEnv("FR0G_CORS_ALLOWED_ORIGINS", base.Security.CORS.AllowedOrigins),
+				AllowedMethods:   getListEnv("FR0G_CORS_ALLOWED_METHODS", base.Security.CORS.AllowedMethods),
+				AllowedHeaders:   getListEnv("FR0G_CORS_ALLOWED_HEADERS", base.Security.CORS.AllowedHeaders),
+				AllowCredentials: getBoolEnv("FR0G_CORS_ALLOW_CREDENTIALS", base.Security.CORS.AllowCredentials),
+			},
 		},
 		Logging: LoggingConfig{
-			Level:  getEnv("FR0G_LOG_LEVEL", "info"),
-			Format: getEnv("FR0G_LOG_FORMAT", "text"),
+			Level:  getEnv("FR0G_LOG_LEVEL", base.Logging.Level),
+			Format: getEnv("FR0G_LOG_FORMAT", base.Logging.Format),
+		},
+		Validation: ValidationConfig{
+			MaxTagsPerEntity: getIntEnv("FR0G_MAX_TAGS_PER_ENTITY", base.Validation.MaxTagsPerEntity),
+			MaxTagLength:     getIntEnv("FR0G_MAX_TAG_LENGTH", base.Validation.MaxTagLength),
+		},
+		Personas: PersonasConfig{
+			BackupOnWrite: getBoolEnv("FR0G_PERSONA_BACKUP_ON_WRITE", base.Personas.BackupOnWrite),
+			BackupDir:     getEnv("FR0G_PERSONA_BACKUP_DIR", base.Personas.BackupDir),
+			MaxBackups:    getIntEnv("FR0G_PERSONA_MAX_BACKUPS", base.Personas.MaxBackups),
+			SoftDelete:    getBoolEnv("FR0G_PERSONA_SOFT_DELETE", base.Personas.SoftDelete),
+		},
+		Community: CommunityConfig{
+			GenerationTimeout: getDurationEnv("FR0G_COMMUNITY_GENERATION_TIMEOUT", base.Community.GenerationTimeout),
+			GenerationWorkers: getIntEnv("FR0G_COMMUNITY_GENERATION_WORKERS", base.Community.GenerationWorkers),
+			PoolsFile:         getEnv("FR0G_COMMUNITY_POOLS_FILE", base.Community.PoolsFile),
+			CallbackHosts:     getListEnv("FR0G_COMMUNITY_CALLBACK_HOSTS", base.Community.CallbackHosts),
 		},
 	}
 	
@@ -114,6 +335,11 @@ func LoadConfig() *Config {
 		}
 	}
 	
+	// Default backups to live alongside the data directory
+	if config.Personas.BackupDir == "" {
+		config.Personas.BackupDir = filepath.Join(config.Storage.DataDir, "backups")
+	}
+	
 	return config
 }
 
@@ -146,6 +372,21 @@ func (c *Config) Validate() error {
 		errors = append(errors, securityErrors...)
 	}
 	
+	// Validate validation limits
+	if validationErrors := c.validateValidationConfig(); len(validationErrors) > 0 {
+		errors = append(errors, validationErrors...)
+	}
+	
+	// Validate persona management config
+	if personasErrors := c.validatePersonasConfig(); len(personasErrors) > 0 {
+		errors = append(errors, personasErrors...)
+	}
+	
+	// Validate community generation config
+	if communityErrors := c.validateCommunityConfig(); len(communityErrors) > 0 {
+		errors = append(errors, communityErrors...)
+	}
+	
 	// Cross-validation
 	if crossErrors := c.validateCrossConfig(); len(crossErrors) > 0 {
 		errors = append(errors, crossErrors...)
@@ -184,6 +425,25 @@ func getBoolEnv(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+// getListEnv reads a comma-separated list
+func getListEnv(key string, defaultValue []string) []string {
+	if value := os.Getenv(key); value != "" {
+		return splitList(value)
+	}
+	return defaultValue
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
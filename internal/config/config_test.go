@@ -0,0 +1,337 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearConfigEnv unsets every FR0G_ variable for the duration of the test
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(key, "FR0G_") {
+			t.Setenv(key, "")
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+const sampleYAML = `# Sample configuration
+http:
+  port: "8181"
+  read_timeout: 45s
+  strict_json: true  # Reject unknown fields
+
+grpc:
+  port: 9191
+  max_recv_msg_size: 1048576
+  enable_reflection: true
+
+storage:
+  type: 'memory'
+  data_dir: "/srv/aip # data"
+
+security:
+  enable_auth: true
+  api_key: "file-secret-key-0123456789"
+`
+
+func TestLoadConfigFromFile_YAML(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, "config.yaml", sampleYAML)
+
+	cfg, err := LoadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile failed: %v", err)
+	}
+
+	if cfg.HTTP.Port != "8181" || cfg.HTTP.ReadTimeout != 45*time.Second || !cfg.HTTP.StrictJSON {
+		t.Errorf("Unexpected HTTP config: %+v", cfg.HTTP)
+	}
+	if cfg.GRPC.Port != "9191" || cfg.GRPC.MaxRecvMsgSize != 1048576 || !cfg.GRPC.EnableReflection {
+		t.Errorf("Unexpected gRPC config: %+v", cfg.GRPC)
+	}
+	if cfg.Storage.Type != "memory" || cfg.Storage.DataDir != "/srv/aip # data" {
+		t.Errorf("Unexpected storage config: %+v", cfg.Storage)
+	}
+	if !cfg.Security.EnableAuth || cfg.Security.APIKey != "file-secret-key-0123456789" {
+		t.Errorf("Unexpected security config: %+v", cfg.Security)
+	}
+
+	// Keys missing from the file keep their defaults
+	if cfg.HTTP.WriteTimeout != 30*time.Second {
+		t.Errorf("Expected default write timeout, got %v", cfg.HTTP.WriteTimeout)
+	}
+	if cfg.Personas.MaxBackups != 10 {
+		t.Errorf("Expected default max backups, got %d", cfg.Personas.MaxBackups)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected loaded config to validate, got %v", err)
+	}
+}
+
+func TestLoadConfigFromFile_EnvOverridesFile(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, "config.yaml", sampleYAML)
+	t.Setenv("FR0G_HTTP_PORT", "8282")
+	t.Setenv("FR0G_ENABLE_AUTH", "false")
+
+	cfg, err := LoadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile failed: %v", err)
+	}
+	if cfg.HTTP.Port != "8282" {
+		t.Errorf("Expected env var to override the file port, got %s", cfg.HTTP.Port)
+	}
+	if cfg.Security.EnableAuth {
+		t.Error("Expected env var to override enable_auth from the file")
+	}
+	if cfg.GRPC.Port != "9191" {
+		t.Errorf("Expected file value where no env var is set, got %s", cfg.GRPC.Port)
+	}
+}
+
+func TestLoadConfigFromFile_JSON(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, "config.json", `{
+		"http": {"port": "8181", "shutdown_timeout": "5s"},
+		"grpc": {"max_send_msg_size": 2097152},
+		"storage": {"type": "memory"},
+		"personas": {"soft_delete": false}
+	}`)
+
+	cfg, err := LoadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile failed: %v", err)
+	}
+	if cfg.HTTP.Port != "8181" || cfg.HTTP.ShutdownTimeout != 5*time.Second {
+		t.Errorf("Unexpected HTTP config: %+v", cfg.HTTP)
+	}
+	if cfg.GRPC.MaxSendMsgSize != 2097152 {
+		t.Errorf("Expected max send size from file, got %d", cfg.GRPC.MaxSendMsgSize)
+	}
+	if cfg.Storage.Type != "memory" || cfg.Personas.SoftDelete {
+		t.Errorf("Unexpected storage or persona config: %+v %+v", cfg.Storage, cfg.Personas)
+	}
+}
+
+func TestLoadConfigFromFile_Example(t *testing.T) {
+	clearConfigEnv(t)
+
+	cfg, err := LoadConfigFromFile(filepath.Join("..", "..", "config.example.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load config.example.yaml: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected config.example.yaml to validate, got %v", err)
+	}
+}
+
+func TestLoadConfigFromFile_Invalid(t *testing.T) {
+	clearConfigEnv(t)
+
+	tests := map[string]string{
+		"unknown.yaml":   "http:\n  prot: \"8080\"\n",
+		"duration.yaml":  "http:\n  read_timeout: soon\n",
+		"integer.yaml":   "grpc:\n  max_recv_msg_size: lots\n",
+		"list.yaml":      "http:\n  - port\n",
+		"duplicate.yaml": "http:\n  port: \"1\"\nhttp:\n  port: \"2\"\n",
+		"indent.yaml":    "http:\n  port: \"1\"\n    key_file: x\n",
+		"scalar.json":    `{"http": "8080"}`,
+		"config.toml":    "port = 8080\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadConfigFromFile(writeConfigFile(t, name, content)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	if _, err := LoadConfigFromFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestLoadConfig_CORS(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, "config.yaml", `security:
+  cors:
+    allowed_origins: "https://a.example, https://b.example"
+    allow_credentials: true
+`)
+
+	cfg, err := LoadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile failed: %v", err)
+	}
+	cors := cfg.Security.CORS
+	if !cors.Enabled || !cors.AllowCredentials || strings.Join(cors.AllowedOrigins, "|") != "https://a.example|https://b.example" {
+		t.Errorf("Unexpected CORS config: %+v", cors)
+	}
+	if len(cors.AllowedMethods) == 0 {
+		t.Error("Expected default methods to be kept")
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected config to validate, got %v", err)
+	}
+
+	t.Setenv("FR0G_CORS_ALLOWED_METHODS", "GET,,HEAD ")
+	t.Setenv("FR0G_CORS_ENABLED", "false")
+	cfg = LoadConfig()
+	if cfg.Security.CORS.Enabled || strings.Join(cfg.Security.CORS.AllowedMethods, "|") != "GET|HEAD" {
+		t.Errorf("Expected env vars to set CORS, got %+v", cfg.Security.CORS)
+	}
+
+	path = writeConfigFile(t, "config.json", `{"security": {"cors": {"allowed_headers": ["Content-Type", "X-API-Key"]}}}`)
+	if cfg, err = LoadConfigFromFile(path); err != nil {
+		t.Fatalf("LoadConfigFromFile failed: %v", err)
+	}
+	if strings.Join(cfg.Security.CORS.AllowedHeaders, "|") != "Content-Type|X-API-Key" {
+		t.Errorf("Expected headers from a JSON array, got %v", cfg.Security.CORS.AllowedHeaders)
+	}
+}
+
+func TestValidate_CORS(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Security.CORS.AllowCredentials = true
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "security.cors.allow_credentials") {
+		t.Errorf("Expected credentials with the * origin to be rejected, got %v", err)
+	}
+
+	cfg = DefaultConfig()
+	cfg.Security.CORS.AllowedOrigins = nil
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "security.cors.allowed_origins") {
+		t.Errorf("Expected an empty origin list to be rejected, got %v", err)
+	}
+	cfg.Security.CORS.Enabled = false
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected disabled CORS to need no origins, got %v", err)
+	}
+}
+
+func TestValidate_ReportsAllErrors(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HTTP.Port = "70000"
+	cfg.GRPC.Port = "9090"
+	cfg.Storage.Type = "tape"
+	cfg.Client.Type = "carrier-pigeon"
+
+	err := cfg.Validate()
+	problems, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected ValidationErrors, got %T: %v", err, err)
+	}
+	fields := make(map[string]bool)
+	for _, problem := range problems {
+		fields[problem.Field] = true
+	}
+	for _, field := range []string{"http.port", "storage.type", "client.type"} {
+		if !fields[field] {
+			t.Errorf("Expected a problem with %s, got %v", field, err)
+		}
+	}
+
+	// Conflicting ports are reported alongside the other problems
+	cfg = DefaultConfig()
+	cfg.GRPC.Port = cfg.HTTP.Port
+	cfg.Storage.Type = "file"
+	cfg.Storage.DataDir = ""
+	err = cfg.Validate()
+	for _, want := range []string{"ports: HTTP and gRPC ports cannot be the same: " + cfg.HTTP.Port, "storage.data_dir"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got %v", want, err)
+		}
+	}
+
+	// A missing port is not also reported as a conflict
+	cfg = DefaultConfig()
+	cfg.HTTP.Port = ""
+	cfg.GRPC.Port = ""
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), "ports:") {
+		t.Errorf("Expected only the missing ports to be reported, got %v", err)
+	}
+}
+
+func TestValidate_SizeLimits(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HTTP.MaxBodySize = -1
+	cfg.GRPC.MaxRecvMsgSize = 1 << 30
+	cfg.GRPC.MaxSendMsgSize = 0
+
+	err := cfg.Validate()
+	for _, field := range []string{"http.max_body_size", "grpc.max_recv_msg_size", "grpc.max_send_msg_size"} {
+		if err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected a problem with %s, got %v", field, err)
+		}
+	}
+
+	// A zero body size turns the limit off
+	cfg = DefaultConfig()
+	cfg.HTTP.MaxBodySize = 0
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a disabled body limit to be valid, got %v", err)
+	}
+}
+
+func TestSecurityConfig_KeyScopes(t *testing.T) {
+	security := SecurityConfig{
+		APIKey:  "primary-key-0123456",
+		APIKeys: []string{"reader-key-0123456:read", "writer-key-0123456:write", "plain-key-0123456"},
+	}
+	keys, err := security.KeyScopes()
+	if err != nil {
+		t.Fatalf("KeyScopes failed: %v", err)
+	}
+	want := map[string]string{
+		"primary-key-0123456": ScopeWrite,
+		"reader-key-0123456":  ScopeRead,
+		"writer-key-0123456":  ScopeWrite,
+		"plain-key-0123456":   ScopeWrite,
+	}
+	if len(keys) != len(want) {
+		t.Errorf("Expected %d keys, got %v", len(want), keys)
+	}
+	for key, scope := range want {
+		if keys[key] != scope {
+			t.Errorf("Expected %s to have scope %q, got %q", key, scope, keys[key])
+		}
+	}
+
+	for name, entries := range map[string][]string{
+		"unknown scope":   {"reader-key-0123456:admin"},
+		"missing key":     {":read"},
+		"conflicting key": {"reader-key-0123456:read", "reader-key-0123456:write"},
+	} {
+		if _, err := (SecurityConfig{APIKeys: entries}).KeyScopes(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		} else if strings.Contains(err.Error(), "reader-key") {
+			t.Errorf("%s: expected the error not to reveal the key, got %v", name, err)
+		}
+	}
+
+	// Scoped keys alone satisfy enable_auth, but must be long enough
+	cfg := DefaultConfig()
+	cfg.Security.EnableAuth = true
+	cfg.Security.APIKeys = []string{"reader-key-0123456:read"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected scoped keys alone to be valid, got %v", err)
+	}
+	cfg.Security.APIKeys = []string{"short:read"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "security.api_keys") {
+		t.Errorf("Expected a short scoped key to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadConfigFromFile loads configuration from a YAML or JSON file, chosen by
+// its .yaml, .yml or .json extension. Keys follow the yaml tags of Config, as
+// in config.example.yaml; keys left out keep their defaults. Environment
+// variables override values from the file, just as they override defaults
+// in LoadConfig. Unknown keys are rejected so typos do not go unnoticed.
+//
+// Only the YAML needed for configuration is supported: nested mappings of
+// scalar values, with optional quoting and comments.
+func LoadConfigFromFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var values map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		values, err = parseYAML(data)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	default:
+		return nil, fmt.Errorf("unsupported config file type %q (supported: .yaml, .yml, .json)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	base := DefaultConfig()
+	if err := applyValues(reflect.ValueOf(base).Elem(), values, ""); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return loadConfig(base), nil
+}
+
+var (
+	durationType   = reflect.TypeOf(time.Duration(0))
+	stringListType = reflect.TypeOf([]string(nil))
+)
+
+// applyValues sets the fields of the struct v from values, matching keys to
+// the fields' yaml tags. prefix is the dotted path of v, for error messages.
+func applyValues(v reflect.Value, values map[string]interface{}, prefix string) error {
+	fields := make(map[string]reflect.Value)
+	for i := 0; i < v.NumField(); i++ {
+		tag := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if tag != "" && tag != "-" {
+			fields[tag] = v.Field(i)
+		}
+	}
+
+	for key, value := range values {
+		path := prefix + key
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("unknown key %s", path)
+		}
+		if value == nil {
+			continue // An empty value keeps the default
+		}
+
+		if field.Kind() == reflect.Struct {
+			nested, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s must be a mapping", path)
+			}
+			if err := applyValues(field, nested, path+"."); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if field.Type() == stringListType {
+			list, err := stringList(value)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			field.Set(reflect.ValueOf(list))
+			continue
+		}
+
+		if err := setScalar(field, value); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// setScalar stores a YAML string or JSON value in a string, bool, int or
+// duration field. Durations are written like "30s".
+func setScalar(field reflect.Value, value interface{}) error {
+	var text string
+	switch value := value.(type) {
+	case string:
+		text = value
+	case bool:
+		text = strconv.FormatBool(value)
+	case json.Number:
+		text = value.String()
+	default:
+		return fmt.Errorf("unsupported value %v", value)
+	}
+
+	switch {
+	case field.Type() == durationType:
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", text)
+		}
+		field.SetInt(int64(duration))
+	case field.Kind() == reflect.String:
+		field.SetString(text)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		field.SetInt(int64(n))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// stringList reads a list from a comma-separated string, as YAML files
+// write it, or from a JSON array of strings
+func stringList(value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case string:
+		return splitList(value), nil
+	case []interface{}:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("list items must be strings")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("must be a comma-separated string or an array")
+}
+
+// yamlLine is a non-blank, comment-free line of a YAML document
+type yamlLine struct {
+	number int
+	indent int
+	key    string
+	value  string
+	hasVal bool
+}
+
+// parseYAML parses a YAML document of nested mappings whose leaves are
+// scalars. Scalars are returned as strings, or nil when empty.
+func parseYAML(data []byte) (map[string]interface{}, error) {
+	var lines []yamlLine
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	number := 0
+	for scanner.Scan() {
+		number++
+		raw := strings.TrimRight(stripYAMLComment(scanner.Text()), " \t\r")
+		content := strings.TrimLeft(raw, " ")
+		if content == "" || content == "---" {
+			continue
+		}
+		if strings.HasPrefix(content, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", number)
+		}
+		if strings.HasPrefix(content, "- ") || content == "-" {
+			return nil, fmt.Errorf("line %d: lists are not supported", number)
+		}
+
+		key, value, ok := strings.Cut(content, ":")
+		if !ok || (value != "" && value[0] != ' ' && value[0] != '\t') {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", number)
+		}
+		lines = append(lines, yamlLine{
+			number: number,
+			indent: len(raw) - len(content),
+			key:    strings.TrimSpace(key),
+			value:  strings.TrimSpace(value),
+			hasVal: strings.TrimSpace(value) != "",
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	values, rest, err := parseYAMLMapping(lines, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("line %d: unexpected indentation", rest[0].number)
+	}
+	return values, nil
+}
+
+// parseYAMLMapping parses the mapping at the given indent from the start of
+// lines and returns the lines that follow it
+func parseYAMLMapping(lines []yamlLine, indent int) (map[string]interface{}, []yamlLine, error) {
+	values := make(map[string]interface{})
+	for len(lines) > 0 {
+		line := lines[0]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, nil, fmt.Errorf("line %d: unexpected indentation", line.number)
+		}
+		if _, exists := values[line.key]; exists {
+			return nil, nil, fmt.Errorf("line %d: duplicate key %s", line.number, line.key)
+		}
+		lines = lines[1:]
+
+		if line.hasVal {
+			value, err := parseYAMLScalar(line.value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %v", line.number, err)
+			}
+			values[line.key] = value
+			continue
+		}
+
+		// A key without a value opens a nested mapping, or is empty
+		if len(lines) == 0 || lines[0].indent <= indent {
+			values[line.key] = nil
+			continue
+		}
+		nested, rest, err := parseYAMLMapping(lines, lines[0].indent)
+		if err != nil {
+			return nil, nil, err
+		}
+		values[line.key] = nested
+		lines = rest
+	}
+	return values, lines, nil
+}
+
+// parseYAMLScalar unquotes a scalar value. Plain "null" and "~" are nil.
+func parseYAMLScalar(value string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s", value)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return nil, fmt.Errorf("invalid quoted string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case value == "null" || value == "~":
+		return nil, nil
+	case strings.ContainsAny(value[:1], "[{&*!|>"):
+		return nil, fmt.Errorf("unsupported value %s", value)
+	}
+	return value, nil
+}
+
+// stripYAMLComment removes a trailing "# comment" that is not inside quotes
+func stripYAMLComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -67,6 +67,20 @@ func (c *Config) validateHTTPConfig() []ValidationError {
 		})
 	}
 	
+	if c.HTTP.EnableCompression && c.HTTP.CompressionMinSize < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "http.compression_min_size",
+			Message: "compression min size cannot be negative",
+		})
+	}
+	
+	if c.HTTP.MaxBodySize < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "http.max_body_size",
+			Message: "max body size cannot be negative",
+		})
+	}
+	
 	// Validate TLS config
 	if c.HTTP.EnableTLS {
 		if c.HTTP.CertFile == "" {
@@ -86,6 +100,10 @@ func (c *Config) validateHTTPConfig() []ValidationError {
 	return errors
 }
 
+// maxGRPCMsgSize bounds the gRPC message size limits; a larger message is
+// almost certainly a misconfiguration rather than a real persona or identity
+const maxGRPCMsgSize = 64 * 1024 * 1024 // 64MB
+
 func (c *Config) validateGRPCConfig() []ValidationError {
 	var errors []ValidationError
 	
@@ -108,6 +126,11 @@ func (c *Config) validateGRPCConfig() []ValidationError {
 			Field:   "grpc.max_recv_msg_size",
 			Message: "max receive message size must be positive",
 		})
+	} else if c.GRPC.MaxRecvMsgSize > maxGRPCMsgSize {
+		errors = append(errors, ValidationError{
+			Field:   "grpc.max_recv_msg_size",
+			Message: fmt.Sprintf("max receive message size cannot exceed %d bytes", maxGRPCMsgSize),
+		})
 	}
 	
 	if c.GRPC.MaxSendMsgSize <= 0 {
@@ -115,6 +138,11 @@ func (c *Config) validateGRPCConfig() []ValidationError {
 			Field:   "grpc.max_send_msg_size",
 			Message: "max send message size must be positive",
 		})
+	} else if c.GRPC.MaxSendMsgSize > maxGRPCMsgSize {
+		errors = append(errors, ValidationError{
+			Field:   "grpc.max_send_msg_size",
+			Message: fmt.Sprintf("max send message size cannot exceed %d bytes", maxGRPCMsgSize),
+		})
 	}
 	
 	// Validate connection timeout
@@ -139,6 +167,11 @@ func (c *Config) validateGRPCConfig() []ValidationError {
 				Message: "key file is required when TLS is enabled",
 			})
 		}
+	} else if c.GRPC.ClientCAFile != "" {
+		errors = append(errors, ValidationError{
+			Field:   "grpc.client_ca_file",
+			Message: "client CA file requires TLS to be enabled",
+		})
 	}
 	
 	return errors
@@ -148,7 +181,7 @@ func (c *Config) validateStorageConfig() []ValidationError {
 	var errors []ValidationError
 	
 	// Validate storage type
-	validTypes := []string{"memory", "file"}
+	validTypes := []string{"memory", "file", "redis"}
 	if !contains(validTypes, c.Storage.Type) {
 		errors = append(errors, ValidationError{
 			Field:   "storage.type",
@@ -164,6 +197,28 @@ func (c *Config) validateStorageConfig() []ValidationError {
 		})
 	}
 	
+	if c.Storage.Type == "redis" {
+		if c.Storage.RedisAddr == "" {
+			errors = append(errors, ValidationError{
+				Field:   "storage.redis_addr",
+				Message: "redis address is required for redis storage",
+			})
+		}
+		if c.Storage.RedisDB < 0 {
+			errors = append(errors, ValidationError{
+				Field:   "storage.redis_db",
+				Message: "redis database must not be negative",
+			})
+		}
+	}
+	
+	if c.Storage.CacheSize < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "storage.cache_size",
+			Message: "cache size must not be negative",
+		})
+	}
+	
 	return errors
 }
 
@@ -194,7 +249,7 @@ func (c *Config) validateSecurityConfig() []ValidationError {
 	var errors []ValidationError
 	
 	// Validate API key if auth is enabled
-	if c.Security.EnableAuth && c.Security.APIKey == "" {
+	if c.Security.EnableAuth && c.Security.APIKey == "" && len(c.Security.APIKeys) == 0 {
 		errors = append(errors, ValidationError{
 			Field:   "security.api_key",
 			Message: "API key is required when authentication is enabled",
@@ -209,17 +264,110 @@ func (c *Config) validateSecurityConfig() []ValidationError {
 		})
 	}
 	
+	if keys, err := c.Security.KeyScopes(); err != nil {
+		errors = append(errors, ValidationError{
+			Field:   "security.api_keys",
+			Message: err.Error(),
+		})
+	} else {
+		for key := range keys {
+			if len(key) < 16 && key != c.Security.APIKey {
+				errors = append(errors, ValidationError{
+					Field:   "security.api_keys",
+					Message: "API keys must be at least 16 characters long",
+				})
+				break
+			}
+		}
+	}
+	
+	// Validate CORS settings
+	cors := c.Security.CORS
+	if cors.Enabled && len(cors.AllowedOrigins) == 0 {
+		errors = append(errors, ValidationError{
+			Field:   "security.cors.allowed_origins",
+			Message: "at least one origin is required when CORS is enabled",
+		})
+	}
+	if cors.AllowCredentials && contains(cors.AllowedOrigins, "*") {
+		errors = append(errors, ValidationError{
+			Field:   "security.cors.allow_credentials",
+			Message: "credentials cannot be allowed for the * origin; list the origins instead",
+		})
+	}
+	
+	return errors
+}
+
+func (c *Config) validateValidationConfig() []ValidationError {
+	var errors []ValidationError
+	
+	if c.Validation.MaxTagsPerEntity <= 0 {
+		errors = append(errors, ValidationError{
+			Field:   "validation.max_tags_per_entity",
+			Message: "max tags per entity must be positive",
+		})
+	}
+	
+	if c.Validation.MaxTagLength <= 0 {
+		errors = append(errors, ValidationError{
+			Field:   "validation.max_tag_length",
+			Message: "max tag length must be positive",
+		})
+	}
+	
+	return errors
+}
+
+func (c *Config) validatePersonasConfig() []ValidationError {
+	var errors []ValidationError
+	
+	if c.Personas.BackupOnWrite {
+		if c.Personas.BackupDir == "" {
+			errors = append(errors, ValidationError{
+				Field:   "personas.backup_dir",
+				Message: "backup directory is required when backups are enabled",
+			})
+		}
+		if c.Personas.MaxBackups <= 0 {
+			errors = append(errors, ValidationError{
+				Field:   "personas.max_backups",
+				Message: "max backups must be positive when backups are enabled",
+			})
+		}
+	}
+	
+	return errors
+}
+
+func (c *Config) validateCommunityConfig() []ValidationError {
+	var errors []ValidationError
+	
+	if c.Community.GenerationTimeout < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "community.generation_timeout",
+			Message: "generation timeout cannot be negative",
+		})
+	}
+	
+	if c.Community.GenerationWorkers < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "community.generation_workers",
+			Message: "generation workers cannot be negative",
+		})
+	}
+	
 	return errors
 }
 
 func (c *Config) validateCrossConfig() []ValidationError {
 	var errors []ValidationError
 	
-	// Validate port conflicts
-	if c.HTTP.Port == c.GRPC.Port {
+	// Validate port conflicts; a missing port is reported on its own
+	if c.HTTP.Port != "" && c.HTTP.Port == c.GRPC.Port {
 		errors = append(errors, ValidationError{
 			Field:   "ports",
-			Message: "HTTP and gRPC ports cannot be the same",
+			Message: fmt.Sprintf("HTTP and gRPC ports cannot be the same: %s", c.HTTP.Port),
 		})
 	}
 	
@@ -0,0 +1,51 @@
+// Package errs defines the kinds of error returned by the service and
+// storage layers, so callers can tell them apart with errors.Is instead of
+// matching messages.
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound means the requested record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrValidation means the input was rejected before anything was stored
+	ErrValidation = errors.New("validation failed")
+	// ErrConflict means the request clashes with the stored state, such as
+	// a stale version
+	ErrConflict = errors.New("conflict")
+)
+
+// Error is an error of a given kind. Its message is the detail alone, so
+// wrapping an existing message in a kind does not change what users see.
+type Error struct {
+	Kind error // ErrNotFound, ErrValidation or ErrConflict
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap exposes both the kind and the detail, which may itself wrap a
+// sentinel
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// NotFound returns an ErrNotFound error formatted like fmt.Errorf
+func NotFound(format string, args ...interface{}) error {
+	return &Error{Kind: ErrNotFound, Err: fmt.Errorf(format, args...)}
+}
+
+// Validation returns an ErrValidation error formatted like fmt.Errorf
+func Validation(format string, args ...interface{}) error {
+	return &Error{Kind: ErrValidation, Err: fmt.Errorf(format, args...)}
+}
+
+// Conflict returns an ErrConflict error formatted like fmt.Errorf
+func Conflict(format string, args ...interface{}) error {
+	return &Error{Kind: ErrConflict, Err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,30 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKinds(t *testing.T) {
+	sentinel := errors.New("persona is deleted")
+	err := fmt.Errorf("failed to create identity: %w", Conflict("%w: %s", sentinel, "p1"))
+
+	if err.Error() != "failed to create identity: persona is deleted: p1" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+	if !errors.Is(err, ErrConflict) || !errors.Is(err, sentinel) {
+		t.Errorf("expected %v to match ErrConflict and its sentinel", err)
+	}
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrValidation) {
+		t.Errorf("expected %v to match only its own kind", err)
+	}
+
+	var kindErr *Error
+	if !errors.As(NotFound("persona not found: %s", "p1"), &kindErr) || kindErr.Kind != ErrNotFound {
+		t.Errorf("expected errors.As to find the kind, got %+v", kindErr)
+	}
+	if !errors.Is(Validation("name is required"), ErrValidation) {
+		t.Error("expected a validation error")
+	}
+}
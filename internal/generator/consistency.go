@@ -0,0 +1,158 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// topicProfile describes the occupations, education and interests that fit
+// personas about a broad topic. Education levels use the community
+// generator's vocabulary (some_high_school, high_school, associate, bachelor,
+// graduate), since ApplyPersonaConsistency runs on community members.
+type topicProfile struct {
+	keywords    []string
+	occupations []string
+	education   []string
+	interests   []string
+}
+
+var topicProfiles = map[string]topicProfile{
+	"technology": {
+		keywords:    []string{"tech", "software", "computer", "programming", "developer", "engineering", "cyber", "security", "data", "ai", "golang", "cloud"},
+		occupations: []string{"software engineer", "data scientist", "systems administrator", "security analyst", "product manager", "devops engineer"},
+		education:   []string{"bachelor", "graduate"},
+		interests:   []string{"technology", "programming", "gaming", "science", "gadgets"},
+	},
+	"healthcare": {
+		keywords:    []string{"health", "medical", "medicine", "nurse", "nursing", "doctor", "clinical", "hospital", "care"},
+		occupations: []string{"nurse", "physician", "pharmacist", "paramedic", "physical therapist", "medical researcher"},
+		education:   []string{"bachelor", "graduate"},
+		interests:   []string{"health", "fitness", "science", "volunteering"},
+	},
+	"finance": {
+		keywords:    []string{"finance", "financial", "banking", "investment", "accounting", "economics", "trading"},
+		occupations: []string{"accountant", "financial analyst", "banker", "investment advisor", "actuary"},
+		education:   []string{"bachelor", "graduate"},
+		interests:   []string{"business", "investing", "economics", "politics"},
+	},
+	"education": {
+		keywords:    []string{"teach", "teacher", "education", "school", "tutor", "academic"},
+		occupations: []string{"teacher", "professor", "tutor", "school administrator", "librarian"},
+		education:   []string{"bachelor", "graduate"},
+		interests:   []string{"reading", "history", "science", "writing"},
+	},
+	"law": {
+		keywords:    []string{"law", "legal", "lawyer", "attorney", "court", "compliance"},
+		occupations: []string{"lawyer", "paralegal", "judge", "compliance officer"},
+		education:   []string{"bachelor", "graduate"},
+		interests:   []string{"politics", "history", "reading", "debate"},
+	},
+	"arts": {
+		keywords:    []string{"art", "artist", "design", "music", "writing", "creative", "film", "photography"},
+		occupations: []string{"graphic designer", "musician", "writer", "photographer", "illustrator"},
+		interests:   []string{"art", "music", "movies", "photography", "crafts"},
+	},
+}
+
+// profileForPersona finds the topic profile matching a persona's topic or
+// name. Keywords match whole words, or word prefixes for keywords longer
+// than three letters, to avoid false positives.
+func profileForPersona(p types.Persona) (string, topicProfile, bool) {
+	words := strings.FieldsFunc(strings.ToLower(p.Topic+" "+p.Name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+
+	best, bestScore := "", 0
+	for name, profile := range topicProfiles {
+		score := 0
+		for _, word := range words {
+			for _, keyword := range profile.keywords {
+				if word == keyword || strings.HasPrefix(word, keyword) && len(keyword) > 3 {
+					score++
+				}
+			}
+		}
+		// Ties are broken by name so matching is deterministic
+		if score > bestScore || score == bestScore && score > 0 && name < best {
+			best, bestScore = name, score
+		}
+	}
+	if bestScore == 0 {
+		return "", topicProfile{}, false
+	}
+	return best, topicProfiles[best], true
+}
+
+// ApplyPersonaConsistency nudges a generated identity towards its persona's
+// topic. Strength (0.0-1.0) is the probability that each of occupation,
+// education and interests is adjusted when it does not already fit. A
+// strength of zero, or a persona with no recognizable topic, leaves the
+// identity unchanged.
+func (g *Generator) ApplyPersonaConsistency(identity *types.Identity, persona types.Persona, strength float64) {
+	if identity == nil || strength <= 0 {
+		return
+	}
+	_, profile, ok := profileForPersona(persona)
+	if !ok {
+		return
+	}
+
+	if identity.RichAttributes == nil {
+		identity.RichAttributes = &types.RichAttributes{}
+	}
+	attrs := identity.RichAttributes
+	if attrs.Demographics == nil {
+		attrs.Demographics = &types.Demographics{}
+	}
+	if attrs.Preferences == nil {
+		attrs.Preferences = &types.Preferences{}
+	}
+
+	if !contains(profile.occupations, attrs.Demographics.Occupation) && g.randFloat64() < strength {
+		attrs.Demographics.Occupation = profile.occupations[g.randIntn(len(profile.occupations))]
+	}
+
+	if len(profile.education) > 0 && !contains(profile.education, attrs.Demographics.Education) && g.randFloat64() < strength {
+		attrs.Demographics.Education = profile.education[g.randIntn(len(profile.education))]
+	}
+
+	if !containsAny(profile.interests, attrs.Preferences.Interests) && g.randFloat64() < strength {
+		interest := profile.interests[g.randIntn(len(profile.interests))]
+		attrs.Preferences.Interests = append([]string{interest}, attrs.Preferences.Interests...)
+	}
+}
+
+// PersonaConsistencyWarnings reports attributes of an identity that conflict
+// with its persona's topic. Warnings are advisory and never block a write.
+func PersonaConsistencyWarnings(identity types.Identity, persona types.Persona) []string {
+	topic, profile, ok := profileForPersona(persona)
+	if !ok || identity.RichAttributes == nil || identity.RichAttributes.Demographics == nil {
+		return nil
+	}
+
+	var warnings []string
+	if occupation := identity.RichAttributes.Demographics.Occupation; occupation != "" && !contains(profile.occupations, occupation) {
+		warnings = append(warnings, fmt.Sprintf("occupation %q is unusual for %s persona %q", occupation, topic, persona.Name))
+	}
+	return warnings
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values, candidates []string) bool {
+	for _, candidate := range candidates {
+		if contains(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,20 +3,53 @@ package generator
 import (
 	"crypto/rand"
 	"encoding/binary"
+	mathrand "math/rand"
+	"sort"
+	"sync"
 
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/names"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/parallel"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
 )
 
+// randSource is the source of randomness used by a Generator
+type randSource interface {
+	Intn(n int) int
+	Float64() float64
+}
+
 // Generator provides methods for creating random and directed identities
-type Generator struct{}
+type Generator struct {
+	rand    randSource
+	workers int
+}
 
-// NewGenerator creates a new generator (no longer needs a seeded random number generator)
+// NewGenerator creates a new generator backed by crypto/rand
 func NewGenerator() *Generator {
-	return &Generator{}
+	return &Generator{rand: cryptoSource{}}
+}
+
+// NewSeededGenerator creates a deterministic generator: generators created
+// with the same seed produce the same identities for the same calls, which
+// makes populations reproducible for tests and research.
+func NewSeededGenerator(seed int64) *Generator {
+	return &Generator{rand: &lockedSource{rand: mathrand.New(mathrand.NewSource(seed))}}
 }
 
-// GenerateRandomIdentity creates a random identity based on a persona
+// SetWorkers bounds how many goroutines GenerateCommunity uses. A zero or
+// negative count uses one per CPU.
+func (g *Generator) SetWorkers(workers int) {
+	g.workers = workers
+}
+
+// GenerateRandomIdentity creates a random identity based on a persona. An
+// empty name is replaced with a generated one.
 func (g *Generator) GenerateRandomIdentity(personaID string, name string) *types.Identity {
+	richAttributes := g.generateRandomRichAttributes()
+	if name == "" {
+		name = g.generateName(richAttributes.Demographics)
+	}
+
 	identity := &types.Identity{
 		PersonaId:      personaID,
 		Name:           name,
@@ -24,7 +57,7 @@ func (g *Generator) GenerateRandomIdentity(personaID string, name string) *types
 		Background:     g.generateRandomBackground(),
 		IsActive:       true,
 		Tags:           g.generateRandomTags(),
-		RichAttributes: g.generateRandomRichAttributes(),
+		RichAttributes: richAttributes,
 	}
 
 	return identity
@@ -57,23 +90,49 @@ func (g *Generator) GenerateDirectedIdentity(personaID string, name string,
 	return identity
 }
 
-// GenerateCommunity generates a community of identities with specified demographics
+// communityBlockSize is how many consecutive members of a community draw
+// from the same random source
+const communityBlockSize = 64
+
+// GenerateCommunity generates a community of identities with specified
+// demographics. Members are generated concurrently, in blocks of
+// communityBlockSize. A seeded generator seeds each block from its own
+// sequence before any block runs, so the same seed reproduces the same
+// community whatever the number of workers.
 func (g *Generator) GenerateCommunity(personaID string, size int,
 	communitySpec *CommunitySpecification) []*types.Identity {
 
 	identities := make([]*types.Identity, size)
 
-	for i := 0; i < size; i++ {
-		demographics := g.generateCommunityDemographics(communitySpec)
-		psychographics := g.generateCommunityPsychographics(communitySpec)
-		name := g.generateName(demographics)
-
-		identities[i] = g.GenerateDirectedIdentity(personaID, name, demographics, psychographics)
+	blocks := make([]*Generator, (size+communityBlockSize-1)/communityBlockSize)
+	for b := range blocks {
+		blocks[b] = g.blockGenerator()
 	}
 
+	parallel.For(len(blocks), g.workers, func(b int) {
+		block := blocks[b]
+		for i := b * communityBlockSize; i < min(size, (b+1)*communityBlockSize); i++ {
+			demographics := block.generateCommunityDemographics(communitySpec)
+			psychographics := block.generateCommunityPsychographics(communitySpec)
+			name := block.generateName(demographics)
+
+			identities[i] = block.GenerateDirectedIdentity(personaID, name, demographics, psychographics)
+		}
+	})
+
 	return identities
 }
 
+// blockGenerator returns the generator for one block of a community: a new
+// generator seeded from g's sequence when g is seeded, otherwise g itself,
+// since crypto/rand needs no partitioning
+func (g *Generator) blockGenerator() *Generator {
+	if seeded, ok := g.rand.(*lockedSource); ok {
+		return NewSeededGenerator(seeded.Int63())
+	}
+	return g
+}
+
 // CommunitySpecification defines the characteristics of a community to generate
 type CommunitySpecification struct {
 	Location               *types.Location    `json:"location,omitempty"`
@@ -85,11 +144,23 @@ type CommunitySpecification struct {
 	PersonalityProfile     *types.Personality `json:"personality_profile,omitempty"` // Average personality for the community
 }
 
-// Helper functions for cryptographically secure random numbers
-func cryptoRandIntn(max int) int {
+// randIntn returns a random int in [0, max), or 0 if max is not positive
+func (g *Generator) randIntn(max int) int {
 	if max <= 0 {
 		return 0
 	}
+	return g.rand.Intn(max)
+}
+
+// randFloat64 returns a random float64 in [0, 1)
+func (g *Generator) randFloat64() float64 {
+	return g.rand.Float64()
+}
+
+// cryptoSource draws cryptographically secure random numbers
+type cryptoSource struct{}
+
+func (cryptoSource) Intn(max int) int {
 	var b [8]byte
 	_, err := rand.Read(b[:])
 	if err != nil {
@@ -99,14 +170,38 @@ func cryptoRandIntn(max int) int {
 	return int(num % uint64(max))
 }
 
-func cryptoRandFloat64() float64 {
+func (cryptoSource) Float64() float64 {
 	var b [8]byte
 	_, err := rand.Read(b[:])
 	if err != nil {
 		panic(err)
 	}
-	num := binary.BigEndian.Uint64(b[:])
-	return float64(num) / (1 << 64)
+	// Use the top 53 bits so the result is always strictly below 1
+	return float64(binary.BigEndian.Uint64(b[:])>>11) / (1 << 53)
+}
+
+// lockedSource makes a math/rand source safe for concurrent use
+type lockedSource struct {
+	mu   sync.Mutex
+	rand *mathrand.Rand
+}
+
+func (s *lockedSource) Intn(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Intn(n)
+}
+
+func (s *lockedSource) Float64() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Float64()
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Int63()
 }
 
 // Helper methods for generating random content
@@ -118,7 +213,7 @@ func (g *Generator) generateRandomDescription() string {
 		"An independent thinker with unique perspectives.",
 		"A dedicated professional with a balanced lifestyle.",
 	}
-	return descriptions[cryptoRandIntn(len(descriptions))]
+	return descriptions[g.randIntn(len(descriptions))]
 }
 
 func (g *Generator) generateRandomBackground() string {
@@ -129,7 +224,7 @@ func (g *Generator) generateRandomBackground() string {
 		"Built a career and life through determination and adaptability.",
 		"Formed meaningful relationships that continue to inspire growth.",
 	}
-	return backgrounds[cryptoRandIntn(len(backgrounds))]
+	return backgrounds[g.randIntn(len(backgrounds))]
 }
 
 func (g *Generator) generateRandomTags() []string {
@@ -139,13 +234,13 @@ func (g *Generator) generateRandomTags() []string {
 		"traditional", "progressive", "practical", "idealistic", "resilient",
 	}
 
-	numTags := cryptoRandIntn(4) + 1 // 1-4 tags
+	numTags := g.randIntn(4) + 1 // 1-4 tags
 	tags := make([]string, numTags)
 	used := make(map[string]bool)
 
 	for i := 0; i < numTags; i++ {
 		for {
-			tag := allTags[cryptoRandIntn(len(allTags))]
+			tag := allTags[g.randIntn(len(allTags))]
 			if !used[tag] {
 				tags[i] = tag
 				used[tag] = true
@@ -181,10 +276,10 @@ func (g *Generator) generateRandomDemographics() *types.Demographics {
 	education := []string{"high_school", "bachelors", "masters", "phd"}
 
 	return &types.Demographics{
-		Age:       int32(ages[cryptoRandIntn(len(ages))]),
-		Gender:    genders[cryptoRandIntn(len(genders))],
-		Ethnicity: ethnicities[cryptoRandIntn(len(ethnicities))],
-		Education: education[cryptoRandIntn(len(education))],
+		Age:       int32(ages[g.randIntn(len(ages))]),
+		Gender:    genders[g.randIntn(len(genders))],
+		Ethnicity: ethnicities[g.randIntn(len(ethnicities))],
+		Education: education[g.randIntn(len(education))],
 		Location: &types.Location{
 			Country:    "United States",
 			City:       "New York",
@@ -196,11 +291,11 @@ func (g *Generator) generateRandomDemographics() *types.Demographics {
 func (g *Generator) generateRandomPsychographics() *types.Psychographics {
 	return &types.Psychographics{
 		Personality: &types.Personality{
-			Openness:          cryptoRandFloat64(),
-			Conscientiousness: cryptoRandFloat64(),
-			Extraversion:      cryptoRandFloat64(),
-			Agreeableness:     cryptoRandFloat64(),
-			Neuroticism:       cryptoRandFloat64(),
+			Openness:          g.randFloat64(),
+			Conscientiousness: g.randFloat64(),
+			Extraversion:      g.randFloat64(),
+			Agreeableness:     g.randFloat64(),
+			Neuroticism:       g.randFloat64(),
 		},
 		Values:        []string{"honesty", "compassion", "growth"},
 		RiskTolerance: "medium",
@@ -282,7 +377,7 @@ func (g *Generator) generateCommunityDemographics(spec *CommunitySpecification)
 	demographics := &types.Demographics{}
 
 	if spec.AgeRange != nil {
-		demographics.Age = int32(cryptoRandIntn(int(spec.AgeRange.Max-spec.AgeRange.Min+1)) + int(spec.AgeRange.Min))
+		demographics.Age = int32(g.randIntn(int(spec.AgeRange.Max-spec.AgeRange.Min+1)) + int(spec.AgeRange.Min))
 	}
 
 	if spec.Location != nil {
@@ -314,35 +409,39 @@ func (g *Generator) generateCommunityPsychographics(spec *CommunitySpecification
 	return psychographics
 }
 
+// generateName picks a name from the pool for the demographics' country
 func (g *Generator) generateName(demographics *types.Demographics) string {
-	// Simple name generation - in a real implementation, you'd use a proper name database
-	firstNames := []string{"Alex", "Jordan", "Casey", "Taylor", "Morgan", "Riley", "Quinn", "Avery"}
-	lastNames := []string{"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis"}
-
-	return firstNames[cryptoRandIntn(len(firstNames))] + " " + lastNames[cryptoRandIntn(len(lastNames))]
+	return names.NewNameGenerator(g.randIntn).ForDemographics(demographics)
 }
 
 // Utility methods
 func (g *Generator) selectFromDistribution(distribution map[string]float64) string {
-	r := cryptoRandFloat64()
+	// Walk keys in sorted order so seeded generators are reproducible
+	keys := make([]string, 0, len(distribution))
+	for key := range distribution {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	r := g.randFloat64()
 	cumulative := 0.0
 
-	for key, prob := range distribution {
-		cumulative += prob
+	for _, key := range keys {
+		cumulative += distribution[key]
 		if r <= cumulative {
 			return key
 		}
 	}
 
 	// Fallback to first key
-	for key := range distribution {
-		return key
+	if len(keys) > 0 {
+		return keys[0]
 	}
 	return ""
 }
 
 func (g *Generator) addVariation(base float64, variation float64) float64 {
-	change := (cryptoRandFloat64() - 0.5) * 2 * variation
+	change := (g.randFloat64() - 0.5) * 2 * variation
 	result := base + change
 	if result < 0 {
 		return 0
@@ -0,0 +1,140 @@
+package generator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+func TestApplyPersonaConsistency_SkewsTowardTopic(t *testing.T) {
+	g := NewGenerator()
+	tech := types.Persona{Name: "Tech Expert", Topic: "Software Engineering"}
+	techOccupations := topicProfiles["technology"].occupations
+
+	countTech := func(strength float64) int {
+		n := 0
+		for range 200 {
+			identity := g.GenerateRandomIdentity("persona-id", "Member")
+			g.ApplyPersonaConsistency(identity, tech, strength)
+			if contains(techOccupations, identity.RichAttributes.Demographics.Occupation) {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := countTech(0); n != 0 {
+		t.Errorf("Expected no tech occupations without consistency, got %d", n)
+	}
+	if n := countTech(0.9); n < 150 {
+		t.Errorf("Expected high strength to skew toward tech occupations, got %d of 200", n)
+	}
+	if n := countTech(1); n != 200 {
+		t.Errorf("Expected full strength to always pick tech occupations, got %d of 200", n)
+	}
+}
+
+func TestApplyPersonaConsistency_UnknownTopic(t *testing.T) {
+	g := NewGenerator()
+	identity := g.GenerateRandomIdentity("persona-id", "Member")
+	before := identity.RichAttributes.Demographics.Education
+
+	g.ApplyPersonaConsistency(identity, types.Persona{Name: "Generalist", Topic: "Everything"}, 1)
+	if identity.RichAttributes.Demographics.Occupation != "" || identity.RichAttributes.Demographics.Education != before {
+		t.Errorf("Expected identity to be unchanged for unknown topic, got %+v", identity.RichAttributes.Demographics)
+	}
+}
+
+func TestPersonaConsistencyWarnings(t *testing.T) {
+	healthcare := types.Persona{Name: "Healthcare Professional", Topic: "Medical care"}
+	identity := types.Identity{
+		RichAttributes: &types.RichAttributes{
+			Demographics: &types.Demographics{Occupation: "plumber"},
+		},
+	}
+
+	warnings := PersonaConsistencyWarnings(identity, healthcare)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "plumber") {
+		t.Errorf("Expected occupation warning, got %v", warnings)
+	}
+
+	identity.RichAttributes.Demographics.Occupation = "nurse"
+	if warnings := PersonaConsistencyWarnings(identity, healthcare); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for consistent identity, got %v", warnings)
+	}
+}
+
+func TestNewSeededGenerator_Reproducible(t *testing.T) {
+	spec := &CommunitySpecification{
+		AgeRange:           &types.AgeRange{Min: 18, Max: 80},
+		GenderDistribution: map[string]float64{"female": 0.5, "male": 0.5},
+		PersonalityProfile: &types.Personality{Openness: 0.5, Conscientiousness: 0.5},
+	}
+
+	first := NewSeededGenerator(42).GenerateCommunity("persona-id", 20, spec)
+	second := NewSeededGenerator(42).GenerateCommunity("persona-id", 20, spec)
+	if !reflect.DeepEqual(first, second) {
+		t.Error("Expected the same seed to reproduce the same community")
+	}
+
+	other := NewSeededGenerator(7).GenerateCommunity("persona-id", 20, spec)
+	if reflect.DeepEqual(first, other) {
+		t.Error("Expected different seeds to produce different communities")
+	}
+
+	a := NewSeededGenerator(42).GenerateRandomIdentity("persona-id", "Member")
+	b := NewSeededGenerator(42).GenerateRandomIdentity("persona-id", "Member")
+	if !reflect.DeepEqual(a, b) {
+		t.Error("Expected the same seed to reproduce the same identity")
+	}
+}
+
+func TestGenerateCommunity_SeededAcrossWorkers(t *testing.T) {
+	spec := &CommunitySpecification{AgeRange: &types.AgeRange{Min: 18, Max: 80}}
+
+	// Several blocks, the last one partial
+	size := 3*communityBlockSize + 5
+	sequential := NewSeededGenerator(42)
+	sequential.SetWorkers(1)
+	concurrent := NewSeededGenerator(42)
+	concurrent.SetWorkers(8)
+
+	first := sequential.GenerateCommunity("persona-id", size, spec)
+	second := concurrent.GenerateCommunity("persona-id", size, spec)
+	if len(first) != size || !reflect.DeepEqual(first, second) {
+		t.Error("Expected the same seed to reproduce the same community with any number of workers")
+	}
+}
+
+func BenchmarkGenerateCommunity(b *testing.B) {
+	spec := &CommunitySpecification{AgeRange: &types.AgeRange{Min: 18, Max: 80}}
+	for _, bench := range []struct {
+		name    string
+		workers int
+	}{
+		{"sequential", 1},
+		{"parallel", 0},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			g := NewSeededGenerator(42)
+			g.SetWorkers(bench.workers)
+			for i := 0; i < b.N; i++ {
+				g.GenerateCommunity("persona-id", 10000, spec)
+			}
+		})
+	}
+}
+
+func TestGenerateRandomIdentity_GeneratesName(t *testing.T) {
+	identity := NewGenerator().GenerateRandomIdentity("persona-id", "")
+	if identity.Name == "" {
+		t.Error("Expected a generated name when none is given")
+	}
+
+	named := NewGenerator().GenerateRandomIdentity("persona-id", "Alex Chen")
+	if named.Name != "Alex Chen" {
+		t.Errorf("Expected the given name to be kept, got %q", named.Name)
+	}
+}
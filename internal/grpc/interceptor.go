@@ -0,0 +1,79 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LoggingInterceptor returns a unary interceptor that logs each call as a
+// single JSON line to out and turns a panicking handler into a
+// codes.Internal error instead of crashing the server. The panic value and
+// stack are logged but not sent to the client.
+func LoggingInterceptor(out io.Writer) grpc.UnaryServerInterceptor {
+	logger := newCallLogger(out)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer logger.finish(info.FullMethod, time.Now(), &err)
+		return handler(ctx, req)
+	}
+}
+
+// StreamLoggingInterceptor is the streaming counterpart of
+// LoggingInterceptor. A streaming call is logged once, when it ends.
+func StreamLoggingInterceptor(out io.Writer) grpc.StreamServerInterceptor {
+	logger := newCallLogger(out)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer logger.finish(info.FullMethod, time.Now(), &err)
+		return handler(srv, ss)
+	}
+}
+
+type callLogger struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func newCallLogger(out io.Writer) *callLogger {
+	return &callLogger{encoder: json.NewEncoder(out)}
+}
+
+// finish must be deferred directly so that it can recover a panic from the
+// handler, which it replaces with a codes.Internal error in *err
+func (l *callLogger) finish(method string, start time.Time, err *error) {
+	entry := callLogEntry{
+		Time:   start.UTC().Format(time.RFC3339Nano),
+		Method: method,
+	}
+
+	if r := recover(); r != nil {
+		entry.Panic = fmt.Sprint(r)
+		entry.Stack = string(debug.Stack())
+		*err = status.Errorf(codes.Internal, "internal server error")
+	}
+
+	entry.Code = status.Code(*err).String()
+	entry.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+
+	l.mu.Lock()
+	l.encoder.Encode(entry)
+	l.mu.Unlock()
+}
+
+type callLogEntry struct {
+	Time      string  `json:"time"`
+	Method    string  `json:"method"`
+	Code      string  `json:"code"`
+	LatencyMs float64 `json:"latency_ms"`
+	Panic     string  `json:"panic,omitempty"`
+	Stack     string  `json:"stack,omitempty"`
+}
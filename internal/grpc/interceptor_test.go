@@ -0,0 +1,122 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/fr0g-vibe/fr0g-ai-aip/internal/grpc/pb"
+)
+
+// panickingServer panics in GetPersona and StreamPersonas and leaves
+// everything else unimplemented
+type panickingServer struct {
+	pb.UnimplementedPersonaServiceServer
+}
+
+func (panickingServer) GetPersona(context.Context, *pb.GetPersonaRequest) (*pb.GetPersonaResponse, error) {
+	panic("boom")
+}
+
+func (panickingServer) StreamPersonas(*pb.StreamPersonasRequest, grpc.ServerStreamingServer[pb.Persona]) error {
+	panic("boom")
+}
+
+func TestLoggingInterceptor_RecoversPanics(t *testing.T) {
+	var logs bytes.Buffer
+	lis := bufconn.Listen(bufSize)
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(LoggingInterceptor(&logs)))
+	pb.RegisterPersonaServiceServer(s, panickingServer{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	defer conn.Close()
+	client := pb.NewPersonaServiceClient(conn)
+
+	_, err = client.GetPersona(context.Background(), &pb.GetPersonaRequest{Id: "any"})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("Expected Internal status, got %v", err)
+	}
+	if strings.Contains(status.Convert(err).Message(), "boom") {
+		t.Error("Expected the panic value not to reach the client")
+	}
+
+	// The server keeps serving after a panic
+	_, err = client.ListPersonas(context.Background(), &pb.ListPersonasRequest{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("Expected Unimplemented after a recovered panic, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %d: %q", len(lines), logs.String())
+	}
+	var entry callLogEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Failed to parse log line: %v", err)
+	}
+	if !strings.HasSuffix(entry.Method, "/GetPersona") {
+		t.Errorf("Expected GetPersona method, got %q", entry.Method)
+	}
+	if entry.Code != codes.Internal.String() || entry.Panic != "boom" || entry.Stack == "" {
+		t.Errorf("Expected an Internal entry with the panic and stack, got %+v", entry)
+	}
+	if entry.LatencyMs < 0 {
+		t.Errorf("Expected a non-negative latency, got %v", entry.LatencyMs)
+	}
+}
+
+func TestStreamLoggingInterceptor_RecoversPanics(t *testing.T) {
+	var logs bytes.Buffer
+	lis := bufconn.Listen(bufSize)
+	s := grpc.NewServer(grpc.ChainStreamInterceptor(StreamLoggingInterceptor(&logs)))
+	pb.RegisterPersonaServiceServer(s, panickingServer{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	defer conn.Close()
+	client := pb.NewPersonaServiceClient(conn)
+
+	stream, err := client.StreamPersonas(context.Background(), &pb.StreamPersonasRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("Expected Internal status, got %v", err)
+	}
+	if strings.Contains(status.Convert(err).Message(), "boom") {
+		t.Error("Expected the panic value not to reach the client")
+	}
+
+	var entry callLogEntry
+	if err := json.Unmarshal(bytes.TrimSpace(logs.Bytes()), &entry); err != nil {
+		t.Fatalf("Failed to parse log line %q: %v", logs.String(), err)
+	}
+	if !strings.HasSuffix(entry.Method, "/StreamPersonas") {
+		t.Errorf("Expected StreamPersonas method, got %q", entry.Method)
+	}
+	if entry.Code != codes.Internal.String() || entry.Panic != "boom" || entry.Stack == "" {
+		t.Errorf("Expected an Internal entry with the panic and stack, got %+v", entry)
+	}
+}
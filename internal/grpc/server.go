@@ -2,14 +2,21 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"os"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/community"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/config"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
 	pb "github.com/fr0g-vibe/fr0g-ai-aip/internal/grpc/pb"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/persona"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
@@ -19,8 +26,9 @@ import (
 // PersonaServer implements the gRPC PersonaService
 type PersonaServer struct {
 	pb.UnimplementedPersonaServiceServer
-	service *persona.Service
-	config  *config.Config
+	service          *persona.Service
+	communityService *community.Service
+	config           *config.Config
 }
 
 // StartGRPCServer starts a real gRPC server using protobuf
@@ -30,16 +38,18 @@ func StartGRPCServer(port string) error {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer()
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(LoggingInterceptor(os.Stderr)),
+		grpc.ChainStreamInterceptor(StreamLoggingInterceptor(os.Stderr)),
+	)
 	
 	// Create a default service for the standalone server
 	memStorage := storage.NewMemoryStorage()
 	service := persona.NewService(memStorage)
-	personaServer := &PersonaServer{
-		service: service,
-	}
+	personaServer := NewPersonaServer(nil, service)
 	
 	pb.RegisterPersonaServiceServer(s, personaServer)
+	registerHealthServer(s)
 
 	fmt.Printf("gRPC server listening on port %s\n", port)
 	fmt.Println("Using real gRPC with protobuf")
@@ -49,23 +59,124 @@ func StartGRPCServer(port string) error {
 
 // NewPersonaServer creates a new gRPC persona server
 func NewPersonaServer(cfg *config.Config, service *persona.Service) *PersonaServer {
-	return &PersonaServer{
+	server := &PersonaServer{
 		service: service,
 		config:  cfg,
 	}
+	if service != nil {
+		server.communityService = community.NewService(service.GetStorage())
+	}
+	return server
 }
 
 // StartGRPCServerWithConfig starts a gRPC server with full configuration
 func StartGRPCServerWithConfig(cfg *config.Config, service *persona.Service) error {
-	lis, err := net.Listen("tcp", ":"+cfg.GRPC.Port)
+	return StartGRPCServerContext(context.Background(), cfg, service)
+}
+
+// StartGRPCServerContext starts a gRPC server with full configuration and
+// serves until ctx is cancelled. On cancellation the health service reports
+// NOT_SERVING before the server stops gracefully, and nil is returned.
+func StartGRPCServerContext(ctx context.Context, cfg *config.Config, service *persona.Service) error {
+	s, err := NewGRPCServer(cfg, service)
+	if err != nil {
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		s.Shutdown(context.Background())
+	})
+	defer stop()
+
+	return s.Start()
+}
+
+// GRPCServer is a configured gRPC server that can be shut down gracefully,
+// the gRPC counterpart of api.Server
+type GRPCServer struct {
+	config       *config.Config
+	server       *grpc.Server
+	health       *health.Server
+	gracefulStop func() // drains the server; replaceable in tests
+}
+
+// NewGRPCServer creates a gRPC server for cfg. It fails only if TLS is
+// enabled and its credentials cannot be loaded.
+func NewGRPCServer(cfg *config.Config, service *persona.Service) (*GRPCServer, error) {
+	s, healthServer, err := newGRPCServer(cfg, service)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCServer{
+		config:       cfg,
+		server:       s,
+		health:       healthServer,
+		gracefulStop: s.GracefulStop,
+	}, nil
+}
+
+// Start listens on the configured port and serves until Shutdown is called,
+// then returns nil
+func (s *GRPCServer) Start() error {
+	lis, err := net.Listen("tcp", ":"+s.config.GRPC.Port)
 	if err != nil {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
+	if s.config.GRPC.EnableTLS {
+		fmt.Println("gRPC TLS enabled")
+	}
+	if s.config.GRPC.EnableReflection {
+		fmt.Println("gRPC reflection enabled")
+	}
+
+	fmt.Printf("gRPC server listening on port %s\n", s.config.GRPC.Port)
+	fmt.Println("Using real gRPC with protobuf")
 
+	if err := s.server.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown reports NOT_SERVING to health checks and stops the server
+// gracefully, waiting for in-flight calls to finish. If ctx is done first the
+// remaining calls are cancelled and ctx.Err() is returned.
+func (s *GRPCServer) Shutdown(ctx context.Context) error {
+	s.health.Shutdown()
+
+	drained := make(chan struct{})
+	go func() {
+		s.gracefulStop()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		<-drained
+		return ctx.Err()
+	}
+}
+
+// newGRPCServer configures a gRPC server and registers its services. The
+// returned health server already reports SERVING. An error is returned only
+// if TLS is enabled and its credentials cannot be loaded.
+func newGRPCServer(cfg *config.Config, service *persona.Service) (*grpc.Server, *health.Server, error) {
 	// Configure gRPC server options
 	opts := []grpc.ServerOption{
 		grpc.MaxRecvMsgSize(cfg.GRPC.MaxRecvMsgSize),
 		grpc.MaxSendMsgSize(cfg.GRPC.MaxSendMsgSize),
+		grpc.ChainUnaryInterceptor(LoggingInterceptor(os.Stderr)),
+		grpc.ChainStreamInterceptor(StreamLoggingInterceptor(os.Stderr)),
+	}
+	if cfg.GRPC.EnableTLS {
+		creds, err := serverCredentials(cfg.GRPC)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, grpc.Creds(creds))
 	}
 
 	s := grpc.NewServer(opts...)
@@ -73,11 +184,38 @@ func StartGRPCServerWithConfig(cfg *config.Config, service *persona.Service) err
 	// Register the persona service
 	personaServer := NewPersonaServer(cfg, service)
 	pb.RegisterPersonaServiceServer(s, personaServer)
+	healthServer := registerHealthServer(s)
 
-	fmt.Printf("gRPC server listening on port %s\n", cfg.GRPC.Port)
-	fmt.Println("Using real gRPC with protobuf")
+	// Reflection lets grpcurl and similar tools discover the API at runtime
+	if cfg.GRPC.EnableReflection {
+		reflection.Register(s)
+	}
 
-	return s.Serve(lis)
+	return s, healthServer, nil
+}
+
+// registerHealthServer registers the standard grpc.health.v1 service on s
+// and marks both the server as a whole and the persona service as SERVING
+func registerHealthServer(s *grpc.Server) *health.Server {
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(s, healthServer)
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(pb.PersonaService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	return healthServer
+}
+
+// errorCode maps the errs kind of a service error to a gRPC status code.
+// Errors of no known kind are internal failures.
+func errorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, errs.ErrNotFound):
+		return codes.NotFound
+	case errors.Is(err, errs.ErrValidation):
+		return codes.InvalidArgument
+	case errors.Is(err, errs.ErrConflict):
+		return codes.Aborted
+	}
+	return codes.Internal
 }
 
 // CreatePersona creates a new persona
@@ -95,7 +233,7 @@ func (s *PersonaServer) CreatePersona(ctx context.Context, req *pb.CreatePersona
 	
 	err := s.service.CreatePersona(p)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "failed to create persona: %v", err)
+		return nil, status.Errorf(errorCode(err), "failed to create persona: %v", err)
 	}
 
 	return &pb.CreatePersonaResponse{
@@ -115,7 +253,7 @@ func (s *PersonaServer) GetPersona(ctx context.Context, req *pb.GetPersonaReques
 
 	p, err := s.service.GetPersona(req.Id)
 	if err != nil {
-		return nil, status.Errorf(codes.NotFound, "persona not found: %v", err)
+		return nil, status.Errorf(errorCode(err), "persona not found: %v", err)
 	}
 
 	return &pb.GetPersonaResponse{
@@ -131,7 +269,7 @@ func (s *PersonaServer) ListPersonas(ctx context.Context, req *pb.ListPersonasRe
 
 	personas, err := s.service.ListPersonas()
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to list personas: %v", err)
+		return nil, status.Errorf(errorCode(err), "failed to list personas: %v", err)
 	}
 
 	var protoPersonas []*pb.Persona
@@ -144,6 +282,30 @@ func (s *PersonaServer) ListPersonas(ctx context.Context, req *pb.ListPersonasRe
 	}, nil
 }
 
+// StreamPersonas sends each persona as a separate message, stopping early if
+// the client cancels
+func (s *PersonaServer) StreamPersonas(req *pb.StreamPersonasRequest, stream grpc.ServerStreamingServer[pb.Persona]) error {
+	if s.service == nil {
+		return status.Errorf(codes.Internal, "persona service not available")
+	}
+
+	personas, err := s.service.ListPersonas()
+	if err != nil {
+		return status.Errorf(errorCode(err), "failed to list personas: %v", err)
+	}
+
+	for i := range personas {
+		if err := stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		if err := stream.Send(types.PersonaToProto(&personas[i])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // UpdatePersona updates an existing persona
 func (s *PersonaServer) UpdatePersona(ctx context.Context, req *pb.UpdatePersonaRequest) (*pb.UpdatePersonaResponse, error) {
 	if req.Id == "" {
@@ -164,7 +326,12 @@ func (s *PersonaServer) UpdatePersona(ctx context.Context, req *pb.UpdatePersona
 
 	err := s.service.UpdatePersona(req.Id, *p)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "failed to update persona: %v", err)
+		return nil, status.Errorf(errorCode(err), "failed to update persona: %v", err)
+	}
+
+	// Return the stored persona so the client sees the new version
+	if updated, err := s.service.GetPersona(req.Id); err == nil {
+		p = &updated
 	}
 
 	return &pb.UpdatePersonaResponse{
@@ -185,7 +352,7 @@ func (s *PersonaServer) DeletePersona(ctx context.Context, req *pb.DeletePersona
 	err := s.service.DeletePersona(req.Id)
 
 	if err != nil {
-		return nil, status.Errorf(codes.NotFound, "failed to delete persona: %v", err)
+		return nil, status.Errorf(errorCode(err), "failed to delete persona: %v", err)
 	}
 
 	return &pb.DeletePersonaResponse{}, nil
@@ -206,7 +373,7 @@ func (s *PersonaServer) CreateIdentity(ctx context.Context, req *pb.CreateIdenti
 	
 	err := s.service.CreateIdentity(identity)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "failed to create identity: %v", err)
+		return nil, status.Errorf(errorCode(err), "failed to create identity: %v", err)
 	}
 
 	return &pb.CreateIdentityResponse{
@@ -214,6 +381,37 @@ func (s *PersonaServer) CreateIdentity(ctx context.Context, req *pb.CreateIdenti
 	}, nil
 }
 
+// BatchCreateIdentities creates several identities in one call, reporting a
+// result per identity
+func (s *PersonaServer) BatchCreateIdentities(ctx context.Context, req *pb.BatchCreateIdentitiesRequest) (*pb.BatchCreateIdentitiesResponse, error) {
+	if len(req.Identities) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "at least one identity is required")
+	}
+
+	if s.service == nil {
+		return nil, status.Errorf(codes.Internal, "persona service not available")
+	}
+
+	identities := make([]*types.Identity, len(req.Identities))
+	for i, identity := range req.Identities {
+		identities[i] = types.ProtoToIdentity(identity)
+	}
+
+	results := s.service.CreateIdentities(identities)
+
+	resp := &pb.BatchCreateIdentitiesResponse{
+		Results: make([]*pb.IdentityBatchResult, len(results)),
+	}
+	for i, result := range results {
+		resp.Results[i] = &pb.IdentityBatchResult{
+			Index: int32(result.Index),
+			Id:    result.Id,
+			Error: result.Error,
+		}
+	}
+	return resp, nil
+}
+
 // GetIdentity retrieves an identity by ID
 func (s *PersonaServer) GetIdentity(ctx context.Context, req *pb.GetIdentityRequest) (*pb.GetIdentityResponse, error) {
 	if req.Id == "" {
@@ -226,7 +424,7 @@ func (s *PersonaServer) GetIdentity(ctx context.Context, req *pb.GetIdentityRequ
 
 	identity, err := s.service.GetIdentity(req.Id)
 	if err != nil {
-		return nil, status.Errorf(codes.NotFound, "identity not found: %v", err)
+		return nil, status.Errorf(errorCode(err), "identity not found: %v", err)
 	}
 
 	return &pb.GetIdentityResponse{
@@ -234,26 +432,38 @@ func (s *PersonaServer) GetIdentity(ctx context.Context, req *pb.GetIdentityRequ
 	}, nil
 }
 
-// ListIdentities returns identities with optional filtering
-func (s *PersonaServer) ListIdentities(ctx context.Context, req *pb.ListIdentitiesRequest) (*pb.ListIdentitiesResponse, error) {
+// GetIdentityWithPersona retrieves an identity together with its persona
+func (s *PersonaServer) GetIdentityWithPersona(ctx context.Context, req *pb.GetIdentityWithPersonaRequest) (*pb.GetIdentityWithPersonaResponse, error) {
+	if req.Id == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "identity ID is required")
+	}
+
 	if s.service == nil {
 		return nil, status.Errorf(codes.Internal, "persona service not available")
 	}
 
-	var filter *types.IdentityFilter
-	if req.Filter != nil {
-		filter = &types.IdentityFilter{
-			PersonaID: req.Filter.PersonaId,
-			Tags:      req.Filter.Tags,
-			Search:    req.Filter.Search,
-		}
-		isActive := req.Filter.IsActive
-		filter.IsActive = &isActive
+	result, err := s.service.GetIdentityWithPersona(req.Id)
+	if err != nil {
+		return nil, status.Errorf(errorCode(err), "failed to get identity with persona: %v", err)
 	}
 
-	identities, err := s.service.ListIdentities(filter)
+	return &pb.GetIdentityWithPersonaResponse{
+		IdentityWithPersona: &pb.IdentityWithPersona{
+			Identity: types.IdentityToProto(&result.Identity),
+			Persona:  types.PersonaToProto(&result.Persona),
+		},
+	}, nil
+}
+
+// ListIdentities returns identities with optional filtering
+func (s *PersonaServer) ListIdentities(ctx context.Context, req *pb.ListIdentitiesRequest) (*pb.ListIdentitiesResponse, error) {
+	if s.service == nil {
+		return nil, status.Errorf(codes.Internal, "persona service not available")
+	}
+
+	identities, err := s.service.ListIdentities(types.ProtoToIdentityFilter(req.Filter))
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to list identities: %v", err)
+		return nil, status.Errorf(errorCode(err), "failed to list identities: %v", err)
 	}
 
 	var pbIdentities []*pb.Identity
@@ -285,7 +495,7 @@ func (s *PersonaServer) UpdateIdentity(ctx context.Context, req *pb.UpdateIdenti
 
 	err := s.service.UpdateIdentity(req.Id, *identity)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "failed to update identity: %v", err)
+		return nil, status.Errorf(errorCode(err), "failed to update identity: %v", err)
 	}
 
 	return &pb.UpdateIdentityResponse{
@@ -305,9 +515,110 @@ func (s *PersonaServer) DeleteIdentity(ctx context.Context, req *pb.DeleteIdenti
 
 	err := s.service.DeleteIdentity(req.Id)
 	if err != nil {
-		return nil, status.Errorf(codes.NotFound, "failed to delete identity: %v", err)
+		return nil, status.Errorf(errorCode(err), "failed to delete identity: %v", err)
 	}
 
 	return &pb.DeleteIdentityResponse{}, nil
 }
 
+// BatchMutate applies a list of persona and identity mutations in order,
+// reporting a result per operation. A failed operation does not fail the
+// call: the applied operations are undone where possible and the response
+// says which, as described for persona.Service.ApplyBatch.
+func (s *PersonaServer) BatchMutate(ctx context.Context, req *pb.BatchMutateRequest) (*pb.BatchMutateResponse, error) {
+	if len(req.Operations) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "at least one operation is required")
+	}
+
+	if s.service == nil {
+		return nil, status.Errorf(codes.Internal, "persona service not available")
+	}
+
+	ops := make([]types.BatchOperation, len(req.Operations))
+	for i, op := range req.Operations {
+		converted, err := protoToBatchOperation(op)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "operation %d: %v", i, err)
+		}
+		ops[i] = converted
+	}
+
+	results, applied := s.service.ApplyBatch(ops)
+
+	resp := &pb.BatchMutateResponse{
+		Results: make([]*pb.BatchOperationResult, len(results)),
+		Applied: applied,
+	}
+	for i, result := range results {
+		resp.Results[i] = &pb.BatchOperationResult{
+			Index:      int32(result.Index),
+			Id:         result.Id,
+			Error:      result.Error,
+			RolledBack: result.RolledBack,
+			Skipped:    result.Skipped,
+		}
+	}
+	return resp, nil
+}
+
+// protoToBatchOperation converts a tagged batch operation, checking that it
+// carries what its kind needs
+func protoToBatchOperation(op *pb.BatchOperation) (types.BatchOperation, error) {
+	switch o := op.GetOp().(type) {
+	case *pb.BatchOperation_CreatePersona:
+		if o.CreatePersona.GetPersona() == nil {
+			return types.BatchOperation{}, fmt.Errorf("persona is required")
+		}
+		return types.BatchOperation{Kind: types.BatchCreatePersona, Persona: types.ProtoToPersona(o.CreatePersona.Persona)}, nil
+	case *pb.BatchOperation_UpdatePersona:
+		if o.UpdatePersona.GetId() == "" || o.UpdatePersona.GetPersona() == nil {
+			return types.BatchOperation{}, fmt.Errorf("persona ID and persona are required")
+		}
+		p := types.ProtoToPersona(o.UpdatePersona.Persona)
+		p.Id = o.UpdatePersona.Id
+		return types.BatchOperation{Kind: types.BatchUpdatePersona, Id: p.Id, Persona: p}, nil
+	case *pb.BatchOperation_DeletePersona:
+		if o.DeletePersona.GetId() == "" {
+			return types.BatchOperation{}, fmt.Errorf("persona ID is required")
+		}
+		return types.BatchOperation{Kind: types.BatchDeletePersona, Id: o.DeletePersona.Id}, nil
+	case *pb.BatchOperation_CreateIdentity:
+		if o.CreateIdentity.GetIdentity() == nil {
+			return types.BatchOperation{}, fmt.Errorf("identity is required")
+		}
+		return types.BatchOperation{Kind: types.BatchCreateIdentity, Identity: types.ProtoToIdentity(o.CreateIdentity.Identity)}, nil
+	case *pb.BatchOperation_UpdateIdentity:
+		if o.UpdateIdentity.GetId() == "" || o.UpdateIdentity.GetIdentity() == nil {
+			return types.BatchOperation{}, fmt.Errorf("identity ID and identity are required")
+		}
+		i := types.ProtoToIdentity(o.UpdateIdentity.Identity)
+		i.Id = o.UpdateIdentity.Id
+		return types.BatchOperation{Kind: types.BatchUpdateIdentity, Id: i.Id, Identity: i}, nil
+	case *pb.BatchOperation_DeleteIdentity:
+		if o.DeleteIdentity.GetId() == "" {
+			return types.BatchOperation{}, fmt.Errorf("identity ID is required")
+		}
+		return types.BatchOperation{Kind: types.BatchDeleteIdentity, Id: o.DeleteIdentity.Id}, nil
+	}
+	return types.BatchOperation{}, fmt.Errorf("operation type is required")
+}
+
+// GetCommunityStats returns analytics for a community
+func (s *PersonaServer) GetCommunityStats(ctx context.Context, req *pb.GetCommunityStatsRequest) (*pb.GetCommunityStatsResponse, error) {
+	if req.Id == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "community ID is required")
+	}
+
+	if s.communityService == nil {
+		return nil, status.Errorf(codes.Internal, "community service not available")
+	}
+
+	stats, err := s.communityService.GetCommunityStats(req.Id)
+	if err != nil {
+		return nil, status.Errorf(errorCode(err), "community not found: %v", err)
+	}
+
+	return &pb.GetCommunityStatsResponse{
+		Stats: types.CommunityStatsToProto(stats),
+	}, nil
+}
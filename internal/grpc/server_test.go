@@ -3,6 +3,7 @@ package grpc
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"testing"
 	"time"
@@ -10,9 +11,11 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/config"
 	pb "github.com/fr0g-vibe/fr0g-ai-aip/internal/grpc/pb"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/persona"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
@@ -61,6 +64,76 @@ func setupTestServer(t *testing.T) (pb.PersonaServiceClient, func()) {
 	return pb.NewPersonaServiceClient(conn), cleanup
 }
 
+func TestNewGRPCServer_Reflection(t *testing.T) {
+	const reflectionService = "grpc.reflection.v1.ServerReflection"
+	service := persona.NewService(storage.NewMemoryStorage())
+	
+	for _, enabled := range []bool{false, true} {
+		cfg := &config.Config{
+			GRPC: config.GRPCConfig{
+				MaxRecvMsgSize:   4 * 1024 * 1024,
+				MaxSendMsgSize:   4 * 1024 * 1024,
+				EnableReflection: enabled,
+			},
+		}
+		
+		server, _, err := newGRPCServer(cfg, service)
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+		info := server.GetServiceInfo()
+		if _, ok := info["persona.PersonaService"]; !ok {
+			t.Errorf("enabled=%v: expected persona service to be registered, got %v", enabled, info)
+		}
+		if _, ok := info[reflectionService]; ok != enabled {
+			t.Errorf("enabled=%v: reflection registered = %v", enabled, ok)
+		}
+	}
+}
+
+func TestNewGRPCServer_HealthCheck(t *testing.T) {
+	cfg := &config.Config{GRPC: config.GRPCConfig{MaxRecvMsgSize: 4 * 1024 * 1024, MaxSendMsgSize: 4 * 1024 * 1024}}
+	s, healthServer, err := newGRPCServer(cfg, persona.NewService(storage.NewMemoryStorage()))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	
+	lis := bufconn.Listen(bufSize)
+	go s.Serve(lis)
+	defer s.Stop()
+	
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	
+	check := func(service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		return resp.GetStatus(), err
+	}
+	
+	for _, service := range []string{"", "persona.PersonaService"} {
+		if got, err := check(service); err != nil || got != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("service %q: expected SERVING, got %v (%v)", service, got, err)
+		}
+	}
+	if _, err := check("unknown.Service"); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for an unknown service, got %v", err)
+	}
+	
+	// Shutting down flips every service to NOT_SERVING
+	healthServer.Shutdown()
+	for _, service := range []string{"", "persona.PersonaService"} {
+		if got, err := check(service); err != nil || got != healthpb.HealthCheckResponse_NOT_SERVING {
+			t.Errorf("service %q: expected NOT_SERVING after shutdown, got %v (%v)", service, got, err)
+		}
+	}
+}
+
 func TestPersonaServer_CreatePersona(t *testing.T) {
 	client, cleanup := setupTestServer(t)
 	defer cleanup()
@@ -376,9 +449,8 @@ func TestPersonaServer_UpdatePersona_NotFound(t *testing.T) {
 	if !ok {
 		t.Error("Expected gRPC status error")
 	}
-	// The actual server returns InvalidArgument for validation errors, not NotFound
-	if st.Code() != codes.InvalidArgument {
-		t.Errorf("Expected InvalidArgument, got %v", st.Code())
+	if st.Code() != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", st.Code())
 	}
 }
 
@@ -674,6 +746,47 @@ func TestPersonaServer_ComplexPersonaOperations(t *testing.T) {
 	}
 }
 
+func TestPersonaServer_StreamPersonas(t *testing.T) {
+	client, cleanup := setupTestServer(t)
+	defer cleanup()
+	
+	const count = 25
+	for i := 0; i < count; i++ {
+		req := &pb.CreatePersonaRequest{Persona: &pb.Persona{
+			Name:   fmt.Sprintf("Persona %d", i),
+			Topic:  "Streaming",
+			Prompt: "Stream prompt",
+		}}
+		if _, err := client.CreatePersona(context.Background(), req); err != nil {
+			t.Fatalf("CreatePersona failed: %v", err)
+		}
+	}
+	
+	stream, err := client.StreamPersonas(context.Background(), &pb.StreamPersonasRequest{})
+	if err != nil {
+		t.Fatalf("StreamPersonas failed: %v", err)
+	}
+	
+	seen := make(map[string]bool)
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if p.Id == "" || p.Topic != "Streaming" {
+			t.Errorf("Unexpected streamed persona: %+v", p)
+		}
+		seen[p.Id] = true
+	}
+	
+	if len(seen) != count {
+		t.Errorf("Expected %d streamed personas, got %d", count, len(seen))
+	}
+}
+
 func TestPersonaServer_EmptyListPersonas(t *testing.T) {
 	client, cleanup := setupTestServer(t)
 	defer cleanup()
@@ -1490,7 +1603,115 @@ func TestStartGRPCServer(t *testing.T) {
 	// Clean up
 	conn.Close()
 	
-	// Note: We can't easily test server shutdown without modifying the StartGRPCServer function
-	// to accept a context or shutdown channel, but we've covered the startup path which was
-	// the missing coverage.
+	// Shutdown is covered by TestStartGRPCServerContext
+}
+
+func TestStartGRPCServerContext(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	
+	cfg := &config.Config{GRPC: config.GRPCConfig{
+		Port:           fmt.Sprintf("%d", port),
+		MaxRecvMsgSize: 4 * 1024 * 1024,
+		MaxSendMsgSize: 4 * 1024 * 1024,
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	
+	done := make(chan error, 1)
+	go func() {
+		done <- StartGRPCServerContext(ctx, cfg, persona.NewService(storage.NewMemoryStorage()))
+	}()
+	time.Sleep(100 * time.Millisecond)
+	
+	conn, err := grpc.Dial(fmt.Sprintf("localhost:%d", port),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("Failed to connect to gRPC server: %v", err)
+	}
+	defer conn.Close()
+	
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Expected SERVING, got %v (%v)", resp.GetStatus(), err)
+	}
+	
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected a clean stop, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop after the context was cancelled")
+	}
+}
+
+func TestGRPCServer_Shutdown(t *testing.T) {
+	cfg := &config.Config{GRPC: config.GRPCConfig{
+		Port:           "0",
+		MaxRecvMsgSize: 4 * 1024 * 1024,
+		MaxSendMsgSize: 4 * 1024 * 1024,
+	}}
+	s, err := NewGRPCServer(cfg, persona.NewService(storage.NewMemoryStorage()))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	gracefulStops := 0
+	drain := s.gracefulStop
+	s.gracefulStop = func() {
+		gracefulStops++
+		drain()
+	}
+	
+	done := make(chan error, 1)
+	go func() { done <- s.Start() }()
+	time.Sleep(100 * time.Millisecond)
+	
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Expected a clean shutdown, got %v", err)
+	}
+	if gracefulStops != 1 {
+		t.Errorf("Expected GracefulStop to be called once, got %d", gracefulStops)
+	}
+	
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected Start to return nil after shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after shutdown")
+	}
+	
+	resp, err := s.health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected NOT_SERVING after shutdown, got %v (%v)", resp.GetStatus(), err)
+	}
+}
+
+func TestGRPCServer_ShutdownTimeout(t *testing.T) {
+	cfg := &config.Config{GRPC: config.GRPCConfig{MaxRecvMsgSize: 4 * 1024 * 1024, MaxSendMsgSize: 4 * 1024 * 1024}}
+	s, err := NewGRPCServer(cfg, persona.NewService(storage.NewMemoryStorage()))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	
+	// A drain that outlives the shutdown context
+	release := make(chan struct{})
+	s.gracefulStop = func() { <-release }
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Shutdown(ctx); err != context.Canceled {
+		t.Errorf("Expected context.Canceled when the drain outlives ctx, got %v", err)
+	}
 }
@@ -0,0 +1,251 @@
+package grpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/client"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/config"
+	pb "github.com/fr0g-vibe/fr0g-ai-aip/internal/grpc/pb"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/persona"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// testCerts holds the PEM files written by writeTestCerts
+type testCerts struct {
+	caFile, serverCert, serverKey, clientCert, clientKey string
+}
+
+// writeTestCerts creates a self-signed CA and a server and client
+// certificate signed by it. The server certificate is valid for localhost
+// and 127.0.0.1.
+func writeTestCerts(t *testing.T) testCerts {
+	t.Helper()
+	dir := t.TempDir()
+
+	write := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		return key
+	}
+	template := func(serial int64, name string) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+	}
+
+	caKey := newKey()
+	ca := template(1, "fr0g test CA")
+	ca.IsCA = true
+	ca.BasicConstraintsValid = true
+	ca.KeyUsage = x509.KeyUsageCertSign
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	ca, err = x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("Failed to parse CA certificate: %v", err)
+	}
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage, certFile, keyFile string) (string, string) {
+		key := newKey()
+		cert := template(serial, name)
+		cert.KeyUsage = x509.KeyUsageDigitalSignature
+		cert.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		if usage == x509.ExtKeyUsageServerAuth {
+			cert.DNSNames = []string{"localhost"}
+			cert.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		}
+		der, err := x509.CreateCertificate(rand.Reader, cert, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("Failed to create %s certificate: %v", name, err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatalf("Failed to marshal %s key: %v", name, err)
+		}
+		return write(certFile, "CERTIFICATE", der), write(keyFile, "EC PRIVATE KEY", keyDER)
+	}
+
+	certs := testCerts{caFile: write("ca.pem", "CERTIFICATE", caDER)}
+	certs.serverCert, certs.serverKey = issue(2, "localhost", x509.ExtKeyUsageServerAuth, "server.pem", "server-key.pem")
+	certs.clientCert, certs.clientKey = issue(3, "fr0g test client", x509.ExtKeyUsageClientAuth, "client.pem", "client-key.pem")
+	return certs
+}
+
+// startTLSTestServer serves newGRPCServer with TLS enabled over bufconn
+func startTLSTestServer(t *testing.T, certs testCerts, clientCAFile string) *bufconn.Listener {
+	t.Helper()
+	cfg := &config.Config{GRPC: config.GRPCConfig{
+		MaxRecvMsgSize: 4 * 1024 * 1024,
+		MaxSendMsgSize: 4 * 1024 * 1024,
+		EnableTLS:      true,
+		CertFile:       certs.serverCert,
+		KeyFile:        certs.serverKey,
+		ClientCAFile:   clientCAFile,
+	}}
+	s, _, err := newGRPCServer(cfg, persona.NewService(storage.NewMemoryStorage()))
+	if err != nil {
+		t.Fatalf("Failed to create TLS server: %v", err)
+	}
+
+	lis := bufconn.Listen(bufSize)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis
+}
+
+// createOverBufconn dials lis with creds and creates a persona
+func createOverBufconn(t *testing.T, lis *bufconn.Listener, creds credentials.TransportCredentials) (*pb.Persona, error) {
+	t.Helper()
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := pb.NewPersonaServiceClient(conn).CreatePersona(ctx, &pb.CreatePersonaRequest{
+		Persona: &pb.Persona{Name: "Secure Expert", Topic: "TLS", Prompt: "You keep secrets."},
+	})
+	return resp.GetPersona(), err
+}
+
+func TestNewGRPCServer_TLS(t *testing.T) {
+	certs := writeTestCerts(t)
+	lis := startTLSTestServer(t, certs, "")
+
+	roots, err := loadCertPool(certs.caFile)
+	if err != nil {
+		t.Fatalf("Failed to load CA: %v", err)
+	}
+	created, err := createOverBufconn(t, lis, credentials.NewTLS(&tls.Config{RootCAs: roots, ServerName: "localhost"}))
+	if err != nil {
+		t.Fatalf("CreatePersona over TLS failed: %v", err)
+	}
+	if created.GetId() == "" || created.GetName() != "Secure Expert" {
+		t.Errorf("Unexpected persona from TLS round trip: %+v", created)
+	}
+
+	// A plaintext client cannot talk to a TLS server
+	if _, err := createOverBufconn(t, lis, insecure.NewCredentials()); err == nil {
+		t.Error("Expected a plaintext client to fail against a TLS server")
+	}
+
+	// Nor can a client that does not trust the server's CA
+	if _, err := createOverBufconn(t, lis, credentials.NewTLS(&tls.Config{ServerName: "localhost"})); err == nil {
+		t.Error("Expected a client without the CA to reject the server certificate")
+	}
+}
+
+func TestNewGRPCServer_MutualTLS(t *testing.T) {
+	certs := writeTestCerts(t)
+	lis := startTLSTestServer(t, certs, certs.caFile)
+
+	roots, err := loadCertPool(certs.caFile)
+	if err != nil {
+		t.Fatalf("Failed to load CA: %v", err)
+	}
+	if _, err := createOverBufconn(t, lis, credentials.NewTLS(&tls.Config{RootCAs: roots, ServerName: "localhost"})); err == nil {
+		t.Error("Expected a client without a certificate to be rejected")
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(certs.clientCert, certs.clientKey)
+	if err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	creds := credentials.NewTLS(&tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: []tls.Certificate{clientCert}})
+	if _, err := createOverBufconn(t, lis, creds); err != nil {
+		t.Fatalf("CreatePersona with a client certificate failed: %v", err)
+	}
+}
+
+func TestNewGRPCClientTLS(t *testing.T) {
+	certs := writeTestCerts(t)
+	cfg := &config.Config{GRPC: config.GRPCConfig{
+		MaxRecvMsgSize: 4 * 1024 * 1024,
+		MaxSendMsgSize: 4 * 1024 * 1024,
+		EnableTLS:      true,
+		CertFile:       certs.serverCert,
+		KeyFile:        certs.serverKey,
+		ClientCAFile:   certs.caFile,
+	}}
+	s, _, err := newGRPCServer(cfg, persona.NewService(storage.NewMemoryStorage()))
+	if err != nil {
+		t.Fatalf("Failed to create TLS server: %v", err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go s.Serve(lis)
+	defer s.Stop()
+
+	c, err := client.NewGRPCClientTLS(lis.Addr().String(), client.TLSOptions{
+		CAFile:   certs.caFile,
+		CertFile: certs.clientCert,
+		KeyFile:  certs.clientKey,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create TLS client: %v", err)
+	}
+	defer c.Close()
+
+	p := &types.Persona{Name: "Secure Expert", Topic: "TLS", Prompt: "You keep secrets."}
+	if err := c.Create(p); err != nil {
+		t.Fatalf("Create over mutual TLS failed: %v", err)
+	}
+	if _, err := c.Get(p.Id); err != nil {
+		t.Errorf("Get over mutual TLS failed: %v", err)
+	}
+
+	if _, err := client.NewGRPCClientTLS(lis.Addr().String(), client.TLSOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("Expected error for a missing CA file")
+	}
+}
+
+func TestNewGRPCServer_TLSMissingCertificate(t *testing.T) {
+	cfg := &config.Config{GRPC: config.GRPCConfig{
+		EnableTLS: true,
+		CertFile:  filepath.Join(t.TempDir(), "missing.pem"),
+		KeyFile:   filepath.Join(t.TempDir(), "missing-key.pem"),
+	}}
+	if _, _, err := newGRPCServer(cfg, persona.NewService(storage.NewMemoryStorage())); err == nil {
+		t.Error("Expected error when the TLS certificate cannot be loaded")
+	}
+}
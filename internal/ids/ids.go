@@ -0,0 +1,20 @@
+// Package ids generates the random identifiers used for stored records and
+// requests.
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// byteLength is the number of random bytes in an ID. 64 bits keeps IDs short
+// while making a collision among millions of records vanishingly unlikely.
+const byteLength = 8
+
+// New returns a random 16-character hex ID read from crypto/rand. Unlike
+// timestamp-based IDs it stays unique when called in a tight loop.
+func New() string {
+	b := make([]byte, byteLength)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,28 @@
+package ids
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestNew_Format(t *testing.T) {
+	id := New()
+	if len(id) != 2*byteLength {
+		t.Errorf("Expected %d characters, got %q", 2*byteLength, id)
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		t.Errorf("Expected a hex ID, got %q", id)
+	}
+}
+
+func TestNew_NoDuplicates(t *testing.T) {
+	const count = 100000
+	seen := make(map[string]struct{}, count)
+	for i := 0; i < count; i++ {
+		id := New()
+		if _, dup := seen[id]; dup {
+			t.Fatalf("Duplicate ID %s after %d IDs", id, i)
+		}
+		seen[id] = struct{}{}
+	}
+}
@@ -0,0 +1,183 @@
+// Package metrics collects request and storage metrics and exposes them in
+// the Prometheus text exposition format.
+//
+// The API server records through the Recorder interface, so tests can use
+// Nop or a fake instead of a live Registry.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric names exported by the API server
+const (
+	RequestsTotal     = "fr0g_aip_http_requests_total"
+	RequestDuration   = "fr0g_aip_http_request_duration_seconds"
+	PersonasStored    = "fr0g_aip_personas"
+	IdentitiesStored  = "fr0g_aip_identities"
+	CommunitiesStored = "fr0g_aip_communities"
+)
+
+// DefaultBuckets are the latency histogram bucket upper bounds in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Recorder records metrics
+type Recorder interface {
+	// ObserveRequest counts a request by handler and status code and records
+	// its latency
+	ObserveRequest(handler string, status int, duration time.Duration)
+
+	// SetGauge sets the current value of a gauge
+	SetGauge(name string, value float64)
+}
+
+// Nop is a Recorder that discards everything
+type Nop struct{}
+
+func (Nop) ObserveRequest(string, int, time.Duration) {}
+func (Nop) SetGauge(string, float64)                  {}
+
+type requestKey struct {
+	handler string
+	status  int
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Registry is an in-process Recorder that serves its metrics over HTTP
+type Registry struct {
+	mu        sync.Mutex
+	buckets   []float64
+	requests  map[requestKey]uint64
+	latencies map[string]*histogram
+	gauges    map[string]float64
+	gaugeHelp map[string]string
+}
+
+// NewRegistry creates an empty registry using DefaultBuckets
+func NewRegistry() *Registry {
+	return &Registry{
+		buckets:   DefaultBuckets,
+		requests:  make(map[requestKey]uint64),
+		latencies: make(map[string]*histogram),
+		gauges:    make(map[string]float64),
+		gaugeHelp: map[string]string{
+			PersonasStored:    "Number of personas in storage.",
+			IdentitiesStored:  "Number of identities in storage.",
+			CommunitiesStored: "Number of communities in storage.",
+		},
+	}
+}
+
+// ObserveRequest implements Recorder
+func (r *Registry) ObserveRequest(handler string, status int, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests[requestKey{handler, status}]++
+
+	h := r.latencies[handler]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(r.buckets))}
+		r.latencies[handler] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range r.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// SetGauge implements Recorder
+func (r *Registry) SetGauge(name string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges[name] = value
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# HELP %s Total HTTP requests by handler and status code.\n", RequestsTotal)
+	fmt.Fprintf(&b, "# TYPE %s counter\n", RequestsTotal)
+	keys := make([]requestKey, 0, len(r.requests))
+	for key := range r.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].handler != keys[j].handler {
+			return keys[i].handler < keys[j].handler
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s{handler=%q,code=\"%d\"} %d\n", RequestsTotal, key.handler, key.status, r.requests[key])
+	}
+
+	fmt.Fprintf(&b, "# HELP %s HTTP request latency by handler.\n", RequestDuration)
+	fmt.Fprintf(&b, "# TYPE %s histogram\n", RequestDuration)
+	for _, handler := range sortedKeys(r.latencies) {
+		h := r.latencies[handler]
+		var cumulative uint64
+		for i, bound := range r.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "%s_bucket{handler=%q,le=%q} %d\n", RequestDuration, handler, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(&b, "%s_bucket{handler=%q,le=\"+Inf\"} %d\n", RequestDuration, handler, h.count)
+		fmt.Fprintf(&b, "%s_sum{handler=%q} %s\n", RequestDuration, handler, formatFloat(h.sum))
+		fmt.Fprintf(&b, "%s_count{handler=%q} %d\n", RequestDuration, handler, h.count)
+	}
+
+	for _, name := range sortedKeys(r.gauges) {
+		if help := r.gaugeHelp[name]; help != "" {
+			fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		}
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(&b, "%s %s\n", name, formatFloat(r.gauges[name]))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP serves the metrics to a Prometheus scraper
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
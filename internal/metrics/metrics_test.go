@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	r.ObserveRequest("/personas", 200, 3*time.Millisecond)
+	r.ObserveRequest("/personas", 200, 200*time.Millisecond)
+	r.ObserveRequest("/personas", 404, time.Millisecond)
+	r.SetGauge(PersonasStored, 7)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE fr0g_aip_http_requests_total counter\n",
+		`fr0g_aip_http_requests_total{handler="/personas",code="200"} 2` + "\n",
+		`fr0g_aip_http_requests_total{handler="/personas",code="404"} 1` + "\n",
+		"# TYPE fr0g_aip_http_request_duration_seconds histogram\n",
+		`fr0g_aip_http_request_duration_seconds_bucket{handler="/personas",le="0.005"} 2` + "\n",
+		`fr0g_aip_http_request_duration_seconds_bucket{handler="/personas",le="0.1"} 2` + "\n",
+		`fr0g_aip_http_request_duration_seconds_bucket{handler="/personas",le="0.25"} 3` + "\n",
+		`fr0g_aip_http_request_duration_seconds_bucket{handler="/personas",le="+Inf"} 3` + "\n",
+		`fr0g_aip_http_request_duration_seconds_count{handler="/personas"} 3` + "\n",
+		"# TYPE fr0g_aip_personas gauge\nfr0g_aip_personas 7\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.SetGauge(IdentitiesStored, 3)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := rr.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("Expected text/plain content type, got %s", contentType)
+	}
+	if !strings.Contains(rr.Body.String(), "fr0g_aip_identities 3\n") {
+		t.Errorf("Expected identities gauge, got:\n%s", rr.Body.String())
+	}
+}
@@ -2,13 +2,32 @@ package middleware
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/config"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/ids"
 )
 
-// AuthMiddleware provides API key authentication
+// AuthMiddleware provides API key authentication with a single key that
+// may make any request
 func AuthMiddleware(apiKey string) func(http.Handler) http.Handler {
+	return ScopedAuthMiddleware(map[string]string{apiKey: config.ScopeWrite})
+}
+
+// ScopedAuthMiddleware provides API key authentication with several keys,
+// mapped to their scopes as returned by config.SecurityConfig.KeyScopes.
+// Keys with read scope get 403 Forbidden for requests other than GET, HEAD
+// and OPTIONS. The scope of the key used, and a caller ID derived from it,
+// are stored in the request context.
+func ScopedAuthMiddleware(keys map[string]string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Skip auth for health check
@@ -33,72 +52,201 @@ func AuthMiddleware(apiKey string) func(http.Handler) http.Handler {
 				return
 			}
 			
-			if providedKey != apiKey {
+			scope, ok := keys[providedKey]
+			if !ok {
 				http.Error(w, "Invalid API key", http.StatusUnauthorized)
 				return
 			}
 			
-			// Add user context
-			ctx := context.WithValue(r.Context(), "authenticated", true)
+			if !ScopeAllows(scope, r.Method) {
+				http.Error(w, "API key does not allow "+r.Method+" requests", http.StatusForbidden)
+				return
+			}
+			
+			ctx := context.WithValue(r.Context(), scopeKey, scope)
+			ctx = context.WithValue(ctx, callerKey, keyCaller(providedKey))
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// CORSMiddleware handles CORS headers
-func CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
-		w.Header().Set("Access-Control-Max-Age", "86400")
-		
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// ScopeAllows reports whether a key with scope may make a request with
+// method
+func ScopeAllows(scope, method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return scope == config.ScopeRead || scope == config.ScopeWrite
+	default:
+		return scope == config.ScopeWrite
+	}
+}
+
+// ScopeFromContext returns the scope of the API key that authenticated a
+// request, or "" when authentication is disabled
+func ScopeFromContext(ctx context.Context) string {
+	scope, _ := ctx.Value(scopeKey).(string)
+	return scope
+}
+
+// CallerFromContext returns an ID for the API key that authenticated a
+// request, or "" when authentication is disabled. The ID is a hash, so it
+// can be stored or logged without revealing the key.
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey).(string)
+	return caller
+}
+
+// keyCaller derives a caller ID from an API key
+func keyCaller(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return "key-" + hex.EncodeToString(sum[:8])
+}
+
+// CORS returns middleware that sets CORS headers as cfg allows. A request
+// from an origin that is not allowed gets no CORS headers, so browsers
+// block it. Preflight OPTIONS requests are answered directly. When CORS is
+// disabled the handler is returned unchanged.
+func CORS(cfg config.CORSConfig) func(http.Handler) http.Handler {
+	allowAny := false
+	allowed := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			allowAny = true
 		}
-		
-		next.ServeHTTP(w, r)
-	})
+		allowed[strings.ToLower(origin)] = true
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	
+	return func(next http.Handler) http.Handler {
+		if !cfg.Enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			allowOrigin := ""
+			switch {
+			case allowAny:
+				allowOrigin = "*"
+			case origin != "" && allowed[strings.ToLower(origin)]:
+				allowOrigin = origin
+			}
+			if !allowAny {
+				// The response depends on the origin, so caches must too
+				w.Header().Add("Vary", "Origin")
+			}
+			
+			if allowOrigin != "" {
+				w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+				w.Header().Set("Access-Control-Expose-Headers", "ETag")
+				w.Header().Set("Access-Control-Max-Age", "86400")
+				if cfg.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+			
+			// Handle preflight requests
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestIDHeader carries the request ID on requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey string
+
+const (
+	requestIDKey contextKey = "request_id"
+	scopeKey     contextKey = "scope"
+	callerKey    contextKey = "caller"
+)
+
+// RequestIDFromContext returns the ID assigned to a request by
+// LoggingMiddleware, or "" if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
 }
 
-// LoggingMiddleware logs HTTP requests
+// LoggingMiddleware logs each HTTP request as a JSON line on stderr
 func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Create a response writer wrapper to capture status code
-		wrapper := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
-		
-		// Log request
-		logRequest(r)
-		
-		// Process request
-		next.ServeHTTP(wrapper, r)
-		
-		// Log response
-		logResponse(r, wrapper.statusCode)
-	})
+	return RequestLogger(os.Stderr)(next)
+}
+
+// RequestLogger logs each request as a single JSON line to out. Every request
+// gets an ID, taken from an incoming X-Request-ID header when present, which
+// is returned in the X-Request-ID response header and stored in the request
+// context.
+func RequestLogger(out io.Writer) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	encoder := json.NewEncoder(out)
+	
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			
+			requestID := r.Header.Get(RequestIDHeader)
+			if requestID == "" || len(requestID) > 128 {
+				requestID = ids.New()
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+			
+			// Create a response writer wrapper to capture status code
+			wrapper := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			ctx := context.WithValue(r.Context(), requestIDKey, requestID)
+			
+			next.ServeHTTP(wrapper, r.WithContext(ctx))
+			
+			entry := requestLogEntry{
+				Time:      start.UTC().Format(time.RFC3339Nano),
+				RequestID: requestID,
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Status:    wrapper.statusCode,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			
+			mu.Lock()
+			encoder.Encode(entry)
+			mu.Unlock()
+		})
+	}
+}
+
+type requestLogEntry struct {
+	Time      string  `json:"time"`
+	RequestID string  `json:"request_id"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
 }
 
 type responseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode  int
+	wroteHeader bool
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
+	if !rw.wroteHeader {
+		rw.statusCode = code
+		rw.wroteHeader = true
+	}
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-func logRequest(r *http.Request) {
-	// In a real implementation, use a proper logger
-	// log.Printf("Request: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-}
-
-func logResponse(r *http.Request, statusCode int) {
-	// In a real implementation, use a proper logger
-	// log.Printf("Response: %s %s -> %d", r.Method, r.URL.Path, statusCode)
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
 }
 
 // RateLimitMiddleware provides basic rate limiting
@@ -152,24 +300,6 @@ func getClientIP(r *http.Request) string {
 	return strings.Split(r.RemoteAddr, ":")[0]
 }
 
-// CompressionMiddleware adds gzip compression
-func CompressionMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check if client accepts gzip
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-			next.ServeHTTP(w, r)
-			return
-		}
-		
-		// Set compression header
-		w.Header().Set("Content-Encoding", "gzip")
-		w.Header().Set("Vary", "Accept-Encoding")
-		
-		// In a real implementation, wrap the response writer with gzip
-		next.ServeHTTP(w, r)
-	})
-}
-
 // SecurityHeadersMiddleware adds security headers
 func SecurityHeadersMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/config"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var out bytes.Buffer
+	var seenID string
+	handler := RequestLogger(&out)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenID = RequestIDFromContext(r.Context())
+		http.Error(w, "Not found", http.StatusNotFound)
+	}))
+	
+	req := httptest.NewRequest("GET", "/personas/missing", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	
+	requestID := rr.Header().Get(RequestIDHeader)
+	if requestID == "" {
+		t.Fatal("Expected X-Request-ID response header")
+	}
+	if seenID != requestID {
+		t.Errorf("Expected handler to see request ID %q, got %q", requestID, seenID)
+	}
+	
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON log line, got %q: %v", out.String(), err)
+	}
+	if strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("Expected exactly one log line, got %q", out.String())
+	}
+	if entry["request_id"] != requestID || entry["method"] != "GET" || entry["path"] != "/personas/missing" {
+		t.Errorf("Unexpected log entry: %v", entry)
+	}
+	if entry["status"] != float64(http.StatusNotFound) {
+		t.Errorf("Expected status 404 in log entry, got %v", entry["status"])
+	}
+	if _, ok := entry["latency_ms"].(float64); !ok {
+		t.Errorf("Expected numeric latency_ms, got %v", entry["latency_ms"])
+	}
+}
+
+func TestRequestLogger_PropagatesRequestID(t *testing.T) {
+	var out bytes.Buffer
+	handler := RequestLogger(&out)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	
+	req := httptest.NewRequest("GET", "/health", nil)
+	req.Header.Set(RequestIDHeader, "upstream-123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	
+	if got := rr.Header().Get(RequestIDHeader); got != "upstream-123" {
+		t.Errorf("Expected incoming request ID to be reused, got %q", got)
+	}
+	if !strings.Contains(out.String(), `"status":200`) {
+		t.Errorf("Expected implicit 200 status in log, got %q", out.String())
+	}
+}
+
+// corsRequest sends a request with the given Origin through CORS(cfg)
+func corsRequest(cfg config.CORSConfig, method, origin string) (*httptest.ResponseRecorder, bool) {
+	reached := false
+	handler := CORS(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	req := httptest.NewRequest(method, "/personas", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr, reached
+}
+
+func TestCORS_DefaultAllowsAnyOrigin(t *testing.T) {
+	rr, reached := corsRequest(config.DefaultConfig().Security.CORS, "GET", "https://anywhere.example")
+	if !reached {
+		t.Error("Expected the request to reach the handler")
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected Access-Control-Allow-Origin *, got %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, "PATCH") {
+		t.Errorf("Expected default methods, got %q", got)
+	}
+}
+
+func TestCORS_AllowedOrigins(t *testing.T) {
+	cfg := config.CORSConfig{
+		Enabled:          true,
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type"},
+		AllowCredentials: true,
+	}
+	
+	rr, _ := corsRequest(cfg, "GET", "https://APP.example.com")
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://APP.example.com" {
+		t.Errorf("Expected the allowed origin to be echoed, got %q", got)
+	}
+	if rr.Header().Get("Access-Control-Allow-Credentials") != "true" || rr.Header().Get("Access-Control-Allow-Methods") != "GET, POST" {
+		t.Errorf("Unexpected CORS headers: %v", rr.Header())
+	}
+	
+	rr, reached := corsRequest(cfg, "GET", "https://evil.example.com")
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no Access-Control-Allow-Origin for a disallowed origin, got %q", got)
+	}
+	if rr.Header().Get("Access-Control-Allow-Credentials") != "" || rr.Header().Get("Vary") != "Origin" {
+		t.Errorf("Unexpected headers for a disallowed origin: %v", rr.Header())
+	}
+	if !reached {
+		t.Error("Expected same-origin and non-browser requests to still be served")
+	}
+	
+	rr, reached = corsRequest(cfg, "OPTIONS", "https://evil.example.com")
+	if reached || rr.Code != http.StatusOK || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected a bare preflight response, got %d %v", rr.Code, rr.Header())
+	}
+}
+
+func TestCORS_Disabled(t *testing.T) {
+	cfg := config.DefaultConfig().Security.CORS
+	cfg.Enabled = false
+	
+	rr, reached := corsRequest(cfg, "OPTIONS", "https://app.example.com")
+	if !reached {
+		t.Error("Expected OPTIONS to reach the handler when CORS is disabled")
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no CORS headers, got %q", got)
+	}
+}
+
+func TestScopedAuthMiddleware(t *testing.T) {
+	const (
+		readKey  = "read-only-key-0123"
+		writeKey = "read-write-key-0123"
+	)
+	var seenScope string
+	handler := ScopedAuthMiddleware(map[string]string{
+		readKey:  config.ScopeRead,
+		writeKey: config.ScopeWrite,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenScope = ScopeFromContext(r.Context())
+	}))
+	
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		status int
+		scope  string
+	}{
+		{"read key may GET", "GET", "/personas", readKey, http.StatusOK, config.ScopeRead},
+		{"read key may not POST", "POST", "/personas", readKey, http.StatusForbidden, ""},
+		{"read key may not DELETE", "DELETE", "/personas/p1", readKey, http.StatusForbidden, ""},
+		{"write key may POST", "POST", "/personas", writeKey, http.StatusOK, config.ScopeWrite},
+		{"unknown key", "GET", "/personas", "not-a-key", http.StatusUnauthorized, ""},
+		{"no key", "GET", "/personas", "", http.StatusUnauthorized, ""},
+		{"health needs no key", "GET", "/health", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seenScope = ""
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rr.Code)
+			}
+			if seenScope != tt.scope {
+				t.Errorf("Expected scope %q in the request context, got %q", tt.scope, seenScope)
+			}
+		})
+	}
+	
+	// A single key keeps full access
+	single := AuthMiddleware(writeKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("POST", "/personas", nil)
+	req.Header.Set("X-API-Key", writeKey)
+	rr := httptest.NewRecorder()
+	single.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected a single key to allow POST, got %d", rr.Code)
+	}
+}
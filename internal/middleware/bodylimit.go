@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+)
+
+// DefaultMaxBodySize is the request body limit used when none is configured
+const DefaultMaxBodySize = 1 << 20 // 1MB
+
+// BodyLimitMiddleware rejects request bodies larger than maxBytes with 413
+// Payload Too Large. Requests that declare a larger Content-Length are
+// rejected before the handler runs; for the rest, reading past the limit
+// fails with an error that IsBodyTooLarge recognises.
+func BodyLimitMiddleware(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IsBodyTooLarge reports whether err came from reading past the limit set
+// by BodyLimitMiddleware
+func IsBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	var readErr error
+	handler := BodyLimitMiddleware(16)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+		if IsBodyTooLarge(readErr) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		}
+	}))
+
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		status        int
+	}{
+		{"within limit", "small body", -1, http.StatusOK},
+		{"declared too large", strings.Repeat("x", 17), 17, http.StatusRequestEntityTooLarge},
+		{"undeclared too large", strings.Repeat("x", 17), -1, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readErr = nil
+			req := httptest.NewRequest("POST", "/identities", strings.NewReader(tt.body))
+			req.ContentLength = tt.contentLength
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d (read error %v)", tt.status, rr.Code, readErr)
+			}
+		})
+	}
+}
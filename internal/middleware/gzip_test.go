@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// jsonHandler writes the given number of personas as a JSON array
+func jsonHandler(count int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		personas := make([]map[string]string, count)
+		for i := range personas {
+			personas[i] = map[string]string{"name": "Go Expert", "prompt": "You are a Go expert."}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		json.NewEncoder(w).Encode(personas)
+	})
+}
+
+func TestGzipMiddleware_CompressesLargeResponses(t *testing.T) {
+	handler := GzipMiddleware(256)(jsonHandler(50))
+
+	req := httptest.NewRequest("GET", "/personas", nil)
+	req.Header.Set("Accept-Encoding", "br, gzip;q=0.8")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Expected Content-Encoding gzip, got %q", got)
+	}
+	if got := rr.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding, got %q", got)
+	}
+	if got := rr.Header().Get("ETag"); got != `W/"v1"` {
+		t.Errorf("Expected the ETag to be made weak, got %q", got)
+	}
+
+	reader, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("Expected a gzip body: %v", err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to decompress body: %v", err)
+	}
+	var personas []map[string]string
+	if err := json.Unmarshal(body, &personas); err != nil {
+		t.Fatalf("Expected JSON after decompressing, got %q: %v", body, err)
+	}
+	if len(personas) != 50 || personas[0]["name"] != "Go Expert" {
+		t.Errorf("Unexpected personas after decompressing: %v", personas)
+	}
+}
+
+func TestGzipMiddleware_PassesThrough(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		count          int
+	}{
+		{"gzip not accepted", "", 50},
+		{"gzip refused", "gzip;q=0, identity", 50},
+		{"below threshold", "gzip", 1},
+	}
+	for _, tt := range tests {
+		handler := GzipMiddleware(256)(jsonHandler(tt.count))
+		req := httptest.NewRequest("GET", "/personas", nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("%s: expected no Content-Encoding, got %q", tt.name, got)
+		}
+		if got := rr.Header().Get("ETag"); got != `"v1"` {
+			t.Errorf("%s: expected the ETag unchanged, got %q", tt.name, got)
+		}
+		var personas []map[string]string
+		if err := json.Unmarshal(rr.Body.Bytes(), &personas); err != nil || len(personas) != tt.count {
+			t.Errorf("%s: expected %d plain JSON personas, got %q", tt.name, tt.count, rr.Body.String())
+		}
+	}
+}
+
+func TestGzipMiddleware_StatusAndFlush(t *testing.T) {
+	handler := GzipMiddleware(16)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "first ")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, strings.Repeat("x", 64))
+	}))
+
+	req := httptest.NewRequest("POST", "/personas", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", rr.Code)
+	}
+	if !rr.Flushed {
+		t.Error("Expected Flush to reach the underlying writer")
+	}
+	// Flushing before the threshold commits to an uncompressed response
+	if got := rr.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Expected no Content-Encoding after an early flush, got %q", got)
+	}
+	if want := "first " + strings.Repeat("x", 64); rr.Body.String() != want {
+		t.Errorf("Expected the whole body, got %q", rr.Body.String())
+	}
+
+	handler = GzipMiddleware(16)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent || rr.Header().Get("Content-Encoding") != "" || rr.Body.Len() != 0 {
+		t.Errorf("Expected a bare 204, got %d %v %q", rr.Code, rr.Header(), rr.Body.String())
+	}
+}
@@ -0,0 +1,364 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Schema is a JSON Schema document represented as a generic map so it can be
+// served directly as JSON.
+type Schema map[string]interface{}
+
+// IdentitySchema returns a JSON Schema (draft 2020-12) describing the Identity
+// payload and its nested RichAttributes. Tag limits reflect the currently
+// configured values so the schema stays consistent with ValidateIdentity.
+func IdentitySchema() Schema {
+	return Schema{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         "/schema/identity.json",
+		"title":       "Identity",
+		"description": "A persona-based identity with rich demographic and behavioral attributes",
+		"type":        "object",
+		"required":    []interface{}{"persona_id", "name"},
+		"properties": Schema{
+			"id":          stringSchema(),
+			"persona_id":  Schema{"type": "string", "minLength": 1},
+			"name":        Schema{"type": "string", "minLength": 1},
+			"description": stringSchema(),
+			"attributes":  stringMapSchema(),
+			"preferences": stringMapSchema(),
+			"background":  stringSchema(),
+			"created_at":  Schema{"type": "string", "format": "date-time"},
+			"updated_at":  Schema{"type": "string", "format": "date-time"},
+			"is_active":   Schema{"type": "boolean"},
+			"tags": Schema{
+				"type":     "array",
+				"maxItems": maxTagsPerEntity,
+				"items":    Schema{"type": "string", "maxLength": maxTagLength},
+			},
+			"rich_attributes": richAttributesSchema(),
+		},
+	}
+}
+
+func richAttributesSchema() Schema {
+	return objectSchema(Schema{
+		"demographics": objectSchema(Schema{
+			"age":                  Schema{"type": "integer", "minimum": 0, "maximum": maxIdentityAge},
+			"gender":               stringSchema(),
+			"ethnicity":            stringSchema(),
+			"nationality":          stringSchema(),
+			"education":            stringSchema(),
+			"occupation":           stringSchema(),
+			"socioeconomic_status": enumSchema(socioeconomicStatuses),
+			"location": objectSchema(Schema{
+				"country":     stringSchema(),
+				"region":      stringSchema(),
+				"city":        stringSchema(),
+				"urban_rural": stringSchema(),
+				"timezone":    stringSchema(),
+				"latitude":    Schema{"type": "number", "minimum": -90, "maximum": 90},
+				"longitude":   Schema{"type": "number", "minimum": -180, "maximum": 180},
+			}),
+			"languages":      stringArraySchema(),
+			"marital_status": stringSchema(),
+			"children":       Schema{"type": "integer", "minimum": 0},
+		}),
+		"psychographics": objectSchema(Schema{
+			"personality": objectSchema(Schema{
+				"openness":          unitIntervalSchema(),
+				"conscientiousness": unitIntervalSchema(),
+				"extraversion":      unitIntervalSchema(),
+				"agreeableness":     unitIntervalSchema(),
+				"neuroticism":       unitIntervalSchema(),
+			}),
+			"values":             stringArraySchema(),
+			"core_beliefs":       stringArraySchema(),
+			"cognitive_style":    stringSchema(),
+			"learning_style":     stringSchema(),
+			"risk_tolerance":     Schema{"type": "string", "enum": []interface{}{"", "low", "medium", "high"}},
+			"openness_to_change": unitIntervalSchema(),
+		}),
+		"life_history": objectSchema(Schema{
+			"childhood_traumas": stringArraySchema(),
+			"adult_traumas":     stringArraySchema(),
+			"major_events": Schema{"type": "array", "items": objectSchema(Schema{
+				"type":        stringSchema(),
+				"description": stringSchema(),
+				"age":         Schema{"type": "integer", "minimum": 0, "maximum": 150},
+				"date":        timestampSchema(),
+				"impact":      stringSchema(),
+			})},
+			"education_history": Schema{"type": "array", "items": objectSchema(Schema{
+				"level":       stringSchema(),
+				"field":       stringSchema(),
+				"institution": stringSchema(),
+				"graduation":  timestampSchema(),
+				"performance": stringSchema(),
+			})},
+			"career_history": Schema{"type": "array", "items": objectSchema(Schema{
+				"title":      stringSchema(),
+				"industry":   stringSchema(),
+				"company":    stringSchema(),
+				"start_date": timestampSchema(),
+				"end_date":   timestampSchema(),
+				"is_current": Schema{"type": "boolean"},
+				"salary":     stringSchema(),
+			})},
+		}),
+		"cultural_religious": objectSchema(Schema{
+			"religion":             stringSchema(),
+			"spirituality":         stringSchema(),
+			"cultural_background":  stringSchema(),
+			"traditions":           stringArraySchema(),
+			"holidays":             stringArraySchema(),
+			"dietary_restrictions": stringArraySchema(),
+		}),
+		"political_social": objectSchema(Schema{
+			"political_leaning": enumSchema(politicalLeanings),
+			"activism":          stringArraySchema(),
+			"social_groups":     stringArraySchema(),
+			"causes":            stringArraySchema(),
+			"voting_history":    stringSchema(),
+			"media_consumption": stringArraySchema(),
+		}),
+		"health": objectSchema(Schema{
+			"physical_health":    stringSchema(),
+			"mental_health":      stringSchema(),
+			"disabilities":       stringArraySchema(),
+			"chronic_conditions": stringArraySchema(),
+			"addictions":         stringArraySchema(),
+			"medications":        stringArraySchema(),
+		}),
+		"preferences": objectSchema(Schema{
+			"hobbies":         stringArraySchema(),
+			"interests":       stringArraySchema(),
+			"favorite_foods":  stringArraySchema(),
+			"favorite_music":  stringArraySchema(),
+			"favorite_movies": stringArraySchema(),
+			"favorite_books":  stringArraySchema(),
+			"technology_use":  stringSchema(),
+			"travel_style":    stringSchema(),
+		}),
+		"behavioral_tendencies": objectSchema(Schema{
+			"decision_making":     stringSchema(),
+			"conflict_resolution": stringSchema(),
+			"communication_style": stringSchema(),
+			"leadership_style":    stringSchema(),
+			"coping_mechanisms":   stringArraySchema(),
+			"stress_response":     stringSchema(),
+		}),
+		"current_context": objectSchema(Schema{
+			"mood":          stringSchema(),
+			"stress_level":  unitIntervalSchema(),
+			"current_goals": stringArraySchema(),
+			"recent_events": stringArraySchema(),
+			"life_stage":    stringSchema(),
+		}),
+		"custom": stringMapSchema(),
+	})
+}
+
+// Schema building helpers
+func stringSchema() Schema {
+	return Schema{"type": "string"}
+}
+
+func stringArraySchema() Schema {
+	return Schema{"type": "array", "items": stringSchema()}
+}
+
+func stringMapSchema() Schema {
+	return Schema{"type": "object", "additionalProperties": stringSchema()}
+}
+
+// enumSchema accepts the given values or an empty string
+func enumSchema(values []string) Schema {
+	enum := []interface{}{""}
+	for _, v := range values {
+		enum = append(enum, v)
+	}
+	return Schema{"type": "string", "enum": enum}
+}
+
+func unitIntervalSchema() Schema {
+	return Schema{"type": "number", "minimum": 0, "maximum": 1}
+}
+
+// timestampSchema describes a protobuf Timestamp as serialized by encoding/json
+func timestampSchema() Schema {
+	return objectSchema(Schema{
+		"seconds": Schema{"type": "integer"},
+		"nanos":   Schema{"type": "integer"},
+	})
+}
+
+func objectSchema(properties Schema) Schema {
+	return Schema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// ValidateAgainstSchema validates a decoded JSON value against a schema.
+//
+// Only the subset of JSON Schema used by this service is supported: type,
+// properties, required, additionalProperties, items, enum, minimum, maximum,
+// minLength, maxLength and maxItems. Both the schema and the value may be
+// the result of decoding JSON into an interface{}, so a schema fetched from
+// /schema/identity.json can be used directly.
+func ValidateAgainstSchema(schema map[string]interface{}, value interface{}) error {
+	var errors []ValidationError
+	validateSchemaValue(schema, value, "", &errors)
+	if len(errors) > 0 {
+		return ValidationErrors{Errors: errors}
+	}
+	return nil
+}
+
+func validateSchemaValue(schema map[string]interface{}, value interface{}, path string, errors *[]ValidationError) {
+	field := path
+	if field == "" {
+		field = "$"
+	}
+	fail := func(format string, args ...interface{}) {
+		*errors = append(*errors, ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if value == nil {
+		// Absent optional values are represented as null in JSON
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if allowed == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value must be one of %v", enum)
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			fail("must be an object")
+			return
+		}
+		properties, _ := asSchema(schema["properties"])
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, present := obj[name.(string)]; !present {
+					*errors = append(*errors, ValidationError{
+						Field:   joinSchemaPath(path, name.(string)),
+						Message: "is required",
+					})
+				}
+			}
+		}
+
+		// Iterate in a stable order so error output is deterministic
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			childPath := joinSchemaPath(path, key)
+			if propSchema, ok := asSchema(properties[key]); ok {
+				validateSchemaValue(propSchema, obj[key], childPath, errors)
+				continue
+			}
+			if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				*errors = append(*errors, ValidationError{Field: childPath, Message: "unknown field"})
+			} else if additional, ok := asSchema(schema["additionalProperties"]); ok {
+				validateSchemaValue(additional, obj[key], childPath, errors)
+			}
+		}
+
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			fail("must be an array")
+			return
+		}
+		if maxItems, ok := toFloat(schema["maxItems"]); ok && float64(len(arr)) > maxItems {
+			fail("cannot have more than %v items", schema["maxItems"])
+		}
+		if itemSchema, ok := asSchema(schema["items"]); ok {
+			for i, item := range arr {
+				validateSchemaValue(itemSchema, item, fmt.Sprintf("%s[%d]", field, i), errors)
+			}
+		}
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			fail("must be a string")
+			return
+		}
+		if minLength, ok := toFloat(schema["minLength"]); ok && float64(len(str)) < minLength {
+			fail("must be at least %v characters", schema["minLength"])
+		}
+		if maxLength, ok := toFloat(schema["maxLength"]); ok && float64(len(str)) > maxLength {
+			fail("cannot exceed %v characters", schema["maxLength"])
+		}
+
+	case "integer", "number":
+		num, ok := value.(float64)
+		if !ok {
+			fail("must be a %s", schema["type"])
+			return
+		}
+		if schema["type"] == "integer" && num != math.Trunc(num) {
+			fail("must be an integer")
+		}
+		if minimum, ok := toFloat(schema["minimum"]); ok && num < minimum {
+			fail("must be at least %v", schema["minimum"])
+		}
+		if maximum, ok := toFloat(schema["maximum"]); ok && num > maximum {
+			fail("must be at most %v", schema["maximum"])
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("must be a boolean")
+		}
+	}
+}
+
+func joinSchemaPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// asSchema accepts both Schema values and schemas decoded from JSON
+func asSchema(v interface{}) (map[string]interface{}, bool) {
+	switch s := v.(type) {
+	case Schema:
+		return s, true
+	case map[string]interface{}:
+		return s, true
+	}
+	return nil, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
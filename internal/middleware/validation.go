@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"unicode"
 
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
 )
 
@@ -28,6 +30,28 @@ func (ve ValidationErrors) Error() string {
 	return strings.Join(messages, ", ")
 }
 
+// Is makes ValidationErrors match errs.ErrValidation
+func (ve ValidationErrors) Is(target error) bool {
+	return target == errs.ErrValidation
+}
+
+// Default tag limits, overridable via SetTagLimits
+var (
+	maxTagsPerEntity = 20
+	maxTagLength     = 50
+)
+
+// SetTagLimits configures the maximum number of tags per entity and the
+// maximum length of a single tag. Non-positive values are ignored.
+func SetTagLimits(maxTags, maxLength int) {
+	if maxTags > 0 {
+		maxTagsPerEntity = maxTags
+	}
+	if maxLength > 0 {
+		maxTagLength = maxLength
+	}
+}
+
 // ValidatePersona validates a persona struct
 func ValidatePersona(p *types.Persona) error {
 	if p == nil {
@@ -103,6 +127,8 @@ func ValidatePersona(p *types.Persona) error {
 		}
 	}
 
+	errors = append(errors, validateTags(p.Tags)...)
+
 	// Validate RAG field
 	if p.Rag != nil {
 		for i, rag := range p.Rag {
@@ -112,6 +138,50 @@ func ValidatePersona(p *types.Persona) error {
 		}
 	}
 
+	errors = append(errors, validateRAGDocuments(p.RagDocuments)...)
+
+	if len(errors) > 0 {
+		return ValidationErrors{Errors: errors}
+	}
+
+	return nil
+}
+
+// validateRAGDocuments checks that every document has a unique ID and
+// something to retrieve
+func validateRAGDocuments(docs []types.RAGDocument) []ValidationError {
+	var errors []ValidationError
+	seen := make(map[string]bool, len(docs))
+	for i, doc := range docs {
+		field := fmt.Sprintf("rag_documents[%d]", i)
+		switch {
+		case doc.Id == "":
+			errors = append(errors, ValidationError{Field: field, Message: "id is required"})
+		case seen[doc.Id]:
+			errors = append(errors, ValidationError{Field: field, Message: fmt.Sprintf("duplicate id %q", doc.Id)})
+		}
+		seen[doc.Id] = true
+		if doc.Content == "" && doc.Source == "" {
+			errors = append(errors, ValidationError{Field: field, Message: "content or source is required"})
+		}
+		if len(doc.Title) > 200 {
+			errors = append(errors, ValidationError{Field: field, Message: "title cannot exceed 200 characters"})
+		}
+	}
+	return errors
+}
+
+// ValidateIdentity validates an identity struct
+func ValidateIdentity(i *types.Identity) error {
+	if i == nil {
+		return ValidationErrors{Errors: []ValidationError{{
+			Field:   "identity",
+			Message: "identity cannot be nil",
+		}}}
+	}
+
+	errors := validateTags(i.Tags)
+	errors = append(errors, validateRichAttributes(i.RichAttributes)...)
 	if len(errors) > 0 {
 		return ValidationErrors{Errors: errors}
 	}
@@ -119,6 +189,116 @@ func ValidatePersona(p *types.Persona) error {
 	return nil
 }
 
+// maxIdentityAge is the oldest age accepted for an identity
+const maxIdentityAge = 150
+
+// Known values for the categorical identity attributes. An empty value
+// means the attribute is unset and is always accepted.
+var (
+	politicalLeanings     = []string{"very_liberal", "liberal", "moderate", "conservative", "very_conservative"}
+	socioeconomicStatuses = []string{"low_income", "lower_middle", "middle", "upper_middle", "high_income"}
+)
+
+// validateRichAttributes checks numeric ranges and enumerated values in an
+// identity's rich attributes. Field names match the paths reported by
+// ValidateAgainstSchema.
+func validateRichAttributes(rich *types.RichAttributes) []ValidationError {
+	var errors []ValidationError
+
+	unitInterval := func(field string, value float64) {
+		if value < 0 || value > 1 {
+			errors = append(errors, ValidationError{
+				Field:   field,
+				Message: "must be between 0 and 1",
+			})
+		}
+	}
+	oneOf := func(field, value string, allowed []string) {
+		if value == "" {
+			return
+		}
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		errors = append(errors, ValidationError{
+			Field:   field,
+			Message: fmt.Sprintf("must be one of %s", strings.Join(allowed, ", ")),
+		})
+	}
+
+	if dem := rich.GetDemographics(); dem != nil {
+		if dem.Age < 0 || dem.Age > maxIdentityAge {
+			errors = append(errors, ValidationError{
+				Field:   "rich_attributes.demographics.age",
+				Message: fmt.Sprintf("must be between 0 and %d", maxIdentityAge),
+			})
+		}
+		oneOf("rich_attributes.demographics.socioeconomic_status", dem.SocioeconomicStatus, socioeconomicStatuses)
+	}
+
+	if psy := rich.GetPsychographics(); psy != nil {
+		if p := psy.Personality; p != nil {
+			unitInterval("rich_attributes.psychographics.personality.openness", p.Openness)
+			unitInterval("rich_attributes.psychographics.personality.conscientiousness", p.Conscientiousness)
+			unitInterval("rich_attributes.psychographics.personality.extraversion", p.Extraversion)
+			unitInterval("rich_attributes.psychographics.personality.agreeableness", p.Agreeableness)
+			unitInterval("rich_attributes.psychographics.personality.neuroticism", p.Neuroticism)
+		}
+		unitInterval("rich_attributes.psychographics.openness_to_change", psy.OpennessToChange)
+	}
+
+	if ps := rich.GetPoliticalSocial(); ps != nil {
+		oneOf("rich_attributes.political_social.political_leaning", ps.PoliticalLeaning, politicalLeanings)
+	}
+
+	if ctx := rich.GetCurrentContext(); ctx != nil {
+		unitInterval("rich_attributes.current_context.stress_level", ctx.StressLevel)
+	}
+
+	return errors
+}
+
+// ValidateCommunity validates a community struct
+func ValidateCommunity(c *types.Community) error {
+	if c == nil {
+		return ValidationErrors{Errors: []ValidationError{{
+			Field:   "community",
+			Message: "community cannot be nil",
+		}}}
+	}
+
+	if errors := validateTags(c.Tags); len(errors) > 0 {
+		return ValidationErrors{Errors: errors}
+	}
+
+	return nil
+}
+
+// validateTags checks tag count and individual tag lengths against the configured limits
+func validateTags(tags []string) []ValidationError {
+	var errors []ValidationError
+
+	if len(tags) > maxTagsPerEntity {
+		errors = append(errors, ValidationError{
+			Field:   "tags",
+			Message: fmt.Sprintf("cannot have more than %d tags", maxTagsPerEntity),
+		})
+	}
+
+	for i, tag := range tags {
+		if len(tag) > maxTagLength {
+			errors = append(errors, ValidationError{
+				Field:   fmt.Sprintf("tags[%d]", i),
+				Message: fmt.Sprintf("tag cannot exceed %d characters", maxTagLength),
+			})
+		}
+	}
+
+	return errors
+}
+
 // ValidationMiddleware returns an HTTP middleware that validates request bodies
 func ValidationMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -185,4 +365,80 @@ func SanitizePersona(p *types.Persona) {
 		}
 		p.Rag = cleanRAG
 	}
+	for i := range p.RagDocuments {
+		doc := &p.RagDocuments[i]
+		doc.Id = strings.TrimSpace(doc.Id)
+		doc.Title = strings.TrimSpace(doc.Title)
+		doc.Source = strings.TrimSpace(doc.Source)
+		doc.Content = strings.TrimSpace(doc.Content)
+	}
+
+	p.Tags = sanitizeTags(p.Tags)
+}
+
+// SanitizeIdentity sanitizes identity input by trimming whitespace,
+// collapsing runs of whitespace and dropping control characters from its
+// free-text fields. The name is kept to a single line; the description and
+// background keep their line breaks.
+func SanitizeIdentity(i *types.Identity) {
+	if i == nil {
+		return
+	}
+
+	i.Name = sanitizeLine(i.Name)
+	i.Description = sanitizeText(i.Description)
+	i.Background = sanitizeText(i.Background)
+	i.Tags = sanitizeTags(i.Tags)
+}
+
+// sanitizeLine drops control characters from s and collapses its
+// whitespace, including line breaks, to single spaces
+func sanitizeLine(s string) string {
+	return strings.Join(strings.Fields(stripControl(s)), " ")
+}
+
+// sanitizeText is sanitizeLine applied to each line of s, keeping the line
+// breaks between them
+func sanitizeText(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = sanitizeLine(line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// stripControl removes control characters other than whitespace, such as
+// NUL or terminal escapes, from s
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// SanitizeCommunity sanitizes community input by trimming whitespace
+func SanitizeCommunity(c *types.Community) {
+	if c == nil {
+		return
+	}
+
+	c.Name = strings.TrimSpace(c.Name)
+	c.Description = strings.TrimSpace(c.Description)
+	c.Tags = sanitizeTags(c.Tags)
+}
+
+// sanitizeTags trims tags and drops empty entries, preserving a nil slice
+func sanitizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	cleanTags := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if clean := strings.TrimSpace(tag); clean != "" {
+			cleanTags = append(cleanTags, clean)
+		}
+	}
+	return cleanTags
 }
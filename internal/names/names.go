@@ -0,0 +1,166 @@
+// Package names generates person names from per-locale first and last name
+// pools. The built-in pools are embedded JSON files under pools/; more can be
+// added at runtime with LoadPools.
+package names
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// DefaultLocale is used when no pool matches the requested locale or country
+const DefaultLocale = "en-US"
+
+//go:embed pools/*.json
+var embeddedPools embed.FS
+
+// Pool is the set of names for one locale
+type Pool struct {
+	Locale string `json:"locale"`
+	// Countries lists the country names and codes that select this pool
+	Countries  []string `json:"countries"`
+	FirstNames []string `json:"first_names"`
+	LastNames  []string `json:"last_names"`
+	// FamilyNameFirst puts the last name before the first name
+	FamilyNameFirst bool `json:"family_name_first,omitempty"`
+}
+
+func (p *Pool) validate() error {
+	if p.Locale == "" {
+		return fmt.Errorf("name pool locale is required")
+	}
+	if len(p.FirstNames) == 0 || len(p.LastNames) == 0 {
+		return fmt.Errorf("name pool %s needs at least one first and last name", p.Locale)
+	}
+	return nil
+}
+
+var (
+	mu        sync.RWMutex
+	pools     = make(map[string]*Pool)
+	countries = make(map[string]string)
+)
+
+func init() {
+	entries, err := embeddedPools.ReadDir("pools")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := embeddedPools.ReadFile(path.Join("pools", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		if err := LoadPools(data); err != nil {
+			panic(fmt.Sprintf("embedded name pool %s: %v", entry.Name(), err))
+		}
+	}
+}
+
+// LoadPools registers the pools in data, which holds either a single pool
+// object or an array of them. A pool replaces any existing pool with the
+// same locale.
+func LoadPools(data []byte) error {
+	var loaded []*Pool
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			return fmt.Errorf("invalid name pools: %v", err)
+		}
+	} else {
+		var pool Pool
+		if err := json.Unmarshal(data, &pool); err != nil {
+			return fmt.Errorf("invalid name pool: %v", err)
+		}
+		loaded = []*Pool{&pool}
+	}
+
+	for _, pool := range loaded {
+		if err := pool.validate(); err != nil {
+			return err
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, pool := range loaded {
+		pools[pool.Locale] = pool
+		for _, country := range pool.Countries {
+			countries[strings.ToLower(country)] = pool.Locale
+		}
+	}
+	return nil
+}
+
+// Locales returns the registered locales in sorted order
+func Locales() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	locales := make([]string, 0, len(pools))
+	for locale := range pools {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// LocaleForCountry returns the locale whose pool lists country, matched
+// case-insensitively, or DefaultLocale
+func LocaleForCountry(country string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if locale, ok := countries[strings.ToLower(strings.TrimSpace(country))]; ok {
+		return locale
+	}
+	return DefaultLocale
+}
+
+func pool(locale string) *Pool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if p, ok := pools[locale]; ok {
+		return p
+	}
+	return pools[DefaultLocale]
+}
+
+// NameGenerator picks names from the registered pools
+type NameGenerator struct {
+	intn func(n int) int
+}
+
+// NewNameGenerator creates a name generator that draws from intn, which
+// must return a value in [0, n)
+func NewNameGenerator(intn func(n int) int) *NameGenerator {
+	return &NameGenerator{intn: intn}
+}
+
+// Generate returns a name from the pool for locale, falling back to
+// DefaultLocale for unknown locales
+func (g *NameGenerator) Generate(locale string) string {
+	p := pool(locale)
+	first := p.FirstNames[g.intn(len(p.FirstNames))]
+	last := p.LastNames[g.intn(len(p.LastNames))]
+	if p.FamilyNameFirst {
+		return last + " " + first
+	}
+	return first + " " + last
+}
+
+// ForDemographics returns a name from the pool matching the country in
+// demographics, or from the default pool when there is none
+func (g *NameGenerator) ForDemographics(demographics *types.Demographics) string {
+	if demographics == nil || demographics.Location == nil {
+		return g.Generate(DefaultLocale)
+	}
+	return g.Generate(LocaleForCountry(demographics.Location.Country))
+}
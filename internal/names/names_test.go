@@ -0,0 +1,104 @@
+package names
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+func lastNames(locale string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range pool(locale).LastNames {
+		set[name] = true
+	}
+	return set
+}
+
+func TestEmbeddedPools(t *testing.T) {
+	locales := Locales()
+	for _, want := range []string{"en-US", "es-ES", "ja-JP"} {
+		found := false
+		for _, locale := range locales {
+			found = found || locale == want
+		}
+		if !found {
+			t.Errorf("Expected embedded pool %s, got %v", want, locales)
+		}
+	}
+}
+
+func TestLocaleForCountry(t *testing.T) {
+	tests := map[string]string{
+		"Spain":         "es-ES",
+		"spain":         "es-ES",
+		"ES":            "es-ES",
+		"Japan":         "ja-JP",
+		"United States": "en-US",
+		"Atlantis":      DefaultLocale,
+		"":              DefaultLocale,
+	}
+	for country, want := range tests {
+		if got := LocaleForCountry(country); got != want {
+			t.Errorf("LocaleForCountry(%q) = %q, want %q", country, got, want)
+		}
+	}
+}
+
+func TestGenerate_LocaleChangesNames(t *testing.T) {
+	g := NewNameGenerator(rand.New(rand.NewSource(1)).Intn)
+	spanish := lastNames("es-ES")
+	american := lastNames("en-US")
+
+	spanishHits, americanHits := 0, 0
+	for range 200 {
+		name := g.ForDemographics(&types.Demographics{Location: &types.Location{Country: "Spain"}})
+		parts := strings.Fields(name)
+		if spanish[parts[len(parts)-1]] {
+			spanishHits++
+		}
+
+		name = g.Generate("en-US")
+		parts = strings.Fields(name)
+		if american[parts[len(parts)-1]] {
+			americanHits++
+		}
+	}
+	if spanishHits != 200 {
+		t.Errorf("Expected every Spain name to use an es-ES last name, got %d/200", spanishHits)
+	}
+	if americanHits != 200 {
+		t.Errorf("Expected every en-US name to use an en-US last name, got %d/200", americanHits)
+	}
+}
+
+func TestGenerate_FamilyNameFirst(t *testing.T) {
+	g := NewNameGenerator(rand.New(rand.NewSource(1)).Intn)
+	japanese := lastNames("ja-JP")
+	for range 20 {
+		name := g.Generate("ja-JP")
+		if !japanese[strings.Fields(name)[0]] {
+			t.Errorf("Expected ja-JP name %q to start with the family name", name)
+		}
+	}
+}
+
+func TestLoadPools(t *testing.T) {
+	data := []byte(`[{"locale": "xx-TEST", "countries": ["Testland"], "first_names": ["Ada"], "last_names": ["Lovelace"]}]`)
+	if err := LoadPools(data); err != nil {
+		t.Fatalf("LoadPools failed: %v", err)
+	}
+
+	g := NewNameGenerator(rand.New(rand.NewSource(1)).Intn)
+	if got := g.ForDemographics(&types.Demographics{Location: &types.Location{Country: "testland"}}); got != "Ada Lovelace" {
+		t.Errorf("Expected a name from the loaded pool, got %q", got)
+	}
+
+	if err := LoadPools([]byte(`{"locale": "xx-EMPTY"}`)); err == nil {
+		t.Error("Expected an error for a pool without names")
+	}
+	if err := LoadPools([]byte(`{`)); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
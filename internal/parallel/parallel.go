@@ -0,0 +1,50 @@
+// Package parallel runs independent units of work on a bounded number of
+// goroutines.
+package parallel
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Workers returns the number of goroutines For uses for n: n itself when
+// positive, otherwise one per CPU
+func Workers(n int) int {
+	if n <= 0 {
+		return runtime.NumCPU()
+	}
+	return n
+}
+
+// For calls fn once for every index in [0, count) from at most
+// Workers(workers) goroutines and returns when all calls have returned.
+// Calls may run in any order, so fn must only touch state belonging to its
+// index or guard shared state itself. With a single worker, fn runs on the
+// calling goroutine in index order.
+func For(count, workers int, fn func(i int)) {
+	workers = min(Workers(workers), count)
+	if workers <= 1 {
+		for i := range count {
+			fn(i)
+		}
+		return
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= count {
+					return
+				}
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
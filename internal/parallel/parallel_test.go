@@ -0,0 +1,43 @@
+package parallel
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestFor_CallsEveryIndexOnce(t *testing.T) {
+	for _, workers := range []int{0, 1, 4, 100} {
+		calls := make([]atomic.Int32, 50)
+		For(len(calls), workers, func(i int) {
+			calls[i].Add(1)
+		})
+		for i := range calls {
+			if n := calls[i].Load(); n != 1 {
+				t.Errorf("workers=%d: expected index %d to be called once, got %d", workers, i, n)
+			}
+		}
+	}
+}
+
+func TestFor_BoundsWorkers(t *testing.T) {
+	var running, peak atomic.Int32
+	For(200, 3, func(int) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		running.Add(-1)
+	})
+	if p := peak.Load(); p > 3 {
+		t.Errorf("Expected at most 3 concurrent calls, got %d", p)
+	}
+}
+
+func TestFor_Empty(t *testing.T) {
+	For(0, 4, func(int) {
+		t.Error("Expected no calls for an empty range")
+	})
+}
@@ -0,0 +1,42 @@
+package persona
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
+)
+
+// BackupTo writes every persona, identity, community and relationship to w
+// as a tar.gz archive that RestoreFrom can load. The storage backend must
+// implement storage.Archiver.
+func (s *Service) BackupTo(w io.Writer) error {
+	archiver, ok := storage.As[storage.Archiver](s.storage)
+	if !ok {
+		return fmt.Errorf("storage backend does not support backup")
+	}
+	if err := archiver.BackupTo(w); err != nil {
+		return fmt.Errorf("failed to write backup: %v", err)
+	}
+	return nil
+}
+
+// RestoreFrom loads an archive written by BackupTo, keeping the archived
+// IDs. Entities that already exist are skipped, or replaced when overwrite
+// is true.
+func (s *Service) RestoreFrom(r io.Reader, overwrite bool) error {
+	archiver, ok := storage.As[storage.Archiver](s.storage)
+	if !ok {
+		return fmt.Errorf("storage backend does not support restore")
+	}
+	err := archiver.RestoreFrom(r, overwrite)
+	// The archive was written to the backend directly, so cached copies of
+	// what it replaced are stale
+	if cache, ok := storage.As[*storage.CachingStorage](s.storage); ok {
+		cache.Purge()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore backup: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package persona
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// MaxAvatarSize is the largest avatar image accepted, in bytes
+const MaxAvatarSize = 512 * 1024
+
+var (
+	// ErrAvatarsUnsupported is returned when the storage backend does not
+	// implement storage.AvatarStore
+	ErrAvatarsUnsupported = errors.New("storage backend does not support avatars")
+	// ErrAvatarTooLarge is returned for an avatar over MaxAvatarSize
+	ErrAvatarTooLarge = fmt.Errorf("avatar exceeds %d bytes", MaxAvatarSize)
+	// ErrAvatarType is returned for an avatar that is not a PNG or JPEG
+	// image
+	ErrAvatarType = errors.New("avatar must be a PNG or JPEG image")
+)
+
+func (s *Service) avatarStore() (storage.AvatarStore, error) {
+	store, ok := storage.As[storage.AvatarStore](s.storage)
+	if !ok {
+		return nil, ErrAvatarsUnsupported
+	}
+	return store, nil
+}
+
+// SetIdentityAvatar stores a PNG or JPEG image as an identity's avatar,
+// replacing any previous one. The declared content type must match the
+// image data.
+func (s *Service) SetIdentityAvatar(id, contentType string, data []byte) error {
+	store, err := s.avatarStore()
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxAvatarSize {
+		return ErrAvatarTooLarge
+	}
+	if contentType != "image/png" && contentType != "image/jpeg" {
+		return ErrAvatarType
+	}
+	if detected := http.DetectContentType(data); detected != contentType {
+		return fmt.Errorf("%w: data is %s, not %s", ErrAvatarType, detected, contentType)
+	}
+
+	if err := store.SaveIdentityAvatar(id, types.Avatar{ContentType: contentType, Data: data}); err != nil {
+		return err
+	}
+	s.notify(types.ChangeKindIdentity, types.ChangeOpUpdate, id)
+	return nil
+}
+
+// GetIdentityAvatar returns an identity's avatar
+func (s *Service) GetIdentityAvatar(id string) (types.Avatar, error) {
+	store, err := s.avatarStore()
+	if err != nil {
+		return types.Avatar{}, err
+	}
+	return store.GetIdentityAvatar(id)
+}
+
+// DeleteIdentityAvatar removes an identity's avatar
+func (s *Service) DeleteIdentityAvatar(id string) error {
+	store, err := s.avatarStore()
+	if err != nil {
+		return err
+	}
+	if err := store.DeleteIdentityAvatar(id); err != nil {
+		return err
+	}
+	s.notify(types.ChangeKindIdentity, types.ChangeOpUpdate, id)
+	return nil
+}
@@ -0,0 +1,149 @@
+package persona
+
+import (
+	"fmt"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// ApplyBatch applies ops in order and reports a result per operation. It
+// returns true if every operation succeeded.
+//
+// The storage backends have no transactions spanning several writes, so a
+// batch is made all-or-nothing by undoing: when an operation fails, the
+// operations after it are skipped and those before it are reverted in
+// reverse order. Creates are deleted, updates are written back and soft
+// deletes are restored. A permanent delete cannot be undone, so a batch
+// that permanently deletes and then fails leaves that delete applied; put
+// deletes last to avoid this. Other clients may see the intermediate states
+// while the batch runs, and an update that is reverted still leaves an entry
+// in the persona's version history. An undo that fails leaves its operation
+// applied; its result reports the rollback error instead of RolledBack.
+func (s *Service) ApplyBatch(ops []types.BatchOperation) ([]types.BatchOperationResult, bool) {
+	results := make([]types.BatchOperationResult, len(ops))
+	undos := make([]func() error, len(ops))
+	for idx, op := range ops {
+		results[idx].Index = idx
+		id, undo, err := s.applyBatchOperation(op)
+		if err != nil {
+			results[idx].Error = err.Error()
+			for j := idx + 1; j < len(ops); j++ {
+				results[j] = types.BatchOperationResult{Index: j, Skipped: true}
+			}
+			for j := idx - 1; j >= 0; j-- {
+				if undos[j] == nil {
+					continue
+				}
+				if err := undos[j](); err != nil {
+					results[j].Error = fmt.Sprintf("rollback failed: %v", err)
+					continue
+				}
+				results[j].RolledBack = true
+			}
+			return results, false
+		}
+		results[idx].Id = id
+		undos[idx] = undo
+	}
+	return results, true
+}
+
+// applyBatchOperation applies op and returns the ID it affected, with a
+// function that reverts it, or nil if it cannot be reverted
+func (s *Service) applyBatchOperation(op types.BatchOperation) (string, func() error, error) {
+	switch op.Kind {
+	case types.BatchCreatePersona:
+		if op.Persona == nil {
+			return "", nil, errs.Validation("persona is required")
+		}
+		p := *op.Persona
+		if err := s.CreatePersona(&p); err != nil {
+			return "", nil, err
+		}
+		return p.Id, func() error {
+			if err := s.storage.Delete(p.Id); err != nil {
+				return err
+			}
+			s.notify(types.ChangeKindPersona, types.ChangeOpDelete, p.Id)
+			return nil
+		}, nil
+
+	case types.BatchUpdatePersona:
+		if op.Persona == nil {
+			return "", nil, errs.Validation("persona is required")
+		}
+		previous, err := s.activePersona(op.Id)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := s.UpdatePersona(op.Id, *op.Persona); err != nil {
+			return "", nil, err
+		}
+		return op.Id, func() error {
+			previous.Version = 0
+			if err := s.storage.Update(op.Id, previous); err != nil {
+				return err
+			}
+			s.notify(types.ChangeKindPersona, types.ChangeOpUpdate, op.Id)
+			return nil
+		}, nil
+
+	case types.BatchDeletePersona:
+		if err := s.DeletePersona(op.Id); err != nil {
+			return "", nil, err
+		}
+		if !s.softDelete {
+			return op.Id, nil, nil
+		}
+		return op.Id, func() error {
+			if err := s.storage.Restore(op.Id); err != nil {
+				return err
+			}
+			s.notify(types.ChangeKindPersona, types.ChangeOpUpdate, op.Id)
+			return nil
+		}, nil
+
+	case types.BatchCreateIdentity:
+		if op.Identity == nil {
+			return "", nil, errs.Validation("identity is required")
+		}
+		i := *op.Identity
+		if err := s.CreateIdentity(&i); err != nil {
+			return "", nil, err
+		}
+		return i.Id, func() error {
+			if err := s.storage.DeleteIdentity(i.Id); err != nil {
+				return err
+			}
+			s.notify(types.ChangeKindIdentity, types.ChangeOpDelete, i.Id)
+			return nil
+		}, nil
+
+	case types.BatchUpdateIdentity:
+		if op.Identity == nil {
+			return "", nil, errs.Validation("identity is required")
+		}
+		previous, err := s.storage.GetIdentity(op.Id)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := s.UpdateIdentity(op.Id, *op.Identity); err != nil {
+			return "", nil, err
+		}
+		return op.Id, func() error {
+			if err := s.storage.UpdateIdentity(op.Id, previous); err != nil {
+				return err
+			}
+			s.notify(types.ChangeKindIdentity, types.ChangeOpUpdate, op.Id)
+			return nil
+		}, nil
+
+	case types.BatchDeleteIdentity:
+		if err := s.DeleteIdentity(op.Id); err != nil {
+			return "", nil, err
+		}
+		return op.Id, nil, nil
+	}
+	return "", nil, errs.Validation("unknown batch operation %q", op.Kind)
+}
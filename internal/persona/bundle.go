@@ -0,0 +1,126 @@
+package persona
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// ExportPersonas serializes all personas as a JSON array bundle, ordered by
+// ID, for moving personas between environments with ImportPersonas.
+func (s *Service) ExportPersonas() ([]byte, error) {
+	personas, err := s.storage.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list personas: %v", err)
+	}
+	sort.Slice(personas, func(i, j int) bool {
+		return personas[i].Id < personas[j].Id
+	})
+	if personas == nil {
+		personas = []types.Persona{}
+	}
+
+	data, err := json.MarshalIndent(personas, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal personas: %v", err)
+	}
+	return data, nil
+}
+
+// ImportPersonas loads a JSON array bundle produced by ExportPersonas.
+//
+// Every persona is validated before anything is written, so an invalid entry
+// rejects the whole bundle. Personas whose IDs already exist are skipped,
+// or replaced when overwrite is true. Other personas are created under new
+// IDs, and parent references within the bundle are rewritten to match.
+//
+// Returns the number of personas created or overwritten.
+func (s *Service) ImportPersonas(data []byte, overwrite bool) (int, error) {
+	var personas []types.Persona
+	if err := json.Unmarshal(data, &personas); err != nil {
+		return 0, errs.Validation("failed to parse persona bundle: %v", err)
+	}
+
+	for i := range personas {
+		middleware.SanitizePersona(&personas[i])
+		if err := middleware.ValidatePersona(&personas[i]); err != nil {
+			return 0, fmt.Errorf("persona %d (%s): %w", i, personas[i].Name, err)
+		}
+	}
+
+	// Split the bundle into personas that exist here and ones to create
+	var existing, pending []types.Persona
+	for _, p := range personas {
+		if p.Id != "" {
+			if _, err := s.storage.Get(p.Id); err == nil {
+				existing = append(existing, p)
+				continue
+			}
+		}
+		pending = append(pending, p)
+	}
+
+	// Bundle IDs are replaced on create; track them so children follow
+	newIDs := make(map[string]string)
+	pendingIDs := make(map[string]bool)
+	for _, p := range pending {
+		if p.Id != "" {
+			pendingIDs[p.Id] = true
+		}
+	}
+
+	imported := 0
+
+	// Create parents before children, one generation per pass
+	for len(pending) > 0 {
+		var deferred []types.Persona
+		for _, p := range pending {
+			if p.ParentId != "" {
+				if pendingIDs[p.ParentId] {
+					deferred = append(deferred, p)
+					continue
+				}
+				if id, ok := newIDs[p.ParentId]; ok {
+					p.ParentId = id
+				}
+			}
+
+			oldID := p.Id
+			p.Version = 0
+			if err := s.CreatePersona(&p); err != nil {
+				return imported, fmt.Errorf("failed to import persona %s: %w", p.Name, err)
+			}
+			if oldID != "" {
+				newIDs[oldID] = p.Id
+				delete(pendingIDs, oldID)
+			}
+			imported++
+		}
+
+		if len(deferred) == len(pending) {
+			return imported, errs.Validation("persona bundle contains an inheritance cycle")
+		}
+		pending = deferred
+	}
+
+	if !overwrite {
+		return imported, nil
+	}
+
+	for _, p := range existing {
+		if id, ok := newIDs[p.ParentId]; ok {
+			p.ParentId = id
+		}
+		p.Version = 0 // Imports always replace the current version
+		if err := s.UpdatePersona(p.Id, p); err != nil {
+			return imported, fmt.Errorf("failed to overwrite persona %s: %w", p.Id, err)
+		}
+		imported++
+	}
+
+	return imported, nil
+}
@@ -0,0 +1,93 @@
+package persona
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// DiffPersonas reports how b differs from a: changed name, topic and prompt,
+// added, removed and changed context keys, and added and removed RAG
+// entries. RAG entries are compared as a set, so reordering is not a change.
+func DiffPersonas(a, b types.Persona) types.PersonaDiff {
+	diff := types.PersonaDiff{From: a.Id, To: b.Id}
+
+	for _, f := range []types.FieldChange{
+		{Field: "name", From: a.Name, To: b.Name},
+		{Field: "topic", From: a.Topic, To: b.Topic},
+		{Field: "prompt", From: a.Prompt, To: b.Prompt},
+	} {
+		if f.From != f.To {
+			diff.Fields = append(diff.Fields, f)
+		}
+	}
+
+	for key, from := range a.Context {
+		to, ok := b.Context[key]
+		switch {
+		case !ok:
+			if diff.ContextRemoved == nil {
+				diff.ContextRemoved = make(map[string]string)
+			}
+			diff.ContextRemoved[key] = from
+		case to != from:
+			if diff.ContextChanged == nil {
+				diff.ContextChanged = make(map[string]types.FieldChange)
+			}
+			diff.ContextChanged[key] = types.FieldChange{Field: key, From: from, To: to}
+		}
+	}
+	for key, to := range b.Context {
+		if _, ok := a.Context[key]; !ok {
+			if diff.ContextAdded == nil {
+				diff.ContextAdded = make(map[string]string)
+			}
+			diff.ContextAdded[key] = to
+		}
+	}
+
+	for _, doc := range b.Rag {
+		if !slices.Contains(a.Rag, doc) && !slices.Contains(diff.RagAdded, doc) {
+			diff.RagAdded = append(diff.RagAdded, doc)
+		}
+	}
+	for _, doc := range a.Rag {
+		if !slices.Contains(b.Rag, doc) && !slices.Contains(diff.RagRemoved, doc) {
+			diff.RagRemoved = append(diff.RagRemoved, doc)
+		}
+	}
+
+	diff.Identical = len(diff.Fields) == 0 && diff.ContextAdded == nil && diff.ContextRemoved == nil &&
+		diff.ContextChanged == nil && diff.RagAdded == nil && diff.RagRemoved == nil
+	return diff
+}
+
+// DiffPersona compares the persona id against the persona against
+func (s *Service) DiffPersona(id, against string) (types.PersonaDiff, error) {
+	a, err := s.GetPersona(id)
+	if err != nil {
+		return types.PersonaDiff{}, err
+	}
+	b, err := s.GetPersona(against)
+	if err != nil {
+		return types.PersonaDiff{}, err
+	}
+	return DiffPersonas(a, b), nil
+}
+
+// DiffPersonaVersion reports what changed in the persona id since version n
+// of its history
+func (s *Service) DiffPersonaVersion(id string, n int) (types.PersonaDiff, error) {
+	v, err := s.GetPersonaVersion(id, n)
+	if err != nil {
+		return types.PersonaDiff{}, err
+	}
+	current, err := s.GetPersona(id)
+	if err != nil {
+		return types.PersonaDiff{}, err
+	}
+	diff := DiffPersonas(v.Persona, current)
+	diff.From = fmt.Sprintf("%s@%d", id, n)
+	return diff, nil
+}
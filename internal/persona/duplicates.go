@@ -0,0 +1,77 @@
+package persona
+
+import (
+	"slices"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// DefaultDuplicateThreshold is the similarity above which identities are
+// reported as duplicates when no threshold is given
+const DefaultDuplicateThreshold = 0.9
+
+// FindDuplicateIdentities groups identities that are likely duplicates, e.g.
+// near-identical members produced by repeated community generation.
+//
+// Two identities are linked when their types.IdentitySimilarity exceeds
+// threshold, and each group holds every identity reachable through such
+// links, so members of a group need not all be that similar to each other.
+// Groups are returned with their IDs sorted, ordered by their first ID, and
+// identities without a duplicate are left out.
+//
+// Example:
+//
+//	groups, err := service.FindDuplicateIdentities(0.9)
+//	for _, ids := range groups {
+//		fmt.Printf("possible duplicates: %v\n", ids)
+//	}
+func (s *Service) FindDuplicateIdentities(threshold float64) ([][]string, error) {
+	if threshold < 0 || threshold > 1 {
+		return nil, errs.Validation("threshold must be between 0 and 1")
+	}
+
+	identities, err := s.storage.ListIdentities(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Union-find over identity indexes
+	parent := make([]int, len(identities))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range identities {
+		for j := i + 1; j < len(identities); j++ {
+			if types.IdentitySimilarity(identities[i], identities[j]) > threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	members := make(map[int][]string)
+	for i, identity := range identities {
+		root := find(i)
+		members[root] = append(members[root], identity.Id)
+	}
+
+	groups := make([][]string, 0)
+	for _, ids := range members {
+		if len(ids) > 1 {
+			slices.Sort(ids)
+			groups = append(groups, ids)
+		}
+	}
+	slices.SortFunc(groups, func(a, b []string) int {
+		return slices.Compare(a, b)
+	})
+	return groups, nil
+}
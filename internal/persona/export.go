@@ -0,0 +1,24 @@
+package persona
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// WriteIdentitiesJSONL writes the identities matching filter to w as JSON
+// Lines, one identity object per line ordered by ID. Identities are read
+// from storage one at a time, so exports of any size are never held in
+// memory.
+func (s *Service) WriteIdentitiesJSONL(w io.Writer, filter *types.IdentityFilter) error {
+	encoder := json.NewEncoder(w)
+	return storage.ForEachIdentity(s.storage, filter, func(i types.Identity) error {
+		if err := encoder.Encode(i); err != nil {
+			return fmt.Errorf("failed to write identity %s: %v", i.Id, err)
+		}
+		return nil
+	})
+}
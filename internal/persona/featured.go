@@ -0,0 +1,95 @@
+package persona
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// FeaturePersona marks a persona as featured at the given order, lower
+// orders listing first, and returns it as stored. Featuring an already
+// featured persona moves it to the new order.
+func (s *Service) FeaturePersona(id string, order int) (types.Persona, error) {
+	return s.setFeatured(id, true, order)
+}
+
+// UnfeaturePersona clears a persona's featured mark and returns it as
+// stored
+func (s *Service) UnfeaturePersona(id string) (types.Persona, error) {
+	return s.setFeatured(id, false, 0)
+}
+
+// featureAttempts bounds how often setFeatured rereads a persona that
+// changed while it was being featured
+const featureAttempts = 3
+
+// setFeatured stores a persona's featured state. This is not a content
+// edit, so it is not validated again or added to the version history. The
+// write carries the version that was read, so a concurrent update is never
+// overwritten: the persona is read again and the change retried, and
+// storage.ErrVersionConflict is returned if it keeps changing.
+func (s *Service) setFeatured(id string, featured bool, order int) (types.Persona, error) {
+	var err error
+	for attempt := 0; attempt < featureAttempts; attempt++ {
+		var p types.Persona
+		p, err = s.activePersona(id)
+		if err != nil {
+			return types.Persona{}, err
+		}
+
+		p.Featured = featured
+		p.FeatureOrder = order
+		p.UpdatedAt = time.Now()
+		err = s.storage.Update(id, p)
+		if errors.Is(err, storage.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return types.Persona{}, err
+		}
+		s.notify(types.ChangeKindPersona, types.ChangeOpUpdate, id)
+		return s.storage.Get(id)
+	}
+	return types.Persona{}, err
+}
+
+// ListFeaturedPersonas returns the featured personas in feature order
+func (s *Service) ListFeaturedPersonas() ([]types.Persona, error) {
+	personas, err := s.storage.List()
+	if err != nil {
+		return nil, err
+	}
+	featured := []types.Persona{}
+	for _, p := range personas {
+		if p.Featured {
+			featured = append(featured, p)
+		}
+	}
+	SortFeaturedFirst(featured)
+	return featured, nil
+}
+
+// SortFeaturedFirst moves featured personas to the front of personas,
+// ordered by FeatureOrder, then name, then ID. The other personas keep
+// their relative order.
+func SortFeaturedFirst(personas []types.Persona) {
+	sort.SliceStable(personas, func(i, j int) bool {
+		a, b := personas[i], personas[j]
+		if a.Featured != b.Featured {
+			return a.Featured
+		}
+		if !a.Featured {
+			return false
+		}
+		if a.FeatureOrder != b.FeatureOrder {
+			return a.FeatureOrder < b.FeatureOrder
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Id < b.Id
+	})
+}
@@ -0,0 +1,35 @@
+package persona
+
+import "github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+
+// ChangeHook is called after a persona, identity or community changes
+type ChangeHook func(event types.ChangeEvent)
+
+// RegisterHook adds a hook that is called after every successful create,
+// update or delete made through the service, e.g. to update a search index
+// or send notifications.
+//
+// Hooks run synchronously, in registration order, on the goroutine that made
+// the change, so they should return quickly and hand slow work off to a
+// goroutine of their own. Changes made directly on the storage backend, or
+// by community generation, do not fire hooks.
+func (s *Service) RegisterHook(hook ChangeHook) {
+	if hook == nil {
+		return
+	}
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// notify calls every registered hook with the given change
+func (s *Service) notify(kind types.ChangeKind, op types.ChangeOp, id string) {
+	s.hooksMu.RLock()
+	hooks := s.hooks
+	s.hooksMu.RUnlock()
+
+	event := types.ChangeEvent{Kind: kind, Op: op, ID: id}
+	for _, hook := range hooks {
+		hook(event)
+	}
+}
@@ -0,0 +1,104 @@
+package persona
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// openAIImport accepts both assistant objects and system-prompt style chat
+// payloads, e.g. {"name": "...", "messages": [{"role": "system", ...}]}.
+type openAIImport struct {
+	OpenAIAssistant
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+}
+
+// ParseOpenAIAssistants converts OpenAI assistant JSON into personas.
+//
+// The input may be a single object or an array of objects. Each object maps
+// name to Name, description to Topic (falling back to the name) and
+// instructions to Prompt. When instructions are absent, the content of the
+// system messages is used instead. The model, if any, is kept in the
+// persona's context under "model".
+func ParseOpenAIAssistants(data []byte) ([]types.Persona, error) {
+	var items []openAIImport
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, errs.Validation("failed to parse OpenAI assistants: %v", err)
+		}
+	} else {
+		var item openAIImport
+		if err := json.Unmarshal(trimmed, &item); err != nil {
+			return nil, errs.Validation("failed to parse OpenAI assistant: %v", err)
+		}
+		items = []openAIImport{item}
+	}
+
+	if len(items) == 0 {
+		return nil, errs.Validation("no assistants to import")
+	}
+
+	personas := make([]types.Persona, 0, len(items))
+	for _, item := range items {
+		prompt := item.Instructions
+		if prompt == "" {
+			var system []string
+			for _, msg := range item.Messages {
+				if msg.Role == "system" && strings.TrimSpace(msg.Content) != "" {
+					system = append(system, msg.Content)
+				}
+			}
+			prompt = strings.Join(system, "\n\n")
+		}
+
+		topic := item.Description
+		if topic == "" {
+			topic = item.Name
+		}
+
+		p := types.Persona{
+			Name:   item.Name,
+			Topic:  topic,
+			Prompt: prompt,
+		}
+		if item.Model != "" {
+			p.Context = map[string]string{"model": item.Model}
+		}
+		personas = append(personas, p)
+	}
+
+	return personas, nil
+}
+
+// CreatePersonas validates and creates a batch of personas.
+//
+// All personas are validated before any is created, so an invalid entry
+// rejects the whole batch. Returns the created personas with their IDs.
+func (s *Service) CreatePersonas(personas []types.Persona) ([]types.Persona, error) {
+	for i := range personas {
+		middleware.SanitizePersona(&personas[i])
+		if err := middleware.ValidatePersona(&personas[i]); err != nil {
+			return nil, fmt.Errorf("persona %d (%s): %w", i, personas[i].Name, err)
+		}
+	}
+
+	created := make([]types.Persona, 0, len(personas))
+	for i := range personas {
+		if err := s.CreatePersona(&personas[i]); err != nil {
+			return created, fmt.Errorf("failed to create persona %d (%s): %w", i, personas[i].Name, err)
+		}
+		created = append(created, personas[i])
+	}
+
+	return created, nil
+}
@@ -35,9 +35,16 @@
 package persona
 
 import (
+	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/generator"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
@@ -60,7 +67,12 @@ type Persona = types.Persona
 //   - Automatic timestamp management
 //   - Reference integrity checking
 type Service struct {
-	storage storage.Storage
+	storage    storage.Storage
+	backups    *storage.BackupStore
+	softDelete bool
+
+	hooksMu sync.RWMutex
+	hooks   []ChangeHook
 }
 
 // NewService creates a new persona service with the given storage backend.
@@ -118,7 +130,7 @@ func NewService(storage storage.Storage) *Service {
 //	}
 func (s *Service) CreatePersona(p *types.Persona) error {
 	if p == nil {
-		return fmt.Errorf("persona cannot be nil")
+		return errs.Validation("persona cannot be nil")
 	}
 
 	// Sanitize input
@@ -129,8 +141,26 @@ func (s *Service) CreatePersona(p *types.Persona) error {
 		return err
 	}
 
+	if p.ParentId != "" {
+		if _, err := s.activePersona(p.ParentId); err != nil {
+			return errs.NotFound("parent persona not found: %s", p.ParentId)
+		}
+	}
+
+	now := time.Now()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	p.Featured = false // Only FeaturePersona features a persona
+	p.FeatureOrder = 0
+	p.DeletedAt = nil // Only DeletePersona soft-deletes a persona
+	p.Version = 1
+
 	// Create persona
-	return s.storage.Create(p)
+	if err := s.storage.Create(p); err != nil {
+		return err
+	}
+	s.notify(types.ChangeKindPersona, types.ChangeOpCreate, p.Id)
+	return nil
 }
 
 // GetPersona retrieves a persona by ID.
@@ -150,10 +180,23 @@ func (s *Service) CreatePersona(p *types.Persona) error {
 //	}
 //	fmt.Printf("Found persona: %s (%s)", persona.Name, persona.Topic)
 func (s *Service) GetPersona(id string) (types.Persona, error) {
-	return s.storage.Get(id)
+	return s.activePersona(id)
 }
 
-// ListPersonas returns all personas.
+// activePersona returns a stored persona, treating a soft-deleted one as
+// not found
+func (s *Service) activePersona(id string) (types.Persona, error) {
+	p, err := s.storage.Get(id)
+	if err != nil {
+		return types.Persona{}, err
+	}
+	if p.DeletedAt != nil {
+		return types.Persona{}, errs.NotFound("persona not found: %s", id)
+	}
+	return p, nil
+}
+
+// ListPersonas returns all personas that are not soft-deleted.
 //
 // Returns a slice containing all stored personas. The slice will be empty
 // if no personas exist. The order of personas in the slice is not guaranteed.
@@ -176,10 +219,39 @@ func (s *Service) ListPersonas() ([]types.Persona, error) {
 	return s.storage.List()
 }
 
+// ListPersonasFiltered returns the personas matching filter. A nil filter
+// returns the same personas as ListPersonas.
+func (s *Service) ListPersonasFiltered(filter *types.PersonaFilter) ([]types.Persona, error) {
+	return s.storage.ListPersonasFiltered(filter)
+}
+
+// ListPersonasIncludingDeleted returns all personas, soft-deleted ones
+// included. Soft-deleted personas have DeletedAt set.
+func (s *Service) ListPersonasIncludingDeleted() ([]types.Persona, error) {
+	personas, err := s.storage.List()
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := s.storage.ListDeleted()
+	if err != nil {
+		return nil, err
+	}
+	return append(personas, deleted...), nil
+}
+
+// SetSoftDelete controls whether DeletePersona marks personas as deleted
+// instead of removing them. Soft-deleted personas are hidden from GetPersona
+// and ListPersonas, cannot be referenced by identities, and can be brought
+// back with RestorePersona.
+func (s *Service) SetSoftDelete(enabled bool) {
+	s.softDelete = enabled
+}
+
 // DeletePersona removes a persona by ID.
 //
-// Permanently deletes the specified persona from storage. This operation
-// cannot be undone. The persona ID must be valid and the persona must exist.
+// With soft delete enabled (see SetSoftDelete) the persona is only marked as
+// deleted. Otherwise it is permanently deleted from storage and cannot be
+// restored except from a backup. The persona must exist.
 //
 // Note: This does not automatically delete any identities that reference
 // this persona. Consider checking for dependent identities before deletion.
@@ -193,7 +265,114 @@ func (s *Service) ListPersonas() ([]types.Persona, error) {
 //		log.Printf("Failed to delete persona: %v", err)
 //	}
 func (s *Service) DeletePersona(id string) error {
-	return s.storage.Delete(id)
+	if s.softDelete {
+		if err := s.storage.SoftDelete(id); err != nil {
+			return err
+		}
+		s.notify(types.ChangeKindPersona, types.ChangeOpDelete, id)
+		return nil
+	}
+	if err := s.backupPersona(id, "delete"); err != nil {
+		return err
+	}
+	if err := s.storage.Delete(id); err != nil {
+		return err
+	}
+	s.notify(types.ChangeKindPersona, types.ChangeOpDelete, id)
+	return nil
+}
+
+// DeletePersonaCascade permanently deletes a persona together with every
+// identity that references it, and returns the number of identities removed.
+//
+// The deleted identities are also removed from the member lists of any
+// communities they belonged to, and their relationships are deleted with
+// them. Soft delete does not apply: the persona is always removed, after a
+// backup if backups are enabled.
+//
+// Example:
+//
+//	removed, err := service.DeletePersonaCascade("abc123")
+//	if err != nil {
+//		log.Printf("Failed to delete persona: %v", err)
+//	}
+//	fmt.Printf("Deleted %d identities", removed)
+func (s *Service) DeletePersonaCascade(id string) (int, error) {
+	if _, err := s.storage.Get(id); err != nil {
+		return 0, err
+	}
+
+	identities, err := s.storage.ListIdentities(&types.IdentityFilter{PersonaID: id})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list identities: %v", err)
+	}
+
+	removed := make(map[string]bool, len(identities))
+	for _, identity := range identities {
+		if err := s.storage.DeleteIdentity(identity.Id); err != nil {
+			return len(removed), fmt.Errorf("failed to delete identity %s: %w", identity.Id, err)
+		}
+		removed[identity.Id] = true
+		s.notify(types.ChangeKindIdentity, types.ChangeOpDelete, identity.Id)
+	}
+
+	if err := s.removeCommunityMembers(removed); err != nil {
+		return len(removed), err
+	}
+
+	if err := s.backupPersona(id, "delete"); err != nil {
+		return len(removed), err
+	}
+	if err := s.storage.Delete(id); err != nil {
+		return len(removed), err
+	}
+	s.notify(types.ChangeKindPersona, types.ChangeOpDelete, id)
+	return len(removed), nil
+}
+
+// removeCommunityMembers drops the given identity IDs from every community
+// that lists them as members
+func (s *Service) removeCommunityMembers(ids map[string]bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	communities, err := s.storage.ListCommunities(nil)
+	if err != nil {
+		return fmt.Errorf("failed to list communities: %v", err)
+	}
+
+	for _, c := range communities {
+		members := make([]string, 0, len(c.MemberIds))
+		for _, memberID := range c.MemberIds {
+			if !ids[memberID] {
+				members = append(members, memberID)
+			}
+		}
+		if len(members) == len(c.MemberIds) {
+			continue
+		}
+
+		c.MemberIds = members
+		c.Size = len(members)
+		c.UpdatedAt = time.Now()
+		if err := s.storage.UpdateCommunity(c.Id, c); err != nil {
+			return fmt.Errorf("failed to update community %s: %w", c.Id, err)
+		}
+		s.notify(types.ChangeKindCommunity, types.ChangeOpUpdate, c.Id)
+	}
+	return nil
+}
+
+// RestorePersona brings back a soft-deleted persona.
+//
+// Returns an error if the persona does not exist or is not deleted.
+func (s *Service) RestorePersona(id string) (types.Persona, error) {
+	if err := s.storage.Restore(id); err != nil {
+		return types.Persona{}, err
+	}
+	s.notify(types.ChangeKindPersona, types.ChangeOpUpdate, id)
+	return s.storage.Get(id)
 }
 
 // UpdatePersona updates an existing persona with validation.
@@ -205,8 +384,15 @@ func (s *Service) DeletePersona(id string) error {
 // Input data is automatically sanitized and validated using the same
 // rules as CreatePersona. The persona ID cannot be changed.
 //
+// Updates use optimistic locking: if p.Version is non-zero it must match
+// the stored version, otherwise storage.ErrVersionConflict is returned.
+// The stored version is incremented on every successful update, and the
+// state it replaces is added to the persona's version history (see
+// ListPersonaVersions).
+//
 // Returns an error if:
 //   - the persona is not found
+//   - the version does not match the stored version
 //   - validation fails
 //   - storage operation fails
 //
@@ -219,6 +405,11 @@ func (s *Service) DeletePersona(id string) error {
 //		log.Printf("Failed to update persona: %v", err)
 //	}
 func (s *Service) UpdatePersona(id string, p types.Persona) error {
+	previous, err := s.activePersona(id)
+	if err != nil {
+		return err
+	}
+
 	// Sanitize input
 	middleware.SanitizePersona(&p)
 
@@ -227,8 +418,327 @@ func (s *Service) UpdatePersona(id string, p types.Persona) error {
 		return err
 	}
 
+	if err := s.validateParent(id, p.ParentId); err != nil {
+		return err
+	}
+
+	if err := s.backupPersona(id, "update"); err != nil {
+		return err
+	}
+
+	// Update timestamps
+	p.CreatedAt = previous.CreatedAt
+	p.UpdatedAt = time.Now()
+
+	// Featuring is managed by FeaturePersona and UnfeaturePersona
+	p.Featured = previous.Featured
+	p.FeatureOrder = previous.FeatureOrder
+
 	// Update persona
-	return s.storage.Update(id, p)
+	if err := s.storage.Update(id, p); err != nil {
+		return err
+	}
+	s.notify(types.ChangeKindPersona, types.ChangeOpUpdate, id)
+
+	// Keep the replaced state in the persona's version history
+	if err := s.storage.AddPersonaVersion(previous); err != nil {
+		return fmt.Errorf("persona updated but its previous version was not recorded: %v", err)
+	}
+	return nil
+}
+
+// validateParent ensures a persona's parent exists and that linking to it
+// would not introduce an inheritance cycle.
+func (s *Service) validateParent(id, parentId string) error {
+	if parentId == "" {
+		return nil
+	}
+	if parentId == id {
+		return errs.Validation("persona cannot be its own parent")
+	}
+	if _, err := s.activePersona(parentId); err != nil {
+		return errs.NotFound("parent persona not found: %s", parentId)
+	}
+
+	chain, err := s.GetPersonaChain(parentId)
+	if err != nil {
+		return err
+	}
+	for _, ancestor := range chain {
+		if ancestor.Id == id {
+			return errs.Validation("setting parent %s would create an inheritance cycle", parentId)
+		}
+	}
+	return nil
+}
+
+// CycleError reports an inheritance cycle found while resolving a persona chain.
+type CycleError struct {
+	// Cycle lists the persona IDs forming the cycle, starting and ending
+	// with the same ID.
+	Cycle []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("persona inheritance cycle detected: %s", strings.Join(e.Cycle, " -> "))
+}
+
+// GetPersonaChain returns the inheritance chain of a persona.
+//
+// The result is ordered from the root ancestor to the requested persona,
+// following each persona's ParentId. A persona without a parent yields a
+// chain of length one.
+//
+// Returns a *CycleError if the chain loops back on itself, or an error if
+// the persona or one of its ancestors cannot be found.
+//
+// Example:
+//
+//	chain, err := service.GetPersonaChain("abc123")
+//	if err != nil {
+//		log.Printf("Failed to resolve chain: %v", err)
+//		return
+//	}
+//	for _, p := range chain {
+//		fmt.Println(p.Name)
+//	}
+func (s *Service) GetPersonaChain(id string) ([]types.Persona, error) {
+	var chain []types.Persona
+	seen := make(map[string]int)
+
+	for current := id; current != ""; {
+		if idx, ok := seen[current]; ok {
+			cycle := make([]string, 0, len(chain)-idx+1)
+			for _, p := range chain[idx:] {
+				cycle = append(cycle, p.Id)
+			}
+			return nil, &CycleError{Cycle: append(cycle, current)}
+		}
+
+		p, err := s.storage.Get(current)
+		if err != nil {
+			if current == id {
+				return nil, err
+			}
+			return nil, errs.NotFound("ancestor persona not found: %s", current)
+		}
+
+		seen[current] = len(chain)
+		chain = append(chain, p)
+		current = p.ParentId
+	}
+
+	// Reverse so the chain runs from root to the requested persona
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// cloneNameSuffix is appended to the names of cloned personas
+const cloneNameSuffix = " (copy)"
+
+// maxPersonaNameLength mirrors the name limit enforced by ValidatePersona
+const maxPersonaNameLength = 100
+
+// ClonePersona copies a persona under a new ID.
+//
+// The copy gets " (copy)" appended to its name, starts at version zero and
+// shares no maps or slices with the original, so later edits to either
+// persona never affect the other. The parent, if any, is kept.
+//
+// Returns the stored copy, or an error if the persona is not found or is
+// soft-deleted.
+//
+// Example:
+//
+//	clone, err := service.ClonePersona("abc123")
+//	if err != nil {
+//		log.Printf("Failed to clone persona: %v", err)
+//	}
+func (s *Service) ClonePersona(id string) (types.Persona, error) {
+	original, err := s.activePersona(id)
+	if err != nil {
+		return types.Persona{}, err
+	}
+
+	clone := CopyPersona(original)
+	if err := s.CreatePersona(&clone); err != nil {
+		return types.Persona{}, fmt.Errorf("failed to clone persona: %w", err)
+	}
+	return clone, nil
+}
+
+// CopyPersona returns a deep copy of p ready to be created as a new persona:
+// the ID, version and timestamps are cleared and the name is suffixed with
+// " (copy)", truncating the original name if needed to stay within limits.
+func CopyPersona(p types.Persona) types.Persona {
+	clone := p
+	clone.Id = ""
+	clone.Version = 0
+	clone.CreatedAt = time.Time{}
+	clone.UpdatedAt = time.Time{}
+	clone.DeletedAt = nil
+
+	name := strings.TrimSpace(p.Name)
+	for len(name) > maxPersonaNameLength-len(cloneNameSuffix) {
+		// Drop whole runes so multi-byte names stay valid UTF-8
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	clone.Name = strings.TrimSpace(name) + cloneNameSuffix
+
+	if p.Context != nil {
+		clone.Context = make(map[string]string, len(p.Context))
+		for k, v := range p.Context {
+			clone.Context[k] = v
+		}
+	}
+	if p.Rag != nil {
+		clone.Rag = append([]string(nil), p.Rag...)
+	}
+	if p.RagDocuments != nil {
+		clone.RagDocuments = make([]types.RAGDocument, len(p.RagDocuments))
+		for i, doc := range p.RagDocuments {
+			doc.Embedding = slices.Clone(doc.Embedding)
+			clone.RagDocuments[i] = doc
+		}
+	}
+	if p.Tags != nil {
+		clone.Tags = append([]string(nil), p.Tags...)
+	}
+	return clone
+}
+
+// SetBackupStore enables automatic persona backups.
+//
+// When set, the current state of a persona is snapshotted into the backup
+// store before every UpdatePersona and DeletePersona. Pass nil to disable.
+func (s *Service) SetBackupStore(backups *storage.BackupStore) {
+	s.backups = backups
+}
+
+// backupPersona snapshots the stored persona before a write, if enabled
+func (s *Service) backupPersona(id, reason string) error {
+	if s.backups == nil {
+		return nil
+	}
+
+	existing, err := s.storage.Get(id)
+	if err != nil {
+		// Nothing to back up; the write itself will report the missing persona
+		return nil
+	}
+
+	if _, err := s.backups.Save(existing, reason); err != nil {
+		return fmt.Errorf("failed to back up persona: %v", err)
+	}
+	return nil
+}
+
+// ListPersonaBackups returns the backups of a persona, newest first.
+//
+// Returns an error if backups are not enabled.
+func (s *Service) ListPersonaBackups(id string) ([]storage.PersonaBackup, error) {
+	if s.backups == nil {
+		return nil, fmt.Errorf("persona backups are not enabled")
+	}
+	return s.backups.List(id)
+}
+
+// RestorePersonaBackup restores a persona to the state captured in a backup.
+//
+// If the persona still exists it is updated in place (which itself creates
+// a new backup of the state being replaced). If it was deleted, it is
+// recreated from the backup and receives a new ID.
+//
+// Example:
+//
+//	restored, err := service.RestorePersonaBackup("abc123", backupID)
+//	if err != nil {
+//		log.Printf("Failed to restore persona: %v", err)
+//	}
+func (s *Service) RestorePersonaBackup(id, backupID string) (types.Persona, error) {
+	if s.backups == nil {
+		return types.Persona{}, fmt.Errorf("persona backups are not enabled")
+	}
+
+	backup, err := s.backups.Get(id, backupID)
+	if err != nil {
+		return types.Persona{}, err
+	}
+
+	p := backup.Persona
+	p.Version = 0 // Restores always overwrite the current version
+	if _, err := s.storage.Get(id); err != nil {
+		p.Id = ""
+		if err := s.CreatePersona(&p); err != nil {
+			return types.Persona{}, fmt.Errorf("failed to recreate persona: %w", err)
+		}
+		return p, nil
+	}
+
+	if err := s.UpdatePersona(id, p); err != nil {
+		return types.Persona{}, fmt.Errorf("failed to restore persona: %w", err)
+	}
+	return s.storage.Get(id)
+}
+
+// ListPersonaVersions returns the past states of a persona, oldest first.
+// A version is recorded each time the persona is updated, so a persona that
+// was never updated has an empty history.
+//
+// Example:
+//
+//	versions, err := service.ListPersonaVersions("abc123")
+//	if err != nil {
+//		log.Printf("Failed to list versions: %v", err)
+//	}
+func (s *Service) ListPersonaVersions(id string) ([]types.PersonaVersion, error) {
+	if _, err := s.activePersona(id); err != nil {
+		return nil, err
+	}
+	return s.storage.ListPersonaVersions(id)
+}
+
+// GetPersonaVersion returns version n of a persona's history, where 1 is the
+// oldest recorded state.
+func (s *Service) GetPersonaVersion(id string, n int) (types.PersonaVersion, error) {
+	versions, err := s.ListPersonaVersions(id)
+	if err != nil {
+		return types.PersonaVersion{}, err
+	}
+	if n < 1 || n > len(versions) {
+		return types.PersonaVersion{}, errs.NotFound("persona version not found: %s version %d", id, n)
+	}
+	return versions[n-1], nil
+}
+
+// IdentityConsistencyWarnings reports attributes of an identity that
+// conflict with its persona's topic, e.g. a plumber identity for a healthcare
+// persona. Returns nil if the persona cannot be found.
+func (s *Service) IdentityConsistencyWarnings(i types.Identity) []string {
+	p, err := s.storage.Get(i.PersonaId)
+	if err != nil {
+		return nil
+	}
+	return generator.PersonaConsistencyWarnings(i, p)
+}
+
+// RebuildIndexes recomputes the storage backend's secondary indexes from its
+// primary data. Backends without secondary indexes, such as memory storage,
+// report nothing to fix.
+func (s *Service) RebuildIndexes() (storage.IndexReport, error) {
+	indexer, ok := storage.As[storage.Indexer](s.storage)
+	if !ok {
+		return storage.IndexReport{}, nil
+	}
+
+	report, err := indexer.RebuildIndexes()
+	if err != nil {
+		return storage.IndexReport{}, fmt.Errorf("failed to rebuild indexes: %v", err)
+	}
+	return report, nil
 }
 
 // GetStorage returns the underlying storage interface
@@ -273,13 +783,41 @@ func (s *Service) GetStorage() storage.Storage {
 //	}
 //	err := service.CreateIdentity(identity)
 func (s *Service) CreateIdentity(i *types.Identity) error {
+	return s.createIdentity(i)
+}
+
+// CreateIdentities creates a batch of identities, validating each one.
+//
+// Every identity gets its own result, so an invalid identity is reported
+// without dropping the rest of the batch. The storage backends have no
+// transactions, so successfully created identities are kept even when others
+// in the batch fail.
+func (s *Service) CreateIdentities(identities []*types.Identity) []types.IdentityBatchResult {
+	results := make([]types.IdentityBatchResult, len(identities))
+	for idx, i := range identities {
+		results[idx].Index = idx
+		if err := s.createIdentity(i); err != nil {
+			results[idx].Error = err.Error()
+			continue
+		}
+		results[idx].Id = i.Id
+	}
+	return results
+}
+
+func (s *Service) createIdentity(i *types.Identity) error {
 	if i == nil {
-		return fmt.Errorf("identity cannot be nil")
+		return errs.Validation("identity cannot be nil")
+	}
+
+	// Sanitize and validate input
+	middleware.SanitizeIdentity(i)
+	if err := middleware.ValidateIdentity(i); err != nil {
+		return err
 	}
 
-	// Validate that the referenced persona exists
-	if _, err := s.storage.Get(i.PersonaId); err != nil {
-		return fmt.Errorf("referenced persona not found: %v", err)
+	if err := s.checkIdentityPersona(i.PersonaId); err != nil {
+		return err
 	}
 
 	// Set timestamps
@@ -294,12 +832,26 @@ func (s *Service) CreateIdentity(i *types.Identity) error {
 	if i.Tags == nil {
 		i.Tags = []string{}
 	}
-	if !i.IsActive {
-		i.IsActive = true // Default to active
-	}
 
 	// Create identity
-	return s.storage.CreateIdentity(i)
+	if err := s.storage.CreateIdentity(i); err != nil {
+		return err
+	}
+	s.notify(types.ChangeKindIdentity, types.ChangeOpCreate, i.Id)
+	return nil
+}
+
+// checkIdentityPersona verifies that an identity's persona exists and has
+// not been soft-deleted
+func (s *Service) checkIdentityPersona(personaID string) error {
+	p, err := s.storage.Get(personaID)
+	if err != nil {
+		return errs.NotFound("referenced persona not found: %v", err)
+	}
+	if p.DeletedAt != nil {
+		return fmt.Errorf("%w: %s", storage.ErrPersonaDeleted, personaID)
+	}
+	return nil
 }
 
 // GetIdentity retrieves an identity by ID
@@ -312,23 +864,207 @@ func (s *Service) ListIdentities(filter *types.IdentityFilter) ([]types.Identity
 	return s.storage.ListIdentities(filter)
 }
 
+// ListIdentitiesByPersona returns the identities derived from a persona.
+// Returns a not-found error if the persona does not exist or is
+// soft-deleted.
+func (s *Service) ListIdentitiesByPersona(personaID string) ([]types.Identity, error) {
+	if _, err := s.activePersona(personaID); err != nil {
+		return nil, err
+	}
+	identities, err := s.storage.ListIdentities(&types.IdentityFilter{PersonaID: personaID})
+	if err != nil {
+		return nil, err
+	}
+	if identities == nil {
+		identities = []types.Identity{}
+	}
+	return identities, nil
+}
+
 // UpdateIdentity updates an existing identity with validation
 func (s *Service) UpdateIdentity(id string, i types.Identity) error {
-	// Validate that the referenced persona exists
-	if _, err := s.storage.Get(i.PersonaId); err != nil {
-		return fmt.Errorf("referenced persona not found: %v", err)
+	// Sanitize and validate input
+	middleware.SanitizeIdentity(&i)
+	if err := middleware.ValidateIdentity(&i); err != nil {
+		return err
+	}
+
+	if err := s.checkIdentityPersona(i.PersonaId); err != nil {
+		return err
 	}
 
 	// Update timestamp
 	i.UpdatedAt = time.Now()
 
 	// Update identity
-	return s.storage.UpdateIdentity(id, i)
+	if err := s.storage.UpdateIdentity(id, i); err != nil {
+		return err
+	}
+	s.notify(types.ChangeKindIdentity, types.ChangeOpUpdate, id)
+	return nil
+}
+
+// modifyIdentity applies change to an identity through the storage's
+// ModifyIdentity, so changes made to other fields in the meantime are not
+// lost, and returns the identity as stored. The result is validated like a
+// full update. change may be called more than once.
+func (s *Service) modifyIdentity(id string, change func(i *types.Identity) error) (types.Identity, error) {
+	current, err := s.storage.GetIdentity(id)
+	if err != nil {
+		return types.Identity{}, err
+	}
+	// The persona cannot change, so it is checked before storage runs change
+	// under its lock
+	if err := s.checkIdentityPersona(current.PersonaId); err != nil {
+		return types.Identity{}, err
+	}
+
+	i, err := s.storage.ModifyIdentity(id, func(i *types.Identity) (bool, error) {
+		if err := change(i); err != nil {
+			return false, err
+		}
+		middleware.SanitizeIdentity(i)
+		return true, middleware.ValidateIdentity(i)
+	})
+	if err != nil {
+		return types.Identity{}, err
+	}
+	s.notify(types.ChangeKindIdentity, types.ChangeOpUpdate, id)
+	return i, nil
+}
+
+// UpdateIdentityAttributes replaces an identity's rich attributes, leaving
+// every other field as it is, and returns the updated identity. Nil attrs
+// clears them. The result is validated like a full update.
+func (s *Service) UpdateIdentityAttributes(id string, attrs *types.RichAttributes) (types.Identity, error) {
+	return s.modifyIdentity(id, func(i *types.Identity) error {
+		i.RichAttributes = attrs
+		return nil
+	})
+}
+
+// patchableIdentityFields are the identity fields PatchIdentity may change
+var patchableIdentityFields = map[string]bool{
+	"name":            true,
+	"description":     true,
+	"background":      true,
+	"tags":            true,
+	"is_active":       true,
+	"rich_attributes": true,
+}
+
+// PatchIdentity merges a partial update into an identity.
+//
+// The patch uses the identity's JSON field names. Only name, description,
+// background, tags, is_active and rich_attributes may be set; fields not in
+// the patch are left untouched. Within rich_attributes each sub-struct, such
+// as demographics, is replaced as a whole and a null value clears it, while
+// sub-structs missing from the patch are kept.
+//
+// The merged identity is validated like a full update. Like
+// AddIdentityTag, the patch is applied to the stored identity atomically,
+// so concurrent changes to other fields are kept.
+func (s *Service) PatchIdentity(id string, patch map[string]interface{}) error {
+	_, err := s.modifyIdentity(id, func(i *types.Identity) error {
+		patched, err := applyIdentityPatch(*i, patch)
+		if err != nil {
+			return err
+		}
+		*i = patched
+		return nil
+	})
+	return err
+}
+
+// applyIdentityPatch returns current with patch merged in
+func applyIdentityPatch(current types.Identity, patch map[string]interface{}) (types.Identity, error) {
+	fields, err := toRawFields(current)
+	if err != nil {
+		return types.Identity{}, err
+	}
+
+	for field, value := range patch {
+		if !patchableIdentityFields[field] {
+			return types.Identity{}, errs.Validation("field %s cannot be patched", field)
+		}
+
+		if field == "rich_attributes" && value != nil {
+			merged, err := mergeRichAttributes(current.RichAttributes, value)
+			if err != nil {
+				return types.Identity{}, err
+			}
+			fields[field] = merged
+			continue
+		}
+
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return types.Identity{}, errs.Validation("invalid value for %s: %v", field, err)
+		}
+		fields[field] = raw
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return types.Identity{}, errs.Validation("failed to apply patch: %v", err)
+	}
+	var patched types.Identity
+	if err := json.Unmarshal(data, &patched); err != nil {
+		return types.Identity{}, errs.Validation("invalid patch: %v", err)
+	}
+	return patched, nil
+}
+
+// mergeRichAttributes overlays the sub-structs in patch onto current
+func mergeRichAttributes(current *types.RichAttributes, patch interface{}) (json.RawMessage, error) {
+	updates, ok := patch.(map[string]interface{})
+	if !ok {
+		return nil, errs.Validation("rich_attributes must be an object")
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if current != nil {
+		var err error
+		if fields, err = toRawFields(current); err != nil {
+			return nil, err
+		}
+	}
+
+	for field, value := range updates {
+		if value == nil {
+			delete(fields, field)
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, errs.Validation("invalid value for rich_attributes.%s: %v", field, err)
+		}
+		fields[field] = raw
+	}
+
+	return json.Marshal(fields)
+}
+
+// toRawFields splits a value's JSON encoding into its top-level fields
+func toRawFields(v interface{}) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %T: %v", v, err)
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode %T: %v", v, err)
+	}
+	return fields, nil
 }
 
 // DeleteIdentity removes an identity by ID
 func (s *Service) DeleteIdentity(id string) error {
-	return s.storage.DeleteIdentity(id)
+	if err := s.storage.DeleteIdentity(id); err != nil {
+		return err
+	}
+	s.notify(types.ChangeKindIdentity, types.ChangeOpDelete, id)
+	return nil
 }
 
 // GetIdentityWithPersona retrieves an identity with its associated persona
@@ -346,14 +1082,50 @@ func (s *Service) ListCommunities(filter *types.CommunityFilter) ([]types.Commun
 	return s.storage.ListCommunities(filter)
 }
 
-// UpdateCommunity updates an existing community
+// UpdateCommunity updates an existing community with validation
 func (s *Service) UpdateCommunity(id string, community types.Community) error {
-	return s.storage.UpdateCommunity(id, community)
+	// Sanitize and validate input
+	middleware.SanitizeCommunity(&community)
+	if err := middleware.ValidateCommunity(&community); err != nil {
+		return err
+	}
+
+	if err := s.storage.UpdateCommunity(id, community); err != nil {
+		return err
+	}
+	s.notify(types.ChangeKindCommunity, types.ChangeOpUpdate, id)
+	return nil
 }
 
 // DeleteCommunity removes a community
 func (s *Service) DeleteCommunity(id string) error {
-	return s.storage.DeleteCommunity(id)
+	if err := s.storage.DeleteCommunity(id); err != nil {
+		return err
+	}
+	s.notify(types.ChangeKindCommunity, types.ChangeOpDelete, id)
+	return nil
+}
+
+// CreateRelationship links two existing identities
+func (s *Service) CreateRelationship(r *types.Relationship) error {
+	if r != nil {
+		r.Type = strings.TrimSpace(r.Type)
+	}
+	return s.storage.CreateRelationship(r)
+}
+
+// ListRelationships returns the relationships an identity is part of, in
+// either direction
+func (s *Service) ListRelationships(identityID string) ([]types.Relationship, error) {
+	if _, err := s.storage.GetIdentity(identityID); err != nil {
+		return nil, err
+	}
+	return s.storage.ListRelationships(identityID)
+}
+
+// DeleteRelationship removes a relationship by ID
+func (s *Service) DeleteRelationship(id string) error {
+	return s.storage.DeleteRelationship(id)
 }
 
 // Global service instance for backward compatibility
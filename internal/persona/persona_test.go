@@ -1,9 +1,17 @@
 package persona
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
 )
@@ -27,6 +35,30 @@ func TestServiceCreatePersona(t *testing.T) {
 	}
 }
 
+func TestServiceCreatePersonaIgnoresDeletedAt(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	deletedAt := time.Now()
+	p := types.Persona{
+		Name:      "Revenant",
+		Topic:     "Testing",
+		Prompt:    "You were never deleted.",
+		DeletedAt: &deletedAt,
+		Version:   7,
+	}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	got, err := service.GetPersona(p.Id)
+	if err != nil {
+		t.Fatalf("Expected the new persona to be visible, got %v", err)
+	}
+	if got.DeletedAt != nil || got.Version != 1 {
+		t.Errorf("Expected no deleted_at and version 1, got %v and %d", got.DeletedAt, got.Version)
+	}
+}
+
 func TestServiceGetPersona(t *testing.T) {
 	service := NewService(storage.NewMemoryStorage())
 
@@ -99,6 +131,130 @@ func TestServiceDeletePersona(t *testing.T) {
 	}
 }
 
+func TestServiceSoftDeletePersona(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+	service.SetSoftDelete(true)
+
+	p := types.Persona{Name: "Soft Delete Expert", Topic: "Deleting", Prompt: "You are a deleting expert."}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	identity := &types.Identity{PersonaId: p.Id, Name: "Existing Member"}
+	if err := service.CreateIdentity(identity); err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+
+	if err := service.DeletePersona(p.Id); err != nil {
+		t.Fatalf("Failed to delete persona: %v", err)
+	}
+	if _, err := service.GetPersona(p.Id); err == nil {
+		t.Error("Expected error getting a soft-deleted persona")
+	}
+	if list, _ := service.ListPersonas(); len(list) != 0 {
+		t.Errorf("Expected soft-deleted persona to be hidden, got %d personas", len(list))
+	}
+	if list, _ := service.ListPersonasIncludingDeleted(); len(list) != 1 || list[0].DeletedAt == nil {
+		t.Errorf("Expected the deleted persona when including deleted, got %+v", list)
+	}
+	if err := service.UpdatePersona(p.Id, p); err == nil {
+		t.Error("Expected error updating a soft-deleted persona")
+	}
+
+	// Orphan guard
+	err := service.CreateIdentity(&types.Identity{PersonaId: p.Id, Name: "New Member"})
+	if err == nil || !strings.Contains(err.Error(), "deleted") {
+		t.Errorf("Expected deleted persona error creating identity, got %v", err)
+	}
+	identity.Name = "Renamed Member"
+	if err := service.UpdateIdentity(identity.Id, *identity); err == nil {
+		t.Error("Expected error updating an identity of a soft-deleted persona")
+	}
+	child := types.Persona{Name: "Child", Topic: "Deleting", Prompt: "Child prompt.", ParentId: p.Id}
+	if err := service.CreatePersona(&child); err == nil {
+		t.Error("Expected error inheriting from a soft-deleted persona")
+	}
+
+	restored, err := service.RestorePersona(p.Id)
+	if err != nil {
+		t.Fatalf("RestorePersona failed: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.Name != p.Name {
+		t.Errorf("Expected restored persona, got %+v", restored)
+	}
+	if _, err := service.GetPersona(p.Id); err != nil {
+		t.Errorf("Expected restored persona to be visible: %v", err)
+	}
+	if err := service.UpdateIdentity(identity.Id, *identity); err != nil {
+		t.Errorf("Expected identity update after restore to succeed: %v", err)
+	}
+	if _, err := service.RestorePersona(p.Id); err == nil {
+		t.Error("Expected error restoring a persona that is not deleted")
+	}
+}
+
+func TestServiceDeletePersonaCascade(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	service := NewService(store)
+
+	doomed := types.Persona{Name: "Doomed", Topic: "Deleting", Prompt: "You are doomed."}
+	kept := types.Persona{Name: "Kept", Topic: "Keeping", Prompt: "You are kept."}
+	for _, p := range []*types.Persona{&doomed, &kept} {
+		if err := service.CreatePersona(p); err != nil {
+			t.Fatalf("Failed to create persona: %v", err)
+		}
+	}
+
+	var doomedIDs []string
+	for n := range 3 {
+		identity := &types.Identity{PersonaId: doomed.Id, Name: fmt.Sprintf("Doomed %d", n)}
+		if err := service.CreateIdentity(identity); err != nil {
+			t.Fatalf("Failed to create identity: %v", err)
+		}
+		doomedIDs = append(doomedIDs, identity.Id)
+	}
+	survivor := &types.Identity{PersonaId: kept.Id, Name: "Survivor"}
+	if err := service.CreateIdentity(survivor); err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+
+	c := &types.Community{
+		Name:      "Mixed",
+		Type:      "interest",
+		MemberIds: []string{doomedIDs[0], survivor.Id, doomedIDs[1]},
+		Size:      3,
+	}
+	if err := store.CreateCommunity(c); err != nil {
+		t.Fatalf("Failed to create community: %v", err)
+	}
+
+	removed, err := service.DeletePersonaCascade(doomed.Id)
+	if err != nil {
+		t.Fatalf("DeletePersonaCascade failed: %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("Expected 3 identities removed, got %d", removed)
+	}
+	if _, err := store.Get(doomed.Id); err == nil {
+		t.Error("Expected persona to be deleted")
+	}
+	remaining, _ := service.ListIdentities(nil)
+	if len(remaining) != 1 || remaining[0].Id != survivor.Id {
+		t.Errorf("Expected only the survivor to remain, got %+v", remaining)
+	}
+
+	updated, err := store.GetCommunity(c.Id)
+	if err != nil {
+		t.Fatalf("Failed to get community: %v", err)
+	}
+	if len(updated.MemberIds) != 1 || updated.MemberIds[0] != survivor.Id || updated.Size != 1 {
+		t.Errorf("Expected community to keep only the survivor, got members %v size %d", updated.MemberIds, updated.Size)
+	}
+
+	if _, err := service.DeletePersonaCascade(doomed.Id); err == nil {
+		t.Error("Expected error cascading a missing persona")
+	}
+}
+
 func TestServiceUpdatePersona(t *testing.T) {
 	service := NewService(storage.NewMemoryStorage())
 
@@ -186,6 +342,95 @@ func TestServiceErrorHandling(t *testing.T) {
 	}
 }
 
+func TestServiceErrorKinds(t *testing.T) {
+	fileStorage, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+
+	for name, store := range map[string]storage.Storage{
+		"memory": storage.NewMemoryStorage(),
+		"file":   fileStorage,
+	} {
+		t.Run(name, func(t *testing.T) {
+			service := NewService(store)
+
+			if _, err := service.GetPersona("nonexistent"); !errors.Is(err, errs.ErrNotFound) {
+				t.Errorf("Expected ErrNotFound for a missing persona, got %v", err)
+			}
+			if err := service.DeletePersona("nonexistent"); !errors.Is(err, errs.ErrNotFound) {
+				t.Errorf("Expected ErrNotFound deleting a missing persona, got %v", err)
+			}
+			if err := service.CreatePersona(&types.Persona{Name: "No Topic"}); !errors.Is(err, errs.ErrValidation) {
+				t.Errorf("Expected ErrValidation for an invalid persona, got %v", err)
+			}
+
+			p := &types.Persona{Name: "Test", Topic: "Test", Prompt: "Test"}
+			if err := service.CreatePersona(p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			stale := *p
+			stale.Version = p.Version + 1
+			if err := service.UpdatePersona(p.Id, stale); !errors.Is(err, errs.ErrConflict) || !errors.Is(err, storage.ErrVersionConflict) {
+				t.Errorf("Expected a version conflict, got %v", err)
+			}
+
+			if err := store.SoftDelete(p.Id); err != nil {
+				t.Fatalf("Failed to soft-delete persona: %v", err)
+			}
+			if _, err := service.GetPersona(p.Id); !errors.Is(err, errs.ErrNotFound) {
+				t.Errorf("Expected ErrNotFound for a soft-deleted persona, got %v", err)
+			}
+		})
+	}
+}
+
+func TestServicePersonaTimestamps(t *testing.T) {
+	fileStorage, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+
+	for name, store := range map[string]storage.Storage{
+		"memory": storage.NewMemoryStorage(),
+		"file":   fileStorage,
+	} {
+		t.Run(name, func(t *testing.T) {
+			service := NewService(store)
+
+			p := &types.Persona{Name: "Test", Topic: "Test", Prompt: "Test"}
+			if err := service.CreatePersona(p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			created, err := service.GetPersona(p.Id)
+			if err != nil {
+				t.Fatalf("Failed to get persona: %v", err)
+			}
+			if created.CreatedAt.IsZero() || !created.UpdatedAt.Equal(created.CreatedAt) {
+				t.Fatalf("Expected matching creation timestamps, got %v and %v", created.CreatedAt, created.UpdatedAt)
+			}
+
+			time.Sleep(time.Millisecond)
+			update := created
+			update.Prompt = "Updated"
+			update.CreatedAt = time.Time{}
+			if err := service.UpdatePersona(p.Id, update); err != nil {
+				t.Fatalf("Failed to update persona: %v", err)
+			}
+			updated, err := service.GetPersona(p.Id)
+			if err != nil {
+				t.Fatalf("Failed to get persona: %v", err)
+			}
+			if !updated.CreatedAt.Equal(created.CreatedAt) {
+				t.Errorf("Expected CreatedAt to stay %v, got %v", created.CreatedAt, updated.CreatedAt)
+			}
+			if !updated.UpdatedAt.After(created.UpdatedAt) {
+				t.Errorf("Expected UpdatedAt to advance past %v, got %v", created.UpdatedAt, updated.UpdatedAt)
+			}
+		})
+	}
+}
+
 
 func TestServiceWithComplexPersona(t *testing.T) {
 	service := NewService(storage.NewMemoryStorage())
@@ -392,6 +637,30 @@ func (e *errorStorage) Delete(id string) error {
 	return fmt.Errorf("mock delete error")
 }
 
+func (e *errorStorage) ListDeleted() ([]types.Persona, error) {
+	return nil, fmt.Errorf("mock list deleted error")
+}
+
+func (e *errorStorage) ListPersonasFiltered(filter *types.PersonaFilter) ([]types.Persona, error) {
+	return nil, fmt.Errorf("mock list filtered error")
+}
+
+func (e *errorStorage) AddPersonaVersion(p types.Persona) error {
+	return fmt.Errorf("mock add persona version error")
+}
+
+func (e *errorStorage) ListPersonaVersions(id string) ([]types.PersonaVersion, error) {
+	return nil, fmt.Errorf("mock list persona versions error")
+}
+
+func (e *errorStorage) SoftDelete(id string) error {
+	return fmt.Errorf("mock soft delete error")
+}
+
+func (e *errorStorage) Restore(id string) error {
+	return fmt.Errorf("mock restore error")
+}
+
 // Identity methods for errorStorage mock
 func (e *errorStorage) CreateIdentity(i *types.Identity) error {
 	return fmt.Errorf("mock create identity error")
@@ -413,6 +682,10 @@ func (e *errorStorage) DeleteIdentity(id string) error {
 	return fmt.Errorf("mock delete identity error")
 }
 
+func (e *errorStorage) ModifyIdentity(id string, modify func(i *types.Identity) (bool, error)) (types.Identity, error) {
+	return types.Identity{}, fmt.Errorf("mock modify identity error")
+}
+
 func (e *errorStorage) GetIdentityWithPersona(id string) (types.IdentityWithPersona, error) {
 	return types.IdentityWithPersona{}, fmt.Errorf("mock get identity with persona error")
 }
@@ -438,6 +711,19 @@ func (e *errorStorage) DeleteCommunity(id string) error {
 	return fmt.Errorf("mock delete community error")
 }
 
+// Relationship methods for errorStorage mock
+func (e *errorStorage) CreateRelationship(r *types.Relationship) error {
+	return fmt.Errorf("mock create relationship error")
+}
+
+func (e *errorStorage) ListRelationships(identityID string) ([]types.Relationship, error) {
+	return nil, fmt.Errorf("mock list relationships error")
+}
+
+func (e *errorStorage) DeleteRelationship(id string) error {
+	return fmt.Errorf("mock delete relationship error")
+}
+
 func TestServiceNewService(t *testing.T) {
 	memStorage := storage.NewMemoryStorage()
 	service := NewService(memStorage)
@@ -464,6 +750,82 @@ func TestServiceNewService(t *testing.T) {
 	}
 }
 
+func TestServiceClonePersona(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	original := types.Persona{
+		Name:    "Go Expert",
+		Topic:   "Golang",
+		Prompt:  "You are a Go expert.",
+		Context: map[string]string{"level": "senior"},
+		Rag:     []string{"effective-go"},
+		Tags:    []string{"go"},
+	}
+	if err := service.CreatePersona(&original); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	clone, err := service.ClonePersona(original.Id)
+	if err != nil {
+		t.Fatalf("ClonePersona failed: %v", err)
+	}
+	if clone.Id == "" || clone.Id == original.Id {
+		t.Errorf("Expected a new ID, got %q", clone.Id)
+	}
+	if clone.Name != "Go Expert (copy)" {
+		t.Errorf("Expected name 'Go Expert (copy)', got %q", clone.Name)
+	}
+	if clone.Prompt != original.Prompt || clone.Context["level"] != "senior" || len(clone.Rag) != 1 {
+		t.Errorf("Expected clone to copy the persona, got %+v", clone)
+	}
+
+	// Mutating the clone must not leak into the original
+	clone.Context["level"] = "junior"
+	clone.Rag[0] = "changed"
+	stored, err := service.GetPersona(original.Id)
+	if err != nil {
+		t.Fatalf("Failed to get original: %v", err)
+	}
+	if stored.Context["level"] != "senior" || stored.Rag[0] != "effective-go" {
+		t.Errorf("Original persona was modified through the clone: %+v", stored)
+	}
+
+	if _, err := service.ClonePersona("non-existent-id"); err == nil {
+		t.Error("Expected error cloning a missing persona")
+	}
+}
+
+func TestServiceClonePersonaSoftDeleted(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+	service.SetSoftDelete(true)
+
+	p := types.Persona{Name: "Gone", Topic: "Deleting", Prompt: "You are gone."}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	if err := service.DeletePersona(p.Id); err != nil {
+		t.Fatalf("Failed to delete persona: %v", err)
+	}
+
+	if _, err := service.ClonePersona(p.Id); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound cloning a soft-deleted persona, got %v", err)
+	}
+	if list, _ := service.ListPersonas(); len(list) != 0 {
+		t.Errorf("Expected no clone to be created, got %+v", list)
+	}
+}
+
+func TestCopyPersona_LongName(t *testing.T) {
+	p := types.Persona{Name: strings.Repeat("é", 50)} // 100 bytes
+	clone := CopyPersona(p)
+	if len(clone.Name) > 100 {
+		t.Errorf("Expected name within 100 bytes, got %d", len(clone.Name))
+	}
+	if !strings.HasSuffix(clone.Name, " (copy)") || !utf8.ValidString(clone.Name) {
+		t.Errorf("Expected valid name ending in ' (copy)', got %q", clone.Name)
+	}
+}
+
 // Test identity functionality
 func TestServiceCreateIdentity(t *testing.T) {
 	service := NewService(storage.NewMemoryStorage())
@@ -510,6 +872,47 @@ func TestServiceCreateIdentity(t *testing.T) {
 	}
 }
 
+func TestServiceCreateIdentitySanitizesText(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	p := types.Persona{Name: "Test Persona", Topic: "Test Topic", Prompt: "Test prompt"}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	i := types.Identity{
+		PersonaId:   p.Id,
+		Name:        "  \tJane\x00  \x1b[31mDoe\n ",
+		Description: " First   line \r\nSecond\x07 line ",
+		Background:  "\x00Grew up\t\tby the sea. ",
+	}
+	if err := service.CreateIdentity(&i); err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+
+	stored, err := service.GetIdentity(i.Id)
+	if err != nil {
+		t.Fatalf("Failed to get identity: %v", err)
+	}
+	if stored.Name != "Jane [31mDoe" {
+		t.Errorf("Expected whitespace and control characters stripped from the name, got %q", stored.Name)
+	}
+	if stored.Description != "First line\nSecond line" {
+		t.Errorf("Expected the description's line break to be kept, got %q", stored.Description)
+	}
+	if stored.Background != "Grew up by the sea." {
+		t.Errorf("Expected a sanitized background, got %q", stored.Background)
+	}
+
+	stored.Name = " Jane\x00 Smith "
+	if err := service.UpdateIdentity(i.Id, stored); err != nil {
+		t.Fatalf("Failed to update identity: %v", err)
+	}
+	if updated, _ := service.GetIdentity(i.Id); updated.Name != "Jane Smith" {
+		t.Errorf("Expected the name to be sanitized on update, got %q", updated.Name)
+	}
+}
+
 func TestServiceCreateIdentityWithInvalidPersona(t *testing.T) {
 	service := NewService(storage.NewMemoryStorage())
 
@@ -525,117 +928,226 @@ func TestServiceCreateIdentityWithInvalidPersona(t *testing.T) {
 	}
 }
 
-func TestServiceListIdentities(t *testing.T) {
+func TestServiceCreateIdentities(t *testing.T) {
 	service := NewService(storage.NewMemoryStorage())
 
-	// Create a persona
 	p := types.Persona{
 		Name:   "Test Persona",
 		Topic:  "Test Topic",
 		Prompt: "Test prompt",
 	}
-	err := service.CreatePersona(&p)
-	if err != nil {
+	if err := service.CreatePersona(&p); err != nil {
 		t.Fatalf("Failed to create persona: %v", err)
 	}
 
-	// Create multiple identities
-	identities := []types.Identity{
-		{PersonaId: p.Id, Name: "Identity 1", Tags: []string{"tag1"}},
-		{PersonaId: p.Id, Name: "Identity 2", Tags: []string{"tag2"}},
-		{PersonaId: p.Id, Name: "Identity 3", Tags: []string{"tag1", "tag2"}},
-	}
-
-	for i := range identities {
-		err = service.CreateIdentity(&identities[i])
-		if err != nil {
-			t.Fatalf("Failed to create identity %d: %v", i, err)
-		}
+	identities := []*types.Identity{
+		{PersonaId: p.Id, Name: "First"},
+		{PersonaId: "non-existent-id", Name: "Orphan"},
+		nil,
+		{PersonaId: p.Id, Name: "Second"},
 	}
 
-	// Test listing all identities
-	allIdentities, err := service.ListIdentities(nil)
-	if err != nil {
-		t.Fatalf("Failed to list identities: %v", err)
+	results := service.CreateIdentities(identities)
+	if len(results) != len(identities) {
+		t.Fatalf("Expected %d results, got %d", len(identities), len(results))
 	}
 
-	if len(allIdentities) != 3 {
-		t.Errorf("Expected 3 identities, got %d", len(allIdentities))
+	for idx, result := range results {
+		if result.Index != idx {
+			t.Errorf("Expected result %d to have index %d, got %d", idx, idx, result.Index)
+		}
 	}
-
-	// Test filtering by persona ID
-	filter := &types.IdentityFilter{PersonaID: p.Id}
-	filteredIdentities, err := service.ListIdentities(filter)
-	if err != nil {
-		t.Fatalf("Failed to list identities with filter: %v", err)
+	for _, idx := range []int{0, 3} {
+		if results[idx].Error != "" || results[idx].Id == "" {
+			t.Errorf("Expected identity %d to be created, got %+v", idx, results[idx])
+		}
+		if results[idx].Id != identities[idx].Id {
+			t.Errorf("Expected result ID %s to match identity ID %s", results[idx].Id, identities[idx].Id)
+		}
 	}
-
-	if len(filteredIdentities) != 3 {
-		t.Errorf("Expected 3 identities for persona %s, got %d", p.Id, len(filteredIdentities))
+	for _, idx := range []int{1, 2} {
+		if results[idx].Error == "" || results[idx].Id != "" {
+			t.Errorf("Expected identity %d to fail, got %+v", idx, results[idx])
+		}
 	}
 
-	// Test filtering by tags
-	tagFilter := &types.IdentityFilter{Tags: []string{"tag1"}}
-	tagFilteredIdentities, err := service.ListIdentities(tagFilter)
+	// Failures must not prevent the valid identities from being stored
+	stored, err := service.ListIdentities(nil)
 	if err != nil {
-		t.Fatalf("Failed to list identities with tag filter: %v", err)
+		t.Fatalf("Failed to list identities: %v", err)
 	}
-
-	if len(tagFilteredIdentities) != 2 {
-		t.Errorf("Expected 2 identities with tag1, got %d", len(tagFilteredIdentities))
+	if len(stored) != 2 {
+		t.Errorf("Expected 2 stored identities, got %d", len(stored))
 	}
 }
 
-func TestServiceUpdateIdentity(t *testing.T) {
+func TestServiceTagLimits(t *testing.T) {
 	service := NewService(storage.NewMemoryStorage())
 
-	// Create a persona
 	p := types.Persona{
 		Name:   "Test Persona",
 		Topic:  "Test Topic",
 		Prompt: "Test prompt",
 	}
-	err := service.CreatePersona(&p)
-	if err != nil {
+	if err := service.CreatePersona(&p); err != nil {
 		t.Fatalf("Failed to create persona: %v", err)
 	}
 
-	// Create an identity
-	i := types.Identity{
-		PersonaId:   p.Id,
-		Name:        "Original Name",
-		Description: "Original description",
-	}
-	err = service.CreateIdentity(&i)
-	if err != nil {
-		t.Fatalf("Failed to create identity: %v", err)
+	tooManyTags := make([]string, 21)
+	for i := range tooManyTags {
+		tooManyTags[i] = fmt.Sprintf("tag%d", i)
 	}
+	longTag := strings.Repeat("a", 51)
 
-	// Update the identity
-	updatedIdentity := i
-	updatedIdentity.Name = "Updated Name"
-	updatedIdentity.Description = "Updated description"
-
-	err = service.UpdateIdentity(i.Id, updatedIdentity)
-	if err != nil {
-		t.Fatalf("Failed to update identity: %v", err)
+	tests := []struct {
+		name      string
+		tags      []string
+		wantField string
+	}{
+		{"too many tags", tooManyTags, "tags"},
+		{"tag too long", []string{"ok", longTag}, "tags[1]"},
 	}
 
-	// Verify the update
-	retrieved, err := service.GetIdentity(i.Id)
-	if err != nil {
-		t.Fatalf("Failed to get updated identity: %v", err)
-	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkErr := func(err error) {
+				t.Helper()
+				validationErr, ok := err.(middleware.ValidationErrors)
+				if !ok {
+					t.Fatalf("Expected ValidationErrors, got %v", err)
+				}
+				if validationErr.Errors[0].Field != tt.wantField {
+					t.Errorf("Expected field %s, got %s", tt.wantField, validationErr.Errors[0].Field)
+				}
+			}
 
-	if retrieved.Name != "Updated Name" {
-		t.Errorf("Expected updated name 'Updated Name', got %s", retrieved.Name)
-	}
-	if retrieved.Description != "Updated description" {
-		t.Errorf("Expected updated description 'Updated description', got %s", retrieved.Description)
+			checkErr(service.CreatePersona(&types.Persona{
+				Name:   "Tagged",
+				Topic:  "Test",
+				Prompt: "Test",
+				Tags:   tt.tags,
+			}))
+			checkErr(service.CreateIdentity(&types.Identity{
+				PersonaId: p.Id,
+				Name:      "Tagged Identity",
+				Tags:      tt.tags,
+			}))
+			checkErr(service.UpdateCommunity("any", types.Community{
+				Name: "Tagged Community",
+				Tags: tt.tags,
+			}))
+		})
 	}
 }
 
-func TestServiceDeleteIdentity(t *testing.T) {
+func TestServiceIdentityAttributeValidation(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	p := types.Persona{Name: "Test Persona", Topic: "Test Topic", Prompt: "Test prompt"}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		rich      *types.RichAttributes
+		wantField string
+	}{
+		{
+			"openness above range",
+			&types.RichAttributes{Psychographics: &types.Psychographics{Personality: &types.Personality{Openness: 1.5}}},
+			"rich_attributes.psychographics.personality.openness",
+		},
+		{
+			"negative neuroticism",
+			&types.RichAttributes{Psychographics: &types.Psychographics{Personality: &types.Personality{Neuroticism: -0.1}}},
+			"rich_attributes.psychographics.personality.neuroticism",
+		},
+		{
+			"negative age",
+			&types.RichAttributes{Demographics: &types.Demographics{Age: -1}},
+			"rich_attributes.demographics.age",
+		},
+		{
+			"unreasonable age",
+			&types.RichAttributes{Demographics: &types.Demographics{Age: 200}},
+			"rich_attributes.demographics.age",
+		},
+		{
+			"unknown socioeconomic status",
+			&types.RichAttributes{Demographics: &types.Demographics{SocioeconomicStatus: "rich"}},
+			"rich_attributes.demographics.socioeconomic_status",
+		},
+		{
+			"unknown political leaning",
+			&types.RichAttributes{PoliticalSocial: &types.PoliticalSocial{PoliticalLeaning: "centrist"}},
+			"rich_attributes.political_social.political_leaning",
+		},
+	}
+
+	valid := types.Identity{PersonaId: p.Id, Name: "Valid Identity"}
+	if err := service.CreateIdentity(&valid); err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkErr := func(err error) {
+				t.Helper()
+				validationErr, ok := err.(middleware.ValidationErrors)
+				if !ok {
+					t.Fatalf("Expected ValidationErrors, got %v", err)
+				}
+				if len(validationErr.Errors) != 1 || validationErr.Errors[0].Field != tt.wantField {
+					t.Errorf("Expected a single error for %s, got %v", tt.wantField, validationErr.Errors)
+				}
+			}
+
+			checkErr(service.CreateIdentity(&types.Identity{
+				PersonaId:      p.Id,
+				Name:           "Invalid Identity",
+				RichAttributes: tt.rich,
+			}))
+
+			update := valid
+			update.RichAttributes = tt.rich
+			checkErr(service.UpdateIdentity(valid.Id, update))
+		})
+	}
+
+	inRange := types.Identity{
+		PersonaId: p.Id,
+		Name:      "Boundary Identity",
+		RichAttributes: &types.RichAttributes{
+			Demographics:    &types.Demographics{Age: 0, SocioeconomicStatus: "middle"},
+			Psychographics:  &types.Psychographics{Personality: &types.Personality{Openness: 1, Neuroticism: 0}},
+			PoliticalSocial: &types.PoliticalSocial{PoliticalLeaning: "very_conservative"},
+		},
+	}
+	if err := service.CreateIdentity(&inRange); err != nil {
+		t.Errorf("Expected boundary values to be accepted, got %v", err)
+	}
+}
+
+func TestServiceTagSanitization(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	p := types.Persona{
+		Name:   "Test Persona",
+		Topic:  "Test Topic",
+		Prompt: "Test prompt",
+		Tags:   []string{"  go  ", "", "backend"},
+	}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	if len(p.Tags) != 2 || p.Tags[0] != "go" || p.Tags[1] != "backend" {
+		t.Errorf("Expected sanitized tags [go backend], got %v", p.Tags)
+	}
+}
+
+func TestServiceListIdentities(t *testing.T) {
 	service := NewService(storage.NewMemoryStorage())
 
 	// Create a persona
@@ -649,39 +1161,61 @@ func TestServiceDeleteIdentity(t *testing.T) {
 		t.Fatalf("Failed to create persona: %v", err)
 	}
 
-	// Create an identity
-	i := types.Identity{
-		PersonaId: p.Id,
-		Name:      "Test Identity",
+	// Create multiple identities
+	identities := []types.Identity{
+		{PersonaId: p.Id, Name: "Identity 1", Tags: []string{"tag1"}},
+		{PersonaId: p.Id, Name: "Identity 2", Tags: []string{"tag2"}},
+		{PersonaId: p.Id, Name: "Identity 3", Tags: []string{"tag1", "tag2"}},
 	}
-	err = service.CreateIdentity(&i)
+
+	for i := range identities {
+		err = service.CreateIdentity(&identities[i])
+		if err != nil {
+			t.Fatalf("Failed to create identity %d: %v", i, err)
+		}
+	}
+
+	// Test listing all identities
+	allIdentities, err := service.ListIdentities(nil)
 	if err != nil {
-		t.Fatalf("Failed to create identity: %v", err)
+		t.Fatalf("Failed to list identities: %v", err)
 	}
 
-	// Delete the identity
-	err = service.DeleteIdentity(i.Id)
+	if len(allIdentities) != 3 {
+		t.Errorf("Expected 3 identities, got %d", len(allIdentities))
+	}
+
+	// Test filtering by persona ID
+	filter := &types.IdentityFilter{PersonaID: p.Id}
+	filteredIdentities, err := service.ListIdentities(filter)
 	if err != nil {
-		t.Fatalf("Failed to delete identity: %v", err)
+		t.Fatalf("Failed to list identities with filter: %v", err)
 	}
 
-	// Verify it's deleted
-	_, err = service.GetIdentity(i.Id)
-	if err == nil {
-		t.Error("Expected error when getting deleted identity")
+	if len(filteredIdentities) != 3 {
+		t.Errorf("Expected 3 identities for persona %s, got %d", p.Id, len(filteredIdentities))
+	}
+
+	// Test filtering by tags
+	tagFilter := &types.IdentityFilter{Tags: []string{"tag1"}}
+	tagFilteredIdentities, err := service.ListIdentities(tagFilter)
+	if err != nil {
+		t.Fatalf("Failed to list identities with tag filter: %v", err)
+	}
+
+	if len(tagFilteredIdentities) != 2 {
+		t.Errorf("Expected 2 identities with tag1, got %d", len(tagFilteredIdentities))
 	}
 }
 
-func TestServiceGetIdentityWithPersona(t *testing.T) {
+func TestServiceUpdateIdentity(t *testing.T) {
 	service := NewService(storage.NewMemoryStorage())
 
 	// Create a persona
 	p := types.Persona{
-		Name:    "Test Persona",
-		Topic:   "Test Topic",
-		Prompt:  "Test prompt",
-		Context: map[string]string{"key": "value"},
-		Rag:     []string{"doc1", "doc2"},
+		Name:   "Test Persona",
+		Topic:  "Test Topic",
+		Prompt: "Test prompt",
 	}
 	err := service.CreatePersona(&p)
 	if err != nil {
@@ -691,36 +1225,1669 @@ func TestServiceGetIdentityWithPersona(t *testing.T) {
 	// Create an identity
 	i := types.Identity{
 		PersonaId:   p.Id,
-		Name:        "Test Identity",
-		Description: "Test description",
-		Background:  "Test background",
-		Tags:        []string{"test"},
+		Name:        "Original Name",
+		Description: "Original description",
 	}
 	err = service.CreateIdentity(&i)
 	if err != nil {
 		t.Fatalf("Failed to create identity: %v", err)
 	}
 
-	// Get identity with persona
-	iwp, err := service.GetIdentityWithPersona(i.Id)
+	// Update the identity
+	updatedIdentity := i
+	updatedIdentity.Name = "Updated Name"
+	updatedIdentity.Description = "Updated description"
+
+	err = service.UpdateIdentity(i.Id, updatedIdentity)
 	if err != nil {
-		t.Fatalf("Failed to get identity with persona: %v", err)
+		t.Fatalf("Failed to update identity: %v", err)
 	}
 
-	// Verify both identity and persona data
-	if iwp.Identity.Id != i.Id {
-		t.Errorf("Expected identity ID %s, got %s", i.Id, iwp.Identity.Id)
+	// Verify the update
+	retrieved, err := service.GetIdentity(i.Id)
+	if err != nil {
+		t.Fatalf("Failed to get updated identity: %v", err)
 	}
-	if iwp.Identity.Name != i.Name {
-		t.Errorf("Expected identity name %s, got %s", i.Name, iwp.Identity.Name)
+
+	if retrieved.Name != "Updated Name" {
+		t.Errorf("Expected updated name 'Updated Name', got %s", retrieved.Name)
 	}
-	if iwp.Persona.Id != p.Id {
-		t.Errorf("Expected persona ID %s, got %s", p.Id, iwp.Persona.Id)
+	if retrieved.Description != "Updated description" {
+		t.Errorf("Expected updated description 'Updated description', got %s", retrieved.Description)
 	}
-	if iwp.Persona.Name != p.Name {
-		t.Errorf("Expected persona name %s, got %s", p.Name, iwp.Persona.Name)
+}
+
+func TestServiceIdentityTags(t *testing.T) {
+	fileStorage, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
 	}
-	if iwp.Persona.Topic != p.Topic {
-		t.Errorf("Expected persona topic %s, got %s", p.Topic, iwp.Persona.Topic)
+
+	for name, store := range map[string]storage.Storage{
+		"memory": storage.NewMemoryStorage(),
+		"file":   fileStorage,
+	} {
+		t.Run(name, func(t *testing.T) {
+			service := NewService(store)
+
+			p := types.Persona{Name: "Tagged", Topic: "Tags", Prompt: "Test prompt"}
+			if err := service.CreatePersona(&p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			i := types.Identity{PersonaId: p.Id, Name: "Tagged Identity", Tags: []string{"existing"}}
+			if err := service.CreateIdentity(&i); err != nil {
+				t.Fatalf("Failed to create identity: %v", err)
+			}
+
+			// Adding the same tag twice keeps a single copy
+			for n := 0; n < 2; n++ {
+				updated, err := service.AddIdentityTag(i.Id, "x")
+				if err != nil {
+					t.Fatalf("Failed to add tag: %v", err)
+				}
+				if !slices.Equal(updated.Tags, []string{"existing", "x"}) {
+					t.Errorf("Expected tags [existing x] after add %d, got %v", n+1, updated.Tags)
+				}
+			}
+
+			// Removing a tag the identity does not have is not an error
+			updated, err := service.RemoveIdentityTag(i.Id, "missing")
+			if err != nil {
+				t.Fatalf("Removing a missing tag should not error: %v", err)
+			}
+			if !slices.Equal(updated.Tags, []string{"existing", "x"}) {
+				t.Errorf("Expected tags unchanged, got %v", updated.Tags)
+			}
+
+			updated, err = service.RemoveIdentityTag(i.Id, "existing")
+			if err != nil {
+				t.Fatalf("Failed to remove tag: %v", err)
+			}
+			retrieved, err := service.GetIdentity(i.Id)
+			if err != nil {
+				t.Fatalf("Failed to get identity: %v", err)
+			}
+			if !slices.Equal(retrieved.Tags, []string{"x"}) || !slices.Equal(updated.Tags, retrieved.Tags) {
+				t.Errorf("Expected stored tags [x], got %v", retrieved.Tags)
+			}
+
+			if _, err := service.AddIdentityTag(i.Id, "  "); !errors.Is(err, errs.ErrValidation) {
+				t.Errorf("Expected ErrValidation for an empty tag, got %v", err)
+			}
+			if _, err := service.AddIdentityTag("nonexistent", "x"); !errors.Is(err, errs.ErrNotFound) {
+				t.Errorf("Expected ErrNotFound adding a tag to a missing identity, got %v", err)
+			}
+			if _, err := service.RemoveIdentityTag("nonexistent", "x"); !errors.Is(err, errs.ErrNotFound) {
+				t.Errorf("Expected ErrNotFound removing a tag from a missing identity, got %v", err)
+			}
+
+			// Concurrent adds of different tags are all kept
+			done := make(chan error, 5)
+			for n := 0; n < 5; n++ {
+				go func(n int) {
+					_, err := service.AddIdentityTag(i.Id, fmt.Sprintf("concurrent-%d", n))
+					done <- err
+				}(n)
+			}
+			for n := 0; n < 5; n++ {
+				if err := <-done; err != nil {
+					t.Errorf("Concurrent add failed: %v", err)
+				}
+			}
+			retrieved, err = service.GetIdentity(i.Id)
+			if err != nil {
+				t.Fatalf("Failed to get identity: %v", err)
+			}
+			if len(retrieved.Tags) != 6 {
+				t.Errorf("Expected 6 tags after concurrent adds, got %v", retrieved.Tags)
+			}
+		})
+	}
+}
+
+func TestServiceIdentityAvatar(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	p := types.Persona{Name: "Pictured", Topic: "Avatars", Prompt: "Test prompt"}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	i := types.Identity{PersonaId: p.Id, Name: "Pictured Identity"}
+	if err := service.CreateIdentity(&i); err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+	if err := service.SetIdentityAvatar(i.Id, "image/png", png); err != nil {
+		t.Fatalf("Failed to set avatar: %v", err)
+	}
+	avatar, err := service.GetIdentityAvatar(i.Id)
+	if err != nil {
+		t.Fatalf("Failed to get avatar: %v", err)
+	}
+	if avatar.ContentType != "image/png" || !bytes.Equal(avatar.Data, png) {
+		t.Errorf("Expected the uploaded PNG, got %s with %d bytes", avatar.ContentType, len(avatar.Data))
+	}
+
+	if err := service.SetIdentityAvatar(i.Id, "image/jpeg", png); !errors.Is(err, ErrAvatarType) {
+		t.Errorf("Expected ErrAvatarType for data not matching its content type, got %v", err)
+	}
+	if err := service.SetIdentityAvatar(i.Id, "image/gif", []byte("GIF89a")); !errors.Is(err, ErrAvatarType) {
+		t.Errorf("Expected ErrAvatarType for a GIF, got %v", err)
+	}
+	large := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, MaxAvatarSize)...)
+	if err := service.SetIdentityAvatar(i.Id, "image/png", large); !errors.Is(err, ErrAvatarTooLarge) {
+		t.Errorf("Expected ErrAvatarTooLarge, got %v", err)
+	}
+
+	if err := service.DeleteIdentityAvatar(i.Id); err != nil {
+		t.Fatalf("Failed to delete avatar: %v", err)
+	}
+	if _, err := service.GetIdentityAvatar(i.Id); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after deleting the avatar, got %v", err)
+	}
+
+	// Backends without avatar support say so
+	unsupported := NewService(&errorStorage{})
+	if _, err := unsupported.GetIdentityAvatar(i.Id); !errors.Is(err, ErrAvatarsUnsupported) {
+		t.Errorf("Expected ErrAvatarsUnsupported, got %v", err)
+	}
+}
+
+func TestServicePatchIdentity(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	p := types.Persona{Name: "Test Persona", Topic: "Test Topic", Prompt: "Test prompt"}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	i := types.Identity{
+		PersonaId:   p.Id,
+		Name:        "Original",
+		Description: "Original description",
+		Tags:        []string{"one"},
+		RichAttributes: &types.RichAttributes{
+			Demographics: &types.Demographics{Age: 30, Occupation: "nurse"},
+			Preferences:  &types.Preferences{Interests: []string{"hiking"}},
+		},
+	}
+	if err := service.CreateIdentity(&i); err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+
+	patch := map[string]interface{}{
+		"name":      "Patched",
+		"is_active": false,
+		"rich_attributes": map[string]interface{}{
+			"demographics": map[string]interface{}{"age": 31, "occupation": "doctor"},
+			"preferences":  nil,
+		},
+	}
+	if err := service.PatchIdentity(i.Id, patch); err != nil {
+		t.Fatalf("PatchIdentity failed: %v", err)
+	}
+
+	patched, err := service.GetIdentity(i.Id)
+	if err != nil {
+		t.Fatalf("Failed to get identity: %v", err)
+	}
+	if patched.Name != "Patched" {
+		t.Errorf("Expected name 'Patched', got %q", patched.Name)
+	}
+	if patched.IsActive {
+		t.Error("Expected is_active=false to persist")
+	}
+	if patched.Description != "Original description" || len(patched.Tags) != 1 || patched.PersonaId != p.Id {
+		t.Errorf("Expected fields outside the patch to be kept, got %+v", patched)
+	}
+	if dem := patched.RichAttributes.GetDemographics(); dem.GetAge() != 31 || dem.GetOccupation() != "doctor" {
+		t.Errorf("Expected demographics to be replaced, got %+v", dem)
+	}
+	if patched.RichAttributes.GetPreferences() != nil {
+		t.Errorf("Expected null to clear preferences, got %+v", patched.RichAttributes.GetPreferences())
+	}
+
+	// Disallowed fields, invalid values and missing identities are rejected
+	if err := service.PatchIdentity(i.Id, map[string]interface{}{"persona_id": "other"}); err == nil {
+		t.Error("Expected error patching persona_id")
+	}
+	if err := service.PatchIdentity(i.Id, map[string]interface{}{"name": 42}); err == nil {
+		t.Error("Expected error for a non-string name")
+	}
+	if err := service.PatchIdentity(i.Id, map[string]interface{}{"rich_attributes": "none"}); err == nil {
+		t.Error("Expected error for non-object rich_attributes")
+	}
+	if err := service.PatchIdentity("non-existent-id", map[string]interface{}{"name": "x"}); err == nil {
+		t.Error("Expected error patching a missing identity")
+	}
+}
+
+// racingIdentityStorage tags an identity concurrently just after each of
+// the first races identity reads
+type racingIdentityStorage struct {
+	*storage.MemoryStorage
+	races int
+}
+
+func (r *racingIdentityStorage) GetIdentity(id string) (types.Identity, error) {
+	i, err := r.MemoryStorage.GetIdentity(id)
+	if err != nil || r.races == 0 {
+		return i, err
+	}
+	r.races--
+	_, err = r.MemoryStorage.ModifyIdentity(id, func(i *types.Identity) (bool, error) {
+		i.Tags = append(i.Tags, "concurrent")
+		return true, nil
+	})
+	return i, err
+}
+
+func TestServicePatchIdentityKeepsConcurrentEdits(t *testing.T) {
+	store := &racingIdentityStorage{MemoryStorage: storage.NewMemoryStorage()}
+	service := NewService(store)
+
+	p := types.Persona{Name: "Test Persona", Topic: "Test Topic", Prompt: "Test prompt"}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	i := types.Identity{PersonaId: p.Id, Name: "Original"}
+	if err := service.CreateIdentity(&i); err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+
+	store.races = 1
+	if err := service.PatchIdentity(i.Id, map[string]interface{}{"name": "Patched"}); err != nil {
+		t.Fatalf("PatchIdentity failed: %v", err)
+	}
+	patched, err := service.GetIdentity(i.Id)
+	if err != nil {
+		t.Fatalf("Failed to get identity: %v", err)
+	}
+	if patched.Name != "Patched" || !slices.Equal(patched.Tags, []string{"concurrent"}) {
+		t.Errorf("Expected the patch and the concurrent tag, got name %q and tags %v", patched.Name, patched.Tags)
+	}
+}
+
+func TestServiceUpdateIdentityAttributes(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	p := types.Persona{Name: "Test Persona", Topic: "Test Topic", Prompt: "Test prompt"}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	i := types.Identity{
+		PersonaId:      p.Id,
+		Name:           "Original",
+		Tags:           []string{"one", "two"},
+		RichAttributes: &types.RichAttributes{Demographics: &types.Demographics{Age: 30}},
+	}
+	if err := service.CreateIdentity(&i); err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	created, err := service.GetIdentity(i.Id)
+	if err != nil {
+		t.Fatalf("Failed to get identity: %v", err)
+	}
+
+	updated, err := service.UpdateIdentityAttributes(i.Id, &types.RichAttributes{
+		Demographics:   &types.Demographics{Age: 45, Occupation: "teacher"},
+		Psychographics: &types.Psychographics{Personality: &types.Personality{Openness: 0.8}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateIdentityAttributes failed: %v", err)
+	}
+	if updated.Name != "Original" || !slices.Equal(updated.Tags, []string{"one", "two"}) || updated.PersonaId != p.Id {
+		t.Errorf("Expected fields outside the attributes to be kept, got %+v", updated)
+	}
+	if dem := updated.RichAttributes.GetDemographics(); dem.GetAge() != 45 || dem.GetOccupation() != "teacher" {
+		t.Errorf("Expected demographics to be replaced, got %+v", dem)
+	}
+	if !updated.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("Expected UpdatedAt to move past %v, got %v", created.UpdatedAt, updated.UpdatedAt)
+	}
+
+	stored, err := service.GetIdentity(i.Id)
+	if err != nil {
+		t.Fatalf("Failed to get identity: %v", err)
+	}
+	if stored.RichAttributes.GetPsychographics().GetPersonality().GetOpenness() != 0.8 {
+		t.Errorf("Expected the new attributes to be stored, got %+v", stored.RichAttributes)
+	}
+
+	// Out-of-range values are rejected and leave the identity unchanged
+	if _, err := service.UpdateIdentityAttributes(i.Id, &types.RichAttributes{Demographics: &types.Demographics{Age: 200}}); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("Expected validation error for age 200, got %v", err)
+	}
+	if _, err := service.UpdateIdentityAttributes(i.Id, &types.RichAttributes{
+		Psychographics: &types.Psychographics{Personality: &types.Personality{Neuroticism: 1.5}},
+	}); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("Expected validation error for neuroticism 1.5, got %v", err)
+	}
+	if stored, _ := service.GetIdentity(i.Id); stored.RichAttributes.GetDemographics().GetAge() != 45 {
+		t.Errorf("Expected rejected updates to leave the age at 45, got %+v", stored.RichAttributes)
+	}
+
+	if _, err := service.UpdateIdentityAttributes("non-existent-id", nil); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("Expected not found for a missing identity, got %v", err)
+	}
+
+	// A tag added while the attributes are replaced is kept
+	store := &racingIdentityStorage{MemoryStorage: storage.NewMemoryStorage()}
+	raced := NewService(store)
+	q := types.Persona{Name: "Raced Persona", Topic: "Test Topic", Prompt: "Test prompt"}
+	if err := raced.CreatePersona(&q); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	j := types.Identity{PersonaId: q.Id, Name: "Raced"}
+	if err := raced.CreateIdentity(&j); err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	store.races = 1
+	updated, err = raced.UpdateIdentityAttributes(j.Id, &types.RichAttributes{Demographics: &types.Demographics{Age: 50}})
+	if err != nil {
+		t.Fatalf("UpdateIdentityAttributes failed: %v", err)
+	}
+	if updated.RichAttributes.GetDemographics().GetAge() != 50 || !slices.Equal(updated.Tags, []string{"concurrent"}) {
+		t.Errorf("Expected the new attributes and the concurrent tag, got %+v", updated)
+	}
+}
+
+func TestServiceDeleteIdentity(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	// Create a persona
+	p := types.Persona{
+		Name:   "Test Persona",
+		Topic:  "Test Topic",
+		Prompt: "Test prompt",
+	}
+	err := service.CreatePersona(&p)
+	if err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	// Create an identity
+	i := types.Identity{
+		PersonaId: p.Id,
+		Name:      "Test Identity",
+	}
+	err = service.CreateIdentity(&i)
+	if err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+
+	// Delete the identity
+	err = service.DeleteIdentity(i.Id)
+	if err != nil {
+		t.Fatalf("Failed to delete identity: %v", err)
+	}
+
+	// Verify it's deleted
+	_, err = service.GetIdentity(i.Id)
+	if err == nil {
+		t.Error("Expected error when getting deleted identity")
+	}
+}
+
+func TestServiceGetIdentityWithPersona(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	// Create a persona
+	p := types.Persona{
+		Name:    "Test Persona",
+		Topic:   "Test Topic",
+		Prompt:  "Test prompt",
+		Context: map[string]string{"key": "value"},
+		Rag:     []string{"doc1", "doc2"},
+	}
+	err := service.CreatePersona(&p)
+	if err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	// Create an identity
+	i := types.Identity{
+		PersonaId:   p.Id,
+		Name:        "Test Identity",
+		Description: "Test description",
+		Background:  "Test background",
+		Tags:        []string{"test"},
+	}
+	err = service.CreateIdentity(&i)
+	if err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+
+	// Get identity with persona
+	iwp, err := service.GetIdentityWithPersona(i.Id)
+	if err != nil {
+		t.Fatalf("Failed to get identity with persona: %v", err)
+	}
+
+	// Verify both identity and persona data
+	if iwp.Identity.Id != i.Id {
+		t.Errorf("Expected identity ID %s, got %s", i.Id, iwp.Identity.Id)
+	}
+	if iwp.Identity.Name != i.Name {
+		t.Errorf("Expected identity name %s, got %s", i.Name, iwp.Identity.Name)
+	}
+	if iwp.Persona.Id != p.Id {
+		t.Errorf("Expected persona ID %s, got %s", p.Id, iwp.Persona.Id)
+	}
+	if iwp.Persona.Name != p.Name {
+		t.Errorf("Expected persona name %s, got %s", p.Name, iwp.Persona.Name)
+	}
+	if iwp.Persona.Topic != p.Topic {
+		t.Errorf("Expected persona topic %s, got %s", p.Topic, iwp.Persona.Topic)
+	}
+}
+
+func TestRenderPersonaPrompt(t *testing.T) {
+	p := types.Persona{
+		Id:      "p1",
+		Name:    "Go Expert",
+		Topic:   "Golang",
+		Prompt:  "You are a Go expert.",
+		Context: map[string]string{"level": "senior"},
+		Rag:     []string{"effective-go.md"},
+	}
+
+	withRAG := RenderPersonaPrompt(p, DefaultRenderOptions())
+	if !strings.HasPrefix(withRAG, p.Prompt) {
+		t.Errorf("Expected rendered prompt to start with persona prompt, got %q", withRAG)
+	}
+	if !strings.Contains(withRAG, "level: senior") {
+		t.Errorf("Expected rendered prompt to contain context, got %q", withRAG)
+	}
+	if !strings.Contains(withRAG, "effective-go.md") {
+		t.Errorf("Expected rendered prompt to contain RAG by default, got %q", withRAG)
+	}
+
+	withoutRAG := RenderPersonaPrompt(p, RenderOptions{IncludeRAG: false})
+	if strings.Contains(withoutRAG, "effective-go.md") {
+		t.Errorf("Expected rendered prompt to omit RAG, got %q", withoutRAG)
+	}
+	if !strings.Contains(withoutRAG, "level: senior") {
+		t.Errorf("Expected rendered prompt to keep context without RAG, got %q", withoutRAG)
+	}
+}
+
+func TestExportPersonaOpenAI(t *testing.T) {
+	p := types.Persona{
+		Id:     "p1",
+		Name:   "Go Expert",
+		Topic:  "Golang",
+		Prompt: "You are a Go expert.",
+		Rag:    []string{"effective-go.md"},
+	}
+
+	assistant := ExportPersonaOpenAI(p, DefaultRenderOptions())
+	if assistant.Name != p.Name || assistant.Description != p.Topic {
+		t.Errorf("Unexpected assistant name/description: %+v", assistant)
+	}
+	if assistant.Metadata["persona_id"] != p.Id {
+		t.Errorf("Expected persona_id metadata %s, got %v", p.Id, assistant.Metadata)
+	}
+	if !strings.Contains(assistant.Instructions, "effective-go.md") {
+		t.Errorf("Expected instructions to include RAG, got %q", assistant.Instructions)
+	}
+
+	assistant = ExportPersonaOpenAI(p, RenderOptions{IncludeRAG: false})
+	if assistant.Instructions != p.Prompt {
+		t.Errorf("Expected instructions %q without RAG, got %q", p.Prompt, assistant.Instructions)
+	}
+}
+
+func TestServiceGetPersonaChain(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	root := &types.Persona{Name: "Root", Topic: "Base", Prompt: "Root prompt"}
+	if err := service.CreatePersona(root); err != nil {
+		t.Fatalf("Failed to create root persona: %v", err)
+	}
+	middle := &types.Persona{Name: "Middle", Topic: "Base", Prompt: "Middle prompt", ParentId: root.Id}
+	if err := service.CreatePersona(middle); err != nil {
+		t.Fatalf("Failed to create middle persona: %v", err)
+	}
+	leaf := &types.Persona{Name: "Leaf", Topic: "Base", Prompt: "Leaf prompt", ParentId: middle.Id}
+	if err := service.CreatePersona(leaf); err != nil {
+		t.Fatalf("Failed to create leaf persona: %v", err)
+	}
+
+	chain, err := service.GetPersonaChain(leaf.Id)
+	if err != nil {
+		t.Fatalf("Failed to get chain: %v", err)
+	}
+	want := []string{root.Id, middle.Id, leaf.Id}
+	if len(chain) != len(want) {
+		t.Fatalf("Expected chain length %d, got %d", len(want), len(chain))
+	}
+	for i, p := range chain {
+		if p.Id != want[i] {
+			t.Errorf("Chain[%d]: expected %s, got %s", i, want[i], p.Id)
+		}
+	}
+
+	// Linking the root to the leaf must be rejected on update
+	root.ParentId = leaf.Id
+	if err := service.UpdatePersona(root.Id, *root); err == nil {
+		t.Error("Expected error when update would create an inheritance cycle")
+	}
+
+	// Unknown parents are rejected on create
+	orphan := &types.Persona{Name: "Orphan", Topic: "Base", Prompt: "Prompt", ParentId: "missing"}
+	if err := service.CreatePersona(orphan); err == nil {
+		t.Error("Expected error for missing parent persona")
+	}
+}
+
+func TestServiceGetPersonaChainCycle(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	service := NewService(store)
+
+	// Build a cycle directly in storage, as could happen with hand-edited data files
+	a := &types.Persona{Name: "A", Topic: "Base", Prompt: "A prompt"}
+	b := &types.Persona{Name: "B", Topic: "Base", Prompt: "B prompt"}
+	c := &types.Persona{Name: "C", Topic: "Base", Prompt: "C prompt"}
+	for _, p := range []*types.Persona{a, b, c} {
+		if err := store.Create(p); err != nil {
+			t.Fatalf("Failed to create persona: %v", err)
+		}
+	}
+	a.ParentId, b.ParentId, c.ParentId = b.Id, a.Id, a.Id
+	for _, p := range []*types.Persona{a, b, c} {
+		if err := store.Update(p.Id, *p); err != nil {
+			t.Fatalf("Failed to update persona: %v", err)
+		}
+	}
+
+	_, err := service.GetPersonaChain(c.Id)
+	cycleErr, ok := err.(*CycleError)
+	if !ok {
+		t.Fatalf("Expected *CycleError, got %v", err)
+	}
+	want := []string{a.Id, b.Id, a.Id}
+	if len(cycleErr.Cycle) != len(want) {
+		t.Fatalf("Expected cycle %v, got %v", want, cycleErr.Cycle)
+	}
+	for i := range want {
+		if cycleErr.Cycle[i] != want[i] {
+			t.Errorf("Expected cycle %v, got %v", want, cycleErr.Cycle)
+			break
+		}
+	}
+}
+
+func TestServicePersonaBackups(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+	backups, err := storage.NewBackupStore(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("Failed to create backup store: %v", err)
+	}
+	service.SetBackupStore(backups)
+
+	p := &types.Persona{Name: "Original", Topic: "Topic", Prompt: "Original prompt"}
+	if err := service.CreatePersona(p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	// Update creates a backup of the original state
+	updated := *p
+	updated.Name = "Bad Edit"
+	updated.Version = 0
+	if err := service.UpdatePersona(p.Id, updated); err != nil {
+		t.Fatalf("Failed to update persona: %v", err)
+	}
+
+	list, err := service.ListPersonaBackups(p.Id)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("Expected 1 backup after update, got %d", len(list))
+	}
+	if list[0].Persona.Name != "Original" || list[0].Reason != "update" {
+		t.Errorf("Expected backup of original persona, got %+v", list[0])
+	}
+
+	// Restore reverts the change
+	restored, err := service.RestorePersonaBackup(p.Id, list[0].Id)
+	if err != nil {
+		t.Fatalf("Failed to restore backup: %v", err)
+	}
+	if restored.Id != p.Id || restored.Name != "Original" {
+		t.Errorf("Expected persona restored to Original, got %+v", restored)
+	}
+
+	// Restoring is itself an update, and the oldest backups are pruned
+	for i := 0; i < 3; i++ {
+		updated.Name = fmt.Sprintf("Edit %d", i)
+		if err := service.UpdatePersona(p.Id, updated); err != nil {
+			t.Fatalf("Failed to update persona: %v", err)
+		}
+	}
+	list, _ = service.ListPersonaBackups(p.Id)
+	if len(list) != 2 {
+		t.Errorf("Expected backups pruned to 2, got %d", len(list))
+	}
+	if list[0].Persona.Name != "Edit 1" {
+		t.Errorf("Expected newest backup first, got %s", list[0].Persona.Name)
+	}
+
+	// Delete backs up the final state, which can be recreated
+	if err := service.DeletePersona(p.Id); err != nil {
+		t.Fatalf("Failed to delete persona: %v", err)
+	}
+	list, _ = service.ListPersonaBackups(p.Id)
+	if list[0].Reason != "delete" || list[0].Persona.Name != "Edit 2" {
+		t.Errorf("Expected delete backup of final state, got %+v", list[0])
+	}
+	recreated, err := service.RestorePersonaBackup(p.Id, list[0].Id)
+	if err != nil {
+		t.Fatalf("Failed to restore deleted persona: %v", err)
+	}
+	if recreated.Name != "Edit 2" || recreated.Id == "" {
+		t.Errorf("Expected deleted persona to be recreated, got %+v", recreated)
+	}
+}
+
+func TestServicePersonaBackupsDisabled(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	if _, err := service.ListPersonaBackups("any"); err == nil {
+		t.Error("Expected error listing backups when disabled")
+	}
+	if _, err := service.RestorePersonaBackup("any", "backup"); err == nil {
+		t.Error("Expected error restoring backup when disabled")
+	}
+}
+
+func TestParseOpenAIAssistants(t *testing.T) {
+	single := `{
+		"name": "Go Expert",
+		"description": "Golang",
+		"instructions": "You are a Go expert.",
+		"model": "gpt-4o"
+	}`
+	personas, err := ParseOpenAIAssistants([]byte(single))
+	if err != nil {
+		t.Fatalf("Failed to parse single assistant: %v", err)
+	}
+	if len(personas) != 1 {
+		t.Fatalf("Expected 1 persona, got %d", len(personas))
+	}
+	p := personas[0]
+	if p.Name != "Go Expert" || p.Topic != "Golang" || p.Prompt != "You are a Go expert." {
+		t.Errorf("Unexpected persona mapping: %+v", p)
+	}
+	if p.Context["model"] != "gpt-4o" {
+		t.Errorf("Expected model in context, got %v", p.Context)
+	}
+
+	array := `[
+		{"name": "Chef", "messages": [
+			{"role": "system", "content": "You are a chef."},
+			{"role": "user", "content": "Hi"}
+		]},
+		{"name": "Poet", "description": "Poetry", "instructions": "You write poems."}
+	]`
+	personas, err = ParseOpenAIAssistants([]byte(array))
+	if err != nil {
+		t.Fatalf("Failed to parse assistant array: %v", err)
+	}
+	if len(personas) != 2 {
+		t.Fatalf("Expected 2 personas, got %d", len(personas))
+	}
+	if personas[0].Prompt != "You are a chef." || personas[0].Topic != "Chef" {
+		t.Errorf("Expected system message prompt and name topic, got %+v", personas[0])
+	}
+
+	if _, err := ParseOpenAIAssistants([]byte(`[]`)); err == nil {
+		t.Error("Expected error for empty array")
+	}
+	if _, err := ParseOpenAIAssistants([]byte(`not json`)); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+}
+
+func TestServiceCreatePersonas(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	personas := []types.Persona{
+		{Name: "First", Topic: "One", Prompt: "You are first."},
+		{Name: "Second", Topic: "Two", Prompt: "You are second."},
+	}
+	created, err := service.CreatePersonas(personas)
+	if err != nil {
+		t.Fatalf("Failed to import personas: %v", err)
+	}
+	if len(created) != 2 || created[0].Id == "" {
+		t.Errorf("Expected 2 created personas with IDs, got %+v", created)
+	}
+
+	// An invalid entry rejects the whole batch
+	invalid := []types.Persona{
+		{Name: "Valid", Topic: "Topic", Prompt: "You are valid."},
+		{Name: "Missing Prompt", Topic: "Topic"},
+	}
+	if _, err := service.CreatePersonas(invalid); err == nil {
+		t.Error("Expected error for invalid persona in batch")
+	}
+	all, _ := service.ListPersonas()
+	if len(all) != 2 {
+		t.Errorf("Expected no personas from rejected batch, got %d total", len(all))
+	}
+}
+
+func TestServiceExportImportPersonas(t *testing.T) {
+	source := NewService(storage.NewMemoryStorage())
+
+	parent := types.Persona{Name: "Parent", Topic: "Base", Prompt: "You are the base."}
+	if err := source.CreatePersona(&parent); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	child := types.Persona{Name: "Child", Topic: "Derived", Prompt: "You are derived.", ParentId: parent.Id}
+	if err := source.CreatePersona(&child); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	bundle, err := source.ExportPersonas()
+	if err != nil {
+		t.Fatalf("ExportPersonas failed: %v", err)
+	}
+
+	// Importing into a fresh environment creates everything and keeps the
+	// inheritance link intact under the new IDs
+	target := NewService(storage.NewMemoryStorage())
+	imported, err := target.ImportPersonas(bundle, false)
+	if err != nil {
+		t.Fatalf("ImportPersonas failed: %v", err)
+	}
+	if imported != 2 {
+		t.Errorf("Expected 2 imported personas, got %d", imported)
+	}
+	personas, _ := target.ListPersonas()
+	byName := make(map[string]types.Persona)
+	for _, p := range personas {
+		byName[p.Name] = p
+	}
+	if byName["Child"].ParentId != byName["Parent"].Id {
+		t.Errorf("Expected child to reference imported parent %s, got %s", byName["Parent"].Id, byName["Child"].ParentId)
+	}
+
+	// Re-importing into the source skips existing IDs unless overwriting
+	imported, err = source.ImportPersonas(bundle, false)
+	if err != nil {
+		t.Fatalf("ImportPersonas failed: %v", err)
+	}
+	if imported != 0 {
+		t.Errorf("Expected existing personas to be skipped, got %d imported", imported)
+	}
+
+	parent.Prompt = "You were changed."
+	if err := source.UpdatePersona(parent.Id, parent); err != nil {
+		t.Fatalf("Failed to update persona: %v", err)
+	}
+	imported, err = source.ImportPersonas(bundle, true)
+	if err != nil {
+		t.Fatalf("ImportPersonas with overwrite failed: %v", err)
+	}
+	if imported != 2 {
+		t.Errorf("Expected 2 overwritten personas, got %d", imported)
+	}
+	restored, _ := source.GetPersona(parent.Id)
+	if restored.Prompt != "You are the base." {
+		t.Errorf("Expected overwrite to restore the prompt, got %q", restored.Prompt)
+	}
+	if all, _ := source.ListPersonas(); len(all) != 2 {
+		t.Errorf("Expected no duplicates after re-import, got %d personas", len(all))
+	}
+}
+
+func TestServiceImportPersonas_Invalid(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	if _, err := service.ImportPersonas([]byte(`{"name": "not an array"}`), false); err == nil {
+		t.Error("Expected error for a bundle that is not an array")
+	}
+
+	// An invalid entry rejects the whole bundle
+	bundle := []byte(`[
+		{"name": "Valid", "topic": "Topic", "prompt": "You are valid."},
+		{"name": "Missing Prompt", "topic": "Topic"}
+	]`)
+	if _, err := service.ImportPersonas(bundle, false); err == nil {
+		t.Error("Expected error for invalid persona in bundle")
+	}
+	if all, _ := service.ListPersonas(); len(all) != 0 {
+		t.Errorf("Expected nothing imported from a rejected bundle, got %d", len(all))
+	}
+
+	cycle := []byte(`[
+		{"id": "a", "name": "A", "topic": "Topic", "prompt": "You are A.", "parent_id": "b"},
+		{"id": "b", "name": "B", "topic": "Topic", "prompt": "You are B.", "parent_id": "a"}
+	]`)
+	if _, err := service.ImportPersonas(cycle, false); err == nil {
+		t.Error("Expected error for a bundle with an inheritance cycle")
+	}
+}
+
+func TestServiceBackupRestore(t *testing.T) {
+	backends := map[string]func(t *testing.T) storage.Storage{
+		"memory": func(t *testing.T) storage.Storage {
+			return storage.NewMemoryStorage()
+		},
+		"file": func(t *testing.T) storage.Storage {
+			store, err := storage.NewFileStorage(t.TempDir())
+			if err != nil {
+				t.Fatalf("Failed to create file storage: %v", err)
+			}
+			return store
+		},
+	}
+
+	for name, newStorage := range backends {
+		t.Run(name, func(t *testing.T) {
+			source := NewService(newStorage(t))
+
+			p := types.Persona{Name: "Expert", Topic: "Backups", Prompt: "You keep backups."}
+			if err := source.CreatePersona(&p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			alice := types.Identity{PersonaId: p.Id, Name: "Alice"}
+			bob := types.Identity{PersonaId: p.Id, Name: "Bob"}
+			for _, i := range []*types.Identity{&alice, &bob} {
+				if err := source.CreateIdentity(i); err != nil {
+					t.Fatalf("Failed to create identity: %v", err)
+				}
+			}
+			community := types.Community{Name: "Archivists", Type: "interest", MemberIds: []string{alice.Id, bob.Id}}
+			if err := source.GetStorage().CreateCommunity(&community); err != nil {
+				t.Fatalf("Failed to create community: %v", err)
+			}
+			rel := types.Relationship{FromId: alice.Id, ToId: bob.Id, Type: "friend", Strength: 0.5}
+			if err := source.CreateRelationship(&rel); err != nil {
+				t.Fatalf("Failed to create relationship: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := source.BackupTo(&buf); err != nil {
+				t.Fatalf("BackupTo failed: %v", err)
+			}
+			archive := buf.Bytes()
+
+			// Restoring into empty storage brings everything back under the
+			// original IDs
+			target := NewService(newStorage(t))
+			if err := target.RestoreFrom(bytes.NewReader(archive), false); err != nil {
+				t.Fatalf("RestoreFrom failed: %v", err)
+			}
+			if got, err := target.GetPersona(p.Id); err != nil || got.Name != p.Name {
+				t.Errorf("Expected persona %s to be restored, got %+v (%v)", p.Id, got, err)
+			}
+			identities, _ := target.ListIdentities(&types.IdentityFilter{PersonaID: p.Id})
+			if len(identities) != 2 {
+				t.Errorf("Expected 2 restored identities for the persona, got %d", len(identities))
+			}
+			if got, err := target.GetCommunity(community.Id); err != nil || len(got.MemberIds) != 2 {
+				t.Errorf("Expected community %s with 2 members to be restored, got %+v (%v)", community.Id, got, err)
+			}
+			if rels, _ := target.ListRelationships(alice.Id); len(rels) != 1 || rels[0].Id != rel.Id {
+				t.Errorf("Expected relationship %s to be restored, got %+v", rel.Id, rels)
+			}
+
+			// Existing entries are kept unless overwriting
+			changed := p
+			changed.Prompt = "You were changed."
+			if err := target.UpdatePersona(p.Id, changed); err != nil {
+				t.Fatalf("Failed to update persona: %v", err)
+			}
+			if err := target.RestoreFrom(bytes.NewReader(archive), false); err != nil {
+				t.Fatalf("RestoreFrom failed: %v", err)
+			}
+			if got, _ := target.GetPersona(p.Id); got.Prompt != changed.Prompt {
+				t.Errorf("Expected existing persona to be kept, got prompt %q", got.Prompt)
+			}
+			if err := target.RestoreFrom(bytes.NewReader(archive), true); err != nil {
+				t.Fatalf("RestoreFrom with overwrite failed: %v", err)
+			}
+			if got, _ := target.GetPersona(p.Id); got.Prompt != p.Prompt {
+				t.Errorf("Expected overwrite to restore the prompt, got %q", got.Prompt)
+			}
+
+			if err := target.RestoreFrom(strings.NewReader("not an archive"), false); err == nil {
+				t.Error("Expected error restoring from invalid data")
+			}
+		})
+	}
+}
+
+func TestServiceChangeHooks(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	var events, order []types.ChangeEvent
+	service.RegisterHook(func(e types.ChangeEvent) {
+		events = append(events, e)
+	})
+	service.RegisterHook(func(e types.ChangeEvent) {
+		// Runs after the first hook has already recorded the event
+		if len(events) != len(order)+1 {
+			t.Errorf("Expected hooks to run in registration order")
+		}
+		order = append(order, e)
+	})
+
+	p := types.Persona{Name: "Hooked", Topic: "Events", Prompt: "You fire hooks."}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	identity := types.Identity{PersonaId: p.Id, Name: "Listener"}
+	if err := service.CreateIdentity(&identity); err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	if err := service.DeleteIdentity(identity.Id); err != nil {
+		t.Fatalf("Failed to delete identity: %v", err)
+	}
+	if err := service.DeletePersona(p.Id); err != nil {
+		t.Fatalf("Failed to delete persona: %v", err)
+	}
+
+	// Failed operations do not fire hooks
+	if err := service.DeletePersona("missing"); err == nil {
+		t.Error("Expected error deleting a missing persona")
+	}
+
+	expected := []types.ChangeEvent{
+		{Kind: types.ChangeKindPersona, Op: types.ChangeOpCreate, ID: p.Id},
+		{Kind: types.ChangeKindIdentity, Op: types.ChangeOpCreate, ID: identity.Id},
+		{Kind: types.ChangeKindIdentity, Op: types.ChangeOpDelete, ID: identity.Id},
+		{Kind: types.ChangeKindPersona, Op: types.ChangeOpDelete, ID: p.Id},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Event %d: expected %+v, got %+v", i, expected[i], events[i])
+		}
+	}
+}
+
+func TestServicePersonaVersions(t *testing.T) {
+	backends := map[string]func(t *testing.T) storage.Storage{
+		"memory": func(t *testing.T) storage.Storage {
+			return storage.NewMemoryStorage()
+		},
+		"file": func(t *testing.T) storage.Storage {
+			store, err := storage.NewFileStorage(t.TempDir())
+			if err != nil {
+				t.Fatalf("Failed to create file storage: %v", err)
+			}
+			return store
+		},
+	}
+
+	for name, newStorage := range backends {
+		t.Run(name, func(t *testing.T) {
+			service := NewService(newStorage(t))
+
+			p := types.Persona{Name: "First", Topic: "History", Prompt: "You remember."}
+			if err := service.CreatePersona(&p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+
+			versions, err := service.ListPersonaVersions(p.Id)
+			if err != nil {
+				t.Fatalf("Failed to list versions: %v", err)
+			}
+			if len(versions) != 0 {
+				t.Fatalf("Expected no versions before an update, got %d", len(versions))
+			}
+
+			for _, name := range []string{"Second", "Third"} {
+				update := types.Persona{Name: name, Topic: "History", Prompt: "You remember."}
+				if err := service.UpdatePersona(p.Id, update); err != nil {
+					t.Fatalf("Failed to update persona: %v", err)
+				}
+			}
+
+			versions, err = service.ListPersonaVersions(p.Id)
+			if err != nil {
+				t.Fatalf("Failed to list versions: %v", err)
+			}
+			if len(versions) != 2 {
+				t.Fatalf("Expected 2 versions, got %d", len(versions))
+			}
+			for i, expected := range []string{"First", "Second"} {
+				if versions[i].Version != i+1 {
+					t.Errorf("Version %d: expected number %d, got %d", i, i+1, versions[i].Version)
+				}
+				if versions[i].Persona.Name != expected {
+					t.Errorf("Version %d: expected name %s, got %s", i+1, expected, versions[i].Persona.Name)
+				}
+				if versions[i].CreatedAt.IsZero() {
+					t.Errorf("Version %d: expected a timestamp", i+1)
+				}
+			}
+
+			v, err := service.GetPersonaVersion(p.Id, 2)
+			if err != nil {
+				t.Fatalf("Failed to get version 2: %v", err)
+			}
+			if v.Persona.Name != "Second" {
+				t.Errorf("Expected version 2 to be Second, got %s", v.Persona.Name)
+			}
+			if _, err := service.GetPersonaVersion(p.Id, 3); err == nil {
+				t.Error("Expected error for a version beyond the history")
+			}
+
+			if err := service.DeletePersona(p.Id); err != nil {
+				t.Fatalf("Failed to delete persona: %v", err)
+			}
+			if _, err := service.ListPersonaVersions(p.Id); err == nil {
+				t.Error("Expected error listing versions of a deleted persona")
+			}
+		})
+	}
+}
+
+func TestServiceFindDuplicateIdentities(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	p := types.Persona{Name: "Expert", Topic: "Duplicates", Prompt: "You find duplicates."}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	attributes := func(age int32, leaning string, interests ...string) *types.RichAttributes {
+		return &types.RichAttributes{
+			Demographics:    &types.Demographics{Age: age},
+			PoliticalSocial: &types.PoliticalSocial{PoliticalLeaning: leaning},
+			Preferences:     &types.Preferences{Interests: interests},
+		}
+	}
+	alice := types.Identity{PersonaId: p.Id, Name: "Alice", RichAttributes: attributes(34, "liberal", "hiking", "reading", "music")}
+	twin := types.Identity{PersonaId: p.Id, Name: "Alicia", RichAttributes: attributes(35, "liberal", "hiking", "reading", "music")}
+	bob := types.Identity{PersonaId: p.Id, Name: "Bob", RichAttributes: attributes(70, "very_conservative", "gardening")}
+	for _, i := range []*types.Identity{&alice, &twin, &bob} {
+		if err := service.CreateIdentity(i); err != nil {
+			t.Fatalf("Failed to create identity: %v", err)
+		}
+	}
+
+	groups, err := service.FindDuplicateIdentities(0.9)
+	if err != nil {
+		t.Fatalf("Failed to find duplicates: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("Expected 1 group of duplicates, got %v", groups)
+	}
+	expected := []string{alice.Id, twin.Id}
+	slices.Sort(expected)
+	if !slices.Equal(groups[0], expected) {
+		t.Errorf("Expected group %v, got %v", expected, groups[0])
+	}
+
+	// A threshold of 0 links everything that shares any attribute
+	groups, err = service.FindDuplicateIdentities(0)
+	if err != nil {
+		t.Fatalf("Failed to find duplicates: %v", err)
+	}
+	if len(groups) != 1 || len(groups[0]) != 3 {
+		t.Errorf("Expected all 3 identities grouped at threshold 0, got %v", groups)
+	}
+
+	if _, err := service.FindDuplicateIdentities(1.5); err == nil {
+		t.Error("Expected error for threshold above 1")
+	}
+}
+
+func TestServiceRAGDocuments(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	p := types.Persona{Name: "Librarian", Topic: "Research", Prompt: "You know the sources."}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	doc, err := service.AddRAGDocument(p.Id, types.RAGDocument{
+		Title:     "  Field guide ",
+		Content:   "Frogs are amphibians.",
+		Embedding: []float32{0.1, 0.2},
+	})
+	if err != nil {
+		t.Fatalf("Failed to add RAG document: %v", err)
+	}
+	if doc.Id == "" {
+		t.Error("Expected a generated document ID")
+	}
+	if doc.Title != "Field guide" {
+		t.Errorf("Expected sanitized title, got %q", doc.Title)
+	}
+	if _, err := service.AddRAGDocument(p.Id, types.RAGDocument{Id: "notes", Source: "https://example.com/notes"}); err != nil {
+		t.Fatalf("Failed to add RAG document: %v", err)
+	}
+
+	docs, err := service.ListRAGDocuments(p.Id)
+	if err != nil {
+		t.Fatalf("Failed to list RAG documents: %v", err)
+	}
+	if len(docs) != 2 || docs[0].Id != doc.Id || docs[1].Id != "notes" {
+		t.Fatalf("Expected both documents in insertion order, got %+v", docs)
+	}
+
+	if _, err := service.AddRAGDocument(p.Id, types.RAGDocument{Id: "notes", Content: "again"}); !errors.Is(err, errs.ErrConflict) {
+		t.Errorf("Expected conflict for duplicate document ID, got %v", err)
+	}
+	if _, err := service.AddRAGDocument(p.Id, types.RAGDocument{Title: "Empty"}); err == nil {
+		t.Error("Expected validation error for document without content or source")
+	}
+
+	if err := service.RemoveRAGDocument(p.Id, doc.Id); err != nil {
+		t.Fatalf("Failed to remove RAG document: %v", err)
+	}
+	docs, err = service.ListRAGDocuments(p.Id)
+	if err != nil {
+		t.Fatalf("Failed to list RAG documents: %v", err)
+	}
+	if len(docs) != 1 || docs[0].Id != "notes" {
+		t.Errorf("Expected only the notes document to remain, got %+v", docs)
+	}
+
+	if err := service.RemoveRAGDocument(p.Id, doc.Id); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("Expected not found removing a missing document, got %v", err)
+	}
+	if _, err := service.ListRAGDocuments("missing"); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("Expected not found for unknown persona, got %v", err)
+	}
+
+	// The legacy RAG field is left alone
+	stored, err := service.GetPersona(p.Id)
+	if err != nil {
+		t.Fatalf("Failed to get persona: %v", err)
+	}
+	if len(stored.Rag) != 0 {
+		t.Errorf("Expected legacy RAG field to stay empty, got %v", stored.Rag)
+	}
+}
+
+func TestMeasurePrompt(t *testing.T) {
+	p := types.Persona{
+		Prompt:  "You are a helpful Go expert.", // 28 characters, 6 words
+		Context: map[string]string{"level": "senior", "style": "short answers"},
+	}
+
+	size := MeasurePrompt(p)
+	want := PromptSize{Characters: 28 + 6 + 13, Words: 6 + 1 + 2, EstimatedTokens: 7 + 2 + 4}
+	if size != want {
+		t.Errorf("Expected %+v, got %+v", want, size)
+	}
+
+	if got := EstimateTokens(""); got != 0 {
+		t.Errorf("Expected no tokens for empty text, got %d", got)
+	}
+	if got := EstimateTokens("héllo"); got != 2 {
+		t.Errorf("Expected characters rather than bytes to be counted, got %d tokens", got)
+	}
+}
+
+func TestServiceSampleIdentities(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	sampled := types.Persona{Name: "Sampled", Topic: "Sampling", Prompt: "You get sampled."}
+	other := types.Persona{Name: "Other", Topic: "Sampling", Prompt: "You do not."}
+	for _, p := range []*types.Persona{&sampled, &other} {
+		if err := service.CreatePersona(p); err != nil {
+			t.Fatalf("Failed to create persona: %v", err)
+		}
+	}
+	for i := 0; i < 6; i++ {
+		for _, p := range []types.Persona{sampled, other} {
+			identity := types.Identity{PersonaId: p.Id, Name: fmt.Sprintf("%s %d", p.Name, i)}
+			if i%2 == 0 {
+				identity.Tags = []string{"even"}
+			}
+			if err := service.CreateIdentity(&identity); err != nil {
+				t.Fatalf("Failed to create identity: %v", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter *types.IdentityFilter
+		total  int
+	}{
+		{"no filter", nil, 12},
+		{"persona", &types.IdentityFilter{PersonaID: sampled.Id}, 6},
+		{"persona and tag", &types.IdentityFilter{PersonaID: sampled.Id, Tags: []string{"even"}}, 3},
+		{"no match", &types.IdentityFilter{Tags: []string{"odd"}}, 0},
+	}
+	for _, tt := range tests {
+		for _, n := range []int{0, 2, 5, 20} {
+			sample, err := service.SampleIdentities(tt.filter, n)
+			if err != nil {
+				t.Fatalf("%s: failed to sample %d: %v", tt.name, n, err)
+			}
+			if len(sample) != min(n, tt.total) {
+				t.Errorf("%s: expected %d identities for n=%d, got %d", tt.name, min(n, tt.total), n, len(sample))
+			}
+			seen := make(map[string]bool)
+			for _, i := range sample {
+				if seen[i.Id] {
+					t.Errorf("%s: identity %s sampled twice", tt.name, i.Id)
+				}
+				seen[i.Id] = true
+				if tt.filter != nil && tt.filter.PersonaID != "" && i.PersonaId != tt.filter.PersonaID {
+					t.Errorf("%s: sampled identity of persona %s", tt.name, i.PersonaId)
+				}
+				if tt.filter != nil && len(tt.filter.Tags) > 0 && !slices.Contains(i.Tags, "even") {
+					t.Errorf("%s: sampled identity without the tag: %+v", tt.name, i)
+				}
+			}
+		}
+	}
+
+	// The same seed picks the same identities in the same order
+	ids := func(identities []types.Identity) []string {
+		var result []string
+		for _, i := range identities {
+			result = append(result, i.Id)
+		}
+		return result
+	}
+	first, err := service.SampleIdentitiesSeeded(nil, 5, 42)
+	if err != nil {
+		t.Fatalf("Failed to sample: %v", err)
+	}
+	second, err := service.SampleIdentitiesSeeded(nil, 5, 42)
+	if err != nil {
+		t.Fatalf("Failed to sample: %v", err)
+	}
+	if len(first) != 5 || !slices.Equal(ids(first), ids(second)) {
+		t.Errorf("Expected the same sample for the same seed, got %v and %v", ids(first), ids(second))
+	}
+
+	if _, err := service.SampleIdentities(nil, -1); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("Expected a validation error for a negative size, got %v", err)
+	}
+}
+
+func TestServiceGetSystemStats(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	service := NewService(store)
+
+	stats, err := service.GetSystemStats()
+	if err != nil {
+		t.Fatalf("GetSystemStats failed: %v", err)
+	}
+	if stats.TotalPersonas != 0 || stats.MostCommonTopic != "" || stats.AverageCommunitySize != 0 {
+		t.Errorf("Expected empty stats for an empty dataset, got %+v", stats)
+	}
+
+	var personas []types.Persona
+	for _, topic := range []string{"Chemistry", "Physics", "Physics", "Biology", "Physics"} {
+		p := types.Persona{Name: topic + " Expert", Topic: topic, Prompt: "You know " + topic + "."}
+		if err := service.CreatePersona(&p); err != nil {
+			t.Fatalf("Failed to create persona: %v", err)
+		}
+		personas = append(personas, p)
+	}
+	var identityIDs []string
+	for i := 0; i < 4; i++ {
+		identity := types.Identity{PersonaId: personas[i%2].Id, Name: fmt.Sprintf("Member %d", i)}
+		if err := service.CreateIdentity(&identity); err != nil {
+			t.Fatalf("Failed to create identity: %v", err)
+		}
+		identityIDs = append(identityIDs, identity.Id)
+	}
+	for _, members := range [][]string{identityIDs[:3], identityIDs[3:]} {
+		c := &types.Community{Name: "Community", Type: "interest", MemberIds: members, Size: len(members)}
+		if err := store.CreateCommunity(c); err != nil {
+			t.Fatalf("Failed to create community: %v", err)
+		}
+	}
+
+	stats, err = service.GetSystemStats()
+	if err != nil {
+		t.Fatalf("GetSystemStats failed: %v", err)
+	}
+	if stats.TotalPersonas != 5 {
+		t.Errorf("Expected 5 personas, got %d", stats.TotalPersonas)
+	}
+	if stats.TotalIdentities != 4 {
+		t.Errorf("Expected 4 identities, got %d", stats.TotalIdentities)
+	}
+	if stats.TotalCommunities != 2 {
+		t.Errorf("Expected 2 communities, got %d", stats.TotalCommunities)
+	}
+	if stats.AverageCommunitySize != 2 {
+		t.Errorf("Expected an average community size of 2, got %v", stats.AverageCommunitySize)
+	}
+	if stats.MostCommonTopic != "Physics" || stats.MostCommonTopicCount != 3 {
+		t.Errorf("Expected Physics (3) as the most common topic, got %s (%d)", stats.MostCommonTopic, stats.MostCommonTopicCount)
+	}
+	if stats.GeneratedAt.IsZero() {
+		t.Error("Expected GeneratedAt to be set")
+	}
+}
+
+func TestDiffPersonas(t *testing.T) {
+	a := types.Persona{
+		Id:      "a",
+		Name:    "Expert",
+		Topic:   "Security",
+		Prompt:  "You are careful.",
+		Context: map[string]string{"tone": "formal", "level": "senior", "region": "EU"},
+		Rag:     []string{"owasp"},
+	}
+	b := a
+	b.Id = "b"
+	b.Context = map[string]string{"tone": "casual", "level": "senior", "focus": "web"}
+	b.Rag = []string{"owasp", "cwe"}
+
+	diff := DiffPersonas(a, b)
+	if diff.From != "a" || diff.To != "b" || diff.Identical {
+		t.Errorf("Unexpected diff header: %+v", diff)
+	}
+	if len(diff.Fields) != 0 {
+		t.Errorf("Expected no scalar changes, got %+v", diff.Fields)
+	}
+	if got := diff.ContextChanged["tone"]; got.From != "formal" || got.To != "casual" || len(diff.ContextChanged) != 1 {
+		t.Errorf("Expected only tone to change, got %+v", diff.ContextChanged)
+	}
+	if len(diff.ContextAdded) != 1 || diff.ContextAdded["focus"] != "web" {
+		t.Errorf("Expected focus to be added, got %+v", diff.ContextAdded)
+	}
+	if len(diff.ContextRemoved) != 1 || diff.ContextRemoved["region"] != "EU" {
+		t.Errorf("Expected region to be removed, got %+v", diff.ContextRemoved)
+	}
+	if !slices.Equal(diff.RagAdded, []string{"cwe"}) || diff.RagRemoved != nil {
+		t.Errorf("Expected cwe to be added to RAG, got added %v removed %v", diff.RagAdded, diff.RagRemoved)
+	}
+
+	c := a
+	c.Prompt = "You are thorough."
+	diff = DiffPersonas(a, c)
+	if len(diff.Fields) != 1 || diff.Fields[0] != (types.FieldChange{Field: "prompt", From: a.Prompt, To: c.Prompt}) {
+		t.Errorf("Expected only the prompt to change, got %+v", diff.Fields)
+	}
+	if diff := DiffPersonas(a, a); !diff.Identical {
+		t.Errorf("Expected a persona to be identical to itself, got %+v", diff)
+	}
+}
+
+func TestServiceDiffPersonaVersion(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	p := types.Persona{Name: "Expert", Topic: "Security", Prompt: "You are careful.", Rag: []string{"owasp"}}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	updated := p
+	updated.Version = 0
+	updated.Rag = []string{"owasp", "cwe"}
+	if err := service.UpdatePersona(p.Id, updated); err != nil {
+		t.Fatalf("Failed to update persona: %v", err)
+	}
+
+	diff, err := service.DiffPersonaVersion(p.Id, 1)
+	if err != nil {
+		t.Fatalf("DiffPersonaVersion failed: %v", err)
+	}
+	if !slices.Equal(diff.RagAdded, []string{"cwe"}) || diff.From != p.Id+"@1" || diff.To != p.Id {
+		t.Errorf("Expected cwe to be added since version 1, got %+v", diff)
+	}
+	if _, err := service.DiffPersonaVersion(p.Id, 2); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("Expected not found for a missing version, got %v", err)
+	}
+	if _, err := service.DiffPersona(p.Id, "missing"); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("Expected not found for a missing persona, got %v", err)
+	}
+}
+
+func TestServiceRestoreFromPurgesCache(t *testing.T) {
+	service := NewService(storage.NewCachingStorage(storage.NewMemoryStorage(), 10))
+
+	p := types.Persona{Name: "Original", Topic: "Caching", Prompt: "You are the original."}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := service.BackupTo(&buf); err != nil {
+		t.Fatalf("BackupTo failed: %v", err)
+	}
+
+	changed := p
+	changed.Version = 0
+	changed.Name = "Changed"
+	if err := service.UpdatePersona(p.Id, changed); err != nil {
+		t.Fatalf("Failed to update persona: %v", err)
+	}
+	if got, _ := service.GetPersona(p.Id); got.Name != "Changed" {
+		t.Fatalf("Expected the update to be visible, got %q", got.Name)
+	}
+
+	if err := service.RestoreFrom(&buf, true); err != nil {
+		t.Fatalf("RestoreFrom failed: %v", err)
+	}
+	if got, _ := service.GetPersona(p.Id); got.Name != "Original" {
+		t.Errorf("Expected the restored persona rather than a cached copy, got %q", got.Name)
+	}
+}
+
+func TestServiceFeaturedPersonas(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	var ids []string
+	for _, name := range []string{"Alpha", "Beta", "Gamma"} {
+		p := types.Persona{Name: name, Topic: "Featuring", Prompt: "You are " + name + "."}
+		if err := service.CreatePersona(&p); err != nil {
+			t.Fatalf("Failed to create persona: %v", err)
+		}
+		ids = append(ids, p.Id)
+	}
+
+	if _, err := service.FeaturePersona(ids[2], 1); err != nil {
+		t.Fatalf("FeaturePersona failed: %v", err)
+	}
+	if _, err := service.FeaturePersona(ids[1], 2); err != nil {
+		t.Fatalf("FeaturePersona failed: %v", err)
+	}
+
+	names := func(personas []types.Persona) []string {
+		var out []string
+		for _, p := range personas {
+			out = append(out, p.Name)
+		}
+		return out
+	}
+	personas, err := service.ListPersonas()
+	if err != nil {
+		t.Fatalf("ListPersonas failed: %v", err)
+	}
+	SortFeaturedFirst(personas)
+	if got := names(personas); !slices.Equal(got, []string{"Gamma", "Beta", "Alpha"}) {
+		t.Errorf("Expected featured personas first in feature order, got %v", got)
+	}
+
+	// Updating a featured persona keeps it featured
+	p, _ := service.GetPersona(ids[2])
+	p.Version = 0
+	p.Featured = false
+	p.Prompt = "You are still Gamma."
+	if err := service.UpdatePersona(ids[2], p); err != nil {
+		t.Fatalf("Failed to update persona: %v", err)
+	}
+	featured, err := service.ListFeaturedPersonas()
+	if err != nil {
+		t.Fatalf("ListFeaturedPersonas failed: %v", err)
+	}
+	if got := names(featured); !slices.Equal(got, []string{"Gamma", "Beta"}) {
+		t.Errorf("Expected Gamma and Beta to stay featured, got %v", got)
+	}
+
+	unfeatured, err := service.UnfeaturePersona(ids[2])
+	if err != nil {
+		t.Fatalf("UnfeaturePersona failed: %v", err)
+	}
+	if unfeatured.Featured || unfeatured.FeatureOrder != 0 {
+		t.Errorf("Expected the featured mark to be cleared, got %+v", unfeatured)
+	}
+	personas, _ = service.ListPersonas()
+	SortFeaturedFirst(personas)
+	if personas[0].Name != "Beta" {
+		t.Errorf("Expected Beta to be listed first once Gamma is unfeatured, got %v", names(personas))
+	}
+
+	if _, err := service.FeaturePersona("missing", 0); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("Expected not found for a missing persona, got %v", err)
+	}
+}
+
+func TestServiceApplyBatch(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+	service.SetSoftDelete(true)
+
+	base := types.Persona{Name: "Base", Topic: "Sync", Prompt: "You are the base."}
+	if err := service.CreatePersona(&base); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	gone := types.Persona{Name: "Gone", Topic: "Sync", Prompt: "You are going."}
+	if err := service.CreatePersona(&gone); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	renamed := base
+	renamed.Version = 0
+	renamed.Name = "Renamed"
+	results, applied := service.ApplyBatch([]types.BatchOperation{
+		{Kind: types.BatchCreateIdentity, Identity: &types.Identity{PersonaId: base.Id, Name: "Member"}},
+		{Kind: types.BatchUpdatePersona, Id: base.Id, Persona: &renamed},
+		{Kind: types.BatchDeletePersona, Id: gone.Id},
+		{Kind: types.BatchDeleteIdentity, Id: "missing"},
+		{Kind: types.BatchCreatePersona, Persona: &types.Persona{Name: "Never", Topic: "Sync", Prompt: "You never exist."}},
+	})
+	if applied {
+		t.Fatal("Expected the batch not to be applied")
+	}
+	for idx, want := range []types.BatchOperationResult{
+		{Index: 0, RolledBack: true},
+		{Index: 1, Id: base.Id, RolledBack: true},
+		{Index: 2, Id: gone.Id, RolledBack: true},
+		{Index: 3},
+		{Index: 4, Skipped: true},
+	} {
+		got := results[idx]
+		if got.Index != want.Index || got.RolledBack != want.RolledBack || got.Skipped != want.Skipped {
+			t.Errorf("Result %d: expected %+v, got %+v", idx, want, got)
+		}
+	}
+	if results[3].Error == "" {
+		t.Errorf("Expected the missing identity to be reported, got %+v", results[3])
+	}
+
+	if p, _ := service.GetPersona(base.Id); p.Name != "Base" {
+		t.Errorf("Expected the update to be undone, got %q", p.Name)
+	}
+	if _, err := service.GetPersona(gone.Id); err != nil {
+		t.Errorf("Expected the soft delete to be undone, got %v", err)
+	}
+	if identities, _ := service.ListIdentities(nil); len(identities) != 0 {
+		t.Errorf("Expected the created identity to be removed, got %d", len(identities))
+	}
+	if personas, _ := service.ListPersonas(); len(personas) != 2 {
+		t.Errorf("Expected no persona to be created, got %d", len(personas))
+	}
+
+	results, applied = service.ApplyBatch([]types.BatchOperation{
+		{Kind: types.BatchCreateIdentity, Identity: &types.Identity{PersonaId: base.Id, Name: "Member"}},
+		{Kind: types.BatchDeletePersona, Id: gone.Id},
+	})
+	if !applied || results[0].Id == "" || results[0].Error != "" || results[1].Error != "" {
+		t.Errorf("Expected the batch to be applied, got %+v", results)
+	}
+}
+
+// racingStorage applies a concurrent edit just before each of the first
+// races persona updates
+type racingStorage struct {
+	*storage.MemoryStorage
+	races int
+}
+
+func (r *racingStorage) Update(id string, p types.Persona) error {
+	if r.races > 0 {
+		r.races--
+		current, err := r.MemoryStorage.Get(id)
+		if err != nil {
+			return err
+		}
+		current.Version = 0
+		current.Prompt = "Edited concurrently."
+		if err := r.MemoryStorage.Update(id, current); err != nil {
+			return err
+		}
+	}
+	return r.MemoryStorage.Update(id, p)
+}
+
+func TestServiceFeaturePersonaKeepsConcurrentEdits(t *testing.T) {
+	store := &racingStorage{MemoryStorage: storage.NewMemoryStorage()}
+	service := NewService(store)
+
+	p := types.Persona{Name: "Raced", Topic: "Featuring", Prompt: "You are raced."}
+	if err := service.CreatePersona(&p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	store.races = 1
+	featured, err := service.FeaturePersona(p.Id, 1)
+	if err != nil {
+		t.Fatalf("FeaturePersona failed: %v", err)
+	}
+	if !featured.Featured || featured.Prompt != "Edited concurrently." {
+		t.Errorf("Expected the concurrent edit to be kept, got %+v", featured)
+	}
+
+	store.races = featureAttempts
+	if _, err := service.UnfeaturePersona(p.Id); !errors.Is(err, storage.ErrVersionConflict) {
+		t.Errorf("Expected a version conflict when the persona keeps changing, got %v", err)
+	}
+}
+
+// undeletableIdentities fails every identity delete
+type undeletableIdentities struct {
+	*storage.MemoryStorage
+}
+
+func (u *undeletableIdentities) DeleteIdentity(id string) error {
+	return errors.New("disk full")
+}
+
+func TestServiceApplyBatchRollbackFailure(t *testing.T) {
+	service := NewService(&undeletableIdentities{MemoryStorage: storage.NewMemoryStorage()})
+
+	base := types.Persona{Name: "Base", Topic: "Sync", Prompt: "You are the base."}
+	if err := service.CreatePersona(&base); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	results, applied := service.ApplyBatch([]types.BatchOperation{
+		{Kind: types.BatchCreateIdentity, Identity: &types.Identity{PersonaId: base.Id, Name: "Stuck"}},
+		{Kind: types.BatchCreatePersona, Persona: &types.Persona{Name: "Undone", Topic: "Sync", Prompt: "You are undone."}},
+		{Kind: types.BatchDeletePersona, Id: "missing"},
+	})
+	if applied {
+		t.Fatal("Expected the batch not to be applied")
+	}
+	if results[0].RolledBack || !strings.Contains(results[0].Error, "rollback failed") {
+		t.Errorf("Expected the failed undo to be reported, got %+v", results[0])
+	}
+	if !results[1].RolledBack || results[1].Error != "" {
+		t.Errorf("Expected the persona create to be rolled back, got %+v", results[1])
+	}
+	if identities, _ := service.ListIdentities(nil); len(identities) != 1 {
+		t.Errorf("Expected the identity whose undo failed to remain, got %d", len(identities))
 	}
 }
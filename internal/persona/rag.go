@@ -0,0 +1,65 @@
+package persona
+
+import (
+	"slices"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/ids"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// AddRAGDocument attaches doc to a persona and returns it as stored. A
+// document without an ID gets a generated one. The persona is updated
+// through UpdatePersona, so the change is versioned like any other edit.
+func (s *Service) AddRAGDocument(personaID string, doc types.RAGDocument) (types.RAGDocument, error) {
+	p, err := s.activePersona(personaID)
+	if err != nil {
+		return types.RAGDocument{}, err
+	}
+
+	if doc.Id == "" {
+		doc.Id = ids.New()
+	}
+	for _, existing := range p.RagDocuments {
+		if existing.Id == doc.Id {
+			return types.RAGDocument{}, errs.Conflict("RAG document already exists: %s", doc.Id)
+		}
+	}
+
+	p.RagDocuments = append(slices.Clone(p.RagDocuments), doc)
+	middleware.SanitizePersona(&p)
+	if err := s.UpdatePersona(personaID, p); err != nil {
+		return types.RAGDocument{}, err
+	}
+	return p.RagDocuments[len(p.RagDocuments)-1], nil
+}
+
+// ListRAGDocuments returns the documents attached to a persona
+func (s *Service) ListRAGDocuments(personaID string) ([]types.RAGDocument, error) {
+	p, err := s.activePersona(personaID)
+	if err != nil {
+		return nil, err
+	}
+	if p.RagDocuments == nil {
+		return []types.RAGDocument{}, nil
+	}
+	return p.RagDocuments, nil
+}
+
+// RemoveRAGDocument detaches the document with the given ID from a persona
+func (s *Service) RemoveRAGDocument(personaID, docID string) error {
+	p, err := s.activePersona(personaID)
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(p.RagDocuments, func(doc types.RAGDocument) bool {
+		return doc.Id == docID
+	})
+	if i < 0 {
+		return errs.NotFound("RAG document not found: %s", docID)
+	}
+	p.RagDocuments = slices.Delete(slices.Clone(p.RagDocuments), i, i+1)
+	return s.UpdatePersona(personaID, p)
+}
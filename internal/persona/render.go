@@ -0,0 +1,86 @@
+package persona
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// RenderOptions controls how a persona is rendered into a system prompt.
+type RenderOptions struct {
+	// IncludeRAG appends the persona's RAG documents to the rendered prompt.
+	IncludeRAG bool
+}
+
+// DefaultRenderOptions returns the default rendering options, which include
+// RAG documents in the rendered prompt.
+func DefaultRenderOptions() RenderOptions {
+	return RenderOptions{IncludeRAG: true}
+}
+
+// OpenAIAssistant is the subset of the OpenAI assistant object that can be
+// derived from a persona.
+type OpenAIAssistant struct {
+	Name         string            `json:"name"`
+	Description  string            `json:"description,omitempty"`
+	Instructions string            `json:"instructions"`
+	Model        string            `json:"model,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+// RenderPersonaPrompt renders a persona into a single system prompt.
+//
+// The rendered prompt starts with the persona's prompt, followed by its
+// context as sorted "key: value" lines. When opts.IncludeRAG is set, RAG
+// documents are appended as a reference list.
+//
+// Example:
+//
+//	prompt := persona.RenderPersonaPrompt(p, persona.RenderOptions{IncludeRAG: false})
+func RenderPersonaPrompt(p types.Persona, opts RenderOptions) string {
+	var b strings.Builder
+	b.WriteString(p.Prompt)
+
+	if len(p.Context) > 0 {
+		keys := make([]string, 0, len(p.Context))
+		for key := range p.Context {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("\n\nContext:\n")
+		for _, key := range keys {
+			b.WriteString(key + ": " + p.Context[key] + "\n")
+		}
+	}
+
+	if opts.IncludeRAG && len(p.Rag) > 0 {
+		if len(p.Context) == 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("\nReference material:\n")
+		for _, doc := range p.Rag {
+			b.WriteString("- " + doc + "\n")
+		}
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// ExportPersonaOpenAI converts a persona into an OpenAI assistant definition.
+//
+// The rendered prompt (see RenderPersonaPrompt) becomes the assistant's
+// instructions, the topic its description, and the persona ID is recorded
+// in the metadata.
+func ExportPersonaOpenAI(p types.Persona, opts RenderOptions) OpenAIAssistant {
+	assistant := OpenAIAssistant{
+		Name:         p.Name,
+		Description:  p.Topic,
+		Instructions: RenderPersonaPrompt(p, opts),
+	}
+	if p.Id != "" {
+		assistant.Metadata = map[string]string{"persona_id": p.Id}
+	}
+	return assistant
+}
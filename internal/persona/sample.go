@@ -0,0 +1,61 @@
+package persona
+
+import (
+	"crypto/rand"
+	"math/big"
+	mathrand "math/rand"
+	"slices"
+	"strings"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// SampleIdentities returns n identities matching filter, picked at random
+// without replacement using crypto/rand. Fewer are returned when fewer
+// match.
+func (s *Service) SampleIdentities(filter *types.IdentityFilter, n int) ([]types.Identity, error) {
+	return s.sampleIdentities(filter, n, cryptoIntn)
+}
+
+// SampleIdentitiesSeeded is SampleIdentities with a deterministic choice:
+// the same seed over the same stored identities returns the same sample.
+func (s *Service) SampleIdentitiesSeeded(filter *types.IdentityFilter, n int, seed int64) ([]types.Identity, error) {
+	return s.sampleIdentities(filter, n, mathrand.New(mathrand.NewSource(seed)).Intn)
+}
+
+func (s *Service) sampleIdentities(filter *types.IdentityFilter, n int, intn func(int) int) ([]types.Identity, error) {
+	if n < 0 {
+		return nil, errs.Validation("sample size must not be negative")
+	}
+
+	identities, err := s.storage.ListIdentities(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Storage order is not guaranteed, so fix it before drawing
+	slices.SortFunc(identities, func(a, b types.Identity) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+
+	// Partial Fisher-Yates shuffle of the first n positions
+	n = min(n, len(identities))
+	if n == 0 {
+		return []types.Identity{}, nil
+	}
+	for i := 0; i < n; i++ {
+		j := i + intn(len(identities)-i)
+		identities[i], identities[j] = identities[j], identities[i]
+	}
+	return identities[:n:n], nil
+}
+
+// cryptoIntn returns a uniformly random int in [0, max) from crypto/rand
+func cryptoIntn(max int) int {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		panic(err)
+	}
+	return int(n.Int64())
+}
@@ -0,0 +1,44 @@
+package persona
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// charsPerToken is the average number of characters in an LLM token for
+// English text, used by EstimateTokens
+const charsPerToken = 4
+
+// PromptSize describes how much text a persona contributes to an LLM
+// context window
+type PromptSize struct {
+	Characters      int `json:"characters"`
+	Words           int `json:"words"`
+	EstimatedTokens int `json:"estimated_tokens"` // approximate, see EstimateTokens
+}
+
+// EstimateTokens approximates how many tokens text takes up, at one token
+// per four characters rounded up. Real counts depend on the model's
+// tokenizer and can differ noticeably for code or non-English text.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// MeasurePrompt sizes a persona's prompt plus its context values. Each piece
+// is estimated separately, since every one of them costs at least a token.
+func MeasurePrompt(p types.Persona) PromptSize {
+	var size PromptSize
+	add := func(text string) {
+		size.Characters += utf8.RuneCountInString(text)
+		size.Words += len(strings.Fields(text))
+		size.EstimatedTokens += EstimateTokens(text)
+	}
+
+	add(p.Prompt)
+	for _, value := range p.Context {
+		add(value)
+	}
+	return size
+}
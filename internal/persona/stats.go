@@ -0,0 +1,53 @@
+package persona
+
+import (
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/storage"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// GetSystemStats summarizes the whole dataset. Soft-deleted personas are
+// not counted. Identities are counted without loading them when the storage
+// backend supports it.
+func (s *Service) GetSystemStats() (*types.SystemStats, error) {
+	personas, err := s.storage.List()
+	if err != nil {
+		return nil, err
+	}
+	identities, err := storage.CountIdentities(s.storage)
+	if err != nil {
+		return nil, err
+	}
+	communities, err := s.storage.ListCommunities(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &types.SystemStats{
+		TotalPersonas:    len(personas),
+		TotalIdentities:  identities,
+		TotalCommunities: len(communities),
+		GeneratedAt:      time.Now(),
+	}
+
+	topics := make(map[string]int)
+	for _, p := range personas {
+		topics[p.Topic]++
+	}
+	for topic, count := range topics {
+		if count > stats.MostCommonTopicCount || (count == stats.MostCommonTopicCount && topic < stats.MostCommonTopic) {
+			stats.MostCommonTopic = topic
+			stats.MostCommonTopicCount = count
+		}
+	}
+
+	if len(communities) > 0 {
+		members := 0
+		for _, c := range communities {
+			members += len(c.MemberIds)
+		}
+		stats.AverageCommunitySize = float64(members) / float64(len(communities))
+	}
+	return stats, nil
+}
@@ -0,0 +1,59 @@
+package persona
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/middleware"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// AddIdentityTag adds a tag to an identity and returns the identity. Adding
+// a tag it already has changes nothing. The read-modify-write happens
+// atomically in storage, so tags added or removed concurrently by other
+// clients are kept, unlike with a full update.
+func (s *Service) AddIdentityTag(id, tag string) (types.Identity, error) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return types.Identity{}, errs.Validation("tag is required")
+	}
+
+	return s.modifyIdentityTags(id, func(i *types.Identity) (bool, error) {
+		if slices.Contains(i.Tags, tag) {
+			return false, nil
+		}
+		i.Tags = append(i.Tags, tag)
+		return true, middleware.ValidateIdentity(i)
+	})
+}
+
+// RemoveIdentityTag removes a tag from an identity and returns the identity.
+// Removing a tag it does not have changes nothing. Like AddIdentityTag, the
+// change is atomic.
+func (s *Service) RemoveIdentityTag(id, tag string) (types.Identity, error) {
+	tag = strings.TrimSpace(tag)
+	return s.modifyIdentityTags(id, func(i *types.Identity) (bool, error) {
+		before := len(i.Tags)
+		i.Tags = slices.DeleteFunc(i.Tags, func(t string) bool { return t == tag })
+		return len(i.Tags) != before, nil
+	})
+}
+
+// modifyIdentityTags applies modify through storage and announces the
+// change when there was one
+func (s *Service) modifyIdentityTags(id string, modify func(i *types.Identity) (bool, error)) (types.Identity, error) {
+	changed := false
+	i, err := s.storage.ModifyIdentity(id, func(i *types.Identity) (bool, error) {
+		var err error
+		changed, err = modify(i)
+		return changed, err
+	})
+	if err != nil {
+		return types.Identity{}, err
+	}
+	if changed {
+		s.notify(types.ChangeKindIdentity, types.ChangeOpUpdate, id)
+	}
+	return i, nil
+}
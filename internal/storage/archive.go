@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// Archiver is implemented by storage backends that can write their entire
+// contents to a tar.gz archive and load such an archive back
+type Archiver interface {
+	// BackupTo writes every persona, identity, community and relationship,
+	// soft-deleted personas included, to w
+	BackupTo(w io.Writer) error
+
+	// RestoreFrom loads an archive written by BackupTo. Entities keep their
+	// IDs; ones that already exist are skipped unless overwrite is true.
+	RestoreFrom(r io.Reader, overwrite bool) error
+}
+
+// Archive directories, one per entity type, matching the FileStorage data
+// directory layout. Each entry is stored as <dir>/<id>.json.
+const (
+	archivePersonas      = "personas"
+	archiveIdentities    = "identities"
+	archiveCommunities   = "communities"
+	archiveRelationships = "relationships"
+)
+
+// archive holds the entities read from a backup archive
+type archive struct {
+	personas      []types.Persona
+	identities    []types.Identity
+	communities   []types.Community
+	relationships []types.Relationship
+}
+
+// archiveWriter writes JSON entries to a tar.gz stream
+type archiveWriter struct {
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	modTime time.Time
+}
+
+func newArchiveWriter(w io.Writer) *archiveWriter {
+	gz := gzip.NewWriter(w)
+	return &archiveWriter{gz: gz, tw: tar.NewWriter(gz), modTime: time.Now()}
+}
+
+// add writes data as the entry <dir>/<id>.json
+func (a *archiveWriter) add(dir, id string, data []byte) error {
+	header := &tar.Header{
+		Name:    dir + "/" + id + ".json",
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: a.modTime,
+	}
+	if err := a.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive entry %s: %v", header.Name, err)
+	}
+	if _, err := a.tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write archive entry %s: %v", header.Name, err)
+	}
+	return nil
+}
+
+// addJSON marshals v and writes it as the entry <dir>/<id>.json
+func (a *archiveWriter) addJSON(dir, id string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s entry %s: %v", dir, id, err)
+	}
+	return a.add(dir, id, data)
+}
+
+// Close flushes the tar and gzip streams
+func (a *archiveWriter) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %v", err)
+	}
+	if err := a.gz.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %v", err)
+	}
+	return nil
+}
+
+// readArchive parses a whole tar.gz archive written by an Archiver. Any
+// unexpected entry, or one whose ID does not match its file name, rejects
+// the archive before anything is restored.
+func readArchive(r io.Reader) (*archive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer gz.Close()
+
+	a := &archive{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %v", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		dir, file := path.Split(path.Clean(header.Name))
+		dir = strings.TrimSuffix(dir, "/")
+		id := strings.TrimSuffix(file, ".json")
+		if header.Typeflag != tar.TypeReg || id == "" || id == file {
+			return nil, fmt.Errorf("unexpected archive entry: %s", header.Name)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive entry %s: %v", header.Name, err)
+		}
+
+		var entryID string
+		switch dir {
+		case archivePersonas:
+			var p types.Persona
+			err = json.Unmarshal(data, &p)
+			entryID = p.Id
+			a.personas = append(a.personas, p)
+		case archiveIdentities:
+			var i types.Identity
+			err = json.Unmarshal(data, &i)
+			entryID = i.Id
+			a.identities = append(a.identities, i)
+		case archiveCommunities:
+			var c types.Community
+			err = json.Unmarshal(data, &c)
+			entryID = c.Id
+			a.communities = append(a.communities, c)
+		case archiveRelationships:
+			var rel types.Relationship
+			err = json.Unmarshal(data, &rel)
+			entryID = rel.Id
+			a.relationships = append(a.relationships, rel)
+		default:
+			return nil, fmt.Errorf("unexpected archive entry: %s", header.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse archive entry %s: %v", header.Name, err)
+		}
+		if entryID != id {
+			return nil, fmt.Errorf("archive entry %s has ID %q", header.Name, entryID)
+		}
+	}
+	return a, nil
+}
@@ -0,0 +1,20 @@
+package storage
+
+import "github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+
+// AvatarStore is implemented by storage backends that can keep an image
+// for each identity. Deleting an identity deletes its avatar.
+type AvatarStore interface {
+	// SaveIdentityAvatar stores the avatar of an existing identity,
+	// replacing any previous one
+	SaveIdentityAvatar(identityID string, avatar types.Avatar) error
+	GetIdentityAvatar(identityID string) (types.Avatar, error)
+	DeleteIdentityAvatar(identityID string) error
+}
+
+// avatarExtensions maps the avatar content types to the file extensions
+// FileStorage stores them under
+var avatarExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/ids"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// PersonaBackup is a snapshot of a persona taken before it was changed
+type PersonaBackup struct {
+	Id        string        `json:"id"`
+	PersonaId string        `json:"persona_id"`
+	Reason    string        `json:"reason"` // update, delete
+	CreatedAt time.Time     `json:"created_at"`
+	Persona   types.Persona `json:"persona"`
+}
+
+// BackupStore keeps file-based persona snapshots, one directory per persona
+type BackupStore struct {
+	dir        string
+	maxBackups int
+	mu         sync.Mutex
+}
+
+// NewBackupStore creates a backup store rooted at dir that keeps at most
+// maxBackups snapshots per persona
+func NewBackupStore(dir string, maxBackups int) (*BackupStore, error) {
+	if maxBackups <= 0 {
+		return nil, errs.Validation("max backups must be positive")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	return &BackupStore{
+		dir:        dir,
+		maxBackups: maxBackups,
+	}, nil
+}
+
+// Save snapshots a persona and prunes the oldest backups beyond the limit
+func (b *BackupStore) Save(p types.Persona, reason string) (PersonaBackup, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if p.Id == "" {
+		return PersonaBackup{}, errs.Validation("persona ID is required")
+	}
+
+	personaDir := filepath.Join(b.dir, p.Id)
+	if err := os.MkdirAll(personaDir, 0755); err != nil {
+		return PersonaBackup{}, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	now := time.Now().UTC()
+	backup := PersonaBackup{
+		// Zero-padded timestamp keeps lexical and chronological order aligned
+		Id:        fmt.Sprintf("%020d-%s", now.UnixNano(), ids.New()[:4]),
+		PersonaId: p.Id,
+		Reason:    reason,
+		CreatedAt: now,
+		Persona:   p,
+	}
+
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return PersonaBackup{}, fmt.Errorf("failed to marshal backup: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(personaDir, backup.Id+".json"), data, 0644); err != nil {
+		return PersonaBackup{}, fmt.Errorf("failed to write backup: %v", err)
+	}
+
+	if err := b.prune(personaDir); err != nil {
+		return PersonaBackup{}, err
+	}
+
+	return backup, nil
+}
+
+// List returns a persona's backups, newest first
+func (b *BackupStore) List(personaID string) ([]PersonaBackup, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if strings.ContainsAny(personaID, `/\`) {
+		return nil, errs.Validation("invalid persona ID: %s", personaID)
+	}
+
+	ids, err := b.backupIDs(filepath.Join(b.dir, personaID))
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]PersonaBackup, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		backup, err := b.read(personaID, ids[i])
+		if err != nil {
+			continue // Skip unreadable snapshots
+		}
+		backups = append(backups, backup)
+	}
+	return backups, nil
+}
+
+// Get returns a single backup of a persona
+func (b *BackupStore) Get(personaID, backupID string) (PersonaBackup, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.read(personaID, backupID)
+}
+
+func (b *BackupStore) read(personaID, backupID string) (PersonaBackup, error) {
+	if strings.ContainsAny(personaID+backupID, `/\`) {
+		return PersonaBackup{}, errs.NotFound("backup not found: %s", backupID)
+	}
+
+	data, err := os.ReadFile(filepath.Join(b.dir, personaID, backupID+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return PersonaBackup{}, errs.NotFound("backup not found: %s", backupID)
+		}
+		return PersonaBackup{}, fmt.Errorf("failed to read backup: %v", err)
+	}
+
+	var backup PersonaBackup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return PersonaBackup{}, fmt.Errorf("failed to parse backup: %v", err)
+	}
+	return backup, nil
+}
+
+// backupIDs returns the backup IDs in a persona directory, oldest first
+func (b *BackupStore) backupIDs(personaDir string) ([]string, error) {
+	files, err := os.ReadDir(personaDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read backup directory: %v", err)
+	}
+
+	var ids []string
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".json" {
+			ids = append(ids, strings.TrimSuffix(file.Name(), ".json"))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (b *BackupStore) prune(personaDir string) error {
+	ids, err := b.backupIDs(personaDir)
+	if err != nil {
+		return err
+	}
+
+	for len(ids) > b.maxBackups {
+		if err := os.Remove(filepath.Join(personaDir, ids[0]+".json")); err != nil {
+			return fmt.Errorf("failed to prune backup: %v", err)
+		}
+		ids = ids[1:]
+	}
+	return nil
+}
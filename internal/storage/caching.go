@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// CachingStorage wraps a Storage with LRU caches of personas and identities
+// by ID, so repeated Get and GetIdentity calls skip the backend. Every
+// change made through CachingStorage drops the affected entry; changes made
+// to the backend by other means, such as another server sharing a Redis
+// database, are not seen until the entry is evicted. Cached values are
+// shallow copies, as with MemoryStorage, so callers must not modify their
+// maps or slices in place.
+//
+// Methods that are not cached are passed straight to the backend. Optional
+// interfaces of the backend, such as Archiver or AvatarStore, are reached
+// through As.
+type CachingStorage struct {
+	Storage
+	personas   *lruCache[types.Persona]
+	identities *lruCache[types.Identity]
+}
+
+// NewCachingStorage wraps backend with caches holding up to size personas
+// and size identities
+func NewCachingStorage(backend Storage, size int) *CachingStorage {
+	return &CachingStorage{
+		Storage:    backend,
+		personas:   newLRUCache[types.Persona](size),
+		identities: newLRUCache[types.Identity](size),
+	}
+}
+
+// Unwrap returns the wrapped backend
+func (c *CachingStorage) Unwrap() Storage {
+	return c.Storage
+}
+
+// Purge empties both caches. Call it after changing the backend directly,
+// e.g. after restoring an archive through its Archiver.
+func (c *CachingStorage) Purge() {
+	c.personas.purge()
+	c.identities.purge()
+}
+
+func (c *CachingStorage) Create(p *types.Persona) error {
+	err := c.Storage.Create(p)
+	if p != nil {
+		c.personas.remove(p.Id)
+	}
+	return err
+}
+
+func (c *CachingStorage) Get(id string) (types.Persona, error) {
+	if p, ok := c.personas.get(id); ok {
+		return p, nil
+	}
+	gen := c.personas.generation()
+	p, err := c.Storage.Get(id)
+	if err != nil {
+		return types.Persona{}, err
+	}
+	c.personas.add(id, p, gen)
+	return p, nil
+}
+
+func (c *CachingStorage) Update(id string, p types.Persona) error {
+	defer c.personas.remove(id)
+	return c.Storage.Update(id, p)
+}
+
+func (c *CachingStorage) Delete(id string) error {
+	defer c.personas.remove(id)
+	return c.Storage.Delete(id)
+}
+
+func (c *CachingStorage) SoftDelete(id string) error {
+	defer c.personas.remove(id)
+	return c.Storage.SoftDelete(id)
+}
+
+func (c *CachingStorage) Restore(id string) error {
+	defer c.personas.remove(id)
+	return c.Storage.Restore(id)
+}
+
+func (c *CachingStorage) CreateIdentity(i *types.Identity) error {
+	err := c.Storage.CreateIdentity(i)
+	if i != nil {
+		c.identities.remove(i.Id)
+	}
+	return err
+}
+
+func (c *CachingStorage) GetIdentity(id string) (types.Identity, error) {
+	if i, ok := c.identities.get(id); ok {
+		return i, nil
+	}
+	gen := c.identities.generation()
+	i, err := c.Storage.GetIdentity(id)
+	if err != nil {
+		return types.Identity{}, err
+	}
+	c.identities.add(id, i, gen)
+	return i, nil
+}
+
+func (c *CachingStorage) UpdateIdentity(id string, i types.Identity) error {
+	defer c.identities.remove(id)
+	return c.Storage.UpdateIdentity(id, i)
+}
+
+func (c *CachingStorage) DeleteIdentity(id string) error {
+	defer c.identities.remove(id)
+	return c.Storage.DeleteIdentity(id)
+}
+
+func (c *CachingStorage) ModifyIdentity(id string, modify func(i *types.Identity) (bool, error)) (types.Identity, error) {
+	defer c.identities.remove(id)
+	return c.Storage.ModifyIdentity(id, modify)
+}
+
+// Unwrapper is implemented by storage layers that wrap another Storage
+type Unwrapper interface {
+	Unwrap() Storage
+}
+
+// As finds the first storage in the chain of s and the layers it wraps
+// that implements T, the way errors.As does for errors. Use it instead of a
+// type assertion to look for an optional interface such as Archiver.
+func As[T any](s Storage) (T, bool) {
+	for s != nil {
+		if t, ok := s.(T); ok {
+			return t, true
+		}
+		u, ok := s.(Unwrapper)
+		if !ok {
+			break
+		}
+		s = u.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// lruCache is a fixed-size map that evicts the least recently used entry.
+// A size below 1 disables it. Every removal bumps a generation counter, and
+// add ignores values read before the latest removal, so a lookup racing an
+// update cannot store the old value.
+type lruCache[V any] struct {
+	mu      sync.Mutex
+	size    int
+	gen     uint64
+	order   *list.List // of *lruEntry[V], most recently used first
+	entries map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+}
+
+func newLRUCache[V any](size int) *lruCache[V] {
+	return &lruCache[V]{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *lruCache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*lruEntry[V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// generation returns the value to pass to add for a value about to be read
+func (c *lruCache[V]) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+func (c *lruCache[V]) add(key string, value V, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size < 1 || gen != c.gen {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*lruEntry[V]).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[V]).key)
+	}
+}
+
+func (c *lruCache[V]) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+func (c *lruCache[V]) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.order.Init()
+	clear(c.entries)
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// countingStorage counts the reads that reach the backend
+type countingStorage struct {
+	*MemoryStorage
+	gets         int
+	identityGets int
+}
+
+func (c *countingStorage) Get(id string) (types.Persona, error) {
+	c.gets++
+	return c.MemoryStorage.Get(id)
+}
+
+func (c *countingStorage) GetIdentity(id string) (types.Identity, error) {
+	c.identityGets++
+	return c.MemoryStorage.GetIdentity(id)
+}
+
+func TestCachingStorage_Personas(t *testing.T) {
+	backend := &countingStorage{MemoryStorage: NewMemoryStorage()}
+	cache := NewCachingStorage(backend, 10)
+
+	p := &types.Persona{Name: "Cached", Topic: "Caching", Prompt: "You are cached."}
+	if err := cache.Create(p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		got, err := cache.Get(p.Id)
+		if err != nil {
+			t.Fatalf("Failed to get persona: %v", err)
+		}
+		if got.Name != "Cached" {
+			t.Errorf("Expected the stored persona, got %+v", got)
+		}
+	}
+	if backend.gets != 1 {
+		t.Errorf("Expected 1 backend read for 3 gets, got %d", backend.gets)
+	}
+
+	updated := *p
+	updated.Version = 0
+	updated.Name = "Updated"
+	if err := cache.Update(p.Id, updated); err != nil {
+		t.Fatalf("Failed to update persona: %v", err)
+	}
+	got, err := cache.Get(p.Id)
+	if err != nil {
+		t.Fatalf("Failed to get persona: %v", err)
+	}
+	if got.Name != "Updated" || backend.gets != 2 {
+		t.Errorf("Expected the update to invalidate the entry, got %q after %d backend reads", got.Name, backend.gets)
+	}
+
+	if err := cache.Delete(p.Id); err != nil {
+		t.Fatalf("Failed to delete persona: %v", err)
+	}
+	if _, err := cache.Get(p.Id); err == nil {
+		t.Error("Expected a deleted persona not to be served from the cache")
+	}
+}
+
+func TestCachingStorage_Identities(t *testing.T) {
+	backend := &countingStorage{MemoryStorage: NewMemoryStorage()}
+	cache := NewCachingStorage(backend, 2)
+
+	p := &types.Persona{Name: "Base", Topic: "Caching", Prompt: "You are a base."}
+	if err := cache.Create(p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	var ids []string
+	for i := 0; i < 3; i++ {
+		identity := &types.Identity{PersonaId: p.Id, Name: fmt.Sprintf("Identity %d", i)}
+		if err := cache.CreateIdentity(identity); err != nil {
+			t.Fatalf("Failed to create identity: %v", err)
+		}
+		ids = append(ids, identity.Id)
+	}
+
+	get := func(id string) types.Identity {
+		t.Helper()
+		i, err := cache.GetIdentity(id)
+		if err != nil {
+			t.Fatalf("Failed to get identity: %v", err)
+		}
+		return i
+	}
+
+	get(ids[0])
+	get(ids[1])
+	get(ids[0])
+	if backend.identityGets != 2 {
+		t.Errorf("Expected 2 backend reads, got %d", backend.identityGets)
+	}
+
+	// ids[1] is the least recently used, so reading a third identity evicts it
+	get(ids[2])
+	get(ids[0])
+	if backend.identityGets != 3 {
+		t.Errorf("Expected ids[0] to stay cached, got %d backend reads", backend.identityGets)
+	}
+	get(ids[1])
+	if backend.identityGets != 4 {
+		t.Errorf("Expected ids[1] to have been evicted, got %d backend reads", backend.identityGets)
+	}
+
+	if _, err := cache.ModifyIdentity(ids[0], func(i *types.Identity) (bool, error) {
+		i.Description = "Modified"
+		return true, nil
+	}); err != nil {
+		t.Fatalf("Failed to modify identity: %v", err)
+	}
+	if got := get(ids[0]); got.Description != "Modified" {
+		t.Errorf("Expected ModifyIdentity to invalidate the entry, got %+v", got)
+	}
+}
+
+func TestCachingStorage_Disabled(t *testing.T) {
+	backend := &countingStorage{MemoryStorage: NewMemoryStorage()}
+	cache := NewCachingStorage(backend, 0)
+
+	p := &types.Persona{Name: "Uncached", Topic: "Caching", Prompt: "You are not cached."}
+	if err := cache.Create(p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	cache.Get(p.Id)
+	cache.Get(p.Id)
+	if backend.gets != 2 {
+		t.Errorf("Expected every get to reach the backend, got %d reads", backend.gets)
+	}
+}
+
+func TestCachingStorage_OptionalInterfaces(t *testing.T) {
+	cache := NewCachingStorage(NewMemoryStorage(), 10)
+
+	archiver, ok := As[Archiver](cache)
+	if !ok {
+		t.Fatal("Expected the backend's Archiver to be found through the cache")
+	}
+	var buf bytes.Buffer
+	if err := archiver.BackupTo(&buf); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	if _, ok := As[*CachingStorage](cache); !ok {
+		t.Error("Expected As to find the cache itself")
+	}
+	if _, ok := As[Indexer](cache); ok {
+		t.Error("Expected memory storage not to be an Indexer")
+	}
+	if _, ok := As[Archiver](NewMemoryStorage()); !ok {
+		t.Error("Expected As to work on an unwrapped backend")
+	}
+}
@@ -0,0 +1,20 @@
+package storage
+
+// IdentityCounter is implemented by storage backends that can count
+// identities without loading them
+type IdentityCounter interface {
+	CountIdentities() (int, error)
+}
+
+// CountIdentities returns the number of identities in s, using
+// IdentityCounter when s implements it
+func CountIdentities(s Storage) (int, error) {
+	if counter, ok := As[IdentityCounter](s); ok {
+		return counter.CountIdentities()
+	}
+	identities, err := s.ListIdentities(nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(identities), nil
+}
@@ -1,26 +1,37 @@
 package storage
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/ids"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
 )
 
 // FileStorage implements file-based storage for personas and identities
 type FileStorage struct {
-	dataDir        string
-	personasDir    string
-	identitiesDir  string
-	communitiesDir string
-	mu             sync.RWMutex
+	dataDir          string
+	personasDir      string
+	identitiesDir    string
+	communitiesDir   string
+	relationshipsDir string
+	versionsDir      string // one subdirectory of versions per persona
+	templatesDir     string // community templates, stored as <name>.json
+	avatarsDir       string // identity avatars, stored as <identity ID>.png or .jpg
+	mu               sync.RWMutex
+
+	// In-memory secondary index, rebuilt from disk on startup
+	personaIdentities idIndex // persona ID -> identity IDs
 }
 
 // NewFileStorage creates a new file storage instance
@@ -44,12 +55,43 @@ func NewFileStorage(dataDir string) (*FileStorage, error) {
 		return nil, fmt.Errorf("failed to create communities directory: %v", err)
 	}
 
-	return &FileStorage{
-		dataDir:        dataDir,
-		personasDir:    personasDir,
-		identitiesDir:  identitiesDir,
-		communitiesDir: communitiesDir,
-	}, nil
+	relationshipsDir := filepath.Join(dataDir, "relationships")
+	if err := os.MkdirAll(relationshipsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create relationships directory: %v", err)
+	}
+
+	versionsDir := filepath.Join(dataDir, "versions")
+	if err := os.MkdirAll(versionsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create versions directory: %v", err)
+	}
+
+	templatesDir := filepath.Join(dataDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create templates directory: %v", err)
+	}
+
+	avatarsDir := filepath.Join(dataDir, "avatars")
+	if err := os.MkdirAll(avatarsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create avatars directory: %v", err)
+	}
+
+	f := &FileStorage{
+		dataDir:          dataDir,
+		personasDir:      personasDir,
+		identitiesDir:    identitiesDir,
+		communitiesDir:   communitiesDir,
+		relationshipsDir: relationshipsDir,
+		versionsDir:      versionsDir,
+		templatesDir:     templatesDir,
+		avatarsDir:       avatarsDir,
+	}
+	index, err := f.buildPersonaIdentities()
+	if err != nil {
+		return nil, err
+	}
+	f.personaIdentities = index
+
+	return f, nil
 }
 
 // Persona operations
@@ -58,19 +100,23 @@ func (f *FileStorage) Create(p *types.Persona) error {
 	defer f.mu.Unlock()
 
 	if p == nil {
-		return fmt.Errorf("persona cannot be nil")
+		return errs.Validation("persona cannot be nil")
 	}
 	if p.Name == "" {
-		return fmt.Errorf("persona name is required")
+		return errs.Validation("persona name is required")
 	}
 	if p.Topic == "" {
-		return fmt.Errorf("persona topic is required")
+		return errs.Validation("persona topic is required")
 	}
 	if p.Prompt == "" {
-		return fmt.Errorf("persona prompt is required")
+		return errs.Validation("persona prompt is required")
 	}
 
-	p.Id = f.generateID()
+	p.Id = ids.New()
+	p.Version = 1
+	now := time.Now()
+	p.CreatedAt = now
+	p.UpdatedAt = now
 	return f.writePersona(*p)
 }
 
@@ -94,7 +140,51 @@ func (f *FileStorage) List() ([]types.Persona, error) {
 	for _, file := range files {
 		if filepath.Ext(file.Name()) == ".json" {
 			id := file.Name()[:len(file.Name())-5] // Remove .json extension
-			if p, err := f.readPersona(id); err == nil {
+			if p, err := f.readPersona(id); err == nil && p.DeletedAt == nil {
+				personas = append(personas, p)
+			}
+		}
+	}
+
+	return personas, nil
+}
+
+func (f *FileStorage) ListPersonasFiltered(filter *types.PersonaFilter) ([]types.Persona, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	files, err := os.ReadDir(f.personasDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read personas directory: %v", err)
+	}
+
+	personas := []types.Persona{}
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".json" {
+			id := file.Name()[:len(file.Name())-5]
+			if p, err := f.readPersona(id); err == nil && matchesPersonaFilter(p, filter) {
+				personas = append(personas, p)
+			}
+		}
+	}
+
+	return personas, nil
+}
+
+func (f *FileStorage) ListDeleted() ([]types.Persona, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	files, err := os.ReadDir(f.personasDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read personas directory: %v", err)
+	}
+
+	personas := []types.Persona{}
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".json" {
+			id := file.Name()[:len(file.Name())-5]
+			if p, err := f.readPersona(id); err == nil && p.DeletedAt != nil {
 				personas = append(personas, p)
 			}
 		}
@@ -108,11 +198,19 @@ func (f *FileStorage) Update(id string, p types.Persona) error {
 	defer f.mu.Unlock()
 
 	// Check if persona exists
-	if _, err := f.readPersona(id); err != nil {
-		return fmt.Errorf("persona not found: %s", id)
+	existing, err := f.readPersona(id)
+	if err != nil {
+		return errs.NotFound("persona not found: %s", id)
+	}
+	if err := checkVersion("persona", id, existing.Version, p.Version); err != nil {
+		return err
 	}
 
 	p.Id = id
+	p.Version = existing.Version + 1
+	p.CreatedAt = existing.CreatedAt
+	p.UpdatedAt = time.Now()
+	p.DeletedAt = existing.DeletedAt
 	return f.writePersona(p)
 }
 
@@ -122,33 +220,142 @@ func (f *FileStorage) Delete(id string) error {
 
 	filePath := filepath.Join(f.personasDir, id+".json")
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("persona not found: %s", id)
+		return errs.NotFound("persona not found: %s", id)
 	}
 
+	if err := os.RemoveAll(filepath.Join(f.versionsDir, id)); err != nil {
+		return fmt.Errorf("failed to remove persona versions: %v", err)
+	}
 	return os.Remove(filePath)
 }
 
+// SoftDelete marks a persona as deleted without removing its file
+func (f *FileStorage) SoftDelete(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.readPersona(id)
+	if err != nil {
+		return err
+	}
+	if p.DeletedAt != nil {
+		return errs.NotFound("persona not found: %s", id)
+	}
+	now := time.Now()
+	p.DeletedAt = &now
+	p.Version++
+	return f.writePersona(p)
+}
+
+// Restore clears a persona's soft-deleted mark
+func (f *FileStorage) Restore(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.readPersona(id)
+	if err != nil {
+		return err
+	}
+	if p.DeletedAt == nil {
+		return fmt.Errorf("%w: %s", ErrPersonaNotDeleted, id)
+	}
+	p.DeletedAt = nil
+	p.Version++
+	return f.writePersona(p)
+}
+
+// AddPersonaVersion writes p as the next file in its persona's versions
+// directory
+func (f *FileStorage) AddPersonaVersion(p types.Persona) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if p.Id == "" {
+		return errs.Validation("persona ID is required")
+	}
+	history, err := f.readPersonaVersions(p.Id)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(f.versionsDir, p.Id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create versions directory: %v", err)
+	}
+	v := types.PersonaVersion{
+		Version:   len(history) + 1,
+		CreatedAt: time.Now(),
+		Persona:   p,
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal persona version: %v", err)
+	}
+	// Zero-padded names keep lexical and version order aligned
+	return os.WriteFile(filepath.Join(dir, fmt.Sprintf("%06d.json", v.Version)), data, 0644)
+}
+
+func (f *FileStorage) ListPersonaVersions(id string) ([]types.PersonaVersion, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.readPersonaVersions(id)
+}
+
+// readPersonaVersions loads the version files of a persona, oldest first
+func (f *FileStorage) readPersonaVersions(id string) ([]types.PersonaVersion, error) {
+	dir := filepath.Join(f.versionsDir, id)
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make([]types.PersonaVersion, 0), nil
+		}
+		return nil, fmt.Errorf("failed to read versions directory: %v", err)
+	}
+
+	versions := make([]types.PersonaVersion, 0, len(files))
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read persona version: %v", err)
+		}
+		var v types.PersonaVersion
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("failed to parse persona version %s: %v", file.Name(), err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
 // Identity operations
 func (f *FileStorage) CreateIdentity(i *types.Identity) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
 	if i == nil {
-		return fmt.Errorf("identity cannot be nil")
+		return errs.Validation("identity cannot be nil")
 	}
 	if i.PersonaId == "" {
-		return fmt.Errorf("persona ID is required")
+		return errs.Validation("persona ID is required")
 	}
 	if i.Name == "" {
-		return fmt.Errorf("identity name is required")
+		return errs.Validation("identity name is required")
 	}
 
 	// Verify persona exists
-	if _, err := f.readPersona(i.PersonaId); err != nil {
-		return fmt.Errorf("referenced persona not found: %s", i.PersonaId)
+	p, err := f.readPersona(i.PersonaId)
+	if err != nil {
+		return errs.NotFound("referenced persona not found: %s", i.PersonaId)
+	}
+	if p.DeletedAt != nil {
+		return fmt.Errorf("%w: %s", ErrPersonaDeleted, i.PersonaId)
 	}
 
-	i.Id = f.generateID()
+	i.Id = ids.New()
 	now := time.Now()
 	i.CreatedAt = now
 	i.UpdatedAt = now
@@ -160,11 +367,12 @@ func (f *FileStorage) CreateIdentity(i *types.Identity) error {
 	if i.Tags == nil {
 		i.Tags = []string{}
 	}
-	if !i.IsActive {
-		i.IsActive = true
-	}
 
-	return f.writeIdentity(*i)
+	if err := f.writeIdentity(*i); err != nil {
+		return err
+	}
+	f.personaIdentities.add(i.PersonaId, i.Id)
+	return nil
 }
 
 func (f *FileStorage) GetIdentity(id string) (types.Identity, error) {
@@ -178,56 +386,25 @@ func (f *FileStorage) ListIdentities(filter *types.IdentityFilter) ([]types.Iden
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 
-	files, err := os.ReadDir(f.identitiesDir)
-	if err != nil {
-		// If directory doesn't exist, return empty list instead of error
-		if os.IsNotExist(err) {
-			return []types.Identity{}, nil
+	var ids []string
+	if filter != nil && filter.PersonaID != "" {
+		// Only read the persona's identities
+		ids = f.personaIdentities.ids(filter.PersonaID)
+	} else {
+		var err error
+		ids, err = f.identityIDs()
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("failed to read identities directory: %v", err)
 	}
 
 	var identities []types.Identity
-	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".json" {
-			id := file.Name()[:len(file.Name())-5] // Remove .json extension
-			if i, err := f.readIdentity(id); err == nil {
-				// Apply filters
-				if filter != nil {
-					if filter.PersonaID != "" && i.PersonaId != filter.PersonaID {
-						continue
-					}
-					if filter.IsActive != nil && i.IsActive != *filter.IsActive {
-						continue
-					}
-					if len(filter.Tags) > 0 {
-						hasTag := false
-						for _, tag := range filter.Tags {
-							for _, identityTag := range i.Tags {
-								if identityTag == tag {
-									hasTag = true
-									break
-								}
-							}
-							if hasTag {
-								break
-							}
-						}
-						if !hasTag {
-							continue
-						}
-					}
-					if filter.Search != "" {
-						searchLower := strings.ToLower(filter.Search)
-						nameMatch := strings.Contains(strings.ToLower(i.Name), searchLower)
-						descMatch := strings.Contains(strings.ToLower(i.Description), searchLower)
-						if !nameMatch && !descMatch {
-							continue
-						}
-					}
-				}
-				identities = append(identities, i)
+	for _, id := range ids {
+		if i, err := f.readIdentity(id); err == nil {
+			if !matchesIdentityFilter(i, filter) {
+				continue
 			}
+			identities = append(identities, i)
 		}
 	}
 
@@ -239,18 +416,55 @@ func (f *FileStorage) UpdateIdentity(id string, i types.Identity) error {
 	defer f.mu.Unlock()
 
 	// Check if identity exists
-	if _, err := f.readIdentity(id); err != nil {
-		return fmt.Errorf("identity not found: %s", id)
+	existing, err := f.readIdentity(id)
+	if err != nil {
+		return errs.NotFound("identity not found: %s", id)
 	}
 
 	// Verify persona exists
-	if _, err := f.readPersona(i.PersonaId); err != nil {
-		return fmt.Errorf("referenced persona not found: %s", i.PersonaId)
+	p, err := f.readPersona(i.PersonaId)
+	if err != nil {
+		return errs.NotFound("referenced persona not found: %s", i.PersonaId)
+	}
+	if p.DeletedAt != nil {
+		return fmt.Errorf("%w: %s", ErrPersonaDeleted, i.PersonaId)
 	}
 
 	i.Id = id
+	i.CreatedAt = existing.CreatedAt
+	i.UpdatedAt = time.Now()
+	if err := f.writeIdentity(i); err != nil {
+		return err
+	}
+	f.personaIdentities.remove(id)
+	f.personaIdentities.add(i.PersonaId, id)
+	return nil
+}
+
+func (f *FileStorage) ModifyIdentity(id string, modify func(i *types.Identity) (bool, error)) (types.Identity, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	current, err := f.readIdentity(id)
+	if err != nil {
+		return types.Identity{}, err
+	}
+
+	i := current
+	i.Tags = slices.Clone(current.Tags)
+	changed, err := modify(&i)
+	if err != nil || !changed {
+		return current, err
+	}
+	if err := checkModifiedIdentity(current, i); err != nil {
+		return types.Identity{}, err
+	}
+
 	i.UpdatedAt = time.Now()
-	return f.writeIdentity(i)
+	if err := f.writeIdentity(i); err != nil {
+		return types.Identity{}, err
+	}
+	return i, nil
 }
 
 func (f *FileStorage) DeleteIdentity(id string) error {
@@ -259,10 +473,49 @@ func (f *FileStorage) DeleteIdentity(id string) error {
 
 	filePath := filepath.Join(f.identitiesDir, id+".json")
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("identity not found: %s", id)
+		return errs.NotFound("identity not found: %s", id)
 	}
 
-	return os.Remove(filePath)
+	if err := os.Remove(filePath); err != nil {
+		return err
+	}
+	f.personaIdentities.remove(id)
+	if err := f.removeAvatar(id); err != nil {
+		return err
+	}
+
+	// Cascade to the identity's relationships
+	relationships, err := f.readRelationships()
+	if err != nil {
+		return err
+	}
+	for _, r := range relationships {
+		if r.Involves(id) {
+			if err := os.Remove(filepath.Join(f.relationshipsDir, r.Id+".json")); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to delete relationship %s: %v", r.Id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// CountIdentities implements IdentityCounter by counting identity files
+// without parsing them
+func (f *FileStorage) CountIdentities() (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	files, err := os.ReadDir(f.identitiesDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read identities directory: %v", err)
+	}
+	count := 0
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".json" {
+			count++
+		}
+	}
+	return count, nil
 }
 
 func (f *FileStorage) GetIdentityWithPersona(id string) (types.IdentityWithPersona, error) {
@@ -276,7 +529,7 @@ func (f *FileStorage) GetIdentityWithPersona(id string) (types.IdentityWithPerso
 
 	p, err := f.readPersona(i.PersonaId)
 	if err != nil {
-		return types.IdentityWithPersona{}, fmt.Errorf("referenced persona not found: %s", i.PersonaId)
+		return types.IdentityWithPersona{}, errs.NotFound("referenced persona not found: %s", i.PersonaId)
 	}
 
 	return types.IdentityWithPersona{
@@ -286,18 +539,12 @@ func (f *FileStorage) GetIdentityWithPersona(id string) (types.IdentityWithPerso
 }
 
 // Helper methods
-func (f *FileStorage) generateID() string {
-	bytes := make([]byte, 8)
-	rand.Read(bytes)
-	return hex.EncodeToString(bytes)
-}
-
 func (f *FileStorage) readPersona(id string) (types.Persona, error) {
 	filePath := filepath.Join(f.personasDir, id+".json")
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return types.Persona{}, fmt.Errorf("persona not found: %s", id)
+			return types.Persona{}, errs.NotFound("persona not found: %s", id)
 		}
 		return types.Persona{}, fmt.Errorf("failed to read persona file: %v", err)
 	}
@@ -326,17 +573,17 @@ func (f *FileStorage) CreateCommunity(c *types.Community) error {
 	defer f.mu.Unlock()
 
 	if c == nil {
-		return fmt.Errorf("community cannot be nil")
+		return errs.Validation("community cannot be nil")
 	}
 	if c.Name == "" {
-		return fmt.Errorf("community name is required")
+		return errs.Validation("community name is required")
 	}
 	if c.Type == "" {
-		return fmt.Errorf("community type is required")
+		return errs.Validation("community type is required")
 	}
 
 	if c.Id == "" {
-		c.Id = f.generateID()
+		c.Id = ids.New()
 	}
 
 	// Initialize empty slices if nil
@@ -374,51 +621,8 @@ func (f *FileStorage) ListCommunities(filter *types.CommunityFilter) ([]types.Co
 		if filepath.Ext(file.Name()) == ".json" {
 			id := file.Name()[:len(file.Name())-5] // Remove .json extension
 			if c, err := f.readCommunity(id); err == nil {
-				// Apply filters
-				if filter != nil {
-					if filter.Type != "" && c.Type != filter.Type {
-						continue
-					}
-					if filter.IsActive != nil && c.IsActive != *filter.IsActive {
-						continue
-					}
-					if filter.MinSize != nil && c.Size < *filter.MinSize {
-						continue
-					}
-					if filter.MaxSize != nil && c.Size > *filter.MaxSize {
-						continue
-					}
-					if filter.MinDiversity != nil && c.Diversity < *filter.MinDiversity {
-						continue
-					}
-					if filter.MaxDiversity != nil && c.Diversity > *filter.MaxDiversity {
-						continue
-					}
-					if len(filter.Tags) > 0 {
-						hasTag := false
-						for _, tag := range filter.Tags {
-							for _, communityTag := range c.Tags {
-								if communityTag == tag {
-									hasTag = true
-									break
-								}
-							}
-							if hasTag {
-								break
-							}
-						}
-						if !hasTag {
-							continue
-						}
-					}
-					if filter.Search != "" {
-						searchLower := strings.ToLower(filter.Search)
-						nameMatch := strings.Contains(strings.ToLower(c.Name), searchLower)
-						descMatch := strings.Contains(strings.ToLower(c.Description), searchLower)
-						if !nameMatch && !descMatch {
-							continue
-						}
-					}
+				if !matchesCommunityFilter(c, filter) {
+					continue
 				}
 				communities = append(communities, c)
 			}
@@ -434,7 +638,7 @@ func (f *FileStorage) UpdateCommunity(id string, c types.Community) error {
 
 	// Check if community exists
 	if _, err := f.readCommunity(id); err != nil {
-		return fmt.Errorf("community not found: %s", id)
+		return errs.NotFound("community not found: %s", id)
 	}
 
 	c.Id = id
@@ -447,7 +651,7 @@ func (f *FileStorage) DeleteCommunity(id string) error {
 
 	filePath := filepath.Join(f.communitiesDir, id+".json")
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("community not found: %s", id)
+		return errs.NotFound("community not found: %s", id)
 	}
 
 	return os.Remove(filePath)
@@ -458,7 +662,7 @@ func (f *FileStorage) readCommunity(id string) (types.Community, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return types.Community{}, fmt.Errorf("community not found: %s", id)
+			return types.Community{}, errs.NotFound("community not found: %s", id)
 		}
 		return types.Community{}, fmt.Errorf("failed to read community file: %v", err)
 	}
@@ -486,7 +690,7 @@ func (f *FileStorage) readIdentity(id string) (types.Identity, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return types.Identity{}, fmt.Errorf("identity not found: %s", id)
+			return types.Identity{}, errs.NotFound("identity not found: %s", id)
 		}
 		return types.Identity{}, fmt.Errorf("failed to read identity file: %v", err)
 	}
@@ -508,3 +712,400 @@ func (f *FileStorage) writeIdentity(i types.Identity) error {
 
 	return os.WriteFile(filePath, data, 0644)
 }
+
+// identityIDs lists the IDs of all identity files
+func (f *FileStorage) identityIDs() ([]string, error) {
+	files, err := os.ReadDir(f.identitiesDir)
+	if err != nil {
+		// If directory doesn't exist, return empty list instead of error
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read identities directory: %v", err)
+	}
+
+	var ids []string
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".json" {
+			ids = append(ids, file.Name()[:len(file.Name())-5]) // Remove .json extension
+		}
+	}
+	return ids, nil
+}
+
+// buildPersonaIdentities computes the persona -> identities index from disk
+func (f *FileStorage) buildPersonaIdentities() (idIndex, error) {
+	ids, err := f.identityIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(idIndex)
+	for _, id := range ids {
+		i, err := f.readIdentity(id)
+		if err != nil {
+			continue // Unreadable identities are skipped by ListIdentities too
+		}
+		index.add(i.PersonaId, i.Id)
+	}
+	return index, nil
+}
+
+// RebuildIndexes recomputes the persona -> identities index from the
+// identity files, e.g. after they were edited by hand
+func (f *FileStorage) RebuildIndexes() (IndexReport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	index, err := f.buildPersonaIdentities()
+	if err != nil {
+		return IndexReport{}, err
+	}
+
+	report := IndexReport{
+		Entries: index.size(),
+		Fixed:   f.personaIdentities.diff(index),
+	}
+	f.personaIdentities = index
+	return report, nil
+}
+
+// BackupTo archives the persona, identity, community and relationship
+// directories as they are on disk
+func (f *FileStorage) BackupTo(w io.Writer) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	a := newArchiveWriter(w)
+	dirs := []struct{ name, path string }{
+		{archivePersonas, f.personasDir},
+		{archiveIdentities, f.identitiesDir},
+		{archiveCommunities, f.communitiesDir},
+		{archiveRelationships, f.relationshipsDir},
+	}
+	for _, dir := range dirs {
+		files, err := os.ReadDir(dir.path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s directory: %v", dir.name, err)
+		}
+		for _, file := range files {
+			if filepath.Ext(file.Name()) != ".json" {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir.path, file.Name()))
+			if err != nil {
+				return fmt.Errorf("failed to read %s file: %v", dir.name, err)
+			}
+			if err := a.add(dir.name, strings.TrimSuffix(file.Name(), ".json"), data); err != nil {
+				return err
+			}
+		}
+	}
+	return a.Close()
+}
+
+// RestoreFrom writes the archived entities back to their directories and
+// rebuilds the persona -> identities index
+func (f *FileStorage) RestoreFrom(r io.Reader, overwrite bool) error {
+	a, err := readArchive(r)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// skip reports whether an existing file should be left alone
+	skip := func(dir, id string) bool {
+		if overwrite {
+			return false
+		}
+		_, err := os.Stat(filepath.Join(dir, id+".json"))
+		return err == nil
+	}
+
+	for _, p := range a.personas {
+		if skip(f.personasDir, p.Id) {
+			continue
+		}
+		if err := f.writePersona(p); err != nil {
+			return err
+		}
+	}
+	for _, i := range a.identities {
+		if skip(f.identitiesDir, i.Id) {
+			continue
+		}
+		if err := f.writeIdentity(i); err != nil {
+			return err
+		}
+	}
+	for _, c := range a.communities {
+		if skip(f.communitiesDir, c.Id) {
+			continue
+		}
+		if err := f.writeCommunity(c); err != nil {
+			return err
+		}
+	}
+	for _, rel := range a.relationships {
+		if skip(f.relationshipsDir, rel.Id) {
+			continue
+		}
+		if err := f.writeRelationship(rel); err != nil {
+			return err
+		}
+	}
+
+	index, err := f.buildPersonaIdentities()
+	if err != nil {
+		return err
+	}
+	f.personaIdentities = index
+	return nil
+}
+
+// Relationship operations
+func (f *FileStorage) CreateRelationship(r *types.Relationship) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := validateRelationship(r); err != nil {
+		return err
+	}
+	for _, id := range []string{r.FromId, r.ToId} {
+		if _, err := f.readIdentity(id); err != nil {
+			return err
+		}
+	}
+
+	r.Id = ids.New()
+	r.CreatedAt = time.Now()
+	return f.writeRelationship(*r)
+}
+
+func (f *FileStorage) ListRelationships(identityID string) ([]types.Relationship, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	relationships, err := f.readRelationships()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]types.Relationship, 0)
+	for _, r := range relationships {
+		if r.Involves(identityID) {
+			result = append(result, r)
+		}
+	}
+	sortRelationships(result)
+	return result, nil
+}
+
+func (f *FileStorage) DeleteRelationship(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	filePath := filepath.Join(f.relationshipsDir, id+".json")
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return errs.NotFound("relationship not found: %s", id)
+	}
+
+	return os.Remove(filePath)
+}
+
+func (f *FileStorage) writeRelationship(r types.Relationship) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal relationship data: %v", err)
+	}
+	return os.WriteFile(filepath.Join(f.relationshipsDir, r.Id+".json"), data, 0644)
+}
+
+// readRelationships loads every relationship file, skipping unreadable ones
+func (f *FileStorage) readRelationships() ([]types.Relationship, error) {
+	files, err := os.ReadDir(f.relationshipsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read relationships directory: %v", err)
+	}
+
+	var relationships []types.Relationship
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(f.relationshipsDir, file.Name()))
+		if err != nil {
+			continue
+		}
+		var r types.Relationship
+		if err := json.Unmarshal(data, &r); err != nil {
+			continue
+		}
+		relationships = append(relationships, r)
+	}
+	return relationships, nil
+}
+
+// Community template operations
+func (f *FileStorage) SaveCommunityTemplate(name string, cfg types.CommunityGenerationConfig) error {
+	if err := validateTemplateName(name); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	t, err := f.readTemplate(name)
+	if errors.Is(err, errs.ErrNotFound) {
+		t = types.CommunityTemplate{Name: name, CreatedAt: now}
+	} else if err != nil {
+		return err
+	}
+	t.Config = cfg
+	t.UpdatedAt = now
+
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal community template: %v", err)
+	}
+	return os.WriteFile(filepath.Join(f.templatesDir, name+".json"), data, 0644)
+}
+
+func (f *FileStorage) GetCommunityTemplate(name string) (types.CommunityTemplate, error) {
+	if err := validateTemplateName(name); err != nil {
+		return types.CommunityTemplate{}, errs.NotFound("community template not found: %s", name)
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.readTemplate(name)
+}
+
+func (f *FileStorage) ListCommunityTemplates() ([]types.CommunityTemplate, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	files, err := os.ReadDir(f.templatesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates directory: %v", err)
+	}
+
+	templates := []types.CommunityTemplate{}
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		t, err := f.readTemplate(strings.TrimSuffix(file.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+func (f *FileStorage) readTemplate(name string) (types.CommunityTemplate, error) {
+	data, err := os.ReadFile(filepath.Join(f.templatesDir, name+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return types.CommunityTemplate{}, errs.NotFound("community template not found: %s", name)
+		}
+		return types.CommunityTemplate{}, fmt.Errorf("failed to read community template: %v", err)
+	}
+
+	var t types.CommunityTemplate
+	if err := json.Unmarshal(data, &t); err != nil {
+		return types.CommunityTemplate{}, fmt.Errorf("failed to parse community template %s: %v", name, err)
+	}
+	return t, nil
+}
+
+// Identity avatar operations
+func (f *FileStorage) SaveIdentityAvatar(identityID string, avatar types.Avatar) error {
+	ext, ok := avatarExtensions[avatar.ContentType]
+	if !ok {
+		return errs.Validation("unsupported avatar content type: %s", avatar.ContentType)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.checkAvatarIdentity(identityID); err != nil {
+		return err
+	}
+	// Drop an avatar stored under another content type first
+	if err := f.removeAvatar(identityID); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(f.avatarsDir, identityID+ext), avatar.Data, 0644)
+}
+
+func (f *FileStorage) GetIdentityAvatar(identityID string) (types.Avatar, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if err := f.checkAvatarIdentity(identityID); err != nil {
+		return types.Avatar{}, err
+	}
+	return f.readAvatar(identityID)
+}
+
+func (f *FileStorage) DeleteIdentityAvatar(identityID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.checkAvatarIdentity(identityID); err != nil {
+		return err
+	}
+	if _, err := f.readAvatar(identityID); err != nil {
+		return err
+	}
+	return f.removeAvatar(identityID)
+}
+
+// checkAvatarIdentity checks that an avatar's identity exists. The ID is
+// used in a file name, so one that is not a plain name cannot exist.
+func (f *FileStorage) checkAvatarIdentity(identityID string) error {
+	if identityID == "" || identityID != filepath.Base(identityID) {
+		return errs.NotFound("identity not found: %s", identityID)
+	}
+	_, err := f.readIdentity(identityID)
+	return err
+}
+
+func (f *FileStorage) readAvatar(identityID string) (types.Avatar, error) {
+	for contentType, ext := range avatarExtensions {
+		path := filepath.Join(f.avatarsDir, identityID+ext)
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return types.Avatar{}, fmt.Errorf("failed to read avatar: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return types.Avatar{}, fmt.Errorf("failed to read avatar: %v", err)
+		}
+		return types.Avatar{ContentType: contentType, Data: data, UpdatedAt: info.ModTime()}, nil
+	}
+	return types.Avatar{}, errs.NotFound("avatar not found for identity: %s", identityID)
+}
+
+// removeAvatar deletes an identity's avatar files, if any
+func (f *FileStorage) removeAvatar(identityID string) error {
+	for _, ext := range avatarExtensions {
+		if err := os.Remove(filepath.Join(f.avatarsDir, identityID+ext)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete avatar: %v", err)
+		}
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package storage
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
 )
 
@@ -207,3 +210,324 @@ func TestFileStorage_ListWithCorruptedFile(t *testing.T) {
 		t.Errorf("Expected valid persona name 'Valid Persona', got %s", personas[0].Name)
 	}
 }
+
+func TestFileStorage_RebuildIndexes(t *testing.T) {
+	storage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	
+	p := &types.Persona{Name: "Indexed", Topic: "Indexes", Prompt: "You are indexed."}
+	if err := storage.Create(p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	first := &types.Identity{PersonaId: p.Id, Name: "First"}
+	second := &types.Identity{PersonaId: p.Id, Name: "Second"}
+	for _, i := range []*types.Identity{first, second} {
+		if err := storage.CreateIdentity(i); err != nil {
+			t.Fatalf("Failed to create identity: %v", err)
+		}
+	}
+	
+	byPersona := func() int {
+		t.Helper()
+		identities, err := storage.ListIdentities(&types.IdentityFilter{PersonaID: p.Id})
+		if err != nil {
+			t.Fatalf("Failed to list identities: %v", err)
+		}
+		return len(identities)
+	}
+	if n := byPersona(); n != 2 {
+		t.Fatalf("Expected 2 identities for persona, got %d", n)
+	}
+	
+	// Corrupt the index: drop a real entry and add a stale one
+	storage.personaIdentities.remove(first.Id)
+	storage.personaIdentities.add(p.Id, "ghost")
+	if n := byPersona(); n != 1 {
+		t.Fatalf("Expected corrupted index to hide an identity, got %d", n)
+	}
+	
+	report, err := storage.RebuildIndexes()
+	if err != nil {
+		t.Fatalf("Failed to rebuild indexes: %v", err)
+	}
+	if report.Fixed != 2 || report.Entries != 2 {
+		t.Errorf("Expected 2 fixed of 2 entries, got %+v", report)
+	}
+	if n := byPersona(); n != 2 {
+		t.Errorf("Expected rebuilt index to find 2 identities, got %d", n)
+	}
+	
+	// A clean index needs no fixes
+	report, _ = storage.RebuildIndexes()
+	if report.Fixed != 0 {
+		t.Errorf("Expected no fixes on a clean index, got %d", report.Fixed)
+	}
+}
+
+func TestListCommunities_MemberAggregateFilters(t *testing.T) {
+	fileStorage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	
+	// The file store round-trips attributes through JSON, so it sees them
+	// as decoded values rather than the types metrics are calculated in
+	for name, store := range map[string]Storage{"memory": NewMemoryStorage(), "file": fileStorage} {
+		t.Run(name, func(t *testing.T) {
+			for _, c := range []types.Community{
+				{Name: "Young", Type: "interest", Attributes: map[string]interface{}{
+					"average_age":            24.5,
+					"political_distribution": map[string]float64{"liberal": 0.7, "moderate": 0.3},
+				}},
+				{Name: "Middle", Type: "interest", Attributes: map[string]interface{}{
+					"average_age":            41.0,
+					"political_distribution": map[string]float64{"liberal": 0.5, "conservative": 0.5},
+				}},
+				{Name: "Senior", Type: "interest", Attributes: map[string]interface{}{
+					"average_age":            67.2,
+					"political_distribution": map[string]float64{"conservative": 0.6, "moderate": 0.4},
+				}},
+				{Name: "Unmeasured", Type: "interest"},
+			} {
+				if err := store.CreateCommunity(&c); err != nil {
+					t.Fatalf("Failed to create community: %v", err)
+				}
+			}
+			
+			minAge, maxAge := 30.0, 70.0
+			tests := []struct {
+				name   string
+				filter types.CommunityFilter
+				want   []string
+			}{
+				{"min average age", types.CommunityFilter{MinAvgAge: &minAge}, []string{"Middle", "Senior"}},
+				{"max average age", types.CommunityFilter{MaxAvgAge: &minAge}, []string{"Young"}},
+				{"average age range", types.CommunityFilter{MinAvgAge: &minAge, MaxAvgAge: &maxAge}, []string{"Middle", "Senior"}},
+				{"dominant leaning", types.CommunityFilter{DominantPolitical: "conservative"}, []string{"Middle", "Senior"}},
+				{"dominant leaning case", types.CommunityFilter{DominantPolitical: "Liberal"}, []string{"Middle", "Young"}},
+				{"minority leaning", types.CommunityFilter{DominantPolitical: "moderate"}, nil},
+			}
+			for _, tt := range tests {
+				communities, err := store.ListCommunities(&tt.filter)
+				if err != nil {
+					t.Fatalf("%s: failed to list communities: %v", tt.name, err)
+				}
+				var names []string
+				for _, c := range communities {
+					names = append(names, c.Name)
+				}
+				slices.Sort(names)
+				if !slices.Equal(names, tt.want) {
+					t.Errorf("%s: expected %v, got %v", tt.name, tt.want, names)
+				}
+			}
+		})
+	}
+}
+
+// plainStorage hides any optional interfaces of the Storage it wraps
+type plainStorage struct {
+	Storage
+}
+
+func TestForEachCommunityMember(t *testing.T) {
+	fileStorage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	
+	backends := map[string]Storage{
+		"memory":   NewMemoryStorage(),
+		"file":     fileStorage,
+		"fallback": plainStorage{NewMemoryStorage()},
+	}
+	for name, store := range backends {
+		t.Run(name, func(t *testing.T) {
+			p := &types.Persona{Name: "Member", Topic: "Members", Prompt: "You belong."}
+			if err := store.Create(p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			var memberIDs []string
+			for _, memberName := range []string{"Ann", "Ben", "Cat", "Dan"} {
+				i := &types.Identity{PersonaId: p.Id, Name: memberName}
+				if err := store.CreateIdentity(i); err != nil {
+					t.Fatalf("Failed to create identity: %v", err)
+				}
+				memberIDs = append(memberIDs, i.Id)
+			}
+			// Members whose identity is gone are skipped
+			if err := store.DeleteIdentity(memberIDs[2]); err != nil {
+				t.Fatalf("Failed to delete identity: %v", err)
+			}
+			c := &types.Community{Name: "Club", Type: "interest", MemberIds: memberIDs}
+			if err := store.CreateCommunity(c); err != nil {
+				t.Fatalf("Failed to create community: %v", err)
+			}
+			
+			calls := make(map[string]int)
+			var order []string
+			err := ForEachCommunityMember(store, c.Id, func(member types.Identity) error {
+				calls[member.Id]++
+				order = append(order, member.Name)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ForEachCommunityMember failed: %v", err)
+			}
+			if want := []string{"Ann", "Ben", "Dan"}; !slices.Equal(order, want) {
+				t.Errorf("Expected members %v in order, got %v", want, order)
+			}
+			for id, count := range calls {
+				if count != 1 {
+					t.Errorf("Expected one call for %s, got %d", id, count)
+				}
+			}
+			
+			// An error from the callback stops the iteration
+			stop := errors.New("stop")
+			visited := 0
+			err = ForEachCommunityMember(store, c.Id, func(types.Identity) error {
+				visited++
+				return stop
+			})
+			if !errors.Is(err, stop) || visited != 1 {
+				t.Errorf("Expected to stop after the first member with the callback's error, got %d calls and %v", visited, err)
+			}
+			
+			err = ForEachCommunityMember(store, "missing", func(types.Identity) error { return nil })
+			if !errors.Is(err, errs.ErrNotFound) {
+				t.Errorf("Expected not found for a missing community, got %v", err)
+			}
+		})
+	}
+}
+
+func TestForEachIdentity(t *testing.T) {
+	fileStorage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	
+	backends := map[string]Storage{
+		"memory":   NewMemoryStorage(),
+		"file":     fileStorage,
+		"fallback": plainStorage{NewMemoryStorage()},
+	}
+	for name, store := range backends {
+		t.Run(name, func(t *testing.T) {
+			var personaIDs []string
+			for _, personaName := range []string{"First", "Second"} {
+				p := &types.Persona{Name: personaName, Topic: "Iteration", Prompt: "You are iterated."}
+				if err := store.Create(p); err != nil {
+					t.Fatalf("Failed to create persona: %v", err)
+				}
+				personaIDs = append(personaIDs, p.Id)
+			}
+			for i, identityName := range []string{"Ann", "Ben", "Cat", "Dan", "Eve"} {
+				identity := &types.Identity{PersonaId: personaIDs[i%2], Name: identityName}
+				if err := store.CreateIdentity(identity); err != nil {
+					t.Fatalf("Failed to create identity: %v", err)
+				}
+			}
+			
+			collect := func(filter *types.IdentityFilter) []string {
+				t.Helper()
+				var names []string
+				err := ForEachIdentity(store, filter, func(i types.Identity) error {
+					names = append(names, i.Name)
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("ForEachIdentity failed: %v", err)
+				}
+				slices.Sort(names)
+				return names
+			}
+			if got, want := collect(nil), []string{"Ann", "Ben", "Cat", "Dan", "Eve"}; !slices.Equal(got, want) {
+				t.Errorf("Expected %v, got %v", want, got)
+			}
+			if got, want := collect(&types.IdentityFilter{PersonaID: personaIDs[1]}), []string{"Ben", "Dan"}; !slices.Equal(got, want) {
+				t.Errorf("Expected %v for the second persona, got %v", want, got)
+			}
+			if got, want := collect(&types.IdentityFilter{Search: "cat"}), []string{"Cat"}; !slices.Equal(got, want) {
+				t.Errorf("Expected %v for a search, got %v", want, got)
+			}
+			
+			// An error from the callback stops the iteration
+			stop := errors.New("stop")
+			visited := 0
+			err := ForEachIdentity(store, nil, func(types.Identity) error {
+				visited++
+				return stop
+			})
+			if !errors.Is(err, stop) || visited != 1 {
+				t.Errorf("Expected to stop after the first identity with the callback's error, got %d calls and %v", visited, err)
+			}
+		})
+	}
+}
+
+func TestIdentityAvatars(t *testing.T) {
+	fileStorage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	
+	for name, store := range map[string]AvatarStore{
+		"memory": NewMemoryStorage(),
+		"file":   fileStorage,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := store.(Storage)
+			p := &types.Persona{Name: "Pictured", Topic: "Avatars", Prompt: "Smile."}
+			if err := s.Create(p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			i := &types.Identity{PersonaId: p.Id, Name: "Pictured Identity"}
+			if err := s.CreateIdentity(i); err != nil {
+				t.Fatalf("Failed to create identity: %v", err)
+			}
+			
+			if _, err := store.GetIdentityAvatar(i.Id); !errors.Is(err, errs.ErrNotFound) {
+				t.Errorf("Expected ErrNotFound before an avatar is set, got %v", err)
+			}
+			if err := store.SaveIdentityAvatar(i.Id, types.Avatar{ContentType: "image/png", Data: []byte("png")}); err != nil {
+				t.Fatalf("Failed to save avatar: %v", err)
+			}
+			// Replacing the avatar with another type leaves only the new one
+			if err := store.SaveIdentityAvatar(i.Id, types.Avatar{ContentType: "image/jpeg", Data: []byte("jpeg")}); err != nil {
+				t.Fatalf("Failed to replace avatar: %v", err)
+			}
+			avatar, err := store.GetIdentityAvatar(i.Id)
+			if err != nil {
+				t.Fatalf("Failed to get avatar: %v", err)
+			}
+			if avatar.ContentType != "image/jpeg" || string(avatar.Data) != "jpeg" || avatar.UpdatedAt.IsZero() {
+				t.Errorf("Expected the replacement avatar, got %+v", avatar)
+			}
+			
+			if err := store.SaveIdentityAvatar(i.Id, types.Avatar{ContentType: "image/gif", Data: []byte("gif")}); !errors.Is(err, errs.ErrValidation) {
+				t.Errorf("Expected ErrValidation for an unsupported content type, got %v", err)
+			}
+			if err := store.SaveIdentityAvatar("missing", types.Avatar{ContentType: "image/png"}); !errors.Is(err, errs.ErrNotFound) {
+				t.Errorf("Expected ErrNotFound for a missing identity, got %v", err)
+			}
+			
+			// Deleting the identity deletes its avatar
+			if err := s.DeleteIdentity(i.Id); err != nil {
+				t.Fatalf("Failed to delete identity: %v", err)
+			}
+			if err := s.CreateIdentity(&types.Identity{Id: i.Id, PersonaId: p.Id, Name: "Recreated"}); err != nil {
+				t.Fatalf("Failed to recreate identity: %v", err)
+			}
+			if _, err := store.GetIdentityAvatar(i.Id); !errors.Is(err, errs.ErrNotFound) {
+				t.Errorf("Expected the avatar to be deleted with its identity, got %v", err)
+			}
+			if err := store.DeleteIdentityAvatar(i.Id); !errors.Is(err, errs.ErrNotFound) {
+				t.Errorf("Expected ErrNotFound deleting a missing avatar, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// matchesPersonaFilter reports whether a persona passes every criterion set
+// in filter. A nil filter matches every persona that is not soft-deleted.
+func matchesPersonaFilter(p types.Persona, filter *types.PersonaFilter) bool {
+	if filter == nil {
+		return p.DeletedAt == nil
+	}
+	if p.DeletedAt != nil && !filter.IncludeDeleted {
+		return false
+	}
+	if filter.Topic != "" && !containsFold(p.Topic, filter.Topic) {
+		return false
+	}
+	if filter.Search != "" && !containsFold(p.Name, filter.Search) && !containsFold(p.Prompt, filter.Search) {
+		return false
+	}
+	if len(filter.Tags) > 0 && !hasAnyTag(p.Tags, filter.Tags) {
+		return false
+	}
+	return true
+}
+
+// containsFold reports whether substr is within s, ignoring case
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// matchesIdentityFilter reports whether an identity passes every criterion
+// set in filter. A nil filter matches everything.
+func matchesIdentityFilter(i types.Identity, filter *types.IdentityFilter) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.PersonaID != "" && i.PersonaId != filter.PersonaID {
+		return false
+	}
+	if filter.IsActive != nil && i.IsActive != *filter.IsActive {
+		return false
+	}
+	if len(filter.Tags) > 0 && !hasAnyTag(i.Tags, filter.Tags) {
+		return false
+	}
+	if filter.Search != "" && !matchesIdentitySearch(i, filter.Search, filter.DeepSearch) {
+		return false
+	}
+	if !matchesDemographics(i, filter) {
+		return false
+	}
+	return true
+}
+
+// matchesDemographics applies the age and city criteria of filter
+func matchesDemographics(i types.Identity, filter *types.IdentityFilter) bool {
+	if filter.MinAge == nil && filter.MaxAge == nil && filter.City == "" {
+		return true
+	}
+	if i.RichAttributes == nil || i.RichAttributes.Demographics == nil {
+		return false
+	}
+	demographics := i.RichAttributes.Demographics
+	age := int(demographics.Age)
+	if filter.MinAge != nil && age < *filter.MinAge {
+		return false
+	}
+	if filter.MaxAge != nil && age > *filter.MaxAge {
+		return false
+	}
+	if filter.City != "" && (demographics.Location == nil || !strings.EqualFold(demographics.Location.City, filter.City)) {
+		return false
+	}
+	return true
+}
+
+// matchesCommunityFilter reports whether a community passes every criterion
+// set in filter. A nil filter matches everything.
+func matchesCommunityFilter(c types.Community, filter *types.CommunityFilter) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.Type != "" && c.Type != filter.Type {
+		return false
+	}
+	if filter.IsActive != nil && c.IsActive != *filter.IsActive {
+		return false
+	}
+	if filter.MinSize != nil && c.Size < *filter.MinSize {
+		return false
+	}
+	if filter.MaxSize != nil && c.Size > *filter.MaxSize {
+		return false
+	}
+	if filter.MinDiversity != nil && c.Diversity < *filter.MinDiversity {
+		return false
+	}
+	if filter.MaxDiversity != nil && c.Diversity > *filter.MaxDiversity {
+		return false
+	}
+	if len(filter.Tags) > 0 && !hasAnyTag(c.Tags, filter.Tags) {
+		return false
+	}
+	if filter.Search != "" {
+		searchLower := strings.ToLower(filter.Search)
+		nameMatch := strings.Contains(strings.ToLower(c.Name), searchLower)
+		descMatch := strings.Contains(strings.ToLower(c.Description), searchLower)
+		if !nameMatch && !descMatch {
+			return false
+		}
+	}
+	if filter.MinAvgAge != nil || filter.MaxAvgAge != nil {
+		// An average of 0 means no member had an age
+		avgAge, ok := attributeFloat(c.Attributes["average_age"])
+		if !ok || avgAge <= 0 {
+			return false
+		}
+		if filter.MinAvgAge != nil && avgAge < *filter.MinAvgAge {
+			return false
+		}
+		if filter.MaxAvgAge != nil && avgAge > *filter.MaxAvgAge {
+			return false
+		}
+	}
+	if filter.DominantPolitical != "" && !isDominantLeaning(c.Attributes["political_distribution"], filter.DominantPolitical) {
+		return false
+	}
+	return true
+}
+
+// attributeFloat reads a numeric community attribute, which is a float64
+// both as calculated and once decoded from JSON
+func attributeFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// isDominantLeaning reports whether leaning has the largest share of a
+// political_distribution attribute. Leanings tied for the largest share are
+// all dominant.
+func isDominantLeaning(distribution interface{}, leaning string) bool {
+	shares := make(map[string]float64)
+	switch d := distribution.(type) {
+	case map[string]float64: // as calculated
+		shares = d
+	case map[string]interface{}: // decoded from JSON
+		for name, value := range d {
+			if share, ok := attributeFloat(value); ok {
+				shares[name] = share
+			}
+		}
+	}
+
+	best := 0.0
+	for _, share := range shares {
+		best = max(best, share)
+	}
+	for name, share := range shares {
+		if strings.EqualFold(name, leaning) {
+			return share > 0 && share == best
+		}
+	}
+	return false
+}
+
+// hasAnyTag reports whether tags contains at least one of wanted
+func hasAnyTag(tags, wanted []string) bool {
+	for _, tag := range wanted {
+		for _, t := range tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package storage
+
+import "sort"
+
+// IndexReport summarizes a secondary index rebuild
+type IndexReport struct {
+	Entries int `json:"entries"` // entries in the rebuilt indexes
+	Fixed   int `json:"fixed"`   // entries that were missing or stale
+}
+
+// Indexer is implemented by storage backends that maintain secondary
+// indexes which can drift from the primary data, e.g. after manual edits
+type Indexer interface {
+	// RebuildIndexes recomputes all secondary indexes from the primary data
+	RebuildIndexes() (IndexReport, error)
+}
+
+// idIndex maps a key to a set of IDs, e.g. persona ID -> identity IDs
+type idIndex map[string]map[string]struct{}
+
+func (x idIndex) add(key, id string) {
+	if x[key] == nil {
+		x[key] = make(map[string]struct{})
+	}
+	x[key][id] = struct{}{}
+}
+
+// remove drops id from every key it is indexed under
+func (x idIndex) remove(id string) {
+	for key, ids := range x {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(x, key)
+		}
+	}
+}
+
+// ids returns the IDs indexed under key in sorted order
+func (x idIndex) ids(key string) []string {
+	ids := make([]string, 0, len(x[key]))
+	for id := range x[key] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// size returns the total number of indexed entries
+func (x idIndex) size() int {
+	n := 0
+	for _, ids := range x {
+		n += len(ids)
+	}
+	return n
+}
+
+// diff counts entries present in only one of the two indexes
+func (x idIndex) diff(other idIndex) int {
+	n := 0
+	for key, ids := range x {
+		for id := range ids {
+			if _, ok := other[key][id]; !ok {
+				n++
+			}
+		}
+	}
+	for key, ids := range other {
+		for id := range ids {
+			if _, ok := x[key][id]; !ok {
+				n++
+			}
+		}
+	}
+	return n
+}
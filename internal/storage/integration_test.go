@@ -1,11 +1,14 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
 )
 
@@ -23,6 +26,8 @@ func TestStorageIntegration(t *testing.T) {
 	}
 	storages["file"] = fileStorage
 	
+	addRedisStorage(t, storages)
+	
 	for name, storage := range storages {
 		t.Run(name, func(t *testing.T) {
 			testStorageOperations(t, storage)
@@ -30,6 +35,502 @@ func TestStorageIntegration(t *testing.T) {
 	}
 }
 
+func TestIdentityDeepSearch(t *testing.T) {
+	storages := map[string]Storage{
+		"memory": NewMemoryStorage(),
+	}
+	fileStorage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	storages["file"] = fileStorage
+	
+	addRedisStorage(t, storages)
+	
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+			if err := storage.Create(p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			
+			gardener := &types.Identity{
+				PersonaId: p.Id,
+				Name:      "Alice",
+				RichAttributes: &types.RichAttributes{
+					Preferences: &types.Preferences{Interests: []string{"Urban Gardening"}},
+				},
+			}
+			other := &types.Identity{
+				PersonaId: p.Id,
+				Name:      "Bob",
+				RichAttributes: &types.RichAttributes{
+					Demographics: &types.Demographics{
+						Occupation: "nurse",
+						Location:   &types.Location{City: "Seattle"},
+					},
+				},
+			}
+			for _, i := range []*types.Identity{gardener, other} {
+				if err := storage.CreateIdentity(i); err != nil {
+					t.Fatalf("Failed to create identity: %v", err)
+				}
+			}
+			
+			// Interests are only searched when deep search is enabled
+			shallow, err := storage.ListIdentities(&types.IdentityFilter{Search: "gardening"})
+			if err != nil {
+				t.Fatalf("Failed to list identities: %v", err)
+			}
+			if len(shallow) != 0 {
+				t.Errorf("Expected no shallow matches, got %d", len(shallow))
+			}
+			
+			tests := []struct {
+				search string
+				want   string
+			}{
+				{"gardening", gardener.Id},
+				{"NURSE", other.Id},
+				{"seattle", other.Id},
+				{"alice", gardener.Id},
+			}
+			for _, tt := range tests {
+				deep, err := storage.ListIdentities(&types.IdentityFilter{Search: tt.search, DeepSearch: true})
+				if err != nil {
+					t.Fatalf("Failed to list identities: %v", err)
+				}
+				if len(deep) != 1 || deep[0].Id != tt.want {
+					t.Errorf("Search %q: expected only %s, got %+v", tt.search, tt.want, deep)
+				}
+			}
+		})
+	}
+}
+
+func TestIdentityDemographicFilters(t *testing.T) {
+	storages := map[string]Storage{
+		"memory": NewMemoryStorage(),
+	}
+	fileStorage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	storages["file"] = fileStorage
+	
+	addRedisStorage(t, storages)
+	
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+			if err := storage.Create(p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			
+			ids := make(map[string]string)
+			for _, tt := range []struct {
+				name string
+				age  int32
+				city string
+			}{
+				{"Young", 29, "Berlin"},
+				{"Lower", 30, "Berlin"},
+				{"Middle", 40, "Paris"},
+				{"Upper", 45, "berlin"},
+				{"Old", 46, "Berlin"},
+			} {
+				i := &types.Identity{
+					PersonaId: p.Id,
+					Name:      tt.name,
+					RichAttributes: &types.RichAttributes{
+						Demographics: &types.Demographics{Age: tt.age, Location: &types.Location{City: tt.city}},
+					},
+				}
+				if err := storage.CreateIdentity(i); err != nil {
+					t.Fatalf("Failed to create identity: %v", err)
+				}
+				ids[i.Id] = tt.name
+			}
+			plain := &types.Identity{PersonaId: p.Id, Name: "No Demographics"}
+			if err := storage.CreateIdentity(plain); err != nil {
+				t.Fatalf("Failed to create identity: %v", err)
+			}
+			ids[plain.Id] = plain.Name
+			
+			minAge, maxAge := 30, 45
+			tests := map[string]struct {
+				filter *types.IdentityFilter
+				want   []string
+			}{
+				"age range includes bounds": {&types.IdentityFilter{MinAge: &minAge, MaxAge: &maxAge}, []string{"Lower", "Middle", "Upper"}},
+				"min age only":              {&types.IdentityFilter{MinAge: &maxAge}, []string{"Upper", "Old"}},
+				"max age only":              {&types.IdentityFilter{MaxAge: &minAge}, []string{"Young", "Lower"}},
+				"city ignores case":         {&types.IdentityFilter{City: "BERLIN"}, []string{"Young", "Lower", "Upper", "Old"}},
+				"age and city":              {&types.IdentityFilter{MinAge: &minAge, MaxAge: &maxAge, City: "berlin"}, []string{"Lower", "Upper"}},
+			}
+			for name, tt := range tests {
+				identities, err := storage.ListIdentities(tt.filter)
+				if err != nil {
+					t.Fatalf("%s: Failed to list identities: %v", name, err)
+				}
+				got := make(map[string]bool)
+				for _, i := range identities {
+					got[ids[i.Id]] = true
+				}
+				if len(got) != len(tt.want) {
+					t.Errorf("%s: expected %v, got %v", name, tt.want, got)
+					continue
+				}
+				for _, want := range tt.want {
+					if !got[want] {
+						t.Errorf("%s: expected %v, got %v", name, tt.want, got)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestListPersonasFiltered(t *testing.T) {
+	storages := map[string]Storage{
+		"memory": NewMemoryStorage(),
+	}
+	fileStorage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	storages["file"] = fileStorage
+	
+	addRedisStorage(t, storages)
+	
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			names := make(map[string]string)
+			for _, p := range []*types.Persona{
+				{Name: "Pentester", Topic: "Network Security", Prompt: "You break into networks.", Tags: []string{"offense"}},
+				{Name: "Defender", Topic: "Cloud security", Prompt: "You harden clouds.", Tags: []string{"defense"}},
+				{Name: "Gopher", Topic: "Golang Programming", Prompt: "You write Go."},
+			} {
+				if err := storage.Create(p); err != nil {
+					t.Fatalf("Failed to create persona: %v", err)
+				}
+				names[p.Id] = p.Name
+			}
+			retired := &types.Persona{Name: "Retired", Topic: "Security Auditing", Prompt: "You audit."}
+			if err := storage.Create(retired); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			names[retired.Id] = retired.Name
+			if err := storage.SoftDelete(retired.Id); err != nil {
+				t.Fatalf("Failed to soft-delete persona: %v", err)
+			}
+			
+			tests := map[string]struct {
+				filter *types.PersonaFilter
+				want   []string
+			}{
+				"nil filter":        {nil, []string{"Pentester", "Defender", "Gopher"}},
+				"topic substring":   {&types.PersonaFilter{Topic: "SECURITY"}, []string{"Pentester", "Defender"}},
+				"topic and deleted": {&types.PersonaFilter{Topic: "security", IncludeDeleted: true}, []string{"Pentester", "Defender", "Retired"}},
+				"search prompt":     {&types.PersonaFilter{Search: "harden"}, []string{"Defender"}},
+				"search name":       {&types.PersonaFilter{Search: "goph"}, []string{"Gopher"}},
+				"tags":              {&types.PersonaFilter{Tags: []string{"offense", "unused"}}, []string{"Pentester"}},
+				"no match":          {&types.PersonaFilter{Topic: "cooking"}, nil},
+			}
+			for name, tt := range tests {
+				personas, err := storage.ListPersonasFiltered(tt.filter)
+				if err != nil {
+					t.Fatalf("%s: Failed to list personas: %v", name, err)
+				}
+				got := make(map[string]bool)
+				for _, p := range personas {
+					got[names[p.Id]] = true
+				}
+				if len(got) != len(tt.want) {
+					t.Errorf("%s: expected %v, got %v", name, tt.want, got)
+					continue
+				}
+				for _, want := range tt.want {
+					if !got[want] {
+						t.Errorf("%s: expected %v, got %v", name, tt.want, got)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestIdentityInactiveRoundTrip(t *testing.T) {
+	storages := map[string]Storage{
+		"memory": NewMemoryStorage(),
+	}
+	fileStorage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	storages["file"] = fileStorage
+	
+	addRedisStorage(t, storages)
+	
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+			if err := storage.Create(p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			
+			identity := &types.Identity{PersonaId: p.Id, Name: "Dormant", IsActive: false}
+			if err := storage.CreateIdentity(identity); err != nil {
+				t.Fatalf("Failed to create identity: %v", err)
+			}
+			if identity.IsActive {
+				t.Error("Expected created identity to stay inactive")
+			}
+			
+			retrieved, err := storage.GetIdentity(identity.Id)
+			if err != nil {
+				t.Fatalf("Failed to get identity: %v", err)
+			}
+			if retrieved.IsActive {
+				t.Error("Expected retrieved identity to stay inactive")
+			}
+			
+			active := true
+			list, err := storage.ListIdentities(&types.IdentityFilter{IsActive: &active})
+			if err != nil {
+				t.Fatalf("Failed to list identities: %v", err)
+			}
+			if len(list) != 0 {
+				t.Errorf("Expected no active identities, got %d", len(list))
+			}
+		})
+	}
+}
+
+func TestUpdateIdentityKeepsCreatedAt(t *testing.T) {
+	storages := map[string]Storage{
+		"memory": NewMemoryStorage(),
+	}
+	fileStorage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	storages["file"] = fileStorage
+	
+	addRedisStorage(t, storages)
+	
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+			if err := storage.Create(p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			identity := &types.Identity{PersonaId: p.Id, Name: "Original"}
+			if err := storage.CreateIdentity(identity); err != nil {
+				t.Fatalf("Failed to create identity: %v", err)
+			}
+			created, err := storage.GetIdentity(identity.Id)
+			if err != nil {
+				t.Fatalf("Failed to get identity: %v", err)
+			}
+			
+			// A full replacement does not carry the creation time
+			update := created
+			update.Name = "Renamed"
+			update.CreatedAt = time.Time{}
+			if err := storage.UpdateIdentity(identity.Id, update); err != nil {
+				t.Fatalf("UpdateIdentity failed: %v", err)
+			}
+			
+			updated, err := storage.GetIdentity(identity.Id)
+			if err != nil {
+				t.Fatalf("Failed to get identity: %v", err)
+			}
+			if updated.Name != "Renamed" {
+				t.Errorf("Expected name Renamed, got %s", updated.Name)
+			}
+			if !updated.CreatedAt.Equal(created.CreatedAt) {
+				t.Errorf("Expected CreatedAt %v to be kept, got %v", created.CreatedAt, updated.CreatedAt)
+			}
+		})
+	}
+}
+
+func TestRelationships(t *testing.T) {
+	storages := map[string]Storage{
+		"memory": NewMemoryStorage(),
+	}
+	fileStorage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	storages["file"] = fileStorage
+	
+	addRedisStorage(t, storages)
+	
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+			if err := storage.Create(p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			ids := make([]string, 3)
+			for n := range ids {
+				identity := &types.Identity{PersonaId: p.Id, Name: "Member"}
+				if err := storage.CreateIdentity(identity); err != nil {
+					t.Fatalf("Failed to create identity: %v", err)
+				}
+				ids[n] = identity.Id
+			}
+			a, b, c := ids[0], ids[1], ids[2]
+			
+			friends := &types.Relationship{FromId: a, ToId: b, Type: "friend", Strength: 0.8}
+			family := &types.Relationship{FromId: c, ToId: a, Type: "family", Strength: 1}
+			for _, r := range []*types.Relationship{friends, family} {
+				if err := storage.CreateRelationship(r); err != nil {
+					t.Fatalf("Failed to create relationship: %v", err)
+				}
+				if r.Id == "" {
+					t.Error("Expected relationship ID to be generated")
+				}
+			}
+			
+			invalid := map[string]*types.Relationship{
+				"self":             {FromId: a, ToId: a, Type: "friend"},
+				"missing identity": {FromId: a, ToId: "missing", Type: "friend"},
+				"no type":          {FromId: a, ToId: b},
+				"strength":         {FromId: a, ToId: b, Type: "friend", Strength: 1.5},
+			}
+			for name, r := range invalid {
+				if err := storage.CreateRelationship(r); err == nil {
+					t.Errorf("%s: expected error", name)
+				}
+			}
+			
+			list, err := storage.ListRelationships(a)
+			if err != nil {
+				t.Fatalf("Failed to list relationships: %v", err)
+			}
+			if len(list) != 2 {
+				t.Fatalf("Expected 2 relationships for a, got %d", len(list))
+			}
+			if list, _ := storage.ListRelationships(b); len(list) != 1 || list[0].Id != friends.Id {
+				t.Errorf("Expected only the friendship for b, got %+v", list)
+			}
+			
+			// Deleting an identity removes the relationships it is part of
+			if err := storage.DeleteIdentity(a); err != nil {
+				t.Fatalf("Failed to delete identity: %v", err)
+			}
+			for _, id := range []string{a, b, c} {
+				if list, _ := storage.ListRelationships(id); len(list) != 0 {
+					t.Errorf("Expected no relationships for %s after cascade, got %d", id, len(list))
+				}
+			}
+			
+			r := &types.Relationship{FromId: b, ToId: c, Type: "colleague", Strength: 0.5}
+			if err := storage.CreateRelationship(r); err != nil {
+				t.Fatalf("Failed to create relationship: %v", err)
+			}
+			if err := storage.DeleteRelationship(r.Id); err != nil {
+				t.Fatalf("Failed to delete relationship: %v", err)
+			}
+			if err := storage.DeleteRelationship(r.Id); err == nil {
+				t.Error("Expected error deleting a missing relationship")
+			}
+		})
+	}
+}
+
+func TestPersonaSoftDelete(t *testing.T) {
+	storages := map[string]Storage{
+		"memory": NewMemoryStorage(),
+	}
+	fileStorage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	storages["file"] = fileStorage
+	
+	addRedisStorage(t, storages)
+	
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+			if err := storage.Create(p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			identity := &types.Identity{PersonaId: p.Id, Name: "Member"}
+			if err := storage.CreateIdentity(identity); err != nil {
+				t.Fatalf("Failed to create identity: %v", err)
+			}
+			
+			if err := storage.SoftDelete(p.Id); err != nil {
+				t.Fatalf("SoftDelete failed: %v", err)
+			}
+			if err := storage.SoftDelete(p.Id); err == nil {
+				t.Error("Expected error soft-deleting an already deleted persona")
+			}
+			
+			// Soft-deleted personas are kept but hidden from List
+			got, err := storage.Get(p.Id)
+			if err != nil {
+				t.Fatalf("Expected Get to return a soft-deleted persona: %v", err)
+			}
+			if got.DeletedAt == nil || got.Version != 2 {
+				t.Errorf("Expected DeletedAt set and version 2, got %+v", got)
+			}
+			if list, _ := storage.List(); len(list) != 0 {
+				t.Errorf("Expected List to hide soft-deleted personas, got %d", len(list))
+			}
+			if list, _ := storage.ListDeleted(); len(list) != 1 || list[0].Id != p.Id {
+				t.Errorf("Expected ListDeleted to return the persona, got %+v", list)
+			}
+			
+			// Identities cannot reference a soft-deleted persona
+			err = storage.CreateIdentity(&types.Identity{PersonaId: p.Id, Name: "Orphan"})
+			if !errors.Is(err, ErrPersonaDeleted) {
+				t.Errorf("Expected ErrPersonaDeleted creating an identity, got %v", err)
+			}
+			identity.Name = "Renamed"
+			if err := storage.UpdateIdentity(identity.Id, *identity); !errors.Is(err, ErrPersonaDeleted) {
+				t.Errorf("Expected ErrPersonaDeleted updating an identity, got %v", err)
+			}
+			
+			// Updates keep the deleted mark
+			got.Name = "Edited"
+			if err := storage.Update(p.Id, got); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+			if got, _ := storage.Get(p.Id); got.DeletedAt == nil {
+				t.Error("Expected Update to keep the persona soft-deleted")
+			}
+			
+			if err := storage.Restore(p.Id); err != nil {
+				t.Fatalf("Restore failed: %v", err)
+			}
+			if err := storage.Restore(p.Id); !errors.Is(err, ErrPersonaNotDeleted) {
+				t.Errorf("Expected ErrPersonaNotDeleted restoring twice, got %v", err)
+			}
+			if list, _ := storage.List(); len(list) != 1 || list[0].DeletedAt != nil {
+				t.Errorf("Expected the restored persona in List, got %+v", list)
+			}
+			if err := storage.UpdateIdentity(identity.Id, *identity); err != nil {
+				t.Errorf("Expected identity update to succeed after restore: %v", err)
+			}
+			
+			if err := storage.SoftDelete("missing"); err == nil {
+				t.Error("Expected error soft-deleting a missing persona")
+			}
+			if err := storage.Restore("missing"); err == nil {
+				t.Error("Expected error restoring a missing persona")
+			}
+		})
+	}
+}
+
 func testStorageOperations(t *testing.T, storage Storage) {
 	// Test complete CRUD workflow
 	personas := []*types.Persona{
@@ -107,6 +608,62 @@ func testStorageOperations(t *testing.T, storage Storage) {
 	}
 }
 
+func TestStorageOptimisticLocking(t *testing.T) {
+	fileStorage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	storages := map[string]Storage{
+		"memory": NewMemoryStorage(),
+		"file":   fileStorage,
+	}
+	
+	addRedisStorage(t, storages)
+	
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+			if err := storage.Create(p); err != nil {
+				t.Fatalf("Failed to create persona: %v", err)
+			}
+			if p.Version != 1 {
+				t.Errorf("Expected initial version 1, got %d", p.Version)
+			}
+			
+			// Versioned update with the current version succeeds
+			p.Name = "Updated Expert"
+			if err := storage.Update(p.Id, *p); err != nil {
+				t.Fatalf("Versioned update failed: %v", err)
+			}
+			updated, err := storage.Get(p.Id)
+			if err != nil {
+				t.Fatalf("Failed to get updated persona: %v", err)
+			}
+			if updated.Version != 2 {
+				t.Errorf("Expected version 2 after update, got %d", updated.Version)
+			}
+			
+			// A second writer holding the stale version is rejected
+			stale := *p
+			stale.Name = "Stale Expert"
+			err = storage.Update(p.Id, stale)
+			if !errors.Is(err, ErrVersionConflict) {
+				t.Fatalf("Expected ErrVersionConflict for stale version, got %v", err)
+			}
+			current, _ := storage.Get(p.Id)
+			if current.Name != "Updated Expert" || current.Version != 2 {
+				t.Errorf("Stale update should not modify persona, got %s v%d", current.Name, current.Version)
+			}
+			
+			// Unversioned updates keep last-write-wins behaviour
+			stale.Version = 0
+			if err := storage.Update(p.Id, stale); err != nil {
+				t.Errorf("Unversioned update failed: %v", err)
+			}
+		})
+	}
+}
+
 func TestFileStorageCorruption(t *testing.T) {
 	tmpDir := t.TempDir()
 	storage, _ := NewFileStorage(tmpDir)
@@ -197,3 +754,63 @@ func TestMemoryStorageConcurrency(t *testing.T) {
 		t.Errorf("Expected %d personas after concurrent operations, got %d", expectedCount, len(list))
 	}
 }
+
+func TestCommunityTemplates(t *testing.T) {
+	fileStorage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file storage: %v", err)
+	}
+	
+	for name, store := range map[string]TemplateStore{
+		"memory": NewMemoryStorage(),
+		"file":   fileStorage,
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := types.CommunityGenerationConfig{
+				PersonaWeights: map[string]float64{"p1": 0.7, "p2": 0.3},
+				AgeDistribution: types.AgeDistribution{Mean: 30, StdDev: 5, MinAge: 20, MaxAge: 40},
+			}
+			if err := store.SaveCommunityTemplate("startup", cfg); err != nil {
+				t.Fatalf("Failed to save template: %v", err)
+			}
+			if err := store.SaveCommunityTemplate("activists", types.CommunityGenerationConfig{PoliticalSpread: 0.9}); err != nil {
+				t.Fatalf("Failed to save template: %v", err)
+			}
+			
+			got, err := store.GetCommunityTemplate("startup")
+			if err != nil {
+				t.Fatalf("Failed to get template: %v", err)
+			}
+			if got.Name != "startup" || got.Config.PersonaWeights["p1"] != 0.7 || got.Config.AgeDistribution.MaxAge != 40 {
+				t.Errorf("Unexpected template %+v", got)
+			}
+			
+			// Saving again replaces the config but keeps the creation time
+			cfg.PersonaWeights = map[string]float64{"p1": 1}
+			if err := store.SaveCommunityTemplate("startup", cfg); err != nil {
+				t.Fatalf("Failed to overwrite template: %v", err)
+			}
+			updated, _ := store.GetCommunityTemplate("startup")
+			if updated.Config.PersonaWeights["p2"] != 0 || !updated.CreatedAt.Equal(got.CreatedAt) {
+				t.Errorf("Unexpected overwritten template %+v", updated)
+			}
+			
+			templates, err := store.ListCommunityTemplates()
+			if err != nil {
+				t.Fatalf("Failed to list templates: %v", err)
+			}
+			if len(templates) != 2 || templates[0].Name != "activists" || templates[1].Name != "startup" {
+				t.Errorf("Expected templates ordered by name, got %+v", templates)
+			}
+			
+			if _, err := store.GetCommunityTemplate("missing"); !errors.Is(err, errs.ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+			for _, bad := range []string{"", "../escape", ".hidden", "has space"} {
+				if err := store.SaveCommunityTemplate(bad, cfg); !errors.Is(err, errs.ErrValidation) {
+					t.Errorf("Expected ErrValidation for name %q, got %v", bad, err)
+				}
+			}
+		})
+	}
+}
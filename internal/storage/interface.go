@@ -1,15 +1,48 @@
 package storage
 
-import "github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+import (
+	"fmt"
+	"sort"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// ErrVersionConflict is returned when an update specifies a version that
+// does not match the stored version (optimistic locking). It is an
+// errs.ErrConflict, like the other sentinels in this package.
+var ErrVersionConflict = errs.Conflict("version conflict")
+
+// checkVersion verifies an update's expected version against the stored one.
+// An expected version of zero skips the check.
+func checkVersion(kind, id string, stored, expected int) error {
+	if expected != 0 && expected != stored {
+		return fmt.Errorf("%w: %s %s is at version %d, got %d", ErrVersionConflict, kind, id, stored, expected)
+	}
+	return nil
+}
 
 // Storage defines the interface for persona storage backends
 type Storage interface {
-	// Persona operations
+	// Persona operations. Get returns soft-deleted personas, with DeletedAt
+	// set, but List leaves them out; ListDeleted returns only those.
+	// ListPersonasFiltered includes them only if the filter asks to.
 	Create(p *types.Persona) error
 	Get(id string) (types.Persona, error)
 	List() ([]types.Persona, error)
+	ListDeleted() ([]types.Persona, error)
+	ListPersonasFiltered(filter *types.PersonaFilter) ([]types.Persona, error)
 	Update(id string, p types.Persona) error
 	Delete(id string) error
+	SoftDelete(id string) error
+	Restore(id string) error
+
+	// Persona version history. AddPersonaVersion appends a past state of a
+	// persona as the next version, numbered from 1; ListPersonaVersions
+	// returns the history oldest first, empty if there is none. Delete also
+	// removes a persona's history.
+	AddPersonaVersion(p types.Persona) error
+	ListPersonaVersions(id string) ([]types.PersonaVersion, error)
 
 	// Identity operations
 	CreateIdentity(i *types.Identity) error
@@ -19,10 +52,70 @@ type Storage interface {
 	DeleteIdentity(id string) error
 	GetIdentityWithPersona(id string) (types.IdentityWithPersona, error)
 
+	// ModifyIdentity reads an identity, passes it to modify and stores the
+	// result as one atomic step, so concurrent changes are not lost. modify
+	// reports whether it changed anything; if not, nothing is written. It
+	// may be called more than once and must not change the identity's ID or
+	// persona. Returns the identity as stored.
+	ModifyIdentity(id string, modify func(i *types.Identity) (bool, error)) (types.Identity, error)
+
 	// Community operations
 	CreateCommunity(c *types.Community) error
 	GetCommunity(id string) (types.Community, error)
 	ListCommunities(filter *types.CommunityFilter) ([]types.Community, error)
 	UpdateCommunity(id string, c types.Community) error
 	DeleteCommunity(id string) error
+
+	// Relationship operations. Deleting an identity also deletes every
+	// relationship it is part of.
+	CreateRelationship(r *types.Relationship) error
+	ListRelationships(identityID string) ([]types.Relationship, error)
+	DeleteRelationship(id string) error
+}
+
+// ErrPersonaDeleted is returned when an operation needs a persona that has
+// been soft-deleted
+var ErrPersonaDeleted = errs.Conflict("persona is deleted")
+
+// ErrPersonaNotDeleted is returned when restoring a persona that is not
+// soft-deleted
+var ErrPersonaNotDeleted = errs.Conflict("persona is not deleted")
+
+// checkModifiedIdentity rejects changes ModifyIdentity does not allow
+func checkModifiedIdentity(before, after types.Identity) error {
+	if after.Id != before.Id || after.PersonaId != before.PersonaId {
+		return errs.Validation("an identity's ID and persona cannot be modified")
+	}
+	return nil
+}
+
+// validateRelationship checks the fields every backend requires before a
+// relationship is stored
+func validateRelationship(r *types.Relationship) error {
+	if r == nil {
+		return errs.Validation("relationship cannot be nil")
+	}
+	if r.FromId == "" || r.ToId == "" {
+		return errs.Validation("relationship from_id and to_id are required")
+	}
+	if r.FromId == r.ToId {
+		return errs.Validation("an identity cannot have a relationship with itself")
+	}
+	if r.Type == "" {
+		return errs.Validation("relationship type is required")
+	}
+	if r.Strength < 0 || r.Strength > 1 {
+		return errs.Validation("relationship strength must be between 0 and 1")
+	}
+	return nil
+}
+
+// sortRelationships orders relationships oldest first, by ID for ties
+func sortRelationships(relationships []types.Relationship) {
+	sort.Slice(relationships, func(i, j int) bool {
+		if !relationships[i].CreatedAt.Equal(relationships[j].CreatedAt) {
+			return relationships[i].CreatedAt.Before(relationships[j].CreatedAt)
+		}
+		return relationships[i].Id < relationships[j].Id
+	})
 }
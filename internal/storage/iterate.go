@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"slices"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// IdentityIterator is implemented by storage backends that can hand out
+// identities one at a time, so exporting every identity never has to hold
+// them all in memory at once
+type IdentityIterator interface {
+	// ForEachIdentity calls fn with each identity matching filter, ordered
+	// by ID. Identities deleted during the iteration are skipped. No lock
+	// is held while fn runs, so fn may use the storage. An error from fn
+	// stops the iteration and is returned.
+	ForEachIdentity(filter *types.IdentityFilter, fn func(types.Identity) error) error
+}
+
+// ForEachIdentity iterates the identities matching filter through s, using
+// its IdentityIterator implementation when it has one and listing them all
+// otherwise
+func ForEachIdentity(s Storage, filter *types.IdentityFilter, fn func(types.Identity) error) error {
+	if iterator, ok := As[IdentityIterator](s); ok {
+		return iterator.ForEachIdentity(filter, fn)
+	}
+
+	identities, err := s.ListIdentities(filter)
+	if err != nil {
+		return err
+	}
+	for _, i := range identities {
+		if err := fn(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachMatchingIdentity looks up each ID with get and passes the
+// identities matching filter to fn
+func forEachMatchingIdentity(ids []string, get func(id string) (types.Identity, error), filter *types.IdentityFilter, fn func(types.Identity) error) error {
+	slices.Sort(ids)
+	return forEachMember(ids, get, func(i types.Identity) error {
+		if !matchesIdentityFilter(i, filter) {
+			return nil
+		}
+		return fn(i)
+	})
+}
+
+// ForEachIdentity implements IdentityIterator
+func (m *MemoryStorage) ForEachIdentity(filter *types.IdentityFilter, fn func(types.Identity) error) error {
+	m.identitiesMu.RLock()
+	ids := make([]string, 0, len(m.identities))
+	for id := range m.identities {
+		ids = append(ids, id)
+	}
+	m.identitiesMu.RUnlock()
+
+	return forEachMatchingIdentity(ids, m.GetIdentity, filter, fn)
+}
+
+// ForEachIdentity implements IdentityIterator. Each identity's file is read
+// only when its turn comes, and only the persona's files are read when
+// filter names a persona.
+func (f *FileStorage) ForEachIdentity(filter *types.IdentityFilter, fn func(types.Identity) error) error {
+	f.mu.RLock()
+	var ids []string
+	var err error
+	if filter != nil && filter.PersonaID != "" {
+		ids = f.personaIdentities.ids(filter.PersonaID)
+	} else {
+		ids, err = f.identityIDs()
+	}
+	f.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	return forEachMatchingIdentity(ids, f.GetIdentity, filter, fn)
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// MemberIterator is implemented by storage backends that can hand out a
+// community's members one at a time, so large communities never have to be
+// held in memory at once
+type MemberIterator interface {
+	// ForEachCommunityMember calls fn with each member identity of a
+	// community, in member order. Members whose identities no longer exist
+	// are skipped. No lock is held while fn runs, so fn may use the storage.
+	// An error from fn stops the iteration and is returned.
+	ForEachCommunityMember(communityID string, fn func(types.Identity) error) error
+}
+
+// ForEachCommunityMember iterates a community's members through s, using
+// its MemberIterator implementation when it has one and fetching members
+// one by one otherwise
+func ForEachCommunityMember(s Storage, communityID string, fn func(types.Identity) error) error {
+	if iterator, ok := As[MemberIterator](s); ok {
+		return iterator.ForEachCommunityMember(communityID, fn)
+	}
+
+	c, err := s.GetCommunity(communityID)
+	if err != nil {
+		return err
+	}
+	return forEachMember(c.MemberIds, s.GetIdentity, fn)
+}
+
+// forEachMember looks up each member ID with get and passes the identities
+// found to fn
+func forEachMember(memberIDs []string, get func(id string) (types.Identity, error), fn func(types.Identity) error) error {
+	for _, id := range memberIDs {
+		member, err := get(id)
+		if errors.Is(err, errs.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachCommunityMember implements MemberIterator
+func (m *MemoryStorage) ForEachCommunityMember(communityID string, fn func(types.Identity) error) error {
+	c, err := m.GetCommunity(communityID)
+	if err != nil {
+		return err
+	}
+	return forEachMember(c.MemberIds, m.GetIdentity, fn)
+}
+
+// ForEachCommunityMember implements MemberIterator. Each member's file is
+// read only when its turn comes.
+func (f *FileStorage) ForEachCommunityMember(communityID string, fn func(types.Identity) error) error {
+	c, err := f.GetCommunity(communityID)
+	if err != nil {
+		return err
+	}
+	return forEachMember(c.MemberIds, f.GetIdentity, fn)
+}
@@ -1,130 +1,221 @@
 package storage
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"fmt"
-	"strings"
+	"io"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/ids"
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
 )
 
-// MemoryStorage implements in-memory storage for personas and identities
+// MemoryStorage implements in-memory storage for personas and identities.
+// Each entity type has its own lock so reads of one type never wait on
+// writes to another. Operations that need more than one lock take them in
+// the order personas, identities, relationships, communities.
 type MemoryStorage struct {
-	personas    map[string]types.Persona
-	identities  map[string]types.Identity
-	communities map[string]types.Community
-	mu          sync.RWMutex
+	personas        map[string]types.Persona
+	versions        map[string][]types.PersonaVersion // persona ID -> history
+	personasMu      sync.RWMutex
+	identities      map[string]types.Identity
+	avatars         map[string]types.Avatar // by identity ID, guarded by identitiesMu
+	identitiesMu    sync.RWMutex
+	relationships   map[string]types.Relationship
+	relationshipsMu sync.RWMutex
+	communities     map[string]types.Community
+	communitiesMu   sync.RWMutex
+	templates       map[string]types.CommunityTemplate // by name
+	templatesMu     sync.RWMutex
 }
 
 // NewMemoryStorage creates a new in-memory storage instance
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		personas:    make(map[string]types.Persona),
-		identities:  make(map[string]types.Identity),
-		communities: make(map[string]types.Community),
+		personas:      make(map[string]types.Persona),
+		versions:      make(map[string][]types.PersonaVersion),
+		identities:    make(map[string]types.Identity),
+		avatars:       make(map[string]types.Avatar),
+		relationships: make(map[string]types.Relationship),
+		communities:   make(map[string]types.Community),
+		templates:     make(map[string]types.CommunityTemplate),
 	}
 }
 
-// generateID creates a random ID for a persona or identity
-func generateID() string {
-	bytes := make([]byte, 8)
-	rand.Read(bytes)
-	return hex.EncodeToString(bytes)
-}
-
 // Persona operations
 func (m *MemoryStorage) Create(p *types.Persona) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.personasMu.Lock()
+	defer m.personasMu.Unlock()
 
 	if p == nil {
-		return fmt.Errorf("persona cannot be nil")
+		return errs.Validation("persona cannot be nil")
 	}
 	if p.Name == "" {
-		return fmt.Errorf("persona name is required")
+		return errs.Validation("persona name is required")
 	}
 	if p.Topic == "" {
-		return fmt.Errorf("persona topic is required")
+		return errs.Validation("persona topic is required")
 	}
 	if p.Prompt == "" {
-		return fmt.Errorf("persona prompt is required")
+		return errs.Validation("persona prompt is required")
 	}
 
-	p.Id = generateID()
+	p.Id = ids.New()
+	p.Version = 1
+	now := time.Now()
+	p.CreatedAt = now
+	p.UpdatedAt = now
 	m.personas[p.Id] = *p
 	return nil
 }
 
 func (m *MemoryStorage) Get(id string) (types.Persona, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.personasMu.RLock()
+	defer m.personasMu.RUnlock()
 
 	p, exists := m.personas[id]
 	if !exists {
-		return types.Persona{}, fmt.Errorf("persona not found: %s", id)
+		return types.Persona{}, errs.NotFound("persona not found: %s", id)
 	}
 	return p, nil
 }
 
 func (m *MemoryStorage) List() ([]types.Persona, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.personasMu.RLock()
+	defer m.personasMu.RUnlock()
 
 	result := make([]types.Persona, 0, len(m.personas))
 	for _, p := range m.personas {
-		result = append(result, p)
+		if p.DeletedAt == nil {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (m *MemoryStorage) ListPersonasFiltered(filter *types.PersonaFilter) ([]types.Persona, error) {
+	m.personasMu.RLock()
+	defer m.personasMu.RUnlock()
+
+	result := make([]types.Persona, 0)
+	for _, p := range m.personas {
+		if matchesPersonaFilter(p, filter) {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (m *MemoryStorage) ListDeleted() ([]types.Persona, error) {
+	m.personasMu.RLock()
+	defer m.personasMu.RUnlock()
+
+	result := make([]types.Persona, 0)
+	for _, p := range m.personas {
+		if p.DeletedAt != nil {
+			result = append(result, p)
+		}
 	}
 	return result, nil
 }
 
 func (m *MemoryStorage) Update(id string, p types.Persona) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.personasMu.Lock()
+	defer m.personasMu.Unlock()
 
-	if _, exists := m.personas[id]; !exists {
-		return fmt.Errorf("persona not found: %s", id)
+	existing, exists := m.personas[id]
+	if !exists {
+		return errs.NotFound("persona not found: %s", id)
+	}
+	if err := checkVersion("persona", id, existing.Version, p.Version); err != nil {
+		return err
 	}
 
 	p.Id = id
+	p.Version = existing.Version + 1
+	p.CreatedAt = existing.CreatedAt
+	p.UpdatedAt = time.Now()
+	p.DeletedAt = existing.DeletedAt
 	m.personas[id] = p
 	return nil
 }
 
 func (m *MemoryStorage) Delete(id string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.personasMu.Lock()
+	defer m.personasMu.Unlock()
 
 	if _, exists := m.personas[id]; !exists {
-		return fmt.Errorf("persona not found: %s", id)
+		return errs.NotFound("persona not found: %s", id)
 	}
 	delete(m.personas, id)
+	delete(m.versions, id)
+	return nil
+}
+
+// SoftDelete marks a persona as deleted without removing it
+func (m *MemoryStorage) SoftDelete(id string) error {
+	m.personasMu.Lock()
+	defer m.personasMu.Unlock()
+
+	p, exists := m.personas[id]
+	if !exists || p.DeletedAt != nil {
+		return errs.NotFound("persona not found: %s", id)
+	}
+	now := time.Now()
+	p.DeletedAt = &now
+	p.Version++
+	m.personas[id] = p
+	return nil
+}
+
+// Restore clears a persona's soft-deleted mark
+func (m *MemoryStorage) Restore(id string) error {
+	m.personasMu.Lock()
+	defer m.personasMu.Unlock()
+
+	p, exists := m.personas[id]
+	if !exists {
+		return errs.NotFound("persona not found: %s", id)
+	}
+	if p.DeletedAt == nil {
+		return fmt.Errorf("%w: %s", ErrPersonaNotDeleted, id)
+	}
+	p.DeletedAt = nil
+	p.Version++
+	m.personas[id] = p
 	return nil
 }
 
 // Identity operations
 func (m *MemoryStorage) CreateIdentity(i *types.Identity) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.personasMu.RLock()
+	defer m.personasMu.RUnlock()
+	m.identitiesMu.Lock()
+	defer m.identitiesMu.Unlock()
 
 	if i == nil {
-		return fmt.Errorf("identity cannot be nil")
+		return errs.Validation("identity cannot be nil")
 	}
 	if i.PersonaId == "" {
-		return fmt.Errorf("persona ID is required")
+		return errs.Validation("persona ID is required")
 	}
 	if i.Name == "" {
-		return fmt.Errorf("identity name is required")
+		return errs.Validation("identity name is required")
 	}
 
 	// Verify persona exists
-	if _, exists := m.personas[i.PersonaId]; !exists {
-		return fmt.Errorf("referenced persona not found: %s", i.PersonaId)
+	p, exists := m.personas[i.PersonaId]
+	if !exists {
+		return errs.NotFound("referenced persona not found: %s", i.PersonaId)
+	}
+	if p.DeletedAt != nil {
+		return fmt.Errorf("%w: %s", ErrPersonaDeleted, i.PersonaId)
 	}
 
-	i.Id = generateID()
+	i.Id = ids.New()
 	now := time.Now()
 	i.CreatedAt = now
 	i.UpdatedAt = now
@@ -136,65 +227,31 @@ func (m *MemoryStorage) CreateIdentity(i *types.Identity) error {
 	if i.Tags == nil {
 		i.Tags = []string{}
 	}
-	if !i.IsActive {
-		i.IsActive = true
-	}
 
 	m.identities[i.Id] = *i
 	return nil
 }
 
 func (m *MemoryStorage) GetIdentity(id string) (types.Identity, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.identitiesMu.RLock()
+	defer m.identitiesMu.RUnlock()
 
 	i, exists := m.identities[id]
 	if !exists {
-		return types.Identity{}, fmt.Errorf("identity not found: %s", id)
+		return types.Identity{}, errs.NotFound("identity not found: %s", id)
 	}
 	return i, nil
 }
 
 func (m *MemoryStorage) ListIdentities(filter *types.IdentityFilter) ([]types.Identity, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.identitiesMu.RLock()
+	defer m.identitiesMu.RUnlock()
 
 	var result []types.Identity
 
 	for _, i := range m.identities {
-		// Apply filters
-		if filter != nil {
-			if filter.PersonaID != "" && i.PersonaId != filter.PersonaID {
-				continue
-			}
-			if filter.IsActive != nil && i.IsActive != *filter.IsActive {
-				continue
-			}
-			if len(filter.Tags) > 0 {
-				hasTag := false
-				for _, tag := range filter.Tags {
-					for _, identityTag := range i.Tags {
-						if identityTag == tag {
-							hasTag = true
-							break
-						}
-					}
-					if hasTag {
-						break
-					}
-				}
-				if !hasTag {
-					continue
-				}
-			}
-			if filter.Search != "" {
-				searchLower := strings.ToLower(filter.Search)
-				nameMatch := strings.Contains(strings.ToLower(i.Name), searchLower)
-				descMatch := strings.Contains(strings.ToLower(i.Description), searchLower)
-				if !nameMatch && !descMatch {
-					continue
-				}
-			}
+		if !matchesIdentityFilter(i, filter) {
+			continue
 		}
 		result = append(result, i)
 	}
@@ -203,47 +260,98 @@ func (m *MemoryStorage) ListIdentities(filter *types.IdentityFilter) ([]types.Id
 }
 
 func (m *MemoryStorage) UpdateIdentity(id string, i types.Identity) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.personasMu.RLock()
+	defer m.personasMu.RUnlock()
+	m.identitiesMu.Lock()
+	defer m.identitiesMu.Unlock()
 
-	if _, exists := m.identities[id]; !exists {
-		return fmt.Errorf("identity not found: %s", id)
+	existing, exists := m.identities[id]
+	if !exists {
+		return errs.NotFound("identity not found: %s", id)
 	}
 
 	// Verify persona exists
-	if _, exists := m.personas[i.PersonaId]; !exists {
-		return fmt.Errorf("referenced persona not found: %s", i.PersonaId)
+	p, exists := m.personas[i.PersonaId]
+	if !exists {
+		return errs.NotFound("referenced persona not found: %s", i.PersonaId)
+	}
+	if p.DeletedAt != nil {
+		return fmt.Errorf("%w: %s", ErrPersonaDeleted, i.PersonaId)
 	}
 
 	i.Id = id
+	i.CreatedAt = existing.CreatedAt
 	i.UpdatedAt = time.Now()
 	m.identities[id] = i
 	return nil
 }
 
+func (m *MemoryStorage) ModifyIdentity(id string, modify func(i *types.Identity) (bool, error)) (types.Identity, error) {
+	m.identitiesMu.Lock()
+	defer m.identitiesMu.Unlock()
+
+	current, exists := m.identities[id]
+	if !exists {
+		return types.Identity{}, errs.NotFound("identity not found: %s", id)
+	}
+
+	// modify gets its own tags so the stored slice is never changed in place
+	i := current
+	i.Tags = slices.Clone(current.Tags)
+	changed, err := modify(&i)
+	if err != nil || !changed {
+		return current, err
+	}
+	if err := checkModifiedIdentity(current, i); err != nil {
+		return types.Identity{}, err
+	}
+
+	i.UpdatedAt = time.Now()
+	m.identities[id] = i
+	return i, nil
+}
+
 func (m *MemoryStorage) DeleteIdentity(id string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.identitiesMu.Lock()
+	defer m.identitiesMu.Unlock()
 
 	if _, exists := m.identities[id]; !exists {
-		return fmt.Errorf("identity not found: %s", id)
+		return errs.NotFound("identity not found: %s", id)
 	}
 	delete(m.identities, id)
+	delete(m.avatars, id)
+
+	m.relationshipsMu.Lock()
+	defer m.relationshipsMu.Unlock()
+	for relID, r := range m.relationships {
+		if r.Involves(id) {
+			delete(m.relationships, relID)
+		}
+	}
 	return nil
 }
 
+// CountIdentities implements IdentityCounter
+func (m *MemoryStorage) CountIdentities() (int, error) {
+	m.identitiesMu.RLock()
+	defer m.identitiesMu.RUnlock()
+	return len(m.identities), nil
+}
+
 func (m *MemoryStorage) GetIdentityWithPersona(id string) (types.IdentityWithPersona, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.personasMu.RLock()
+	defer m.personasMu.RUnlock()
+	m.identitiesMu.RLock()
+	defer m.identitiesMu.RUnlock()
 
 	i, exists := m.identities[id]
 	if !exists {
-		return types.IdentityWithPersona{}, fmt.Errorf("identity not found: %s", id)
+		return types.IdentityWithPersona{}, errs.NotFound("identity not found: %s", id)
 	}
 
 	p, exists := m.personas[i.PersonaId]
 	if !exists {
-		return types.IdentityWithPersona{}, fmt.Errorf("referenced persona not found: %s", i.PersonaId)
+		return types.IdentityWithPersona{}, errs.NotFound("referenced persona not found: %s", i.PersonaId)
 	}
 
 	return types.IdentityWithPersona{
@@ -254,21 +362,21 @@ func (m *MemoryStorage) GetIdentityWithPersona(id string) (types.IdentityWithPer
 
 // Community operations
 func (m *MemoryStorage) CreateCommunity(c *types.Community) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.communitiesMu.Lock()
+	defer m.communitiesMu.Unlock()
 
 	if c == nil {
-		return fmt.Errorf("community cannot be nil")
+		return errs.Validation("community cannot be nil")
 	}
 	if c.Name == "" {
-		return fmt.Errorf("community name is required")
+		return errs.Validation("community name is required")
 	}
 	if c.Type == "" {
-		return fmt.Errorf("community type is required")
+		return errs.Validation("community type is required")
 	}
 
 	if c.Id == "" {
-		c.Id = generateID()
+		c.Id = ids.New()
 	}
 	
 	// Initialize empty slices if nil
@@ -287,68 +395,25 @@ func (m *MemoryStorage) CreateCommunity(c *types.Community) error {
 }
 
 func (m *MemoryStorage) GetCommunity(id string) (types.Community, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.communitiesMu.RLock()
+	defer m.communitiesMu.RUnlock()
 
 	c, exists := m.communities[id]
 	if !exists {
-		return types.Community{}, fmt.Errorf("community not found: %s", id)
+		return types.Community{}, errs.NotFound("community not found: %s", id)
 	}
 	return c, nil
 }
 
 func (m *MemoryStorage) ListCommunities(filter *types.CommunityFilter) ([]types.Community, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.communitiesMu.RLock()
+	defer m.communitiesMu.RUnlock()
 
 	var result []types.Community
 
 	for _, c := range m.communities {
-		// Apply filters
-		if filter != nil {
-			if filter.Type != "" && c.Type != filter.Type {
-				continue
-			}
-			if filter.IsActive != nil && c.IsActive != *filter.IsActive {
-				continue
-			}
-			if filter.MinSize != nil && c.Size < *filter.MinSize {
-				continue
-			}
-			if filter.MaxSize != nil && c.Size > *filter.MaxSize {
-				continue
-			}
-			if filter.MinDiversity != nil && c.Diversity < *filter.MinDiversity {
-				continue
-			}
-			if filter.MaxDiversity != nil && c.Diversity > *filter.MaxDiversity {
-				continue
-			}
-			if len(filter.Tags) > 0 {
-				hasTag := false
-				for _, tag := range filter.Tags {
-					for _, communityTag := range c.Tags {
-						if communityTag == tag {
-							hasTag = true
-							break
-						}
-					}
-					if hasTag {
-						break
-					}
-				}
-				if !hasTag {
-					continue
-				}
-			}
-			if filter.Search != "" {
-				searchLower := strings.ToLower(filter.Search)
-				nameMatch := strings.Contains(strings.ToLower(c.Name), searchLower)
-				descMatch := strings.Contains(strings.ToLower(c.Description), searchLower)
-				if !nameMatch && !descMatch {
-					continue
-				}
-			}
+		if !matchesCommunityFilter(c, filter) {
+			continue
 		}
 		result = append(result, c)
 	}
@@ -357,11 +422,11 @@ func (m *MemoryStorage) ListCommunities(filter *types.CommunityFilter) ([]types.
 }
 
 func (m *MemoryStorage) UpdateCommunity(id string, c types.Community) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.communitiesMu.Lock()
+	defer m.communitiesMu.Unlock()
 
 	if _, exists := m.communities[id]; !exists {
-		return fmt.Errorf("community not found: %s", id)
+		return errs.NotFound("community not found: %s", id)
 	}
 
 	c.Id = id
@@ -370,12 +435,247 @@ func (m *MemoryStorage) UpdateCommunity(id string, c types.Community) error {
 }
 
 func (m *MemoryStorage) DeleteCommunity(id string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.communitiesMu.Lock()
+	defer m.communitiesMu.Unlock()
 
 	if _, exists := m.communities[id]; !exists {
-		return fmt.Errorf("community not found: %s", id)
+		return errs.NotFound("community not found: %s", id)
 	}
 	delete(m.communities, id)
 	return nil
 }
+
+// AddPersonaVersion appends p to its persona's version history
+func (m *MemoryStorage) AddPersonaVersion(p types.Persona) error {
+	m.personasMu.Lock()
+	defer m.personasMu.Unlock()
+
+	if p.Id == "" {
+		return errs.Validation("persona ID is required")
+	}
+	history := m.versions[p.Id]
+	m.versions[p.Id] = append(history, types.PersonaVersion{
+		Version:   len(history) + 1,
+		CreatedAt: time.Now(),
+		Persona:   p,
+	})
+	return nil
+}
+
+func (m *MemoryStorage) ListPersonaVersions(id string) ([]types.PersonaVersion, error) {
+	m.personasMu.RLock()
+	defer m.personasMu.RUnlock()
+
+	return append(make([]types.PersonaVersion, 0), m.versions[id]...), nil
+}
+
+// Relationship operations
+func (m *MemoryStorage) CreateRelationship(r *types.Relationship) error {
+	m.identitiesMu.RLock()
+	defer m.identitiesMu.RUnlock()
+	m.relationshipsMu.Lock()
+	defer m.relationshipsMu.Unlock()
+
+	if err := validateRelationship(r); err != nil {
+		return err
+	}
+	for _, id := range []string{r.FromId, r.ToId} {
+		if _, exists := m.identities[id]; !exists {
+			return errs.NotFound("identity not found: %s", id)
+		}
+	}
+
+	r.Id = ids.New()
+	r.CreatedAt = time.Now()
+	m.relationships[r.Id] = *r
+	return nil
+}
+
+func (m *MemoryStorage) ListRelationships(identityID string) ([]types.Relationship, error) {
+	m.relationshipsMu.RLock()
+	defer m.relationshipsMu.RUnlock()
+
+	result := make([]types.Relationship, 0)
+	for _, r := range m.relationships {
+		if r.Involves(identityID) {
+			result = append(result, r)
+		}
+	}
+	sortRelationships(result)
+	return result, nil
+}
+
+func (m *MemoryStorage) DeleteRelationship(id string) error {
+	m.relationshipsMu.Lock()
+	defer m.relationshipsMu.Unlock()
+
+	if _, exists := m.relationships[id]; !exists {
+		return errs.NotFound("relationship not found: %s", id)
+	}
+	delete(m.relationships, id)
+	return nil
+}
+
+// BackupTo serializes the current state to a tar.gz archive, entries in
+// ID order
+func (m *MemoryStorage) BackupTo(w io.Writer) error {
+	m.personasMu.RLock()
+	defer m.personasMu.RUnlock()
+	m.identitiesMu.RLock()
+	defer m.identitiesMu.RUnlock()
+	m.relationshipsMu.RLock()
+	defer m.relationshipsMu.RUnlock()
+	m.communitiesMu.RLock()
+	defer m.communitiesMu.RUnlock()
+
+	a := newArchiveWriter(w)
+	for _, id := range slices.Sorted(maps.Keys(m.personas)) {
+		if err := a.addJSON(archivePersonas, id, m.personas[id]); err != nil {
+			return err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(m.identities)) {
+		if err := a.addJSON(archiveIdentities, id, m.identities[id]); err != nil {
+			return err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(m.communities)) {
+		if err := a.addJSON(archiveCommunities, id, m.communities[id]); err != nil {
+			return err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(m.relationships)) {
+		if err := a.addJSON(archiveRelationships, id, m.relationships[id]); err != nil {
+			return err
+		}
+	}
+	return a.Close()
+}
+
+// RestoreFrom loads the archived entities into memory
+func (m *MemoryStorage) RestoreFrom(r io.Reader, overwrite bool) error {
+	a, err := readArchive(r)
+	if err != nil {
+		return err
+	}
+
+	m.personasMu.Lock()
+	defer m.personasMu.Unlock()
+	m.identitiesMu.Lock()
+	defer m.identitiesMu.Unlock()
+	m.relationshipsMu.Lock()
+	defer m.relationshipsMu.Unlock()
+	m.communitiesMu.Lock()
+	defer m.communitiesMu.Unlock()
+
+	for _, p := range a.personas {
+		if _, exists := m.personas[p.Id]; !exists || overwrite {
+			m.personas[p.Id] = p
+		}
+	}
+	for _, i := range a.identities {
+		if _, exists := m.identities[i.Id]; !exists || overwrite {
+			m.identities[i.Id] = i
+		}
+	}
+	for _, c := range a.communities {
+		if _, exists := m.communities[c.Id]; !exists || overwrite {
+			m.communities[c.Id] = c
+		}
+	}
+	for _, rel := range a.relationships {
+		if _, exists := m.relationships[rel.Id]; !exists || overwrite {
+			m.relationships[rel.Id] = rel
+		}
+	}
+	return nil
+}
+
+// Community template operations
+func (m *MemoryStorage) SaveCommunityTemplate(name string, cfg types.CommunityGenerationConfig) error {
+	if err := validateTemplateName(name); err != nil {
+		return err
+	}
+
+	m.templatesMu.Lock()
+	defer m.templatesMu.Unlock()
+
+	now := time.Now()
+	t, exists := m.templates[name]
+	if !exists {
+		t = types.CommunityTemplate{Name: name, CreatedAt: now}
+	}
+	t.Config = cfg
+	t.UpdatedAt = now
+	m.templates[name] = t
+	return nil
+}
+
+func (m *MemoryStorage) GetCommunityTemplate(name string) (types.CommunityTemplate, error) {
+	m.templatesMu.RLock()
+	defer m.templatesMu.RUnlock()
+
+	t, exists := m.templates[name]
+	if !exists {
+		return types.CommunityTemplate{}, errs.NotFound("community template not found: %s", name)
+	}
+	return t, nil
+}
+
+func (m *MemoryStorage) ListCommunityTemplates() ([]types.CommunityTemplate, error) {
+	m.templatesMu.RLock()
+	defer m.templatesMu.RUnlock()
+
+	templates := make([]types.CommunityTemplate, 0, len(m.templates))
+	for _, name := range slices.Sorted(maps.Keys(m.templates)) {
+		templates = append(templates, m.templates[name])
+	}
+	return templates, nil
+}
+
+// Identity avatar operations
+func (m *MemoryStorage) SaveIdentityAvatar(identityID string, avatar types.Avatar) error {
+	if _, ok := avatarExtensions[avatar.ContentType]; !ok {
+		return errs.Validation("unsupported avatar content type: %s", avatar.ContentType)
+	}
+
+	m.identitiesMu.Lock()
+	defer m.identitiesMu.Unlock()
+
+	if _, exists := m.identities[identityID]; !exists {
+		return errs.NotFound("identity not found: %s", identityID)
+	}
+	avatar.Data = slices.Clone(avatar.Data)
+	avatar.UpdatedAt = time.Now()
+	m.avatars[identityID] = avatar
+	return nil
+}
+
+func (m *MemoryStorage) GetIdentityAvatar(identityID string) (types.Avatar, error) {
+	m.identitiesMu.RLock()
+	defer m.identitiesMu.RUnlock()
+
+	if _, exists := m.identities[identityID]; !exists {
+		return types.Avatar{}, errs.NotFound("identity not found: %s", identityID)
+	}
+	avatar, exists := m.avatars[identityID]
+	if !exists {
+		return types.Avatar{}, errs.NotFound("avatar not found for identity: %s", identityID)
+	}
+	avatar.Data = slices.Clone(avatar.Data)
+	return avatar, nil
+}
+
+func (m *MemoryStorage) DeleteIdentityAvatar(identityID string) error {
+	m.identitiesMu.Lock()
+	defer m.identitiesMu.Unlock()
+
+	if _, exists := m.identities[identityID]; !exists {
+		return errs.NotFound("identity not found: %s", identityID)
+	}
+	if _, exists := m.avatars[identityID]; !exists {
+		return errs.NotFound("avatar not found for identity: %s", identityID)
+	}
+	delete(m.avatars, identityID)
+	return nil
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
@@ -160,6 +161,122 @@ func BenchmarkMemoryStorage_Get(b *testing.B) {
 	}
 }
 
+func BenchmarkMemoryStorage_ParallelGet(b *testing.B) {
+	storage := NewMemoryStorage()
+	
+	personas := make([]*types.Persona, 1000)
+	for i := range personas {
+		p := &types.Persona{
+			Name:   "Test Expert",
+			Topic:  "Testing",
+			Prompt: "You are a testing expert.",
+		}
+		storage.Create(p)
+		personas[i] = p
+	}
+	
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			storage.Get(personas[i%len(personas)].Id)
+			i++
+		}
+	})
+}
+
+// BenchmarkMemoryStorage_ParallelGetWithIdentityWrites measures persona
+// reads while identities are written concurrently. With a single storage
+// lock every identity write stalled all persona reads; with per-entity locks
+// the reads proceed.
+func BenchmarkMemoryStorage_ParallelGetWithIdentityWrites(b *testing.B) {
+	storage := NewMemoryStorage()
+	
+	personas := make([]*types.Persona, 1000)
+	for i := range personas {
+		p := &types.Persona{
+			Name:   "Test Expert",
+			Topic:  "Testing",
+			Prompt: "You are a testing expert.",
+		}
+		storage.Create(p)
+		personas[i] = p
+	}
+	
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 0; ; n++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			identity := &types.Identity{PersonaId: personas[n%len(personas)].Id, Name: "Writer"}
+			if storage.CreateIdentity(identity) == nil {
+				storage.DeleteIdentity(identity.Id)
+			}
+		}
+	}()
+	
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			storage.Get(personas[i%len(personas)].Id)
+			i++
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-done
+}
+
+func TestMemoryStorage_ConcurrentMixedAccess(t *testing.T) {
+	storage := NewMemoryStorage()
+	p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+	if err := storage.Create(p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			identity := &types.Identity{PersonaId: p.Id, Name: "Member"}
+			if err := storage.CreateIdentity(identity); err != nil {
+				t.Errorf("Failed to create identity: %v", err)
+				return
+			}
+			if _, err := storage.GetIdentityWithPersona(identity.Id); err != nil {
+				t.Errorf("Failed to get identity with persona: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			c := &types.Community{Name: "Community", Type: "interest"}
+			if err := storage.CreateCommunity(c); err != nil {
+				t.Errorf("Failed to create community: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := storage.Get(p.Id); err != nil {
+				t.Errorf("Failed to get persona: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	
+	identities, _ := storage.ListIdentities(nil)
+	communities, _ := storage.ListCommunities(nil)
+	if len(identities) != 10 || len(communities) != 10 {
+		t.Errorf("Expected 10 identities and 10 communities, got %d and %d", len(identities), len(communities))
+	}
+}
+
 func TestMemoryStorage_ConcurrentAccess(t *testing.T) {
 	storage := NewMemoryStorage()
 	
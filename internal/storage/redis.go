@@ -0,0 +1,711 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/ids"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// Redis key layout. Each entity is a JSON string under "<type>:<id>" and the
+// IDs of each type are kept in a set used by the List operations. Every
+// identity also has a set of the relationships it is part of, and every
+// updated persona a JSON array of its past versions.
+const (
+	redisPersonasKey     = "personas"
+	redisIdentitiesKey   = "identities"
+	redisCommunitiesKey  = "communities"
+	redisPersonaPrefix   = "persona:"
+	redisIdentityPrefix  = "identity:"
+	redisCommunityPrefix = "community:"
+	redisRelationPrefix  = "relationship:"
+	redisRelationsPrefix = "relationships:"
+	redisVersionsPrefix  = "persona_versions:"
+	redisMaxTxAttempts   = 10
+)
+
+// RedisStorage implements storage backed by a Redis server, so several API
+// and gRPC instances can share the same data. Read-modify-write operations
+// run in WATCH/MULTI/EXEC transactions and are retried when another client
+// changes the same keys first.
+type RedisStorage struct {
+	pool *redisPool
+}
+
+// NewRedisStorage connects to the Redis server at addr, selecting database
+// db, and pings it. An empty password skips AUTH.
+func NewRedisStorage(addr, password string, db int) (*RedisStorage, error) {
+	r := &RedisStorage{pool: newRedisPool(addr, password, db)}
+	if err := r.Ping(); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("failed to connect to redis at %s: %v", addr, err)
+	}
+	return r, nil
+}
+
+// Ping checks that the server is reachable
+func (r *RedisStorage) Ping() error {
+	_, err := r.pool.do("PING")
+	return err
+}
+
+// Close closes the idle connections
+func (r *RedisStorage) Close() error {
+	r.pool.close()
+	return nil
+}
+
+// redisDoer runs a single command, on a pooled or a specific connection
+type redisDoer interface {
+	do(args ...string) (interface{}, error)
+}
+
+// getJSON decodes the value at key into v and reports whether it existed
+func getJSON(d redisDoer, key string, v interface{}) (bool, error) {
+	reply, err := d.do("GET", key)
+	if err != nil {
+		return false, err
+	}
+	if reply == nil {
+		return false, nil
+	}
+	data, ok := reply.(string)
+	if !ok {
+		return false, fmt.Errorf("unexpected reply for %s", key)
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %v", key, err)
+	}
+	return true, nil
+}
+
+// setCommand returns the SET command storing v as JSON at key
+func setCommand(key string, v interface{}) ([]string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %v", key, err)
+	}
+	return []string{"SET", key, string(data)}, nil
+}
+
+// members returns the members of a set
+func members(d redisDoer, key string) ([]string, error) {
+	reply, err := d.do("SMEMBERS", key)
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]interface{})
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		if id, ok := item.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// loadAll decodes the entities whose IDs are in setKey, calling add for
+// each. IDs left in the set without a value are skipped.
+func loadAll[T any](d redisDoer, setKey, prefix string, add func(T)) error {
+	ids, err := members(d, setKey)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	args := make([]string, 0, len(ids)+1)
+	args = append(args, "MGET")
+	for _, id := range ids {
+		args = append(args, prefix+id)
+	}
+	reply, err := d.do(args...)
+	if err != nil {
+		return err
+	}
+	values, _ := reply.([]interface{})
+	for n, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var v T
+		if err := json.Unmarshal([]byte(data), &v); err != nil {
+			return fmt.Errorf("failed to parse %s%s: %v", prefix, ids[n], err)
+		}
+		add(v)
+	}
+	return nil
+}
+
+// atomically watches keys, lets read inspect them on the same connection
+// and then applies the commands it returns in one transaction. If a watched
+// key changes in between, the whole operation is retried.
+func (r *RedisStorage) atomically(keys []string, read func(c *redisConn) ([][]string, error)) error {
+	for range redisMaxTxAttempts {
+		err := r.tryAtomically(keys, read)
+		if err != errTxAborted {
+			return err
+		}
+	}
+	return fmt.Errorf("redis transaction kept conflicting after %d attempts", redisMaxTxAttempts)
+}
+
+func (r *RedisStorage) tryAtomically(keys []string, read func(c *redisConn) ([][]string, error)) error {
+	c, err := r.pool.get()
+	if err != nil {
+		return err
+	}
+	defer r.pool.put(c)
+
+	if len(keys) > 0 {
+		if _, err := c.do(append([]string{"WATCH"}, keys...)...); err != nil {
+			return err
+		}
+	}
+
+	commands, err := read(c)
+	if err != nil || len(commands) == 0 {
+		if len(keys) > 0 {
+			c.do("UNWATCH")
+		}
+		return err
+	}
+	return c.exec(commands)
+}
+
+// Persona operations
+func (r *RedisStorage) Create(p *types.Persona) error {
+	if p == nil {
+		return errs.Validation("persona cannot be nil")
+	}
+	if p.Name == "" {
+		return errs.Validation("persona name is required")
+	}
+	if p.Topic == "" {
+		return errs.Validation("persona topic is required")
+	}
+	if p.Prompt == "" {
+		return errs.Validation("persona prompt is required")
+	}
+
+	p.Id = ids.New()
+	p.Version = 1
+	now := time.Now()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	set, err := setCommand(redisPersonaPrefix+p.Id, p)
+	if err != nil {
+		return err
+	}
+	return r.atomically(nil, func(*redisConn) ([][]string, error) {
+		return [][]string{set, {"SADD", redisPersonasKey, p.Id}}, nil
+	})
+}
+
+func (r *RedisStorage) Get(id string) (types.Persona, error) {
+	var p types.Persona
+	found, err := getJSON(r.pool, redisPersonaPrefix+id, &p)
+	if err != nil {
+		return types.Persona{}, err
+	}
+	if !found {
+		return types.Persona{}, errs.NotFound("persona not found: %s", id)
+	}
+	return p, nil
+}
+
+func (r *RedisStorage) List() ([]types.Persona, error) {
+	result := make([]types.Persona, 0)
+	err := loadAll(r.pool, redisPersonasKey, redisPersonaPrefix, func(p types.Persona) {
+		if p.DeletedAt == nil {
+			result = append(result, p)
+		}
+	})
+	return result, err
+}
+
+func (r *RedisStorage) ListPersonasFiltered(filter *types.PersonaFilter) ([]types.Persona, error) {
+	result := make([]types.Persona, 0)
+	err := loadAll(r.pool, redisPersonasKey, redisPersonaPrefix, func(p types.Persona) {
+		if matchesPersonaFilter(p, filter) {
+			result = append(result, p)
+		}
+	})
+	return result, err
+}
+
+func (r *RedisStorage) ListDeleted() ([]types.Persona, error) {
+	result := make([]types.Persona, 0)
+	err := loadAll(r.pool, redisPersonasKey, redisPersonaPrefix, func(p types.Persona) {
+		if p.DeletedAt != nil {
+			result = append(result, p)
+		}
+	})
+	return result, err
+}
+
+// updatePersona applies change to the stored persona in a transaction
+func (r *RedisStorage) updatePersona(id string, change func(existing types.Persona) (types.Persona, error)) error {
+	key := redisPersonaPrefix + id
+	return r.atomically([]string{key}, func(c *redisConn) ([][]string, error) {
+		var existing types.Persona
+		found, err := getJSON(c, key, &existing)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errs.NotFound("persona not found: %s", id)
+		}
+
+		updated, err := change(existing)
+		if err != nil {
+			return nil, err
+		}
+		set, err := setCommand(key, updated)
+		if err != nil {
+			return nil, err
+		}
+		return [][]string{set}, nil
+	})
+}
+
+func (r *RedisStorage) Update(id string, p types.Persona) error {
+	return r.updatePersona(id, func(existing types.Persona) (types.Persona, error) {
+		if err := checkVersion("persona", id, existing.Version, p.Version); err != nil {
+			return types.Persona{}, err
+		}
+		// Work on a copy: the transaction may be retried with the caller's p
+		updated := p
+		updated.Id = id
+		updated.Version = existing.Version + 1
+		updated.CreatedAt = existing.CreatedAt
+		updated.UpdatedAt = time.Now()
+		updated.DeletedAt = existing.DeletedAt
+		return updated, nil
+	})
+}
+
+func (r *RedisStorage) Delete(id string) error {
+	key := redisPersonaPrefix + id
+	return r.atomically([]string{key}, func(c *redisConn) ([][]string, error) {
+		exists, err := c.do("EXISTS", key)
+		if err != nil {
+			return nil, err
+		}
+		if exists != int64(1) {
+			return nil, errs.NotFound("persona not found: %s", id)
+		}
+		return [][]string{{"DEL", key}, {"SREM", redisPersonasKey, id}, {"DEL", redisVersionsPrefix + id}}, nil
+	})
+}
+
+// SoftDelete marks a persona as deleted without removing it
+func (r *RedisStorage) SoftDelete(id string) error {
+	return r.updatePersona(id, func(p types.Persona) (types.Persona, error) {
+		if p.DeletedAt != nil {
+			return types.Persona{}, errs.NotFound("persona not found: %s", id)
+		}
+		now := time.Now()
+		p.DeletedAt = &now
+		p.Version++
+		return p, nil
+	})
+}
+
+// Restore clears a persona's soft-deleted mark
+func (r *RedisStorage) Restore(id string) error {
+	return r.updatePersona(id, func(p types.Persona) (types.Persona, error) {
+		if p.DeletedAt == nil {
+			return types.Persona{}, fmt.Errorf("%w: %s", ErrPersonaNotDeleted, id)
+		}
+		p.DeletedAt = nil
+		p.Version++
+		return p, nil
+	})
+}
+
+// AddPersonaVersion appends p to its persona's version history
+func (r *RedisStorage) AddPersonaVersion(p types.Persona) error {
+	if p.Id == "" {
+		return errs.Validation("persona ID is required")
+	}
+
+	key := redisVersionsPrefix + p.Id
+	return r.atomically([]string{key}, func(c *redisConn) ([][]string, error) {
+		var history []types.PersonaVersion
+		if _, err := getJSON(c, key, &history); err != nil {
+			return nil, err
+		}
+		history = append(history, types.PersonaVersion{
+			Version:   len(history) + 1,
+			CreatedAt: time.Now(),
+			Persona:   p,
+		})
+		set, err := setCommand(key, history)
+		if err != nil {
+			return nil, err
+		}
+		return [][]string{set}, nil
+	})
+}
+
+func (r *RedisStorage) ListPersonaVersions(id string) ([]types.PersonaVersion, error) {
+	history := make([]types.PersonaVersion, 0)
+	if _, err := getJSON(r.pool, redisVersionsPrefix+id, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// checkPersonaRef verifies on c that an identity's persona exists and is
+// not soft-deleted
+func checkPersonaRef(c *redisConn, personaID string) error {
+	var p types.Persona
+	found, err := getJSON(c, redisPersonaPrefix+personaID, &p)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errs.NotFound("referenced persona not found: %s", personaID)
+	}
+	if p.DeletedAt != nil {
+		return fmt.Errorf("%w: %s", ErrPersonaDeleted, personaID)
+	}
+	return nil
+}
+
+// Identity operations
+func (r *RedisStorage) CreateIdentity(i *types.Identity) error {
+	if i == nil {
+		return errs.Validation("identity cannot be nil")
+	}
+	if i.PersonaId == "" {
+		return errs.Validation("persona ID is required")
+	}
+	if i.Name == "" {
+		return errs.Validation("identity name is required")
+	}
+
+	return r.atomically([]string{redisPersonaPrefix + i.PersonaId}, func(c *redisConn) ([][]string, error) {
+		if err := checkPersonaRef(c, i.PersonaId); err != nil {
+			return nil, err
+		}
+
+		i.Id = ids.New()
+		now := time.Now()
+		i.CreatedAt = now
+		i.UpdatedAt = now
+
+		// Set default values
+		if i.RichAttributes == nil {
+			i.RichAttributes = &types.RichAttributes{}
+		}
+		if i.Tags == nil {
+			i.Tags = []string{}
+		}
+
+		set, err := setCommand(redisIdentityPrefix+i.Id, i)
+		if err != nil {
+			return nil, err
+		}
+		return [][]string{set, {"SADD", redisIdentitiesKey, i.Id}}, nil
+	})
+}
+
+func (r *RedisStorage) GetIdentity(id string) (types.Identity, error) {
+	var i types.Identity
+	found, err := getJSON(r.pool, redisIdentityPrefix+id, &i)
+	if err != nil {
+		return types.Identity{}, err
+	}
+	if !found {
+		return types.Identity{}, errs.NotFound("identity not found: %s", id)
+	}
+	return i, nil
+}
+
+func (r *RedisStorage) ListIdentities(filter *types.IdentityFilter) ([]types.Identity, error) {
+	var result []types.Identity
+	err := loadAll(r.pool, redisIdentitiesKey, redisIdentityPrefix, func(i types.Identity) {
+		if matchesIdentityFilter(i, filter) {
+			result = append(result, i)
+		}
+	})
+	return result, err
+}
+
+func (r *RedisStorage) UpdateIdentity(id string, i types.Identity) error {
+	key := redisIdentityPrefix + id
+	return r.atomically([]string{key, redisPersonaPrefix + i.PersonaId}, func(c *redisConn) ([][]string, error) {
+		var existing types.Identity
+		found, err := getJSON(c, key, &existing)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errs.NotFound("identity not found: %s", id)
+		}
+		if err := checkPersonaRef(c, i.PersonaId); err != nil {
+			return nil, err
+		}
+
+		i.Id = id
+		i.CreatedAt = existing.CreatedAt
+		i.UpdatedAt = time.Now()
+		set, err := setCommand(key, i)
+		if err != nil {
+			return nil, err
+		}
+		return [][]string{set}, nil
+	})
+}
+
+func (r *RedisStorage) ModifyIdentity(id string, modify func(i *types.Identity) (bool, error)) (types.Identity, error) {
+	key := redisIdentityPrefix + id
+	var result types.Identity
+	err := r.atomically([]string{key}, func(c *redisConn) ([][]string, error) {
+		var current types.Identity
+		found, err := getJSON(c, key, &current)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errs.NotFound("identity not found: %s", id)
+		}
+
+		i := current
+		i.Tags = slices.Clone(current.Tags)
+		changed, err := modify(&i)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			result = current
+			return nil, nil
+		}
+		if err := checkModifiedIdentity(current, i); err != nil {
+			return nil, err
+		}
+
+		i.UpdatedAt = time.Now()
+		set, err := setCommand(key, i)
+		if err != nil {
+			return nil, err
+		}
+		result = i
+		return [][]string{set}, nil
+	})
+	if err != nil {
+		return types.Identity{}, err
+	}
+	return result, nil
+}
+
+// DeleteIdentity deletes an identity and every relationship it is part of
+func (r *RedisStorage) DeleteIdentity(id string) error {
+	key := redisIdentityPrefix + id
+	relationsKey := redisRelationsPrefix + id
+	return r.atomically([]string{key, relationsKey}, func(c *redisConn) ([][]string, error) {
+		exists, err := c.do("EXISTS", key)
+		if err != nil {
+			return nil, err
+		}
+		if exists != int64(1) {
+			return nil, errs.NotFound("identity not found: %s", id)
+		}
+
+		commands := [][]string{{"DEL", key, relationsKey}, {"SREM", redisIdentitiesKey, id}}
+		err = loadAll(c, relationsKey, redisRelationPrefix, func(rel types.Relationship) {
+			other := rel.FromId
+			if other == id {
+				other = rel.ToId
+			}
+			commands = append(commands,
+				[]string{"DEL", redisRelationPrefix + rel.Id},
+				[]string{"SREM", redisRelationsPrefix + other, rel.Id})
+		})
+		if err != nil {
+			return nil, err
+		}
+		return commands, nil
+	})
+}
+
+func (r *RedisStorage) GetIdentityWithPersona(id string) (types.IdentityWithPersona, error) {
+	i, err := r.GetIdentity(id)
+	if err != nil {
+		return types.IdentityWithPersona{}, err
+	}
+
+	var p types.Persona
+	found, err := getJSON(r.pool, redisPersonaPrefix+i.PersonaId, &p)
+	if err != nil {
+		return types.IdentityWithPersona{}, err
+	}
+	if !found {
+		return types.IdentityWithPersona{}, errs.NotFound("referenced persona not found: %s", i.PersonaId)
+	}
+
+	return types.IdentityWithPersona{
+		Identity: i,
+		Persona:  p,
+	}, nil
+}
+
+// Community operations
+func (r *RedisStorage) CreateCommunity(c *types.Community) error {
+	if c == nil {
+		return errs.Validation("community cannot be nil")
+	}
+	if c.Name == "" {
+		return errs.Validation("community name is required")
+	}
+	if c.Type == "" {
+		return errs.Validation("community type is required")
+	}
+
+	if c.Id == "" {
+		c.Id = ids.New()
+	}
+
+	// Initialize empty slices if nil
+	if c.MemberIds == nil {
+		c.MemberIds = []string{}
+	}
+	if c.Tags == nil {
+		c.Tags = []string{}
+	}
+	if c.Attributes == nil {
+		c.Attributes = make(map[string]interface{})
+	}
+
+	set, err := setCommand(redisCommunityPrefix+c.Id, c)
+	if err != nil {
+		return err
+	}
+	return r.atomically(nil, func(*redisConn) ([][]string, error) {
+		return [][]string{set, {"SADD", redisCommunitiesKey, c.Id}}, nil
+	})
+}
+
+func (r *RedisStorage) GetCommunity(id string) (types.Community, error) {
+	var c types.Community
+	found, err := getJSON(r.pool, redisCommunityPrefix+id, &c)
+	if err != nil {
+		return types.Community{}, err
+	}
+	if !found {
+		return types.Community{}, errs.NotFound("community not found: %s", id)
+	}
+	return c, nil
+}
+
+func (r *RedisStorage) ListCommunities(filter *types.CommunityFilter) ([]types.Community, error) {
+	var result []types.Community
+	err := loadAll(r.pool, redisCommunitiesKey, redisCommunityPrefix, func(c types.Community) {
+		if matchesCommunityFilter(c, filter) {
+			result = append(result, c)
+		}
+	})
+	return result, err
+}
+
+func (r *RedisStorage) UpdateCommunity(id string, c types.Community) error {
+	key := redisCommunityPrefix + id
+	return r.atomically([]string{key}, func(conn *redisConn) ([][]string, error) {
+		exists, err := conn.do("EXISTS", key)
+		if err != nil {
+			return nil, err
+		}
+		if exists != int64(1) {
+			return nil, errs.NotFound("community not found: %s", id)
+		}
+
+		c.Id = id
+		set, err := setCommand(key, c)
+		if err != nil {
+			return nil, err
+		}
+		return [][]string{set}, nil
+	})
+}
+
+func (r *RedisStorage) DeleteCommunity(id string) error {
+	key := redisCommunityPrefix + id
+	return r.atomically([]string{key}, func(c *redisConn) ([][]string, error) {
+		exists, err := c.do("EXISTS", key)
+		if err != nil {
+			return nil, err
+		}
+		if exists != int64(1) {
+			return nil, errs.NotFound("community not found: %s", id)
+		}
+		return [][]string{{"DEL", key}, {"SREM", redisCommunitiesKey, id}}, nil
+	})
+}
+
+// Relationship operations
+func (r *RedisStorage) CreateRelationship(rel *types.Relationship) error {
+	if err := validateRelationship(rel); err != nil {
+		return err
+	}
+
+	keys := []string{redisIdentityPrefix + rel.FromId, redisIdentityPrefix + rel.ToId}
+	return r.atomically(keys, func(c *redisConn) ([][]string, error) {
+		for _, id := range []string{rel.FromId, rel.ToId} {
+			exists, err := c.do("EXISTS", redisIdentityPrefix+id)
+			if err != nil {
+				return nil, err
+			}
+			if exists != int64(1) {
+				return nil, errs.NotFound("identity not found: %s", id)
+			}
+		}
+
+		rel.Id = ids.New()
+		rel.CreatedAt = time.Now()
+		set, err := setCommand(redisRelationPrefix+rel.Id, rel)
+		if err != nil {
+			return nil, err
+		}
+		return [][]string{
+			set,
+			{"SADD", redisRelationsPrefix + rel.FromId, rel.Id},
+			{"SADD", redisRelationsPrefix + rel.ToId, rel.Id},
+		}, nil
+	})
+}
+
+func (r *RedisStorage) ListRelationships(identityID string) ([]types.Relationship, error) {
+	result := make([]types.Relationship, 0)
+	err := loadAll(r.pool, redisRelationsPrefix+identityID, redisRelationPrefix, func(rel types.Relationship) {
+		result = append(result, rel)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortRelationships(result)
+	return result, nil
+}
+
+func (r *RedisStorage) DeleteRelationship(id string) error {
+	key := redisRelationPrefix + id
+	return r.atomically([]string{key}, func(c *redisConn) ([][]string, error) {
+		var rel types.Relationship
+		found, err := getJSON(c, key, &rel)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errs.NotFound("relationship not found: %s", id)
+		}
+		return [][]string{
+			{"DEL", key},
+			{"SREM", redisRelationsPrefix + rel.FromId, id},
+			{"SREM", redisRelationsPrefix + rel.ToId, id},
+		}, nil
+	})
+}
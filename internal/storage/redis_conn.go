@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This file holds the minimal RESP2 client used by RedisStorage. It
+// implements only what the storage needs: plain commands, WATCH and
+// MULTI/EXEC on a pooled connection.
+
+const (
+	redisDialTimeout    = 5 * time.Second
+	redisCommandTimeout = 5 * time.Second
+	redisMaxIdleConns   = 8
+)
+
+// redisError is an error reply sent by the server. The connection stays
+// usable after one.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisConn is one connection to the server
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+
+	// broken is set after an I/O or protocol failure; the pool then closes
+	// the connection instead of reusing it
+	broken bool
+}
+
+// do sends a command and returns its reply: a string for simple and bulk
+// strings, int64 for integers, []interface{} for arrays and nil for null
+// replies. Error replies are returned as a redisError.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(redisCommandTimeout))
+
+	fmt.Fprintf(c.writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.writer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.writer.Flush(); err != nil {
+		c.broken = true
+		return nil, err
+	}
+
+	reply, err := c.readReply()
+	if err != nil {
+		c.broken = true
+		return nil, err
+	}
+	if e, ok := reply.(redisError); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return redisError(payload), nil
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", payload)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed array length %q", payload)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for n := range items {
+			if items[n], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+	}
+}
+
+// redisPool hands out connections, dialing new ones as needed and keeping
+// up to redisMaxIdleConns idle ones for reuse
+type redisPool struct {
+	addr     string
+	password string
+	db       int
+	idle     chan *redisConn
+}
+
+func newRedisPool(addr, password string, db int) *redisPool {
+	return &redisPool{
+		addr:     addr,
+		password: password,
+		db:       db,
+		idle:     make(chan *redisConn, redisMaxIdleConns),
+	}
+}
+
+func (p *redisPool) get() (*redisConn, error) {
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+	}
+
+	conn, err := net.DialTimeout("tcp", p.addr, redisDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+
+	if p.password != "" {
+		if _, err := c.do("AUTH", p.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if p.db != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(p.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (p *redisPool) put(c *redisConn) {
+	if c.broken {
+		c.conn.Close()
+		return
+	}
+	select {
+	case p.idle <- c:
+	default:
+		c.conn.Close()
+	}
+}
+
+func (p *redisPool) close() {
+	for {
+		select {
+		case c := <-p.idle:
+			c.conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// do runs a single command on a pooled connection
+func (p *redisPool) do(args ...string) (interface{}, error) {
+	c, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+	defer p.put(c)
+	return c.do(args...)
+}
+
+// errTxAborted is returned by exec when a watched key changed
+var errTxAborted = errors.New("redis: transaction aborted")
+
+// exec queues commands in a MULTI/EXEC block on c, which may hold WATCHes
+func (c *redisConn) exec(commands [][]string) error {
+	if _, err := c.do("MULTI"); err != nil {
+		return err
+	}
+	for _, command := range commands {
+		if _, err := c.do(command...); err != nil {
+			c.do("DISCARD")
+			return err
+		}
+	}
+	reply, err := c.do("EXEC")
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return errTxAborted
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// The Redis tests only run when REDIS_ADDR points at a server. They use the
+// database in REDIS_TEST_DB (default 15) and flush it before every test, so
+// never point them at a database holding real data.
+
+// newTestRedisStorage connects to the test server with an empty database,
+// skipping the test when REDIS_ADDR is unset
+func newTestRedisStorage(t *testing.T) *RedisStorage {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+	db := 15
+	if value := os.Getenv("REDIS_TEST_DB"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			t.Fatalf("Invalid REDIS_TEST_DB: %v", err)
+		}
+		db = parsed
+	}
+
+	store, err := NewRedisStorage(addr, os.Getenv("REDIS_PASSWORD"), db)
+	if err != nil {
+		t.Fatalf("Failed to create redis storage: %v", err)
+	}
+	if _, err := store.pool.do("FLUSHDB"); err != nil {
+		t.Fatalf("Failed to flush redis test database: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// addRedisStorage adds a "redis" backend to a table of storages under test
+// when REDIS_ADDR is set
+func addRedisStorage(t *testing.T, storages map[string]Storage) {
+	t.Helper()
+	if os.Getenv("REDIS_ADDR") == "" {
+		return
+	}
+	storages["redis"] = newTestRedisStorage(t)
+}
+
+func TestNewRedisStorage_Unreachable(t *testing.T) {
+	if _, err := NewRedisStorage("127.0.0.1:1", "", 0); err == nil {
+		t.Error("Expected error connecting to an unreachable server")
+	}
+}
+
+func TestRedisStorage_Filters(t *testing.T) {
+	store := newTestRedisStorage(t)
+
+	p := &types.Persona{Name: "Expert", Topic: "Topic", Prompt: "Prompt"}
+	if err := store.Create(p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	other := &types.Persona{Name: "Other", Topic: "Topic", Prompt: "Prompt"}
+	if err := store.Create(other); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	for _, i := range []*types.Identity{
+		{PersonaId: p.Id, Name: "Alice Analyst", IsActive: true, Tags: []string{"security"}},
+		{PersonaId: p.Id, Name: "Bob Builder", IsActive: false, Tags: []string{"construction"}},
+		{PersonaId: other.Id, Name: "Carol Analyst", IsActive: true},
+	} {
+		if err := store.CreateIdentity(i); err != nil {
+			t.Fatalf("Failed to create identity: %v", err)
+		}
+	}
+
+	active := true
+	tests := map[string]struct {
+		filter *types.IdentityFilter
+		want   int
+	}{
+		"all":     {nil, 3},
+		"persona": {&types.IdentityFilter{PersonaID: p.Id}, 2},
+		"active":  {&types.IdentityFilter{IsActive: &active}, 2},
+		"tags":    {&types.IdentityFilter{Tags: []string{"security"}}, 1},
+		"search":  {&types.IdentityFilter{Search: "analyst"}, 2},
+	}
+	for name, tt := range tests {
+		identities, err := store.ListIdentities(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: ListIdentities failed: %v", name, err)
+		}
+		if len(identities) != tt.want {
+			t.Errorf("%s: expected %d identities, got %d", name, tt.want, len(identities))
+		}
+	}
+
+	for _, c := range []*types.Community{
+		{Name: "Small Group", Type: "interest", Size: 2},
+		{Name: "Large Town", Type: "geographic", Size: 50},
+	} {
+		if err := store.CreateCommunity(c); err != nil {
+			t.Fatalf("Failed to create community: %v", err)
+		}
+	}
+	minSize := 10
+	communities, err := store.ListCommunities(&types.CommunityFilter{MinSize: &minSize})
+	if err != nil {
+		t.Fatalf("ListCommunities failed: %v", err)
+	}
+	if len(communities) != 1 || communities[0].Name != "Large Town" {
+		t.Errorf("Expected only the large community, got %+v", communities)
+	}
+	if communities, _ := store.ListCommunities(&types.CommunityFilter{Type: "interest"}); len(communities) != 1 {
+		t.Errorf("Expected one interest community, got %d", len(communities))
+	}
+}
+
+// Two storages on the same server behave like two API instances
+func TestRedisStorage_SharedBetweenInstances(t *testing.T) {
+	first := newTestRedisStorage(t)
+	second, err := NewRedisStorage(os.Getenv("REDIS_ADDR"), os.Getenv("REDIS_PASSWORD"), first.pool.db)
+	if err != nil {
+		t.Fatalf("Failed to create second redis storage: %v", err)
+	}
+	defer second.Close()
+
+	p := &types.Persona{Name: "Shared", Topic: "Topic", Prompt: "Prompt"}
+	if err := first.Create(p); err != nil {
+		t.Fatalf("Failed to create persona: %v", err)
+	}
+	if got, err := second.Get(p.Id); err != nil || got.Name != "Shared" {
+		t.Fatalf("Expected the second instance to see the persona, got %+v, %v", got, err)
+	}
+
+	// Concurrent versioned updates from both instances: exactly one wins
+	var wg sync.WaitGroup
+	results := make([]error, 2)
+	for n, store := range []*RedisStorage{first, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			update := *p
+			update.Name = "Writer " + strconv.Itoa(n)
+			results[n] = store.Update(p.Id, update)
+		}()
+	}
+	wg.Wait()
+
+	conflicts := 0
+	for _, err := range results {
+		if errors.Is(err, ErrVersionConflict) {
+			conflicts++
+		} else if err != nil {
+			t.Errorf("Unexpected update error: %v", err)
+		}
+	}
+	if conflicts != 1 {
+		t.Errorf("Expected exactly one version conflict, got %d", conflicts)
+	}
+	if got, _ := first.Get(p.Id); got.Version != 2 {
+		t.Errorf("Expected version 2 after one successful update, got %d", got.Version)
+	}
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// matchesIdentitySearch reports whether an identity matches a case-insensitive
+// search term. Name and description are always searched; deep search also
+// scans occupation, city, interests and values from the rich attributes.
+func matchesIdentitySearch(i types.Identity, search string, deep bool) bool {
+	searchLower := strings.ToLower(search)
+	contains := func(value string) bool {
+		return strings.Contains(strings.ToLower(value), searchLower)
+	}
+
+	if contains(i.Name) || contains(i.Description) {
+		return true
+	}
+	if !deep || i.RichAttributes == nil {
+		return false
+	}
+
+	attrs := i.RichAttributes
+	if demographics := attrs.Demographics; demographics != nil {
+		if contains(demographics.Occupation) {
+			return true
+		}
+		if demographics.Location != nil && contains(demographics.Location.City) {
+			return true
+		}
+	}
+	if attrs.Preferences != nil {
+		for _, interest := range attrs.Preferences.Interests {
+			if contains(interest) {
+				return true
+			}
+		}
+	}
+	if attrs.Psychographics != nil {
+		for _, value := range attrs.Psychographics.Values {
+			if contains(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"regexp"
+
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/errs"
+	"github.com/fr0g-vibe/fr0g-ai-aip/internal/types"
+)
+
+// TemplateStore is implemented by storage backends that can keep named
+// community generation templates
+type TemplateStore interface {
+	// SaveCommunityTemplate stores cfg under name, replacing any template
+	// of that name
+	SaveCommunityTemplate(name string, cfg types.CommunityGenerationConfig) error
+	GetCommunityTemplate(name string) (types.CommunityTemplate, error)
+	// ListCommunityTemplates returns all templates ordered by name
+	ListCommunityTemplates() ([]types.CommunityTemplate, error)
+}
+
+// templateNamePattern keeps template names usable as file names and URL
+// path segments
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,99}$`)
+
+// validateTemplateName checks a template name before it is stored
+func validateTemplateName(name string) error {
+	if !templateNamePattern.MatchString(name) {
+		return errs.Validation("template name must be 1-100 letters, digits, '.', '_' or '-', starting with a letter or digit")
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package types
+
+// BatchOpKind names the mutation a BatchOperation performs
+type BatchOpKind string
+
+const (
+	BatchCreatePersona  BatchOpKind = "create_persona"
+	BatchUpdatePersona  BatchOpKind = "update_persona"
+	BatchDeletePersona  BatchOpKind = "delete_persona"
+	BatchCreateIdentity BatchOpKind = "create_identity"
+	BatchUpdateIdentity BatchOpKind = "update_identity"
+	BatchDeleteIdentity BatchOpKind = "delete_identity"
+)
+
+// BatchOperation is one mutation of a batch. Id names the persona or
+// identity to update or delete; Persona or Identity carries the data for a
+// create or update, matching Kind.
+type BatchOperation struct {
+	Kind     BatchOpKind `json:"kind"`
+	Id       string      `json:"id,omitempty"`
+	Persona  *Persona    `json:"persona,omitempty"`
+	Identity *Identity   `json:"identity,omitempty"`
+}
+
+// BatchOperationResult reports the outcome for one operation of a batch.
+// Index refers to the operation's position in the request and Id to the
+// persona or identity it affected. An operation that failed has Error set;
+// operations after it are Skipped, and those before it that were undone are
+// RolledBack. An earlier operation whose undo failed is still applied and
+// has Error set to the rollback failure.
+type BatchOperationResult struct {
+	Index      int    `json:"index"`
+	Id         string `json:"id,omitempty"`
+	Error      string `json:"error,omitempty"`
+	RolledBack bool   `json:"rolled_back,omitempty"`
+	Skipped    bool   `json:"skipped,omitempty"`
+}
@@ -1,6 +1,11 @@
 package types
 
-import "time"
+import (
+	"time"
+
+	pb "github.com/fr0g-vibe/fr0g-ai-aip/internal/grpc/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
 
 // Community represents a generated community of identities
 type Community struct {
@@ -13,6 +18,7 @@ type Community struct {
 	Size         int               `json:"size"`
 	Diversity    float64          `json:"diversity"`    // 0.0-1.0, measure of internal diversity
 	Cohesion     float64          `json:"cohesion"`     // 0.0-1.0, measure of group cohesion
+	MetricsMemberHash string      `json:"metrics_member_hash,omitempty"` // Member set Diversity and Cohesion were computed for
 	Attributes   map[string]interface{} `json:"attributes"` // Community-specific attributes
 	
 	// Member management
@@ -39,6 +45,10 @@ type CommunityGenerationConfig struct {
 	AgeDistribution    AgeDistribution    `json:"age_distribution"`
 	LocationConstraint LocationConstraint `json:"location_constraint"`
 	
+	// Gender weights, e.g. {"female": 0.45, "male": 0.45, "non-binary": 0.1}.
+	// Weights are normalized; empty means an even male/female split.
+	GenderDistribution map[string]float64 `json:"gender_distribution,omitempty"`
+	
 	// Diversity settings
 	PoliticalSpread    float64 `json:"political_spread"`    // 0.0-1.0, how politically diverse
 	InterestSpread     float64 `json:"interest_spread"`     // 0.0-1.0, how diverse interests are
@@ -48,9 +58,33 @@ type CommunityGenerationConfig struct {
 	NetworkDensity     float64 `json:"network_density"`     // 0.0-1.0, how interconnected
 	ClusteringFactor   float64 `json:"clustering_factor"`   // 0.0-1.0, tendency to form subgroups
 	
+	// Store relationships between similar members. A pair is linked when its
+	// similarity is at least 1 - NetworkDensity.
+	GenerateRelationships bool `json:"generate_relationships,omitempty"`
+	
 	// Behavioral parameters
 	ActivityLevel      float64 `json:"activity_level"`      // 0.0-1.0, how active members are
 	EngagementStyle    string  `json:"engagement_style"`    // "collaborative", "competitive", "passive"
+	
+	// Quality constraints
+	MinDiversity          *float64 `json:"min_diversity,omitempty"`           // 0.0-1.0, regenerate members until diversity reaches this
+	MaxGenerationAttempts int      `json:"max_generation_attempts,omitempty"` // attempts allowed to reach MinDiversity or TargetDiversity, default 10
+	
+	// Overall diversity target (0.0-1.0, 0 disables). Members are regenerated
+	// until diversity is within DiversityTolerance (default 0.05) of the
+	// target; if no attempt gets there the closest one is kept and the
+	// community's "diversity_warning" attribute says so.
+	TargetDiversity    float64 `json:"target_diversity,omitempty"`
+	DiversityTolerance float64 `json:"diversity_tolerance,omitempty"`
+	
+	// Per-dimension diversity targets (0.0-1.0), e.g. {"political_leaning": 0.9}.
+	// Best-effort: generation is biased towards each target and the achieved
+	// values are reported in the community's "diversity_by_dimension" attribute.
+	TargetDiversityByDimension map[string]float64 `json:"target_diversity_by_dimension,omitempty"`
+	
+	// Persona consistency strength (0.0-1.0): how strongly occupation,
+	// education and interests are nudged towards each member's persona topic
+	PersonaConsistency float64 `json:"persona_consistency,omitempty"`
 }
 
 // AgeDistribution defines age distribution parameters
@@ -64,11 +98,24 @@ type AgeDistribution struct {
 
 // LocationConstraint defines geographic constraints
 type LocationConstraint struct {
-	Type        string   `json:"type"`        // "city", "region", "country", "global"
+	Type        string   `json:"type"`        // "city", "region", "country", "geo", "global"
 	Locations   []string `json:"locations"`   // specific locations to include
 	Radius      float64  `json:"radius"`      // km radius for geographic clustering
 	Urban       *bool    `json:"urban"`       // true=urban, false=rural, nil=mixed
 	Timezone    string   `json:"timezone"`    // preferred timezone
+	
+	// Geo mode: members live in known cities within RadiusKm of the center
+	CenterLat float64 `json:"center_lat,omitempty"`
+	CenterLng float64 `json:"center_lng,omitempty"`
+	RadiusKm  float64 `json:"radius_km,omitempty"`
+}
+
+// CommunityTemplate is a named generation config saved for reuse
+type CommunityTemplate struct {
+	Name      string                    `json:"name"`
+	Config    CommunityGenerationConfig `json:"config"`
+	CreatedAt time.Time                 `json:"created_at"`
+	UpdatedAt time.Time                 `json:"updated_at"`
 }
 
 // CommunityFilter defines filtering options for community queries
@@ -81,6 +128,12 @@ type CommunityFilter struct {
 	MinDiversity *float64 `json:"min_diversity,omitempty"`
 	MaxDiversity *float64 `json:"max_diversity,omitempty"`
 	Search       string   `json:"search,omitempty"`
+
+	// Member aggregates, read from the attributes set when the community's
+	// metrics were calculated. Communities without them never match.
+	MinAvgAge         *float64 `json:"min_avg_age,omitempty"`
+	MaxAvgAge         *float64 `json:"max_avg_age,omitempty"`
+	DominantPolitical string   `json:"dominant_political,omitempty"` // most common political leaning
 }
 
 // CommunityMember represents a member within a community context
@@ -109,6 +162,70 @@ type CommunityStats struct {
 	GeneratedAt      time.Time         `json:"generated_at"`
 }
 
+// CommunityStatsToProto converts internal CommunityStats to protobuf
+// CommunityStats
+func CommunityStatsToProto(stats *CommunityStats) *pb.CommunityStats {
+	if stats == nil {
+		return nil
+	}
+
+	var generatedAt *timestamppb.Timestamp
+	if !stats.GeneratedAt.IsZero() {
+		generatedAt = timestamppb.New(stats.GeneratedAt)
+	}
+
+	locationSpread := make(map[string]int32, len(stats.LocationSpread))
+	for location, count := range stats.LocationSpread {
+		locationSpread[location] = int32(count)
+	}
+
+	return &pb.CommunityStats{
+		CommunityId:     stats.CommunityId,
+		MemberCount:     int32(stats.MemberCount),
+		ActiveMembers:   int32(stats.ActiveMembers),
+		AverageAge:      stats.AverageAge,
+		GenderRatio:     stats.GenderRatio,
+		LocationSpread:  locationSpread,
+		PoliticalSpread: stats.PoliticalSpread,
+		EngagementScore: stats.EngagementScore,
+		DiversityIndex:  stats.DiversityIndex,
+		CohesionScore:   stats.CohesionScore,
+		GeneratedAt:     generatedAt,
+	}
+}
+
+// ProtoToCommunityStats converts protobuf CommunityStats to internal
+// CommunityStats
+func ProtoToCommunityStats(stats *pb.CommunityStats) *CommunityStats {
+	if stats == nil {
+		return nil
+	}
+
+	var generatedAt time.Time
+	if stats.GeneratedAt != nil {
+		generatedAt = stats.GeneratedAt.AsTime()
+	}
+
+	locationSpread := make(map[string]int, len(stats.LocationSpread))
+	for location, count := range stats.LocationSpread {
+		locationSpread[location] = int(count)
+	}
+
+	return &CommunityStats{
+		CommunityId:     stats.CommunityId,
+		MemberCount:     int(stats.MemberCount),
+		ActiveMembers:   int(stats.ActiveMembers),
+		AverageAge:      stats.AverageAge,
+		GenderRatio:     stats.GenderRatio,
+		LocationSpread:  locationSpread,
+		PoliticalSpread: stats.PoliticalSpread,
+		EngagementScore: stats.EngagementScore,
+		DiversityIndex:  stats.DiversityIndex,
+		CohesionScore:   stats.CohesionScore,
+		GeneratedAt:     generatedAt,
+	}
+}
+
 // CommunityInteraction represents interactions between community members
 type CommunityInteraction struct {
 	Id           string                 `json:"id"`
@@ -0,0 +1,26 @@
+package types
+
+// ChangeKind is the kind of entity a ChangeEvent refers to
+type ChangeKind string
+
+const (
+	ChangeKindPersona   ChangeKind = "persona"
+	ChangeKindIdentity  ChangeKind = "identity"
+	ChangeKindCommunity ChangeKind = "community"
+)
+
+// ChangeOp is the operation a ChangeEvent reports
+type ChangeOp string
+
+const (
+	ChangeOpCreate ChangeOp = "create"
+	ChangeOpUpdate ChangeOp = "update"
+	ChangeOpDelete ChangeOp = "delete"
+)
+
+// ChangeEvent describes a successful change to a stored entity
+type ChangeEvent struct {
+	Kind ChangeKind `json:"kind"`
+	Op   ChangeOp   `json:"op"`
+	ID   string     `json:"id"`
+}
@@ -3,6 +3,7 @@ package types
 import (
 	"time"
 	pb "github.com/fr0g-vibe/fr0g-ai-aip/internal/grpc/pb"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -40,12 +41,27 @@ type Education = pb.Education
 type Career = pb.Career
 type AgeRange = pb.AgeRange
 
+// IdentityBatchResult reports the outcome for one identity of a batch create.
+// Index refers to the identity's position in the request.
+type IdentityBatchResult struct {
+	Index int    `json:"index"`
+	Id    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
 // IdentityWithPersona combines an identity with its base persona
 type IdentityWithPersona struct {
 	Identity Identity `json:"identity"`
 	Persona  Persona  `json:"persona"`
 }
 
+// Avatar is an image attached to an identity
+type Avatar struct {
+	ContentType string    `json:"content_type"` // image/png or image/jpeg
+	Data        []byte    `json:"data"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
 // IdentityFilter represents filters for listing identities
 type IdentityFilter struct {
 	PersonaID string   `json:"persona_id,omitempty"`
@@ -53,6 +69,15 @@ type IdentityFilter struct {
 	IsActive  *bool    `json:"is_active,omitempty"`
 	Search    string   `json:"search,omitempty"`
 
+	// DeepSearch extends Search to occupation, city, interests and values
+	DeepSearch bool `json:"deep_search,omitempty"`
+
+	// Demographic filters (inclusive ages, case-insensitive city). Identities
+	// without demographics never match them.
+	MinAge *int   `json:"min_age,omitempty"`
+	MaxAge *int   `json:"max_age,omitempty"`
+	City   string `json:"city,omitempty"`
+
 	// New filters for rich attributes
 	AgeRange         *AgeRange    `json:"age_range,omitempty"`
 	Location         *Location    `json:"location,omitempty"`
@@ -86,7 +111,7 @@ func ProtoToIdentity(pb *pb.Identity) *Identity {
 		Background:     pb.Background,
 		CreatedAt:      createdAt,
 		UpdatedAt:      updatedAt,
-		IsActive:       pb.IsActive,
+		IsActive:       pb.IsActive == nil || *pb.IsActive, // Unset means active, as over REST
 		Tags:           pb.Tags,
 		RichAttributes: pb.RichAttributes,
 	}
@@ -116,12 +141,86 @@ func IdentityToProto(i *Identity) *pb.Identity {
 		Background:     i.Background,
 		CreatedAt:      createdAt,
 		UpdatedAt:      updatedAt,
-		IsActive:       i.IsActive,
+		IsActive:       proto.Bool(i.IsActive),
 		Tags:           i.Tags,
 		RichAttributes: i.RichAttributes,
 	}
 }
 
+// IdentityFilterToProto converts internal IdentityFilter to protobuf
+// IdentityFilter. The age bounds travel as an AgeRange, whose max of 0 means
+// no upper bound, and the city as a Location.
+func IdentityFilterToProto(f *IdentityFilter) *pb.IdentityFilter {
+	if f == nil {
+		return nil
+	}
+	
+	filter := &pb.IdentityFilter{
+		PersonaId:        f.PersonaID,
+		Tags:             f.Tags,
+		Search:           f.Search,
+		DeepSearch:       f.DeepSearch,
+		PoliticalLeaning: f.PoliticalLeaning,
+		Education:        f.Education,
+		Occupation:       f.Occupation,
+		Personality:      f.Personality,
+	}
+	if f.IsActive != nil {
+		filter.IsActive = *f.IsActive
+		filter.IsActiveSet = true
+	}
+	if f.MinAge != nil || f.MaxAge != nil {
+		filter.AgeRange = &pb.AgeRange{}
+		if f.MinAge != nil {
+			filter.AgeRange.Min = int32(*f.MinAge)
+		}
+		if f.MaxAge != nil {
+			filter.AgeRange.Max = int32(*f.MaxAge)
+		}
+	}
+	if f.City != "" {
+		filter.Location = &pb.Location{City: f.City}
+	}
+	return filter
+}
+
+// ProtoToIdentityFilter converts protobuf IdentityFilter to internal
+// IdentityFilter, the reverse of IdentityFilterToProto
+func ProtoToIdentityFilter(f *pb.IdentityFilter) *IdentityFilter {
+	if f == nil {
+		return nil
+	}
+	
+	filter := &IdentityFilter{
+		PersonaID:        f.PersonaId,
+		Tags:             f.Tags,
+		Search:           f.Search,
+		DeepSearch:       f.DeepSearch,
+		PoliticalLeaning: f.PoliticalLeaning,
+		Education:        f.Education,
+		Occupation:       f.Occupation,
+		Personality:      f.Personality,
+	}
+	if f.IsActiveSet {
+		isActive := f.IsActive
+		filter.IsActive = &isActive
+	}
+	if r := f.AgeRange; r != nil {
+		if r.Min > 0 {
+			minAge := int(r.Min)
+			filter.MinAge = &minAge
+		}
+		if r.Max > 0 {
+			maxAge := int(r.Max)
+			filter.MaxAge = &maxAge
+		}
+	}
+	if f.Location != nil {
+		filter.City = f.Location.City
+	}
+	return filter
+}
+
 // NewIdentity creates a new identity with default values
 func NewIdentity() *Identity {
 	now := time.Now()
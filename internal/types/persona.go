@@ -1,22 +1,154 @@
 package types
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 	pb "github.com/fr0g-vibe/fr0g-ai-aip/internal/grpc/pb"
 )
 
 // Persona represents an AI persona with specific expertise
 type Persona struct {
-	Id      string            `json:"id"`
-	Name    string            `json:"name"`
-	Topic   string            `json:"topic"`
-	Prompt  string            `json:"prompt"`
-	Context map[string]string `json:"context"`
-	Rag     []string          `json:"rag"`
+	Id       string            `json:"id"`
+	Name     string            `json:"name"`
+	Topic    string            `json:"topic"`
+	Prompt   string            `json:"prompt"`
+	Context  map[string]string `json:"context"`
+	Rag      []string          `json:"rag"`
+	Tags     []string          `json:"tags,omitempty"`
+	Version  int               `json:"version"`
+	ParentId string            `json:"parent_id,omitempty"` // persona this one inherits from
 	
 	// Additional fields not in proto
+	RagDocuments []RAGDocument `json:"rag_documents,omitempty"` // structured retrieval documents; Rag keeps plain identifiers
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // set while soft-deleted
+	
+	// Featured personas are listed first when asked for, in ascending
+	// FeatureOrder. Both are set only through the feature endpoints.
+	Featured     bool `json:"featured,omitempty"`
+	FeatureOrder int  `json:"feature_order,omitempty"`
+}
+
+// RAGDocument is a retrieval document attached to a persona. Embedding is
+// optional and stored as given; nothing here computes embeddings.
+type RAGDocument struct {
+	Id        string    `json:"id"`
+	Title     string    `json:"title,omitempty"`
+	Source    string    `json:"source,omitempty"` // e.g. a URL or file path
+	Content   string    `json:"content,omitempty"`
+	Embedding []float32 `json:"embedding,omitempty"`
+}
+
+// PersonaFilter selects personas by content. Text matches are
+// case-insensitive substrings, and empty fields match every persona.
+type PersonaFilter struct {
+	Topic          string   `json:"topic,omitempty"`
+	Search         string   `json:"search,omitempty"` // matched against name and prompt
+	Tags           []string `json:"tags,omitempty"`   // personas with any of these tags
+	IncludeDeleted bool     `json:"include_deleted,omitempty"`
+}
+
+// PersonaVersion is a past state of a persona, recorded each time the
+// persona is updated
+type PersonaVersion struct {
+	Version   int       `json:"version"`    // 1 for the oldest recorded state
+	CreatedAt time.Time `json:"created_at"` // when this state was replaced
+	Persona   Persona   `json:"persona"`
+}
+
+// PersonaDiff describes how persona To differs from persona From. Empty
+// fields mean no difference of that kind.
+type PersonaDiff struct {
+	From           string                 `json:"from"`
+	To             string                 `json:"to"`
+	Identical      bool                   `json:"identical"`
+	Fields         []FieldChange          `json:"fields,omitempty"` // name, topic and prompt
+	ContextAdded   map[string]string      `json:"context_added,omitempty"`
+	ContextRemoved map[string]string      `json:"context_removed,omitempty"`
+	ContextChanged map[string]FieldChange `json:"context_changed,omitempty"` // keyed by context key
+	RagAdded       []string               `json:"rag_added,omitempty"`
+	RagRemoved     []string               `json:"rag_removed,omitempty"`
+}
+
+// FieldChange is a single value that differs between two personas
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// ErrUnresolvedVariables is returned when a persona template references
+// variables that were not supplied
+var ErrUnresolvedVariables = errors.New("unresolved template variables")
+
+// templateVariable matches {{name}} placeholders, allowing spaces inside
+// the braces
+var templateVariable = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// RenderPrompt returns the prompt with each {{variable}} placeholder replaced
+// by its value in vars. Placeholders without a value cause an error wrapping
+// ErrUnresolvedVariables that names all of them.
+func (p *Persona) RenderPrompt(vars map[string]string) (string, error) {
+	out, missing := substituteVariables(p.Prompt, vars)
+	if err := unresolvedError(missing); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// RenderContext returns a copy of the context with placeholders in its
+// values substituted in the same way as RenderPrompt
+func (p *Persona) RenderContext(vars map[string]string) (map[string]string, error) {
+	if p.Context == nil {
+		return nil, nil
+	}
+
+	rendered := make(map[string]string, len(p.Context))
+	var missing []string
+	for key, value := range p.Context {
+		out, unresolved := substituteVariables(value, vars)
+		rendered[key] = out
+		missing = append(missing, unresolved...)
+	}
+	if err := unresolvedError(missing); err != nil {
+		return nil, err
+	}
+	return rendered, nil
+}
+
+// substituteVariables replaces the placeholders in text that have a value in
+// vars and returns the names of those that do not
+func substituteVariables(text string, vars map[string]string) (string, []string) {
+	var missing []string
+	out := templateVariable.ReplaceAllStringFunc(text, func(match string) string {
+		name := templateVariable.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		missing = append(missing, name)
+		return match
+	})
+	return out, missing
+}
+
+// unresolvedError reports the distinct missing variable names in sorted order
+func unresolvedError(missing []string) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	names := []string{missing[0]}
+	for _, name := range missing[1:] {
+		if name != names[len(names)-1] {
+			names = append(names, name)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnresolvedVariables, strings.Join(names, ", "))
 }
 
 // ProtoToPersona converts protobuf Persona to internal Persona
@@ -25,12 +157,15 @@ func ProtoToPersona(pb *pb.Persona) *Persona {
 		return nil
 	}
 	return &Persona{
-		Id:      pb.Id,
-		Name:    pb.Name,
-		Topic:   pb.Topic,
-		Prompt:  pb.Prompt,
-		Context: pb.Context,
-		Rag:     pb.Rag,
+		Id:       pb.Id,
+		Name:     pb.Name,
+		Topic:    pb.Topic,
+		Prompt:   pb.Prompt,
+		Context:  pb.Context,
+		Rag:      pb.Rag,
+		Tags:     pb.Tags,
+		Version:  int(pb.Version),
+		ParentId: pb.ParentId,
 	}
 }
 
@@ -40,11 +175,27 @@ func PersonaToProto(p *Persona) *pb.Persona {
 		return nil
 	}
 	return &pb.Persona{
-		Id:      p.Id,
-		Name:    p.Name,
-		Topic:   p.Topic,
-		Prompt:  p.Prompt,
-		Context: p.Context,
-		Rag:     p.Rag,
+		Id:       p.Id,
+		Name:     p.Name,
+		Topic:    p.Topic,
+		Prompt:   p.Prompt,
+		Context:  p.Context,
+		Rag:      p.Rag,
+		Tags:     p.Tags,
+		Version:  int64(p.Version),
+		ParentId: p.ParentId,
 	}
 }
+
+// SystemStats summarizes the whole dataset
+type SystemStats struct {
+	TotalPersonas        int     `json:"total_personas"`
+	TotalIdentities      int     `json:"total_identities"`
+	TotalCommunities     int     `json:"total_communities"`
+	AverageCommunitySize float64 `json:"average_community_size"`
+	// MostCommonTopic is the topic shared by the most personas, the first
+	// alphabetically on a tie, or "" when there are no personas
+	MostCommonTopic      string    `json:"most_common_topic"`
+	MostCommonTopicCount int       `json:"most_common_topic_count"`
+	GeneratedAt          time.Time `json:"generated_at"`
+}
@@ -2,7 +2,11 @@ package types
 
 import (
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+
+	pb "github.com/fr0g-vibe/fr0g-ai-aip/internal/grpc/pb"
 )
 
 func TestPersonaJSONSerialization(t *testing.T) {
@@ -211,3 +215,84 @@ func TestPersonaJSONInvalidCases(t *testing.T) {
 		})
 	}
 }
+
+func TestPersonaRenderPrompt(t *testing.T) {
+	p := Persona{
+		Prompt: "You are an expert in {{domain}}. Answer in {{ language }}; stay focused on {{domain}}.",
+		Context: map[string]string{
+			"audience": "{{audience}} teams",
+			"style":    "concise",
+		},
+	}
+	
+	prompt, err := p.RenderPrompt(map[string]string{"domain": "cryptography", "language": "English", "unused": "x"})
+	if err != nil {
+		t.Fatalf("RenderPrompt failed: %v", err)
+	}
+	want := "You are an expert in cryptography. Answer in English; stay focused on cryptography."
+	if prompt != want {
+		t.Errorf("Expected %q, got %q", want, prompt)
+	}
+	
+	context, err := p.RenderContext(map[string]string{"audience": "security"})
+	if err != nil {
+		t.Fatalf("RenderContext failed: %v", err)
+	}
+	if context["audience"] != "security teams" || context["style"] != "concise" {
+		t.Errorf("Unexpected rendered context: %v", context)
+	}
+	if p.Context["audience"] != "{{audience}} teams" {
+		t.Error("Expected RenderContext not to modify the persona")
+	}
+	
+	plain := Persona{Prompt: "No placeholders {here}"}
+	if prompt, err := plain.RenderPrompt(nil); err != nil || prompt != plain.Prompt {
+		t.Errorf("Expected prompt without placeholders unchanged, got %q, %v", prompt, err)
+	}
+}
+
+func TestPersonaRenderPrompt_MissingVariables(t *testing.T) {
+	p := Persona{
+		Prompt:  "Expert in {{domain}} for {{region}}, focused on {{domain}}",
+		Context: map[string]string{"team": "{{team}}"},
+	}
+	
+	_, err := p.RenderPrompt(map[string]string{"region": "EU"})
+	if !errors.Is(err, ErrUnresolvedVariables) {
+		t.Fatalf("Expected ErrUnresolvedVariables, got %v", err)
+	}
+	if !strings.HasSuffix(err.Error(), ": domain") {
+		t.Errorf("Expected the error to name domain once, got %q", err)
+	}
+	
+	_, err = p.RenderPrompt(nil)
+	if err == nil || !strings.HasSuffix(err.Error(), ": domain, region") {
+		t.Errorf("Expected the error to name all missing variables in order, got %v", err)
+	}
+	
+	if _, err := p.RenderContext(nil); !errors.Is(err, ErrUnresolvedVariables) || !strings.Contains(err.Error(), "team") {
+		t.Errorf("Expected RenderContext to report team as unresolved, got %v", err)
+	}
+}
+
+func TestProtoToIdentityIsActive(t *testing.T) {
+	active, inactive := true, false
+	tests := []struct {
+		name string
+		set  *bool
+		want bool
+	}{
+		{"unset", nil, true},
+		{"true", &active, true},
+		{"false", &inactive, false},
+	}
+	for _, tt := range tests {
+		identity := ProtoToIdentity(&pb.Identity{PersonaId: "p", Name: "n", IsActive: tt.set})
+		if identity.IsActive != tt.want {
+			t.Errorf("%s: expected is_active %v, got %v", tt.name, tt.want, identity.IsActive)
+		}
+		if got := IdentityToProto(identity).GetIsActive(); got != tt.want {
+			t.Errorf("%s: expected is_active %v after a round trip, got %v", tt.name, tt.want, got)
+		}
+	}
+}
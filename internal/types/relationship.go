@@ -0,0 +1,19 @@
+package types
+
+import "time"
+
+// Relationship is a directed link between two identities, e.g. a friendship
+// or family tie used for social simulation
+type Relationship struct {
+	Id        string    `json:"id"`
+	FromId    string    `json:"from_id"`
+	ToId      string    `json:"to_id"`
+	Type      string    `json:"type"`     // "friend", "family", "colleague", "acquaintance"
+	Strength  float64   `json:"strength"` // 0.0-1.0, how close the tie is
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Involves reports whether the relationship starts or ends at identityID
+func (r Relationship) Involves(identityID string) bool {
+	return r.FromId == identityID || r.ToId == identityID
+}
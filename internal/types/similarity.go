@@ -0,0 +1,98 @@
+package types
+
+import "math"
+
+// IdentitySimilarity scores how alike two identities are, from 0 to 1, by
+// averaging the similarity of their age, political leaning and interests.
+// Attributes missing from either identity are left out of the average, and
+// identities sharing none of them score 0.
+func IdentitySimilarity(a, b Identity) float64 {
+	if a.RichAttributes == nil || b.RichAttributes == nil {
+		return 0
+	}
+	attrs1, attrs2 := a.RichAttributes, b.RichAttributes
+	similarities := make([]float64, 0)
+
+	// Age similarity
+	if attrs1.Demographics != nil && attrs2.Demographics != nil {
+		ageDiff := math.Abs(float64(attrs1.Demographics.Age - attrs2.Demographics.Age))
+		similarities = append(similarities, math.Max(0, 1.0-ageDiff/50.0)) // Normalize by 50-year span
+	}
+
+	// Political similarity
+	if attrs1.PoliticalSocial != nil && attrs2.PoliticalSocial != nil {
+		pol1 := attrs1.PoliticalSocial.PoliticalLeaning
+		pol2 := attrs2.PoliticalSocial.PoliticalLeaning
+		if pol1 != "" && pol2 != "" {
+			similarities = append(similarities, politicalSimilarity(pol1, pol2))
+		}
+	}
+
+	// Interest similarity
+	if attrs1.Preferences != nil && attrs2.Preferences != nil {
+		interests1 := attrs1.Preferences.Interests
+		interests2 := attrs2.Preferences.Interests
+		if len(interests1) > 0 && len(interests2) > 0 {
+			similarities = append(similarities, interestSimilarity(interests1, interests2))
+		}
+	}
+
+	if len(similarities) == 0 {
+		return 0
+	}
+
+	// Average similarity across attributes
+	total := 0.0
+	for _, sim := range similarities {
+		total += sim
+	}
+	return total / float64(len(similarities))
+}
+
+// politicalSimilarity compares two political leanings by their distance on
+// the liberal-conservative scale. Unknown leanings score 0.
+func politicalSimilarity(pol1, pol2 string) float64 {
+	politicalOrder := map[string]int{
+		"very_liberal":      0,
+		"liberal":           1,
+		"moderate":          2,
+		"conservative":      3,
+		"very_conservative": 4,
+	}
+
+	val1, ok1 := politicalOrder[pol1]
+	val2, ok2 := politicalOrder[pol2]
+	if !ok1 || !ok2 {
+		return 0
+	}
+
+	diff := math.Abs(float64(val1 - val2))
+	return math.Max(0, 1.0-diff/4.0) // Normalize by maximum difference
+}
+
+// interestSimilarity computes the Jaccard similarity of two interest lists
+func interestSimilarity(interests1, interests2 []string) float64 {
+	set1 := make(map[string]bool)
+	set2 := make(map[string]bool)
+	for _, interest := range interests1 {
+		set1[interest] = true
+	}
+	for _, interest := range interests2 {
+		set2[interest] = true
+	}
+
+	intersection := 0
+	union := len(set1)
+	for interest := range set2 {
+		if set1[interest] {
+			intersection++
+		} else {
+			union++
+		}
+	}
+
+	if union == 0 {
+		return 0
+	}
+	return float64(intersection) / float64(union)
+}